@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type maintenanceState struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message"`
+	RetryAfter int        `json:"retry_after"`
+	Since      *time.Time `json:"since"`
+}
+
+func adminMaintenance(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("admin maintenance", "on|off|status")
+	message := fs.String("message", "", "message shown to clients while on")
+	retryAfter := fs.Int("retry-after", 0, "Retry-After seconds sent with rejected writes")
+	positional, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	action := "status"
+	if len(positional) > 0 {
+		action = positional[0]
+	}
+	if len(positional) > 1 {
+		return usagef("unexpected argument %q", positional[1])
+	}
+	if a.settings.AdminToken == "" {
+		return usagef("admin token is required; set --admin-token, EVENTCTL_ADMIN_TOKEN or the config file")
+	}
+
+	var state maintenanceState
+	var raw []byte
+	switch action {
+	case "status":
+		raw, err = a.client.doJSON(ctx, http.MethodGet, "/api/v1/admin/maintenance", adminAuth, nil, &state)
+	case "on", "off":
+		body := map[string]any{"enabled": action == "on", "message": *message, "retry_after": *retryAfter}
+		raw, err = a.client.doJSON(ctx, http.MethodPost, "/api/v1/admin/maintenance", adminAuth, body, &state)
+	default:
+		return usagef("action must be on, off or status, got %q", action)
+	}
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return a.printJSON(raw)
+	}
+
+	return a.table(func(t *table) {
+		mode := "off"
+		if state.Enabled {
+			mode = "on"
+		}
+		t.row("Maintenance", mode)
+		if state.Enabled {
+			t.row("Message", state.Message)
+			t.row("Retry after", time.Duration(state.RetryAfter)*time.Second)
+		}
+		if state.Since != nil {
+			t.row("Since", state.Since.Format(time.RFC3339))
+		}
+	}, "")
+}
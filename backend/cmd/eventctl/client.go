@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// credential selects the credentials a request carries
+type credential int
+
+const (
+	noAuth credential = iota
+	tenantAuth
+	adminAuth
+)
+
+const (
+	// maxRetries bounds how often a request the server asked to retry later
+	// is sent again
+	maxRetries = 3
+	// maxRetryWait is the longest retry_after waited out; longer ones are
+	// reported instead
+	maxRetryWait = 30 * time.Second
+)
+
+// client calls the server's HTTP API
+type client struct {
+	base     *url.URL
+	http     *http.Client
+	settings settings
+}
+
+func newClient(s settings) (*client, error) {
+	base, err := url.Parse(strings.TrimRight(s.Server, "/"))
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, usagef("server must be an http or https URL, got %q", s.Server)
+	}
+	return &client{
+		base:     base,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		settings: s,
+	}, nil
+}
+
+// apiError is an error response in the server's error envelope
+type apiError struct {
+	Status    int
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   string `json:"details"`
+	RequestID string `json:"request_id"`
+	Meta      struct {
+		RetryAfter int `json:"retry_after_seconds"`
+	} `json:"meta"`
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%s (%d %s)", e.Message, e.Status, e.Code)
+	if e.Details != "" {
+		msg += ": " + e.Details
+	}
+	if e.Meta.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %ds)", e.Meta.RetryAfter)
+	}
+	if e.RequestID != "" {
+		msg += " [request " + e.RequestID + "]"
+	}
+	return msg
+}
+
+// do sends a request with an optional JSON body and returns the raw
+// response body. Non-2xx responses are returned as *apiError. A rejection
+// that says when to retry, such as a rate limit, is retried after waiting
+// that long, up to maxRetries times.
+func (c *client) do(ctx context.Context, method, path string, cred credential, body any) ([]byte, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		data, err := c.send(ctx, method, path, cred, payload)
+		apiErr, ok := err.(*apiError)
+		if !ok || apiErr.Meta.RetryAfter <= 0 || attempt == maxRetries {
+			return data, err
+		}
+		wait := time.Duration(apiErr.Meta.RetryAfter) * time.Second
+		if wait > maxRetryWait {
+			return nil, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// send makes one attempt of do
+func (c *client) send(ctx context.Context, method, path string, cred credential, payload []byte) ([]byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.base.String()+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "eventctl")
+	c.authorize(req.Header, cred)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := decodeError(resp.StatusCode, data)
+		// Servers predating error meta only send the header
+		if apiErr := err.(*apiError); apiErr.Meta.RetryAfter == 0 {
+			apiErr.Meta.RetryAfter, _ = strconv.Atoi(resp.Header.Get("Retry-After"))
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// doJSON is do followed by decoding the response into out
+func (c *client) doJSON(ctx context.Context, method, path string, cred credential, body, out any) ([]byte, error) {
+	data, err := c.do(ctx, method, path, cred, body)
+	if err != nil {
+		return nil, err
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return data, nil
+}
+
+func (c *client) authorize(h http.Header, cred credential) {
+	switch cred {
+	case tenantAuth:
+		h.Set(c.settings.APIKeyHeader, c.settings.APIKey)
+	case adminAuth:
+		h.Set("X-Admin-Token", c.settings.AdminToken)
+	}
+}
+
+// websocketURL returns the ws:// or wss:// URL of path
+func (c *client) websocketURL(path string) string {
+	u := *c.base
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+	return u.String() + path
+}
+
+// decodeError builds an apiError from an error response. Besides the error
+// envelope it understands the flat {"error", "message"} body of tenant
+// authentication, and falls back to the status text for anything else.
+func decodeError(status int, body []byte) error {
+	// Only the first JSON value counts; a rejected WebSocket upgrade can
+	// carry more than one
+	var value json.RawMessage
+	if json.NewDecoder(bytes.NewReader(body)).Decode(&value) == nil {
+		body = value
+	}
+
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil && len(envelope.Error) > 0 {
+		e := &apiError{Status: status}
+		if json.Unmarshal(envelope.Error, e) == nil && e.Code != "" {
+			return e
+		}
+		var flat struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &flat) == nil && flat.Error != "" {
+			return &apiError{Status: status, Code: flat.Error, Message: flat.Message}
+		}
+	}
+	return &apiError{Status: status, Code: "http_error", Message: http.StatusText(status)}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxLine bounds one NDJSON line on input
+const maxLine = 1 << 20
+
+// eventInput is one event to ingest; tenant_id and timestamp default to the
+// configured tenant and the current time
+type eventInput struct {
+	TenantID  string          `json:"tenant_id"`
+	EventType string          `json:"event_type"`
+	Timestamp string          `json:"timestamp"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+}
+
+// ingestResult reports one ingested line in --json mode
+type ingestResult struct {
+	Line  int             `json:"line,omitempty"`
+	Event json.RawMessage `json:"event,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+func eventIngest(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("event ingest", "")
+	eventType := fs.String("type", "", "event type of a single event")
+	timestamp := fs.String("timestamp", "", "ISO8601 timestamp of a single event (default now)")
+	metadata := fs.String("metadata", "", "JSON metadata of a single event")
+	file := fs.String("file", "", "NDJSON file of events, - for stdin (default stdin when piped)")
+	if err := a.noArgs(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireTenant(); err != nil {
+		return err
+	}
+
+	if *eventType != "" {
+		if *file != "" {
+			return usagef("--type ingests a single event; it cannot be combined with --file")
+		}
+		in := eventInput{EventType: *eventType, Timestamp: *timestamp}
+		if *metadata != "" {
+			if !json.Valid([]byte(*metadata)) {
+				return usagef("--metadata must be valid JSON")
+			}
+			in.Metadata = json.RawMessage(*metadata)
+		}
+		raw, err := a.ingest(ctx, in)
+		if err != nil {
+			return err
+		}
+		if a.json {
+			return a.printJSON(raw)
+		}
+		var created struct {
+			ID uint64 `json:"id"`
+		}
+		_ = json.Unmarshal(raw, &created)
+		fmt.Fprintf(a.stdout, "Ingested event %d\n", created.ID)
+		return nil
+	}
+
+	if *timestamp != "" || *metadata != "" {
+		return usagef("--timestamp and --metadata need --type")
+	}
+
+	var r io.Reader
+	switch {
+	case *file != "" && *file != "-":
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	case *file == "-" || !a.stdinIsTerminal():
+		r = a.stdin
+	default:
+		return usagef("give --type for a single event, or NDJSON events with --file or on stdin")
+	}
+	return a.ingestStream(ctx, r)
+}
+
+// ingestStream ingests NDJSON events one at a time. Bad lines are reported
+// and skipped; the command fails if any line failed.
+func (a *app) ingestStream(ctx context.Context, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+
+	ingested, failed, line := 0, 0, 0
+	report := func(res ingestResult) {
+		if res.Error != "" {
+			failed++
+		} else {
+			ingested++
+		}
+		if a.json {
+			data, _ := json.Marshal(res)
+			fmt.Fprintln(a.stdout, string(data))
+		} else if res.Error != "" {
+			fmt.Fprintf(a.stderr, "line %d: %s\n", res.Line, res.Error)
+		}
+	}
+
+	for scanner.Scan() {
+		line++
+		text := scanner.Bytes()
+		if len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		var in eventInput
+		if err := json.Unmarshal(text, &in); err != nil {
+			report(ingestResult{Line: line, Error: "invalid JSON: " + err.Error()})
+			continue
+		}
+		raw, err := a.ingest(ctx, in)
+		if err != nil {
+			report(ingestResult{Line: line, Error: err.Error()})
+			continue
+		}
+		report(ingestResult{Line: line, Event: raw})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read line %d: %w", line+1, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if !a.json {
+		fmt.Fprintf(a.stdout, "Ingested %d events, %d failed\n", ingested, failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d events failed", failed, ingested+failed)
+	}
+	return nil
+}
+
+// ingest posts one event, filling in the tenant and timestamp defaults
+func (a *app) ingest(ctx context.Context, in eventInput) ([]byte, error) {
+	if in.TenantID == "" {
+		in.TenantID = a.settings.TenantID
+	}
+	if in.Timestamp == "" {
+		in.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	return a.client.do(ctx, http.MethodPost, "/api/v1/events", tenantAuth, in)
+}
+
+func eventTail(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("event tail", "")
+	var types listFlag
+	fs.Var(&types, "event-type", "only print events of this type (repeatable, or comma-separated)")
+	if err := a.noArgs(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireTenant(); err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	a.client.authorize(header, tenantAuth)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, a.client.websocketURL("/api/v1/ws"), header)
+	if err != nil {
+		if resp != nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return decodeError(resp.StatusCode, body)
+		}
+		return err
+	}
+	defer conn.Close()
+
+	// Close the connection when interrupted so ReadMessage returns
+	stop := context.AfterFunc(ctx, func() {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		conn.Close()
+	})
+	defer stop()
+
+	wanted := make(map[string]bool, len(types))
+	for _, t := range types {
+		wanted[t] = true
+	}
+	fmt.Fprintln(a.stderr, "Connected; waiting for events. Press Ctrl+C to stop.")
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil || websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return nil
+			}
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				return fmt.Errorf("server closed the connection: %s", closeErr.Text)
+			}
+			return err
+		}
+
+		// Events are sent bare; server notices carry a type and payload
+		var msg struct {
+			EventType string          `json:"event_type"`
+			Type      string          `json:"type"`
+			Payload   json.RawMessage `json:"payload"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		if msg.EventType == "" {
+			fmt.Fprintf(a.stderr, "notice: %s %s\n", msg.Type, msg.Payload)
+			continue
+		}
+		if len(wanted) > 0 && !wanted[msg.EventType] {
+			continue
+		}
+		fmt.Fprintln(a.stdout, string(data))
+	}
+}
+
+func stats(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("stats", "")
+	if err := a.noArgs(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireTenant(); err != nil {
+		return err
+	}
+
+	var resp struct {
+		Stats            map[string]int64 `json:"stats"`
+		UnprocessedCount int64            `json:"unprocessed_count"`
+	}
+	raw, err := a.client.doJSON(ctx, http.MethodGet, "/api/v1/events/stats", tenantAuth, nil, &resp)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return a.printJSON(raw)
+	}
+
+	types := make([]string, 0, len(resp.Stats))
+	for t := range resp.Stats {
+		if t != "total" {
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	return a.table(func(t *table) {
+		t.row("EVENT TYPE", "COUNT")
+		for _, name := range types {
+			t.row(name, resp.Stats[name])
+		}
+		t.row("total", resp.Stats["total"])
+		t.row("unprocessed", resp.UnprocessedCount)
+	}, "")
+}
@@ -0,0 +1,253 @@
+// Command eventctl operates an event ingestion server from the command line.
+//
+// Credentials and the server URL come from flags, EVENTCTL_* environment
+// variables or a YAML config file, in that order of precedence. Run
+// `eventctl help` for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// command is one subcommand; name has one or two words
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, a *app, args []string) error
+}
+
+var commands = []command{
+	{"tenant create", "Register a tenant and print its credentials", tenantCreate},
+	{"tenant list", "List tenants (--keys to include API keys)", tenantList},
+	{"tenant rotate-key", "Replace the configured tenant's API key", tenantRotateKey},
+	{"event ingest", "Ingest one event, or NDJSON events from a file or stdin", eventIngest},
+	{"event tail", "Print live events as NDJSON", eventTail},
+	{"stats", "Count the tenant's events by type", stats},
+	{"webhook create", "Subscribe a URL to events", webhookCreate},
+	{"webhook list", "List the tenant's webhooks", webhookList},
+	{"webhook test", "Send a test delivery to a webhook", webhookTest},
+	{"admin maintenance", "Show or switch maintenance mode (on|off|status)", adminMaintenance},
+}
+
+// settings are the connection settings shared by every command
+type settings struct {
+	Server       string `yaml:"server"`
+	TenantID     string `yaml:"tenant_id"`
+	APIKey       string `yaml:"api_key"`
+	APIKeyHeader string `yaml:"api_key_header"`
+	AdminToken   string `yaml:"admin_token"`
+}
+
+// app carries the I/O streams, parsed global flags and resolved client
+type app struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// stdinIsTerminal reports whether stdin is interactive, so ingest knows
+	// whether to read NDJSON from it
+	stdinIsTerminal func() bool
+
+	flags      settings
+	configPath string
+	json       bool
+
+	settings settings
+	client   *client
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a := &app{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		stdinIsTerminal: func() bool {
+			fi, err := os.Stdin.Stat()
+			return err == nil && fi.Mode()&os.ModeCharDevice != 0
+		},
+	}
+	os.Exit(a.run(ctx, os.Args[1:]))
+}
+
+// run executes one command and returns the process exit code
+func (a *app) run(ctx context.Context, args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		a.usage(a.stdout)
+		return 0
+	}
+
+	cmd, rest := lookup(args)
+	if cmd == nil {
+		fmt.Fprintf(a.stderr, "eventctl: unknown command %q\n\n", strings.Join(args[:min(2, len(args))], " "))
+		a.usage(a.stderr)
+		return 2
+	}
+
+	if err := cmd.run(ctx, a, rest); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(a.stderr, "eventctl %s: %v\n", cmd.name, err)
+		var usage usageError
+		if errors.As(err, &usage) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// lookup finds the command named by the first one or two arguments
+func lookup(args []string) (*command, []string) {
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == commands[i].name {
+			return &commands[i], args[len(words):]
+		}
+	}
+	return nil, nil
+}
+
+func (a *app) usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: eventctl <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Every command accepts --server, --tenant, --api-key, --admin-token, --config and --json.")
+	fmt.Fprintln(w, "Unset flags fall back to EVENTCTL_SERVER, EVENTCTL_TENANT_ID, EVENTCTL_API_KEY,")
+	fmt.Fprintln(w, "EVENTCTL_ADMIN_TOKEN and then to the config file (EVENTCTL_CONFIG, default")
+	fmt.Fprintf(w, "%s).\n", defaultConfigPath())
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run `eventctl <command> -h` for the flags of a command.")
+}
+
+// usageError marks an error in the command line rather than in the request
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...any) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+// flagSet returns a flag set for the named command with the global flags
+// registered
+func (a *app) flagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet("eventctl "+name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: eventctl %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&a.flags.Server, "server", "", "server URL (default http://localhost:8080)")
+	fs.StringVar(&a.flags.TenantID, "tenant", "", "tenant ID")
+	fs.StringVar(&a.flags.APIKey, "api-key", "", "tenant API key")
+	fs.StringVar(&a.flags.AdminToken, "admin-token", "", "admin token for admin commands")
+	fs.StringVar(&a.configPath, "config", "", "config file")
+	fs.BoolVar(&a.json, "json", false, "print JSON instead of tables")
+	return fs
+}
+
+// parse parses flags and resolves the settings and client. Positional
+// arguments may come before or after flags.
+func (a *app) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, usageError{err.Error()}
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if err := a.resolve(); err != nil {
+		return nil, err
+	}
+	return positional, nil
+}
+
+// resolve merges flags, environment and config file into a.settings
+func (a *app) resolve() error {
+	path := first(a.configPath, os.Getenv("EVENTCTL_CONFIG"))
+	explicit := path != ""
+	if path == "" {
+		path = defaultConfigPath()
+	}
+
+	var file settings
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+		// The default config file is optional
+	default:
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	a.settings = settings{
+		Server:       first(a.flags.Server, os.Getenv("EVENTCTL_SERVER"), file.Server, "http://localhost:8080"),
+		TenantID:     first(a.flags.TenantID, os.Getenv("EVENTCTL_TENANT_ID"), file.TenantID),
+		APIKey:       first(a.flags.APIKey, os.Getenv("EVENTCTL_API_KEY"), file.APIKey),
+		APIKeyHeader: first(os.Getenv("EVENTCTL_API_KEY_HEADER"), file.APIKeyHeader, "X-API-Key"),
+		AdminToken:   first(a.flags.AdminToken, os.Getenv("EVENTCTL_ADMIN_TOKEN"), file.AdminToken),
+	}
+
+	a.client, err = newClient(a.settings)
+	return err
+}
+
+// requireTenant checks that tenant credentials are configured
+func (a *app) requireTenant() error {
+	if a.settings.TenantID == "" || a.settings.APIKey == "" {
+		return usagef("tenant ID and API key are required; set --tenant and --api-key, EVENTCTL_TENANT_ID and EVENTCTL_API_KEY, or the config file")
+	}
+	return nil
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "eventctl.yaml"
+	}
+	return filepath.Join(dir, "eventctl", "config.yaml")
+}
+
+// first returns the first non-empty value
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/testsupport"
+)
+
+// lockedBuffer is a bytes.Buffer a command can write while the test reads
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// isolate clears the EVENTCTL_* environment and points the config at an
+// empty file, so only what a test sets is seen
+func isolate(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{"EVENTCTL_SERVER", "EVENTCTL_TENANT_ID", "EVENTCTL_API_KEY", "EVENTCTL_API_KEY_HEADER", "EVENTCTL_ADMIN_TOKEN"} {
+		t.Setenv(name, "")
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EVENTCTL_CONFIG", path)
+}
+
+// newTestApp returns an app reading stdin from input, which counts as
+// piped unless it is empty
+func newTestApp(input string) (*app, *lockedBuffer, *lockedBuffer) {
+	stdout, stderr := &lockedBuffer{}, &lockedBuffer{}
+	return &app{
+		stdin:           strings.NewReader(input),
+		stdout:          stdout,
+		stderr:          stderr,
+		stdinIsTerminal: func() bool { return input == "" },
+	}, stdout, stderr
+}
+
+func TestRunParsesArguments(t *testing.T) {
+	credentials := []string{"--server", "http://127.0.0.1:1", "--tenant", "t", "--api-key", "k"}
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{"no command", nil, "", 0, "Usage: eventctl <command>", ""},
+		{"help", []string{"help"}, "", 0, "event ingest", ""},
+		{"unknown command", []string{"event", "nope"}, "", 2, "", `unknown command "event nope"`},
+		{"command help", []string{"event", "ingest", "-h"}, "", 0, "", "Usage: eventctl event ingest"},
+		{"unknown flag", []string{"stats", "--nope"}, "", 2, "", "flag provided but not defined: -nope"},
+		{"unexpected argument", append([]string{"stats", "extra"}, credentials...), "", 2, "", `unexpected argument "extra"`},
+		{"bad server", []string{"stats", "--server", "localhost:8080"}, "", 2, "", "server must be an http or https URL"},
+		{"missing credentials", []string{"event", "ingest", "--type", "a"}, "", 2, "", "tenant ID and API key are required"},
+		{"type with file", append([]string{"event", "ingest", "--type", "a", "--file", "x.ndjson"}, credentials...), "", 2, "", "cannot be combined with --file"},
+		{"bad metadata", append([]string{"event", "ingest", "--type", "a", "--metadata", "{"}, credentials...), "", 2, "", "--metadata must be valid JSON"},
+		{"metadata without type", append([]string{"event", "ingest", "--metadata", "{}"}, credentials...), "", 2, "", "--timestamp and --metadata need --type"},
+		{"nothing to ingest", append([]string{"event", "ingest"}, credentials...), "", 2, "", "give --type for a single event"},
+		{"missing file", append([]string{"event", "ingest", "--file", "missing.ndjson"}, credentials...), "", 1, "", "missing.ndjson"},
+		{"flags after positional", []string{"admin", "maintenance", "status", "--server", "ftp://x"}, "", 2, "", "server must be an http or https URL"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			isolate(t)
+			a, stdout, stderr := newTestApp(tc.stdin)
+			if code := a.run(context.Background(), tc.args); code != tc.code {
+				t.Fatalf("exit code %d, want %d; stderr: %s", code, tc.code, stderr)
+			}
+			if !strings.Contains(stdout.String(), tc.stdout) {
+				t.Errorf("stdout %q does not contain %q", stdout, tc.stdout)
+			}
+			if !strings.Contains(stderr.String(), tc.stderr) {
+				t.Errorf("stderr %q does not contain %q", stderr, tc.stderr)
+			}
+		})
+	}
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		flag string
+		env  string
+		file string
+		want string
+	}{
+		{"default", "", "", "", "http://localhost:8080"},
+		{"config file", "", "", "http://file:1", "http://file:1"},
+		{"environment over file", "", "http://env:1", "http://file:1", "http://env:1"},
+		{"flag over environment", "http://flag:1", "http://env:1", "http://file:1", "http://flag:1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			isolate(t)
+			t.Setenv("EVENTCTL_SERVER", tc.env)
+			if tc.file != "" {
+				if err := os.WriteFile(os.Getenv("EVENTCTL_CONFIG"), []byte("server: "+tc.file+"\n"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			a, _, _ := newTestApp("")
+			args := []string{}
+			if tc.flag != "" {
+				args = append(args, "--server", tc.flag)
+			}
+			if _, err := a.parse(a.flagSet("stats", ""), args); err != nil {
+				t.Fatal(err)
+			}
+			if a.settings.Server != tc.want {
+				t.Fatalf("server %q, want %q", a.settings.Server, tc.want)
+			}
+		})
+	}
+}
+
+// serverArgs returns the flags that point eventctl at s as its tenant
+func serverArgs(s *testsupport.Server) []string {
+	return []string{"--server", s.URL, "--tenant", s.Tenant.ID, "--api-key", s.Tenant.APIKey}
+}
+
+func countEvents(t *testing.T, s *testsupport.Server, eventType string) int64 {
+	t.Helper()
+	var n int64
+	if err := s.App.DB.DB.Model(&models.Event{}).Where("tenant_id = ? AND event_type = ?", s.Tenant.ID, eventType).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestEventIngest(t *testing.T) {
+	s := testsupport.Start(t)
+	for _, tc := range []struct {
+		name      string
+		args      []string
+		stdin     string
+		code      int
+		stdout    string
+		eventType string
+		stored    int64
+	}{
+		{"single", []string{"--type", "cli.single", "--metadata", `{"a":1}`}, "", 0, "Ingested event ", "cli.single", 1},
+		{"single json", []string{"--type", "cli.json", "--json"}, "", 0, `"event_type":"cli.json"`, "cli.json", 1},
+		{"stdin", nil, "{\"event_type\":\"cli.stdin\"}\n\n{\"event_type\":\"cli.stdin\",\"metadata\":{\"n\":2}}\n", 0, "Ingested 2 events, 0 failed", "cli.stdin", 2},
+		// Bad lines are reported and skipped; the rest are stored
+		{"stdin with bad lines", []string{"--file", "-"}, "{\"event_type\":\"cli.mixed\"}\nnot json\n{\"event_type\":\"\"}\n{\"event_type\":\"cli.mixed\"}\n", 1, "Ingested 2 events, 2 failed", "cli.mixed", 2},
+		{"stdin json", []string{"--json"}, "{\"event_type\":\"cli.ndjson\"}\nnot json\n", 1, `{"line":2,"error":"invalid JSON`, "cli.ndjson", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			isolate(t)
+			a, stdout, stderr := newTestApp(tc.stdin)
+			args := append(append([]string{"event", "ingest"}, tc.args...), serverArgs(s)...)
+			if code := a.run(context.Background(), args); code != tc.code {
+				t.Fatalf("exit code %d, want %d; stderr: %s", code, tc.code, stderr)
+			}
+			if !strings.Contains(stdout.String(), tc.stdout) {
+				t.Errorf("stdout %q does not contain %q", stdout, tc.stdout)
+			}
+			if n := countEvents(t, s, tc.eventType); n != tc.stored {
+				t.Errorf("stored %d %s events, want %d", n, tc.eventType, tc.stored)
+			}
+		})
+	}
+
+	t.Run("rejected credentials", func(t *testing.T) {
+		isolate(t)
+		a, _, stderr := newTestApp("")
+		args := []string{"event", "ingest", "--type", "cli.denied", "--server", s.URL, "--tenant", s.Tenant.ID, "--api-key", "wrong"}
+		if code := a.run(context.Background(), args); code != 1 {
+			t.Fatalf("exit code %d, want 1", code)
+		}
+		if !strings.Contains(stderr.String(), "(401 unauthorized)") {
+			t.Errorf("stderr %q does not report the 401", stderr)
+		}
+	})
+}
+
+func TestEventTail(t *testing.T) {
+	s := testsupport.Start(t)
+	for _, tc := range []struct {
+		name    string
+		filters []string
+		want    []string
+		skipped []string
+	}{
+		{"every event", nil, []string{"tail.a", "tail.b"}, nil},
+		{"filtered", []string{"--event-type", "tail.a,tail.c"}, []string{"tail.a"}, []string{"tail.b"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			isolate(t)
+			a, stdout, stderr := newTestApp("")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			code := make(chan int, 1)
+			go func() {
+				code <- a.run(ctx, append(append([]string{"event", "tail"}, tc.filters...), serverArgs(s)...))
+			}()
+			waitFor(t, func() bool { return strings.Contains(stderr.String(), "Connected") }, "tail to connect: "+stderr.String())
+
+			// The skipped types go first, so once the wanted ones are
+			// printed the skipped ones have been seen and dropped
+			for _, eventType := range append(append([]string{}, tc.skipped...), tc.want...) {
+				event := models.EventRequest{
+					TenantID:  s.Tenant.ID,
+					EventType: eventType,
+					Timestamp: time.Now().UTC().Format(time.RFC3339),
+					Metadata:  []byte(`{}`),
+				}
+				if status, err := s.Client.JSON(http.MethodPost, "/api/v1/events", event, nil); err != nil || status != http.StatusCreated {
+					t.Fatalf("ingest %s: status %d: %v", eventType, status, err)
+				}
+			}
+			waitFor(t, func() bool { return strings.Count(stdout.String(), "\n") >= len(tc.want) }, "tail to print the events")
+
+			cancel()
+			select {
+			case c := <-code:
+				if c != 0 {
+					t.Fatalf("exit code %d; stderr: %s", c, stderr)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("tail did not stop when cancelled")
+			}
+
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			if len(lines) != len(tc.want) {
+				t.Fatalf("printed %d lines, want %d: %q", len(lines), len(tc.want), lines)
+			}
+			for i, eventType := range tc.want {
+				if !strings.Contains(lines[i], `"event_type":"`+eventType+`"`) {
+					t.Errorf("line %d = %s, want a %s event", i+1, lines[i], eventType)
+				}
+			}
+		})
+	}
+}
+
+func waitFor(t *testing.T, done func() bool, what string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !done(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// table writes aligned columns
+type table struct {
+	tw *tabwriter.Writer
+}
+
+func (t *table) row(cols ...any) {
+	parts := make([]string, len(cols))
+	for i, c := range cols {
+		parts[i] = fmt.Sprint(c)
+	}
+	fmt.Fprintln(t.tw, strings.Join(parts, "\t"))
+}
+
+// table renders rows to stdout, then prints the optional note to stderr so
+// piping the table elsewhere keeps it clean
+func (a *app) table(rows func(t *table), note string, args ...any) error {
+	t := &table{tw: tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)}
+	rows(t)
+	if err := t.tw.Flush(); err != nil {
+		return err
+	}
+	if note != "" {
+		fmt.Fprintf(a.stderr, note+"\n", args...)
+	}
+	return nil
+}
+
+// printJSON writes a response body as received, one document per line
+func (a *app) printJSON(raw []byte) error {
+	_, err := fmt.Fprintln(a.stdout, strings.TrimSpace(string(raw)))
+	return err
+}
+
+// noArgs parses flags for a command that takes no positional arguments
+func (a *app) noArgs(fs *flag.FlagSet, args []string) error {
+	positional, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("unexpected argument %q", positional[0])
+	}
+	return nil
+}
+
+// listFlag is a repeatable flag that also accepts comma-separated values
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type tenantInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Active    bool      `json:"active"`
+	APIKey    string    `json:"api_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func tenantCreate(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("tenant create", "<name>")
+	name := fs.String("name", "", "tenant name (or the first argument)")
+	positional, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *name == "" && len(positional) > 0 {
+		*name, positional = positional[0], positional[1:]
+	}
+	if *name == "" || len(positional) > 0 {
+		return usagef("give exactly one tenant name")
+	}
+
+	var created struct {
+		tenantInfo
+		Token string `json:"token"`
+	}
+	raw, err := a.client.doJSON(ctx, http.MethodPost, "/api/v1/tenants", noAuth, map[string]string{"name": *name}, &created)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return a.printJSON(raw)
+	}
+
+	return a.table(func(t *table) {
+		t.row("ID", created.ID)
+		t.row("Name", created.Name)
+		t.row("API key", created.APIKey)
+	}, "The API key is not shown again. To use this tenant, run:\n  export EVENTCTL_TENANT_ID=%s EVENTCTL_API_KEY=%s", created.ID, created.APIKey)
+}
+
+func tenantList(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("tenant list", "")
+	keys := fs.Bool("keys", false, "include API keys")
+	if err := a.noArgs(fs, args); err != nil {
+		return err
+	}
+
+	path := "/api/v1/tenants"
+	if *keys {
+		path = "/api/v1/tenants-with-keys"
+	}
+	var resp struct {
+		Tenants []tenantInfo `json:"tenants"`
+	}
+	raw, err := a.client.doJSON(ctx, http.MethodGet, path, noAuth, nil, &resp)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return a.printJSON(raw)
+	}
+
+	return a.table(func(t *table) {
+		header := []any{"ID", "NAME", "ACTIVE", "CREATED"}
+		if *keys {
+			header = append(header, "API KEY")
+		}
+		t.row(header...)
+		for _, tn := range resp.Tenants {
+			cols := []any{tn.ID, tn.Name, tn.Active, tn.CreatedAt.Format(time.RFC3339)}
+			if *keys {
+				cols = append(cols, tn.APIKey)
+			}
+			t.row(cols...)
+		}
+	}, "")
+}
+
+func tenantRotateKey(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("tenant rotate-key", "")
+	if err := a.noArgs(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireTenant(); err != nil {
+		return err
+	}
+
+	var resp struct {
+		APIKey string `json:"api_key"`
+	}
+	path := "/api/v1/tenants/" + url.PathEscape(a.settings.TenantID) + "/rotate-key"
+	raw, err := a.client.doJSON(ctx, http.MethodPost, path, tenantAuth, nil, &resp)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return a.printJSON(raw)
+	}
+
+	fmt.Fprintln(a.stdout, resp.APIKey)
+	fmt.Fprintln(a.stderr, "The old key no longer works; update EVENTCTL_API_KEY or the config file.")
+	return nil
+}
@@ -0,0 +1,343 @@
+// Package alert evaluates tenants' alert rules: event counts over a window
+// against a threshold, the absence of an expected event, and events whose
+// metadata matches. State changes are sent through the webhook dispatcher
+// and to the tenant's WebSocket clients.
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/webhook"
+	"event-ingestion-system/internal/websocket"
+)
+
+const (
+	// MinWindow and MaxWindow bound a rule's window
+	MinWindow = time.Minute
+	MaxWindow = 7 * 24 * time.Hour
+	// maxMatchKeys bounds the metadata paths of a metadata_match rule
+	maxMatchKeys = 20
+	// matchScanLimit bounds the events a metadata_match rule inspects per
+	// evaluation, newest first
+	matchScanLimit = 1000
+)
+
+// Payload is the JSON body sent for a state change, distinguished from event
+// deliveries by its type. Over WebSocket it is the payload of a message of
+// type "alert".
+type Payload struct {
+	Type  string `json:"type"`  // always "alert"
+	State string `json:"state"` // firing or resolved
+	// Repeat marks a reminder that the rule is still firing
+	Repeat bool `json:"repeat,omitempty"`
+	Rule   Info `json:"rule"`
+	// Value is the event count in the window, or for absence rules the
+	// seconds since the last event
+	Value   int64     `json:"value"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"` // when the rule entered its state
+	At      time.Time `json:"at"`
+}
+
+// Info identifies the rule a payload belongs to
+type Info struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Condition string `json:"condition"`
+	EventType string `json:"event_type"`
+	Window    string `json:"window"`
+	Threshold int64  `json:"threshold,omitempty"`
+}
+
+// Evaluator evaluates active alert rules periodically
+type Evaluator struct {
+	db       *database.Database
+	events   database.EventStore
+	webhooks *webhook.Dispatcher
+	hub      *websocket.Hub
+	cfg      config.AlertsConfig
+	logger   *slog.Logger
+
+	seen lastSeen
+	// deliveries tracks webhook notifications so Run can wait for them
+	deliveries sync.WaitGroup
+}
+
+// NewEvaluator creates an alert evaluator
+func NewEvaluator(db *database.Database, events database.EventStore, webhooks *webhook.Dispatcher, hub *websocket.Hub, cfg config.AlertsConfig, logger *slog.Logger) *Evaluator {
+	return &Evaluator{
+		db:       db,
+		events:   events,
+		webhooks: webhooks,
+		hub:      hub,
+		cfg:      cfg,
+		logger:   logger.With("component", "alerts"),
+		seen:     lastSeen{times: make(map[seenKey]time.Time)},
+	}
+}
+
+// ParseWindow parses a rule's window
+func ParseWindow(text string) (time.Duration, error) {
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", text)
+	}
+	if d < MinWindow || d > MaxWindow {
+		return 0, fmt.Errorf("must be between %s and %s", MinWindow, MaxWindow)
+	}
+	return d, nil
+}
+
+// Validate checks the parts of a request that do not depend on other
+// records, and defaults the threshold of metadata_match rules
+func Validate(req *models.AlertRuleRequest) error {
+	if _, err := ParseWindow(req.Window); err != nil {
+		return fmt.Errorf("window: %w", err)
+	}
+	if req.RenotifyAfter != "" {
+		if _, err := ParseWindow(req.RenotifyAfter); err != nil {
+			return fmt.Errorf("renotify_after: %w", err)
+		}
+	}
+
+	switch req.Condition {
+	case models.AlertThreshold:
+		if req.Threshold < 1 {
+			return fmt.Errorf("threshold must be at least 1")
+		}
+	case models.AlertAbsence:
+		if req.Threshold != 0 {
+			return fmt.Errorf("threshold does not apply to absence rules")
+		}
+	case models.AlertMetadataMatch:
+		if req.Threshold == 0 {
+			req.Threshold = 1
+		}
+	default:
+		return fmt.Errorf("condition must be threshold, absence or metadata_match")
+	}
+
+	if req.Condition != models.AlertMetadataMatch {
+		if len(req.Match) > 0 {
+			return fmt.Errorf("match only applies to metadata_match rules")
+		}
+		return nil
+	}
+	if len(req.Match) == 0 {
+		return fmt.Errorf("match is required for metadata_match rules")
+	}
+	if len(req.Match) > maxMatchKeys {
+		return fmt.Errorf("match has more than %d keys", maxMatchKeys)
+	}
+	for path, want := range req.Match {
+		if path == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") || strings.Contains(path, "..") {
+			return fmt.Errorf("match key %q is not a dotted path", path)
+		}
+		switch want.(type) {
+		case nil, string, float64, bool:
+		default:
+			return fmt.Errorf("match value of %q must be a string, number, boolean or null", path)
+		}
+	}
+	return nil
+}
+
+// Observe records an event for absence rules. It is called for every
+// stored event and must not block.
+func (e *Evaluator) Observe(event *models.Event) {
+	e.seen.observe(event.TenantID, event.EventType, event.Timestamp)
+}
+
+// Run evaluates the active rules every evaluation interval until ctx is
+// cancelled, then waits for notifications in flight. It returns at once when
+// alerts are disabled.
+func (e *Evaluator) Run(ctx context.Context) {
+	if !e.cfg.Enabled {
+		return
+	}
+	defer e.deliveries.Wait()
+
+	ticker := time.NewTicker(e.cfg.EvaluationInterval)
+	defer ticker.Stop()
+
+	for {
+		e.evaluateAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// evaluateAll evaluates every active rule and handles state changes
+func (e *Evaluator) evaluateAll(ctx context.Context) {
+	db := e.db.WithContext(ctx)
+
+	rules, err := db.GetActiveAlertRules()
+	if err != nil {
+		e.logger.ErrorContext(ctx, "Failed to load alert rules", "error", err)
+		return
+	}
+
+	watched := make(map[seenKey]bool)
+	for _, rule := range rules {
+		if rule.Condition == models.AlertAbsence {
+			watched[seenKey{rule.TenantID, rule.EventType}] = true
+		}
+	}
+	e.seen.watch(watched)
+
+	for _, rule := range rules {
+		if ctx.Err() != nil {
+			return
+		}
+		now := time.Now().UTC()
+
+		value, firing, message, err := e.evaluate(ctx, rule, now)
+		if err != nil {
+			e.logger.ErrorContext(ctx, "Failed to evaluate alert rule", "rule_id", rule.ID, "tenant_id", rule.TenantID, "error", err)
+			continue
+		}
+		if err := db.RecordAlertEvaluation(rule.ID, now, value); err != nil {
+			e.logger.ErrorContext(ctx, "Failed to record alert evaluation", "rule_id", rule.ID, "error", err)
+		}
+
+		switch {
+		case firing && rule.State != models.AlertFiring:
+			e.transition(ctx, rule, models.AlertFiring, value, message, now)
+		case !firing && rule.State == models.AlertFiring:
+			e.transition(ctx, rule, models.AlertOK, value, message, now)
+		case firing && e.renotifyDue(rule, now):
+			claimed, err := db.ClaimAlertRenotify(rule.ID, *rule.LastNotifiedAt, now)
+			if err != nil {
+				e.logger.ErrorContext(ctx, "Failed to claim alert renotification", "rule_id", rule.ID, "error", err)
+				continue
+			}
+			if claimed {
+				e.notify(ctx, rule, e.payload(rule, models.AlertFiring, true, value, message, rule.StateSince, now), 0)
+			}
+		}
+	}
+}
+
+// renotifyDue reports whether a firing rule should be notified again
+func (e *Evaluator) renotifyDue(rule models.AlertRule, now time.Time) bool {
+	if rule.RenotifyAfter == "" || rule.LastNotifiedAt == nil {
+		return false
+	}
+	after, err := time.ParseDuration(rule.RenotifyAfter)
+	return err == nil && !now.Before(rule.LastNotifiedAt.Add(after))
+}
+
+// transition moves a rule to a new state, records it in the rule's history
+// and notifies. Claiming the transition first keeps replicas from notifying
+// twice.
+func (e *Evaluator) transition(ctx context.Context, rule models.AlertRule, to string, value int64, message string, now time.Time) {
+	db := e.db.WithContext(ctx)
+
+	claimed, err := db.ClaimAlertTransition(rule.ID, rule.State, to, now)
+	if err != nil {
+		e.logger.ErrorContext(ctx, "Failed to claim alert transition", "rule_id", rule.ID, "error", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	state := to
+	if to == models.AlertOK {
+		state = models.AlertResolved
+	}
+	e.logger.InfoContext(ctx, "Alert "+state, "rule_id", rule.ID, "tenant_id", rule.TenantID, "value", value)
+
+	entry := &models.AlertHistory{
+		RuleID:   rule.ID,
+		TenantID: rule.TenantID,
+		State:    state,
+		Value:    value,
+		Message:  message,
+	}
+	if err := db.CreateAlertHistory(entry); err != nil {
+		e.logger.ErrorContext(ctx, "Failed to record alert history", "rule_id", rule.ID, "error", err)
+	}
+	e.notify(ctx, rule, e.payload(rule, state, false, value, message, now, now), entry.ID)
+}
+
+func (e *Evaluator) payload(rule models.AlertRule, state string, repeat bool, value int64, message string, since, now time.Time) Payload {
+	return Payload{
+		Type:   "alert",
+		State:  state,
+		Repeat: repeat,
+		Rule: Info{
+			ID:        rule.ID,
+			Name:      rule.Name,
+			Condition: rule.Condition,
+			EventType: rule.EventType,
+			Window:    rule.Window,
+			Threshold: rule.Threshold,
+		},
+		Value:   value,
+		Message: message,
+		Since:   since,
+		At:      now,
+	}
+}
+
+// notify sends a payload to the tenant's WebSocket clients and, in the
+// background, to the rule's webhook or URL. A failed delivery is stored on
+// the history entry, if there is one.
+func (e *Evaluator) notify(ctx context.Context, rule models.AlertRule, payload Payload, historyID uint) {
+	if err := e.hub.NotifyTenant(rule.TenantID, "alert", payload); err != nil {
+		e.logger.ErrorContext(ctx, "Failed to send alert to WebSocket clients", "rule_id", rule.ID, "error", err)
+	}
+	if rule.WebhookID == nil && rule.URL == "" {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	e.deliveries.Add(1)
+	go func() {
+		defer e.deliveries.Done()
+		err := e.deliver(ctx, rule, payload)
+		if err == nil {
+			return
+		}
+		e.logger.WarnContext(ctx, "Alert delivery failed", "rule_id", rule.ID, "tenant_id", rule.TenantID, "error", err)
+		if historyID == 0 {
+			return
+		}
+		if err := e.db.WithContext(ctx).RecordAlertDelivery(historyID, err.Error()); err != nil {
+			e.logger.ErrorContext(ctx, "Failed to record alert delivery", "rule_id", rule.ID, "error", err)
+		}
+	}()
+}
+
+func (e *Evaluator) deliver(ctx context.Context, rule models.AlertRule, payload Payload) error {
+	target := models.Webhook{TenantID: rule.TenantID, URL: rule.URL, Secret: rule.Secret}
+	if rule.WebhookID != nil {
+		wh, err := e.db.WithContext(ctx).GetWebhook(rule.TenantID, *rule.WebhookID)
+		if err != nil {
+			return fmt.Errorf("load webhook %d: %w", *rule.WebhookID, err)
+		}
+		if !wh.Active {
+			return fmt.Errorf("webhook %d is inactive", wh.ID)
+		}
+		target = *wh
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return e.webhooks.Deliver(ctx, target, body, true)
+}
@@ -0,0 +1,164 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/models"
+)
+
+// evaluate computes a rule's value at now, whether it is firing, and a
+// message describing the result
+func (e *Evaluator) evaluate(ctx context.Context, rule models.AlertRule, now time.Time) (int64, bool, string, error) {
+	window, err := time.ParseDuration(rule.Window)
+	if err != nil {
+		return 0, false, "", fmt.Errorf("invalid window: %w", err)
+	}
+	since := now.Add(-window)
+
+	switch rule.Condition {
+	case models.AlertThreshold:
+		count, err := e.events.EventsWithContext(ctx).CountEvents(database.EventFilter{
+			TenantID:   rule.TenantID,
+			EventTypes: []string{rule.EventType},
+			Since:      &since,
+		})
+		if err != nil {
+			return 0, false, "", err
+		}
+		message := fmt.Sprintf("%d %s events in the last %s (threshold %d)", count, rule.EventType, rule.Window, rule.Threshold)
+		return count, count >= rule.Threshold, message, nil
+
+	case models.AlertAbsence:
+		last, err := e.latestEvent(ctx, rule, since)
+		if err != nil {
+			return 0, false, "", err
+		}
+		// A rule watches from when it was last changed, so a new rule does
+		// not fire for events that were missing before it existed
+		from := rule.UpdatedAt
+		if last != nil && last.After(from) {
+			from = *last
+		}
+		quiet := now.Sub(from)
+		message := fmt.Sprintf("No %s events for %s (window %s)", rule.EventType, quiet.Truncate(time.Second), rule.Window)
+		if last != nil && !last.Before(since) {
+			message = fmt.Sprintf("Last %s event at %s", rule.EventType, last.UTC().Format(time.RFC3339))
+		}
+		return int64(quiet / time.Second), from.Before(since), message, nil
+
+	case models.AlertMetadataMatch:
+		match, err := rule.ParseMatch()
+		if err != nil {
+			return 0, false, "", fmt.Errorf("decode match: %w", err)
+		}
+		events, err := e.events.EventsWithContext(ctx).GetEvents(database.EventFilter{
+			TenantID:   rule.TenantID,
+			EventTypes: []string{rule.EventType},
+			Since:      &since,
+			Limit:      matchScanLimit,
+		})
+		if err != nil {
+			return 0, false, "", err
+		}
+		var count int64
+		for _, event := range events {
+			if matches(event.Metadata, match) {
+				count++
+			}
+		}
+		message := fmt.Sprintf("%d matching %s events in the last %s (threshold %d)", count, rule.EventType, rule.Window, rule.Threshold)
+		return count, count >= rule.Threshold, message, nil
+	}
+	return 0, false, "", fmt.Errorf("unknown condition %q", rule.Condition)
+}
+
+// latestEvent returns the time of the newest event of the rule's type. The
+// tracker answers while its time is inside the window; otherwise the
+// database is asked, since another replica, or this one before a restart,
+// may have stored a newer event.
+func (e *Evaluator) latestEvent(ctx context.Context, rule models.AlertRule, since time.Time) (*time.Time, error) {
+	if t, ok := e.seen.get(rule.TenantID, rule.EventType); ok && !t.Before(since) {
+		return &t, nil
+	}
+	latest, err := e.events.EventsWithContext(ctx).GetLatestEventTime(rule.TenantID, rule.EventType)
+	if err != nil || latest == nil {
+		return nil, err
+	}
+	e.seen.observe(rule.TenantID, rule.EventType, *latest)
+	return latest, nil
+}
+
+// matches reports whether every dotted path of match has the given value in
+// an event's metadata
+func matches(metadata string, match map[string]interface{}) bool {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(metadata), &doc); err != nil {
+		return false
+	}
+	for path, want := range match {
+		value, ok := lookup(doc, path)
+		if !ok || value != want {
+			return false
+		}
+	}
+	return true
+}
+
+func lookup(doc interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+type seenKey struct {
+	tenantID, eventType string
+}
+
+// lastSeen tracks the newest event timestamp of the tenant and event type
+// pairs watched by absence rules
+type lastSeen struct {
+	mu      sync.Mutex
+	watched map[seenKey]bool
+	times   map[seenKey]time.Time
+}
+
+// watch replaces the watched pairs, forgetting the others
+func (s *lastSeen) watch(keys map[seenKey]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watched = keys
+	for key := range s.times {
+		if !keys[key] {
+			delete(s.times, key)
+		}
+	}
+}
+
+func (s *lastSeen) observe(tenantID, eventType string, t time.Time) {
+	key := seenKey{tenantID, eventType}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watched[key] && t.After(s.times[key]) {
+		s.times[key] = t
+	}
+}
+
+func (s *lastSeen) get(tenantID, eventType string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.times[seenKey{tenantID, eventType}]
+	return t, ok
+}
@@ -0,0 +1,323 @@
+// Package anomaly flags tenants whose ingestion rate departs sharply from
+// their usual rate, without any configured rule. The ingest path only
+// increments a counter; every interval the counts become rates, are compared
+// to each tenant's baseline, an exponentially weighted moving average, and
+// are then folded into it.
+//
+// Each replica judges the traffic it receives itself.
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/webhook"
+
+	"gorm.io/gorm"
+)
+
+// settingKey is the system setting that persists the baselines
+const settingKey = "anomaly_baselines"
+
+// Anomaly kinds
+const (
+	KindSpike = "spike"
+	KindDrop  = "drop"
+)
+
+// Notification states
+const (
+	StateDetected = "detected"
+	StateResolved = "resolved"
+)
+
+// Baseline is a tenant's learned ingestion rate
+type Baseline struct {
+	Rate  float64   `json:"rate"`  // events per minute
+	Since time.Time `json:"since"` // first interval observed
+}
+
+// Anomaly is a tenant whose latest rate is factor times above or below its
+// baseline
+type Anomaly struct {
+	TenantID   string  `json:"tenant_id"`
+	TenantName string  `json:"tenant_name"`
+	Kind       string  `json:"kind"` // spike or drop
+	Rate       float64 `json:"rate"` // events per minute in the latest interval
+	// Baseline is the rate the latest interval was compared to
+	Baseline float64   `json:"baseline"`
+	Since    time.Time `json:"since"`
+}
+
+// Notification is the JSON body posted to the anomalies webhook
+type Notification struct {
+	Type    string    `json:"type"`  // always "anomaly"
+	State   string    `json:"state"` // detected or resolved
+	Anomaly Anomaly   `json:"anomaly"`
+	At      time.Time `json:"at"`
+}
+
+// Tracker counts ingested events per tenant and flags anomalies
+type Tracker struct {
+	db       *database.Database
+	webhooks *webhook.Dispatcher
+	cfg      config.AnomaliesConfig
+	logger   *slog.Logger
+
+	// counts holds a *atomic.Int64 per tenant ID for the current interval
+	counts sync.Map
+
+	mu        sync.Mutex
+	baselines map[string]*Baseline
+	anomalies map[string]Anomaly
+
+	// deliveries tracks webhook notifications so Run can wait for them
+	deliveries sync.WaitGroup
+}
+
+// NewTracker creates an anomaly tracker
+func NewTracker(db *database.Database, webhooks *webhook.Dispatcher, cfg config.AnomaliesConfig, logger *slog.Logger) *Tracker {
+	return &Tracker{
+		db:        db,
+		webhooks:  webhooks,
+		cfg:       cfg,
+		logger:    logger.With("component", "anomalies"),
+		baselines: make(map[string]*Baseline),
+		anomalies: make(map[string]Anomaly),
+	}
+}
+
+// Enabled reports whether anomalies are tracked
+func (t *Tracker) Enabled() bool {
+	return t.cfg.Enabled
+}
+
+// Observe counts an ingested event. It is called for every stored event.
+func (t *Tracker) Observe(tenantID string) {
+	if !t.cfg.Enabled {
+		return
+	}
+	counter, ok := t.counts.Load(tenantID)
+	if !ok {
+		counter, _ = t.counts.LoadOrStore(tenantID, new(atomic.Int64))
+	}
+	counter.(*atomic.Int64).Add(1)
+}
+
+// Anomalies returns the tenants currently flagged, longest-running first
+func (t *Tracker) Anomalies() []Anomaly {
+	t.mu.Lock()
+	list := make([]Anomaly, 0, len(t.anomalies))
+	for _, a := range t.anomalies {
+		list = append(list, a)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Since.Equal(list[j].Since) {
+			return list[i].Since.Before(list[j].Since)
+		}
+		return list[i].TenantID < list[j].TenantID
+	})
+	return list
+}
+
+// Run evaluates the counts every interval and saves the baselines every
+// persist interval until ctx is cancelled, then saves them once more and
+// waits for notifications in flight. It returns at once when anomalies are
+// disabled.
+func (t *Tracker) Run(ctx context.Context) {
+	if !t.cfg.Enabled {
+		return
+	}
+	defer t.deliveries.Wait()
+
+	if err := t.load(); err != nil {
+		t.logger.ErrorContext(ctx, "Failed to load anomaly baselines, learning afresh", "error", err)
+	}
+
+	interval := time.NewTicker(t.cfg.Interval)
+	defer interval.Stop()
+	persist := time.NewTicker(t.cfg.PersistInterval)
+	defer persist.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := t.persist(context.WithoutCancel(ctx)); err != nil {
+				t.logger.ErrorContext(ctx, "Failed to save anomaly baselines", "error", err)
+			}
+			return
+		case <-interval.C:
+			t.evaluate(ctx, time.Now().UTC())
+		case <-persist.C:
+			if err := t.persist(ctx); err != nil {
+				t.logger.ErrorContext(ctx, "Failed to save anomaly baselines", "error", err)
+			}
+		}
+	}
+}
+
+// evaluate turns the interval's counts into rates, flags or clears
+// anomalies against the baselines and updates the baselines
+func (t *Tracker) evaluate(ctx context.Context, now time.Time) {
+	tenants, err := t.db.WithContext(ctx).GetAllTenants()
+	if err != nil {
+		t.logger.ErrorContext(ctx, "Failed to load tenants for anomaly detection", "error", err)
+		return
+	}
+
+	perMinute := float64(time.Minute) / float64(t.cfg.Interval)
+	known := make(map[string]bool, len(tenants))
+	var detected, resolved []Anomaly
+
+	t.mu.Lock()
+	for _, tenant := range tenants {
+		known[tenant.ID] = true
+		var count int64
+		if counter, ok := t.counts.Load(tenant.ID); ok {
+			count = counter.(*atomic.Int64).Swap(0)
+		}
+		rate := float64(count) * perMinute
+
+		baseline, ok := t.baselines[tenant.ID]
+		if !ok {
+			t.baselines[tenant.ID] = &Baseline{Rate: rate, Since: now}
+			continue
+		}
+
+		kind := t.judge(tenant, baseline, rate, now)
+		previous, flagged := t.anomalies[tenant.ID]
+		switch {
+		case kind == "" && flagged:
+			delete(t.anomalies, tenant.ID)
+			previous.Rate = rate
+			resolved = append(resolved, previous)
+		case kind != "" && flagged && previous.Kind == kind:
+			previous.Rate = rate
+			previous.Baseline = baseline.Rate
+			t.anomalies[tenant.ID] = previous
+		case kind != "":
+			a := Anomaly{
+				TenantID:   tenant.ID,
+				TenantName: tenant.Name,
+				Kind:       kind,
+				Rate:       rate,
+				Baseline:   baseline.Rate,
+				Since:      now,
+			}
+			t.anomalies[tenant.ID] = a
+			detected = append(detected, a)
+		}
+
+		baseline.Rate = t.cfg.Smoothing*rate + (1-t.cfg.Smoothing)*baseline.Rate
+	}
+
+	// Forget deleted and deactivated tenants; GetAllTenants omits both
+	for id := range t.baselines {
+		if !known[id] {
+			delete(t.baselines, id)
+			delete(t.anomalies, id)
+		}
+	}
+	t.mu.Unlock()
+	t.counts.Range(func(id, _ any) bool {
+		if !known[id.(string)] {
+			t.counts.Delete(id)
+		}
+		return true
+	})
+
+	for _, a := range detected {
+		t.logger.WarnContext(ctx, "Ingestion rate anomaly", "tenant_id", a.TenantID, "kind", a.Kind, "rate", a.Rate, "baseline", a.Baseline)
+		t.notify(ctx, StateDetected, a, now)
+	}
+	for _, a := range resolved {
+		t.logger.InfoContext(ctx, "Ingestion rate back to normal", "tenant_id", a.TenantID, "kind", a.Kind, "rate", a.Rate)
+		t.notify(ctx, StateResolved, a, now)
+	}
+}
+
+// judge returns the kind of anomaly a rate is against a baseline, or "".
+// Tenants are not judged while learning or while their baseline is too low
+// for a ratio to mean anything.
+func (t *Tracker) judge(tenant models.Tenant, baseline *Baseline, rate float64, now time.Time) string {
+	learningFrom := baseline.Since
+	if tenant.CreatedAt.After(learningFrom) {
+		learningFrom = tenant.CreatedAt
+	}
+	if now.Sub(learningFrom) < t.cfg.LearningWindow || baseline.Rate < t.cfg.MinRate {
+		return ""
+	}
+
+	switch {
+	case rate >= baseline.Rate*t.cfg.Factor:
+		return KindSpike
+	case rate <= baseline.Rate/t.cfg.Factor:
+		return KindDrop
+	}
+	return ""
+}
+
+// notify posts a notification to the anomalies webhook, if one is set,
+// without blocking evaluation
+func (t *Tracker) notify(ctx context.Context, state string, a Anomaly, now time.Time) {
+	if t.cfg.WebhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(Notification{Type: "anomaly", State: state, Anomaly: a, At: now})
+	if err != nil {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	t.deliveries.Add(1)
+	go func() {
+		defer t.deliveries.Done()
+		target := models.Webhook{URL: t.cfg.WebhookURL, Secret: t.cfg.WebhookSecret}
+		if err := t.webhooks.Deliver(ctx, target, body, true); err != nil {
+			t.logger.WarnContext(ctx, "Anomaly notification failed", "tenant_id", a.TenantID, "error", err)
+		}
+	}()
+}
+
+// load restores the persisted baselines; a missing setting means none
+func (t *Tracker) load() error {
+	setting, err := t.db.GetSetting(settingKey)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	baselines := make(map[string]*Baseline)
+	if err := json.Unmarshal([]byte(setting.Value), &baselines); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.baselines = baselines
+	t.mu.Unlock()
+	return nil
+}
+
+// persist saves the baselines
+func (t *Tracker) persist(ctx context.Context) error {
+	t.mu.Lock()
+	data, err := json.Marshal(t.baselines)
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return t.db.WithContext(ctx).PutSetting(settingKey, string(data))
+}
@@ -0,0 +1,798 @@
+// Package app wires the server's components together and carries out the
+// binary's one-off modes: checking, migrating, seeding and compressing
+// metadata. main loads the configuration and calls Run or one of the
+// modes; tests build an App with New and drive its Handler directly.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/alert"
+	"event-ingestion-system/internal/anomaly"
+	"event-ingestion-system/internal/archive"
+	"event-ingestion-system/internal/audit"
+	"event-ingestion-system/internal/auth"
+	"event-ingestion-system/internal/cache"
+	"event-ingestion-system/internal/capture"
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/deadletter"
+	"event-ingestion-system/internal/diagnostics"
+	"event-ingestion-system/internal/export"
+	"event-ingestion-system/internal/flags"
+	"event-ingestion-system/internal/geoip"
+	"event-ingestion-system/internal/handlers"
+	"event-ingestion-system/internal/importer"
+	"event-ingestion-system/internal/ingest"
+	"event-ingestion-system/internal/latency"
+	"event-ingestion-system/internal/leader"
+	"event-ingestion-system/internal/lifecycle"
+	"event-ingestion-system/internal/maintenance"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/middleware"
+	"event-ingestion-system/internal/mqtt"
+	"event-ingestion-system/internal/natsbus"
+	"event-ingestion-system/internal/oidc"
+	"event-ingestion-system/internal/quota"
+	"event-ingestion-system/internal/receipt"
+	"event-ingestion-system/internal/redaction"
+	"event-ingestion-system/internal/report"
+	"event-ingestion-system/internal/server"
+	"event-ingestion-system/internal/sink"
+	"event-ingestion-system/internal/tracing"
+	"event-ingestion-system/internal/version"
+	"event-ingestion-system/internal/webhook"
+	"event-ingestion-system/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+)
+
+// App is a fully wired server. New starts the in-process workers (hub,
+// webhook dispatcher, sinks, ingest buffer, export and import jobs and
+// audit log) so Handler is usable right away;
+// Start adds the listeners and message consumers.
+type App struct {
+	Config *config.Config
+	DB     *database.Database
+	// Events keeps events: DB itself, or the store database.event_store
+	// chose
+	Events database.EventStore
+	Hub    *websocket.Hub
+	// Handler serves the public API, the WebSocket endpoint and the dashboard
+	Handler http.Handler
+
+	logger       *slog.Logger
+	handler      *handlers.Handler
+	router       *gin.Engine
+	diag         http.Handler
+	maint        *maintenance.Mode
+	dispatcher   *webhook.Dispatcher
+	reports      *report.Scheduler
+	alerts       *alert.Evaluator
+	anomalies    *anomaly.Tracker
+	exports      *export.Runner
+	imports      *importer.Runner
+	redactions   *redaction.Runner
+	auth         *auth.AuthMiddleware
+	sinks        *sink.Pipeline
+	ingestSvc    *ingest.Service
+	geo          *geoip.Resolver
+	deadLetters  *deadletter.Store
+	leader       *leader.Elector
+	auditLogger  *audit.Logger
+	recentErrors *capture.Recorder
+	natsConn     *nats.Conn
+	natsConsumer *natsbus.Consumer
+	mqttBridge   *mqtt.Bridge
+
+	shutdownTracing  func(context.Context) error
+	stopHub          context.CancelFunc
+	stopWebhooks     context.CancelFunc
+	stopSinks        context.CancelFunc
+	stopIngest       context.CancelFunc
+	stopAudit        context.CancelFunc
+	stopDeadLetters  context.CancelFunc
+	stopPoolStats    context.CancelFunc
+	stopGeoIP        context.CancelFunc
+	stopAuthTracking context.CancelFunc
+	authTrackingDone chan struct{}
+	stopLeader       context.CancelFunc
+	leaderDone       chan struct{}
+	stopReports      context.CancelFunc
+	reportsDone      chan struct{}
+	stopAlerts       context.CancelFunc
+	alertsDone       chan struct{}
+	stopAnomalies    context.CancelFunc
+	anomaliesDone    chan struct{}
+	stopExports      context.CancelFunc
+	exportsDone      chan struct{}
+	stopImports      context.CancelFunc
+	importsDone      chan struct{}
+	stopRedactions   context.CancelFunc
+	redactionsDone   chan struct{}
+	auditDone        chan struct{}
+
+	// Set by Start
+	started     bool
+	srv         *http.Server
+	redirectSrv *http.Server
+	metricsSrv  *http.Server
+	adminSrv    *http.Server
+	debugSrv    *http.Server
+	errs        chan error
+
+	// shutdownOnce runs the shutdown steps once; shutdownOK is whether
+	// they all succeeded
+	shutdownOnce sync.Once
+	shutdownOK   bool
+}
+
+// OpenDatabase connects to the configured database and, unless
+// database.migrate_on_start is off, runs migrations. Event searches on it
+// give up after database.query_timeout, and metadata is compressed above
+// database.compress_metadata_above.
+func OpenDatabase(cfg *config.Config, logger *slog.Logger) (*database.Database, error) {
+	db, err := connectDatabase(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	if !*cfg.Database.MigrateOnStart {
+		logger.Info("Skipping migrations, database.migrate_on_start is off")
+		return db, nil
+	}
+	if err := db.Migrate(cfg.Database.MigrateLockTimeout); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("run migrations: %w", err)
+	}
+	return db, nil
+}
+
+// connectDatabase is OpenDatabase without migrations, for Migrate and
+// PrintMigrationPlan
+func connectDatabase(cfg *config.Config, logger *slog.Logger) (*database.Database, error) {
+	if cfg.Database.IsServer() {
+		logger.Info("Connecting to database", "driver", cfg.Database.Driver, "host", cfg.Database.Host, "port", cfg.Database.Port, "database", cfg.Database.Name)
+	} else {
+		logger.Info("Using SQLite database", "path", cfg.Database.Host)
+	}
+
+	db, err := database.NewDatabase(
+		cfg.Database.Driver,
+		cfg.Database.DSN(),
+		cfg.Database.MaxOpenConns,
+		cfg.Database.MaxIdleConns,
+		cfg.Database.ConnMaxLifetime,
+		cfg.Database.AcquireTimeout,
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return db.WithQueryTimeout(cfg.Database.QueryTimeout).
+		WithMetadataCompression(cfg.Database.CompressMetadataAbove).
+		WithWriteConflictRetries(cfg.Database.WriteConflictRetries), nil
+}
+
+// New connects to the database and external systems and builds the router.
+// cfg must already have defaults applied and be validated.
+func New(cfg *config.Config, logger *slog.Logger) (a *App, err error) {
+	a = &App{Config: cfg, logger: logger, errs: make(chan error, 5)}
+
+	// Release what was opened if a later step fails. The App is passed
+	// in, since failing returns set a to nil.
+	defer func(a *App) {
+		if err != nil {
+			a.release()
+		}
+	}(a)
+
+	gin.SetMode(cfg.App.Mode)
+
+	// Initialize tracing (no-op unless enabled)
+	a.shutdownTracing, err = tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("initialize tracing: %w", err)
+	}
+
+	db, err := OpenDatabase(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	a.DB = db
+	a.Events = db
+	if cfg.Database.EventStore == database.EventStoreMemory {
+		a.Events = database.NewMemoryEventStore()
+		logger.Warn("Events are kept in memory and lost on restart; tenant exports, imports and bulk redactions are unavailable")
+	}
+	if cfg.Tracing.Enabled {
+		if err := db.DB.Use(tracing.GormPlugin()); err != nil {
+			return nil, fmt.Errorf("instrument database: %w", err)
+		}
+	}
+
+	// Restore maintenance mode so it survives restarts
+	a.maint = maintenance.New(db)
+	if err := a.maint.Load(); err != nil {
+		logger.Error("Failed to load maintenance state; starting with maintenance off", "error", err)
+	} else if a.maint.Enabled() {
+		logger.Warn("Maintenance mode is on; mutating requests will be rejected", "message", a.maint.State().Message)
+	}
+
+	wsCfg := &config.WebSocketConfig{
+		PingInterval:    cfg.WebSocket.PingInterval,
+		PongTimeout:     cfg.WebSocket.PongTimeout,
+		WriteTimeout:    cfg.WebSocket.WriteTimeout,
+		ReadBufferSize:  cfg.WebSocket.ReadBufferSize,
+		WriteBufferSize: cfg.WebSocket.WriteBufferSize,
+		MaxMessageSize:  cfg.WebSocket.MaxMessageSize,
+
+		MessageRateLimit:  cfg.WebSocket.MessageRateLimit,
+		MessageBurst:      cfg.WebSocket.MessageBurst,
+		MaxRateViolations: cfg.WebSocket.MaxRateViolations,
+
+		ThroughputInterval: cfg.WebSocket.ThroughputInterval,
+	}
+
+	// Tenants are looked up for every event, also to hold back the
+	// notifications of muted ones; changes made through this replica
+	// invalidate them
+	tenants := cache.NewTenantCache(db, cfg.Auth.TenantCacheTTL)
+
+	a.Hub = websocket.NewHub(wsCfg, a.Events, tenants, logger)
+	a.deadLetters = deadletter.NewStore(db, cfg.DeadLetters, logger)
+	latencies := latency.New(cfg.Metrics.LatencySampleRate)
+	featureFlags := flags.New(cfg.Flags)
+	a.dispatcher = webhook.NewDispatcher(db, tenants, cfg.Webhooks, a.deadLetters, latencies, logger)
+	a.leader = leader.New(db, cfg.Leader, logger)
+	a.reports = report.NewScheduler(db, a.Events, a.dispatcher, cfg.Reports, logger)
+	a.alerts = alert.NewEvaluator(db, a.Events, a.dispatcher, a.Hub, cfg.Alerts, logger)
+	a.anomalies = anomaly.NewTracker(db, a.dispatcher, cfg.Anomalies, logger)
+
+	archiveStore, err := archive.New(cfg.Archive, cfg.Auth.JWTSecret)
+	if err != nil {
+		return nil, fmt.Errorf("configure archive: %w", err)
+	}
+	a.exports = export.NewRunner(db, archiveStore, cfg.Exports, logger)
+	a.imports = importer.NewRunner(db, archiveStore, cfg.Imports, logger)
+	a.redactions = redaction.NewRunner(db, a.Hub, cfg.Redactions, logger)
+
+	// Initialize event sinks that mirror accepted events to external systems
+	var forwarders []*sink.Forwarder
+	if cfg.Sinks.Kafka.Enabled {
+		kafkaSink, err := sink.NewKafka(cfg.Sinks.Kafka)
+		if err != nil {
+			return nil, fmt.Errorf("configure Kafka sink: %w", err)
+		}
+		forwarders = append(forwarders, sink.NewForwarder(kafkaSink, cfg.Sinks.BufferSize, a.deadLetters, logger))
+		logger.Info("Kafka sink enabled", "brokers", cfg.Sinks.Kafka.Brokers, "topic", cfg.Sinks.Kafka.Topic)
+	}
+
+	// Connect to NATS when configured; it is both a sink and an event source
+	if cfg.Nats.URL != "" {
+		a.natsConn, err = natsbus.Connect(cfg.Nats, logger)
+		if err != nil {
+			return nil, fmt.Errorf("configure NATS: %w", err)
+		}
+		natsSink, err := sink.NewNATS(a.natsConn, cfg.Nats)
+		if err != nil {
+			return nil, fmt.Errorf("configure NATS sink: %w", err)
+		}
+		forwarders = append(forwarders, sink.NewForwarder(natsSink, cfg.Sinks.BufferSize, a.deadLetters, logger))
+		logger.Info("NATS sink enabled", "subjects", cfg.Nats.SubjectPrefix+".<tenant_id>")
+	}
+	a.sinks = sink.NewPipeline(forwarders...)
+
+	a.geo, err = geoip.Open(cfg.GeoIP, logger)
+	if err != nil {
+		return nil, fmt.Errorf("configure GeoIP: %w", err)
+	}
+
+	// The ingest service is shared by the API and the message consumers
+	a.ingestSvc = ingest.NewService(db, a.Events, tenants, a.Hub, a.dispatcher, a.sinks, a.deadLetters, a.alerts, a.anomalies, latencies, quota.NewTracker(a.Events), a.geo, cfg.Ingest, cfg.GeoIP, logger)
+
+	if a.natsConn != nil && cfg.Nats.Consume.Subject != "" {
+		a.natsConsumer, err = natsbus.NewConsumer(a.natsConn, cfg.Nats.Consume, a.ingestSvc, a.maint, logger)
+		if err != nil {
+			return nil, fmt.Errorf("configure NATS consumer: %w", err)
+		}
+	}
+	if cfg.MQTT.Broker != "" {
+		a.mqttBridge = mqtt.New(cfg.MQTT, tenants, a.ingestSvc, logger)
+	}
+
+	a.auditLogger = audit.NewLogger(db, logger)
+
+	metrics.Configure(cfg.Metrics)
+	if cfg.Metrics.Enabled {
+		sqlDB, err := db.DB.DB()
+		if err != nil {
+			return nil, fmt.Errorf("access database pool: %w", err)
+		}
+		metrics.RegisterDB(sqlDB)
+		metrics.SampleWebSocketBuffers(a.Hub.SendBufferLengths)
+	}
+
+	a.auth = auth.NewAuthMiddleware(
+		db,
+		tenants,
+		cfg.Auth.JWTSecret,
+		cfg.Auth.JWTExpiry,
+		cfg.Auth.APIKeyHeader,
+		logger,
+	)
+	rateLimiter := middleware.NewRateLimiter(cfg.RateLimit.RequestsPerMinute)
+
+	var sso *oidc.Provider
+	if cfg.Auth.OIDC != nil {
+		sso = oidc.New(*cfg.Auth.OIDC, cfg.Auth.JWTSecret)
+	}
+
+	receipts, err := receipt.New(cfg.Receipts)
+	if err != nil {
+		return nil, fmt.Errorf("configure receipts: %w", err)
+	}
+
+	// Credential headers are never captured
+	a.recentErrors = capture.New(cfg.Debug, cfg.Auth.APIKeyHeader, auth.AdminTokenHeader)
+
+	a.handler = handlers.NewHandler(db, a.Events, tenants, a.Hub, a.auth, sso, a.ingestSvc, a.dispatcher, a.reports, a.anomalies, latencies, featureFlags, a.leader, a.auditLogger, a.maint, a.recentErrors, a.exports, a.imports, a.redactions, archiveStore, receipts, cfg, logger)
+	if a.mqttBridge != nil {
+		a.handler.AddReadinessCheck("mqtt", a.mqttBridge.Health)
+	}
+
+	if len(cfg.Cors.AllowedOrigins) == 0 {
+		logger.Warn("CORS allowed_origins not configured; allowing requests from any origin")
+	}
+
+	a.router, err = setupRouter(a.handler, a.auth, rateLimiter, a.maint, a.recentErrors, featureFlags, cfg, tenants, logger)
+	if err != nil {
+		return nil, fmt.Errorf("configure router: %w", err)
+	}
+	a.Handler = a.router
+	a.diag = diagnostics.Handler(diagnostics.Sources{
+		Hub:        a.Hub,
+		Dispatcher: a.dispatcher,
+		Sinks:      a.sinks,
+		Routes:     a.router.Routes,
+	})
+
+	// Nothing below can fail, so the workers never need unwinding here
+	var hubCtx, webhookCtx, sinkCtx, ingestCtx, auditCtx, deadLetterCtx, leaderCtx, reportCtx, alertCtx, anomalyCtx, exportCtx, importCtx, redactionCtx, poolStatsCtx, geoCtx, authTrackingCtx context.Context
+	hubCtx, a.stopHub = context.WithCancel(context.Background())
+	go a.Hub.Run(hubCtx)
+	webhookCtx, a.stopWebhooks = context.WithCancel(context.Background())
+	go a.dispatcher.Run(webhookCtx)
+	sinkCtx, a.stopSinks = context.WithCancel(context.Background())
+	go a.sinks.Run(sinkCtx)
+	ingestCtx, a.stopIngest = context.WithCancel(context.Background())
+	go a.ingestSvc.Run(ingestCtx)
+	deadLetterCtx, a.stopDeadLetters = context.WithCancel(context.Background())
+	go a.deadLetters.Run(deadLetterCtx)
+	// Jobs that should run on one replica run while it leads
+	leaderCtx, a.stopLeader = context.WithCancel(context.Background())
+	a.leaderDone = make(chan struct{})
+	go func() {
+		a.leader.Run(leaderCtx)
+		close(a.leaderDone)
+	}()
+	go a.leader.Lead(deadLetterCtx, a.deadLetters.RunPurge)
+	geoCtx, a.stopGeoIP = context.WithCancel(context.Background())
+	if a.geo != nil {
+		go a.geo.Run(geoCtx)
+	}
+	poolStatsCtx, a.stopPoolStats = context.WithCancel(context.Background())
+	if cfg.Metrics.Enabled {
+		go db.MonitorPool(poolStatsCtx, cfg.Database.PoolStatsInterval, func(stats database.PoolStats) {
+			metrics.DBPoolSampled(stats.Saturation, stats.AcquireTimeouts)
+		})
+	}
+	reportCtx, a.stopReports = context.WithCancel(context.Background())
+	a.reportsDone = make(chan struct{})
+	go func() {
+		a.leader.Lead(reportCtx, a.reports.Run)
+		close(a.reportsDone)
+	}()
+	alertCtx, a.stopAlerts = context.WithCancel(context.Background())
+	a.alertsDone = make(chan struct{})
+	go func() {
+		a.alerts.Run(alertCtx)
+		close(a.alertsDone)
+	}()
+	anomalyCtx, a.stopAnomalies = context.WithCancel(context.Background())
+	a.anomaliesDone = make(chan struct{})
+	go func() {
+		a.anomalies.Run(anomalyCtx)
+		close(a.anomaliesDone)
+	}()
+	exportCtx, a.stopExports = context.WithCancel(context.Background())
+	a.exportsDone = make(chan struct{})
+	go func() {
+		a.exports.Run(exportCtx)
+		close(a.exportsDone)
+	}()
+	importCtx, a.stopImports = context.WithCancel(context.Background())
+	a.importsDone = make(chan struct{})
+	go func() {
+		a.imports.Run(importCtx)
+		close(a.importsDone)
+	}()
+	redactionCtx, a.stopRedactions = context.WithCancel(context.Background())
+	a.redactionsDone = make(chan struct{})
+	go func() {
+		a.redactions.Run(redactionCtx)
+		close(a.redactionsDone)
+	}()
+
+	authTrackingCtx, a.stopAuthTracking = context.WithCancel(context.Background())
+	a.authTrackingDone = make(chan struct{})
+	go func() {
+		a.auth.RunAuthTracking(authTrackingCtx)
+		close(a.authTrackingDone)
+	}()
+
+	// The audit logger gets its own context so queued entries are flushed
+	// only after the HTTP server has stopped accepting requests
+	auditCtx, a.stopAudit = context.WithCancel(context.Background())
+	a.auditDone = make(chan struct{})
+	go func() {
+		a.auditLogger.Run(auditCtx)
+		close(a.auditDone)
+	}()
+
+	return a, nil
+}
+
+// release closes the connections New opened before it failed
+func (a *App) release() {
+	if a.natsConn != nil {
+		a.natsConn.Close()
+	}
+	if a.DB != nil {
+		a.DB.Close()
+	}
+	if a.shutdownTracing != nil {
+		a.shutdownTracing(context.Background())
+	}
+}
+
+// Start binds the configured listeners and starts the message consumers.
+// A listener that fails after binding is reported by Run.
+func (a *App) Start() error {
+	cfg, logger := a.Config, a.logger
+	build := version.Get()
+
+	a.srv = &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", cfg.App.Host, cfg.App.Port),
+		Handler:           a.Handler,
+		ReadTimeout:       cfg.App.ReadTimeout,
+		ReadHeaderTimeout: cfg.App.ReadHeaderTimeout,
+		WriteTimeout:      cfg.App.WriteTimeout,
+		IdleTimeout:       cfg.App.IdleTimeout,
+	}
+
+	// Terminate TLS when configured; HTTP/2 is negotiated automatically
+	var serverTLS *server.TLS
+	if cfg.App.TLS.Enabled() {
+		serverTLS = server.NewTLS(cfg.App.TLS)
+		a.srv.TLSConfig = serverTLS.Config
+	}
+
+	// Listen before starting the goroutine so a bad address or an occupied
+	// socket fails startup. A Unix listener removes its socket file on close.
+	listen := cfg.App.Listen
+	if listen == "" {
+		listen = a.srv.Addr
+	}
+	socketMode, _ := cfg.App.FileMode() // validated at load
+	listener, err := server.Listen(listen, socketMode)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", listen, err)
+	}
+	a.started = true
+
+	go func() {
+		logger.Info("Starting server", "listen", listen, "tls", serverTLS != nil, "version", build.Version)
+		var err error
+		if serverTLS != nil {
+			err = a.srv.ServeTLS(listener, serverTLS.CertFile, serverTLS.KeyFile)
+		} else {
+			err = a.srv.Serve(listener)
+		}
+		a.serveFailed("server", err)
+	}()
+
+	// Optionally redirect plain HTTP to HTTPS
+	if serverTLS != nil && cfg.App.TLS.RedirectPort > 0 {
+		a.redirectSrv = &http.Server{
+			Addr:              fmt.Sprintf("%s:%d", cfg.App.Host, cfg.App.TLS.RedirectPort),
+			Handler:           serverTLS.RedirectHandler(cfg.App.Port),
+			ReadHeaderTimeout: cfg.App.ReadHeaderTimeout,
+		}
+		go func() {
+			logger.Info("Starting HTTP redirect server", "host", cfg.App.Host, "port", cfg.App.TLS.RedirectPort)
+			a.serveFailed("redirect server", a.redirectSrv.ListenAndServe())
+		}()
+	}
+
+	// Optionally serve metrics on a separate port
+	if cfg.Metrics.Enabled && cfg.Metrics.Port > 0 {
+		mux := http.NewServeMux()
+		mux.Handle(cfg.Metrics.Path, metrics.Handler())
+		a.metricsSrv = &http.Server{
+			Addr:    fmt.Sprintf("%s:%d", cfg.App.Host, cfg.Metrics.Port),
+			Handler: mux,
+		}
+		go func() {
+			logger.Info("Starting metrics server", "host", cfg.App.Host, "port", cfg.Metrics.Port)
+			a.serveFailed("metrics server", a.metricsSrv.ListenAndServe())
+		}()
+	}
+
+	// Optionally serve the admin API, metrics and pprof on their own listener
+	if cfg.App.AdminPort > 0 {
+		if cfg.Auth.AdminToken == "" {
+			logger.Warn("Admin listener enabled without auth.admin_token; every request will be rejected")
+		}
+		adminRouter, err := setupAdminRouter(a.handler, a.maint, a.recentErrors, a.diag, cfg, logger)
+		if err != nil {
+			return fmt.Errorf("configure admin router: %w", err)
+		}
+		a.adminSrv = &http.Server{
+			Addr:              fmt.Sprintf("%s:%d", cfg.App.AdminHost, cfg.App.AdminPort),
+			Handler:           adminRouter,
+			ReadHeaderTimeout: cfg.App.ReadHeaderTimeout,
+		}
+		go func() {
+			logger.Info("Starting admin server", "host", cfg.App.AdminHost, "port", cfg.App.AdminPort)
+			a.serveFailed("admin server", a.adminSrv.ListenAndServe())
+		}()
+	}
+
+	// Optionally serve pprof and runtime diagnostics on a private listener
+	if cfg.App.DebugPort > 0 {
+		debugHost := cfg.App.DebugHost
+		a.debugSrv = &http.Server{
+			Addr:    fmt.Sprintf("%s:%d", debugHost, cfg.App.DebugPort),
+			Handler: a.diag,
+		}
+		go func() {
+			logger.Info("Starting debug server", "host", debugHost, "port", cfg.App.DebugPort)
+			a.serveFailed("debug server", a.debugSrv.ListenAndServe())
+		}()
+	}
+
+	if a.natsConsumer != nil {
+		go a.natsConsumer.Run(context.Background())
+	}
+	// Bridge device messages from an MQTT broker when configured
+	if a.mqttBridge != nil {
+		if err := a.mqttBridge.Start(context.Background()); err != nil {
+			return fmt.Errorf("configure MQTT bridge: %w", err)
+		}
+	}
+	return nil
+}
+
+// serveFailed reports a listener that stopped for any reason but Shutdown
+func (a *App) serveFailed(name string, err error) {
+	if err == nil || errors.Is(err, http.ErrServerClosed) {
+		return
+	}
+	select {
+	case a.errs <- fmt.Errorf("%s: %w", name, err):
+	default:
+	}
+}
+
+// Run starts the app, serves until ctx is done or a listener fails, then
+// shuts down
+func (a *App) Run(ctx context.Context) error {
+	if err := a.Start(); err != nil {
+		a.Shutdown()
+		return err
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-a.errs:
+		a.logger.Error("Listener failed", "error", err)
+	}
+
+	a.logger.Info("Shutting down server...")
+	if !a.Shutdown() {
+		return errors.Join(err, errors.New("shutdown finished with errors"))
+	}
+	return err
+}
+
+// Shutdown stops the app outside-in: stop taking traffic, finish what was
+// accepted, then release what the pipeline writes to. The database goes
+// last. It reports whether every step succeeded. Later calls wait for the
+// first and report its result.
+func (a *App) Shutdown() bool {
+	a.shutdownOnce.Do(func() { a.shutdownOK = a.shutdown() })
+	return a.shutdownOK
+}
+
+func (a *App) shutdown() bool {
+	cfg, logger := a.Config, a.logger
+	timeout := cfg.App.ShutdownTimeout
+
+	shutdown := lifecycle.New(logger)
+	shutdown.Add("mark not ready", 0, func(ctx context.Context) error {
+		a.handler.SetDraining()
+		if a.started {
+			time.Sleep(cfg.App.ShutdownDelay)
+		}
+		return nil
+	})
+	shutdown.Add("stop accepting requests", timeout, func(ctx context.Context) error {
+		if a.redirectSrv != nil {
+			if err := a.redirectSrv.Shutdown(ctx); err != nil {
+				logger.Error("Redirect server forced to shutdown", "error", err)
+			}
+		}
+		if a.adminSrv != nil {
+			if err := a.adminSrv.Shutdown(ctx); err != nil {
+				logger.Error("Admin server forced to shutdown", "error", err)
+			}
+		}
+		if a.srv == nil {
+			return nil
+		}
+		return a.srv.Shutdown(ctx)
+	})
+	shutdown.Add("stop message consumers", timeout, func(ctx context.Context) error {
+		if !a.started {
+			return nil
+		}
+		if a.natsConsumer != nil {
+			if err := a.natsConsumer.Shutdown(ctx); err != nil {
+				return err
+			}
+		}
+		if a.mqttBridge != nil {
+			return a.mqttBridge.Shutdown(ctx)
+		}
+		return nil
+	})
+	shutdown.Add("flush ingest buffer", timeout, a.ingestSvc.Shutdown)
+	// The fan-out workers stop with the ingest context
+	shutdown.Add("flush ingest broadcasts", timeout, func(ctx context.Context) error {
+		defer a.stopIngest()
+		return a.ingestSvc.WaitBackground(ctx)
+	})
+	shutdown.Add("stop report scheduler", timeout, func(ctx context.Context) error {
+		a.stopReports()
+		select {
+		case <-a.reportsDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdown.Add("stop alert evaluator", timeout, func(ctx context.Context) error {
+		a.stopAlerts()
+		select {
+		case <-a.alertsDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdown.Add("stop anomaly tracker", timeout, func(ctx context.Context) error {
+		a.stopAnomalies()
+		select {
+		case <-a.anomaliesDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdown.Add("stop export jobs", timeout, func(ctx context.Context) error {
+		a.stopExports()
+		select {
+		case <-a.exportsDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdown.Add("stop import jobs", timeout, func(ctx context.Context) error {
+		a.stopImports()
+		select {
+		case <-a.importsDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdown.Add("stop redaction jobs", timeout, func(ctx context.Context) error {
+		a.stopRedactions()
+		select {
+		case <-a.redactionsDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdown.Add("resign leadership", timeout, func(ctx context.Context) error {
+		a.stopLeader()
+		select {
+		case <-a.leaderDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdown.Add("flush webhook outbox", timeout, func(ctx context.Context) error {
+		defer a.stopWebhooks()
+		return a.dispatcher.Shutdown(ctx)
+	})
+	shutdown.Add("flush event sinks", timeout, func(ctx context.Context) error {
+		defer a.stopSinks()
+		return a.sinks.Shutdown(ctx)
+	})
+	shutdown.Add("close NATS connection", timeout, func(ctx context.Context) error {
+		if a.natsConn == nil {
+			return nil
+		}
+		defer a.natsConn.Close()
+		if !a.natsConn.IsConnected() {
+			return nil
+		}
+		return a.natsConn.FlushWithContext(ctx)
+	})
+	shutdown.Add("drain websocket hub", timeout, func(ctx context.Context) error {
+		defer a.stopHub()
+		return a.Hub.Shutdown(ctx)
+	})
+	shutdown.Add("record tenant authentication", timeout, func(ctx context.Context) error {
+		a.stopAuthTracking()
+		select {
+		case <-a.authTrackingDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdown.Add("flush audit log", timeout, func(ctx context.Context) error {
+		a.stopAudit()
+		select {
+		case <-a.auditDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdown.Add("stop auxiliary servers", timeout, func(ctx context.Context) error {
+		if a.metricsSrv != nil {
+			if err := a.metricsSrv.Shutdown(ctx); err != nil {
+				logger.Error("Metrics server forced to shutdown", "error", err)
+			}
+		}
+		if a.debugSrv != nil {
+			if err := a.debugSrv.Shutdown(ctx); err != nil {
+				logger.Error("Debug server forced to shutdown", "error", err)
+			}
+		}
+		return nil
+	})
+	shutdown.Add("flush traces", timeout, a.shutdownTracing)
+	shutdown.Add("close database", timeout, func(ctx context.Context) error {
+		a.stopDeadLetters()
+		a.stopPoolStats()
+		a.stopGeoIP()
+		return a.DB.Close()
+	})
+
+	return shutdown.Shutdown()
+}
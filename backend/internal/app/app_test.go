@@ -0,0 +1,25 @@
+package app_test
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"event-ingestion-system/internal/app"
+	"event-ingestion-system/internal/config"
+)
+
+func TestNewReleasesWhatItOpenedOnFailure(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.Host = filepath.Join(t.TempDir(), "events.db")
+	cfg.Frontend.Mode = "disabled"
+	cfg.Defaults()
+	// Not a usable seed, so New fails after opening the database
+	cfg.Receipts.KeyID = "broken"
+	cfg.Receipts.Keys = map[string]string{"broken": "not base64"}
+
+	if _, err := app.New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+		t.Fatal("New accepted an unusable receipt key")
+	}
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/geoip"
+	"event-ingestion-system/internal/natsbus"
+	"event-ingestion-system/internal/sink"
+	"event-ingestion-system/internal/version"
+)
+
+// checkTimeout bounds each check that reaches another system
+const checkTimeout = 10 * time.Second
+
+// Check statuses. A warning does not fail the report.
+const (
+	CheckOK      = "ok"
+	CheckWarning = "warning"
+	CheckFailed  = "failed"
+)
+
+// CheckReport is the outcome of Check
+type CheckReport struct {
+	OK      bool          `json:"ok"`
+	Version string        `json:"version"`
+	Checks  []CheckResult `json:"checks"`
+}
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// Details lists the configuration problems or pending migrations
+	Details    []string `json:"details,omitempty"`
+	DurationMS int64    `json:"duration_ms"`
+}
+
+// Check verifies that the server could start with cfg without starting it:
+// the configuration is valid, the JWT secret and TLS certificate load, the
+// database answers and its pending migrations are listed but not applied,
+// and the configured Kafka brokers, NATS server and GeoIP databases are
+// reachable. Every check runs even when an earlier one fails.
+func Check(ctx context.Context, cfg *config.Config, logger *slog.Logger) CheckReport {
+	report := CheckReport{OK: true, Version: version.Get().Version}
+	run := func(name string, check func(ctx context.Context) CheckResult) {
+		ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+		defer cancel()
+		start := time.Now()
+		result := check(ctx)
+		result.Name = name
+		result.DurationMS = time.Since(start).Milliseconds()
+		if result.Status == CheckFailed {
+			report.OK = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	run("config", func(context.Context) CheckResult {
+		var invalid *config.ValidationError
+		if err := cfg.Validate(); stderrors.As(err, &invalid) {
+			return CheckResult{Status: CheckFailed, Message: "invalid configuration", Details: invalid.Problems}
+		} else if err != nil {
+			return failed(err)
+		}
+		return CheckResult{Status: CheckOK}
+	})
+	run("jwt_secret", func(context.Context) CheckResult {
+		switch {
+		case cfg.Auth.JWTSecret == "":
+			return CheckResult{Status: CheckFailed, Message: "not set"}
+		case cfg.Auth.JWTSecret == config.InsecureJWTSecret:
+			return CheckResult{Status: CheckWarning, Message: "the example secret from config.yaml is in use"}
+		case len(cfg.Auth.JWTSecret) < 32:
+			return CheckResult{Status: CheckWarning, Message: "shorter than 32 characters"}
+		}
+		return CheckResult{Status: CheckOK}
+	})
+	run("tls", func(context.Context) CheckResult {
+		tlsCfg := cfg.App.TLS
+		switch {
+		case tlsCfg.CertFile != "" || tlsCfg.KeyFile != "":
+			if _, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile); err != nil {
+				return failed(err)
+			}
+			return CheckResult{Status: CheckOK}
+		case len(tlsCfg.AutocertHosts) > 0:
+			return CheckResult{Status: CheckOK, Message: "certificates are obtained from Let's Encrypt at startup"}
+		}
+		return CheckResult{Status: CheckOK, Message: "not configured"}
+	})
+	run("database", func(ctx context.Context) CheckResult {
+		return checkDatabase(ctx, cfg, logger)
+	})
+	if cfg.Sinks.Kafka.Enabled {
+		run("kafka", func(ctx context.Context) CheckResult {
+			if err := sink.CheckKafka(ctx, cfg.Sinks.Kafka); err != nil {
+				return failed(err)
+			}
+			return CheckResult{Status: CheckOK}
+		})
+	}
+	if cfg.Nats.URL != "" {
+		run("nats", func(ctx context.Context) CheckResult {
+			if err := natsbus.Check(ctx, cfg.Nats); err != nil {
+				return failed(err)
+			}
+			return CheckResult{Status: CheckOK}
+		})
+	}
+	if cfg.GeoIP.Database != "" || cfg.GeoIP.ASNDatabase != "" {
+		run("geoip", func(context.Context) CheckResult {
+			if _, err := geoip.Open(cfg.GeoIP, logger); err != nil {
+				return failed(err)
+			}
+			return CheckResult{Status: CheckOK}
+		})
+	}
+	return report
+}
+
+// checkDatabase connects, pings and lists the pending migrations. They are
+// applied at startup, or by -migrate when database.migrate_on_start is off.
+func checkDatabase(ctx context.Context, cfg *config.Config, logger *slog.Logger) CheckResult {
+	db, err := database.NewDatabase(cfg.Database.Driver, cfg.Database.DSN(), 1, 1, cfg.Database.ConnMaxLifetime, 0, logger)
+	if err != nil {
+		return failed(err)
+	}
+	defer db.Close()
+
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return failed(err)
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return failed(err)
+	}
+
+	pending, err := db.WithContext(ctx).PendingMigrations()
+	if err != nil {
+		return failed(fmt.Errorf("plan migrations: %w", err))
+	}
+	switch {
+	case len(pending) == 0:
+		return CheckResult{Status: CheckOK, Message: "schema up to date"}
+	case !*cfg.Database.MigrateOnStart:
+		return CheckResult{Status: CheckFailed, Message: "migrations must be applied with -migrate before starting", Details: pending}
+	}
+	return CheckResult{Status: CheckWarning, Message: "migrations will be applied at startup", Details: pending}
+}
+
+// failed is a failed check reporting err
+func failed(err error) CheckResult {
+	return CheckResult{Status: CheckFailed, Message: err.Error()}
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/logging"
+	"event-ingestion-system/internal/seed"
+	"event-ingestion-system/internal/version"
+)
+
+// The one-off modes of the server binary. Each opens the database itself
+// and closes it before returning; main only picks the mode.
+
+// RunCheck runs Check on the config at path, printing the JSON report on
+// out and logging on logs. The report says why a config that does not load
+// failed. It reports whether every check passed.
+func RunCheck(ctx context.Context, path string, required bool, out, logs io.Writer) bool {
+	report := CheckReport{Version: version.Get().Version}
+	cfg, err := config.ReadConfig(path, required)
+	if err != nil {
+		report.Checks = []CheckResult{{Name: "config", Status: CheckFailed, Message: err.Error()}}
+	} else {
+		report = Check(ctx, cfg, logging.New(cfg.Logging, logs))
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		fmt.Fprintf(logs, "Failed to write report: %v\n", err)
+		return false
+	}
+	return report.OK
+}
+
+// Seed populates the database with demo data, as the -seed mode
+func Seed(ctx context.Context, cfg *config.Config, opts seed.Options, out io.Writer, logger *slog.Logger) error {
+	db, err := OpenDatabase(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+	opts.Env = cfg.App.Env
+	return seed.Run(ctx, db, opts, out)
+}
+
+// Migrate applies the pending database migrations, waiting up to
+// database.migrate_lock_timeout for any other process migrating
+func Migrate(cfg *config.Config, logger *slog.Logger) error {
+	db, err := connectDatabase(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+	return db.Migrate(cfg.Database.MigrateLockTimeout)
+}
+
+// PrintMigrationPlan prints the migrations Migrate would apply, one per
+// line, on out
+func PrintMigrationPlan(cfg *config.Config, out io.Writer, logger *slog.Logger) error {
+	db, err := connectDatabase(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Fprintln(out, "No pending migrations")
+		return nil
+	}
+	for _, migration := range pending {
+		fmt.Fprintln(out, migration)
+	}
+	return nil
+}
+
+// CompressMetadata compresses stored event metadata batch events at a
+// time, printing progress and the space saved on out. Stopped partway, it
+// starts over from the first event and skips what is already compressed.
+func CompressMetadata(cfg *config.Config, batch int, out io.Writer, logger *slog.Logger) error {
+	if batch <= 0 {
+		return fmt.Errorf("-compress-batch must be positive")
+	}
+	db, err := OpenDatabase(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	var total database.MetadataCompression
+	printed := time.Now()
+	for {
+		result, err := db.CompressStoredMetadata(total.LastID, batch)
+		if err != nil {
+			return err
+		}
+		total.Scanned += result.Scanned
+		total.Compressed += result.Compressed
+		total.BytesBefore += result.BytesBefore
+		total.BytesAfter += result.BytesAfter
+		total.LastID = result.LastID
+		if result.Scanned < int64(batch) {
+			break
+		}
+		if time.Since(printed) >= 10*time.Second {
+			fmt.Fprintf(out, "Scanned %d events up to ID %d, compressed %d\n", total.Scanned, total.LastID, total.Compressed)
+			printed = time.Now()
+		}
+	}
+
+	saved := total.BytesBefore - total.BytesAfter
+	fmt.Fprintf(out, "Scanned %d events, compressed the metadata of %d: %d bytes to %d, %d saved", total.Scanned, total.Compressed, total.BytesBefore, total.BytesAfter, saved)
+	if total.BytesBefore > 0 {
+		fmt.Fprintf(out, " (%.1f%%)", 100*float64(saved)/float64(total.BytesBefore))
+	}
+	fmt.Fprintln(out)
+	return nil
+}
@@ -0,0 +1,55 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"event-ingestion-system/internal/app"
+	"event-ingestion-system/internal/config"
+)
+
+func TestMigrateLeavesNoMigrationPending(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.Host = filepath.Join(t.TempDir(), "events.db")
+	cfg.Defaults()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var plan bytes.Buffer
+	if err := app.PrintMigrationPlan(cfg, &plan, logger); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plan.String(), "No pending migrations") {
+		t.Fatal("a new database has no pending migrations")
+	}
+
+	if err := app.Migrate(cfg, logger); err != nil {
+		t.Fatal(err)
+	}
+	plan.Reset()
+	if err := app.PrintMigrationPlan(cfg, &plan, logger); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(plan.String()); got != "No pending migrations" {
+		t.Fatalf("plan after migrating = %q", got)
+	}
+}
+
+func TestRunCheckReportsAMissingConfig(t *testing.T) {
+	var out bytes.Buffer
+	if app.RunCheck(context.Background(), filepath.Join(t.TempDir(), "missing.yaml"), true, &out, io.Discard) {
+		t.Fatal("check passed without its config file")
+	}
+	var report app.CheckReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.OK || len(report.Checks) != 1 || report.Checks[0].Name != "config" || report.Checks[0].Status != app.CheckFailed {
+		t.Fatalf("report = %+v, want a failed config check", report)
+	}
+}
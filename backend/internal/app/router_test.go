@@ -0,0 +1,171 @@
+package app_test
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"event-ingestion-system/internal/app"
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/openapi"
+	"event-ingestion-system/internal/testsupport"
+)
+
+// TestOpenAPIDocumentsEveryRoute fails when a route is added without its
+// operation in the OpenAPI document. Every optional route group is
+// switched on, and the admin routes are served by the main router.
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	s := testsupport.Start(t, func(cfg *config.Config) {
+		cfg.Metrics.Enabled = true
+		cfg.Receipts.KeyID = "test"
+		cfg.Receipts.Keys = map[string]string{"test": base64.StdEncoding.EncodeToString(seed)}
+		cfg.Auth.OIDC = &config.OIDCConfig{
+			Issuer:         "https://issuer.example.com",
+			ClientID:       "event-system",
+			ClientSecret:   "secret",
+			RedirectURL:    "https://events.example.com/api/v1/auth/oidc/callback",
+			AllowedDomains: []string{"example.com"},
+		}
+	})
+
+	var doc openapi.Document
+	status, err := s.Anonymous.JSON(http.MethodGet, "/openapi.json", nil, &doc)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("get OpenAPI document: status %d: %v", status, err)
+	}
+	for _, route := range openapi.Missing(&doc, s.App.Handler.(*gin.Engine).Routes()) {
+		t.Errorf("route %s is missing from the OpenAPI document", route)
+	}
+}
+
+// clientIPOf ingests an event with the X-Forwarded-For header and returns
+// the client address recorded on it
+func clientIPOf(t *testing.T, s *testsupport.Server, forwardedFor string) string {
+	t.Helper()
+	var accepted struct {
+		ID uint `json:"id"`
+	}
+	status, err := s.Client.With("X-Forwarded-For", forwardedFor).JSON(http.MethodPost, "/api/v1/events", models.EventRequest{
+		TenantID:  s.Tenant.ID,
+		EventType: "proxy.test",
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Metadata:  []byte(`{}`),
+	}, &accepted)
+	if err != nil || status != http.StatusCreated {
+		t.Fatalf("ingest event: status %d: %v", status, err)
+	}
+	var event models.EventResponse
+	status, err = s.Client.JSON(http.MethodGet, fmt.Sprintf("/api/v1/events/%d", accepted.ID), nil, &event)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("get event: status %d: %v", status, err)
+	}
+	return event.ClientIP
+}
+
+func TestForwardedForIsBelievedFromTrustedProxiesOnly(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		proxies []string
+		header  string
+		want    string
+	}{
+		// The test client connects from loopback
+		{"untrusted peer", nil, "203.0.113.7", "127.0.0.1"},
+		{"peer outside the trusted ranges", []string{"10.0.0.0/8"}, "203.0.113.7", "127.0.0.1"},
+		{"trusted peer", []string{"127.0.0.1"}, "203.0.113.7", "203.0.113.7"},
+		// A client prepending an address of its choosing is still found
+		// as the address the trusted proxy appended
+		{"spoofed address before the trusted hop", []string{"127.0.0.0/8"}, "198.51.100.9, 203.0.113.7", "203.0.113.7"},
+		{"trusted hops skipped", []string{"127.0.0.0/8", "10.0.0.0/8"}, "203.0.113.7, 10.1.2.3", "203.0.113.7"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := testsupport.Start(t, func(cfg *config.Config) {
+				cfg.App.TrustedProxies = tc.proxies
+				cfg.GeoIP.RecordClientIP = true
+			})
+			if got := clientIPOf(t, s, tc.header); got != tc.want {
+				t.Fatalf("client_ip = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewRefusesUnusableTrustedProxies(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.Host = filepath.Join(t.TempDir(), "events.db")
+	cfg.Frontend.Mode = "disabled"
+	cfg.Defaults()
+	// Validate rejects these too; New must not start with them regardless
+	cfg.App.TrustedProxies = []string{"10.0.0.0/8", "proxy.internal"}
+
+	a, err := app.New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil {
+		a.Shutdown()
+		t.Fatal("New accepted an unusable app.trusted_proxies")
+	}
+	if !strings.Contains(err.Error(), "app.trusted_proxies") {
+		t.Fatalf("err = %v, want it to name app.trusted_proxies", err)
+	}
+}
+
+// sample scrapes the metrics endpoint and returns the value of series, or
+// 0 when it has not been recorded
+func sample(t *testing.T, s *testsupport.Server, series string) float64 {
+	t.Helper()
+	resp, err := s.Anonymous.Request(http.MethodGet, "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("scrape: status %d: %s", resp.StatusCode, body)
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("sample %q: %v", line, err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+// TestMetricsRecordTheStatusOfRenderedErrors checks that a request failed
+// through c.Error is counted with the status ErrorHandler sends, not the
+// 200 the writer held before it rendered
+func TestMetricsRecordTheStatusOfRenderedErrors(t *testing.T) {
+	s := testsupport.Start(t, func(cfg *config.Config) { cfg.Metrics.Enabled = true })
+	const series = `event_system_http_requests_total{method="GET",route="/api/v1/events",status="%d"}`
+	// The registry is shared by every server in the package
+	before400 := sample(t, s, fmt.Sprintf(series, http.StatusBadRequest))
+	before200 := sample(t, s, fmt.Sprintf(series, http.StatusOK))
+
+	status, err := s.Client.JSON(http.MethodGet, "/api/v1/events?limit=abc", nil, nil)
+	if err != nil || status != http.StatusBadRequest {
+		t.Fatalf("list events: status %d, want %d: %v", status, http.StatusBadRequest, err)
+	}
+	if got := sample(t, s, fmt.Sprintf(series, http.StatusBadRequest)) - before400; got != 1 {
+		t.Errorf("requests counted with status 400 = %v, want 1", got)
+	}
+	if got := sample(t, s, fmt.Sprintf(series, http.StatusOK)) - before200; got != 0 {
+		t.Errorf("requests counted with status 200 = %v, want 0", got)
+	}
+}
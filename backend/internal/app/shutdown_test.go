@@ -0,0 +1,93 @@
+package app_test
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/testsupport"
+)
+
+// TestShutdownKeepsAcknowledgedEvents ingests with ack=received and
+// ack=durable while the app shuts down, as it does on SIGTERM. Every event
+// a client was told was accepted must be stored; the ones refused during
+// shutdown may be retried.
+func TestShutdownKeepsAcknowledgedEvents(t *testing.T) {
+	// A file outlives the app, so the rows can be counted after Shutdown
+	// has closed the database
+	path := filepath.Join(t.TempDir(), "events.db")
+	s := testsupport.Start(t, func(cfg *config.Config) {
+		cfg.Database.Host = path
+		// Small batches and a short interval keep the writer busy while
+		// the buffer drains
+		cfg.Ingest.BatchSize = 8
+		cfg.Ingest.FlushInterval = time.Millisecond
+		cfg.RateLimit.Enabled = false
+	})
+
+	var acked atomic.Int64
+	var started sync.WaitGroup
+	var senders sync.WaitGroup
+	for _, ack := range []string{"received", "durable"} {
+		want := http.StatusAccepted
+		if ack == "durable" {
+			want = http.StatusCreated
+		}
+		for i := 0; i < 4; i++ {
+			started.Add(1)
+			senders.Add(1)
+			go func(ack string, want, sender int) {
+				defer senders.Done()
+				for n := 0; ; n++ {
+					event := models.EventRequest{
+						TenantID:  s.Tenant.ID,
+						EventType: fmt.Sprintf("shutdown.%s.%d", ack, sender),
+						Timestamp: time.Now().UTC().Format(time.RFC3339),
+						Metadata:  []byte(fmt.Sprintf(`{"n":%d}`, n)),
+					}
+					status, err := s.Client.JSON(http.MethodPost, "/api/v1/events?ack="+ack, event, nil)
+					if n == 0 {
+						started.Done()
+					}
+					if err != nil || status != want {
+						// Refused or cut off by the shutdown
+						return
+					}
+					acked.Add(1)
+				}
+			}(ack, want, i)
+		}
+	}
+
+	started.Wait()
+	time.Sleep(50 * time.Millisecond)
+	if !s.App.Shutdown() {
+		t.Fatal("shutdown reported errors")
+	}
+	senders.Wait()
+
+	db, err := database.NewDatabase("sqlite", path, 1, 1, 0, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var stored int64
+	if err := db.DB.Model(&models.Event{}).Where("tenant_id = ?", s.Tenant.ID).Count(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if acked.Load() == 0 {
+		t.Fatal("no event was acknowledged before shutdown")
+	}
+	if stored != acked.Load() {
+		t.Fatalf("stored %d events, acknowledged %d", stored, acked.Load())
+	}
+}
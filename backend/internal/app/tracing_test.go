@@ -0,0 +1,153 @@
+package app_test
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/testsupport"
+)
+
+// collector is an OTLP/HTTP trace receiver that keeps the spans exported
+// to it
+type collector struct {
+	mu    sync.Mutex
+	spans []*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	var req coltracepb.ExportTraceServiceRequest
+	if err == nil {
+		err = proto.Unmarshal(body, &req)
+	}
+	if r.URL.Path != "/v1/traces" || err != nil {
+		http.Error(w, "bad export", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	c.mu.Unlock()
+	resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp)
+}
+
+// span returns the exported span named name, or nil
+func (c *collector) span(name string) *tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// TestServerErrorsCarryTheirTrace fails a request with a 5xx while metrics
+// and tracing are on. The trace the request was sampled into must be the
+// one in the error's meta.trace_id, the exemplar of its latency bucket and
+// the exported server span, which is marked as an error.
+func TestServerErrorsCarryTheirTrace(t *testing.T) {
+	receiver := &collector{}
+	otlp := httptest.NewServer(receiver)
+	defer otlp.Close()
+	// Setup installs the global tracer provider; later tests get a no-op one
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	s := testsupport.Start(t, func(cfg *config.Config) {
+		cfg.Metrics.Enabled = true
+		cfg.Tracing.Enabled = true
+		cfg.Tracing.Endpoint = strings.TrimPrefix(otlp.URL, "http://")
+		cfg.Tracing.Insecure = true
+		cfg.Tracing.SampleRate = 1
+	})
+
+	// Without its table the event list fails with a database error
+	db := s.App.DB.DB
+	if err := db.Exec("ALTER TABLE events RENAME TO events_hidden").Error; err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+			Meta struct {
+				TraceID string `json:"trace_id"`
+			} `json:"meta"`
+		} `json:"error"`
+	}
+	status, err := s.Client.JSON(http.MethodGet, "/api/v1/events", nil, &body)
+	if err := db.Exec("ALTER TABLE events_hidden RENAME TO events").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err != nil || status != http.StatusInternalServerError {
+		t.Fatalf("list events: status %d, want 500: %v", status, err)
+	}
+	traceID := body.Error.Meta.TraceID
+	if len(traceID) != 32 {
+		t.Fatalf("error %+v carries no trace ID", body.Error)
+	}
+
+	// Exemplars are only in the OpenMetrics exposition
+	resp, err := s.Anonymous.With("Accept", "application/openmetrics-text").Request(http.MethodGet, "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrape, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket := `event_system_http_request_duration_seconds_bucket{method="GET",route="/api/v1/events",status="500",`
+	exemplar := `# {trace_id="` + traceID + `"}`
+	found := false
+	for _, line := range strings.Split(string(scrape), "\n") {
+		if strings.HasPrefix(line, bucket) && strings.Contains(line, exemplar) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Errorf("no bucket of the 500's latency has exemplar %s", exemplar)
+	}
+
+	// Shutting down flushes the spans to the collector
+	if !s.App.Shutdown() {
+		t.Fatal("shutdown reported errors")
+	}
+	span := receiver.span("GET /api/v1/events")
+	if span == nil {
+		t.Fatal("the request's server span was not exported")
+	}
+	if got := hex.EncodeToString(span.TraceId); got != traceID {
+		t.Errorf("span trace %s, want %s", got, traceID)
+	}
+	if span.Kind != tracepb.Span_SPAN_KIND_SERVER || span.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR {
+		t.Errorf("span kind %s, status %s, want a server span with error status", span.Kind, span.Status.GetCode())
+	}
+	var statusCode int64
+	for _, attr := range span.Attributes {
+		if attr.Key == "http.response.status_code" {
+			statusCode = attr.Value.GetIntValue()
+		}
+	}
+	if statusCode != http.StatusInternalServerError {
+		t.Errorf("span http.response.status_code = %d, want 500", statusCode)
+	}
+}
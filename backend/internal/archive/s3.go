@@ -0,0 +1,185 @@
+package archive
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/config"
+)
+
+// unsignedPayload leaves the body out of request signatures, which S3
+// allows over TLS and for presigned URLs
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3 keeps files in an S3 bucket, signing requests with AWS Signature
+// Version 4
+type S3 struct {
+	cfg    config.ArchiveS3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3 creates an S3 store
+func NewS3(cfg config.ArchiveS3Config) *S3 {
+	return &S3{cfg: cfg, client: &http.Client{}, now: time.Now}
+}
+
+// Put uploads the file in a single PUT
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	resp, err := s.do(ctx, http.MethodPut, key, body, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Open downloads the object
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// do sends a request for the object signed in the Authorization header. A
+// response that is not 2xx is returned as an error.
+func (s *S3) do(ctx context.Context, method, key string, body io.Reader, size int64) (*http.Response, error) {
+	target := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+
+	now := s.now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	signed := map[string]string{
+		"host":                 target.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	names := sortedKeys(signed)
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{method, target.RawPath, "", headers.String(), signedHeaders, unsignedPayload}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, s.scope(now), signedHeaders, s.signature(canonical, now)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return resp, nil
+}
+
+// URL presigns a GET of the object that saves it as filename
+func (s *S3) URL(key, filename string, expires time.Time) (string, error) {
+	now := s.now().UTC()
+	ttl := int64(expires.Sub(now).Seconds())
+	if ttl < 1 {
+		return "", fmt.Errorf("download link for %s would already have expired", key)
+	}
+
+	target := s.objectURL(key)
+	query := map[string]string{
+		"X-Amz-Algorithm":              "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":             s.cfg.AccessKeyID + "/" + s.scope(now),
+		"X-Amz-Date":                   now.Format("20060102T150405Z"),
+		"X-Amz-Expires":                strconv.FormatInt(ttl, 10),
+		"X-Amz-SignedHeaders":          "host",
+		"response-content-disposition": fmt.Sprintf("attachment; filename=%q", filename),
+		"response-content-type":        ContentType(key),
+	}
+	pairs := make([]string, 0, len(query))
+	for _, name := range sortedKeys(query) {
+		pairs = append(pairs, encode(name, true)+"="+encode(query[name], true))
+	}
+	canonicalQuery := strings.Join(pairs, "&")
+
+	canonical := strings.Join([]string{http.MethodGet, target.RawPath, canonicalQuery, "host:" + target.Host + "\n", "host", unsignedPayload}, "\n")
+	return target.Scheme + "://" + target.Host + target.RawPath + "?" + canonicalQuery + "&X-Amz-Signature=" + s.signature(canonical, now), nil
+}
+
+// objectURL addresses the object by path on a custom endpoint and by
+// virtual host on AWS
+func (s *S3) objectURL(key string) *url.URL {
+	key = strings.TrimPrefix(s.cfg.Prefix+key, "/")
+	u := &url.URL{Scheme: "https", Host: s.cfg.Bucket + ".s3." + s.cfg.Region + ".amazonaws.com", Path: "/" + key}
+	if s.cfg.Endpoint != "" {
+		endpoint, _ := url.Parse(s.cfg.Endpoint) // validated at load
+		u.Scheme, u.Host = endpoint.Scheme, endpoint.Host
+		u.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + s.cfg.Bucket + "/" + key
+	}
+	u.RawPath = encode(u.Path, false)
+	return u
+}
+
+func (s *S3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request
+func (s *S3) signature(canonical string, now time.Time) string {
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + s.scope(now) + "\n" + hex.EncodeToString(digest[:])
+
+	key := []byte("AWS4" + s.cfg.SecretAccessKey)
+	for _, part := range []string{now.Format("20060102"), s.cfg.Region, "s3", "aws4_request", toSign} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(key)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// encode escapes everything but the unreserved characters, as Signature
+// Version 4 requires; slashes are kept in paths
+func encode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
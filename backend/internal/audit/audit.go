@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/models"
+)
+
+// queueSize bounds the number of entries waiting to be written
+const queueSize = 1024
+
+// Actor types recorded on audit log entries
+const (
+	ActorTenant    = "tenant"
+	ActorAdmin     = "admin"
+	ActorAnonymous = "anonymous"
+)
+
+// Entry describes a sensitive operation to be recorded
+type Entry struct {
+	ActorType  string
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	RequestID  string
+	IP         string
+	Details    map[string]interface{}
+	// ImpersonatedBy names the operator behind an impersonation token
+	ImpersonatedBy string
+	// UserID is the tenant's user who acted, if any
+	UserID uint
+}
+
+// Logger writes audit log entries asynchronously through a bounded queue so
+// that recording never blocks the request path. Each entry is chained to
+// the latest one in the database, whichever replica wrote it.
+type Logger struct {
+	db     *database.Database
+	queue  chan models.AuditLog
+	logger *slog.Logger
+}
+
+// NewLogger creates a new audit logger
+func NewLogger(db *database.Database, logger *slog.Logger) *Logger {
+	return &Logger{
+		db:     db,
+		queue:  make(chan models.AuditLog, queueSize),
+		logger: logger.With("component", "audit"),
+	}
+}
+
+// Record queues an entry without blocking the caller.
+// Entries are dropped, and the drop logged, when the queue is full.
+func (l *Logger) Record(e Entry) {
+	entry := models.AuditLog{
+		ActorType:      e.ActorType,
+		ActorID:        e.ActorID,
+		Action:         e.Action,
+		TargetType:     e.TargetType,
+		TargetID:       e.TargetID,
+		RequestID:      e.RequestID,
+		IP:             e.IP,
+		ImpersonatedBy: e.ImpersonatedBy,
+		UserID:         e.UserID,
+		Timestamp:      time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if len(e.Details) > 0 {
+		if details, err := json.Marshal(e.Details); err == nil {
+			entry.Details = string(details)
+		}
+	}
+
+	select {
+	case l.queue <- entry:
+	default:
+		l.logger.Error("Audit queue full, dropping entry",
+			"action", entry.Action,
+			"actor_type", entry.ActorType,
+			"actor_id", entry.ActorID,
+			"target_id", entry.TargetID,
+		)
+	}
+}
+
+// Run writes queued entries until the context is cancelled, then flushes
+// whatever is still queued before returning
+func (l *Logger) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			l.flush()
+			return
+		case entry := <-l.queue:
+			l.write(entry)
+		}
+	}
+}
+
+// flush writes every entry still in the queue
+func (l *Logger) flush() {
+	for {
+		select {
+		case entry := <-l.queue:
+			l.write(entry)
+		default:
+			return
+		}
+	}
+}
+
+// write chains an entry to its predecessor and persists it
+func (l *Logger) write(entry models.AuditLog) {
+	if err := l.db.AppendAuditLog(&entry, Hash); err != nil {
+		l.logger.Error("Failed to write audit entry", "action", entry.Action, "request_id", entry.RequestID, "error", err)
+	}
+}
+
+// Hash computes the chain hash of an entry from its fields and PrevHash.
+// ImpersonatedBy and UserID are only hashed when set, so entries written
+// before they existed still verify.
+func Hash(entry *models.AuditLog) string {
+	fields := []string{
+		entry.PrevHash,
+		entry.ActorType,
+		entry.ActorID,
+		entry.Action,
+		entry.TargetType,
+		entry.TargetID,
+		entry.RequestID,
+		entry.IP,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		entry.Details,
+	}
+	if entry.ImpersonatedBy != "" {
+		fields = append(fields, entry.ImpersonatedBy)
+	}
+	if entry.UserID != 0 {
+		fields = append(fields, "user:"+strconv.FormatUint(uint64(entry.UserID), 10))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/database"
+)
+
+func openTestDatabase(t *testing.T) *database.Database {
+	t.Helper()
+	db, err := database.NewDatabase("sqlite", filepath.Join(t.TempDir(), "audit.db"), 4, 4, time.Hour, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// record writes n entries through each of loggers concurrently, as
+// replicas would, and waits for them to be flushed
+func record(t *testing.T, db *database.Database, loggers, n int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	var running, senders sync.WaitGroup
+	for i := 0; i < loggers; i++ {
+		l := NewLogger(db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			l.Run(ctx)
+		}()
+		senders.Add(1)
+		go func(replica int) {
+			defer senders.Done()
+			for j := 0; j < n; j++ {
+				l.Record(Entry{ActorType: ActorAdmin, Action: "tenant.create", TargetID: fmt.Sprintf("%d-%d", replica, j)})
+			}
+		}(i)
+	}
+	senders.Wait()
+	cancel()
+	running.Wait()
+}
+
+// TestReplicasAppendToOneChain has two loggers, each keeping no state of
+// its own, write to one database at once: the entries must form a single
+// chain
+func TestReplicasAppendToOneChain(t *testing.T) {
+	db := openTestDatabase(t)
+	record(t, db, 2, 200)
+
+	v, err := Verify(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Valid || v.Entries != 400 {
+		t.Fatalf("verification = %+v, want 400 valid entries", v)
+	}
+}
+
+func TestVerifyFindsTampering(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		tamper   string
+		brokenAt uint
+	}{
+		{"edited entry", "UPDATE audit_logs SET action = 'tenant.delete' WHERE id = 2", 2},
+		{"removed entry", "DELETE FROM audit_logs WHERE id = 2", 3},
+		{"removed last entry", "DELETE FROM audit_logs WHERE id = 3", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := openTestDatabase(t)
+			record(t, db, 1, 3)
+			if v, err := Verify(context.Background(), db); err != nil || !v.Valid {
+				t.Fatalf("before tampering: %+v: %v", v, err)
+			}
+
+			if err := db.DB.Exec(tc.tamper).Error; err != nil {
+				t.Fatal(err)
+			}
+			v, err := Verify(context.Background(), db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Valid || v.BrokenAt != tc.brokenAt || v.Reason == "" {
+				t.Errorf("verification = %+v, want broken at %d", v, tc.brokenAt)
+			}
+		})
+	}
+}
+
+// TestChainHeadIsRebuilt appends to a log whose head row is missing, as in
+// logs written before it existed: the chain carries on from the latest
+// entry
+func TestChainHeadIsRebuilt(t *testing.T) {
+	db := openTestDatabase(t)
+	record(t, db, 1, 2)
+	if err := db.DB.Exec("DELETE FROM audit_chain_heads").Error; err != nil {
+		t.Fatal(err)
+	}
+	record(t, db, 1, 2)
+
+	v, err := Verify(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Valid || v.Entries != 4 {
+		t.Fatalf("verification = %+v, want 4 valid entries", v)
+	}
+}
@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"event-ingestion-system/internal/database"
+)
+
+// verifyBatch is the number of entries read at a time while verifying
+const verifyBatch = 1000
+
+// Verification is the outcome of checking the audit log's hash chain
+type Verification struct {
+	// Valid is whether every entry, and the chain head, checked out
+	Valid bool `json:"valid"`
+	// Entries is the number of entries checked
+	Entries int `json:"entries"`
+	// BrokenAt is the ID of the first entry that failed, if any; 0 with
+	// Valid false means the head does not match the last entry
+	BrokenAt uint   `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	// Head is the hash of the last entry
+	Head string `json:"head"`
+}
+
+// Verify walks the audit log in ID order and checks that each entry's hash
+// matches its fields and that it chains to the entry before it, and that
+// the last entry is the stored chain head. It stops at the first entry
+// that was edited, removed or inserted out of chain.
+func Verify(ctx context.Context, db *database.Database) (Verification, error) {
+	var v Verification
+	var afterID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return v, err
+		}
+		entries, err := db.GetAuditLogsAfter(afterID, verifyBatch)
+		if err != nil {
+			return v, err
+		}
+		for i := range entries {
+			entry := &entries[i]
+			switch {
+			case entry.PrevHash != v.Head:
+				return v.broken(entry.ID, fmt.Sprintf("prev_hash %q does not match the previous entry's hash %q", entry.PrevHash, v.Head)), nil
+			case Hash(entry) != entry.Hash:
+				return v.broken(entry.ID, "hash does not match the entry's fields"), nil
+			}
+			v.Entries++
+			v.Head = entry.Hash
+			afterID = entry.ID
+		}
+		if len(entries) < verifyBatch {
+			break
+		}
+	}
+
+	head, err := db.GetAuditChainHead()
+	if err != nil {
+		return v, err
+	}
+	// Logs written before the head existed have none until the next append
+	if head != "" && head != v.Head {
+		return v.broken(0, fmt.Sprintf("chain head %q does not match the last entry", head)), nil
+	}
+	v.Valid = true
+	return v, nil
+}
+
+// broken marks v as failing at an entry
+func (v Verification) broken(id uint, reason string) Verification {
+	v.BrokenAt = id
+	v.Reason = reason
+	return v
+}
@@ -1,12 +1,19 @@
 package auth
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"event-ingestion-system/internal/cache"
 	"event-ingestion-system/internal/database"
+	apperrors "event-ingestion-system/internal/errors"
 	"event-ingestion-system/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -16,30 +23,59 @@ import (
 const (
 	AuthTypeAPIKey = "api_key"
 	AuthTypeJWT    = "jwt"
+	AuthTypeAdmin  = "admin"
+
+	// AdminTokenHeader carries the operator token for admin endpoints
+	AdminTokenHeader = "X-Admin-Token"
+	// ImpersonatedByHeader is set on every response to a request made with
+	// an impersonation token
+	ImpersonatedByHeader = "X-Impersonated-By"
+
+	// authFlushInterval is how often tenants' last authentication times
+	// are written
+	authFlushInterval = 30 * time.Second
+	// authFlushTimeout bounds the last write on shutdown
+	authFlushTimeout = 5 * time.Second
 )
 
 // AuthClaims represents the JWT claims
 type AuthClaims struct {
 	TenantID string `json:"tenant_id"`
-	APIKey   string `json:"api_key"`
+	APIKey   string `json:"api_key,omitempty"`
+	// ImpersonatedBy and Scope are only set on impersonation tokens, whose
+	// ID is that of their models.Impersonation
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
+	Scope          string `json:"scope,omitempty"`
+	// UserID and Role are only set on tokens issued to a tenant's users
+	UserID uint   `json:"user_id,omitempty"`
+	Role   string `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // AuthMiddleware provides authentication middleware
 type AuthMiddleware struct {
 	db           *database.Database
+	tenants      cache.Tenants
 	jwtSecret    []byte
 	jwtExpiry    time.Duration
 	apiKeyHeader string
+	logger       *slog.Logger
+
+	// authenticated holds when tenants last authenticated on this replica,
+	// by tenant ID, until RunAuthTracking writes it
+	authMu        sync.Mutex
+	authenticated map[string]time.Time
 }
 
 // NewAuthMiddleware creates a new auth middleware
-func NewAuthMiddleware(db *database.Database, jwtSecret string, jwtExpiry time.Duration, apiKeyHeader string) *AuthMiddleware {
+func NewAuthMiddleware(db *database.Database, tenants cache.Tenants, jwtSecret string, jwtExpiry time.Duration, apiKeyHeader string, logger *slog.Logger) *AuthMiddleware {
 	return &AuthMiddleware{
 		db:           db,
+		tenants:      tenants,
 		jwtSecret:    []byte(jwtSecret),
 		jwtExpiry:    jwtExpiry,
 		apiKeyHeader: apiKeyHeader,
+		logger:       logger,
 	}
 }
 
@@ -51,10 +87,21 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 		if strings.HasPrefix(authHeader, "Bearer ") {
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 			claims, err := m.validateJWT(tokenString)
+			if err == nil && claims.ImpersonatedBy != "" {
+				m.impersonate(c, claims)
+				return
+			}
+			if err == nil && claims.UserID != 0 {
+				m.authenticateUser(c, claims)
+				return
+			}
 			if err == nil {
 				c.Set("tenant_id", claims.TenantID)
 				c.Set("api_key", claims.APIKey)
 				c.Set("auth_type", AuthTypeJWT)
+				setExpiry(c, claims)
+				m.withTenant(c, claims.TenantID)
+				m.RecordAuth(claims.TenantID)
 				c.Next()
 				return
 			}
@@ -63,22 +110,194 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 		// Try API key
 		apiKey := c.GetHeader(m.apiKeyHeader)
 		if apiKey != "" {
-			tenant, err := m.db.GetTenantByAPIKey(apiKey)
+			tenant, err := m.tenants.ByAPIKey(c.Request.Context(), apiKey)
 			if err == nil && tenant.Active {
 				c.Set("tenant_id", tenant.ID)
 				c.Set("api_key", apiKey)
 				c.Set("auth_type", AuthTypeAPIKey)
 				c.Set("tenant", tenant)
+				m.RecordAuth(tenant.ID)
+				// Later lookups of the tenant in this request reuse it
+				c.Request = c.Request.WithContext(cache.WithTenant(c.Request.Context(), tenant))
 				c.Next()
 				return
 			}
 		}
 
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "unauthorized",
-			"message": "Invalid or missing authentication credentials",
-		})
-		c.Abort()
+		unauthorized(c, "Invalid or missing authentication credentials")
+	}
+}
+
+// RecordAuth notes that a tenant's credentials were accepted. The time is
+// written by RunAuthTracking, so authenticating costs no write. Requests
+// made with impersonation tokens are not recorded.
+func (m *AuthMiddleware) RecordAuth(tenantID string) {
+	m.authMu.Lock()
+	defer m.authMu.Unlock()
+	if m.authenticated == nil {
+		m.authenticated = make(map[string]time.Time)
+	}
+	m.authenticated[tenantID] = time.Now().UTC()
+}
+
+// PendingAuth returns when the tenant last authenticated on this replica,
+// if that is not written yet
+func (m *AuthMiddleware) PendingAuth(tenantID string) (time.Time, bool) {
+	m.authMu.Lock()
+	defer m.authMu.Unlock()
+	at, ok := m.authenticated[tenantID]
+	return at, ok
+}
+
+// RunAuthTracking writes tenants' last authentication times every
+// authFlushInterval until ctx is cancelled, and once more then
+func (m *AuthMiddleware) RunAuthTracking(ctx context.Context) {
+	ticker := time.NewTicker(authFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), authFlushTimeout)
+			m.flushAuth(ctx)
+			cancel()
+			return
+		case <-ticker.C:
+			m.flushAuth(ctx)
+		}
+	}
+}
+
+// flushAuth writes the pending authentication times; times that fail to
+// write are kept for the next flush unless a later one was recorded since
+func (m *AuthMiddleware) flushAuth(ctx context.Context) {
+	m.authMu.Lock()
+	seen := m.authenticated
+	m.authenticated = nil
+	m.authMu.Unlock()
+	if len(seen) == 0 {
+		return
+	}
+
+	if err := m.db.WithContext(ctx).RecordTenantAuth(seen); err != nil {
+		m.logger.ErrorContext(ctx, "Failed to record tenant authentication times", "tenants", len(seen), "error", err)
+		m.authMu.Lock()
+		defer m.authMu.Unlock()
+		if m.authenticated == nil {
+			m.authenticated = seen
+			return
+		}
+		for tenantID, at := range seen {
+			if _, ok := m.authenticated[tenantID]; !ok {
+				m.authenticated[tenantID] = at
+			}
+		}
+	}
+}
+
+// withTenant stores the tenant of a token in the request, as API key
+// authentication does, so ingest need not look it up again. It comes from
+// the tenant cache; if the lookup fails the tenant is simply not stored.
+// Unlike API keys, tokens of inactive tenants are accepted here and
+// rejected by what they are used for, as before.
+func (m *AuthMiddleware) withTenant(c *gin.Context, tenantID string) {
+	tenant, err := m.tenants.ByID(c.Request.Context(), tenantID)
+	if err != nil {
+		return
+	}
+	c.Set("tenant", tenant)
+	c.Request = c.Request.WithContext(cache.WithTenant(c.Request.Context(), tenant))
+}
+
+// unauthorized rejects a tenant request
+func unauthorized(c *gin.Context, message string) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error":   "unauthorized",
+		"message": message,
+	})
+	c.Abort()
+}
+
+// impersonate authenticates a request made with an impersonation token. The
+// token is rejected once its record is revoked, and read-scoped tokens may
+// only read.
+func (m *AuthMiddleware) impersonate(c *gin.Context, claims *AuthClaims) {
+	imp, err := m.db.WithContext(c.Request.Context()).GetImpersonation(claims.ID)
+	if err != nil || imp.RevokedAt != nil || imp.TenantID != claims.TenantID {
+		unauthorized(c, "Impersonation token is invalid or revoked")
+		return
+	}
+
+	c.Header(ImpersonatedByHeader, imp.ImpersonatedBy)
+	if imp.Scope != models.ScopeWrite {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			c.Error(apperrors.ErrForbidden("Impersonation token is read-only"))
+			c.Abort()
+			return
+		}
+	}
+
+	c.Set("tenant_id", imp.TenantID)
+	c.Set("auth_type", AuthTypeJWT)
+	c.Set("impersonated_by", imp.ImpersonatedBy)
+	c.Set("impersonation_id", imp.ID)
+	c.Set("scope", imp.Scope)
+	c.Set("expires_at", imp.ExpiresAt)
+	c.Next()
+}
+
+// authenticateUser authenticates a request made with a user's token. The
+// user is loaded so that deactivation and role changes apply at once rather
+// than when the token expires.
+func (m *AuthMiddleware) authenticateUser(c *gin.Context, claims *AuthClaims) {
+	user, err := m.db.WithContext(c.Request.Context()).GetUser(claims.TenantID, claims.UserID)
+	if err != nil || !user.Active {
+		unauthorized(c, "User is unknown or deactivated")
+		return
+	}
+
+	c.Set("tenant_id", user.TenantID)
+	c.Set("auth_type", AuthTypeJWT)
+	c.Set("user_id", user.ID)
+	c.Set("role", user.Role)
+	setExpiry(c, claims)
+	m.withTenant(c, user.TenantID)
+	m.RecordAuth(user.TenantID)
+	c.Next()
+}
+
+// setExpiry stores when the token of a request expires
+func setExpiry(c *gin.Context, claims *AuthClaims) {
+	if claims.ExpiresAt != nil {
+		c.Set("expires_at", claims.ExpiresAt.Time)
+	}
+}
+
+// RequireAdmin guards operator endpoints with a static admin token, sent in
+// the X-Admin-Token header or, for scrapers that only support bearer
+// credentials, as "Authorization: Bearer <token>". An empty token disables
+// the endpoints entirely.
+func RequireAdmin(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			c.Error(apperrors.ErrForbidden("Admin API is disabled"))
+			c.Abort()
+			return
+		}
+
+		token := c.GetHeader(AdminTokenHeader)
+		if token == "" {
+			token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			c.Error(apperrors.ErrUnauthorized("Invalid or missing admin token"))
+			c.Abort()
+			return
+		}
+
+		c.Set("auth_type", AuthTypeAdmin)
+		c.Next()
 	}
 }
 
@@ -120,6 +339,52 @@ func (m *AuthMiddleware) GenerateJWT(tenant *models.Tenant) (string, error) {
 	return token.SignedString(m.jwtSecret)
 }
 
+// GenerateUserJWT generates a JWT for a tenant's user. It carries no API
+// key, so the user's role applies to everything it is used for.
+func (m *AuthMiddleware) GenerateUserJWT(user *models.User) (string, error) {
+	claims := &AuthClaims{
+		TenantID: user.TenantID,
+		UserID:   user.ID,
+		Role:     user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.jwtExpiry)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    "event-ingestion-system",
+			Subject:   user.TenantID,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(m.jwtSecret)
+}
+
+// JWTExpiry returns how long issued tenant and user tokens are valid
+func (m *AuthMiddleware) JWTExpiry() time.Duration {
+	return m.jwtExpiry
+}
+
+// GenerateImpersonationJWT generates the token of an impersonation. It
+// carries no API key and expires with the impersonation.
+func (m *AuthMiddleware) GenerateImpersonationJWT(imp *models.Impersonation) (string, error) {
+	claims := &AuthClaims{
+		TenantID:       imp.TenantID,
+		ImpersonatedBy: imp.ImpersonatedBy,
+		Scope:          imp.Scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        imp.ID,
+			ExpiresAt: jwt.NewNumericDate(imp.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(imp.CreatedAt),
+			NotBefore: jwt.NewNumericDate(imp.CreatedAt),
+			Issuer:    "event-ingestion-system",
+			Subject:   imp.TenantID,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(m.jwtSecret)
+}
+
 // GetTenantFromContext retrieves the tenant from the Gin context
 func GetTenantFromContext(c *gin.Context) (*models.Tenant, bool) {
 	tenant, exists := c.Get("tenant")
@@ -139,6 +404,67 @@ func GetTenantIDFromContext(c *gin.Context) string {
 	return ""
 }
 
+// IsAdmin reports whether the request was authenticated with the admin token
+func IsAdmin(c *gin.Context) bool {
+	return c.GetString("auth_type") == AuthTypeAdmin
+}
+
+// GetImpersonatorFromContext returns the operator impersonating the tenant,
+// or "" when the request was not made with an impersonation token
+func GetImpersonatorFromContext(c *gin.Context) string {
+	return c.GetString("impersonated_by")
+}
+
+// IsImpersonated reports whether the request was made with an impersonation
+// token
+func IsImpersonated(c *gin.Context) bool {
+	return GetImpersonatorFromContext(c) != ""
+}
+
+// GetUserIDFromContext returns the ID of the tenant's user who made the
+// request, or 0 when it was made with an API key or tenant token
+func GetUserIDFromContext(c *gin.Context) uint {
+	return c.GetUint("user_id")
+}
+
+// GetRoleFromContext returns the role of the tenant's user who made the
+// request, or "" when it was not made by a user
+func GetRoleFromContext(c *gin.Context) string {
+	return c.GetString("role")
+}
+
+// GetScopeFromContext returns the scope of the impersonation token the
+// request was made with, or "" when it was not made with one
+func GetScopeFromContext(c *gin.Context) string {
+	return c.GetString("scope")
+}
+
+// GetExpiryFromContext returns when the token the request was made with
+// expires, or nil when it was made with an API key, which does not
+func GetExpiryFromContext(c *gin.Context) *time.Time {
+	if expiry := c.GetTime("expires_at"); !expiry.IsZero() {
+		return &expiry
+	}
+	return nil
+}
+
+// Credential labels how the request was authenticated, for recording on
+// what it creates: "api_key" for the tenant's API key, "token" for a tenant
+// token, "user:<id>" for a user and "impersonation" for an operator
+func Credential(c *gin.Context) string {
+	switch {
+	case IsImpersonated(c):
+		return "impersonation"
+	case GetUserIDFromContext(c) != 0:
+		return fmt.Sprintf("user:%d", GetUserIDFromContext(c))
+	case c.GetString("auth_type") == AuthTypeAPIKey:
+		return AuthTypeAPIKey
+	case c.GetString("auth_type") == AuthTypeJWT:
+		return "token"
+	}
+	return ""
+}
+
 // GetAPIKeyFromContext retrieves the API key from the Gin context
 func GetAPIKeyFromContext(c *gin.Context) string {
 	apiKey, _ := c.Get("api_key")
@@ -0,0 +1,186 @@
+// Package cache keeps short-lived copies of hot database reads.
+//
+// TenantCache serves the tenant lookups made for every ingested event:
+// authentication by API key, the tenant check in ingest and the settings
+// it carries. Entries live for the configured TTL (auth.tenant_cache_ttl).
+// Changes made through this replica invalidate the tenant at once; the TTL
+// bounds how long a change made by another replica, such as deactivating
+// a tenant or rotating its API key, can go unseen here.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+)
+
+// Tenants looks tenants up for authentication and ingest. TenantCache
+// implements it over the database; tests can substitute their own.
+type Tenants interface {
+	ByID(ctx context.Context, id string) (*models.Tenant, error)
+	ByAPIKey(ctx context.Context, apiKey string) (*models.Tenant, error)
+	// Invalidate drops the tenant, so its next lookup reads the database
+	Invalidate(id string)
+}
+
+// TenantCache is a read-through cache of tenants by ID and API key. Lookups
+// that find no tenant are not cached. It is safe for concurrent use.
+type TenantCache struct {
+	db  *database.Database
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	byID  map[string]tenantEntry
+	byKey map[string]string // API key to tenant ID
+	// generation counts invalidations, so a lookup that raced one doesn't
+	// cache what it read before it
+	generation uint64
+	swept      time.Time
+}
+
+type tenantEntry struct {
+	tenant  models.Tenant
+	expires time.Time
+}
+
+var _ Tenants = (*TenantCache)(nil)
+
+// NewTenantCache creates a tenant cache whose entries live for ttl; with a
+// ttl that isn't positive every lookup reads the database
+func NewTenantCache(db *database.Database, ttl time.Duration) *TenantCache {
+	return &TenantCache{
+		db:    db,
+		ttl:   ttl,
+		now:   time.Now,
+		byID:  make(map[string]tenantEntry),
+		byKey: make(map[string]string),
+	}
+}
+
+// ByID returns the tenant with id. A tenant this request has already looked
+// up is returned without a lookup.
+func (tc *TenantCache) ByID(ctx context.Context, id string) (*models.Tenant, error) {
+	if tenant := FromContext(ctx); tenant != nil && tenant.ID == id {
+		return tenant, nil
+	}
+	if tenant := tc.cached(id, ""); tenant != nil {
+		return tenant, nil
+	}
+	return tc.load(func() (*models.Tenant, error) {
+		return tc.db.WithContext(ctx).GetTenantByID(id)
+	})
+}
+
+// ByAPIKey returns the tenant whose API key is apiKey
+func (tc *TenantCache) ByAPIKey(ctx context.Context, apiKey string) (*models.Tenant, error) {
+	tc.mu.Lock()
+	id, ok := tc.byKey[apiKey]
+	tc.mu.Unlock()
+	if ok {
+		if tenant := tc.cached(id, apiKey); tenant != nil {
+			return tenant, nil
+		}
+	}
+	return tc.load(func() (*models.Tenant, error) {
+		return tc.db.WithContext(ctx).GetTenantByAPIKey(apiKey)
+	})
+}
+
+// Invalidate drops the tenant, so its next lookup reads the database
+func (tc *TenantCache) Invalidate(id string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.generation++
+	tc.drop(id)
+}
+
+// cached returns a copy of the tenant while its entry is live, and when
+// apiKey isn't empty only if that is still its key
+func (tc *TenantCache) cached(id, apiKey string) *models.Tenant {
+	if tc.ttl <= 0 {
+		return nil
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	entry, ok := tc.byID[id]
+	if !ok || !tc.now().Before(entry.expires) || (apiKey != "" && entry.tenant.APIKey != apiKey) {
+		metrics.TenantCacheLookup("miss")
+		return nil
+	}
+	metrics.TenantCacheLookup("hit")
+	tenant := entry.tenant
+	return &tenant
+}
+
+// load reads a tenant with read and caches it, unless the cache was
+// invalidated meanwhile
+func (tc *TenantCache) load(read func() (*models.Tenant, error)) (*models.Tenant, error) {
+	if tc.ttl <= 0 {
+		return read()
+	}
+	tc.mu.Lock()
+	generation := tc.generation
+	tc.mu.Unlock()
+
+	tenant, err := read()
+	if err != nil {
+		return nil, err
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.generation != generation {
+		return tenant, nil
+	}
+	now := tc.now()
+	tc.sweep(now)
+	tc.drop(tenant.ID)
+	tc.byID[tenant.ID] = tenantEntry{tenant: *tenant, expires: now.Add(tc.ttl)}
+	tc.byKey[tenant.APIKey] = tenant.ID
+	return tenant, nil
+}
+
+// drop removes the tenant's entries; the caller holds mu
+func (tc *TenantCache) drop(id string) {
+	entry, ok := tc.byID[id]
+	if !ok {
+		return
+	}
+	delete(tc.byID, id)
+	if tc.byKey[entry.tenant.APIKey] == id {
+		delete(tc.byKey, entry.tenant.APIKey)
+	}
+}
+
+// sweep removes expired entries, at most once per TTL, so tenants that
+// stop sending don't stay cached; the caller holds mu
+func (tc *TenantCache) sweep(now time.Time) {
+	if now.Sub(tc.swept) < tc.ttl {
+		return
+	}
+	tc.swept = now
+	for id, entry := range tc.byID {
+		if !now.Before(entry.expires) {
+			tc.drop(id)
+		}
+	}
+}
+
+type contextKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant authenticated for
+// the request, which ByID then returns without a lookup
+func WithTenant(ctx context.Context, tenant *models.Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext returns the tenant WithTenant stored in ctx, or nil
+func FromContext(ctx context.Context) *models.Tenant {
+	tenant, _ := ctx.Value(contextKey{}).(*models.Tenant)
+	return tenant
+}
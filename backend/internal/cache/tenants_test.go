@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/models"
+)
+
+func openDatabase(t *testing.T) *database.Database {
+	t.Helper()
+	db, err := database.NewDatabase("sqlite", filepath.Join(t.TempDir(), "events.db"), 1, 1, time.Hour, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// deactivate deactivates the tenant in the database without telling the
+// cache, as another replica does
+func deactivate(t *testing.T, db *database.Database, id string) {
+	t.Helper()
+	if err := db.DB.Model(&models.Tenant{}).Where("id = ?", id).Update("active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeactivationIsSeenWithinTheTTL(t *testing.T) {
+	const ttl = 5 * time.Second
+	ctx := context.Background()
+	db := openDatabase(t)
+	tenant := models.Tenant{ID: "tenant-1", Name: "Tenant", APIKey: "key-1", Active: true}
+	if err := db.CreateTenant(&tenant); err != nil {
+		t.Fatal(err)
+	}
+	tc := NewTenantCache(db, ttl)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tc.now = func() time.Time { return now }
+
+	if got, err := tc.ByAPIKey(ctx, "key-1"); err != nil || !got.Active {
+		t.Fatalf("ByAPIKey = %+v, %v, want the active tenant", got, err)
+	}
+	deactivate(t, db, tenant.ID)
+
+	// Until the entry expires this replica still authenticates the tenant
+	now = now.Add(ttl - time.Millisecond)
+	if got, err := tc.ByAPIKey(ctx, "key-1"); err != nil || !got.Active {
+		t.Fatalf("ByAPIKey before the TTL = %+v, %v, want the cached active tenant", got, err)
+	}
+	// Once it has, the lookup reads the deactivated tenant, which
+	// authentication refuses
+	now = now.Add(time.Millisecond)
+	if got, err := tc.ByAPIKey(ctx, "key-1"); err != nil || got.Active {
+		t.Fatalf("ByAPIKey after the TTL = %+v, %v, want the tenant inactive", got, err)
+	}
+	if got, err := tc.ByID(ctx, tenant.ID); err != nil || got.Active {
+		t.Fatalf("ByID after the TTL = %+v, %v, want the tenant inactive", got, err)
+	}
+}
+
+func TestInvalidateIsSeenAtOnce(t *testing.T) {
+	ctx := context.Background()
+	db := openDatabase(t)
+	tenant := models.Tenant{ID: "tenant-1", Name: "Tenant", APIKey: "key-1", Active: true}
+	if err := db.CreateTenant(&tenant); err != nil {
+		t.Fatal(err)
+	}
+	tc := NewTenantCache(db, time.Hour)
+
+	if _, err := tc.ByAPIKey(ctx, "key-1"); err != nil {
+		t.Fatal(err)
+	}
+	deactivate(t, db, tenant.ID)
+	tc.Invalidate(tenant.ID)
+	if got, err := tc.ByAPIKey(ctx, "key-1"); err != nil || got.Active {
+		t.Fatalf("ByAPIKey after Invalidate = %+v, %v, want the tenant inactive", got, err)
+	}
+}
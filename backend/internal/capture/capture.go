@@ -0,0 +1,342 @@
+// Package capture keeps the latest failed requests in memory, so support can
+// see what a client sent when it reports an error after the fact. Nothing is
+// persisted. Credential headers are never stored, and bodies are truncated
+// with secret-looking JSON fields redacted before they are kept.
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Entry is one captured request and the response it got
+type Entry struct {
+	ID        uint64    `json:"id"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	Method    string    `json:"method"`
+	// Route is the registered route pattern; empty when no route matched
+	Route     string            `json:"route"`
+	Path      string            `json:"path"`
+	Query     string            `json:"query,omitempty"`
+	Headers   map[string]string `json:"headers"`
+	Status    int               `json:"status"`
+	Code      string            `json:"code,omitempty"` // error code of the response
+	LatencyMS float64           `json:"latency_ms"`
+
+	RequestBody  string `json:"request_body,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	// Truncated is set when either body was cut at capture_body_bytes
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Filter selects entries. Code matches the HTTP status, such as "400", or
+// the error code, such as "invalid_request".
+type Filter struct {
+	TenantID string
+	Route    string
+	Code     string
+	Limit    int
+}
+
+// secretHints mark headers, query parameters and JSON fields as secret by
+// name, compared in lower case without dashes or underscores
+var secretHints = []string{"authorization", "cookie", "password", "passwd", "secret", "token", "apikey", "credential", "privatekey", "signature"}
+
+// secretValue finds the values of secret-looking fields in JSON that could
+// not be parsed, such as a truncated body; the value may lack its closing
+// quote
+var secretValue = regexp.MustCompile(`(?i)("[^"]*(?:authorization|cookie|password|passwd|secret|token|api_?key|credential|private_?key|signature)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*(?:"|$)`)
+
+// Recorder keeps the latest failed requests in a ring buffer. It is safe
+// for concurrent use.
+type Recorder struct {
+	cfg           config.DebugConfig
+	secretHeaders map[string]bool
+
+	mu      sync.Mutex
+	entries []Entry
+	next    int // index the next entry goes to
+	seq     uint64
+}
+
+// New creates a recorder. secretHeaders names further headers whose values
+// must never be stored, such as the API key header; headers with
+// secret-looking names are dropped regardless.
+func New(cfg config.DebugConfig, secretHeaders ...string) *Recorder {
+	r := &Recorder{cfg: cfg, secretHeaders: make(map[string]bool)}
+	for _, name := range append([]string{"Authorization", "Proxy-Authorization", "Cookie"}, secretHeaders...) {
+		r.secretHeaders[http.CanonicalHeaderKey(name)] = true
+	}
+	return r
+}
+
+// Enabled reports whether failed requests are captured
+func (r *Recorder) Enabled() bool {
+	return r.cfg.CaptureFailedRequests
+}
+
+// Start begins watching a request: its body and response are copied, up to
+// capture_body_bytes, as they are read and written. Call the returned
+// function once the response is complete; it stores the request if it
+// failed.
+func (r *Recorder) Start(c *gin.Context) func() {
+	start := time.Now()
+	limit := r.cfg.CaptureBodyBytes
+
+	var body *teeBody
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		body = &teeBody{ReadCloser: c.Request.Body, limit: limit}
+		c.Request.Body = body
+	}
+	writer := &teeWriter{ResponseWriter: c.Writer, limit: limit}
+	c.Writer = writer
+
+	return func() {
+		c.Writer = writer.ResponseWriter
+		status := writer.Status()
+		if status < http.StatusBadRequest {
+			return
+		}
+
+		entry := Entry{
+			Time:      start.UTC(),
+			RequestID: c.GetString("request_id"),
+			TenantID:  c.GetString("tenant_id"),
+			Method:    c.Request.Method,
+			Route:     c.FullPath(),
+			Path:      c.Request.URL.Path,
+			Query:     r.query(c.Request.URL.RawQuery),
+			Headers:   r.headers(c.Request.Header),
+			Status:    status,
+			LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if body != nil {
+			// A request rejected before its body was read still shows it
+			body.fill()
+			entry.RequestBody, entry.Truncated = clean(body.buf.Bytes(), body.truncated, limit)
+		}
+		response, truncated := writer.captured()
+		entry.Code = errorCode(response)
+		entry.ResponseBody, truncated = clean(response, truncated, limit)
+		entry.Truncated = entry.Truncated || truncated
+
+		r.add(entry)
+	}
+}
+
+// List returns the matching entries, newest first
+func (r *Recorder) List(f Filter) []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := []Entry{}
+	for i := 1; i <= len(r.entries); i++ {
+		e := r.entries[(r.next-i+len(r.entries))%len(r.entries)]
+		if f.TenantID != "" && e.TenantID != f.TenantID {
+			continue
+		}
+		if f.Route != "" && e.Route != f.Route && e.Path != f.Route {
+			continue
+		}
+		if f.Code != "" && f.Code != strconv.Itoa(e.Status) && f.Code != e.Code {
+			continue
+		}
+		out = append(out, e)
+		if f.Limit > 0 && len(out) == f.Limit {
+			break
+		}
+	}
+	return out
+}
+
+func (r *Recorder) add(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	e.ID = r.seq
+	if len(r.entries) < r.cfg.CaptureSize {
+		r.entries = append(r.entries, e)
+	} else {
+		r.entries[r.next] = e
+	}
+	r.next = (r.next + 1) % r.cfg.CaptureSize
+}
+
+// headers returns the request headers with every secret value replaced
+func (r *Recorder) headers(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		if r.secretHeaders[name] || secretName(name) {
+			out[name] = config.RedactedValue
+			continue
+		}
+		out[name] = strings.Join(values, ", ")
+	}
+	return out
+}
+
+// query returns the raw query with the values of secret-looking parameters,
+// such as the WebSocket api_key, replaced
+func (r *Recorder) query(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return config.RedactedValue
+	}
+	for name := range values {
+		if secretName(name) {
+			values[name] = []string{config.RedactedValue}
+		}
+	}
+	return values.Encode()
+}
+
+func secretName(name string) bool {
+	name = strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+	for _, hint := range secretHints {
+		if strings.Contains(name, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// clean redacts a captured body and cuts it to limit bytes
+func clean(body []byte, truncated bool, limit int) (string, bool) {
+	if len(body) == 0 {
+		return "", truncated
+	}
+
+	var doc any
+	if !truncated && json.Unmarshal(body, &doc) == nil {
+		body, _ = json.Marshal(redact(doc))
+	} else {
+		body = secretValue.ReplaceAll(body, []byte(`${1}"`+config.RedactedValue+`"`))
+	}
+	if len(body) > limit {
+		body, truncated = body[:limit], true
+	}
+	// Binary bodies and characters split by the cut become U+FFFD
+	return strings.ToValidUTF8(string(body), "\uFFFD"), truncated
+}
+
+// redact replaces the values of secret-looking fields throughout a JSON
+// document
+func redact(node any) any {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if secretName(key) {
+				v[key] = config.RedactedValue
+			} else {
+				v[key] = redact(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redact(value)
+		}
+	}
+	return node
+}
+
+// errorCode reads the code of an error response, in the error envelope or
+// the flat body of tenant authentication
+func errorCode(body []byte) string {
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) != nil || len(envelope.Error) == 0 {
+		return ""
+	}
+	var nested struct {
+		Code string `json:"code"`
+	}
+	if json.Unmarshal(envelope.Error, &nested) == nil {
+		return nested.Code
+	}
+	var flat string
+	json.Unmarshal(envelope.Error, &flat)
+	return flat
+}
+
+// teeBody keeps the first limit bytes read from a request body
+type teeBody struct {
+	io.ReadCloser
+	limit     int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	keep(&b.buf, &b.truncated, b.limit, p[:n])
+	return n, err
+}
+
+// fill reads on until the limit when the handler stopped short of it
+func (b *teeBody) fill() {
+	if !b.truncated {
+		io.CopyN(io.Discard, b, int64(b.limit-b.buf.Len()+1))
+	}
+}
+
+// teeWriter keeps the first limit bytes of a response. The timeout
+// middleware may write from its timer, hence the lock.
+type teeWriter struct {
+	gin.ResponseWriter
+	limit int
+
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (w *teeWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.mu.Lock()
+	keep(&w.buf, &w.truncated, w.limit, p[:n])
+	w.mu.Unlock()
+	return n, err
+}
+
+func (w *teeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (w *teeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *teeWriter) captured() ([]byte, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return bytes.Clone(w.buf.Bytes()), w.truncated
+}
+
+// keep appends p to buf up to limit bytes, noting when some are left out
+func keep(buf *bytes.Buffer, truncated *bool, limit int, p []byte) {
+	room := limit - buf.Len()
+	if len(p) > room {
+		p, *truncated = p[:max(room, 0)], true
+	}
+	buf.Write(p)
+}
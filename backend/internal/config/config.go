@@ -2,10 +2,13 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"gopkg.in/yaml.v3"
 )
 
@@ -19,6 +22,34 @@ type Config struct {
 	WebSocket WebSocketConfig `yaml:"websocket"`
 	Webhooks  WebhooksConfig  `yaml:"webhooks"`
 	Logging   LoggingConfig   `yaml:"logging"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+
+	Compression CompressionConfig `yaml:"compression"`
+	Cors        CorsConfig        `yaml:"cors"`
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+	Health      HealthConfig      `yaml:"health"`
+	Frontend    FrontendConfig    `yaml:"frontend"`
+	Ingest      IngestConfig      `yaml:"ingest"`
+	GeoIP       GeoIPConfig       `yaml:"geoip"`
+	Sinks       SinksConfig       `yaml:"sinks"`
+	DeadLetters DeadLettersConfig `yaml:"dead_letters"`
+	Leader      LeaderConfig      `yaml:"leader"`
+	Reports     ReportsConfig     `yaml:"reports"`
+	Alerts      AlertsConfig      `yaml:"alerts"`
+	Anomalies   AnomaliesConfig   `yaml:"anomalies"`
+	Debug       DebugConfig       `yaml:"debug"`
+	Archive     ArchiveConfig     `yaml:"archive"`
+	Exports     ExportsConfig     `yaml:"exports"`
+	Imports     ImportsConfig     `yaml:"imports"`
+	Redactions  RedactionsConfig  `yaml:"redactions"`
+	Receipts    ReceiptsConfig    `yaml:"receipts"`
+	Nats        NatsConfig        `yaml:"nats"`
+	MQTT        MQTTConfig        `yaml:"mqtt"`
+
+	// Flags defines the feature flags and whether each is on for tenants
+	// without an override in their settings
+	Flags map[string]bool `yaml:"flags"`
 }
 
 // AppConfig represents application settings
@@ -27,31 +58,174 @@ type AppConfig struct {
 	Port int    `yaml:"port"`
 	Mode string `yaml:"mode"`
 	Env  string `yaml:"env"`
+
+	// Listen overrides Host/Port; "unix:/path/to.sock" serves on a Unix
+	// domain socket created with SocketMode (octal, e.g. "0660")
+	Listen     string `yaml:"listen"`
+	SocketMode string `yaml:"socket_mode"`
+
+	// DisableServerHeader omits the Server header carrying the build version
+	DisableServerHeader bool `yaml:"disable_server_header"`
+
+	// TrustedProxies are the CIDR ranges or addresses of the proxies whose
+	// X-Forwarded-For and X-Real-IP headers name the client; requests from
+	// other peers are attributed to the peer
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// HTTP server timeouts
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// RequestTimeout bounds handler processing for API routes (504 when exceeded)
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// LongPollMaxWait caps how long GET /api/v1/events/poll parks a request;
+	// waits are also cut short to finish within RequestTimeout
+	LongPollMaxWait time.Duration `yaml:"long_poll_max_wait"`
+	// ShutdownDelay keeps serving after readiness turns unready so load
+	// balancers can stop routing here; ShutdownTimeout bounds each
+	// shutdown step
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// MissingVersion is what updates of versioned resources (tenant settings,
+	// webhooks) without If-Match or a version do: "last_write_wins" applies
+	// them, "reject" answers 428
+	MissingVersion string `yaml:"missing_version"`
+
+	// Admin listener for /api/v1/admin, metrics and pprof; when AdminPort is
+	// 0 the admin API stays on the main listener
+	AdminHost string `yaml:"admin_host"`
+	AdminPort int    `yaml:"admin_port"`
+
+	// Debug listener for pprof, expvar and route/goroutine dumps; disabled when DebugPort is 0
+	DebugHost string `yaml:"debug_host"`
+	DebugPort int    `yaml:"debug_port"`
+
+	TLS TLSConfig `yaml:"tls"`
+}
+
+// FileMode parses SocketMode as an octal permission mode
+func (a *AppConfig) FileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(a.SocketMode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if mode > 0o777 {
+		return 0, fmt.Errorf("mode %s out of range", a.SocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// TLSConfig represents TLS termination settings. TLS is served when either a
+// certificate/key pair or autocert hosts are configured.
+type TLSConfig struct {
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	MinVersion string `yaml:"min_version"` // "1.2" or "1.3"
+
+	// Let's Encrypt certificates for these hosts, cached in AutocertCacheDir
+	AutocertHosts    []string `yaml:"autocert_hosts"`
+	AutocertCacheDir string   `yaml:"autocert_cache_dir"`
+	AutocertEmail    string   `yaml:"autocert_email"`
+
+	// RedirectPort serves plain HTTP redirects to HTTPS (and ACME challenges); 0 disables
+	RedirectPort int `yaml:"redirect_port"`
+}
+
+// Enabled reports whether the server should terminate TLS
+func (t *TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || len(t.AutocertHosts) > 0
 }
 
 // DatabaseConfig represents database connection settings
 type DatabaseConfig struct {
-	Driver          string        `yaml:"driver"`
-	Host            string        `yaml:"host"`
+	Driver string `yaml:"driver"`
+	Host   string `yaml:"host"` // SQLite: file path, PostgreSQL and MySQL: host
+
+	// PostgreSQL and MySQL connection settings
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password" redact:"true"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+
 	MaxOpenConns    int           `yaml:"max_open_conns"`
 	MaxIdleConns    int           `yaml:"max_idle_conns"`
 	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	// AcquireTimeout is how long a query waits for a pooled connection
+	// before failing with database_busy; 0 waits as long as the request
+	AcquireTimeout time.Duration `yaml:"acquire_timeout"`
+	// PoolStatsInterval is how often pool saturation is sampled for metrics
+	PoolStatsInterval time.Duration `yaml:"pool_stats_interval"`
+	// QueryTimeout is how long an interactive event search may run before
+	// it is cancelled and answered 504 query_timeout
+	QueryTimeout time.Duration `yaml:"query_timeout"`
+	// CompressMetadataAbove is the metadata length in bytes above which
+	// events are stored zstd-compressed; 0 disables compression. Ignored on
+	// PostgreSQL, which compresses large values itself.
+	CompressMetadataAbove int `yaml:"compress_metadata_above"`
+	// WriteConflictRetries is how many times an event insert aborted for a
+	// serialization failure or deadlock is retried before it is answered
+	// 409 write_conflict (default 3); negative fails it at once
+	WriteConflictRetries int `yaml:"write_conflict_retries"`
+	// MigrateOnStart applies pending migrations when the server starts
+	// (default true). Turned off, a migration job runs -migrate instead.
+	MigrateOnStart *bool `yaml:"migrate_on_start"`
+	// MigrateLockTimeout is how long a process waits for another one to
+	// finish migrating before it fails
+	MigrateLockTimeout time.Duration `yaml:"migrate_lock_timeout"`
+	// EventStore keeps events: sql, in the database with everything else,
+	// or memory, in the process, for development
+	EventStore string `yaml:"event_store"`
 }
 
 // RedisConfig represents Redis connection settings
 type RedisConfig struct {
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
-	Password string `yaml:"password"`
+	Password string `yaml:"password" redact:"true"`
 	DB       int    `yaml:"db"`
 	PoolSize int    `yaml:"pool_size"`
 }
 
 // AuthConfig represents authentication settings
 type AuthConfig struct {
-	JWTSecret    string        `yaml:"jwt_secret"`
+	JWTSecret    string        `yaml:"jwt_secret" redact:"true"`
 	JWTExpiry    time.Duration `yaml:"jwt_expiry"`
 	APIKeyHeader string        `yaml:"api_key_header"`
+	// AdminToken guards the /api/v1/admin endpoints; they are disabled when empty
+	AdminToken string `yaml:"admin_token" redact:"true"`
+	// ImpersonationTTL is the default and longest lifetime of an
+	// impersonation token
+	ImpersonationTTL time.Duration `yaml:"impersonation_ttl"`
+	// TenantCacheTTL is how long a tenant looked up by API key or ID is
+	// reused; it bounds how late this replica sees a tenant deactivated or
+	// its key rotated through another. Negative disables the cache.
+	TenantCacheTTL time.Duration `yaml:"tenant_cache_ttl"`
+	// OIDC enables dashboard sign-in through an OpenID Connect provider;
+	// it is off when the section is absent
+	OIDC *OIDCConfig `yaml:"oidc"`
+}
+
+// OIDCConfig represents an OpenID Connect provider users sign in with
+type OIDCConfig struct {
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret" redact:"true"`
+	// RedirectURL is this server's /api/v1/auth/oidc/callback as the
+	// provider reaches it
+	RedirectURL string `yaml:"redirect_url"`
+	// AllowedDomains are the email domains that may sign in
+	AllowedDomains []string `yaml:"allowed_domains"`
+	// DomainTenants maps email domains to the tenant whose users they are;
+	// unknown users of a mapped domain are provisioned with DefaultRole
+	DomainTenants map[string]string `yaml:"domain_tenants"`
+	DefaultRole   string            `yaml:"default_role"`
+	// ClockSkew is the leeway allowed on ID token timestamps
+	ClockSkew time.Duration `yaml:"clock_skew"`
+	// DashboardURL receives the token in its fragment after sign-in;
+	// without it the callback answers with JSON
+	DashboardURL string `yaml:"dashboard_url"`
 }
 
 // RateLimitConfig represents rate limiting settings
@@ -61,6 +235,36 @@ type RateLimitConfig struct {
 	Burst             int  `yaml:"burst"`
 }
 
+// ConcurrencyConfig bounds how many requests of a route group run at once
+// on each replica, so that slow ones cannot starve the others. A limit of 0
+// takes the default and a negative one lifts it.
+type ConcurrencyConfig struct {
+	// Exports covers archive downloads and export jobs (default 4)
+	Exports int `yaml:"exports"`
+	// Searches covers event searches and stats (default 16)
+	Searches int `yaml:"searches"`
+	// Ingestion covers event writes (default unbounded)
+	Ingestion int `yaml:"ingestion"`
+	// QueueDepth requests of a full group wait up to QueueTimeout for a
+	// slot; later ones are answered 503 at once. Negative disables waiting.
+	QueueDepth   int           `yaml:"queue_depth"`
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+}
+
+// HealthConfig grades the components /ready reports. A threshold of 0
+// takes the default and a negative one disables it.
+type HealthConfig struct {
+	// CheckTimeout bounds each component's check; checks run concurrently
+	CheckTimeout time.Duration `yaml:"check_timeout"`
+	// DatabaseLatencyDegraded marks the database degraded when a ping
+	// takes longer (default 500ms)
+	DatabaseLatencyDegraded time.Duration `yaml:"database_latency_degraded"`
+	// WebhookQueueDegraded and WebhookQueueUnhealthy grade the number of
+	// events waiting for webhook delivery (default 1000 and disabled)
+	WebhookQueueDegraded  int `yaml:"webhook_queue_degraded"`
+	WebhookQueueUnhealthy int `yaml:"webhook_queue_unhealthy"`
+}
+
 // WebSocketConfig represents WebSocket settings
 type WebSocketConfig struct {
 	PingInterval    time.Duration `yaml:"ping_interval"`
@@ -68,6 +272,18 @@ type WebSocketConfig struct {
 	WriteTimeout    time.Duration `yaml:"write_timeout"`
 	ReadBufferSize  int           `yaml:"read_buffer_size"`
 	WriteBufferSize int           `yaml:"write_buffer_size"`
+	// MaxMessageSize bounds a message read from a client, in bytes; larger
+	// ones close the connection with 1009
+	MaxMessageSize int64 `yaml:"max_message_size"`
+
+	// Per-connection throttling of client-originated messages
+	MessageRateLimit  float64 `yaml:"message_rate_limit"` // messages per second, 0 disables
+	MessageBurst      int     `yaml:"message_burst"`
+	MaxRateViolations int     `yaml:"max_rate_violations"` // consecutive violations before closing
+
+	// ThroughputInterval is how often clients subscribed to throughput are
+	// sent their tenant's ingest rates
+	ThroughputInterval time.Duration `yaml:"throughput_interval"`
 }
 
 // WebhooksConfig represents webhook settings
@@ -75,6 +291,29 @@ type WebhooksConfig struct {
 	Enabled    bool          `yaml:"enabled"`
 	MaxRetries int           `yaml:"max_retries"`
 	RetryDelay time.Duration `yaml:"retry_delay"`
+	// Timeout bounds a delivery attempt up to the response headers, and
+	// ConnectTimeout its connection, TLS handshake included. A webhook may
+	// override both.
+	Timeout        time.Duration `yaml:"timeout"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	Proxy          ProxyConfig   `yaml:"proxy"`
+	// AllowedNetworks are CIDR ranges or addresses deliveries may reach
+	// although they are loopback, private, link-local or otherwise not
+	// public, for endpoints on internal networks
+	AllowedNetworks []string `yaml:"allowed_networks"`
+	// PausedBufferSize bounds the deliveries held for each paused webhook
+	// until it is resumed; later ones become dead letters
+	PausedBufferSize int `yaml:"paused_buffer_size"`
+}
+
+// ProxyConfig routes outgoing HTTP requests through a proxy
+type ProxyConfig struct {
+	// URL is an http, https or socks5 proxy, with user:password@ for one
+	// that authenticates; empty connects directly
+	URL string `yaml:"url" redact:"true"`
+	// NoProxy lists hosts, domains (matching subdomains too), IP addresses
+	// and CIDR ranges reached directly, as the NO_PROXY variable does
+	NoProxy []string `yaml:"no_proxy"`
 }
 
 // LoggingConfig represents logging settings
@@ -83,150 +322,1464 @@ type LoggingConfig struct {
 	Format string `yaml:"format"`
 }
 
-// LoadConfig loads configuration from a YAML file
-func LoadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+// MetricsConfig represents Prometheus metrics settings
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+	// Port serves metrics on a separate listener; 0 uses the main router
+	Port int `yaml:"port"`
+	// TenantLabels adds a tenant_id label to per-tenant series. Off by
+	// default because it makes cardinality grow with the tenant count.
+	TenantLabels bool `yaml:"tenant_labels"`
+	// LatencySampleRate is the share of events, from 0 to 1, whose
+	// end-to-end latency is measured; 0 turns the measuring off
+	LatencySampleRate float64 `yaml:"latency_sample_rate"`
+}
+
+// TracingConfig represents OpenTelemetry tracing settings
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	Endpoint    string  `yaml:"endpoint"` // OTLP/HTTP collector host:port
+	Insecure    bool    `yaml:"insecure"`
+	SampleRate  float64 `yaml:"sample_rate"`
+	ServiceName string  `yaml:"service_name"`
+}
+
+// CompressionConfig represents HTTP response compression settings
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Level is a compress/flate level: 1 (fastest) to 9 (best); 0 or -1 uses the default
+	Level int `yaml:"level"`
+	// MinSize is the smallest body, in bytes, worth compressing
+	MinSize int `yaml:"min_size"`
+}
+
+// CorsConfig represents cross-origin resource sharing settings. When
+// AllowedOrigins is empty every origin is allowed, as before the section
+// existed.
+type CorsConfig struct {
+	// AllowedOrigins lists exact origins, "*" for any, or subdomain
+	// wildcards such as "https://*.example.com"
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	ExposedHeaders []string `yaml:"exposed_headers"`
+	// AllowCredentials needs AllowedOrigins to list the origins; Validate
+	// refuses it with any origin allowed
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+// FrontendConfig controls how the dashboard is served from the API server
+type FrontendConfig struct {
+	// Mode is "embedded" (assets compiled into the binary), "dir" (serve
+	// Dir from disk), "proxy" (forward to ProxyURL, e.g. the Vite dev
+	// server) or "disabled"
+	Mode     string `yaml:"mode"`
+	Dir      string `yaml:"dir"`
+	ProxyURL string `yaml:"proxy_url"`
+}
+
+// IngestConfig represents how events are written. Requests with ack=none
+// or ack=received are answered before the write and queued for the buffer
+// writer, which inserts them in batches.
+type IngestConfig struct {
+	// BufferSize bounds the queued events; ack=none requests are rejected
+	// when it is full, ack=received requests wait for room
+	BufferSize int `yaml:"buffer_size"`
+	// BatchSize is the most events written in one transaction
+	BatchSize int `yaml:"batch_size"`
+	// FlushInterval is how long a partial batch waits for more events
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	// SynchronousCommit makes ack=durable writes on PostgreSQL wait for
+	// synchronous_commit even when the server default relaxes it
+	SynchronousCommit bool `yaml:"synchronous_commit"`
+	// TransformBudget bounds the time a tenant's transformation rules may
+	// take on one event; rules left when it runs out fail
+	TransformBudget time.Duration `yaml:"transform_budget"`
+	// StreamAckEvery is how many accepted lines of POST
+	// /api/v1/events/stream are committed and acknowledged together
+	StreamAckEvery int `yaml:"stream_ack_every"`
+}
+
+// GeoIPConfig represents recording where events ingested over HTTP come
+// from. For privacy, nothing is recorded unless configured.
+type GeoIPConfig struct {
+	// RecordClientIP stores the client's IP address on each event
+	RecordClientIP bool `yaml:"record_client_ip"`
+	// Database is a MaxMind-format City or Country database; with one, the
+	// client's country and city are added to event metadata under _geo
+	Database string `yaml:"database"`
+	// ASNDatabase is a MaxMind-format ASN database adding the client's
+	// autonomous system
+	ASNDatabase string `yaml:"asn_database"`
+	// ReloadInterval is how often the databases are checked for a new file
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// SinksConfig represents the external systems accepted events are mirrored
+// to. Delivery is asynchronous and never fails the ingest request.
+type SinksConfig struct {
+	// BufferSize bounds the events waiting per sink; overflow is dropped
+	BufferSize int             `yaml:"buffer_size"`
+	Kafka      KafkaSinkConfig `yaml:"kafka"`
+}
+
+// DeadLettersConfig represents the store of events that could not be
+// persisted or delivered to a sink or webhook
+type DeadLettersConfig struct {
+	// Retention is how long dead letters are kept before they are purged
+	Retention time.Duration `yaml:"retention"`
+	// SpillFile receives dead letters as JSON lines while the database is
+	// unavailable; they are moved into the database once it recovers
+	SpillFile string `yaml:"spill_file"`
+}
+
+// LeaderConfig represents the election of the replica that runs the
+// background jobs meant to run once: the report scheduler and the dead
+// letter purge. Disabled, every replica runs them.
+type LeaderConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// LeaseTTL is how long a leader holds the lease without renewing it,
+	// and so how long jobs can go unrun after it dies
+	LeaseTTL time.Duration `yaml:"lease_ttl"`
+	// InstanceID names this replica in the lease; it must differ between
+	// replicas
+	InstanceID string `yaml:"instance_id"`
+}
+
+// ReportsConfig represents the scheduler of tenants' report digests
+type ReportsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// CheckInterval is how often due reports are looked for
+	CheckInterval time.Duration `yaml:"check_interval"`
+}
+
+// AlertsConfig represents the evaluator of tenants' alert rules
+type AlertsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// EvaluationInterval is how often every active rule is evaluated
+	EvaluationInterval time.Duration `yaml:"evaluation_interval"`
+}
+
+// AnomaliesConfig represents the detection of unusual per-tenant ingestion
+// rates against a learned baseline
+type AnomaliesConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Interval is the length of the buckets ingest counts are taken over
+	Interval time.Duration `yaml:"interval"`
+	// Factor is how far, up or down, a rate must be from the baseline to
+	// be flagged
+	Factor float64 `yaml:"factor"`
+	// MinRate is the baseline, in events per minute, below which a tenant
+	// is not judged
+	MinRate float64 `yaml:"min_rate"`
+	// Smoothing is the weight of the newest interval in the baseline
+	Smoothing float64 `yaml:"smoothing"`
+	// LearningWindow is how long a tenant is watched before it can be
+	// flagged
+	LearningWindow  time.Duration `yaml:"learning_window"`
+	PersistInterval time.Duration `yaml:"persist_interval"`
+	// WebhookURL, when set, receives a signed notification when a tenant
+	// is flagged or recovers
+	WebhookURL    string `yaml:"webhook_url"`
+	WebhookSecret string `yaml:"webhook_secret"`
+}
+
+// DebugConfig represents support aids that keep request data in memory
+type DebugConfig struct {
+	// CaptureFailedRequests keeps the latest 4xx and 5xx requests, with
+	// redacted headers and bodies, for GET /api/v1/admin/recent-errors
+	CaptureFailedRequests bool `yaml:"capture_failed_requests"`
+	// CaptureSize is how many failed requests are kept
+	CaptureSize int `yaml:"capture_size"`
+	// CaptureBodyBytes bounds the request and response body kept for each
+	CaptureBodyBytes int `yaml:"capture_body_bytes"`
+}
+
+// ArchiveConfig represents where generated files, such as tenant exports,
+// are stored and how they are handed out
+type ArchiveConfig struct {
+	// Backend is "local" or "s3"
+	Backend string `yaml:"backend"`
+	// Dir holds the files of the local backend; they are downloaded from
+	// this server through signed links
+	Dir string `yaml:"dir"`
+	// URLExpiry is how long a download link stays valid
+	URLExpiry time.Duration   `yaml:"url_expiry"`
+	S3        ArchiveS3Config `yaml:"s3"`
+}
+
+// ArchiveS3Config represents the S3 bucket of the s3 archive backend.
+// Downloads are presigned GET URLs.
+type ArchiveS3Config struct {
+	Bucket string `yaml:"bucket"`
+	Region string `yaml:"region"`
+	// Endpoint replaces https://s3.<region>.amazonaws.com for S3-compatible
+	// stores such as MinIO; objects are then addressed by path
+	Endpoint string `yaml:"endpoint"`
+	// Prefix is prepended to every object key
+	Prefix          string `yaml:"prefix"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" redact:"true"`
+}
+
+// ExportsConfig represents the background jobs that bundle a tenant's data
+// into the archive
+type ExportsConfig struct {
+	// PollInterval is how often queued jobs, and jobs abandoned by a
+	// stopped server, are looked for
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// BatchSize is the events read per query
+	BatchSize int `yaml:"batch_size"`
+	// QueryTimeout is how long each of those queries may run
+	QueryTimeout time.Duration `yaml:"query_timeout"`
+	// PartSize is about the most compressed bytes of an archive part; a
+	// larger export is split into several. Negative keeps every export in
+	// one part.
+	PartSize int64 `yaml:"part_size"`
+}
+
+// ImportsConfig represents the background jobs that load export archives
+// into tenants
+type ImportsConfig struct {
+	// PollInterval is how often queued jobs, and jobs abandoned by a
+	// stopped server, are looked for
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// BatchSize is the archive records committed per transaction
+	BatchSize int `yaml:"batch_size"`
+}
+
+// RedactionsConfig represents the background jobs that redact the metadata
+// of a tenant's events in bulk
+type RedactionsConfig struct {
+	// PollInterval is how often queued jobs, and jobs abandoned by a
+	// stopped server, are looked for
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// BatchSize is the events redacted per transaction
+	BatchSize int `yaml:"batch_size"`
+}
+
+// ReceiptsConfig represents the Ed25519 keys signing event receipts.
+// Receipts are off when no key is configured.
+type ReceiptsConfig struct {
+	// KeyID names the key new receipts are signed with
+	KeyID string `yaml:"key_id"`
+	// Keys maps key IDs to base64 32-byte Ed25519 seeds
+	Keys map[string]string `yaml:"keys" redact:"true"`
+	// PublicKeys maps the IDs of retired keys to their base64 public keys,
+	// so receipts they signed still verify once their seeds are discarded
+	PublicKeys map[string]string `yaml:"public_keys"`
+}
+
+// KafkaSinkConfig represents the Kafka sink. Messages are keyed by tenant ID
+// so each tenant's events stay in order on one partition.
+type KafkaSinkConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Brokers  []string `yaml:"brokers"`
+	Topic    string   `yaml:"topic"`
+	ClientID string   `yaml:"client_id"`
+	// RequiredAcks is "all", "one" or "none"
+	RequiredAcks string        `yaml:"required_acks"`
+	BatchTimeout time.Duration `yaml:"batch_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+
+	TLS  KafkaTLSConfig  `yaml:"tls"`
+	SASL KafkaSASLConfig `yaml:"sasl"`
+}
+
+// KafkaTLSConfig represents TLS settings for broker connections
+type KafkaTLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// KafkaSASLConfig represents SASL authentication; an empty Mechanism
+// disables it
+type KafkaSASLConfig struct {
+	// Mechanism is "plain", "scram-sha-256" or "scram-sha-512"
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password" redact:"true"`
+}
+
+// NatsConfig represents the NATS JetStream integration. It is disabled
+// while URL is empty; otherwise accepted events are published to
+// <subject_prefix>.<tenant_id>, and Consume optionally ingests messages.
+type NatsConfig struct {
+	// URL is one or more comma-separated server URLs
+	URL           string        `yaml:"url"`
+	Name          string        `yaml:"name"`
+	Token         string        `yaml:"token" redact:"true"`
+	Username      string        `yaml:"username"`
+	Password      string        `yaml:"password" redact:"true"`
+	CredsFile     string        `yaml:"creds_file"`
+	ReconnectWait time.Duration `yaml:"reconnect_wait"`
+	// SubjectPrefix is the subject accepted events are published under;
+	// a JetStream stream must capture <subject_prefix>.>
+	SubjectPrefix  string        `yaml:"subject_prefix"`
+	PublishTimeout time.Duration `yaml:"publish_timeout"`
+
+	Consume NatsConsumeConfig `yaml:"consume"`
+}
+
+// NatsConsumeConfig represents the JetStream consumer that ingests messages
+// as events. It is disabled while Subject is empty. The message body is an
+// event request; tenant_id and event_type missing from it are taken from
+// headers, then from subject tokens.
+type NatsConsumeConfig struct {
+	Subject string `yaml:"subject"`
+	// Durable names the pull consumer so progress survives restarts
+	Durable         string `yaml:"durable"`
+	TenantHeader    string `yaml:"tenant_header"`
+	EventTypeHeader string `yaml:"event_type_header"`
+	// TenantToken and EventTypeToken are 1-based subject token positions,
+	// e.g. 2 and 3 for "ingest.<tenant_id>.<event_type>"; 0 disables them
+	TenantToken    int           `yaml:"tenant_token"`
+	EventTypeToken int           `yaml:"event_type_token"`
+	BatchSize      int           `yaml:"batch_size"`
+	AckWait        time.Duration `yaml:"ack_wait"`
+	MaxDeliver     int           `yaml:"max_deliver"`
+}
+
+// MQTTConfig represents the MQTT bridge that ingests device messages. It is
+// disabled while Broker is empty. Each message on a topic matching Topic
+// becomes an event: the payload is the metadata JSON and the timestamp comes
+// from the TimestampProperty user property or the receive time.
+type MQTTConfig struct {
+	// Broker is an mqtt://, tcp://, tls://, ssl:// or mqtts:// URL; the TLS
+	// schemes use the TLS settings
+	Broker   string `yaml:"broker"`
+	ClientID string `yaml:"client_id"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" redact:"true"`
+	// Topic contains the {tenant_api_key} and {event_type} levels, e.g.
+	// "events/{tenant_api_key}/{event_type}"
+	Topic string `yaml:"topic"`
+	// SharedGroup subscribes through $share/<group>/ so replicas split the
+	// messages instead of each ingesting all of them
+	SharedGroup       string `yaml:"shared_group"`
+	QoS               int    `yaml:"qos"`
+	CleanSession      bool   `yaml:"clean_session"`
+	TimestampProperty string `yaml:"timestamp_property"`
+
+	SessionExpiry time.Duration `yaml:"session_expiry"`
+	KeepAlive     time.Duration `yaml:"keep_alive"`
+	ReconnectWait time.Duration `yaml:"reconnect_wait"`
+
+	TLS MQTTTLSConfig `yaml:"tls"`
+}
+
+// MQTTTLSConfig represents TLS settings for TLS broker URLs
+type MQTTTLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// LoadConfig loads configuration from a YAML file. A missing file is not an
+// error unless required is set: the configuration is then built from
+// defaults and environment variables alone.
+func LoadConfig(path string, required bool) (*Config, error) {
+	cfg, err := ReadConfig(path, required)
 	if err != nil {
 		return nil, err
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
 
+// ReadConfig is LoadConfig without validation, for callers that report
+// problems rather than stop at them
+func ReadConfig(path string, required bool) (*Config, error) {
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	case os.IsNotExist(err) && !required:
+	default:
 		return nil, err
 	}
 
 	// Override with environment variables if set
-	cfg.overrideFromEnv()
+	if err := cfg.overrideFromEnv(); err != nil {
+		return nil, err
+	}
 
+	cfg.Defaults()
 	return &cfg, nil
 }
 
 // overrideFromEnv overrides configuration with environment variables
-func (c *Config) overrideFromEnv() {
+func (c *Config) overrideFromEnv() error {
+	env := &envReader{}
+
 	// App Settings
-	if host := os.Getenv("APP_HOST"); host != "" {
+	if host := env.get("APP_HOST"); host != "" {
 		c.App.Host = host
 	}
-	if port := os.Getenv("APP_PORT"); port != "" {
+	if port := env.get("APP_PORT"); port != "" {
 		if p, err := strconv.Atoi(port); err == nil {
 			c.App.Port = p
 		}
 	}
-	if mode := os.Getenv("APP_MODE"); mode != "" {
+	// PORT is set by hosting platforms such as Render and takes precedence
+	if port := env.get("PORT"); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			c.App.Port = p
+		}
+	}
+	if mode := env.get("APP_MODE"); mode != "" {
 		c.App.Mode = mode
 	}
-	if env := os.Getenv("APP_ENV"); env != "" {
+	if env := env.get("APP_ENV"); env != "" {
 		c.App.Env = env
 	}
+	if timeout := env.get("APP_READ_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.App.ReadTimeout = d
+		}
+	}
+	if timeout := env.get("APP_READ_HEADER_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.App.ReadHeaderTimeout = d
+		}
+	}
+	if timeout := env.get("APP_WRITE_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.App.WriteTimeout = d
+		}
+	}
+	if timeout := env.get("APP_IDLE_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.App.IdleTimeout = d
+		}
+	}
+	if timeout := env.get("APP_REQUEST_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.App.RequestTimeout = d
+		}
+	}
+	if wait := env.get("APP_LONG_POLL_MAX_WAIT"); wait != "" {
+		if d, err := time.ParseDuration(wait); err == nil {
+			c.App.LongPollMaxWait = d
+		}
+	}
+	if delay := env.get("APP_SHUTDOWN_DELAY"); delay != "" {
+		if d, err := time.ParseDuration(delay); err == nil {
+			c.App.ShutdownDelay = d
+		}
+	}
+	if timeout := env.get("APP_SHUTDOWN_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.App.ShutdownTimeout = d
+		}
+	}
+	if missing := env.get("APP_MISSING_VERSION"); missing != "" {
+		c.App.MissingVersion = missing
+	}
+	if listen := env.get("APP_LISTEN"); listen != "" {
+		c.App.Listen = listen
+	}
+	if mode := env.get("APP_SOCKET_MODE"); mode != "" {
+		c.App.SocketMode = mode
+	}
+	if disable := env.get("APP_DISABLE_SERVER_HEADER"); disable != "" {
+		c.App.DisableServerHeader = disable == "true" || disable == "1"
+	}
+	if proxies := env.get("APP_TRUSTED_PROXIES"); proxies != "" {
+		c.App.TrustedProxies = splitList(proxies)
+	}
+	if host := env.get("APP_ADMIN_HOST"); host != "" {
+		c.App.AdminHost = host
+	}
+	if port := env.get("APP_ADMIN_PORT"); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			c.App.AdminPort = p
+		}
+	}
+	if host := env.get("APP_DEBUG_HOST"); host != "" {
+		c.App.DebugHost = host
+	}
+	if port := env.get("APP_DEBUG_PORT"); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			c.App.DebugPort = p
+		}
+	}
+	if certFile := env.get("APP_TLS_CERT_FILE"); certFile != "" {
+		c.App.TLS.CertFile = certFile
+	}
+	if keyFile := env.get("APP_TLS_KEY_FILE"); keyFile != "" {
+		c.App.TLS.KeyFile = keyFile
+	}
+	if version := env.get("APP_TLS_MIN_VERSION"); version != "" {
+		c.App.TLS.MinVersion = version
+	}
+	if hosts := env.get("APP_TLS_AUTOCERT_HOSTS"); hosts != "" {
+		c.App.TLS.AutocertHosts = splitList(hosts)
+	}
+	if dir := env.get("APP_TLS_AUTOCERT_CACHE_DIR"); dir != "" {
+		c.App.TLS.AutocertCacheDir = dir
+	}
+	if email := env.get("APP_TLS_AUTOCERT_EMAIL"); email != "" {
+		c.App.TLS.AutocertEmail = email
+	}
+	if port := env.get("APP_TLS_REDIRECT_PORT"); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			c.App.TLS.RedirectPort = p
+		}
+	}
 
 	// Database Settings
-	if driver := os.Getenv("DB_DRIVER"); driver != "" {
+	if driver := env.get("DB_DRIVER"); driver != "" {
+		if driver != c.Database.Driver {
+			// A host from the file belongs to the other driver
+			c.Database.Host = ""
+		}
 		c.Database.Driver = driver
 	}
-	if dbPath := os.Getenv("DATABASE_PATH"); dbPath != "" {
+	// DATABASE_PATH locates the SQLite file, DB_HOST the database server
+	if dbPath := env.get("DATABASE_PATH"); dbPath != "" && !c.Database.IsServer() {
 		c.Database.Host = dbPath
 	}
-	if maxOpen := os.Getenv("DATABASE_MAX_OPEN_CONNS"); maxOpen != "" {
+	if host := env.get("DB_HOST"); host != "" && c.Database.IsServer() {
+		c.Database.Host = host
+	}
+	if port := env.get("DB_PORT"); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			c.Database.Port = p
+		}
+	}
+	if user := env.get("DB_USER"); user != "" {
+		c.Database.User = user
+	}
+	if password := env.get("DB_PASSWORD"); password != "" {
+		c.Database.Password = password
+	}
+	if name := env.get("DB_NAME"); name != "" {
+		c.Database.Name = name
+	}
+	if sslMode := env.get("DB_SSLMODE"); sslMode != "" {
+		c.Database.SSLMode = sslMode
+	}
+	if maxOpen := env.get("DATABASE_MAX_OPEN_CONNS"); maxOpen != "" {
 		if n, err := strconv.Atoi(maxOpen); err == nil {
 			c.Database.MaxOpenConns = n
 		}
 	}
-	if maxIdle := os.Getenv("DATABASE_MAX_IDLE_CONNS"); maxIdle != "" {
+	if maxIdle := env.get("DATABASE_MAX_IDLE_CONNS"); maxIdle != "" {
 		if n, err := strconv.Atoi(maxIdle); err == nil {
 			c.Database.MaxIdleConns = n
 		}
 	}
-	if lifetime := os.Getenv("DATABASE_CONN_MAX_LIFETIME"); lifetime != "" {
+	if lifetime := env.get("DATABASE_CONN_MAX_LIFETIME"); lifetime != "" {
 		if d, err := time.ParseDuration(lifetime); err == nil {
 			c.Database.ConnMaxLifetime = d
 		}
 	}
+	if timeout := env.get("DATABASE_ACQUIRE_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.Database.AcquireTimeout = d
+		}
+	}
+	if interval := env.get("DATABASE_POOL_STATS_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.Database.PoolStatsInterval = d
+		}
+	}
+	if timeout := env.get("DATABASE_QUERY_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.Database.QueryTimeout = d
+		}
+	}
+	if above := env.get("DATABASE_COMPRESS_METADATA_ABOVE"); above != "" {
+		if n, err := strconv.Atoi(above); err == nil {
+			c.Database.CompressMetadataAbove = n
+		}
+	}
+	if retries := env.get("DATABASE_WRITE_CONFLICT_RETRIES"); retries != "" {
+		if n, err := strconv.Atoi(retries); err == nil {
+			c.Database.WriteConflictRetries = n
+		}
+	}
+	if migrate := env.get("DATABASE_MIGRATE_ON_START"); migrate != "" {
+		enabled := migrate == "true" || migrate == "1"
+		c.Database.MigrateOnStart = &enabled
+	}
+	if timeout := env.get("DATABASE_MIGRATE_LOCK_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.Database.MigrateLockTimeout = d
+		}
+	}
+	if store := env.get("DATABASE_EVENT_STORE"); store != "" {
+		c.Database.EventStore = store
+	}
 
 	// Redis Settings
-	if redisHost := os.Getenv("REDIS_HOST"); redisHost != "" {
+	if redisHost := env.get("REDIS_HOST"); redisHost != "" {
 		c.Redis.Host = redisHost
 	}
-	if redisPort := os.Getenv("REDIS_PORT"); redisPort != "" {
+	if redisPort := env.get("REDIS_PORT"); redisPort != "" {
 		if p, err := strconv.Atoi(redisPort); err == nil {
 			c.Redis.Port = p
 		}
 	}
-	if redisPassword := os.Getenv("REDIS_PASSWORD"); redisPassword != "" {
+	if redisPassword := env.get("REDIS_PASSWORD"); redisPassword != "" {
 		c.Redis.Password = redisPassword
 	}
-	if redisDB := os.Getenv("REDIS_DB"); redisDB != "" {
+	if redisDB := env.get("REDIS_DB"); redisDB != "" {
 		if n, err := strconv.Atoi(redisDB); err == nil {
 			c.Redis.DB = n
 		}
 	}
 
 	// Auth Settings
-	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+	if secret := env.get("JWT_SECRET"); secret != "" {
 		c.Auth.JWTSecret = secret
 	}
-	if expiry := os.Getenv("JWT_EXPIRY"); expiry != "" {
+	if expiry := env.get("JWT_EXPIRY"); expiry != "" {
 		if d, err := time.ParseDuration(expiry); err == nil {
 			c.Auth.JWTExpiry = d
 		}
 	}
-	if header := os.Getenv("API_KEY_HEADER"); header != "" {
+	if ttl := env.get("IMPERSONATION_TTL"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			c.Auth.ImpersonationTTL = d
+		}
+	}
+	if ttl := env.get("TENANT_CACHE_TTL"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			c.Auth.TenantCacheTTL = d
+		}
+	}
+	if header := env.get("API_KEY_HEADER"); header != "" {
 		c.Auth.APIKeyHeader = header
 	}
+	if token := env.get("ADMIN_TOKEN"); token != "" {
+		c.Auth.AdminToken = token
+	}
+	// Any OIDC variable enables the section
+	oidc := func() *OIDCConfig {
+		if c.Auth.OIDC == nil {
+			c.Auth.OIDC = &OIDCConfig{}
+		}
+		return c.Auth.OIDC
+	}
+	if issuer := env.get("OIDC_ISSUER"); issuer != "" {
+		oidc().Issuer = issuer
+	}
+	if id := env.get("OIDC_CLIENT_ID"); id != "" {
+		oidc().ClientID = id
+	}
+	if secret := env.get("OIDC_CLIENT_SECRET"); secret != "" {
+		oidc().ClientSecret = secret
+	}
+	if redirect := env.get("OIDC_REDIRECT_URL"); redirect != "" {
+		oidc().RedirectURL = redirect
+	}
+	if domains := env.get("OIDC_ALLOWED_DOMAINS"); domains != "" {
+		oidc().AllowedDomains = splitList(domains)
+	}
+	if mapping := env.get("OIDC_DOMAIN_TENANTS"); mapping != "" {
+		// domain=tenant_id pairs, comma-separated
+		oidc().DomainTenants = splitPairs(mapping)
+	}
+	if role := env.get("OIDC_DEFAULT_ROLE"); role != "" {
+		oidc().DefaultRole = role
+	}
+	if skew := env.get("OIDC_CLOCK_SKEW"); skew != "" {
+		if d, err := time.ParseDuration(skew); err == nil {
+			oidc().ClockSkew = d
+		}
+	}
+	if dashboard := env.get("OIDC_DASHBOARD_URL"); dashboard != "" {
+		oidc().DashboardURL = dashboard
+	}
 
 	// Rate Limit Settings
-	if enabled := os.Getenv("RATE_LIMIT_ENABLED"); enabled != "" {
+	if enabled := env.get("RATE_LIMIT_ENABLED"); enabled != "" {
 		c.RateLimit.Enabled = enabled == "true" || enabled == "1"
 	}
-	if rpm := os.Getenv("RATE_LIMIT_REQUESTS_PER_MINUTE"); rpm != "" {
+	if rpm := env.get("RATE_LIMIT_REQUESTS_PER_MINUTE"); rpm != "" {
 		if n, err := strconv.Atoi(rpm); err == nil {
 			c.RateLimit.RequestsPerMinute = n
 		}
 	}
-	if burst := os.Getenv("RATE_LIMIT_BURST"); burst != "" {
+	if burst := env.get("RATE_LIMIT_BURST"); burst != "" {
 		if n, err := strconv.Atoi(burst); err == nil {
 			c.RateLimit.Burst = n
 		}
 	}
 
+	// Concurrency limits
+	if n := env.get("CONCURRENCY_EXPORTS"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			c.Concurrency.Exports = v
+		}
+	}
+	if n := env.get("CONCURRENCY_SEARCHES"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			c.Concurrency.Searches = v
+		}
+	}
+	if n := env.get("CONCURRENCY_INGESTION"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			c.Concurrency.Ingestion = v
+		}
+	}
+	if n := env.get("CONCURRENCY_QUEUE_DEPTH"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			c.Concurrency.QueueDepth = v
+		}
+	}
+	if timeout := env.get("CONCURRENCY_QUEUE_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.Concurrency.QueueTimeout = d
+		}
+	}
+
+	// Health grading
+	if timeout := env.get("HEALTH_CHECK_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.Health.CheckTimeout = d
+		}
+	}
+	if latency := env.get("HEALTH_DATABASE_LATENCY_DEGRADED"); latency != "" {
+		if d, err := time.ParseDuration(latency); err == nil {
+			c.Health.DatabaseLatencyDegraded = d
+		}
+	}
+	if n := env.get("HEALTH_WEBHOOK_QUEUE_DEGRADED"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			c.Health.WebhookQueueDegraded = v
+		}
+	}
+	if n := env.get("HEALTH_WEBHOOK_QUEUE_UNHEALTHY"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			c.Health.WebhookQueueUnhealthy = v
+		}
+	}
+
 	// WebSocket Settings
-	if ping := os.Getenv("WS_PING_INTERVAL"); ping != "" {
+	if ping := env.get("WS_PING_INTERVAL"); ping != "" {
 		if d, err := time.ParseDuration(ping); err == nil {
 			c.WebSocket.PingInterval = d
 		}
 	}
-	if pong := os.Getenv("WS_PONG_TIMEOUT"); pong != "" {
+	if pong := env.get("WS_PONG_TIMEOUT"); pong != "" {
 		if d, err := time.ParseDuration(pong); err == nil {
 			c.WebSocket.PongTimeout = d
 		}
 	}
-	if writeTimeout := os.Getenv("WS_WRITE_TIMEOUT"); writeTimeout != "" {
+	if writeTimeout := env.get("WS_WRITE_TIMEOUT"); writeTimeout != "" {
 		if d, err := time.ParseDuration(writeTimeout); err == nil {
 			c.WebSocket.WriteTimeout = d
 		}
 	}
+	if size := env.get("WS_READ_BUFFER_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.WebSocket.ReadBufferSize = n
+		}
+	}
+	if size := env.get("WS_WRITE_BUFFER_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.WebSocket.WriteBufferSize = n
+		}
+	}
+	if size := env.get("WS_MAX_MESSAGE_SIZE"); size != "" {
+		if n, err := strconv.ParseInt(size, 10, 64); err == nil {
+			c.WebSocket.MaxMessageSize = n
+		}
+	}
+	if rate := env.get("WS_MESSAGE_RATE_LIMIT"); rate != "" {
+		if f, err := strconv.ParseFloat(rate, 64); err == nil {
+			c.WebSocket.MessageRateLimit = f
+		}
+	}
+	if burst := env.get("WS_MESSAGE_BURST"); burst != "" {
+		if n, err := strconv.Atoi(burst); err == nil {
+			c.WebSocket.MessageBurst = n
+		}
+	}
+	if violations := env.get("WS_MAX_RATE_VIOLATIONS"); violations != "" {
+		if n, err := strconv.Atoi(violations); err == nil {
+			c.WebSocket.MaxRateViolations = n
+		}
+	}
+	if interval := env.get("WS_THROUGHPUT_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.WebSocket.ThroughputInterval = d
+		}
+	}
 
 	// Webhook Settings
-	if enabled := os.Getenv("WEBHOOKS_ENABLED"); enabled != "" {
+	if enabled := env.get("WEBHOOKS_ENABLED"); enabled != "" {
 		c.Webhooks.Enabled = enabled == "true" || enabled == "1"
 	}
-	if retries := os.Getenv("WEBHOOKS_MAX_RETRIES"); retries != "" {
+	if retries := env.get("WEBHOOKS_MAX_RETRIES"); retries != "" {
 		if n, err := strconv.Atoi(retries); err == nil {
 			c.Webhooks.MaxRetries = n
 		}
 	}
-	if delay := os.Getenv("WEBHOOKS_RETRY_DELAY"); delay != "" {
+	if delay := env.get("WEBHOOKS_RETRY_DELAY"); delay != "" {
 		if d, err := time.ParseDuration(delay); err == nil {
 			c.Webhooks.RetryDelay = d
 		}
 	}
 
+	if timeout := env.get("WEBHOOKS_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.Webhooks.Timeout = d
+		}
+	}
+	if timeout := env.get("WEBHOOKS_CONNECT_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.Webhooks.ConnectTimeout = d
+		}
+	}
+	if proxy := env.get("WEBHOOKS_PROXY_URL"); proxy != "" {
+		c.Webhooks.Proxy.URL = proxy
+	}
+	if hosts := env.get("WEBHOOKS_NO_PROXY"); hosts != "" {
+		c.Webhooks.Proxy.NoProxy = splitList(hosts)
+	}
+	if networks := env.get("WEBHOOKS_ALLOWED_NETWORKS"); networks != "" {
+		c.Webhooks.AllowedNetworks = splitList(networks)
+	}
+	if size := env.get("WEBHOOKS_PAUSED_BUFFER_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.Webhooks.PausedBufferSize = n
+		}
+	}
+
+	// Metrics Settings
+	if enabled := env.get("METRICS_ENABLED"); enabled != "" {
+		c.Metrics.Enabled = enabled == "true" || enabled == "1"
+	}
+	if path := env.get("METRICS_PATH"); path != "" {
+		c.Metrics.Path = path
+	}
+	if port := env.get("METRICS_PORT"); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			c.Metrics.Port = p
+		}
+	}
+	if tenantLabels := env.get("METRICS_TENANT_LABELS"); tenantLabels != "" {
+		c.Metrics.TenantLabels = tenantLabels == "true" || tenantLabels == "1"
+	}
+	if rate := env.get("METRICS_LATENCY_SAMPLE_RATE"); rate != "" {
+		if f, err := strconv.ParseFloat(rate, 64); err == nil {
+			c.Metrics.LatencySampleRate = f
+		}
+	}
+
+	// Tracing Settings
+	if enabled := env.get("TRACING_ENABLED"); enabled != "" {
+		c.Tracing.Enabled = enabled == "true" || enabled == "1"
+	}
+	if endpoint := env.get("TRACING_ENDPOINT"); endpoint != "" {
+		c.Tracing.Endpoint = endpoint
+	}
+	if insecure := env.get("TRACING_INSECURE"); insecure != "" {
+		c.Tracing.Insecure = insecure == "true" || insecure == "1"
+	}
+	if rate := env.get("TRACING_SAMPLE_RATE"); rate != "" {
+		if f, err := strconv.ParseFloat(rate, 64); err == nil {
+			c.Tracing.SampleRate = f
+		}
+	}
+	if name := env.get("TRACING_SERVICE_NAME"); name != "" {
+		c.Tracing.ServiceName = name
+	}
+
+	// Compression Settings
+	if enabled := env.get("COMPRESSION_ENABLED"); enabled != "" {
+		c.Compression.Enabled = enabled == "true" || enabled == "1"
+	}
+	if level := env.get("COMPRESSION_LEVEL"); level != "" {
+		if n, err := strconv.Atoi(level); err == nil {
+			c.Compression.Level = n
+		}
+	}
+	if size := env.get("COMPRESSION_MIN_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.Compression.MinSize = n
+		}
+	}
+
+	// CORS Settings
+	if origins := env.get("CORS_ALLOWED_ORIGINS"); origins != "" {
+		c.Cors.AllowedOrigins = splitList(origins)
+	}
+	if methods := env.get("CORS_ALLOWED_METHODS"); methods != "" {
+		c.Cors.AllowedMethods = splitList(methods)
+	}
+	if headers := env.get("CORS_ALLOWED_HEADERS"); headers != "" {
+		c.Cors.AllowedHeaders = splitList(headers)
+	}
+	if headers := env.get("CORS_EXPOSED_HEADERS"); headers != "" {
+		c.Cors.ExposedHeaders = splitList(headers)
+	}
+	if credentials := env.get("CORS_ALLOW_CREDENTIALS"); credentials != "" {
+		c.Cors.AllowCredentials = credentials == "true" || credentials == "1"
+	}
+	if maxAge := env.get("CORS_MAX_AGE"); maxAge != "" {
+		if d, err := time.ParseDuration(maxAge); err == nil {
+			c.Cors.MaxAge = d
+		}
+	}
+
+	// Frontend Settings
+	if mode := env.get("FRONTEND_MODE"); mode != "" {
+		c.Frontend.Mode = mode
+	}
+	if dir := env.get("FRONTEND_DIR"); dir != "" {
+		c.Frontend.Dir = dir
+	}
+	if proxyURL := env.get("FRONTEND_PROXY_URL"); proxyURL != "" {
+		c.Frontend.ProxyURL = proxyURL
+	}
+
+	// Ingest Settings
+	if size := env.get("INGEST_BUFFER_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.Ingest.BufferSize = n
+		}
+	}
+	if size := env.get("INGEST_BATCH_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.Ingest.BatchSize = n
+		}
+	}
+	if interval := env.get("INGEST_FLUSH_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.Ingest.FlushInterval = d
+		}
+	}
+	if sync := env.get("INGEST_SYNCHRONOUS_COMMIT"); sync != "" {
+		c.Ingest.SynchronousCommit = sync == "true" || sync == "1"
+	}
+	if budget := env.get("INGEST_TRANSFORM_BUDGET"); budget != "" {
+		if d, err := time.ParseDuration(budget); err == nil {
+			c.Ingest.TransformBudget = d
+		}
+	}
+	if every := env.get("INGEST_STREAM_ACK_EVERY"); every != "" {
+		if n, err := strconv.Atoi(every); err == nil {
+			c.Ingest.StreamAckEvery = n
+		}
+	}
+
+	// GeoIP Settings
+	if record := env.get("GEOIP_RECORD_CLIENT_IP"); record != "" {
+		c.GeoIP.RecordClientIP = record == "true" || record == "1"
+	}
+	if path := env.get("GEOIP_DATABASE"); path != "" {
+		c.GeoIP.Database = path
+	}
+	if path := env.get("GEOIP_ASN_DATABASE"); path != "" {
+		c.GeoIP.ASNDatabase = path
+	}
+	if interval := env.get("GEOIP_RELOAD_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.GeoIP.ReloadInterval = d
+		}
+	}
+
+	// Sink Settings
+	if size := env.get("SINK_BUFFER_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.Sinks.BufferSize = n
+		}
+	}
+	if enabled := env.get("KAFKA_ENABLED"); enabled != "" {
+		c.Sinks.Kafka.Enabled = enabled == "true" || enabled == "1"
+	}
+	if brokers := env.get("KAFKA_BROKERS"); brokers != "" {
+		c.Sinks.Kafka.Brokers = splitList(brokers)
+	}
+	if topic := env.get("KAFKA_TOPIC"); topic != "" {
+		c.Sinks.Kafka.Topic = topic
+	}
+	if clientID := env.get("KAFKA_CLIENT_ID"); clientID != "" {
+		c.Sinks.Kafka.ClientID = clientID
+	}
+	if acks := env.get("KAFKA_REQUIRED_ACKS"); acks != "" {
+		c.Sinks.Kafka.RequiredAcks = acks
+	}
+	if timeout := env.get("KAFKA_BATCH_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.Sinks.Kafka.BatchTimeout = d
+		}
+	}
+	if timeout := env.get("KAFKA_WRITE_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.Sinks.Kafka.WriteTimeout = d
+		}
+	}
+	if enabled := env.get("KAFKA_TLS_ENABLED"); enabled != "" {
+		c.Sinks.Kafka.TLS.Enabled = enabled == "true" || enabled == "1"
+	}
+	if caFile := env.get("KAFKA_TLS_CA_FILE"); caFile != "" {
+		c.Sinks.Kafka.TLS.CAFile = caFile
+	}
+	if certFile := env.get("KAFKA_TLS_CERT_FILE"); certFile != "" {
+		c.Sinks.Kafka.TLS.CertFile = certFile
+	}
+	if keyFile := env.get("KAFKA_TLS_KEY_FILE"); keyFile != "" {
+		c.Sinks.Kafka.TLS.KeyFile = keyFile
+	}
+	if skip := env.get("KAFKA_TLS_INSECURE_SKIP_VERIFY"); skip != "" {
+		c.Sinks.Kafka.TLS.InsecureSkipVerify = skip == "true" || skip == "1"
+	}
+	if mechanism := env.get("KAFKA_SASL_MECHANISM"); mechanism != "" {
+		c.Sinks.Kafka.SASL.Mechanism = mechanism
+	}
+	if username := env.get("KAFKA_SASL_USERNAME"); username != "" {
+		c.Sinks.Kafka.SASL.Username = username
+	}
+	if password := env.get("KAFKA_SASL_PASSWORD"); password != "" {
+		c.Sinks.Kafka.SASL.Password = password
+	}
+
+	// Dead Letter Settings
+	if retention := env.get("DEAD_LETTERS_RETENTION"); retention != "" {
+		if d, err := time.ParseDuration(retention); err == nil {
+			c.DeadLetters.Retention = d
+		}
+	}
+	if spill := env.get("DEAD_LETTERS_SPILL_FILE"); spill != "" {
+		c.DeadLetters.SpillFile = spill
+	}
+
+	// Leader Election Settings
+	if enabled := env.get("LEADER_ENABLED"); enabled != "" {
+		c.Leader.Enabled = enabled == "true" || enabled == "1"
+	}
+	if ttl := env.get("LEADER_LEASE_TTL"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			c.Leader.LeaseTTL = d
+		}
+	}
+	if id := env.get("LEADER_INSTANCE_ID"); id != "" {
+		c.Leader.InstanceID = id
+	}
+
+	// Report Settings
+	if enabled := env.get("REPORTS_ENABLED"); enabled != "" {
+		c.Reports.Enabled = enabled == "true" || enabled == "1"
+	}
+	if interval := env.get("REPORTS_CHECK_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.Reports.CheckInterval = d
+		}
+	}
+
+	// Alert Settings
+	if enabled := env.get("ALERTS_ENABLED"); enabled != "" {
+		c.Alerts.Enabled = enabled == "true" || enabled == "1"
+	}
+	if interval := env.get("ALERTS_EVALUATION_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.Alerts.EvaluationInterval = d
+		}
+	}
+
+	// Anomaly Settings
+	if enabled := env.get("ANOMALIES_ENABLED"); enabled != "" {
+		c.Anomalies.Enabled = enabled == "true" || enabled == "1"
+	}
+	if interval := env.get("ANOMALIES_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.Anomalies.Interval = d
+		}
+	}
+	if factor := env.get("ANOMALIES_FACTOR"); factor != "" {
+		if f, err := strconv.ParseFloat(factor, 64); err == nil {
+			c.Anomalies.Factor = f
+		}
+	}
+	if rate := env.get("ANOMALIES_MIN_RATE"); rate != "" {
+		if f, err := strconv.ParseFloat(rate, 64); err == nil {
+			c.Anomalies.MinRate = f
+		}
+	}
+	if smoothing := env.get("ANOMALIES_SMOOTHING"); smoothing != "" {
+		if f, err := strconv.ParseFloat(smoothing, 64); err == nil {
+			c.Anomalies.Smoothing = f
+		}
+	}
+	if window := env.get("ANOMALIES_LEARNING_WINDOW"); window != "" {
+		if d, err := time.ParseDuration(window); err == nil {
+			c.Anomalies.LearningWindow = d
+		}
+	}
+	if interval := env.get("ANOMALIES_PERSIST_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.Anomalies.PersistInterval = d
+		}
+	}
+	if url := env.get("ANOMALIES_WEBHOOK_URL"); url != "" {
+		c.Anomalies.WebhookURL = url
+	}
+	if secret := env.get("ANOMALIES_WEBHOOK_SECRET"); secret != "" {
+		c.Anomalies.WebhookSecret = secret
+	}
+
+	// Debug Settings
+	if capture := env.get("DEBUG_CAPTURE_FAILED_REQUESTS"); capture != "" {
+		c.Debug.CaptureFailedRequests = capture == "true" || capture == "1"
+	}
+	if size := env.get("DEBUG_CAPTURE_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.Debug.CaptureSize = n
+		}
+	}
+	if limit := env.get("DEBUG_CAPTURE_BODY_BYTES"); limit != "" {
+		if n, err := strconv.Atoi(limit); err == nil {
+			c.Debug.CaptureBodyBytes = n
+		}
+	}
+
+	// Archive Settings
+	if backend := env.get("ARCHIVE_BACKEND"); backend != "" {
+		c.Archive.Backend = backend
+	}
+	if dir := env.get("ARCHIVE_DIR"); dir != "" {
+		c.Archive.Dir = dir
+	}
+	if expiry := env.get("ARCHIVE_URL_EXPIRY"); expiry != "" {
+		if d, err := time.ParseDuration(expiry); err == nil {
+			c.Archive.URLExpiry = d
+		}
+	}
+	if bucket := env.get("ARCHIVE_S3_BUCKET"); bucket != "" {
+		c.Archive.S3.Bucket = bucket
+	}
+	if region := env.get("ARCHIVE_S3_REGION"); region != "" {
+		c.Archive.S3.Region = region
+	}
+	if endpoint := env.get("ARCHIVE_S3_ENDPOINT"); endpoint != "" {
+		c.Archive.S3.Endpoint = endpoint
+	}
+	if prefix := env.get("ARCHIVE_S3_PREFIX"); prefix != "" {
+		c.Archive.S3.Prefix = prefix
+	}
+	if key := env.get("ARCHIVE_S3_ACCESS_KEY_ID"); key != "" {
+		c.Archive.S3.AccessKeyID = key
+	}
+	if secret := env.get("ARCHIVE_S3_SECRET_ACCESS_KEY"); secret != "" {
+		c.Archive.S3.SecretAccessKey = secret
+	}
+
+	// Export Settings
+	if interval := env.get("EXPORTS_POLL_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.Exports.PollInterval = d
+		}
+	}
+	if size := env.get("EXPORTS_BATCH_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.Exports.BatchSize = n
+		}
+	}
+	if timeout := env.get("EXPORTS_QUERY_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.Exports.QueryTimeout = d
+		}
+	}
+	if size := env.get("EXPORTS_PART_SIZE"); size != "" {
+		if n, err := strconv.ParseInt(size, 10, 64); err == nil {
+			c.Exports.PartSize = n
+		}
+	}
+
+	// Import Settings
+	if interval := env.get("IMPORTS_POLL_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.Imports.PollInterval = d
+		}
+	}
+	if size := env.get("IMPORTS_BATCH_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.Imports.BatchSize = n
+		}
+	}
+
+	// Redaction Settings
+	if interval := env.get("REDACTIONS_POLL_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			c.Redactions.PollInterval = d
+		}
+	}
+	if size := env.get("REDACTIONS_BATCH_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.Redactions.BatchSize = n
+		}
+	}
+
+	// Receipt Settings
+	if id := env.get("RECEIPTS_KEY_ID"); id != "" {
+		c.Receipts.KeyID = id
+	}
+	if keys := env.get("RECEIPTS_KEYS"); keys != "" {
+		// id=seed pairs, comma-separated
+		c.Receipts.Keys = splitPairs(keys)
+	}
+	if keys := env.get("RECEIPTS_PUBLIC_KEYS"); keys != "" {
+		c.Receipts.PublicKeys = splitPairs(keys)
+	}
+
+	// NATS Settings
+	if url := env.get("NATS_URL"); url != "" {
+		c.Nats.URL = url
+	}
+	if name := env.get("NATS_NAME"); name != "" {
+		c.Nats.Name = name
+	}
+	if token := env.get("NATS_TOKEN"); token != "" {
+		c.Nats.Token = token
+	}
+	if username := env.get("NATS_USERNAME"); username != "" {
+		c.Nats.Username = username
+	}
+	if password := env.get("NATS_PASSWORD"); password != "" {
+		c.Nats.Password = password
+	}
+	if credsFile := env.get("NATS_CREDS_FILE"); credsFile != "" {
+		c.Nats.CredsFile = credsFile
+	}
+	if wait := env.get("NATS_RECONNECT_WAIT"); wait != "" {
+		if d, err := time.ParseDuration(wait); err == nil {
+			c.Nats.ReconnectWait = d
+		}
+	}
+	if prefix := env.get("NATS_SUBJECT_PREFIX"); prefix != "" {
+		c.Nats.SubjectPrefix = prefix
+	}
+	if timeout := env.get("NATS_PUBLISH_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			c.Nats.PublishTimeout = d
+		}
+	}
+	if subject := env.get("NATS_CONSUME_SUBJECT"); subject != "" {
+		c.Nats.Consume.Subject = subject
+	}
+	if durable := env.get("NATS_CONSUME_DURABLE"); durable != "" {
+		c.Nats.Consume.Durable = durable
+	}
+	if header := env.get("NATS_CONSUME_TENANT_HEADER"); header != "" {
+		c.Nats.Consume.TenantHeader = header
+	}
+	if header := env.get("NATS_CONSUME_EVENT_TYPE_HEADER"); header != "" {
+		c.Nats.Consume.EventTypeHeader = header
+	}
+	if token := env.get("NATS_CONSUME_TENANT_TOKEN"); token != "" {
+		if n, err := strconv.Atoi(token); err == nil {
+			c.Nats.Consume.TenantToken = n
+		}
+	}
+	if token := env.get("NATS_CONSUME_EVENT_TYPE_TOKEN"); token != "" {
+		if n, err := strconv.Atoi(token); err == nil {
+			c.Nats.Consume.EventTypeToken = n
+		}
+	}
+	if size := env.get("NATS_CONSUME_BATCH_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			c.Nats.Consume.BatchSize = n
+		}
+	}
+	if wait := env.get("NATS_CONSUME_ACK_WAIT"); wait != "" {
+		if d, err := time.ParseDuration(wait); err == nil {
+			c.Nats.Consume.AckWait = d
+		}
+	}
+	if maxDeliver := env.get("NATS_CONSUME_MAX_DELIVER"); maxDeliver != "" {
+		if n, err := strconv.Atoi(maxDeliver); err == nil {
+			c.Nats.Consume.MaxDeliver = n
+		}
+	}
+
+	// MQTT Settings
+	if broker := env.get("MQTT_BROKER"); broker != "" {
+		c.MQTT.Broker = broker
+	}
+	if clientID := env.get("MQTT_CLIENT_ID"); clientID != "" {
+		c.MQTT.ClientID = clientID
+	}
+	if username := env.get("MQTT_USERNAME"); username != "" {
+		c.MQTT.Username = username
+	}
+	if password := env.get("MQTT_PASSWORD"); password != "" {
+		c.MQTT.Password = password
+	}
+	if topic := env.get("MQTT_TOPIC"); topic != "" {
+		c.MQTT.Topic = topic
+	}
+	if group := env.get("MQTT_SHARED_GROUP"); group != "" {
+		c.MQTT.SharedGroup = group
+	}
+	if qos := env.get("MQTT_QOS"); qos != "" {
+		if n, err := strconv.Atoi(qos); err == nil {
+			c.MQTT.QoS = n
+		}
+	}
+	if clean := env.get("MQTT_CLEAN_SESSION"); clean != "" {
+		c.MQTT.CleanSession = clean == "true" || clean == "1"
+	}
+	if property := env.get("MQTT_TIMESTAMP_PROPERTY"); property != "" {
+		c.MQTT.TimestampProperty = property
+	}
+	if expiry := env.get("MQTT_SESSION_EXPIRY"); expiry != "" {
+		if d, err := time.ParseDuration(expiry); err == nil {
+			c.MQTT.SessionExpiry = d
+		}
+	}
+	if keepAlive := env.get("MQTT_KEEP_ALIVE"); keepAlive != "" {
+		if d, err := time.ParseDuration(keepAlive); err == nil {
+			c.MQTT.KeepAlive = d
+		}
+	}
+	if wait := env.get("MQTT_RECONNECT_WAIT"); wait != "" {
+		if d, err := time.ParseDuration(wait); err == nil {
+			c.MQTT.ReconnectWait = d
+		}
+	}
+	if caFile := env.get("MQTT_TLS_CA_FILE"); caFile != "" {
+		c.MQTT.TLS.CAFile = caFile
+	}
+	if certFile := env.get("MQTT_TLS_CERT_FILE"); certFile != "" {
+		c.MQTT.TLS.CertFile = certFile
+	}
+	if keyFile := env.get("MQTT_TLS_KEY_FILE"); keyFile != "" {
+		c.MQTT.TLS.KeyFile = keyFile
+	}
+	if skip := env.get("MQTT_TLS_INSECURE_SKIP_VERIFY"); skip != "" {
+		c.MQTT.TLS.InsecureSkipVerify = skip == "true" || skip == "1"
+	}
+
+	// Feature Flags
+	if flags := env.get("FEATURE_FLAGS"); flags != "" {
+		// name=true|false pairs, comma-separated
+		c.Flags = make(map[string]bool)
+		for name, value := range splitPairs(flags) {
+			c.Flags[name] = value == "true" || value == "1"
+		}
+	}
+
 	// Logging Settings
-	if level := os.Getenv("LOG_LEVEL"); level != "" {
+	if level := env.get("LOG_LEVEL"); level != "" {
 		c.Logging.Level = level
 	}
-	if format := os.Getenv("LOG_FORMAT"); format != "" {
+	if format := env.get("LOG_FORMAT"); format != "" {
 		c.Logging.Format = format
 	}
+
+	return env.err()
+}
+
+// envReader looks up environment variables, honouring the NAME_FILE
+// convention used for Docker and Kubernetes secrets
+type envReader struct {
+	errs []string
+}
+
+// get returns the value of an environment variable. When NAME_FILE is set,
+// the contents of that file (without the trailing newline) take precedence.
+func (e *envReader) get(name string) string {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			e.errs = append(e.errs, name+"_FILE: "+err.Error())
+			return ""
+		}
+		return strings.TrimRight(string(data), "\r\n")
+	}
+	return os.Getenv(name)
+}
+
+// err reports every secret file that could not be read
+func (e *envReader) err() error {
+	if len(e.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("read environment: %s", strings.Join(e.errs, "; "))
+}
+
+// splitList parses a comma-separated environment value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// splitPairs parses comma-separated key=value pairs; items without "=" are
+// skipped
+func splitPairs(value string) map[string]string {
+	pairs := make(map[string]string)
+	for _, item := range splitList(value) {
+		if key, val, ok := strings.Cut(item, "="); ok {
+			pairs[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+	}
+	return pairs
+}
+
+// IsServer reports whether the driver connects to a database server rather
+// than opening a SQLite file
+func (c *DatabaseConfig) IsServer() bool {
+	return c.Driver == "postgres" || c.Driver == "mysql"
+}
+
+// mysqlTLS maps sslmode to the MySQL driver's tls parameter
+var mysqlTLS = map[string]string{
+	"disable":     "false",
+	"preferred":   "preferred",
+	"require":     "skip-verify",
+	"verify-full": "true",
+}
+
+// DSN returns the connection string for the configured driver: the file
+// path for SQLite, a key/value DSN for PostgreSQL and a URL-like DSN for
+// MySQL, which reads times as UTC time.Time values
+func (c *DatabaseConfig) DSN() string {
+	switch c.Driver {
+	case "postgres":
+		return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+			dsnValue(c.Host), c.Port, dsnValue(c.User), dsnValue(c.Password), dsnValue(c.Name), dsnValue(c.SSLMode))
+	case "mysql":
+		cfg := mysql.NewConfig()
+		cfg.User, cfg.Passwd, cfg.DBName = c.User, c.Password, c.Name
+		cfg.Net, cfg.Addr = "tcp", net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+		cfg.TLSConfig = mysqlTLS[c.SSLMode]
+		cfg.ParseTime, cfg.Loc = true, time.UTC
+		cfg.Params = map[string]string{"charset": "utf8mb4"}
+		return cfg.FormatDSN()
+	}
+	return c.Host
+}
+
+// dsnValue quotes a PostgreSQL key/value DSN value when it contains spaces,
+// quotes or backslashes
+func dsnValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
 }
 
 // GetRedisAddr returns the Redis address in host:port format
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// RedactedValue replaces the value of a secret field in Redacted output
+const RedactedValue = "[REDACTED]"
+
+// secretNameHints mark fields as secret by name, so a newly added credential
+// is redacted even if nobody remembered to tag it
+var secretNameHints = []string{"secret", "password", "passwd", "token", "credential", "privatekey", "apikey"}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Redacted returns the configuration as a map keyed by YAML names with every
+// secret field replaced by "[REDACTED]". A field is secret when tagged
+// `redact:"true"` or when its name looks like a credential; `redact:"false"`
+// opts a field out of the name check. Empty secrets stay empty so operators
+// can see that they are unset.
+func (c *Config) Redacted() map[string]interface{} {
+	return redactStruct(reflect.ValueOf(*c))
+}
+
+func redactStruct(v reflect.Value) map[string]interface{} {
+	out := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		value := v.Field(i)
+		switch {
+		case isSecretField(field):
+			if value.IsZero() {
+				out[name] = ""
+			} else {
+				out[name] = RedactedValue
+			}
+		case field.Type == durationType:
+			out[name] = value.Interface().(time.Duration).String()
+		case value.Kind() == reflect.Struct:
+			out[name] = redactStruct(value)
+		case value.Kind() == reflect.Pointer && value.Type().Elem().Kind() == reflect.Struct:
+			// Optional sections are nil when absent
+			if value.IsNil() {
+				out[name] = nil
+			} else {
+				out[name] = redactStruct(value.Elem())
+			}
+		default:
+			out[name] = value.Interface()
+		}
+	}
+	return out
+}
+
+// isSecretField reports whether a field must be redacted
+func isSecretField(field reflect.StructField) bool {
+	switch field.Tag.Get("redact") {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	name := strings.ToLower(field.Name)
+	if strings.HasSuffix(name, "header") {
+		return false
+	}
+	for _, hint := range secretNameHints {
+		if strings.Contains(name, hint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,650 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// InsecureJWTSecret is the example secret shipped in config.yaml. It is
+// rejected in release mode.
+const InsecureJWTSecret = "your-super-secret-jwt-key-change-in-production"
+
+// receiptKeyID matches the IDs receipts name their signing key by
+var receiptKeyID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// flagName matches feature flag names
+var flagName = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Defaults fills optional fields that were left empty
+func (c *Config) Defaults() {
+	setDefault(&c.App.Host, "0.0.0.0")
+	setDefault(&c.App.Port, 8080)
+	setDefault(&c.App.Mode, "release")
+	setDefault(&c.App.Env, "development")
+	setDefault(&c.App.SocketMode, "0660")
+	setDefault(&c.App.ReadHeaderTimeout, 10*time.Second)
+	setDefault(&c.App.ShutdownTimeout, 10*time.Second)
+	setDefault(&c.App.MissingVersion, "last_write_wins")
+	setDefault(&c.App.LongPollMaxWait, 25*time.Second)
+	setDefault(&c.App.AdminHost, c.App.Host)
+	setDefault(&c.App.DebugHost, "127.0.0.1")
+	if c.App.TLS.Enabled() {
+		setDefault(&c.App.TLS.MinVersion, "1.2")
+	}
+	if len(c.App.TLS.AutocertHosts) > 0 {
+		setDefault(&c.App.TLS.AutocertCacheDir, "./data/autocert")
+	}
+
+	setDefault(&c.Database.Driver, "sqlite")
+	if c.Database.Driver == "sqlite" {
+		setDefault(&c.Database.Host, "./data/events.db")
+	}
+	if c.Database.Driver == "postgres" {
+		setDefault(&c.Database.Port, 5432)
+		setDefault(&c.Database.Name, "render")
+		setDefault(&c.Database.SSLMode, "require")
+	}
+	if c.Database.Driver == "mysql" {
+		setDefault(&c.Database.Port, 3306)
+		setDefault(&c.Database.Name, "events")
+		setDefault(&c.Database.SSLMode, "preferred")
+	}
+	setDefault(&c.Database.MaxOpenConns, 25)
+	setDefault(&c.Database.ConnMaxLifetime, 5*time.Minute)
+	setDefault(&c.Database.PoolStatsInterval, 5*time.Second)
+	setDefault(&c.Database.QueryTimeout, 10*time.Second)
+	setDefault(&c.Database.WriteConflictRetries, 3)
+	if c.Database.MigrateOnStart == nil {
+		migrate := true
+		c.Database.MigrateOnStart = &migrate
+	}
+	setDefault(&c.Database.MigrateLockTimeout, 5*time.Minute)
+	setDefault(&c.Database.EventStore, "sql")
+
+	setDefault(&c.Auth.JWTExpiry, 24*time.Hour)
+	setDefault(&c.Auth.ImpersonationTTL, 15*time.Minute)
+	setDefault(&c.Auth.TenantCacheTTL, 5*time.Second)
+	setDefault(&c.Auth.APIKeyHeader, "X-API-Key")
+	if oidc := c.Auth.OIDC; oidc != nil {
+		setDefault(&oidc.DefaultRole, "viewer")
+		setDefault(&oidc.ClockSkew, time.Minute)
+	}
+
+	setDefault(&c.Concurrency.Exports, 4)
+	setDefault(&c.Concurrency.Searches, 16)
+	setDefault(&c.Concurrency.QueueDepth, 8)
+	setDefault(&c.Concurrency.QueueTimeout, 5*time.Second)
+
+	setDefault(&c.Health.CheckTimeout, 2*time.Second)
+	setDefault(&c.Health.DatabaseLatencyDegraded, 500*time.Millisecond)
+	setDefault(&c.Health.WebhookQueueDegraded, 1000)
+	setDefault(&c.Health.WebhookQueueUnhealthy, -1)
+
+	setDefault(&c.WebSocket.PingInterval, 30*time.Second)
+	setDefault(&c.WebSocket.PongTimeout, 60*time.Second)
+	setDefault(&c.WebSocket.WriteTimeout, 10*time.Second)
+	setDefault(&c.WebSocket.ReadBufferSize, 1024)
+	setDefault(&c.WebSocket.WriteBufferSize, 1024)
+	setDefault(&c.WebSocket.MaxMessageSize, int64(64<<10))
+	setDefault(&c.WebSocket.ThroughputInterval, 2*time.Second)
+
+	setDefault(&c.Webhooks.Timeout, 10*time.Second)
+	setDefault(&c.Webhooks.ConnectTimeout, 5*time.Second)
+	setDefault(&c.Webhooks.PausedBufferSize, 1000)
+
+	setDefault(&c.Logging.Level, "info")
+	setDefault(&c.Logging.Format, "json")
+
+	setDefault(&c.Metrics.Path, "/metrics")
+
+	setDefault(&c.Tracing.ServiceName, "event-ingestion-system")
+
+	setDefault(&c.Compression.Level, -1)
+
+	setDefault(&c.Frontend.Mode, "embedded")
+
+	setDefault(&c.Ingest.BufferSize, 10000)
+	setDefault(&c.Ingest.BatchSize, 500)
+	setDefault(&c.Ingest.FlushInterval, 50*time.Millisecond)
+	setDefault(&c.Ingest.TransformBudget, 5*time.Millisecond)
+	setDefault(&c.Ingest.StreamAckEvery, 1000)
+	setDefault(&c.GeoIP.ReloadInterval, time.Minute)
+	setDefault(&c.Sinks.BufferSize, 10000)
+	setDefault(&c.Sinks.Kafka.ClientID, "event-ingestion-system")
+	setDefault(&c.Sinks.Kafka.RequiredAcks, "all")
+	setDefault(&c.Sinks.Kafka.BatchTimeout, 10*time.Millisecond)
+	setDefault(&c.Sinks.Kafka.WriteTimeout, 10*time.Second)
+
+	setDefault(&c.DeadLetters.Retention, 7*24*time.Hour)
+	setDefault(&c.DeadLetters.SpillFile, "./data/dead-letters.jsonl")
+
+	setDefault(&c.Leader.LeaseTTL, 15*time.Second)
+	setDefault(&c.Reports.CheckInterval, 30*time.Second)
+	setDefault(&c.Alerts.EvaluationInterval, 30*time.Second)
+	setDefault(&c.Anomalies.Interval, time.Minute)
+	setDefault(&c.Anomalies.Factor, 10.0)
+	setDefault(&c.Anomalies.MinRate, 10.0)
+	setDefault(&c.Anomalies.Smoothing, 0.1)
+	setDefault(&c.Anomalies.LearningWindow, time.Hour)
+	setDefault(&c.Anomalies.PersistInterval, 5*time.Minute)
+
+	setDefault(&c.Debug.CaptureSize, 200)
+	setDefault(&c.Debug.CaptureBodyBytes, 4096)
+
+	setDefault(&c.Archive.Backend, "local")
+	setDefault(&c.Archive.Dir, "./data/archive")
+	setDefault(&c.Archive.URLExpiry, time.Hour)
+	setDefault(&c.Exports.PollInterval, 5*time.Second)
+	setDefault(&c.Exports.BatchSize, 1000)
+	setDefault(&c.Exports.QueryTimeout, 5*time.Minute)
+	setDefault(&c.Exports.PartSize, int64(1<<30))
+	setDefault(&c.Imports.PollInterval, 5*time.Second)
+	setDefault(&c.Imports.BatchSize, 1000)
+	setDefault(&c.Redactions.PollInterval, 5*time.Second)
+	setDefault(&c.Redactions.BatchSize, 1000)
+
+	setDefault(&c.Nats.Name, "event-ingestion-system")
+	setDefault(&c.Nats.ReconnectWait, 2*time.Second)
+	setDefault(&c.Nats.SubjectPrefix, "events")
+	setDefault(&c.Nats.PublishTimeout, 5*time.Second)
+	setDefault(&c.Nats.Consume.Durable, "event-ingestion-system")
+	setDefault(&c.Nats.Consume.TenantHeader, "Tenant-Id")
+	setDefault(&c.Nats.Consume.EventTypeHeader, "Event-Type")
+	setDefault(&c.Nats.Consume.BatchSize, 50)
+	setDefault(&c.Nats.Consume.AckWait, 30*time.Second)
+	setDefault(&c.Nats.Consume.MaxDeliver, 5)
+
+	// Replicas must not share a client ID or they disconnect each other,
+	// nor an instance ID or they all lead
+	hostname, _ := os.Hostname()
+	setDefault(&c.MQTT.ClientID, strings.TrimSuffix("event-ingestion-system-"+hostname, "-"))
+	setDefault(&c.Leader.InstanceID, strings.TrimPrefix(fmt.Sprintf("%s-%d", hostname, os.Getpid()), "-"))
+	setDefault(&c.MQTT.Topic, "events/{tenant_api_key}/{event_type}")
+	setDefault(&c.MQTT.TimestampProperty, "timestamp")
+	setDefault(&c.MQTT.SessionExpiry, time.Hour)
+	setDefault(&c.MQTT.KeepAlive, 30*time.Second)
+	setDefault(&c.MQTT.ReconnectWait, 5*time.Second)
+}
+
+// Validate checks required fields and ranges and reports every problem at once
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, field, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, field+": "+fmt.Sprintf(format, args...))
+		}
+	}
+
+	// App
+	check(validPort(c.App.Port), "app.port", "must be between 1 and 65535, got %d", c.App.Port)
+	if c.App.Listen != "" && !strings.HasPrefix(c.App.Listen, "unix:") {
+		_, _, err := net.SplitHostPort(strings.TrimPrefix(c.App.Listen, "tcp:"))
+		check(err == nil, "app.listen", "must be host:port or unix:/path, got %q", c.App.Listen)
+	}
+	check(c.App.Listen != "unix:", "app.listen", "socket path is empty")
+	_, err := c.App.FileMode()
+	check(err == nil, "app.socket_mode", "must be an octal file mode such as 0660, got %q", c.App.SocketMode)
+	check(oneOf(c.App.Mode, "debug", "release", "test"), "app.mode", "must be debug, release or test, got %q", c.App.Mode)
+	check(c.App.ReadTimeout >= 0, "app.read_timeout", "must not be negative")
+	check(c.App.ReadHeaderTimeout > 0, "app.read_header_timeout", "must be positive")
+	check(c.App.WriteTimeout >= 0, "app.write_timeout", "must not be negative")
+	check(c.App.IdleTimeout >= 0, "app.idle_timeout", "must not be negative")
+	check(c.App.RequestTimeout >= 0, "app.request_timeout", "must not be negative")
+	check(c.App.ShutdownDelay >= 0, "app.shutdown_delay", "must not be negative")
+	check(c.App.LongPollMaxWait > 0, "app.long_poll_max_wait", "must be positive")
+	check(c.App.ShutdownTimeout > 0, "app.shutdown_timeout", "must be positive")
+	check(oneOf(c.App.MissingVersion, "last_write_wins", "reject"), "app.missing_version", "must be last_write_wins or reject, got %q", c.App.MissingVersion)
+	for _, proxy := range c.App.TrustedProxies {
+		check(validProxy(proxy), "app.trusted_proxies", "must be CIDR ranges or IP addresses without a zone, got %q", proxy)
+	}
+	if c.App.AdminPort != 0 {
+		check(validPort(c.App.AdminPort), "app.admin_port", "must be between 1 and 65535, got %d", c.App.AdminPort)
+		check(c.App.AdminPort != c.App.Port, "app.admin_port", "must differ from app.port")
+		check(c.App.AdminPort != c.App.DebugPort, "app.admin_port", "must differ from app.debug_port")
+		check(c.App.AdminPort != c.Metrics.Port, "app.admin_port", "must differ from metrics.port")
+	}
+	if c.App.DebugPort != 0 {
+		check(validPort(c.App.DebugPort), "app.debug_port", "must be between 1 and 65535, got %d", c.App.DebugPort)
+		check(c.App.DebugPort != c.App.Port, "app.debug_port", "must differ from app.port")
+	}
+
+	if tls := c.App.TLS; tls.Enabled() {
+		usesFiles := tls.CertFile != "" || tls.KeyFile != ""
+		if usesFiles {
+			check(tls.CertFile != "" && tls.KeyFile != "", "app.tls", "cert_file and key_file must be set together")
+			check(len(tls.AutocertHosts) == 0, "app.tls", "use either cert_file/key_file or autocert_hosts, not both")
+			check(tls.CertFile == "" || fileExists(tls.CertFile), "app.tls.cert_file", "cannot read %q", tls.CertFile)
+			check(tls.KeyFile == "" || fileExists(tls.KeyFile), "app.tls.key_file", "cannot read %q", tls.KeyFile)
+		}
+		check(oneOf(tls.MinVersion, "1.2", "1.3"), "app.tls.min_version", "must be 1.2 or 1.3, got %q", tls.MinVersion)
+		if tls.RedirectPort != 0 {
+			check(validPort(tls.RedirectPort), "app.tls.redirect_port", "must be between 1 and 65535, got %d", tls.RedirectPort)
+			check(tls.RedirectPort != c.App.Port, "app.tls.redirect_port", "must differ from app.port")
+		}
+	}
+
+	// Database
+	check(oneOf(c.Database.Driver, "sqlite", "postgres", "mysql"), "database.driver", "must be sqlite, postgres or mysql, got %q", c.Database.Driver)
+	check(oneOf(c.Database.EventStore, "sql", "memory"), "database.event_store", "must be sql or memory, got %q", c.Database.EventStore)
+	if c.Database.Driver == "sqlite" {
+		check(c.Database.Host != "", "database.host", "is required for sqlite (database file path)")
+	}
+	if c.Database.Driver == "postgres" {
+		check(c.Database.Host != "", "database.host", "is required for postgres (set DB_HOST)")
+		check(c.Database.User != "", "database.user", "is required for postgres (set DB_USER)")
+		check(c.Database.Password != "", "database.password", "is required for postgres (set DB_PASSWORD)")
+		check(validPort(c.Database.Port), "database.port", "must be between 1 and 65535, got %d", c.Database.Port)
+		check(oneOf(c.Database.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full"), "database.sslmode", "unknown mode %q", c.Database.SSLMode)
+	}
+	if c.Database.Driver == "mysql" {
+		check(c.Database.Host != "", "database.host", "is required for mysql (set DB_HOST)")
+		check(c.Database.User != "", "database.user", "is required for mysql (set DB_USER)")
+		check(c.Database.Name != "", "database.name", "is required for mysql (set DB_NAME)")
+		check(validPort(c.Database.Port), "database.port", "must be between 1 and 65535, got %d", c.Database.Port)
+		check(mysqlTLS[c.Database.SSLMode] != "", "database.sslmode", "must be disable, preferred, require or verify-full for mysql, got %q", c.Database.SSLMode)
+	}
+	check(c.Database.MaxOpenConns > 0, "database.max_open_conns", "must be positive")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns", "must not be negative")
+	check(c.Database.MaxIdleConns <= c.Database.MaxOpenConns, "database.max_idle_conns", "must not exceed max_open_conns")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime", "must not be negative")
+	check(c.Database.AcquireTimeout >= 0, "database.acquire_timeout", "must not be negative")
+	check(c.Database.PoolStatsInterval > 0, "database.pool_stats_interval", "must be positive")
+	check(c.Database.QueryTimeout > 0, "database.query_timeout", "must be positive")
+	check(c.Database.CompressMetadataAbove >= 0, "database.compress_metadata_above", "must not be negative")
+	check(c.Database.MigrateLockTimeout > 0, "database.migrate_lock_timeout", "must be positive")
+
+	// Auth
+	check(c.Auth.JWTSecret != "", "auth.jwt_secret", "is required (set JWT_SECRET)")
+	if c.App.Mode == "release" {
+		check(c.Auth.JWTSecret != InsecureJWTSecret, "auth.jwt_secret", "the example secret is not allowed in release mode (set JWT_SECRET)")
+	}
+	check(c.Auth.JWTExpiry > 0, "auth.jwt_expiry", "must be positive")
+	check(c.Auth.ImpersonationTTL > 0, "auth.impersonation_ttl", "must be positive")
+	check(c.Auth.TenantCacheTTL <= 5*time.Minute, "auth.tenant_cache_ttl", "must be at most 5m")
+	check(c.Auth.APIKeyHeader != "", "auth.api_key_header", "is required")
+	if oidc := c.Auth.OIDC; oidc != nil {
+		check(validURL(oidc.Issuer), "auth.oidc.issuer", "must be an http(s) URL, got %q", oidc.Issuer)
+		check(oidc.ClientID != "", "auth.oidc.client_id", "is required")
+		check(validURL(oidc.RedirectURL), "auth.oidc.redirect_url", "must be an http(s) URL, got %q", oidc.RedirectURL)
+		check(oidc.DashboardURL == "" || validURL(oidc.DashboardURL), "auth.oidc.dashboard_url", "must be an http(s) URL, got %q", oidc.DashboardURL)
+		check(len(oidc.AllowedDomains) > 0, "auth.oidc.allowed_domains", "is required")
+		allowed := make(map[string]bool, len(oidc.AllowedDomains))
+		for _, domain := range oidc.AllowedDomains {
+			allowed[strings.ToLower(domain)] = true
+		}
+		for domain := range oidc.DomainTenants {
+			check(allowed[strings.ToLower(domain)], "auth.oidc.domain_tenants", "domain %q is not in allowed_domains", domain)
+		}
+		check(oneOf(oidc.DefaultRole, "admin", "developer", "viewer"), "auth.oidc.default_role", "must be admin, developer or viewer, got %q", oidc.DefaultRole)
+		check(oidc.ClockSkew >= 0, "auth.oidc.clock_skew", "must not be negative")
+	}
+
+	// Rate limiting
+	if c.RateLimit.Enabled {
+		check(c.RateLimit.RequestsPerMinute > 0, "rate_limit.requests_per_minute", "must be positive when rate limiting is enabled")
+	}
+	check(c.RateLimit.Burst >= 0, "rate_limit.burst", "must not be negative")
+
+	// Concurrency limits
+	check(c.Concurrency.QueueTimeout > 0, "concurrency.queue_timeout", "must be positive")
+
+	// Health grading
+	check(c.Health.CheckTimeout > 0, "health.check_timeout", "must be positive")
+	if c.Health.WebhookQueueDegraded > 0 && c.Health.WebhookQueueUnhealthy > 0 {
+		check(c.Health.WebhookQueueUnhealthy > c.Health.WebhookQueueDegraded, "health.webhook_queue_unhealthy", "must be greater than webhook_queue_degraded")
+	}
+
+	// WebSocket
+	check(c.WebSocket.PingInterval > 0, "websocket.ping_interval", "must be positive")
+	check(c.WebSocket.PongTimeout > c.WebSocket.PingInterval, "websocket.pong_timeout", "must be greater than ping_interval")
+	check(c.WebSocket.WriteTimeout > 0, "websocket.write_timeout", "must be positive")
+	check(c.WebSocket.ReadBufferSize > 0, "websocket.read_buffer_size", "must be positive")
+	check(c.WebSocket.WriteBufferSize > 0, "websocket.write_buffer_size", "must be positive")
+	check(c.WebSocket.MaxMessageSize > 0, "websocket.max_message_size", "must be positive")
+	check(c.WebSocket.MessageRateLimit >= 0, "websocket.message_rate_limit", "must not be negative")
+	check(c.WebSocket.MessageBurst >= 0, "websocket.message_burst", "must not be negative")
+	check(c.WebSocket.MaxRateViolations >= 0, "websocket.max_rate_violations", "must not be negative")
+	check(c.WebSocket.ThroughputInterval >= time.Second, "websocket.throughput_interval", "must be at least 1s, got %s", c.WebSocket.ThroughputInterval)
+
+	// Webhooks
+	if c.Webhooks.Enabled {
+		check(c.Webhooks.MaxRetries >= 0, "webhooks.max_retries", "must not be negative")
+		check(c.Webhooks.RetryDelay >= 0, "webhooks.retry_delay", "must not be negative")
+		check(c.Webhooks.Timeout > 0, "webhooks.timeout", "must be positive")
+		check(c.Webhooks.ConnectTimeout > 0 && c.Webhooks.ConnectTimeout <= c.Webhooks.Timeout, "webhooks.connect_timeout", "must be positive and at most webhooks.timeout")
+		check(c.Webhooks.PausedBufferSize > 0, "webhooks.paused_buffer_size", "must be positive")
+		if proxy := c.Webhooks.Proxy.URL; proxy != "" {
+			// The URL may hold credentials, so it is not repeated
+			u, err := url.Parse(proxy)
+			check(err == nil && u.Host != "" && oneOf(u.Scheme, "http", "https", "socks5"), "webhooks.proxy.url", "must be an http://, https:// or socks5:// URL")
+		}
+		for _, network := range c.Webhooks.AllowedNetworks {
+			check(validNetwork(network), "webhooks.allowed_networks", "must be CIDR ranges or IP addresses, got %q", network)
+		}
+	}
+
+	// Logging
+	check(oneOf(strings.ToLower(c.Logging.Level), "debug", "info", "warn", "warning", "error"), "logging.level", "must be debug, info, warn or error, got %q", c.Logging.Level)
+	check(oneOf(strings.ToLower(c.Logging.Format), "json", "text"), "logging.format", "must be json or text, got %q", c.Logging.Format)
+
+	// Metrics
+	check(c.Metrics.LatencySampleRate >= 0 && c.Metrics.LatencySampleRate <= 1, "metrics.latency_sample_rate", "must be between 0 and 1, got %g", c.Metrics.LatencySampleRate)
+	if c.Metrics.Enabled {
+		check(strings.HasPrefix(c.Metrics.Path, "/"), "metrics.path", "must start with /")
+		if c.Metrics.Port != 0 {
+			check(validPort(c.Metrics.Port), "metrics.port", "must be between 1 and 65535, got %d", c.Metrics.Port)
+			check(c.Metrics.Port != c.App.Port, "metrics.port", "must differ from app.port")
+		}
+	}
+
+	// Tracing
+	if c.Tracing.Enabled {
+		check(c.Tracing.Endpoint != "", "tracing.endpoint", "is required when tracing is enabled")
+		check(c.Tracing.SampleRate >= 0 && c.Tracing.SampleRate <= 1, "tracing.sample_rate", "must be between 0 and 1, got %g", c.Tracing.SampleRate)
+	}
+
+	// Compression
+	check(c.Compression.Level >= -2 && c.Compression.Level <= 9, "compression.level", "must be between -2 and 9, got %d", c.Compression.Level)
+	check(c.Compression.MinSize >= 0, "compression.min_size", "must not be negative")
+
+	// CORS
+	anyOrigin := len(c.Cors.AllowedOrigins) == 0
+	for _, origin := range c.Cors.AllowedOrigins {
+		check(origin == "*" || strings.Contains(origin, "://"), "cors.allowed_origins", "%q must be \"*\" or include a scheme", origin)
+		anyOrigin = anyOrigin || origin == "*"
+	}
+	// Credentials sent to any origin would let every site act as the user
+	check(!anyOrigin || !c.Cors.AllowCredentials, "cors.allowed_origins", "must list the origins, not allow any, when cors.allow_credentials is set")
+	check(c.Cors.MaxAge >= 0, "cors.max_age", "must not be negative")
+
+	// Frontend
+	check(oneOf(c.Frontend.Mode, "embedded", "dir", "proxy", "disabled"), "frontend.mode", "must be embedded, dir, proxy or disabled, got %q", c.Frontend.Mode)
+	if c.Frontend.Mode == "dir" {
+		info, err := os.Stat(c.Frontend.Dir)
+		check(err == nil && info.IsDir(), "frontend.dir", "must be an existing directory, got %q", c.Frontend.Dir)
+	}
+	if c.Frontend.Mode == "proxy" {
+		check(validURL(c.Frontend.ProxyURL), "frontend.proxy_url", "must be an http(s) URL, got %q", c.Frontend.ProxyURL)
+	}
+
+	// Ingest
+	check(c.Ingest.BufferSize > 0, "ingest.buffer_size", "must be positive")
+	check(c.Ingest.BatchSize > 0, "ingest.batch_size", "must be positive")
+	check(c.Ingest.FlushInterval > 0, "ingest.flush_interval", "must be positive")
+	check(c.Ingest.TransformBudget > 0, "ingest.transform_budget", "must be positive")
+	check(c.Ingest.StreamAckEvery > 0, "ingest.stream_ack_every", "must be positive")
+	check(c.GeoIP.ReloadInterval > 0, "geoip.reload_interval", "must be positive")
+	check(c.GeoIP.Database == "" || fileExists(c.GeoIP.Database), "geoip.database", "cannot read %q", c.GeoIP.Database)
+	check(c.GeoIP.ASNDatabase == "" || fileExists(c.GeoIP.ASNDatabase), "geoip.asn_database", "cannot read %q", c.GeoIP.ASNDatabase)
+
+	// Sinks
+	check(c.Sinks.BufferSize > 0, "sinks.buffer_size", "must be positive")
+	if k := c.Sinks.Kafka; k.Enabled {
+		check(len(k.Brokers) > 0, "sinks.kafka.brokers", "is required when the Kafka sink is enabled (set KAFKA_BROKERS)")
+		check(k.Topic != "", "sinks.kafka.topic", "is required when the Kafka sink is enabled (set KAFKA_TOPIC)")
+		check(oneOf(k.RequiredAcks, "all", "one", "none"), "sinks.kafka.required_acks", "must be all, one or none, got %q", k.RequiredAcks)
+		check(k.BatchTimeout > 0, "sinks.kafka.batch_timeout", "must be positive")
+		check(k.WriteTimeout > 0, "sinks.kafka.write_timeout", "must be positive")
+		if k.TLS.Enabled {
+			check((k.TLS.CertFile == "") == (k.TLS.KeyFile == ""), "sinks.kafka.tls", "cert_file and key_file must be set together")
+			check(k.TLS.CAFile == "" || fileExists(k.TLS.CAFile), "sinks.kafka.tls.ca_file", "cannot read %q", k.TLS.CAFile)
+		}
+		if k.SASL.Mechanism != "" {
+			check(oneOf(k.SASL.Mechanism, "plain", "scram-sha-256", "scram-sha-512"), "sinks.kafka.sasl.mechanism", "must be plain, scram-sha-256 or scram-sha-512, got %q", k.SASL.Mechanism)
+			check(k.SASL.Username != "" && k.SASL.Password != "", "sinks.kafka.sasl", "username and password are required with a SASL mechanism")
+		}
+	}
+
+	// Dead letters
+	check(c.DeadLetters.Retention > 0, "dead_letters.retention", "must be positive")
+
+	// Leader election
+	if c.Leader.Enabled {
+		check(c.Leader.LeaseTTL >= time.Second, "leader.lease_ttl", "must be at least 1s")
+		check(len(c.Leader.InstanceID) <= 255, "leader.instance_id", "must be at most 255 characters")
+	}
+
+	// Reports
+	if c.Reports.Enabled {
+		check(c.Reports.CheckInterval > 0, "reports.check_interval", "must be positive")
+	}
+
+	// Alerts
+	if c.Alerts.Enabled {
+		check(c.Alerts.EvaluationInterval > 0, "alerts.evaluation_interval", "must be positive")
+	}
+
+	// Anomalies
+	if a := c.Anomalies; a.Enabled {
+		check(a.Interval > 0, "anomalies.interval", "must be positive")
+		check(a.Factor > 1, "anomalies.factor", "must be greater than 1, got %g", a.Factor)
+		check(a.MinRate >= 0, "anomalies.min_rate", "must not be negative")
+		check(a.Smoothing > 0 && a.Smoothing <= 1, "anomalies.smoothing", "must be greater than 0 and at most 1, got %g", a.Smoothing)
+		check(a.LearningWindow >= 0, "anomalies.learning_window", "must not be negative")
+		check(a.PersistInterval > 0, "anomalies.persist_interval", "must be positive")
+		if a.WebhookURL != "" {
+			check(validURL(a.WebhookURL), "anomalies.webhook_url", "must be an http(s) URL, got %q", a.WebhookURL)
+		}
+	}
+
+	// Debug
+	if d := c.Debug; d.CaptureFailedRequests {
+		check(d.CaptureSize > 0 && d.CaptureSize <= 10000, "debug.capture_size", "must be between 1 and 10000, got %d", d.CaptureSize)
+		check(d.CaptureBodyBytes >= 0 && d.CaptureBodyBytes <= 1<<20, "debug.capture_body_bytes", "must be between 0 and 1048576, got %d", d.CaptureBodyBytes)
+	}
+
+	// Archive
+	check(oneOf(c.Archive.Backend, "local", "s3"), "archive.backend", "must be local or s3, got %q", c.Archive.Backend)
+	check(c.Archive.URLExpiry > 0 && c.Archive.URLExpiry <= 7*24*time.Hour, "archive.url_expiry", "must be positive and at most 168h, got %s", c.Archive.URLExpiry)
+	if s3 := c.Archive.S3; c.Archive.Backend == "s3" {
+		check(s3.Bucket != "", "archive.s3.bucket", "is required with the s3 backend")
+		check(s3.Region != "", "archive.s3.region", "is required with the s3 backend")
+		check(s3.AccessKeyID != "" && s3.SecretAccessKey != "", "archive.s3", "access_key_id and secret_access_key are required with the s3 backend")
+		if s3.Endpoint != "" {
+			check(validURL(s3.Endpoint), "archive.s3.endpoint", "must be an http(s) URL, got %q", s3.Endpoint)
+		}
+	} else {
+		check(c.Archive.Dir != "", "archive.dir", "is required with the local backend")
+	}
+
+	// Exports
+	check(c.Exports.PollInterval > 0, "exports.poll_interval", "must be positive")
+	check(c.Exports.BatchSize > 0 && c.Exports.BatchSize <= 10000, "exports.batch_size", "must be between 1 and 10000, got %d", c.Exports.BatchSize)
+	check(c.Exports.QueryTimeout > 0, "exports.query_timeout", "must be positive")
+
+	// Imports
+	check(c.Imports.PollInterval > 0, "imports.poll_interval", "must be positive")
+	check(c.Imports.BatchSize > 0 && c.Imports.BatchSize <= 10000, "imports.batch_size", "must be between 1 and 10000, got %d", c.Imports.BatchSize)
+
+	// Redactions
+	check(c.Redactions.PollInterval > 0, "redactions.poll_interval", "must be positive")
+	check(c.Redactions.BatchSize > 0 && c.Redactions.BatchSize <= 10000, "redactions.batch_size", "must be between 1 and 10000, got %d", c.Redactions.BatchSize)
+
+	// Receipts
+	if r := c.Receipts; len(r.Keys) > 0 || r.KeyID != "" {
+		_, ok := r.Keys[r.KeyID]
+		check(ok, "receipts.key_id", "must name one of receipts.keys, got %q", r.KeyID)
+		for id, seed := range r.Keys {
+			check(receiptKeyID.MatchString(id), "receipts.keys", "key ID %q must be 1-64 letters, digits, dashes or underscores", id)
+			decoded, err := base64.StdEncoding.DecodeString(seed)
+			check(err == nil && len(decoded) == ed25519.SeedSize, "receipts.keys."+id, "must be a base64 %d-byte Ed25519 seed", ed25519.SeedSize)
+		}
+	}
+	for id, key := range c.Receipts.PublicKeys {
+		check(receiptKeyID.MatchString(id), "receipts.public_keys", "key ID %q must be 1-64 letters, digits, dashes or underscores", id)
+		_, signing := c.Receipts.Keys[id]
+		check(!signing, "receipts.public_keys."+id, "is also in receipts.keys")
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		check(err == nil && len(decoded) == ed25519.PublicKeySize, "receipts.public_keys."+id, "must be a base64 %d-byte Ed25519 public key", ed25519.PublicKeySize)
+	}
+
+	// NATS
+	if n := c.Nats; n.URL != "" {
+		check(n.ReconnectWait > 0, "nats.reconnect_wait", "must be positive")
+		check(n.PublishTimeout > 0, "nats.publish_timeout", "must be positive")
+		check(validSubject(n.SubjectPrefix) && !strings.ContainsAny(n.SubjectPrefix, "*>"), "nats.subject_prefix", "must be a subject without wildcards, got %q", n.SubjectPrefix)
+		check(n.Token == "" || n.Username == "", "nats", "token and username cannot both be set")
+		check((n.Username == "") == (n.Password == ""), "nats", "username and password must be set together")
+		check(n.CredsFile == "" || fileExists(n.CredsFile), "nats.creds_file", "cannot read %q", n.CredsFile)
+
+		if cons := n.Consume; cons.Subject != "" {
+			check(validSubject(cons.Subject), "nats.consume.subject", "is not a valid subject: %q", cons.Subject)
+			// Consuming our own output would ingest every event again, forever
+			check(!subjectsOverlap(cons.Subject, n.SubjectPrefix+".>"), "nats.consume.subject", "must not overlap the published subjects %s.>", n.SubjectPrefix)
+			check(!strings.ContainsAny(cons.Durable, ". *>"), "nats.consume.durable", "must not contain dots, spaces or wildcards, got %q", cons.Durable)
+			check(cons.TenantToken >= 0, "nats.consume.tenant_token", "must not be negative")
+			check(cons.EventTypeToken >= 0, "nats.consume.event_type_token", "must not be negative")
+			check(cons.BatchSize > 0, "nats.consume.batch_size", "must be positive")
+			check(cons.AckWait > 0, "nats.consume.ack_wait", "must be positive")
+			check(cons.MaxDeliver > 0, "nats.consume.max_deliver", "must be positive")
+		}
+	}
+
+	// MQTT
+	if m := c.MQTT; m.Broker != "" {
+		u, err := url.Parse(m.Broker)
+		check(err == nil && u.Host != "" && oneOf(u.Scheme, "mqtt", "tcp", "tls", "ssl", "mqtts"), "mqtt.broker", "must be an mqtt://, tcp://, tls://, ssl:// or mqtts:// URL, got %q", m.Broker)
+		check(validTopicPattern(m.Topic), "mqtt.topic", "must contain the {tenant_api_key} and {event_type} levels once each and no wildcards, got %q", m.Topic)
+		check(!strings.ContainsAny(m.SharedGroup, "/+#"), "mqtt.shared_group", "must not contain /, + or #")
+		check(m.QoS >= 0 && m.QoS <= 2, "mqtt.qos", "must be 0, 1 or 2, got %d", m.QoS)
+		check(m.SessionExpiry >= 0 && m.SessionExpiry <= math.MaxUint32*time.Second, "mqtt.session_expiry", "must be between 0 and %d seconds", uint32(math.MaxUint32))
+		check(m.KeepAlive >= time.Second && m.KeepAlive <= math.MaxUint16*time.Second, "mqtt.keep_alive", "must be between 1s and %d seconds", math.MaxUint16)
+		check(m.ReconnectWait > 0, "mqtt.reconnect_wait", "must be positive")
+		check((m.TLS.CertFile == "") == (m.TLS.KeyFile == ""), "mqtt.tls", "cert_file and key_file must be set together")
+		check(m.TLS.CAFile == "" || fileExists(m.TLS.CAFile), "mqtt.tls.ca_file", "cannot read %q", m.TLS.CAFile)
+	}
+
+	// Feature flags
+	for name := range c.Flags {
+		check(flagName.MatchString(name), "flags", "flag %q must be 1-64 lowercase letters, digits or underscores", name)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// setDefault assigns value to a field that still holds its zero value
+func setDefault[T comparable](field *T, value T) {
+	var zero T
+	if *field == zero {
+		*field = value
+	}
+}
+
+// fileExists reports whether path names a readable regular file
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// validSubject reports whether s is a well-formed NATS subject: non-empty
+// tokens, "*" only as a whole token and ">" only as the last token
+func validSubject(s string) bool {
+	if s == "" || strings.ContainsAny(s, " \t\r\n") {
+		return false
+	}
+	tokens := strings.Split(s, ".")
+	for i, t := range tokens {
+		switch {
+		case t == "":
+			return false
+		case t == ">" && i != len(tokens)-1:
+			return false
+		case t != "*" && t != ">" && strings.ContainsAny(t, "*>"):
+			return false
+		}
+	}
+	return true
+}
+
+// subjectsOverlap reports whether some subject matches both patterns
+func subjectsOverlap(a, b string) bool {
+	ta, tb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(ta) && i < len(tb); i++ {
+		if ta[i] == ">" || tb[i] == ">" {
+			return true
+		}
+		if ta[i] != tb[i] && ta[i] != "*" && tb[i] != "*" {
+			return false
+		}
+	}
+	return len(ta) == len(tb)
+}
+
+// validTopicPattern reports whether an MQTT topic pattern names the tenant
+// API key and event type levels exactly once, as whole levels, and has no
+// wildcards of its own
+func validTopicPattern(pattern string) bool {
+	var keys, types int
+	for _, level := range strings.Split(pattern, "/") {
+		switch {
+		case level == "{tenant_api_key}":
+			keys++
+		case level == "{event_type}":
+			types++
+		case strings.ContainsAny(level, "+#{}"):
+			return false
+		}
+	}
+	return keys == 1 && types == 1
+}
+
+// validNetwork reports whether value is a CIDR range or an IP address
+func validNetwork(value string) bool {
+	if _, err := netip.ParsePrefix(value); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(value)
+	return err == nil
+}
+
+// validProxy reports whether value is a CIDR range or an IP address as the
+// router parses trusted proxies, which takes no IPv6 zone
+func validProxy(value string) bool {
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return true
+	}
+	return net.ParseIP(value) != nil
+}
+
+// validURL reports whether value is an absolute http or https URL
+func validURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validPort(port int) bool {
+	return port >= 1 && port <= 65535
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
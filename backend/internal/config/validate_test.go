@@ -0,0 +1,155 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() *Config {
+	cfg := &Config{}
+	cfg.Auth.JWTSecret = "validate-test-secret"
+	cfg.Defaults()
+	return cfg
+}
+
+func TestValidateRejectsUnusableTrustedProxies(t *testing.T) {
+	for _, proxy := range []string{"proxy.internal", "10.0.0.0/33", "fe80::1%eth0"} {
+		cfg := validConfig()
+		cfg.App.TrustedProxies = []string{"10.0.0.0/8", proxy}
+
+		var invalid *ValidationError
+		if err := cfg.Validate(); !errors.As(err, &invalid) || !strings.Contains(strings.Join(invalid.Problems, "\n"), "app.trusted_proxies") {
+			t.Errorf("%q: err = %v, want app.trusted_proxies rejected", proxy, err)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.App.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("valid proxies rejected: %v", err)
+	}
+}
+
+func TestValidateRejectsCredentialsForAnyOrigin(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		origins []string
+		ok      bool
+	}{
+		{"wildcard", []string{"*"}, false},
+		{"wildcard among origins", []string{"https://app.example.com", "*"}, false},
+		{"no origins, which allows any", nil, false},
+		{"listed origins", []string{"https://app.example.com", "https://*.example.com"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Cors.AllowedOrigins = tc.origins
+			cfg.Cors.AllowCredentials = true
+
+			err := cfg.Validate()
+			if tc.ok && err != nil {
+				t.Fatalf("Validate() = %v, want nil", err)
+			}
+			var invalid *ValidationError
+			if !tc.ok && (!errors.As(err, &invalid) || !strings.Contains(strings.Join(invalid.Problems, "\n"), "cors.allowed_origins")) {
+				t.Fatalf("Validate() = %v, want cors.allowed_origins rejected", err)
+			}
+		})
+	}
+
+	// Without credentials any origin is fine
+	cfg := validConfig()
+	cfg.Cors.AllowedOrigins = []string{"*"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(*Config)
+		// want is the problem reported, or "" when the config is valid
+		want string
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"lowest port", func(c *Config) { c.App.Port = 1 }, ""},
+		{"highest port", func(c *Config) { c.App.Port = 65535 }, ""},
+		{"port too high", func(c *Config) { c.App.Port = 65536 }, "app.port: must be between 1 and 65535, got 65536"},
+		{"negative port", func(c *Config) { c.App.Port = -1 }, "app.port: must be between 1 and 65535, got -1"},
+		{"admin port on app port", func(c *Config) { c.App.AdminPort = c.App.Port }, "app.admin_port: must differ from app.port"},
+		{"negative duration", func(c *Config) { c.App.WriteTimeout = -time.Second }, "app.write_timeout: must not be negative"},
+		{"duration that must be positive", func(c *Config) { c.Auth.JWTExpiry = -time.Hour }, "auth.jwt_expiry: must be positive"},
+		{"pong timeout within ping interval", func(c *Config) { c.WebSocket.PongTimeout = c.WebSocket.PingInterval }, "websocket.pong_timeout: must be greater than ping_interval"},
+		{"tenant cache TTL too long", func(c *Config) { c.Auth.TenantCacheTTL = 6 * time.Minute }, "auth.tenant_cache_ttl: must be at most 5m"},
+		{"rate limit without a rate", func(c *Config) {
+			c.RateLimit.Enabled = true
+			c.RateLimit.RequestsPerMinute = 0
+		}, "rate_limit.requests_per_minute: must be positive when rate limiting is enabled"},
+		{"rate limit off without a rate", func(c *Config) { c.RateLimit.RequestsPerMinute = 0 }, ""},
+		{"negative burst", func(c *Config) { c.RateLimit.Burst = -1 }, "rate_limit.burst: must not be negative"},
+		{"example secret in release mode", func(c *Config) {
+			c.App.Mode = "release"
+			c.Auth.JWTSecret = InsecureJWTSecret
+		}, "auth.jwt_secret: the example secret is not allowed in release mode (set JWT_SECRET)"},
+		{"example secret in debug mode", func(c *Config) {
+			c.App.Mode = "debug"
+			c.Auth.JWTSecret = InsecureJWTSecret
+		}, ""},
+		{"missing secret", func(c *Config) { c.Auth.JWTSecret = "" }, "auth.jwt_secret: is required (set JWT_SECRET)"},
+		{"unknown driver", func(c *Config) { c.Database.Driver = "oracle" }, `database.driver: must be sqlite, postgres or mysql, got "oracle"`},
+		{"postgres without credentials", func(c *Config) {
+			c.Database.Driver = "postgres"
+			c.Database.Host = "db.internal"
+			c.Database.Port = 5432
+			c.Database.SSLMode = "require"
+		}, "database.user: is required for postgres (set DB_USER)"},
+		{"mysql without a database name", func(c *Config) {
+			c.Database.Driver = "mysql"
+			c.Database.Host = "db.internal"
+			c.Database.User = "events"
+			c.Database.Port = 3306
+			c.Database.SSLMode = "require"
+		}, "database.name: is required for mysql (set DB_NAME)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := validConfig()
+			tc.change(cfg)
+			err := cfg.Validate()
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+			for _, problem := range invalid.Problems {
+				if problem == tc.want {
+					return
+				}
+			}
+			t.Fatalf("problems = %q, want %q among them", invalid.Problems, tc.want)
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig()
+	cfg.App.Port = 0
+	cfg.Database.Driver = "oracle"
+	cfg.RateLimit.Burst = -1
+
+	err := cfg.Validate()
+	want := "invalid configuration:\n" +
+		"  - app.port: must be between 1 and 65535, got 0\n" +
+		"  - database.driver: must be sqlite, postgres or mysql, got \"oracle\"\n" +
+		"  - rate_limit.burst: must not be negative"
+	if err == nil || err.Error() != want {
+		t.Fatalf("Validate() = %v, want\n%s", err, want)
+	}
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"errors"
+
+	"event-ingestion-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrCompressedMetadata is returned when a search or tag filter would have
+// to match the metadata of events stored compressed, which SQL cannot see
+// into
+var ErrCompressedMetadata = errors.New("search covers events with compressed metadata")
+
+// ErrCompressionDisabled is returned by CompressStoredMetadata when the
+// database stores metadata as it is
+var ErrCompressionDisabled = errors.New("metadata compression is disabled: database.compress_metadata_above is 0 or the database is PostgreSQL")
+
+// WithMetadataCompression returns a copy of the database that stores event
+// metadata longer than threshold bytes zstd-compressed; 0 stores it as it
+// is. PostgreSQL always does, as it compresses large values itself.
+func (d *Database) WithMetadataCompression(threshold int) *Database {
+	clone := *d
+	clone.compressMetadataAbove = 0
+	if !d.dialect.compressesText() {
+		clone.compressMetadataAbove = threshold
+	}
+	return &clone
+}
+
+// prepareMetadata records the metadata size of events about to be
+// inserted and compresses their metadata, and returns a function restoring
+// it, since callers go on to deliver and broadcast the events they stored
+func (d *Database) prepareMetadata(events ...*models.Event) (restore func()) {
+	for _, event := range events {
+		if event.MetadataEncoding == models.MetadataPlain {
+			event.MetadataSize = int64(len(event.Metadata))
+		}
+	}
+	plain := make(map[*models.Event]string)
+	if d.compressMetadataAbove > 0 {
+		for _, event := range events {
+			metadata := event.Metadata
+			if event.CompressMetadata(d.compressMetadataAbove) {
+				plain[event] = metadata
+			}
+		}
+	}
+	return func() {
+		for event, metadata := range plain {
+			event.Metadata, event.MetadataEncoding = metadata, models.MetadataPlain
+		}
+	}
+}
+
+// decompressMetadata restores the plain metadata of events read back
+func decompressMetadata(events []models.Event) error {
+	for i := range events {
+		if err := events[i].DecompressMetadata(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchable returns ErrCompressedMetadata when the filter matches metadata
+// text and any of the events it covers has its metadata compressed
+func (d *Database) searchable(db *gorm.DB, filter EventFilter) error {
+	if filter.Search == "" && len(filter.Tags) == 0 {
+		return nil
+	}
+	filter.Search, filter.Tags = "", nil
+	var ids []uint
+	err := d.eventQuery(db, filter).Model(&models.Event{}).
+		Where("metadata_encoding = ?", models.MetadataZstd).
+		Limit(1).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		return ErrCompressedMetadata
+	}
+	return nil
+}
+
+// MetadataCompression counts what CompressStoredMetadata did. Bytes are
+// those of the metadata it compressed, before and after.
+type MetadataCompression struct {
+	Scanned     int64
+	Compressed  int64
+	BytesBefore int64
+	BytesAfter  int64
+	// LastID is the ID of the last event scanned, to resume after
+	LastID uint
+}
+
+// CompressStoredMetadata compresses the plain metadata of up to limit
+// stored events with an ID greater than afterID, deleted ones included, as
+// new events above the threshold are. Each batch is its own transaction, so
+// the work can be stopped and resumed at any batch. Scanned is less than
+// limit once no events are left.
+func (d *Database) CompressStoredMetadata(afterID uint, limit int) (MetadataCompression, error) {
+	result := MetadataCompression{LastID: afterID}
+	if d.compressMetadataAbove <= 0 {
+		return result, ErrCompressionDisabled
+	}
+
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		var events []models.Event
+		if err := tx.Unscoped().Select("id", "metadata", "metadata_encoding").
+			Where("id > ?", afterID).
+			Order("id ASC").
+			Limit(limit).
+			Find(&events).Error; err != nil {
+			return err
+		}
+		for i := range events {
+			event := &events[i]
+			result.Scanned++
+			result.LastID = event.ID
+			before := len(event.Metadata)
+			if !event.CompressMetadata(d.compressMetadataAbove) {
+				continue
+			}
+			if err := tx.Unscoped().Model(&models.Event{}).
+				Where("id = ? AND metadata_encoding = ?", event.ID, models.MetadataPlain).
+				UpdateColumns(map[string]interface{}{
+					"metadata":          event.Metadata,
+					"metadata_encoding": event.MetadataEncoding,
+				}).Error; err != nil {
+				return err
+			}
+			result.Compressed++
+			result.BytesBefore += int64(before)
+			result.BytesAfter += int64(len(event.Metadata))
+		}
+		return nil
+	})
+	if err != nil {
+		return MetadataCompression{LastID: afterID}, err
+	}
+	return result, nil
+}
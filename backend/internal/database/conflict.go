@@ -0,0 +1,70 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrWriteConflict is returned when a write transaction kept failing on a
+// serialization failure or deadlock with concurrent ones. Nothing was
+// written, so running it again is safe.
+var ErrWriteConflict = errors.New("write conflicted with concurrent transactions")
+
+// writeConflictBackoff is the wait before the first retry of a conflicted
+// write; each retry doubles it, and a random part spreads the retries of
+// transactions that conflicted with each other
+const writeConflictBackoff = 10 * time.Millisecond
+
+// WithWriteConflictRetries returns a copy of the database that runs event
+// inserts again up to retries times when the server aborts them for a
+// serialization failure or deadlock; 0 or less fails them at once
+func (d *Database) WithWriteConflictRetries(retries int) *Database {
+	clone := *d
+	clone.writeConflictRetries = max(retries, 0)
+	return &clone
+}
+
+// sequencedEvents runs fn in a transaction as sequenced does, and again
+// while the transaction conflicts and retries remain. The IDs and
+// sequences of events are put back before each retry, as the aborted
+// transaction stored neither. Running out of retries is ErrWriteConflict.
+func (d *Database) sequencedEvents(events []*models.Event, fn func(tx *gorm.DB) error) error {
+	ids := make([]uint, len(events))
+	sequences := make([]uint64, len(events))
+	for i, event := range events {
+		ids[i], sequences[i] = event.ID, event.Sequence
+	}
+
+	ctx := d.DB.Statement.Context
+	wait := writeConflictBackoff
+	for attempt := 0; ; attempt++ {
+		err := d.sequenced(fn)
+		if err == nil || !d.dialect.isWriteConflict(err) {
+			return err
+		}
+		if attempt == d.writeConflictRetries {
+			metrics.DBWriteConflict("exhausted")
+			return fmt.Errorf("%w after %d attempts: %w", ErrWriteConflict, attempt+1, err)
+		}
+		metrics.DBWriteConflict("retried")
+
+		for i, event := range events {
+			event.ID, event.Sequence = ids[i], sequences[i]
+		}
+		timer := time.NewTimer(wait/2 + time.Duration(rand.Int63n(int64(wait))))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
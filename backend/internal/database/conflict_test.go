@@ -0,0 +1,150 @@
+package database
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errTestConflict = errors.New("deadlock detected")
+
+// conflictingDialect is SQLite taking errTestConflict for a write conflict
+type conflictingDialect struct{ dialect }
+
+func (conflictingDialect) isWriteConflict(err error) bool { return errors.Is(err, errTestConflict) }
+
+func TestSequencedEventsRetriesWriteConflicts(t *testing.T) {
+	db := openTestDatabase(t)
+	if err := db.Migrate(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	db.dialect = conflictingDialect{db.dialect}
+	db = db.WithWriteConflictRetries(2)
+
+	// The first two attempts insert the event and then conflict, so they
+	// roll back; the third commits
+	event := newEvent("tenant-1")
+	attempts := 0
+	err := db.sequencedEvents([]*models.Event{&event}, func(tx *gorm.DB) error {
+		attempts++
+		if err := createEvent(tx, db.dialect, &event); err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return errTestConflict
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 || event.Sequence != 1 {
+		t.Fatalf("attempts = %d, sequence = %d, want the third attempt to store sequence 1", attempts, event.Sequence)
+	}
+
+	// Out of retries
+	attempts = 0
+	second := newEvent("tenant-1")
+	err = db.sequencedEvents([]*models.Event{&second}, func(tx *gorm.DB) error {
+		attempts++
+		if err := createEvent(tx, db.dialect, &second); err != nil {
+			return err
+		}
+		return errTestConflict
+	})
+	if !errors.Is(err, ErrWriteConflict) || attempts != 3 {
+		t.Fatalf("err = %v after %d attempts, want ErrWriteConflict after 3", err, attempts)
+	}
+	var stored int64
+	if err := db.DB.Model(&models.Event{}).Count(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored != 1 {
+		t.Fatalf("%d events stored, want only the first", stored)
+	}
+}
+
+// TestSequencedEventsRetriesPostgresDeadlock makes two transactions lock
+// two tenants' sequence counters in opposite orders. PostgreSQL aborts one
+// of them with deadlock_detected, and it must succeed when run again. It
+// needs a scratch PostgreSQL database, named by TEST_POSTGRES_DSN.
+func TestSequencedEventsRetriesPostgresDeadlock(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	db, err := NewDatabase("postgres", dsn, 4, 4, time.Hour, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	db = db.WithWriteConflictRetries(3)
+
+	tenants := []string{uuid.New().String(), uuid.New().String()}
+	// Both transactions hold their first counter before either asks for
+	// its second, on their first attempt
+	var locked sync.WaitGroup
+	locked.Add(2)
+	var mu sync.Mutex
+	attempts := 0
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range tenants {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			first, second := tenants[i], tenants[1-i]
+			events := []models.Event{newEvent(first), newEvent(second)}
+			attempt := 0
+			errs[i] = db.sequencedEvents([]*models.Event{&events[0], &events[1]}, func(tx *gorm.DB) error {
+				attempt++
+				mu.Lock()
+				attempts++
+				mu.Unlock()
+				if _, err := reserveSequences(tx, db.dialect, first, 1); err != nil {
+					return err
+				}
+				if attempt == 1 {
+					locked.Done()
+					locked.Wait()
+				}
+				if _, err := reserveSequences(tx, db.dialect, second, 1); err != nil {
+					return err
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("transaction %d: %v", i, err)
+		}
+	}
+	if attempts < 3 {
+		t.Fatalf("%d attempts, want a deadlocked transaction retried", attempts)
+	}
+	for _, tenantID := range tenants {
+		var counter models.EventSequence
+		if err := db.DB.Where("tenant_id = ?", tenantID).Take(&counter).Error; err != nil {
+			t.Fatal(err)
+		}
+		if counter.LastSequence != 2 {
+			t.Errorf("tenant %s counter = %d, want 2 with the aborted attempt rolled back", tenantID, counter.LastSequence)
+		}
+	}
+}
@@ -1,15 +1,22 @@
 package database
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"event-ingestion-system/internal/eventtype"
+	"event-ingestion-system/internal/logging"
 	"event-ingestion-system/internal/models"
 	"fmt"
-	"gorm.io/driver/postgres"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
-	"log"
-	"os"
-	"path/filepath"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,32 +27,42 @@ type Database struct {
 	MaxOpenConns    int
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
-}
 
-// NewDatabase creates a new database connection
-func NewDatabase(driver, dsn string, maxOpenConns, maxIdleConns int, connMaxLifetime time.Duration) (*Database, error) {
-	var db *gorm.DB
-	var err error
+	dialect dialect
+	// acquireTimeout bounds waits for a pooled connection when positive;
+	// acquireTimeouts counts the waits that ran out
+	acquireTimeout  time.Duration
+	acquireTimeouts *atomic.Int64
+	// queryTimeout bounds event searches when positive, on the server too
+	// when statementTimeout is set
+	queryTimeout     time.Duration
+	statementTimeout bool
+	// compressMetadataAbove is the metadata length in bytes above which
+	// events are stored compressed; 0 stores all metadata as it is
+	compressMetadataAbove int
+	// writeConflictRetries is how many times an event insert the server
+	// aborted for a serialization failure or deadlock is run again
+	writeConflictRetries int
+	// sequenceMu serialises event inserts on SQLite, which has no row locks
+	// to hold a tenant's sequence counter with. Shared by WithContext copies.
+	sequenceMu *sync.Mutex
+	logger     *slog.Logger
+}
 
-	if driver == "postgres" {
-		// PostgreSQL connection
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Info),
-		})
-	} else {
-		// SQLite connection (default)
-		// Create directory if it doesn't exist
-		dir := filepath.Dir(dsn)
-		if dir != "" && dir != "." {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				return nil, fmt.Errorf("failed to create database directory: %w", err)
-			}
-		}
-		db, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Info),
-		})
+// NewDatabase creates a new database connection. driver is sqlite,
+// postgres or mysql.
+func NewDatabase(driver, dsn string, maxOpenConns, maxIdleConns int, connMaxLifetime, acquireTimeout time.Duration, logger *slog.Logger) (*Database, error) {
+	dialect, err := dialectFor(driver)
+	if err != nil {
+		return nil, err
 	}
-
+	dialector, err := dialect.open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logging.NewGormLogger(logger),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -59,34 +76,286 @@ func NewDatabase(driver, dsn string, maxOpenConns, maxIdleConns int, connMaxLife
 	sqlDB.SetMaxIdleConns(maxIdleConns)
 	sqlDB.SetConnMaxLifetime(connMaxLifetime)
 
+	acquireTimeouts := &atomic.Int64{}
+	if acquireTimeout > 0 {
+		db.ConnPool = &timedPool{db: sqlDB, timeout: acquireTimeout, timeouts: acquireTimeouts}
+		db.Statement.ConnPool = db.ConnPool
+	}
+
 	return &Database{
 		DB:              db,
 		Driver:          driver,
 		MaxOpenConns:    maxOpenConns,
 		MaxIdleConns:    maxIdleConns,
 		ConnMaxLifetime: connMaxLifetime,
+		dialect:         dialect,
+		acquireTimeout:  acquireTimeout,
+		acquireTimeouts: acquireTimeouts,
+		sequenceMu:      &sync.Mutex{},
+		logger:          logger,
 	}, nil
 }
 
-// BuildDSN builds a PostgreSQL connection string from components
-func BuildDSN(host, port, user, password, dbname string) string {
-	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=require",
-		host, port, user, password, dbname)
+// WithContext returns a copy of the database bound to ctx, so queries
+// observe its cancellation and are traced as children of its span
+func (d *Database) WithContext(ctx context.Context) *Database {
+	clone := *d
+	clone.DB = d.DB.WithContext(ctx)
+	return &clone
+}
+
+// migratedModels are the models Migrate creates tables for
+var migratedModels = []interface{}{
+	&models.Tenant{},
+	&models.Event{},
+	&models.EventSequence{},
+	&models.SampledEventCount{},
+	&models.QuotaNotice{},
+	&models.Lease{},
+	&models.Webhook{},
+	&models.AuditLog{},
+	&models.AuditChainHead{},
+	&models.SystemSetting{},
+	&models.ConsumerOffset{},
+	&models.DeadLetter{},
+	&models.SavedView{},
+	&models.Report{},
+	&models.AlertRule{},
+	&models.AlertHistory{},
+	&models.Impersonation{},
+	&models.User{},
+	&models.ExportJob{},
+	&models.ExportPart{},
+	&models.ImportJob{},
+	&models.RedactionJob{},
+}
+
+// Migrate runs database migrations: the SQL files of migrations/postgres
+// on PostgreSQL, AutoMigrate of migratedModels elsewhere, then backfills of
+// columns added since events were stored. One process migrates at a time;
+// others wait up to lockTimeout for it to finish, then fail with
+// ErrMigrationLocked, and find nothing left to do once they get the lock.
+func (d *Database) Migrate(lockTimeout time.Duration) error {
+	release, err := d.lockMigrations(lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if files := d.dialect.migrations(); files != nil {
+		if err := d.applySQLMigrations(files); err != nil {
+			return err
+		}
+	} else {
+		if err := d.DB.AutoMigrate(migratedModels...); err != nil {
+			return err
+		}
+		if err := d.dialect.afterMigrate(d.DB, migratedModels); err != nil {
+			return err
+		}
+	}
+
+	// Events stored before sequence numbers existed need theirs before the
+	// unique index can be built, so the index is not declared on the model
+	if err := d.backfillEventSequences(); err != nil {
+		return fmt.Errorf("backfill event sequences: %w", err)
+	}
+	if err := d.backfillMetadataSizes(); err != nil {
+		return fmt.Errorf("backfill metadata sizes: %w", err)
+	}
+	if d.DB.Migrator().HasIndex(&models.Event{}, "idx_events_tenant_sequence") {
+		return nil
+	}
+	return d.DB.Exec("CREATE UNIQUE INDEX idx_events_tenant_sequence ON events (tenant_id, sequence)").Error
+}
+
+// PendingMigrations lists what Migrate would do without changing anything:
+// the SQL files it would apply on PostgreSQL, and elsewhere missing tables,
+// and missing columns and indexes of existing ones. It does not notice
+// columns whose type changed.
+func (d *Database) PendingMigrations() ([]string, error) {
+	var pending []string
+	if files := d.dialect.migrations(); files != nil {
+		versions, err := d.pendingSQLMigrations(files)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range versions {
+			pending = append(pending, "apply migration "+version)
+		}
+	} else {
+		changes, err := d.pendingModelChanges()
+		if err != nil {
+			return nil, err
+		}
+		pending = changes
+	}
+	migrator := d.DB.Migrator()
+	if migrator.HasTable(&models.Event{}) && !migrator.HasIndex(&models.Event{}, "idx_events_tenant_sequence") {
+		pending = append(pending, "create index idx_events_tenant_sequence on events")
+	}
+	return pending, nil
+}
+
+// pendingModelChanges lists the tables, columns and indexes of
+// migratedModels that AutoMigrate would create
+func (d *Database) pendingModelChanges() ([]string, error) {
+	migrator := d.DB.Migrator()
+	var pending []string
+	for _, model := range migratedModels {
+		stmt := &gorm.Statement{DB: d.DB}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		table := stmt.Schema.Table
+		if !migrator.HasTable(model) {
+			pending = append(pending, "create table "+table)
+			continue
+		}
+		for _, column := range stmt.Schema.DBNames {
+			if !migrator.HasColumn(model, column) {
+				pending = append(pending, "add column "+table+"."+column)
+			}
+		}
+		var indexes []string
+		for name := range stmt.Schema.ParseIndexes() {
+			indexes = append(indexes, name)
+		}
+		sort.Strings(indexes)
+		for _, name := range indexes {
+			if !migrator.HasIndex(model, name) {
+				pending = append(pending, "create index "+name+" on "+table)
+			}
+		}
+	}
+	return pending, nil
 }
 
-// Migrate runs database migrations
-func (d *Database) Migrate() error {
-	// For PostgreSQL, skip AutoMigrate if tables already exist (prevents "insufficient arguments" error)
-	// Tables were created during initial deployment
-	if d.Driver == "postgres" {
-		log.Println("Skipping PostgreSQL AutoMigrate - tables already exist")
+// backfillEventSequences numbers events without a sequence in ID order,
+// after any numbered events of the same tenant, and moves the tenants'
+// counters past them. Soft-deleted events are numbered too.
+func (d *Database) backfillEventSequences() error {
+	var tenantIDs []string
+	err := d.DB.Unscoped().Model(&models.Event{}).Where("sequence = 0").Distinct().Pluck("tenant_id", &tenantIDs).Error
+	if err != nil || len(tenantIDs) == 0 {
+		return err
+	}
+
+	d.logger.Info("Assigning sequence numbers to existing events", "tenants", len(tenantIDs))
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		for _, tenantID := range tenantIDs {
+			var ids []uint
+			if err := tx.Unscoped().Model(&models.Event{}).Where("tenant_id = ? AND sequence = 0", tenantID).Order("id ASC").Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			first, err := reserveSequences(tx, d.dialect, tenantID, len(ids))
+			if err != nil {
+				return err
+			}
+			for i, id := range ids {
+				if err := tx.Unscoped().Model(&models.Event{}).Where("id = ?", id).Update("sequence", first+uint64(i)).Error; err != nil {
+					return err
+				}
+			}
+		}
 		return nil
+	})
+}
+
+// backfillMetadataSizes records the metadata size of events stored before
+// sizes were, from the metadata as stored; compressed metadata is sized
+// once decompressed. Soft-deleted events are sized too.
+func (d *Database) backfillMetadataSizes() error {
+	unsized := d.DB.Unscoped().Model(&models.Event{}).Where("metadata_size = 0 AND metadata <> ''")
+	result := unsized.Session(&gorm.Session{}).
+		Where("metadata_encoding <> ?", models.MetadataZstd).
+		Update("metadata_size", gorm.Expr(d.dialect.byteLength("metadata")))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		d.logger.Info("Recorded the metadata size of existing events", "events", result.RowsAffected)
+	}
+
+	for {
+		var events []models.Event
+		err := unsized.Session(&gorm.Session{}).
+			Select("id, metadata, metadata_encoding").
+			Where("metadata_encoding = ?", models.MetadataZstd).
+			Order("id ASC").Limit(500).
+			Find(&events).Error
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		for _, event := range events {
+			plain, err := event.PlainMetadata()
+			if err != nil {
+				return err
+			}
+			err = d.DB.Unscoped().Model(&models.Event{}).Where("id = ?", event.ID).Update("metadata_size", len(plain)).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// reserveSequences advances a tenant's counter by n within tx and returns
+// the first of the n numbers reserved. The counter row stays locked until
+// tx ends, so a rolled-back insert leaves no gap and tenants' inserts are
+// numbered in commit order. A missing counter starts after the highest
+// sequence already stored, so it can be rebuilt from the events.
+func reserveSequences(tx *gorm.DB, dialect dialect, tenantID string, n int) (uint64, error) {
+	lock := tx
+	if dialect.rowLocks() {
+		// SELECT ... FOR UPDATE; SQLite callers hold sequenceMu instead
+		lock = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	var counter models.EventSequence
+	err := lock.Where("tenant_id = ?", tenantID).Take(&counter).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var highest uint64
+		if err := tx.Unscoped().Model(&models.Event{}).Where("tenant_id = ?", tenantID).
+			Select("COALESCE(MAX(sequence), 0)").Scan(&highest).Error; err != nil {
+			return 0, err
+		}
+		// A concurrent first insert may create the counter first; then lock
+		// and use that one
+		counter = models.EventSequence{TenantID: tenantID, LastSequence: highest}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&counter).Error; err != nil {
+			return 0, err
+		}
+		err = lock.Where("tenant_id = ?", tenantID).Take(&counter).Error
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	first := counter.LastSequence + 1
+	err = tx.Model(&models.EventSequence{}).Where("tenant_id = ?", tenantID).
+		Update("last_sequence", counter.LastSequence+uint64(n)).Error
+	return first, err
+}
+
+// sequenced runs fn in a transaction that may reserve sequence numbers
+func (d *Database) sequenced(fn func(tx *gorm.DB) error) error {
+	if !d.dialect.rowLocks() {
+		d.sequenceMu.Lock()
+		defer d.sequenceMu.Unlock()
 	}
-	return d.DB.AutoMigrate(
-		&models.Tenant{},
-		&models.Event{},
-		&models.Webhook{},
-	)
+	return d.DB.Transaction(fn)
+}
+
+// IsUniqueViolation reports whether err is a violation of a unique index
+func (d *Database) IsUniqueViolation(err error) bool {
+	return d.dialect.isUniqueViolation(err)
+}
+
+// batchSize caps rows per INSERT so a statement of columns per row stays
+// within the driver's bind parameter limit
+func (d *Database) batchSize(rows, columns int) int {
+	return max(1, min(rows, d.dialect.maxParams()/columns))
 }
 
 // Close closes the database connection
@@ -103,6 +372,45 @@ func (d *Database) CreateTenant(tenant *models.Tenant) error {
 	return d.DB.Create(tenant).Error
 }
 
+// CreateTenants creates tenants in a single transaction, all or none
+func (d *Database) CreateTenants(tenants []models.Tenant) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(tenants, 100).Error
+	})
+}
+
+// FindTenantIDs returns which of ids are tenants that exist
+func (d *Database) FindTenantIDs(ids []string) (map[string]bool, error) {
+	found := make(map[string]bool)
+	if len(ids) == 0 {
+		return found, nil
+	}
+	var existing []string
+	if err := d.DB.Model(&models.Tenant{}).Where("id IN ?", ids).Pluck("id", &existing).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range existing {
+		found[id] = true
+	}
+	return found, nil
+}
+
+// FindTenantNames returns which of names existing tenants already have
+func (d *Database) FindTenantNames(names []string) (map[string]bool, error) {
+	taken := make(map[string]bool)
+	if len(names) == 0 {
+		return taken, nil
+	}
+	var found []string
+	if err := d.DB.Model(&models.Tenant{}).Where("name IN ?", names).Pluck("name", &found).Error; err != nil {
+		return nil, err
+	}
+	for _, name := range found {
+		taken[name] = true
+	}
+	return taken, nil
+}
+
 // GetTenantByID retrieves a tenant by ID
 func (d *Database) GetTenantByID(id string) (*models.Tenant, error) {
 	var tenant models.Tenant
@@ -133,6 +441,124 @@ func (d *Database) GetTenantByName(name string) (*models.Tenant, error) {
 	return &tenant, nil
 }
 
+// RotateTenantAPIKey replaces a tenant's API key
+func (d *Database) RotateTenantAPIKey(id, apiKey string) error {
+	result := d.DB.Model(&models.Tenant{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"api_key": apiKey, "version": bumpVersion})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateTenantSettings replaces a tenant's settings JSON and returns the
+// tenant's new version. With a version other than 0 it only does so while
+// the tenant is at that version, and returns a *StaleVersionError otherwise.
+func (d *Database) UpdateTenantSettings(id, settings string, version int64) (int64, error) {
+	var updated []int64
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.Tenant{}).Where("id = ?", id)
+		if version != 0 {
+			query = query.Where("version = ?", version)
+		}
+		result := query.Updates(map[string]interface{}{"settings": settings, "version": bumpVersion})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return checkVersion(tx.Where("id = ?", id), &models.Tenant{})
+		}
+		return tx.Model(&models.Tenant{}).Where("id = ?", id).Pluck("version", &updated).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(updated) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return updated[0], nil
+}
+
+// SetTenantMute mutes a tenant's notifications since since, until until
+// when that is set, or unmutes them when muted is false. It does not bump
+// the tenant's version, as the mute is not part of its settings.
+func (d *Database) SetTenantMute(id string, muted bool, until, since *time.Time) (*models.Tenant, error) {
+	if !muted {
+		until, since = nil, nil
+	}
+	result := d.DB.Model(&models.Tenant{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"notifications_muted":       muted,
+		"notifications_muted_until": until,
+		"notifications_muted_at":    since,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return d.GetTenantByID(id)
+}
+
+// DeleteTenant deactivates and soft-deletes a tenant together with its
+// webhooks. The webhooks share the tenant's deletion time, which is how
+// RestoreTenant tells them apart from webhooks deleted earlier.
+func (d *Database) DeleteTenant(id string) error {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Tenant{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"active": false, "deleted_at": now, "version": bumpVersion})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.Webhook{}).Where("tenant_id = ?", id).Update("deleted_at", now).Error
+	})
+}
+
+// GetTenantByIDIncludingDeleted retrieves a tenant by ID, including a
+// soft-deleted one
+func (d *Database) GetTenantByIDIncludingDeleted(id string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	err := d.DB.Unscoped().First(&tenant, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// RestoreTenant undeletes and reactivates a soft-deleted tenant under a new
+// API key. With webhooks set, the webhooks deleted together with the tenant
+// are undeleted too; it returns how many.
+func (d *Database) RestoreTenant(tenant *models.Tenant, apiKey string, webhooks bool) (int64, error) {
+	var restored int64
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&models.Tenant{}).
+			Where("id = ? AND deleted_at IS NOT NULL", tenant.ID).
+			Updates(map[string]interface{}{"active": true, "api_key": apiKey, "deleted_at": nil, "version": bumpVersion})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if !webhooks {
+			return nil
+		}
+		result = tx.Unscoped().Model(&models.Webhook{}).
+			Where("tenant_id = ? AND deleted_at = ?", tenant.ID, tenant.DeletedAt.Time).
+			Update("deleted_at", nil)
+		restored = result.RowsAffected
+		return result.Error
+	})
+	return restored, err
+}
+
 // GetAllTenants retrieves all active tenants
 func (d *Database) GetAllTenants() ([]models.Tenant, error) {
 	var tenants []models.Tenant
@@ -140,79 +566,1967 @@ func (d *Database) GetAllTenants() ([]models.Tenant, error) {
 	return tenants, err
 }
 
+// RecordTenantAuth stores when tenants last authenticated, by tenant ID,
+// keeping later times another replica already stored
+func (d *Database) RecordTenantAuth(seen map[string]time.Time) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		for tenantID, at := range seen {
+			err := tx.Model(&models.Tenant{}).
+				Where("id = ? AND (last_auth_at IS NULL OR last_auth_at < ?)", tenantID, at).
+				UpdateColumn("last_auth_at", at).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListTenantActivity returns every tenant with when it last sent an event
+// and authenticated. It reads the newest event of each tenant, so it is
+// meant for occasional reviews rather than dashboards.
+func (d *Database) ListTenantActivity() ([]models.TenantActivitySummary, error) {
+	var tenants []models.Tenant
+	if err := d.DB.Select("id, name, active, created_at, last_auth_at").Find(&tenants).Error; err != nil {
+		return nil, err
+	}
+
+	var newest []struct {
+		TenantID string
+		ID       uint
+		Bytes    int64
+	}
+	err := d.DB.Unscoped().Model(&models.Event{}).Select("tenant_id, MAX(id) AS id, SUM(metadata_size) AS bytes").Group("tenant_id").Scan(&newest).Error
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(newest))
+	bytes := make(map[string]int64, len(newest))
+	for _, n := range newest {
+		ids = append(ids, n.ID)
+		bytes[n.TenantID] = n.Bytes
+	}
+	lastEvent := make(map[string]time.Time, len(ids))
+	for start := 0; start < len(ids); start += 1000 {
+		var events []models.Event
+		end := min(start+1000, len(ids))
+		if err := d.DB.Unscoped().Select("tenant_id, created_at").Where("id IN ?", ids[start:end]).Find(&events).Error; err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			lastEvent[event.TenantID] = event.CreatedAt
+		}
+	}
+
+	summaries := make([]models.TenantActivitySummary, 0, len(tenants))
+	for _, tenant := range tenants {
+		summary := models.TenantActivitySummary{
+			TenantID:      tenant.ID,
+			Name:          tenant.Name,
+			Active:        tenant.Active,
+			CreatedAt:     tenant.CreatedAt,
+			LastAuthAt:    tenant.LastAuthAt,
+			MetadataBytes: bytes[tenant.ID],
+		}
+		if at, ok := lastEvent[tenant.ID]; ok {
+			summary.LastEventAt = &at
+		}
+		summary.LastActiveAt = summary.LastAuthAt
+		if summary.LastEventAt != nil && (summary.LastActiveAt == nil || summary.LastEventAt.After(*summary.LastActiveAt)) {
+			summary.LastActiveAt = summary.LastEventAt
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// CreateUser creates a tenant's user
+func (d *Database) CreateUser(user *models.User) error {
+	return d.DB.Create(user).Error
+}
+
+// ListUsers retrieves a tenant's users ordered by email
+func (d *Database) ListUsers(tenantID string) ([]models.User, error) {
+	var users []models.User
+	err := d.DB.Where("tenant_id = ?", tenantID).Order("email").Find(&users).Error
+	return users, err
+}
+
+// GetUser retrieves a user of a tenant by ID
+func (d *Database) GetUser(tenantID string, id uint) (*models.User, error) {
+	var user models.User
+	err := d.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user of a tenant by email
+func (d *Database) GetUserByEmail(tenantID, email string) (*models.User, error) {
+	var user models.User
+	err := d.DB.Where("tenant_id = ? AND email = ?", tenantID, email).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserBySSOSubject retrieves a user of a tenant by their identity
+// provider subject
+func (d *Database) GetUserBySSOSubject(tenantID, subject string) (*models.User, error) {
+	var user models.User
+	err := d.DB.Where("tenant_id = ? AND sso_subject = ?", tenantID, subject).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindUsersByEmail retrieves the users with an email across all tenants
+func (d *Database) FindUsersByEmail(email string) ([]models.User, error) {
+	var users []models.User
+	err := d.DB.Where("email = ?", email).Order("id").Find(&users).Error
+	return users, err
+}
+
+// UpdateUser saves a user's credentials, role and active flag
+func (d *Database) UpdateUser(user *models.User) error {
+	return d.DB.Model(user).Select("password_hash", "sso_subject", "role", "active", "updated_at").Updates(user).Error
+}
+
+// RecordUserLogin stores when a user last signed in
+func (d *Database) RecordUserLogin(id uint, at time.Time) error {
+	return d.DB.Model(&models.User{}).Where("id = ?", id).UpdateColumn("last_login_at", at).Error
+}
+
+// DeleteUser removes a tenant's user
+func (d *Database) DeleteUser(tenantID string, id uint) error {
+	result := d.DB.Where("tenant_id = ? AND id = ?", tenantID, id).Delete(&models.User{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
 // CreateEvent creates a new event
 func (d *Database) CreateEvent(event *models.Event) error {
-	return d.DB.Create(event).Error
+	defer d.prepareMetadata(event)()
+	return d.sequencedEvents([]*models.Event{event}, func(tx *gorm.DB) error {
+		return createEvent(tx, d.dialect, event)
+	})
 }
 
-// GetEventsByTenant retrieves events for a tenant with pagination
-func (d *Database) GetEventsByTenant(tenantID string, limit, offset int) ([]models.Event, error) {
-	var events []models.Event
-	err := d.DB.Where("tenant_id = ?", tenantID).
-		Order("timestamp DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&events).Error
-	return events, err
+// CreateEventSynchronous creates an event like CreateEvent, except that the
+// commit waits until it is durable whatever the server default, as for
+// synchronous_commit=on on PostgreSQL
+func (d *Database) CreateEventSynchronous(event *models.Event) error {
+	defer d.prepareMetadata(event)()
+	return d.sequencedEvents([]*models.Event{event}, func(tx *gorm.DB) error {
+		if sql := d.dialect.synchronousCommit(); sql != "" {
+			if err := tx.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+		return createEvent(tx, d.dialect, event)
+	})
 }
 
-// GetEventsByTenantAndType retrieves events for a tenant filtered by event type
-func (d *Database) GetEventsByTenantAndType(tenantID, eventType string, limit, offset int) ([]models.Event, error) {
-	var events []models.Event
-	err := d.DB.Where("tenant_id = ? AND event_type = ?", tenantID, eventType).
-		Order("timestamp DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&events).Error
-	return events, err
+func createEvent(tx *gorm.DB, dialect dialect, event *models.Event) error {
+	first, err := reserveSequences(tx, dialect, event.TenantID, 1)
+	if err != nil {
+		return err
+	}
+	event.Sequence = first
+	return tx.Create(event).Error
 }
 
-// SearchEventsByMetadata searches events by metadata content (basic LIKE search)
-func (d *Database) SearchEventsByMetadata(tenantID, query string, limit, offset int) ([]models.Event, error) {
-	var events []models.Event
-	err := d.DB.Where("tenant_id = ? AND metadata LIKE ?", tenantID, "%"+query+"%").
-		Order("timestamp DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&events).Error
-	return events, err
+// eventColumns is the most columns an event INSERT binds per row: every
+// column of the model, so it follows columns as they are added
+var eventColumns = func() int {
+	s, err := schema.Parse(&models.Event{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		panic(err)
+	}
+	return len(s.DBNames)
+}()
+
+// CreateEvents inserts events in a single transaction, at most batchSize
+// rows per statement. Each tenant's events get a contiguous range of
+// sequence numbers in slice order. Callers bypass ingestion, so nothing is
+// broadcast.
+func (d *Database) CreateEvents(events []models.Event, batchSize int) error {
+	return d.createEvents(events, batchSize, false)
 }
 
-// GetEventStats retrieves event statistics for a tenant
-func (d *Database) GetEventStats(tenantID string) (map[string]int64, error) {
-	stats := make(map[string]int64)
+// CreateEventsSynchronous inserts events like CreateEvents, except that the
+// commit waits until it is durable whatever the server default
+func (d *Database) CreateEventsSynchronous(events []models.Event, batchSize int) error {
+	return d.createEvents(events, batchSize, true)
+}
 
-	// Total count
-	var total int64
-	d.DB.Model(&models.Event{}).Where("tenant_id = ?", tenantID).Count(&total)
-	stats["total"] = total
+func (d *Database) createEvents(events []models.Event, batchSize int, synchronous bool) error {
+	counts := make(map[string]int)
+	for _, e := range events {
+		counts[e.TenantID]++
+	}
+	// Lock counters in a fixed order so concurrent batches cannot deadlock
+	tenantIDs := make([]string, 0, len(counts))
+	for tenantID := range counts {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
 
-	// Count by event type
-	var results []struct {
-		EventType string
-		Count     int64
+	stored := make([]*models.Event, len(events))
+	for i := range events {
+		stored[i] = &events[i]
 	}
-	d.DB.Model(&models.Event{}).
-		Select("event_type, COUNT(*) as count").
-		Where("tenant_id = ?", tenantID).
-		Group("event_type").
-		Find(&results)
+	defer d.prepareMetadata(stored...)()
 
-	for _, r := range results {
-		stats[r.EventType] = r.Count
+	return d.sequencedEvents(stored, func(tx *gorm.DB) error {
+		if sql := d.dialect.synchronousCommit(); synchronous && sql != "" {
+			if err := tx.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+		next := make(map[string]uint64, len(tenantIDs))
+		for _, tenantID := range tenantIDs {
+			first, err := reserveSequences(tx, d.dialect, tenantID, counts[tenantID])
+			if err != nil {
+				return err
+			}
+			next[tenantID] = first
+		}
+		for i := range events {
+			events[i].Sequence = next[events[i].TenantID]
+			next[events[i].TenantID]++
+		}
+		return tx.CreateInBatches(events, d.batchSize(batchSize, eventColumns)).Error
+	})
+}
+
+// GetEvent retrieves one of a tenant's events
+func (d *Database) GetEvent(tenantID string, id uint) (*models.Event, error) {
+	var event models.Event
+	err := d.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&event).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := event.DecompressMetadata(); err != nil {
+		return nil, err
 	}
+	return &event, nil
+}
 
-	return stats, nil
+// EventFilter narrows an event query to one tenant; other zero values are
+// ignored
+type EventFilter struct {
+	TenantID string
+	// EventTypes selects events by type, prefix or exclusion, as
+	// eventtype patterns
+	EventTypes []string
+	// Sources selects events from any of the sources
+	Sources []string
+	// CorrelationID selects the events of one workflow
+	CorrelationID string
+	// Tags selects events whose metadata "tags" array holds every tag
+	Tags []string
+	// Since and Until bound the event timestamp, Until exclusively
+	Since *time.Time
+	Until *time.Time
+	// Search matches metadata containing the text (basic LIKE search). Like
+	// Tags, it skips redacted events, and fails with ErrCompressedMetadata
+	// when any event it would look at has its metadata stored compressed.
+	Search string
+	// Processed, when set, selects acknowledged or unacknowledged events
+	Processed *bool
+	// ExcludeSystem leaves out the events the service wrote itself
+	ExcludeSystem bool
+	// Oldest orders events oldest first instead of newest first
+	Oldest bool
+	Limit  int
+	Offset int
 }
 
-// CreateWebhook creates a new webhook
-func (d *Database) CreateWebhook(webhook *models.Webhook) error {
-	return d.DB.Create(webhook).Error
+// GetEvents retrieves events matching a filter, newest first unless
+// filter.Oldest is set. Like the other event searches, it gives up after the
+// query timeout with ErrQueryTimeout.
+func (d *Database) GetEvents(filter EventFilter) ([]models.Event, error) {
+	order := "timestamp DESC"
+	if filter.Oldest {
+		order = "timestamp ASC"
+	}
+
+	var events []models.Event
+	err := d.bounded(func(db *gorm.DB) error {
+		if err := d.searchable(db, filter); err != nil {
+			return err
+		}
+		return d.eventQuery(db, filter).Order(order).
+			Limit(filter.Limit).
+			Offset(filter.Offset).
+			Find(&events).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, decompressMetadata(events)
 }
 
-// GetWebhooksByTenant retrieves webhooks for a tenant
-func (d *Database) GetWebhooksByTenant(tenantID string) ([]models.Webhook, error) {
-	var webhooks []models.Webhook
-	err := d.DB.Where("tenant_id = ? AND active = ?", tenantID, true).Find(&webhooks).Error
-	return webhooks, err
+// CountEventsByType counts the events matching a filter per event type;
+// Limit, Offset and Oldest are ignored
+func (d *Database) CountEventsByType(filter EventFilter) (map[string]int64, error) {
+	var rows []struct {
+		EventType string
+		Count     int64
+	}
+	err := d.bounded(func(db *gorm.DB) error {
+		if err := d.searchable(db, filter); err != nil {
+			return err
+		}
+		return d.eventQuery(db, filter).Model(&models.Event{}).
+			Select("event_type, COUNT(*) as count").
+			Group("event_type").
+			Scan(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.EventType] = row.Count
+	}
+	return counts, nil
+}
+
+// CountEvents counts the events matching a filter; Limit, Offset and
+// Oldest are ignored
+func (d *Database) CountEvents(filter EventFilter) (int64, error) {
+	var count int64
+	err := d.bounded(func(db *gorm.DB) error {
+		if err := d.searchable(db, filter); err != nil {
+			return err
+		}
+		return d.eventQuery(db, filter).Model(&models.Event{}).Count(&count).Error
+	})
+	return count, err
+}
+
+// CountEventsBySource counts a tenant's events per source; events sent
+// without one are not counted
+func (d *Database) CountEventsBySource(tenantID string) (map[string]int64, error) {
+	var rows []struct {
+		Source string
+		Count  int64
+	}
+	err := d.bounded(func(db *gorm.DB) error {
+		return db.Model(&models.Event{}).
+			Select("source, COUNT(*) as count").
+			Where("tenant_id = ? AND source <> ''", tenantID).
+			Group("source").
+			Scan(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Source] = row.Count
+	}
+	return counts, nil
+}
+
+// GetLatestEventTime returns the timestamp of a tenant's newest event of a
+// type, or nil when it has none
+func (d *Database) GetLatestEventTime(tenantID, eventType string) (*time.Time, error) {
+	var events []models.Event
+	err := d.DB.Select("timestamp").
+		Where("tenant_id = ? AND event_type = ?", tenantID, eventType).
+		Order("timestamp DESC").
+		Limit(1).
+		Find(&events).Error
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return &events[0].Timestamp, nil
+}
+
+// eventQuery applies the conditions of a filter to db
+func (d *Database) eventQuery(db *gorm.DB, filter EventFilter) *gorm.DB {
+	query := db.Where("tenant_id = ?", filter.TenantID)
+	query = eventTypeQuery(query, eventtype.Compile(filter.EventTypes))
+	if len(filter.Sources) > 0 {
+		query = query.Where("source IN ?", filter.Sources)
+	}
+	if filter.CorrelationID != "" {
+		query = query.Where("correlation_id = ?", filter.CorrelationID)
+	}
+	for _, tag := range filter.Tags {
+		query = query.Where(d.dialect.jsonArrayContains("metadata", "tags"), tag)
+	}
+	if filter.Since != nil {
+		query = query.Where("timestamp >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("timestamp < ?", *filter.Until)
+	}
+	if filter.Search != "" {
+		query = query.Where("metadata LIKE ?", "%"+filter.Search+"%")
+	}
+	if filter.Search != "" || len(filter.Tags) > 0 {
+		// What is left of a redacted event's metadata is not searchable
+		query = query.Where("redacted_at IS NULL")
+	}
+	if filter.Processed != nil {
+		if *filter.Processed {
+			query = query.Where("processed_at IS NOT NULL")
+		} else {
+			query = query.Where("processed_at IS NULL")
+		}
+	}
+	if filter.ExcludeSystem {
+		query = query.Where("is_system = ?", false)
+	}
+	return query
+}
+
+// MarkEventsProcessed sets ProcessedAt on the tenant's events among ids.
+// It returns the IDs it marked and the IDs that were already processed; any
+// other ID does not exist or belongs to another tenant.
+func (d *Database) MarkEventsProcessed(tenantID string, ids []uint, at time.Time) (marked, already []uint, err error) {
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		var rows []models.Event
+		if err := tx.Select("id", "processed_at").
+			Where("tenant_id = ? AND id IN ?", tenantID, ids).
+			Find(&rows).Error; err != nil {
+			return err
+		}
+
+		marked, already = nil, nil
+		for _, row := range rows {
+			if row.ProcessedAt != nil {
+				already = append(already, row.ID)
+			} else {
+				marked = append(marked, row.ID)
+			}
+		}
+		if len(marked) == 0 {
+			return nil
+		}
+		return tx.Model(&models.Event{}).
+			Where("tenant_id = ? AND id IN ? AND processed_at IS NULL", tenantID, marked).
+			Update("processed_at", at).Error
+	})
+	return marked, already, err
+}
+
+// MarkEventsProcessedUpTo sets ProcessedAt on every unprocessed event of the
+// tenant with an ID up to and including upTo, and returns how many
+func (d *Database) MarkEventsProcessedUpTo(tenantID string, upTo uint, at time.Time) (int64, error) {
+	result := d.DB.Model(&models.Event{}).
+		Where("tenant_id = ? AND id <= ? AND processed_at IS NULL", tenantID, upTo).
+		Update("processed_at", at)
+	return result.RowsAffected, result.Error
+}
+
+// CountUnprocessedEvents counts the tenant's events that have not been
+// acknowledged
+func (d *Database) CountUnprocessedEvents(tenantID string) (int64, error) {
+	var count int64
+	err := d.DB.Model(&models.Event{}).
+		Where("tenant_id = ? AND processed_at IS NULL", tenantID).
+		Count(&count).Error
+	return count, err
+}
+
+// GetEventStats retrieves event statistics for a tenant
+func (d *Database) GetEventStats(tenantID string) (map[string]int64, error) {
+	stats := make(map[string]int64)
+
+	// Total count
+	var total int64
+	d.DB.Model(&models.Event{}).Where("tenant_id = ?", tenantID).Count(&total)
+	stats["total"] = total
+
+	// Count by event type
+	var results []struct {
+		EventType string
+		Count     int64
+	}
+	d.DB.Model(&models.Event{}).
+		Select("event_type, COUNT(*) as count").
+		Where("tenant_id = ?", tenantID).
+		Group("event_type").
+		Find(&results)
+
+	for _, r := range results {
+		stats[r.EventType] = r.Count
+	}
+
+	return stats, nil
+}
+
+// GetEventSizeStats summarizes the metadata size of a tenant's events by
+// event type. Databases without a percentile aggregate find each
+// percentile with a query per type.
+func (d *Database) GetEventSizeStats(tenantID string) (map[string]models.EventSizeStats, error) {
+	columns := "event_type, COUNT(*) AS count, SUM(metadata_size) AS total, MAX(metadata_size) AS max"
+	p50, p95 := d.dialect.percentile("metadata_size", 0.5), d.dialect.percentile("metadata_size", 0.95)
+	if p50 != "" {
+		columns += ", " + p50 + " AS p50, " + p95 + " AS p95"
+	}
+	var rows []struct {
+		EventType            string
+		Count                int64
+		Total, Max, P50, P95 int64
+	}
+	err := d.DB.Model(&models.Event{}).
+		Select(columns).
+		Where("tenant_id = ?", tenantID).
+		Group("event_type").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]models.EventSizeStats, len(rows))
+	for _, r := range rows {
+		if p50 == "" {
+			if r.P50, err = d.eventSizeAt(tenantID, r.EventType, r.Count, 0.5); err != nil {
+				return nil, err
+			}
+			if r.P95, err = d.eventSizeAt(tenantID, r.EventType, r.Count, 0.95); err != nil {
+				return nil, err
+			}
+		}
+		stats[r.EventType] = models.EventSizeStats{P50: r.P50, P95: r.P95, Max: r.Max, Total: r.Total}
+	}
+	return stats, nil
+}
+
+// eventSizeAt returns the nearest-rank metadata size at fraction p of the
+// count events of a tenant's event type
+func (d *Database) eventSizeAt(tenantID, eventType string, count int64, p float64) (int64, error) {
+	rank := int(math.Ceil(p*float64(count))) - 1
+	var sizes []int64
+	err := d.DB.Model(&models.Event{}).
+		Where("tenant_id = ? AND event_type = ?", tenantID, eventType).
+		Order("metadata_size ASC").
+		Offset(max(rank, 0)).Limit(1).
+		Pluck("metadata_size", &sizes).Error
+	if err != nil || len(sizes) == 0 {
+		return 0, err
+	}
+	return sizes[0], nil
+}
+
+// AddSampledEventCounts adds to the counts of events kept from being
+// stored by sampling rules, by tenant ID and then event type
+func (d *Database) AddSampledEventCounts(counts map[string]map[string]int64) error {
+	now := time.Now().UTC()
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		for tenantID, types := range counts {
+			for eventType, n := range types {
+				err := tx.Clauses(clause.OnConflict{
+					Columns: []clause.Column{{Name: "tenant_id"}, {Name: "event_type"}},
+					DoUpdates: clause.Assignments(map[string]interface{}{
+						"count":      gorm.Expr("sampled_event_counts.count + ?", n),
+						"updated_at": now,
+					}),
+				}).Create(&models.SampledEventCount{TenantID: tenantID, EventType: eventType, Count: n, UpdatedAt: now}).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// GetSampledEventCounts returns the tenant's sampled-out events by type
+func (d *Database) GetSampledEventCounts(tenantID string) (map[string]int64, error) {
+	var rows []models.SampledEventCount
+	if err := d.DB.Where("tenant_id = ?", tenantID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.EventType] = row.Count
+	}
+	return counts, nil
+}
+
+// CountEventsCreatedSince counts the tenant's events created at or after
+// since, deleted ones included and system events left out
+func (d *Database) CountEventsCreatedSince(tenantID string, since time.Time) (int64, error) {
+	var count int64
+	err := d.DB.Unscoped().Model(&models.Event{}).Where("tenant_id = ? AND created_at >= ? AND is_system = ?", tenantID, since, false).Count(&count).Error
+	return count, err
+}
+
+// ClaimQuotaNotice records that the tenant is being told of reaching the
+// threshold of its quota in month. It reports false when it already was,
+// by this process or another.
+func (d *Database) ClaimQuotaNotice(tenantID, month string, threshold int) (bool, error) {
+	result := d.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.QuotaNotice{TenantID: tenantID, Month: month, Threshold: threshold})
+	return result.RowsAffected == 1, result.Error
+}
+
+// GetLastEventReceived returns when the tenant's newest event was
+// received, deleted ones included, or nil when it has none
+func (d *Database) GetLastEventReceived(tenantID string) (*time.Time, error) {
+	var events []models.Event
+	err := d.DB.Unscoped().Select("created_at").
+		Where("tenant_id = ?", tenantID).
+		Order("id DESC").
+		Limit(1).
+		Find(&events).Error
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return &events[0].CreatedAt, nil
+}
+
+// ErrOffsetBehind is returned when a commit would move a consumer's
+// checkpoint backwards
+var ErrOffsetBehind = errors.New("commit is behind the stored offset")
+
+// GetEventsAfter retrieves up to limit of the tenant's events with an ID
+// greater than afterID, oldest first
+func (d *Database) GetEventsAfter(tenantID string, afterID uint, limit int) ([]models.Event, error) {
+	var events []models.Event
+	err := d.bounded(func(db *gorm.DB) error {
+		return db.Where("tenant_id = ? AND id > ?", tenantID, afterID).
+			Order("id ASC").
+			Limit(limit).
+			Find(&events).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, decompressMetadata(events)
+}
+
+// GetEventsAfterSequence retrieves up to limit of the tenant's events with a
+// sequence number greater than after, in sequence order
+func (d *Database) GetEventsAfterSequence(tenantID string, after uint64, limit int) ([]models.Event, error) {
+	var events []models.Event
+	err := d.bounded(func(db *gorm.DB) error {
+		return db.Where("tenant_id = ? AND sequence > ?", tenantID, after).
+			Order("sequence ASC").
+			Limit(limit).
+			Find(&events).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, decompressMetadata(events)
+}
+
+// GetEventsCreatedBetween returns up to limit of the tenant's events
+// stored from from up to but excluding to, in sequence order
+func (d *Database) GetEventsCreatedBetween(tenantID string, from, to time.Time, limit int) ([]models.Event, error) {
+	var events []models.Event
+	err := d.bounded(func(db *gorm.DB) error {
+		return db.Where("tenant_id = ? AND created_at >= ? AND created_at < ?", tenantID, from, to).
+			Order("sequence ASC").
+			Limit(limit).
+			Find(&events).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, decompressMetadata(events)
+}
+
+// CountEventsAfter counts the tenant's events with an ID greater than afterID
+func (d *Database) CountEventsAfter(tenantID string, afterID uint) (int64, error) {
+	var count int64
+	err := d.DB.Model(&models.Event{}).
+		Where("tenant_id = ? AND id > ?", tenantID, afterID).
+		Count(&count).Error
+	return count, err
+}
+
+// GetLatestEventID returns the highest event ID of a tenant, or 0 when it
+// has no events
+func (d *Database) GetLatestEventID(tenantID string) (uint, error) {
+	var id *uint
+	err := d.DB.Model(&models.Event{}).
+		Select("MAX(id)").
+		Where("tenant_id = ?", tenantID).
+		Scan(&id).Error
+	if err != nil || id == nil {
+		return 0, err
+	}
+	return *id, nil
+}
+
+// GetConsumerOffset retrieves a consumer's checkpoint. A consumer that has
+// never committed is at offset 0.
+func (d *Database) GetConsumerOffset(tenantID, name string) (*models.ConsumerOffset, error) {
+	var offset models.ConsumerOffset
+	err := d.DB.Where("tenant_id = ? AND consumer_name = ?", tenantID, name).First(&offset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.ConsumerOffset{TenantID: tenantID, ConsumerName: name}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &offset, nil
+}
+
+// ListConsumerOffsets retrieves every consumer checkpoint of a tenant
+func (d *Database) ListConsumerOffsets(tenantID string) ([]models.ConsumerOffset, error) {
+	var offsets []models.ConsumerOffset
+	err := d.DB.Where("tenant_id = ?", tenantID).Order("consumer_name").Find(&offsets).Error
+	return offsets, err
+}
+
+// CommitConsumerOffset moves a consumer's checkpoint to lastEventID,
+// creating it on first commit. Unless force is set, a commit behind the
+// stored offset fails with ErrOffsetBehind and the stored offset is
+// returned; committing the same offset again succeeds. The check and the
+// write are one statement, so concurrent commits cannot move it backwards.
+func (d *Database) CommitConsumerOffset(tenantID, name string, lastEventID uint, force bool) (*models.ConsumerOffset, error) {
+	update := func() (bool, error) {
+		query := d.DB.Model(&models.ConsumerOffset{}).
+			Where("tenant_id = ? AND consumer_name = ?", tenantID, name)
+		if !force {
+			query = query.Where("last_event_id <= ?", lastEventID)
+		}
+		result := query.Update("last_event_id", lastEventID)
+		return result.RowsAffected > 0, result.Error
+	}
+
+	// Update first, then insert; when a concurrent first commit wins the
+	// insert, the update is retried against its row
+	for attempt := 0; attempt < 2; attempt++ {
+		updated, err := update()
+		if err != nil {
+			return nil, err
+		}
+		if updated {
+			return d.GetConsumerOffset(tenantID, name)
+		}
+
+		var current models.ConsumerOffset
+		err = d.DB.Where("tenant_id = ? AND consumer_name = ?", tenantID, name).First(&current).Error
+		if err == nil {
+			return &current, ErrOffsetBehind
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		offset := &models.ConsumerOffset{TenantID: tenantID, ConsumerName: name, LastEventID: lastEventID}
+		result := d.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(offset)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return offset, nil
+		}
+	}
+	return nil, fmt.Errorf("commit offset of consumer %q: lost a concurrent update", name)
+}
+
+// CreateSavedView creates a saved view
+func (d *Database) CreateSavedView(view *models.SavedView) error {
+	return d.DB.Create(view).Error
+}
+
+// ListSavedViews retrieves a tenant's saved views ordered by name
+func (d *Database) ListSavedViews(tenantID string) ([]models.SavedView, error) {
+	var views []models.SavedView
+	err := d.DB.Where("tenant_id = ?", tenantID).Order("name").Find(&views).Error
+	return views, err
+}
+
+// GetSavedView retrieves a tenant's saved view by ID
+func (d *Database) GetSavedView(tenantID string, id uint) (*models.SavedView, error) {
+	var view models.SavedView
+	err := d.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&view).Error
+	if err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// GetSavedViewByName retrieves a tenant's saved view by name
+func (d *Database) GetSavedViewByName(tenantID, name string) (*models.SavedView, error) {
+	var view models.SavedView
+	err := d.DB.Where("tenant_id = ? AND name = ?", tenantID, name).First(&view).Error
+	if err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// UpdateSavedView replaces the name and filter of a saved view
+func (d *Database) UpdateSavedView(view *models.SavedView) error {
+	return d.DB.Model(view).Select("name", "filter", "updated_at").Updates(view).Error
+}
+
+// DeleteSavedView removes a tenant's saved view
+func (d *Database) DeleteSavedView(tenantID string, id uint) error {
+	result := d.DB.Where("tenant_id = ? AND id = ?", tenantID, id).Delete(&models.SavedView{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CreateReport creates a report
+func (d *Database) CreateReport(report *models.Report) error {
+	return d.DB.Create(report).Error
+}
+
+// ListReports retrieves a tenant's reports
+func (d *Database) ListReports(tenantID string) ([]models.Report, error) {
+	var reports []models.Report
+	err := d.DB.Where("tenant_id = ?", tenantID).Order("id").Find(&reports).Error
+	return reports, err
+}
+
+// GetReport retrieves a report owned by a tenant
+func (d *Database) GetReport(tenantID string, id uint) (*models.Report, error) {
+	var report models.Report
+	err := d.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&report).Error
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// UpdateReport replaces a report's definition and next run
+func (d *Database) UpdateReport(report *models.Report) error {
+	return d.DB.Model(report).
+		Select("name", "schedule", "webhook_id", "url", "secret", "filter", "format", "active", "next_run_at", "updated_at").
+		Updates(report).Error
+}
+
+// DeleteReport removes a report owned by a tenant
+func (d *Database) DeleteReport(tenantID string, id uint) error {
+	result := d.DB.Where("tenant_id = ? AND id = ?", tenantID, id).Delete(&models.Report{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetDueReports retrieves active reports whose next run is at or before
+// now, earliest first
+func (d *Database) GetDueReports(now time.Time, limit int) ([]models.Report, error) {
+	var reports []models.Report
+	err := d.DB.Where("active = ? AND next_run_at <= ?", true, now).
+		Order("next_run_at").
+		Limit(limit).
+		Find(&reports).Error
+	return reports, err
+}
+
+// ClaimReportRun moves a report's next run from due to next. It reports
+// false when the run was already claimed, by another replica or because the
+// report changed since it was read.
+func (d *Database) ClaimReportRun(id uint, due, next time.Time) (bool, error) {
+	result := d.DB.Model(&models.Report{}).
+		Where("id = ? AND next_run_at = ?", id, due).
+		Update("next_run_at", next)
+	return result.RowsAffected == 1, result.Error
+}
+
+// AcquireLease takes or renews the named lease for holder until expires. It
+// reports false while another holder's lease has not expired at now.
+func (d *Database) AcquireLease(name, holder string, now, expires time.Time) (bool, error) {
+	result := d.DB.Model(&models.Lease{}).
+		Where("name = ? AND (holder = ? OR expires_at <= ?)", name, holder, now).
+		Updates(map[string]interface{}{"holder": holder, "expires_at": expires})
+	if result.Error != nil || result.RowsAffected == 1 {
+		return result.RowsAffected == 1, result.Error
+	}
+
+	// No row yet, or another holder's; the insert loses to a concurrent one
+	result = d.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.Lease{Name: name, Holder: holder, ExpiresAt: expires})
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReleaseLease gives up the named lease if holder has it, so another can
+// take it without waiting for it to expire
+func (d *Database) ReleaseLease(name, holder string) error {
+	return d.DB.Where("name = ? AND holder = ?", name, holder).Delete(&models.Lease{}).Error
+}
+
+// GetLease returns the named lease, or nil when no one has taken it
+func (d *Database) GetLease(name string) (*models.Lease, error) {
+	var lease models.Lease
+	err := d.DB.Where("name = ?", name).First(&lease).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// RecordReportRun stores the outcome of a report run
+func (d *Database) RecordReportRun(id uint, at time.Time, status, cause string) error {
+	return d.DB.Model(&models.Report{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_run_at": at,
+		"last_status": status,
+		"last_error":  cause,
+	}).Error
+}
+
+// CreateAlertRule creates an alert rule
+func (d *Database) CreateAlertRule(rule *models.AlertRule) error {
+	return d.DB.Create(rule).Error
+}
+
+// ListAlertRules retrieves a tenant's alert rules
+func (d *Database) ListAlertRules(tenantID string) ([]models.AlertRule, error) {
+	var rules []models.AlertRule
+	err := d.DB.Where("tenant_id = ?", tenantID).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// GetAlertRule retrieves an alert rule owned by a tenant
+func (d *Database) GetAlertRule(tenantID string, id uint) (*models.AlertRule, error) {
+	var rule models.AlertRule
+	err := d.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&rule).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// UpdateAlertRule replaces an alert rule's definition and state
+func (d *Database) UpdateAlertRule(rule *models.AlertRule) error {
+	return d.DB.Model(rule).
+		Select("name", "condition", "event_type", "time_window", "threshold", "metadata_match", "webhook_id", "url", "secret",
+			"renotify_after", "active", "state", "state_since", "updated_at").
+		Updates(rule).Error
+}
+
+// DeleteAlertRule removes an alert rule owned by a tenant, with its history
+func (d *Database) DeleteAlertRule(tenantID string, id uint) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("tenant_id = ? AND id = ?", tenantID, id).Delete(&models.AlertRule{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("rule_id = ?", id).Delete(&models.AlertHistory{}).Error
+	})
+}
+
+// GetActiveAlertRules retrieves every tenant's active alert rules
+func (d *Database) GetActiveAlertRules() ([]models.AlertRule, error) {
+	var rules []models.AlertRule
+	err := d.DB.Where("active = ?", true).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// RecordAlertEvaluation stores the value an alert rule was last evaluated to
+func (d *Database) RecordAlertEvaluation(id uint, at time.Time, value int64) error {
+	return d.DB.Model(&models.AlertRule{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"last_evaluated_at": at,
+		"last_value":        value,
+	}).Error
+}
+
+// ClaimAlertTransition moves an alert rule from one state to another and
+// marks it notified at. It reports false when the rule was no longer in the
+// from state, because another replica moved it or the rule was updated.
+func (d *Database) ClaimAlertTransition(id uint, from, to string, at time.Time) (bool, error) {
+	result := d.DB.Model(&models.AlertRule{}).
+		Where("id = ? AND state = ?", id, from).
+		UpdateColumns(map[string]interface{}{
+			"state":            to,
+			"state_since":      at,
+			"last_notified_at": at,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// ClaimAlertRenotify marks a firing alert rule notified again at. It reports
+// false when another replica already did.
+func (d *Database) ClaimAlertRenotify(id uint, last, at time.Time) (bool, error) {
+	result := d.DB.Model(&models.AlertRule{}).
+		Where("id = ? AND state = ? AND last_notified_at = ?", id, models.AlertFiring, last).
+		UpdateColumn("last_notified_at", at)
+	return result.RowsAffected == 1, result.Error
+}
+
+// CreateAlertHistory records an alert rule's state change
+func (d *Database) CreateAlertHistory(entry *models.AlertHistory) error {
+	return d.DB.Create(entry).Error
+}
+
+// RecordAlertDelivery stores why the notification of a state change failed
+func (d *Database) RecordAlertDelivery(id uint, cause string) error {
+	return d.DB.Model(&models.AlertHistory{}).Where("id = ?", id).UpdateColumn("delivery_error", cause).Error
+}
+
+// GetAlertHistory retrieves an alert rule's state changes, newest first
+func (d *Database) GetAlertHistory(tenantID string, ruleID uint, limit int) ([]models.AlertHistory, error) {
+	var history []models.AlertHistory
+	err := d.DB.Where("tenant_id = ? AND rule_id = ?", tenantID, ruleID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&history).Error
+	return history, err
+}
+
+// CreateImpersonation records a newly minted impersonation token
+func (d *Database) CreateImpersonation(imp *models.Impersonation) error {
+	return d.DB.Create(imp).Error
+}
+
+// GetImpersonation retrieves an impersonation by its token ID
+func (d *Database) GetImpersonation(id string) (*models.Impersonation, error) {
+	var imp models.Impersonation
+	err := d.DB.Where("id = ?", id).First(&imp).Error
+	if err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
+// ListImpersonations retrieves impersonations, newest first, optionally of
+// one tenant and only those neither expired nor revoked
+func (d *Database) ListImpersonations(tenantID string, activeOnly bool, limit int) ([]models.Impersonation, error) {
+	query := d.DB.Model(&models.Impersonation{})
+	if tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	if activeOnly {
+		query = query.Where("revoked_at IS NULL AND expires_at > ?", time.Now().UTC())
+	}
+
+	var imps []models.Impersonation
+	err := query.Order("created_at DESC").Limit(limit).Find(&imps).Error
+	return imps, err
+}
+
+// RevokeImpersonation revokes an impersonation token. Revoking one twice
+// keeps the first time.
+func (d *Database) RevokeImpersonation(id string, at time.Time) (*models.Impersonation, error) {
+	result := d.DB.Model(&models.Impersonation{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		UpdateColumn("revoked_at", at)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return d.GetImpersonation(id)
+}
+
+// CreateExportJob queues an export unless the tenant already has one pending
+// or running, which is returned instead. The unique index on
+// active_tenant_id settles concurrent requests.
+func (d *Database) CreateExportJob(job *models.ExportJob) (*models.ExportJob, error) {
+	if active, err := d.GetActiveExportJob(job.TenantID); err != nil || active != nil {
+		return active, err
+	}
+	job.Status = models.JobPending
+	job.ActiveTenantID = &job.TenantID
+	if err := d.DB.Create(job).Error; err != nil {
+		if active, findErr := d.GetActiveExportJob(job.TenantID); findErr == nil && active != nil {
+			return active, nil
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+// GetActiveExportJob retrieves the tenant's pending or running export; nil
+// when there is none
+func (d *Database) GetActiveExportJob(tenantID string) (*models.ExportJob, error) {
+	var jobs []models.ExportJob
+	err := d.DB.Where("active_tenant_id = ?", tenantID).Limit(1).Find(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// GetExportJob retrieves a tenant's export job by ID
+func (d *Database) GetExportJob(tenantID, id string) (*models.ExportJob, error) {
+	var job models.ExportJob
+	err := d.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FinishExportJob records the outcome of a running attempt: completed or
+// failed, which frees the tenant for another export, or pending to be
+// retried. Outcomes of attempts that were taken over are ignored.
+func (d *Database) FinishExportJob(job *models.ExportJob, at time.Time) error {
+	updates := map[string]interface{}{
+		"status":       job.Status,
+		"error":        job.Error,
+		"object_key":   job.ObjectKey,
+		"size":         job.Size,
+		"event_count":  job.EventCount,
+		"heartbeat_at": nil,
+	}
+	if job.Status != models.JobPending {
+		updates["active_tenant_id"] = nil
+		updates["completed_at"] = at
+	}
+	return d.DB.Model(&models.ExportJob{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, models.JobRunning, job.Attempts).
+		Updates(updates).Error
+}
+
+// SaveExportPart records a stored part of an export's archive, replacing
+// one a taken-over attempt stored under the same number
+func (d *Database) SaveExportPart(part *models.ExportPart) error {
+	return d.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(part).Error
+}
+
+// ListExportParts retrieves the stored parts of an export's archive in
+// order
+func (d *Database) ListExportParts(jobID string) ([]models.ExportPart, error) {
+	var parts []models.ExportPart
+	err := d.DB.Where("job_id = ?", jobID).Order("number").Find(&parts).Error
+	return parts, err
+}
+
+// CreateImportJob queues an import
+func (d *Database) CreateImportJob(job *models.ImportJob) error {
+	job.Status = models.JobPending
+	return d.DB.Create(job).Error
+}
+
+// GetImportJob retrieves an import job by ID
+func (d *Database) GetImportJob(id string) (*models.ImportJob, error) {
+	var job models.ImportJob
+	err := d.DB.Where("id = ?", id).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// TenantHasData reports whether a tenant has events, including deleted
+// ones, webhooks, saved views or an unfinished import
+func (d *Database) TenantHasData(tenantID string) (bool, error) {
+	checks := []*gorm.DB{
+		d.DB.Unscoped().Model(&models.Event{}).Where("tenant_id = ?", tenantID),
+		d.DB.Model(&models.Webhook{}).Where("tenant_id = ?", tenantID),
+		d.DB.Model(&models.SavedView{}).Where("tenant_id = ?", tenantID),
+		d.DB.Model(&models.ImportJob{}).Where("tenant_id = ? AND status IN ?", tenantID, []string{models.JobPending, models.JobRunning}),
+	}
+	for _, query := range checks {
+		var ids []interface{}
+		if err := query.Limit(1).Pluck("tenant_id", &ids).Error; err != nil {
+			return false, err
+		}
+		if len(ids) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FinishImportJob records that a running attempt of an import completed,
+// failed, or is pending to be retried. Outcomes of attempts that were
+// taken over are ignored.
+func (d *Database) FinishImportJob(job *models.ImportJob, at time.Time) error {
+	updates := map[string]interface{}{
+		"status":       job.Status,
+		"error":        job.Error,
+		"heartbeat_at": nil,
+	}
+	if job.Status != models.JobPending {
+		updates["completed_at"] = at
+	}
+	return d.DB.Model(&models.ImportJob{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, models.JobRunning, job.Attempts).
+		Updates(updates).Error
+}
+
+// ResumeImportJob queues a failed import again, to carry on after the
+// lines it committed. It reports false when the job has not failed.
+func (d *Database) ResumeImportJob(id string) (bool, error) {
+	result := d.DB.Model(&models.ImportJob{}).
+		Where("id = ? AND status = ?", id, models.JobFailed).
+		Updates(map[string]interface{}{
+			"status":       models.JobPending,
+			"attempts":     0,
+			"error":        "",
+			"completed_at": nil,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// ErrJobTakenOver is returned when a job's attempt no longer holds it
+var ErrJobTakenOver = errors.New("job was taken over by another worker")
+
+// maxImportConflicts bounds the conflicts an import job logs; the rest are
+// only counted
+const maxImportConflicts = 100
+
+// ImportItem is a record of an archive line to import; exactly one of its
+// fields besides Line is set. Invalid describes a line that cannot be
+// imported, to be logged as a conflict.
+type ImportItem struct {
+	Line    int64
+	Event   *models.Event
+	View    *models.SavedView
+	Webhook *models.Webhook
+	Invalid string
+}
+
+// ImportBatch commits items to the job's tenant together with the job's
+// progress up to line lines, all or none. Events keep their sequence
+// numbers, and the tenant's counter is moved past them; webhooks are left
+// inactive. An event whose sequence the tenant already has, or a view whose
+// name it already has, is skipped as a conflict. The job's counters are
+// updated in place.
+func (d *Database) ImportBatch(job *models.ImportJob, lines int64, items []ImportItem) ([]models.ImportConflict, error) {
+	var conflicts []models.ImportConflict
+	conflict := func(line int64, kind, reason string) {
+		conflicts = append(conflicts, models.ImportConflict{Line: line, Type: kind, Reason: reason})
+	}
+
+	var sequences []uint64
+	var names, webhookNames []string
+	for _, item := range items {
+		switch {
+		case item.Event != nil:
+			sequences = append(sequences, item.Event.Sequence)
+		case item.View != nil:
+			names = append(names, item.View.Name)
+		case item.Webhook != nil && item.Webhook.Name != nil:
+			webhookNames = append(webhookNames, *item.Webhook.Name)
+		}
+	}
+
+	var imported int64
+	err := d.sequenced(func(tx *gorm.DB) error {
+		taken := make(map[uint64]bool)
+		takenNames := make(map[string]bool)
+		takenWebhookNames := make(map[string]bool)
+		if len(sequences) > 0 {
+			var existing []uint64
+			if err := tx.Unscoped().Model(&models.Event{}).Where("tenant_id = ? AND sequence IN ?", job.TenantID, sequences).
+				Pluck("sequence", &existing).Error; err != nil {
+				return err
+			}
+			for _, seq := range existing {
+				taken[seq] = true
+			}
+		}
+		if len(names) > 0 {
+			var existing []string
+			if err := tx.Model(&models.SavedView{}).Where("tenant_id = ? AND name IN ?", job.TenantID, names).
+				Pluck("name", &existing).Error; err != nil {
+				return err
+			}
+			for _, name := range existing {
+				takenNames[name] = true
+			}
+		}
+		if len(webhookNames) > 0 {
+			var existing []string
+			if err := tx.Unscoped().Model(&models.Webhook{}).Where("tenant_id = ? AND name IN ?", job.TenantID, webhookNames).
+				Pluck("name", &existing).Error; err != nil {
+				return err
+			}
+			for _, name := range existing {
+				takenWebhookNames[name] = true
+			}
+		}
+
+		var events []models.Event
+		var highest uint64
+		for _, item := range items {
+			switch {
+			case item.Invalid != "":
+				conflict(item.Line, "invalid", item.Invalid)
+			case item.Event != nil:
+				if taken[item.Event.Sequence] {
+					conflict(item.Line, "event", fmt.Sprintf("sequence %d is already taken", item.Event.Sequence))
+					continue
+				}
+				taken[item.Event.Sequence] = true
+				events = append(events, *item.Event)
+				highest = max(highest, item.Event.Sequence)
+			case item.View != nil:
+				if takenNames[item.View.Name] {
+					conflict(item.Line, "view", fmt.Sprintf("a view named %q already exists", item.View.Name))
+					continue
+				}
+				takenNames[item.View.Name] = true
+				if err := tx.Create(item.View).Error; err != nil {
+					return err
+				}
+			case item.Webhook != nil:
+				if name := item.Webhook.Name; name != nil {
+					if takenWebhookNames[*name] {
+						conflict(item.Line, "webhook", fmt.Sprintf("a webhook named %q already exists", *name))
+						continue
+					}
+					takenWebhookNames[*name] = true
+				}
+				// Imported webhooks start inactive; Create would write the
+				// column's default of true for a false Active
+				if err := tx.Create(item.Webhook).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(item.Webhook).Update("active", false).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(events) > 0 {
+			// events are copies, so their metadata need not be restored
+			stored := make([]*models.Event, len(events))
+			for i := range events {
+				stored[i] = &events[i]
+			}
+			d.prepareMetadata(stored...)
+			if err := tx.CreateInBatches(events, 100).Error; err != nil {
+				return err
+			}
+			first, err := reserveSequences(tx, d.dialect, job.TenantID, 0)
+			if err != nil {
+				return err
+			}
+			if highest >= first {
+				if err := tx.Model(&models.EventSequence{}).Where("tenant_id = ?", job.TenantID).
+					Update("last_sequence", highest).Error; err != nil {
+					return err
+				}
+			}
+		}
+		imported = int64(len(events))
+
+		conflictLog := job.ConflictLog
+		if len(conflicts) > 0 && job.ConflictCount < maxImportConflicts {
+			var logged []models.ImportConflict
+			if conflictLog != "" {
+				if err := json.Unmarshal([]byte(conflictLog), &logged); err != nil {
+					return err
+				}
+			}
+			logged = append(logged, conflicts[:min(len(conflicts), maxImportConflicts-len(logged))]...)
+			data, err := json.Marshal(logged)
+			if err != nil {
+				return err
+			}
+			conflictLog = string(data)
+		}
+		result := tx.Model(&models.ImportJob{}).
+			Where("id = ? AND status = ? AND attempts = ?", job.ID, models.JobRunning, job.Attempts).
+			Updates(map[string]interface{}{
+				"lines":           lines,
+				"events_imported": job.EventsImported + imported,
+				"conflict_count":  job.ConflictCount + int64(len(conflicts)),
+				"conflict_log":    conflictLog,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrJobTakenOver
+		}
+		job.ConflictLog = conflictLog
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	job.Lines = lines
+	job.EventsImported += imported
+	job.ConflictCount += int64(len(conflicts))
+	return conflicts, nil
+}
+
+// ClaimJob claims the oldest claimable background job of model's table,
+// pending or running with a heartbeat older than staleBefore, and loads it
+// into model with its attempt counted. It reports false when there is none.
+func (d *Database) ClaimJob(model interface{}, staleBefore, now time.Time) (bool, error) {
+	claimable := d.DB.Where("status = ?", models.JobPending).
+		Or("status = ? AND heartbeat_at < ?", models.JobRunning, staleBefore)
+
+	var candidates []struct {
+		ID       string
+		Status   string
+		Attempts int
+	}
+	err := d.DB.Model(model).Select("id", "status", "attempts").Where(claimable).Order("created_at").Limit(10).Find(&candidates).Error
+	if err != nil {
+		return false, err
+	}
+	for _, job := range candidates {
+		// Another worker may claim the same job; the attempt it counted
+		// makes the update miss
+		result := d.DB.Model(model).
+			Where("id = ? AND status = ? AND attempts = ?", job.ID, job.Status, job.Attempts).
+			Updates(map[string]interface{}{
+				"status":       models.JobRunning,
+				"attempts":     job.Attempts + 1,
+				"heartbeat_at": now,
+				"started_at":   now,
+			})
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return true, d.DB.Where("id = ?", job.ID).First(model).Error
+		}
+	}
+	return false, nil
+}
+
+// HeartbeatJob marks a running attempt of the job of model's table with
+// id as alive. It reports false once the attempt has been taken over or
+// has ended.
+func (d *Database) HeartbeatJob(model interface{}, id string, attempt int, at time.Time) (bool, error) {
+	result := d.DB.Model(model).
+		Where("id = ? AND status = ? AND attempts = ?", id, models.JobRunning, attempt).
+		Update("heartbeat_at", at)
+	return result.RowsAffected == 1, result.Error
+}
+
+// RequeueJob hands a running attempt of the job of model's table with id
+// back to the queue without counting it, as when its server shuts down
+func (d *Database) RequeueJob(model interface{}, id string, attempt int) error {
+	return d.DB.Model(model).
+		Where("id = ? AND status = ? AND attempts = ?", id, models.JobRunning, attempt).
+		Updates(map[string]interface{}{
+			"status":       models.JobPending,
+			"attempts":     attempt - 1,
+			"heartbeat_at": nil,
+		}).Error
+}
+
+// CreateWebhook creates a new webhook
+func (d *Database) CreateWebhook(webhook *models.Webhook) error {
+	return d.DB.Create(webhook).Error
+}
+
+// UpsertWebhook creates the tenant's webhook named *wh.Name, or updates the
+// URL, event types, payload version, timeouts and active flag of the
+// existing one, keeping its ID and secret. wh is then the stored webhook,
+// and created reports whether it was inserted. Concurrent upserts of a name
+// leave a single webhook.
+func (d *Database) UpsertWebhook(wh *models.Webhook) (created bool, err error) {
+	secret, active := wh.Secret, wh.Active
+	var stored models.Webhook
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "tenant_id"}, {Name: "name"}},
+			DoUpdates: append(clause.AssignmentColumns([]string{"url", "event_types", "payload_version", "timeout", "connect_timeout", "updated_at"}),
+				clause.Assignment{Column: clause.Column{Name: "version"}, Value: gorm.Expr("webhooks.version + 1")}),
+		}).Create(wh).Error
+		if err != nil {
+			return err
+		}
+		// The stored ID may not be the one the insert reported, on MySQL
+		if err := tx.Where("tenant_id = ? AND name = ?", wh.TenantID, *wh.Name).First(&stored).Error; err != nil {
+			return err
+		}
+		// Set separately, as the insert writes the column's default of true
+		// for a false Active
+		if stored.Active != active {
+			stored.Active = active
+			return tx.Model(&stored).Update("active", active).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	*wh = stored
+	// Only an insert stores the new secret
+	return stored.Secret == secret, nil
+}
+
+// UpdateWebhook replaces the URL, event types, payload version, timeouts
+// and active flag of the tenant's webhook named *wh.Name while it is at
+// version, and returns a *StaleVersionError otherwise. wh is then the
+// stored webhook.
+func (d *Database) UpdateWebhook(wh *models.Webhook, version int64) error {
+	var stored models.Webhook
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		named := func() *gorm.DB {
+			return tx.Where("tenant_id = ? AND name = ?", wh.TenantID, *wh.Name)
+		}
+		result := named().Model(&models.Webhook{}).Where("version = ?", version).
+			Updates(map[string]interface{}{
+				"url":             wh.URL,
+				"event_types":     wh.EventTypes,
+				"active":          wh.Active,
+				"payload_version": wh.PayloadVersion,
+				"timeout":         wh.Timeout,
+				"connect_timeout": wh.ConnectTimeout,
+				"version":         bumpVersion,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return checkVersion(named(), &models.Webhook{})
+		}
+		return named().First(&stored).Error
+	})
+	if err != nil {
+		return err
+	}
+	*wh = stored
+	return nil
+}
+
+// GetWebhooksByTenant retrieves webhooks for a tenant
+func (d *Database) GetWebhooksByTenant(tenantID string) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := d.DB.Where("tenant_id = ? AND active = ?", tenantID, true).Find(&webhooks).Error
+	return webhooks, err
+}
+
+// ListWebhooks retrieves all webhooks of a tenant, including inactive ones
+func (d *Database) ListWebhooks(tenantID string) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := d.DB.Where("tenant_id = ?", tenantID).Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// ListWebhooksLimit retrieves at most limit of a tenant's webhooks, by ID
+func (d *Database) ListWebhooksLimit(tenantID string, limit int) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := d.DB.Where("tenant_id = ?", tenantID).Order("id").Limit(limit).Find(&webhooks).Error
+	return webhooks, err
+}
+
+// GetWebhook retrieves a webhook owned by a tenant
+func (d *Database) GetWebhook(tenantID string, id uint) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := d.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&webhook).Error
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// SetWebhookActive enables or disables a webhook. Active defaults to true
+// on insert, so this is how an inactive webhook is stored.
+func (d *Database) SetWebhookActive(id uint, active bool) error {
+	return d.DB.Model(&models.Webhook{}).Where("id = ?", id).Update("active", active).Error
+}
+
+// DeleteWebhook soft-deletes a webhook owned by a tenant. Its name, if it
+// has one, is released for a new webhook.
+func (d *Database) DeleteWebhook(tenantID string, id uint) error {
+	result := d.DB.Model(&models.Webhook{}).
+		Where("tenant_id = ? AND id = ?", tenantID, id).
+		Updates(map[string]interface{}{"name": nil, "deleted_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateWebhookDeliveryStatus records the outcome of a webhook delivery
+// and its status
+func (d *Database) UpdateWebhookDeliveryStatus(id uint, success bool, status string) error {
+	updates := map[string]interface{}{"last_triggered": time.Now(), "last_status": status}
+	if success {
+		updates["failure_count"] = 0
+	} else {
+		updates["failure_count"] = gorm.Expr("failure_count + 1")
+	}
+	return d.DB.Model(&models.Webhook{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// GetLastWebhookDelivery returns the tenant's webhook with the latest
+// delivery attempt, or nil when none was attempted
+func (d *Database) GetLastWebhookDelivery(tenantID string) (*models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := d.DB.Where("tenant_id = ? AND last_triggered IS NOT NULL", tenantID).
+		Order("last_triggered DESC").
+		Limit(1).
+		Find(&webhooks).Error
+	if err != nil || len(webhooks) == 0 {
+		return nil, err
+	}
+	return &webhooks[0], nil
+}
+
+// CreateWebhooks creates webhooks, possibly of several tenants, all or none
+func (d *Database) CreateWebhooks(webhooks []models.Webhook) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(webhooks, 100).Error
+	})
+}
+
+// FindWebhookName returns which of the tenants already have a webhook
+// named name
+func (d *Database) FindWebhookName(tenantIDs []string, name string) (map[string]bool, error) {
+	taken := make(map[string]bool)
+	if len(tenantIDs) == 0 {
+		return taken, nil
+	}
+	var found []string
+	err := d.DB.Model(&models.Webhook{}).
+		Where("tenant_id IN ? AND name = ?", tenantIDs, name).
+		Pluck("tenant_id", &found).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range found {
+		taken[id] = true
+	}
+	return taken, nil
+}
+
+// WebhookSelector picks webhooks across tenants for a bulk change; a
+// webhook must match every field given
+type WebhookSelector struct {
+	// URLPattern matches the whole URL, * standing for any characters
+	URLPattern string
+	TenantIDs  []string
+}
+
+// ErrTooManyWebhooks is returned when a bulk change selects more webhooks
+// than it may change at once
+var ErrTooManyWebhooks = errors.New("too many webhooks selected")
+
+// WebhookChange is a webhook a bulk change selected, as it was before the
+// change, and whether the change applied to it
+type WebhookChange struct {
+	Webhook models.Webhook
+	Changed bool
+}
+
+// ChangeWebhooks pauses, resumes or deletes the webhooks sel picks, all or
+// none, and returns them in ID order. It fails with ErrTooManyWebhooks when
+// they are more than limit. Pausing a paused webhook or resuming one that
+// is not paused leaves it unchanged.
+func (d *Database) ChangeWebhooks(sel WebhookSelector, action string, at time.Time, limit int) ([]WebhookChange, error) {
+	var updates map[string]interface{}
+	switch action {
+	case models.WebhookActionPause:
+		updates = map[string]interface{}{"paused_at": at}
+	case models.WebhookActionResume:
+		updates = map[string]interface{}{"paused_at": nil}
+	case models.WebhookActionDelete:
+		updates = map[string]interface{}{"name": nil, "deleted_at": at}
+	default:
+		return nil, fmt.Errorf("unknown webhook action %q", action)
+	}
+
+	var changes []WebhookChange
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx
+		if d.dialect.rowLocks() {
+			query = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		if sel.URLPattern != "" {
+			query = query.Where("url LIKE ? ESCAPE '!'", likePattern(sel.URLPattern))
+		}
+		if len(sel.TenantIDs) > 0 {
+			query = query.Where("tenant_id IN ?", sel.TenantIDs)
+		}
+		var webhooks []models.Webhook
+		if err := query.Order("id").Limit(limit + 1).Find(&webhooks).Error; err != nil {
+			return err
+		}
+		if len(webhooks) > limit {
+			return ErrTooManyWebhooks
+		}
+
+		changes = make([]WebhookChange, 0, len(webhooks))
+		var ids []uint
+		for _, wh := range webhooks {
+			changed := true
+			switch action {
+			case models.WebhookActionPause:
+				changed = wh.PausedAt == nil
+			case models.WebhookActionResume:
+				changed = wh.PausedAt != nil
+			}
+			changes = append(changes, WebhookChange{Webhook: wh, Changed: changed})
+			if changed {
+				ids = append(ids, wh.ID)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return tx.Model(&models.Webhook{}).Where("id IN ?", ids).UpdateColumns(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// eventTypeQuery selects the event types m matches: exact types with IN and
+// prefixes with LIKE, excludes negated
+func eventTypeQuery(query *gorm.DB, m *eventtype.Matcher) *gorm.DB {
+	conditions := func(patterns []eventtype.Pattern) (exact, like []string) {
+		for _, p := range patterns {
+			if p.Prefix() {
+				like = append(like, likePattern(p.Value())+"%")
+			} else {
+				exact = append(exact, p.Value())
+			}
+		}
+		return exact, like
+	}
+
+	if include := m.Include(); len(include) > 0 {
+		exact, like := conditions(include)
+		var sql []string
+		var args []any
+		if len(exact) > 0 {
+			sql = append(sql, "event_type IN ?")
+			args = append(args, exact)
+		}
+		for _, pattern := range like {
+			sql = append(sql, "event_type LIKE ? ESCAPE '!'")
+			args = append(args, pattern)
+		}
+		query = query.Where("("+strings.Join(sql, " OR ")+")", args...)
+	}
+	exact, like := conditions(m.Exclude())
+	if len(exact) > 0 {
+		query = query.Where("event_type NOT IN ?", exact)
+	}
+	for _, pattern := range like {
+		query = query.Where("event_type NOT LIKE ? ESCAPE '!'", pattern)
+	}
+	return query
+}
+
+// likePattern turns a pattern where * stands for any characters into a
+// LIKE pattern escaped with !
+func likePattern(pattern string) string {
+	escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(pattern)
+	return strings.ReplaceAll(escaped, "*", "%")
+}
+
+// AuditLogFilter narrows an audit log query; zero values are ignored
+type AuditLogFilter struct {
+	ActorType string
+	ActorID   string
+	Action    string
+	// ImpersonatedBy matches entries recorded through impersonation tokens
+	ImpersonatedBy string
+	Since          time.Time
+	Until          time.Time
+	Limit          int
+	Offset         int
+}
+
+// auditChainHeadID is the ID of the audit chain's only head row
+const auditChainHeadID = 1
+
+// AppendAuditLog chains an entry to the latest one and stores it. The
+// chain head stays locked until the entry is committed, so replicas append
+// one at a time and entry IDs follow the chain. hash computes the entry's
+// hash once its PrevHash is set. A missing head starts at the latest
+// entry, so it can be rebuilt from the log.
+func (d *Database) AppendAuditLog(entry *models.AuditLog, hash func(*models.AuditLog) string) error {
+	return d.sequenced(func(tx *gorm.DB) error {
+		head, err := lockAuditChainHead(tx, d.dialect)
+		if err != nil {
+			return err
+		}
+		entry.PrevHash = head.Hash
+		entry.Hash = hash(entry)
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.AuditChainHead{}).Where("id = ?", auditChainHeadID).
+			Update("hash", entry.Hash).Error
+	})
+}
+
+// lockAuditChainHead returns the audit chain head, locked until tx ends,
+// creating it if missing
+func lockAuditChainHead(tx *gorm.DB, dialect dialect) (models.AuditChainHead, error) {
+	lock := tx
+	if dialect.rowLocks() {
+		// SELECT ... FOR UPDATE; SQLite callers hold sequenceMu instead
+		lock = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	var head models.AuditChainHead
+	err := lock.Where("id = ?", auditChainHeadID).Take(&head).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var latest []models.AuditLog
+		if err := tx.Select("hash").Order("id DESC").Limit(1).Find(&latest).Error; err != nil {
+			return head, err
+		}
+		head = models.AuditChainHead{ID: auditChainHeadID}
+		if len(latest) > 0 {
+			head.Hash = latest[0].Hash
+		}
+		// A concurrent first append may create the head first; then lock
+		// and use that one
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&head).Error; err != nil {
+			return head, err
+		}
+		err = lock.Where("id = ?", auditChainHeadID).Take(&head).Error
+	}
+	return head, err
+}
+
+// GetAuditChainHead returns the hash of the latest chained audit log
+// entry, or "" when nothing has been appended
+func (d *Database) GetAuditChainHead() (string, error) {
+	var heads []models.AuditChainHead
+	err := d.DB.Where("id = ?", auditChainHeadID).Limit(1).Find(&heads).Error
+	if err != nil || len(heads) == 0 {
+		return "", err
+	}
+	return heads[0].Hash, nil
+}
+
+// GetAuditLogsAfter retrieves up to limit audit log entries with an ID
+// above afterID, in chain order
+func (d *Database) GetAuditLogsAfter(afterID uint, limit int) ([]models.AuditLog, error) {
+	var entries []models.AuditLog
+	err := d.DB.Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// GetAuditLogs retrieves audit log entries matching a filter, newest first
+func (d *Database) GetAuditLogs(filter AuditLogFilter) ([]models.AuditLog, error) {
+	query := d.DB.Model(&models.AuditLog{})
+	if filter.ActorType != "" {
+		query = query.Where("actor_type = ?", filter.ActorType)
+	}
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ImpersonatedBy != "" {
+		query = query.Where("impersonated_by = ?", filter.ImpersonatedBy)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("timestamp >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("timestamp < ?", filter.Until)
+	}
+
+	var entries []models.AuditLog
+	err := query.Order("id DESC").
+		Limit(filter.Limit).
+		Offset(filter.Offset).
+		Find(&entries).Error
+	return entries, err
+}
+
+// GetSetting retrieves a system setting by key
+func (d *Database) GetSetting(key string) (*models.SystemSetting, error) {
+	var setting models.SystemSetting
+	err := d.DB.First(&setting, "key = ?", key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &setting, nil
+}
+
+// PutSetting creates or replaces a system setting
+func (d *Database) PutSetting(key, value string) error {
+	return d.DB.Save(&models.SystemSetting{Key: key, Value: value}).Error
+}
+
+// DeadLetterFilter narrows a dead letter query; zero values are ignored
+type DeadLetterFilter struct {
+	TenantID string
+	Source   string
+	Limit    int
+	Offset   int
+}
+
+// CreateDeadLetters stores dead letters in one transaction
+func (d *Database) CreateDeadLetters(letters []models.DeadLetter) error {
+	return d.DB.Create(&letters).Error
+}
+
+// GetDeadLetters returns dead letters matching the filter, most recently
+// failed first
+func (d *Database) GetDeadLetters(filter DeadLetterFilter) ([]models.DeadLetter, error) {
+	query := d.DB.Model(&models.DeadLetter{})
+	if filter.TenantID != "" {
+		query = query.Where("tenant_id = ?", filter.TenantID)
+	}
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+
+	var letters []models.DeadLetter
+	err := query.Order("last_seen_at DESC, id DESC").
+		Limit(filter.Limit).
+		Offset(filter.Offset).
+		Find(&letters).Error
+	return letters, err
+}
+
+// GetDeadLetter returns one dead letter
+func (d *Database) GetDeadLetter(id uint) (*models.DeadLetter, error) {
+	var letter models.DeadLetter
+	if err := d.DB.First(&letter, id).Error; err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// RecordDeadLetterAttempt counts another failed attempt at a dead letter
+func (d *Database) RecordDeadLetterAttempt(id uint, cause string, at time.Time) error {
+	return d.DB.Model(&models.DeadLetter{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":     gorm.Expr("attempts + 1"),
+		"error":        cause,
+		"last_seen_at": at,
+	}).Error
+}
+
+// DeleteDeadLetter removes a dead letter
+func (d *Database) DeleteDeadLetter(id uint) error {
+	result := d.DB.Delete(&models.DeadLetter{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// PurgeDeadLetters deletes dead letters that last failed before cutoff
+func (d *Database) PurgeDeadLetters(cutoff time.Time) (int64, error) {
+	result := d.DB.Where("last_seen_at < ?", cutoff).Delete(&models.DeadLetter{})
+	return result.RowsAffected, result.Error
 }
@@ -0,0 +1,296 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// dialect holds what differs between the supported databases, so queries
+// ask it rather than checking the driver name
+type dialect interface {
+	// open returns the gorm dialector connecting to dsn
+	open(dsn string) (gorm.Dialector, error)
+	// rowLocks reports whether SELECT ... FOR UPDATE locks rows. Without
+	// them, transactions that reserve sequence numbers run one at a time.
+	rowLocks() bool
+	// migrations returns the SQL files Migrate applies, or nil when it
+	// creates and alters tables with AutoMigrate
+	migrations() fs.FS
+	// compressesText reports whether the database compresses large text
+	// values by itself, which makes compressing metadata first pointless
+	compressesText() bool
+	// afterMigrate adjusts what AutoMigrate created for models
+	afterMigrate(db *gorm.DB, models []interface{}) error
+	// tryLockMigrations takes the lock that lets one process at a time
+	// migrate for holder, returning how to release it, or nil when another
+	// process holds it
+	tryLockMigrations(ctx context.Context, db *gorm.DB, holder string) (release func(), err error)
+	// jsonArrayContains returns a condition that the JSON array under key
+	// of the JSON object in a text column holds the string bound to its one
+	// placeholder. A string under key is not an array holding itself.
+	jsonArrayContains(column, key string) string
+	// synchronousCommit returns a statement that makes the transaction's
+	// commit wait until it is durable whatever the server default, or ""
+	synchronousCommit() string
+	// maxParams is the most bind parameters one statement may have
+	maxParams() int
+	// isUniqueViolation reports whether err is a unique index violation
+	isUniqueViolation(err error) bool
+	// statementTimeout returns a statement that makes the server cancel the
+	// transaction's statements after timeout, or ""
+	statementTimeout(timeout time.Duration) string
+	// isStatementTimeout reports whether err is a statement the server
+	// cancelled for running past its statement timeout
+	isStatementTimeout(err error) bool
+	// isWriteConflict reports whether err is a transaction the server
+	// aborted for a serialization failure or deadlock, which succeeds when
+	// run again
+	isWriteConflict(err error) bool
+	// byteLength returns an expression for the length in bytes of a text
+	// column
+	byteLength(column string) string
+	// percentile returns an aggregate of the nearest-rank value at fraction
+	// p of a column within each group, or "" when the database has none
+	percentile(column string, p float64) string
+}
+
+// dialectFor returns the dialect of a Database.Driver value
+func dialectFor(driver string) (dialect, error) {
+	switch driver {
+	case "sqlite", "":
+		return sqliteDialect{}, nil
+	case "postgres":
+		return postgresDialect{}, nil
+	case "mysql":
+		return mysqlDialect{}, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q", driver)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) open(dsn string) (gorm.Dialector, error) {
+	// Create the file's directory if it doesn't exist
+	dir := filepath.Dir(dsn)
+	if dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+	return sqlite.Open(dsn), nil
+}
+
+func (sqliteDialect) rowLocks() bool       { return false }
+func (sqliteDialect) migrations() fs.FS    { return nil }
+func (sqliteDialect) compressesText() bool { return false }
+
+func (sqliteDialect) afterMigrate(*gorm.DB, []interface{}) error { return nil }
+
+// tryLockMigrations inserts a row into migration_locks, as SQLite has no
+// session locks. The row is deleted on release, or taken over once its
+// lease has passed.
+func (sqliteDialect) tryLockMigrations(_ context.Context, db *gorm.DB, holder string) (func(), error) {
+	if err := db.Exec("CREATE TABLE IF NOT EXISTS migration_locks (name TEXT PRIMARY KEY, holder TEXT NOT NULL, acquired_at DATETIME NOT NULL)").Error; err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if err := db.Exec("DELETE FROM migration_locks WHERE name = ? AND acquired_at < ?", migrationLockName, now.Add(-migrationLockLease)).Error; err != nil {
+		return nil, err
+	}
+	result := db.Exec("INSERT OR IGNORE INTO migration_locks (name, holder, acquired_at) VALUES (?, ?, ?)", migrationLockName, holder, now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return func() {
+		db.WithContext(context.Background()).Exec("DELETE FROM migration_locks WHERE name = ? AND holder = ?", migrationLockName, holder)
+	}, nil
+}
+
+func (sqliteDialect) jsonArrayContains(column, key string) string {
+	return fmt.Sprintf("json_valid(%s) AND json_type(%s, '$.%s') = 'array' AND EXISTS (SELECT 1 FROM json_each(%s, '$.%s') WHERE value = ?)", column, column, key, column, key)
+}
+
+func (sqliteDialect) synchronousCommit() string { return "" }
+
+// maxParams is SQLITE_MAX_VARIABLE_NUMBER since SQLite 3.32
+func (sqliteDialect) maxParams() int { return 32766 }
+
+func (sqliteDialect) isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func (sqliteDialect) statementTimeout(time.Duration) string { return "" }
+func (sqliteDialect) isStatementTimeout(error) bool         { return false }
+
+// isWriteConflict is false as SQLite has one writer at a time, so writers
+// wait for each other rather than deadlock
+func (sqliteDialect) isWriteConflict(error) bool { return false }
+
+// byteLength casts to a blob, as LENGTH of text counts characters
+func (sqliteDialect) byteLength(column string) string {
+	return fmt.Sprintf("LENGTH(CAST(%s AS BLOB))", column)
+}
+
+func (sqliteDialect) percentile(string, float64) string { return "" }
+
+type postgresDialect struct{}
+
+func (postgresDialect) open(dsn string) (gorm.Dialector, error) {
+	return postgres.Open(dsn), nil
+}
+
+func (postgresDialect) rowLocks() bool { return true }
+
+// migrations are SQL files rather than AutoMigrate, which fails with
+// "insufficient arguments" on the tables of the initial deployment
+func (postgresDialect) migrations() fs.FS { return driverMigrations("postgres") }
+
+// compressesText is true as TOAST compresses values of more than about 2 kB
+func (postgresDialect) compressesText() bool { return true }
+
+func (postgresDialect) afterMigrate(*gorm.DB, []interface{}) error { return nil }
+
+func (postgresDialect) tryLockMigrations(ctx context.Context, db *gorm.DB, _ string) (func(), error) {
+	return lockOnConn(ctx, db,
+		fmt.Sprintf("SELECT pg_try_advisory_lock(%d)", migrationLockKey),
+		fmt.Sprintf("SELECT pg_advisory_unlock(%d)", migrationLockKey))
+}
+
+func (postgresDialect) jsonArrayContains(column, key string) string {
+	return fmt.Sprintf("jsonb_typeof(%s::jsonb -> '%s') = 'array' AND jsonb_exists(%s::jsonb -> '%s', ?)", column, key, column, key)
+}
+
+func (postgresDialect) synchronousCommit() string { return "SET LOCAL synchronous_commit = on" }
+func (postgresDialect) maxParams() int            { return 65535 }
+
+func (postgresDialect) isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func (postgresDialect) statementTimeout(timeout time.Duration) string {
+	return fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())
+}
+
+func (postgresDialect) isStatementTimeout(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "57014"
+}
+
+// isWriteConflict matches serialization_failure and deadlock_detected
+func (postgresDialect) isWriteConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
+
+func (postgresDialect) byteLength(column string) string {
+	return fmt.Sprintf("OCTET_LENGTH(%s)", column)
+}
+
+func (postgresDialect) percentile(column string, p float64) string {
+	return fmt.Sprintf("PERCENTILE_DISC(%g) WITHIN GROUP (ORDER BY %s)", p, column)
+}
+
+type mysqlDialect struct{}
+
+// datetimePrecision keeps microseconds, as PostgreSQL and SQLite do
+var datetimePrecision = 6
+
+func (mysqlDialect) open(dsn string) (gorm.Dialector, error) {
+	return gormmysql.New(gormmysql.Config{DSN: dsn, DefaultDatetimePrecision: &datetimePrecision}), nil
+}
+
+func (mysqlDialect) rowLocks() bool       { return true }
+func (mysqlDialect) migrations() fs.FS    { return nil }
+func (mysqlDialect) compressesText() bool { return false }
+
+// afterMigrate widens TEXT columns to LONGTEXT. MySQL's TEXT holds at most
+// 64 KiB, where the other databases' text is unbounded. JSON is kept as
+// text rather than MySQL's JSON type, which would reorder keys and change
+// the metadata clients get back.
+func (mysqlDialect) afterMigrate(db *gorm.DB, models []interface{}) error {
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		columns, err := db.Migrator().ColumnTypes(model)
+		if err != nil {
+			return err
+		}
+		current := make(map[string]string, len(columns))
+		for _, column := range columns {
+			current[column.Name()] = column.DatabaseTypeName()
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.DataType != schema.DataType("text") || current[field.DBName] != "TEXT" {
+				continue
+			}
+			sql := fmt.Sprintf("ALTER TABLE `%s` MODIFY `%s` LONGTEXT", stmt.Schema.Table, field.DBName)
+			if field.NotNull {
+				sql += " NOT NULL"
+			}
+			if err := db.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tryLockMigrations takes a named lock, GET_LOCK returning at once when
+// another session holds it
+func (mysqlDialect) tryLockMigrations(ctx context.Context, db *gorm.DB, _ string) (func(), error) {
+	return lockOnConn(ctx, db,
+		fmt.Sprintf("SELECT GET_LOCK('%s', 0)", migrationLockName),
+		fmt.Sprintf("SELECT RELEASE_LOCK('%s')", migrationLockName))
+}
+
+func (mysqlDialect) jsonArrayContains(column, key string) string {
+	return fmt.Sprintf("JSON_VALID(%s) AND JSON_TYPE(JSON_EXTRACT(%s, '$.%s')) = 'ARRAY' AND JSON_CONTAINS(JSON_EXTRACT(%s, '$.%s'), JSON_QUOTE(?))", column, column, key, column, key)
+}
+
+// synchronousCommit is "" as InnoDB flushes each commit by default
+// (innodb_flush_log_at_trx_commit=1), which a session cannot raise
+func (mysqlDialect) synchronousCommit() string { return "" }
+func (mysqlDialect) maxParams() int            { return 65535 }
+
+func (mysqlDialect) isUniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// statementTimeout is "" as max_execution_time can only be set for the
+// session, which outlives the transaction on a pooled connection
+func (mysqlDialect) statementTimeout(time.Duration) string { return "" }
+func (mysqlDialect) isStatementTimeout(error) bool         { return false }
+
+// isWriteConflict matches ER_LOCK_DEADLOCK, which rolls the transaction back
+func (mysqlDialect) isWriteConflict(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1213
+}
+
+// byteLength is LENGTH, which counts bytes where CHAR_LENGTH counts
+// characters
+func (mysqlDialect) byteLength(column string) string {
+	return fmt.Sprintf("LENGTH(%s)", column)
+}
+
+func (mysqlDialect) percentile(string, float64) string { return "" }
@@ -0,0 +1,66 @@
+//go:build integration
+
+package database
+
+import (
+	"os"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// The integration build runs the driver tests against real servers too:
+//
+//	TEST_POSTGRES_DSN="host=localhost user=events password=events dbname=events_test sslmode=disable" \
+//	TEST_MYSQL_DSN="events:events@tcp(localhost:3306)/events_test?parseTime=true&loc=UTC&charset=utf8mb4" \
+//	go test -tags integration ./internal/database
+//
+// Each test drops every table of the database it is given, so point them
+// at databases kept for the tests. A driver whose variable is unset is
+// skipped.
+func init() {
+	testDrivers = append(testDrivers,
+		testDriver{name: "postgres", dsn: envDSN("TEST_POSTGRES_DSN"), reset: resetPostgres, slowQuery: "SELECT pg_sleep(60)"},
+		testDriver{name: "mysql", dsn: envDSN("TEST_MYSQL_DSN"), reset: resetMySQL, slowQuery: "SELECT SLEEP(60)"},
+	)
+}
+
+func envDSN(name string) func(t *testing.T) string {
+	return func(t *testing.T) string {
+		dsn := os.Getenv(name)
+		if dsn == "" {
+			t.Skipf("%s is not set", name)
+		}
+		return dsn
+	}
+}
+
+func resetPostgres(t *testing.T, db *Database) {
+	t.Helper()
+	if err := db.DB.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public").Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func resetMySQL(t *testing.T, db *Database) {
+	t.Helper()
+	var tables []string
+	if err := db.DB.Raw("SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()").Scan(&tables).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Dropping runs on one connection, the one the session setting is on
+	err := db.DB.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if err := conn.Exec("DROP TABLE IF EXISTS `" + table + "`").Error; err != nil {
+				return err
+			}
+		}
+		return conn.Exec("SET FOREIGN_KEY_CHECKS = 1").Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/models"
+)
+
+// testDriver is a database the driver tests run against
+type testDriver struct {
+	name string
+	// dsn returns where to connect, skipping the test when the database is
+	// not available
+	dsn func(t *testing.T) string
+	// reset empties a database that outlives the test, so each test
+	// migrates from scratch
+	reset func(t *testing.T, db *Database)
+	// slowQuery runs until cancelled, or for far longer than any test
+	slowQuery string
+}
+
+// testDrivers always holds SQLite. Built with the integration tag, the
+// PostgreSQL and MySQL servers named by TEST_POSTGRES_DSN and
+// TEST_MYSQL_DSN are added; see drivers_integration_test.go.
+var testDrivers = []testDriver{{
+	name: "sqlite",
+	dsn:  func(t *testing.T) string { return filepath.Join(t.TempDir(), "events.db") },
+	// Counts without end
+	slowQuery: "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT count(*) FROM n",
+}}
+
+// forEachDriver runs fn against every test driver on a freshly migrated
+// database
+func forEachDriver(t *testing.T, fn func(t *testing.T, db *Database)) {
+	forEachTestDriver(t, func(t *testing.T, driver testDriver) {
+		fn(t, openDriver(t, driver))
+	})
+}
+
+// forEachTestDriver is forEachDriver for tests that need the driver
+func forEachTestDriver(t *testing.T, fn func(t *testing.T, driver testDriver)) {
+	for _, driver := range testDrivers {
+		driver := driver
+		t.Run(driver.name, func(t *testing.T) {
+			fn(t, driver)
+		})
+	}
+}
+
+// testTenants exist in every driver test database. PostgreSQL and MySQL
+// enforce the foreign key from events and the like to their tenant.
+var testTenants = []string{"tenant-a", "tenant-b"}
+
+// openDriver connects to a test driver's database, migrates it and
+// creates testTenants
+func openDriver(t *testing.T, driver testDriver) *Database {
+	t.Helper()
+	db, err := NewDatabase(driver.name, driver.dsn(t), 4, 4, time.Hour, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if driver.reset != nil {
+		driver.reset(t, db)
+	}
+	if err := db.Migrate(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range testTenants {
+		if err := db.CreateTenant(&models.Tenant{ID: id, Name: id, APIKey: "key-" + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestDriverMigrationsAreComplete(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *Database) {
+		pending, err := db.PendingMigrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) > 0 {
+			t.Fatalf("pending after Migrate: %v", pending)
+		}
+		// A second run finds nothing to do
+		if err := db.Migrate(time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// TestDriverStoresEventsFaithfully writes events through the batch path
+// with more rows than one statement can bind and reads them back: large
+// metadata must not be cut to a short text type, and timestamps keep their
+// microseconds.
+func TestDriverStoresEventsFaithfully(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *Database) {
+		rows := db.dialect.maxParams()/10 + 50
+		at := time.Date(2024, 3, 1, 12, 30, 45, 123456000, time.UTC)
+		large := `{"blob":"` + strings.Repeat("x", 100_000) + `"}`
+		events := make([]models.Event, rows)
+		for i := range events {
+			events[i] = models.Event{TenantID: "tenant-a", EventType: "driver.batch", Timestamp: at, Metadata: fmt.Sprintf(`{"n":%d}`, i)}
+		}
+		events[0].Metadata = large
+		if err := db.CreateEvents(events, rows); err != nil {
+			t.Fatal(err)
+		}
+		for i, event := range events {
+			if event.Sequence != uint64(i+1) {
+				t.Fatalf("event %d has sequence %d", i, event.Sequence)
+			}
+		}
+
+		stored, err := db.GetEvent("tenant-a", events[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Metadata != large {
+			t.Errorf("metadata of %d bytes came back as %d", len(large), len(stored.Metadata))
+		}
+		if !stored.Timestamp.Equal(at) {
+			t.Errorf("timestamp %s came back as %s", at.Format(time.RFC3339Nano), stored.Timestamp.Format(time.RFC3339Nano))
+		}
+		if n, err := db.CountEvents(EventFilter{TenantID: "tenant-a"}); err != nil || n != int64(rows) {
+			t.Errorf("counted %d events, want %d: %v", n, rows, err)
+		}
+	})
+}
+
+func TestDriverQueriesMetadataTags(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *Database) {
+		for _, metadata := range []string{`{"tags":["red","blue"]}`, `{"tags":["red"]}`, `{"tags":"red"}`, `{"other":["red"]}`, `{}`} {
+			event := newEvent("tenant-a")
+			event.Metadata = metadata
+			if err := db.CreateEvent(&event); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, tc := range []struct {
+			tags []string
+			want int64
+		}{
+			{[]string{"red"}, 2},
+			{[]string{"red", "blue"}, 1},
+			{[]string{"green"}, 0},
+		} {
+			n, err := db.CountEvents(EventFilter{TenantID: "tenant-a", Tags: tc.tags})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tc.want {
+				t.Errorf("tags %v matched %d events, want %d", tc.tags, n, tc.want)
+			}
+		}
+	})
+}
+
+func TestDriverUpserts(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *Database) {
+		name := "orders"
+		first := &models.Webhook{TenantID: "tenant-a", Name: &name, URL: "https://a.example/hook", Secret: "secret-1", EventTypes: "[]", Active: true}
+		created, err := db.UpsertWebhook(first)
+		if err != nil || !created {
+			t.Fatalf("first upsert: created %v: %v", created, err)
+		}
+		second := &models.Webhook{TenantID: "tenant-a", Name: &name, URL: "https://b.example/hook", Secret: "secret-2", EventTypes: "[]", Active: false}
+		created, err = db.UpsertWebhook(second)
+		if err != nil || created {
+			t.Fatalf("second upsert: created %v: %v", created, err)
+		}
+		if second.ID != first.ID || second.URL != "https://b.example/hook" || second.Secret != "secret-1" || second.Active || second.Version != 2 {
+			t.Errorf("upserted webhook = id %d url %s secret %s active %v version %d", second.ID, second.URL, second.Secret, second.Active, second.Version)
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := db.AddSampledEventCounts(map[string]map[string]int64{"tenant-a": {"page.view": 3}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		counts, err := db.GetSampledEventCounts("tenant-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts["page.view"] != 6 {
+			t.Errorf("sampled counts = %v, want page.view 6", counts)
+		}
+
+		claimed, err := db.ClaimQuotaNotice("tenant-a", "2024-03", 80)
+		if err != nil || !claimed {
+			t.Fatalf("first claim: %v: %v", claimed, err)
+		}
+		if claimed, err = db.ClaimQuotaNotice("tenant-a", "2024-03", 80); err != nil || claimed {
+			t.Fatalf("second claim: %v: %v", claimed, err)
+		}
+	})
+}
+
+func TestDriverDetectsUniqueViolations(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *Database) {
+		if err := db.CreateSavedView(&models.SavedView{TenantID: "tenant-a", Name: "errors", Filter: "{}"}); err != nil {
+			t.Fatal(err)
+		}
+		err := db.CreateSavedView(&models.SavedView{TenantID: "tenant-a", Name: "errors", Filter: "{}"})
+		if err == nil || !db.IsUniqueViolation(err) {
+			t.Fatalf("duplicate view: %v, want a unique violation", err)
+		}
+		if db.IsUniqueViolation(fmt.Errorf("some other failure")) {
+			t.Fatal("an unrelated error was taken for a unique violation")
+		}
+	})
+}
+
+func TestDriverEventSizeStats(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *Database) {
+		// Sizes 10, 20, ... 100 bytes
+		for i := 1; i <= 10; i++ {
+			event := newEvent("tenant-a")
+			event.Metadata = `{"p":"` + strings.Repeat("x", i*10-8) + `"}`
+			if err := db.CreateEvent(&event); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stats, err := db.GetEventSizeStats("tenant-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := models.EventSizeStats{P50: 50, P95: 100, Max: 100, Total: 550}
+		if got := stats["sequence.test"]; got != want {
+			t.Fatalf("size stats = %+v, want %+v", got, want)
+		}
+	})
+}
+
+// TestDriverChainsAuditLogs appends audit entries from many goroutines:
+// each must chain to the one before it in ID order
+func TestDriverChainsAuditLogs(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *Database) {
+		const writers, each = 4, 25
+		hash := func(entry *models.AuditLog) string {
+			return fmt.Sprintf("%x", sha256.Sum256([]byte(entry.PrevHash+entry.TargetID)))
+		}
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < each; i++ {
+					entry := &models.AuditLog{ActorType: "admin", Action: "tenant.create", TargetID: fmt.Sprintf("%d-%d", w, i), Timestamp: time.Now().UTC()}
+					if err := db.AppendAuditLog(entry, hash); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+
+		entries, err := db.GetAuditLogsAfter(0, writers*each+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != writers*each {
+			t.Fatalf("got %d entries, want %d", len(entries), writers*each)
+		}
+		prev := ""
+		for _, entry := range entries {
+			if entry.PrevHash != prev || entry.Hash != hash(&entry) {
+				t.Fatalf("entry %d does not chain to the one before it", entry.ID)
+			}
+			prev = entry.Hash
+		}
+		if head, err := db.GetAuditChainHead(); err != nil || head != prev {
+			t.Fatalf("chain head %q, want %q: %v", head, prev, err)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"event-ingestion-system/internal/models"
+)
+
+// Event store backends, chosen by database.event_store
+const (
+	EventStoreSQL    = "sql"
+	EventStoreMemory = "memory"
+)
+
+// EventStore keeps a tenant's events. *Database, the default, keeps them in
+// the events table; another backend can hold them while tenants, webhooks
+// and everything else stay in the database. Lookups of a missing event fail
+// with gorm.ErrRecordNotFound whatever the backend, and events are handed
+// out with their metadata plain.
+type EventStore interface {
+	// EventsWithContext returns the store bound to ctx, so queries observe
+	// its cancellation
+	EventsWithContext(ctx context.Context) EventStore
+
+	// CreateEvent stores an event, setting its ID and next sequence number.
+	// CreateEvents stores events all or none, at most batchSize per
+	// statement where that applies, each tenant's numbered in slice order.
+	// The synchronous variants return once the events are durable.
+	CreateEvent(event *models.Event) error
+	CreateEventSynchronous(event *models.Event) error
+	CreateEvents(events []models.Event, batchSize int) error
+	CreateEventsSynchronous(events []models.Event, batchSize int) error
+
+	// Queries by filter
+	GetEvent(tenantID string, id uint) (*models.Event, error)
+	GetEvents(filter EventFilter) ([]models.Event, error)
+	CountEvents(filter EventFilter) (int64, error)
+	CountEventsByType(filter EventFilter) (map[string]int64, error)
+
+	// Statistics
+	GetEventStats(tenantID string) (map[string]int64, error)
+	CountEventsBySource(tenantID string) (map[string]int64, error)
+	GetEventSizeStats(tenantID string) (map[string]models.EventSizeStats, error)
+	CountUnprocessedEvents(tenantID string) (int64, error)
+	CountEventsCreatedSince(tenantID string, since time.Time) (int64, error)
+	GetLatestEventTime(tenantID, eventType string) (*time.Time, error)
+	GetLastEventReceived(tenantID string) (*time.Time, error)
+
+	// Reading in order, for consumers, replays and exports
+	GetEventsAfter(tenantID string, afterID uint, limit int) ([]models.Event, error)
+	GetEventsAfterSequence(tenantID string, after uint64, limit int) ([]models.Event, error)
+	GetEventsCreatedBetween(tenantID string, from, to time.Time, limit int) ([]models.Event, error)
+	CountEventsAfter(tenantID string, afterID uint) (int64, error)
+	GetLatestEventID(tenantID string) (uint, error)
+
+	// Changes to stored events
+	MarkEventsProcessed(tenantID string, ids []uint, at time.Time) (marked, already []uint, err error)
+	MarkEventsProcessedUpTo(tenantID string, upTo uint, at time.Time) (int64, error)
+	RedactEvent(tenantID string, id uint, at time.Time) (event *models.Event, redacted bool, err error)
+}
+
+var _ EventStore = (*Database)(nil)
+
+// EventsWithContext is WithContext as an EventStore
+func (d *Database) EventsWithContext(ctx context.Context) EventStore {
+	return d.WithContext(ctx)
+}
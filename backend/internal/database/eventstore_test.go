@@ -0,0 +1,332 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// TestEventStores runs the same checks against every EventStore: the
+// memory store, and *Database on each test driver. Whatever the backend,
+// callers must get the same answers.
+func TestEventStores(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		runEventStoreSuite(t, func(t *testing.T) EventStore { return NewMemoryEventStore() })
+	})
+	forEachTestDriver(t, func(t *testing.T, driver testDriver) {
+		runEventStoreSuite(t, func(t *testing.T) EventStore { return openDriver(t, driver) })
+	})
+}
+
+// storeEvent describes an event seeded by seedEvents
+type storeEvent struct {
+	tenant, eventType, source, correlation, metadata string
+	// minute is the event timestamp, in minutes after storeEpoch
+	minute int
+	system bool
+}
+
+var storeEpoch = time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+// storeEvents are inserted in this order, so IDs and each tenant's
+// sequence numbers follow it, while timestamps do not
+var storeEvents = []storeEvent{
+	{"tenant-a", "page.view", "web", "flow-1", `{"tags":["red","blue"],"path":"/home"}`, 3, false},
+	{"tenant-a", "page.click", "web", "flow-1", `{"tags":["red"],"path":"/cart"}`, 1, false},
+	{"tenant-b", "page.view", "ios", "", `{"path":"/home"}`, 2, false},
+	{"tenant-a", "order.placed", "api", "flow-2", `{"tags":"red","total":10}`, 5, false},
+	{"tenant-a", "page.view", "", "", `{"path":"/about"}`, 4, false},
+	{"tenant-a", "quota.notice", "", "", `{}`, 6, true},
+}
+
+// seedEvents stores storeEvents, the first two one at a time and the rest
+// in one batch, and returns them with their IDs
+func seedEvents(t *testing.T, store EventStore) []models.Event {
+	t.Helper()
+	events := make([]models.Event, len(storeEvents))
+	for i, e := range storeEvents {
+		events[i] = models.Event{
+			TenantID:      e.tenant,
+			EventType:     e.eventType,
+			Source:        e.source,
+			CorrelationID: e.correlation,
+			Metadata:      e.metadata,
+			Timestamp:     storeEpoch.Add(time.Duration(e.minute) * time.Minute),
+			System:        e.system,
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.CreateEvent(&events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.CreateEvents(events[2:], 2); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// ids returns the IDs of events in order
+func ids(events []models.Event) []uint {
+	out := make([]uint, len(events))
+	for i, e := range events {
+		out[i] = e.ID
+	}
+	return out
+}
+
+// idsOf returns the IDs of the seeded events at indexes
+func idsOf(seeded []models.Event, indexes ...int) []uint {
+	out := make([]uint, len(indexes))
+	for i, index := range indexes {
+		out[i] = seeded[index].ID
+	}
+	return out
+}
+
+func runEventStoreSuite(t *testing.T, open func(t *testing.T) EventStore) {
+	t.Run("create and get", func(t *testing.T) {
+		store := open(t)
+		seeded := seedEvents(t, store)
+		wantSequences := []uint64{1, 2, 1, 3, 4, 5}
+		for i, e := range seeded {
+			if e.ID == 0 || e.Sequence != wantSequences[i] {
+				t.Fatalf("event %d: id %d sequence %d, want sequence %d", i, e.ID, e.Sequence, wantSequences[i])
+			}
+		}
+
+		got, err := store.GetEvent("tenant-a", seeded[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.EventType != "page.view" || got.Metadata != storeEvents[0].metadata || !got.Timestamp.Equal(seeded[0].Timestamp) || got.MetadataSize != int64(len(storeEvents[0].metadata)) {
+			t.Errorf("GetEvent = %+v", got)
+		}
+		if _, err := store.GetEvent("tenant-b", seeded[0].ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("another tenant's event: %v, want gorm.ErrRecordNotFound", err)
+		}
+		if _, err := store.GetEvent("tenant-a", seeded[len(seeded)-1].ID+100); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("missing event: %v, want gorm.ErrRecordNotFound", err)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		store := open(t)
+		seeded := seedEvents(t, store)
+		since, until := storeEpoch.Add(2*time.Minute), storeEpoch.Add(5*time.Minute)
+		processed := true
+		if _, _, err := store.MarkEventsProcessed("tenant-a", []uint{seeded[1].ID}, storeEpoch); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			name   string
+			filter EventFilter
+			// want is the seeded events matched, newest first
+			want []int
+		}{
+			{"tenant", EventFilter{}, []int{5, 3, 4, 0, 1}},
+			{"event type", EventFilter{EventTypes: []string{"page.view"}}, []int{4, 0}},
+			{"event type prefix", EventFilter{EventTypes: []string{"page.*"}}, []int{4, 0, 1}},
+			{"event type exclusion", EventFilter{EventTypes: []string{"!page.*"}}, []int{5, 3}},
+			{"sources", EventFilter{Sources: []string{"web", "api"}}, []int{3, 0, 1}},
+			{"correlation", EventFilter{CorrelationID: "flow-1"}, []int{0, 1}},
+			{"tags", EventFilter{Tags: []string{"red"}}, []int{0, 1}},
+			{"every tag", EventFilter{Tags: []string{"red", "blue"}}, []int{0}},
+			{"search", EventFilter{Search: "/home"}, []int{0}},
+			{"since and until", EventFilter{Since: &since, Until: &until}, []int{4, 0}},
+			{"processed", EventFilter{Processed: &processed}, []int{1}},
+			{"without system events", EventFilter{ExcludeSystem: true}, []int{3, 4, 0, 1}},
+			{"oldest first", EventFilter{EventTypes: []string{"page.*"}, Oldest: true}, []int{1, 0, 4}},
+			{"page", EventFilter{Limit: 2, Offset: 1}, []int{3, 4}},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				filter := tc.filter
+				filter.TenantID = "tenant-a"
+				if filter.Limit == 0 {
+					filter.Limit = 100
+				}
+				events, err := store.GetEvents(filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := ids(events), idsOf(seeded, tc.want...); !reflect.DeepEqual(got, want) {
+					t.Errorf("GetEvents = %v, want %v", got, want)
+				}
+
+				filter.Limit, filter.Offset = 0, 0
+				want := len(tc.want)
+				if tc.name == "page" {
+					want = 5
+				}
+				if n, err := store.CountEvents(filter); err != nil || n != int64(want) {
+					t.Errorf("CountEvents = %d, want %d: %v", n, want, err)
+				}
+			})
+		}
+
+		byType, err := store.CountEventsByType(EventFilter{TenantID: "tenant-a", EventTypes: []string{"page.*"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]int64{"page.view": 2, "page.click": 1}; !reflect.DeepEqual(byType, want) {
+			t.Errorf("CountEventsByType = %v, want %v", byType, want)
+		}
+	})
+
+	t.Run("statistics", func(t *testing.T) {
+		store := open(t)
+		seeded := seedEvents(t, store)
+
+		stats, err := store.GetEventStats("tenant-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]int64{"total": 5, "page.view": 2, "page.click": 1, "order.placed": 1, "quota.notice": 1}; !reflect.DeepEqual(stats, want) {
+			t.Errorf("GetEventStats = %v, want %v", stats, want)
+		}
+		sources, err := store.CountEventsBySource("tenant-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]int64{"web": 2, "api": 1}; !reflect.DeepEqual(sources, want) {
+			t.Errorf("CountEventsBySource = %v, want %v", sources, want)
+		}
+		sizes, err := store.GetEventSizeStats("tenant-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		view := int64(len(storeEvents[0].metadata))
+		about := int64(len(storeEvents[4].metadata))
+		if want := (models.EventSizeStats{P50: about, P95: view, Max: view, Total: view + about}); sizes["page.view"] != want {
+			t.Errorf("page.view sizes = %+v, want %+v", sizes["page.view"], want)
+		}
+
+		if n, err := store.CountUnprocessedEvents("tenant-a"); err != nil || n != 5 {
+			t.Errorf("CountUnprocessedEvents = %d: %v", n, err)
+		}
+		if n, err := store.CountEventsCreatedSince("tenant-a", time.Now().Add(-time.Hour)); err != nil || n != 4 {
+			t.Errorf("CountEventsCreatedSince = %d, want 4 without the system event: %v", n, err)
+		}
+		if n, err := store.CountEventsCreatedSince("tenant-a", time.Now().Add(time.Hour)); err != nil || n != 0 {
+			t.Errorf("CountEventsCreatedSince an hour ahead = %d: %v", n, err)
+		}
+
+		latest, err := store.GetLatestEventTime("tenant-a", "page.view")
+		if err != nil || latest == nil || !latest.Equal(seeded[4].Timestamp) {
+			t.Errorf("GetLatestEventTime = %v, want %v: %v", latest, seeded[4].Timestamp, err)
+		}
+		if latest, err := store.GetLatestEventTime("tenant-a", "missing"); err != nil || latest != nil {
+			t.Errorf("GetLatestEventTime of a missing type = %v: %v", latest, err)
+		}
+		if received, err := store.GetLastEventReceived("tenant-a"); err != nil || received == nil || time.Since(*received) > time.Minute {
+			t.Errorf("GetLastEventReceived = %v: %v", received, err)
+		}
+		if received, err := store.GetLastEventReceived("tenant-none"); err != nil || received != nil {
+			t.Errorf("GetLastEventReceived without events = %v: %v", received, err)
+		}
+	})
+
+	t.Run("reading in order", func(t *testing.T) {
+		store := open(t)
+		seeded := seedEvents(t, store)
+
+		after, err := store.GetEventsAfter("tenant-a", seeded[1].ID, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := ids(after), idsOf(seeded, 3, 4); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetEventsAfter = %v, want %v", got, want)
+		}
+		bySequence, err := store.GetEventsAfterSequence("tenant-a", 3, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := ids(bySequence), idsOf(seeded, 4, 5); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetEventsAfterSequence = %v, want %v", got, want)
+		}
+		between, err := store.GetEventsCreatedBetween("tenant-a", time.Now().Add(-time.Hour), time.Now().Add(time.Hour), 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := ids(between), idsOf(seeded, 0, 1, 3); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetEventsCreatedBetween = %v, want %v", got, want)
+		}
+		if n, err := store.CountEventsAfter("tenant-a", seeded[0].ID); err != nil || n != 4 {
+			t.Errorf("CountEventsAfter = %d, want 4: %v", n, err)
+		}
+		if id, err := store.GetLatestEventID("tenant-a"); err != nil || id != seeded[5].ID {
+			t.Errorf("GetLatestEventID = %d, want %d: %v", id, seeded[5].ID, err)
+		}
+		if id, err := store.GetLatestEventID("tenant-none"); err != nil || id != 0 {
+			t.Errorf("GetLatestEventID without events = %d: %v", id, err)
+		}
+	})
+
+	t.Run("marking processed", func(t *testing.T) {
+		store := open(t)
+		seeded := seedEvents(t, store)
+		at := storeEpoch.Add(time.Hour)
+
+		marked, already, err := store.MarkEventsProcessed("tenant-a", idsOf(seeded, 0, 2), at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := idsOf(seeded, 0); !reflect.DeepEqual(marked, want) || len(already) != 0 {
+			t.Errorf("marked %v, already %v; want %v, none: another tenant's event is left alone", marked, already, want)
+		}
+		marked, already, err = store.MarkEventsProcessed("tenant-a", idsOf(seeded, 0, 1), at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(marked, idsOf(seeded, 1)) || !reflect.DeepEqual(already, idsOf(seeded, 0)) {
+			t.Errorf("marked %v, already %v", marked, already)
+		}
+		if n, err := store.MarkEventsProcessedUpTo("tenant-a", seeded[4].ID, at); err != nil || n != 2 {
+			t.Errorf("MarkEventsProcessedUpTo = %d, want 2: %v", n, err)
+		}
+		if n, err := store.CountUnprocessedEvents("tenant-a"); err != nil || n != 1 {
+			t.Errorf("CountUnprocessedEvents = %d, want 1: %v", n, err)
+		}
+		event, err := store.GetEvent("tenant-a", seeded[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.ProcessedAt == nil || !event.ProcessedAt.Equal(at) {
+			t.Errorf("ProcessedAt = %v, want %v", event.ProcessedAt, at)
+		}
+	})
+
+	t.Run("redaction", func(t *testing.T) {
+		store := open(t)
+		seeded := seedEvents(t, store)
+		at := storeEpoch.Add(time.Hour)
+
+		event, redacted, err := store.RedactEvent("tenant-a", seeded[0].ID, at)
+		if err != nil || !redacted {
+			t.Fatalf("first redaction: %v: %v", redacted, err)
+		}
+		if event.Metadata != models.RedactedMetadata(at) || event.RedactedAt == nil || !event.RedactedAt.Equal(at) {
+			t.Errorf("redacted event = metadata %s, redacted at %v", event.Metadata, event.RedactedAt)
+		}
+		if _, redacted, err := store.RedactEvent("tenant-a", seeded[0].ID, at.Add(time.Hour)); err != nil || redacted {
+			t.Errorf("second redaction: %v: %v", redacted, err)
+		}
+		if _, _, err := store.RedactEvent("tenant-b", seeded[0].ID, at); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("another tenant's event: %v, want gorm.ErrRecordNotFound", err)
+		}
+		// What is left is not searchable
+		if n, err := store.CountEvents(EventFilter{TenantID: "tenant-a", Tags: []string{"blue"}}); err != nil || n != 0 {
+			t.Errorf("tag search found %d redacted events: %v", n, err)
+		}
+		stored, err := store.GetEvent("tenant-a", seeded[0].ID)
+		if err != nil || stored.Metadata != models.RedactedMetadata(at) {
+			t.Errorf("stored metadata after redaction = %v: %v", stored, err)
+		}
+	})
+}
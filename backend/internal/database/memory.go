@@ -0,0 +1,445 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/eventtype"
+	"event-ingestion-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MemoryEventStore keeps events in process memory. Events are lost on
+// restart and not shared between replicas, so it suits development and
+// trying out the EventStore interface rather than production. Queries give
+// the same results as on the database; the query timeout does not apply.
+type MemoryEventStore struct {
+	mu sync.RWMutex
+	// events holds every event in ID order; tenants indexes them by tenant
+	events    []*models.Event
+	tenants   map[string][]*models.Event
+	sequences map[string]uint64
+}
+
+var _ EventStore = (*MemoryEventStore)(nil)
+
+// NewMemoryEventStore creates an empty store
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{
+		tenants:   make(map[string][]*models.Event),
+		sequences: make(map[string]uint64),
+	}
+}
+
+// EventsWithContext returns the store itself; its queries do not block
+func (m *MemoryEventStore) EventsWithContext(context.Context) EventStore {
+	return m
+}
+
+// CreateEvent stores a copy of event, setting its ID, sequence number and
+// creation time
+func (m *MemoryEventStore) CreateEvent(event *models.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.insert(event, time.Now())
+	return nil
+}
+
+// CreateEventSynchronous is CreateEvent; memory has nothing to flush
+func (m *MemoryEventStore) CreateEventSynchronous(event *models.Event) error {
+	return m.CreateEvent(event)
+}
+
+// CreateEvents stores copies of events at once; batchSize is ignored
+func (m *MemoryEventStore) CreateEvents(events []models.Event, batchSize int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for i := range events {
+		m.insert(&events[i], now)
+	}
+	return nil
+}
+
+// CreateEventsSynchronous is CreateEvents
+func (m *MemoryEventStore) CreateEventsSynchronous(events []models.Event, batchSize int) error {
+	return m.CreateEvents(events, batchSize)
+}
+
+// insert numbers event and stores a copy of it. The caller holds mu.
+func (m *MemoryEventStore) insert(event *models.Event, now time.Time) {
+	m.sequences[event.TenantID]++
+	event.ID = uint(len(m.events) + 1)
+	event.Sequence = m.sequences[event.TenantID]
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = now
+	}
+	event.MetadataSize = int64(len(event.Metadata))
+
+	stored := *event
+	stored.Tenant = models.Tenant{}
+	m.events = append(m.events, &stored)
+	m.tenants[event.TenantID] = append(m.tenants[event.TenantID], &stored)
+}
+
+// GetEvent retrieves one of a tenant's events
+func (m *MemoryEventStore) GetEvent(tenantID string, id uint) (*models.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	event := m.find(tenantID, id)
+	if event == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *event
+	return &copied, nil
+}
+
+// find returns the tenant's stored event with an ID, or nil. The caller
+// holds mu.
+func (m *MemoryEventStore) find(tenantID string, id uint) *models.Event {
+	if id == 0 || int(id) > len(m.events) {
+		return nil
+	}
+	if event := m.events[id-1]; event.TenantID == tenantID {
+		return event
+	}
+	return nil
+}
+
+// GetEvents retrieves events matching a filter, newest first unless
+// filter.Oldest is set
+func (m *MemoryEventStore) GetEvents(filter EventFilter) ([]models.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	matched := m.filter(filter)
+	sort.SliceStable(matched, func(i, j int) bool {
+		if filter.Oldest {
+			return matched[i].Timestamp.Before(matched[j].Timestamp)
+		}
+		return matched[i].Timestamp.After(matched[j].Timestamp)
+	})
+	return page(matched, filter.Offset, filter.Limit), nil
+}
+
+// CountEvents counts the events matching a filter
+func (m *MemoryEventStore) CountEvents(filter EventFilter) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int64(len(m.filter(filter))), nil
+}
+
+// CountEventsByType counts the events matching a filter per event type
+func (m *MemoryEventStore) CountEventsByType(filter EventFilter) (map[string]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := make(map[string]int64)
+	for _, event := range m.filter(filter) {
+		counts[event.EventType]++
+	}
+	return counts, nil
+}
+
+// filter returns the events matching a filter in ID order. The caller
+// holds mu.
+func (m *MemoryEventStore) filter(filter EventFilter) []*models.Event {
+	var matched []*models.Event
+	types := eventtype.Compile(filter.EventTypes)
+	for _, event := range m.tenants[filter.TenantID] {
+		if types.Match(event.EventType) && matchesFilter(event, filter) {
+			matched = append(matched, event)
+		}
+	}
+	return matched
+}
+
+// matchesFilter applies the conditions eventQuery puts in SQL, but for
+// event types
+func matchesFilter(event *models.Event, filter EventFilter) bool {
+	switch {
+	case len(filter.Sources) > 0 && !contains(filter.Sources, event.Source),
+		filter.CorrelationID != "" && event.CorrelationID != filter.CorrelationID,
+		filter.Since != nil && event.Timestamp.Before(*filter.Since),
+		filter.Until != nil && !event.Timestamp.Before(*filter.Until),
+		filter.Processed != nil && *filter.Processed != (event.ProcessedAt != nil),
+		filter.ExcludeSystem && event.System:
+		return false
+	}
+	if filter.Search == "" && len(filter.Tags) == 0 {
+		return true
+	}
+	// What is left of a redacted event's metadata is not searchable
+	if event.RedactedAt != nil || !strings.Contains(event.Metadata, filter.Search) {
+		return false
+	}
+	if len(filter.Tags) > 0 {
+		var doc struct {
+			Tags []any `json:"tags"`
+		}
+		if json.Unmarshal([]byte(event.Metadata), &doc) != nil {
+			return false
+		}
+		for _, tag := range filter.Tags {
+			if !containsValue(doc.Tags, tag) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(values []any, value string) bool {
+	for _, v := range values {
+		if s, ok := v.(string); ok && s == value {
+			return true
+		}
+	}
+	return false
+}
+
+// page copies the events from offset, at most limit of them, like LIMIT
+// and OFFSET do
+func page(events []*models.Event, offset, limit int) []models.Event {
+	if offset >= len(events) {
+		return nil
+	}
+	events = events[offset:]
+	if limit >= 0 && limit < len(events) {
+		events = events[:limit]
+	}
+	out := make([]models.Event, len(events))
+	for i, event := range events {
+		out[i] = *event
+	}
+	return out
+}
+
+// GetEventStats counts a tenant's events by type, plus "total"
+func (m *MemoryEventStore) GetEventStats(tenantID string) (map[string]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := map[string]int64{"total": int64(len(m.tenants[tenantID]))}
+	for _, event := range m.tenants[tenantID] {
+		stats[event.EventType]++
+	}
+	return stats, nil
+}
+
+// CountEventsBySource counts a tenant's events per source; events sent
+// without one are not counted
+func (m *MemoryEventStore) CountEventsBySource(tenantID string) (map[string]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := make(map[string]int64)
+	for _, event := range m.tenants[tenantID] {
+		if event.Source != "" {
+			counts[event.Source]++
+		}
+	}
+	return counts, nil
+}
+
+// GetEventSizeStats summarizes the metadata size of a tenant's events by
+// event type, with nearest-rank percentiles
+func (m *MemoryEventStore) GetEventSizeStats(tenantID string) (map[string]models.EventSizeStats, error) {
+	m.mu.RLock()
+	sizes := make(map[string][]int64)
+	for _, event := range m.tenants[tenantID] {
+		sizes[event.EventType] = append(sizes[event.EventType], event.MetadataSize)
+	}
+	m.mu.RUnlock()
+
+	stats := make(map[string]models.EventSizeStats, len(sizes))
+	for eventType, s := range sizes {
+		sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+		at := func(p float64) int64 {
+			return s[max(int(math.Ceil(p*float64(len(s))))-1, 0)]
+		}
+		var total int64
+		for _, size := range s {
+			total += size
+		}
+		stats[eventType] = models.EventSizeStats{P50: at(0.5), P95: at(0.95), Max: s[len(s)-1], Total: total}
+	}
+	return stats, nil
+}
+
+// CountUnprocessedEvents counts the tenant's events that have not been
+// acknowledged
+func (m *MemoryEventStore) CountUnprocessedEvents(tenantID string) (int64, error) {
+	processed := false
+	return m.CountEvents(EventFilter{TenantID: tenantID, Processed: &processed})
+}
+
+// CountEventsCreatedSince counts the tenant's events created at or after
+// since, system events left out
+func (m *MemoryEventStore) CountEventsCreatedSince(tenantID string, since time.Time) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var count int64
+	for _, event := range m.tenants[tenantID] {
+		if !event.System && !event.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetLatestEventTime returns the timestamp of a tenant's newest event of a
+// type, or nil when it has none
+func (m *MemoryEventStore) GetLatestEventTime(tenantID, eventType string) (*time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var latest *time.Time
+	for _, event := range m.tenants[tenantID] {
+		if event.EventType == eventType && (latest == nil || event.Timestamp.After(*latest)) {
+			at := event.Timestamp
+			latest = &at
+		}
+	}
+	return latest, nil
+}
+
+// GetLastEventReceived returns when the tenant's newest event was
+// received, or nil when it has none
+func (m *MemoryEventStore) GetLastEventReceived(tenantID string) (*time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events := m.tenants[tenantID]
+	if len(events) == 0 {
+		return nil, nil
+	}
+	at := events[len(events)-1].CreatedAt
+	return &at, nil
+}
+
+// GetEventsAfter retrieves up to limit of the tenant's events with an ID
+// greater than afterID, oldest first
+func (m *MemoryEventStore) GetEventsAfter(tenantID string, afterID uint, limit int) ([]models.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events := m.tenants[tenantID]
+	from := sort.Search(len(events), func(i int) bool { return events[i].ID > afterID })
+	return page(events[from:], 0, limit), nil
+}
+
+// GetEventsAfterSequence retrieves up to limit of the tenant's events with a
+// sequence number greater than after, in sequence order
+func (m *MemoryEventStore) GetEventsAfterSequence(tenantID string, after uint64, limit int) ([]models.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events := m.tenants[tenantID]
+	from := sort.Search(len(events), func(i int) bool { return events[i].Sequence > after })
+	return page(events[from:], 0, limit), nil
+}
+
+// GetEventsCreatedBetween returns up to limit of the tenant's events
+// stored from from up to but excluding to, in sequence order
+func (m *MemoryEventStore) GetEventsCreatedBetween(tenantID string, from, to time.Time, limit int) ([]models.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []*models.Event
+	for _, event := range m.tenants[tenantID] {
+		if !event.CreatedAt.Before(from) && event.CreatedAt.Before(to) {
+			matched = append(matched, event)
+		}
+	}
+	return page(matched, 0, limit), nil
+}
+
+// CountEventsAfter counts the tenant's events with an ID greater than afterID
+func (m *MemoryEventStore) CountEventsAfter(tenantID string, afterID uint) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events := m.tenants[tenantID]
+	from := sort.Search(len(events), func(i int) bool { return events[i].ID > afterID })
+	return int64(len(events) - from), nil
+}
+
+// GetLatestEventID returns the highest event ID of a tenant, or 0 when it
+// has no events
+func (m *MemoryEventStore) GetLatestEventID(tenantID string) (uint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events := m.tenants[tenantID]
+	if len(events) == 0 {
+		return 0, nil
+	}
+	return events[len(events)-1].ID, nil
+}
+
+// MarkEventsProcessed sets ProcessedAt on the tenant's events among ids.
+// It returns the IDs it marked and the IDs that were already processed.
+func (m *MemoryEventStore) MarkEventsProcessed(tenantID string, ids []uint, at time.Time) (marked, already []uint, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		event := m.find(tenantID, id)
+		if event == nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if event.ProcessedAt != nil {
+			already = append(already, id)
+			continue
+		}
+		processedAt := at
+		event.ProcessedAt = &processedAt
+		marked = append(marked, id)
+	}
+	return marked, already, nil
+}
+
+// MarkEventsProcessedUpTo sets ProcessedAt on every unprocessed event of the
+// tenant with an ID up to and including upTo, and returns how many
+func (m *MemoryEventStore) MarkEventsProcessedUpTo(tenantID string, upTo uint, at time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var count int64
+	for _, event := range m.tenants[tenantID] {
+		if event.ID > upTo {
+			break
+		}
+		if event.ProcessedAt == nil {
+			processedAt := at
+			event.ProcessedAt = &processedAt
+			count++
+		}
+	}
+	return count, nil
+}
+
+// RedactEvent replaces the metadata of one of a tenant's events with
+// models.RedactedMetadata. Redacting an event again changes nothing;
+// redacted reports whether this call redacted it.
+func (m *MemoryEventStore) RedactEvent(tenantID string, id uint, at time.Time) (*models.Event, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	event := m.find(tenantID, id)
+	if event == nil {
+		return nil, false, gorm.ErrRecordNotFound
+	}
+	redacted := event.RedactedAt == nil
+	if redacted {
+		event.Metadata = models.RedactedMetadata(at)
+		event.MetadataSize = int64(len(event.Metadata))
+		event.RedactedAt = &at
+	}
+	copied := *event
+	return &copied, redacted, nil
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrMigrationLocked is returned when another process kept the migration
+// lock for longer than the caller was willing to wait
+var ErrMigrationLocked = errors.New("another process is migrating the database")
+
+// migrationLockPoll is how often a process waiting to migrate tries the
+// lock again
+const migrationLockPoll = 500 * time.Millisecond
+
+// migrationLockLease is how long a lock row keeps other processes out on
+// databases without session locks. A process dying while it migrates
+// leaves its row behind, to be taken over once the lease has passed.
+const migrationLockLease = 15 * time.Minute
+
+// The migration lock on PostgreSQL, where advisory locks are numbered, and
+// on MySQL and in SQLite's lock table, where it is named
+const (
+	migrationLockKey  = 4917263508
+	migrationLockName = "event_system_migrate"
+)
+
+// lockMigrations takes the lock that lets one process at a time migrate,
+// waiting up to timeout for a process holding it, and returns how to
+// release it
+func (d *Database) lockMigrations(timeout time.Duration) (release func(), err error) {
+	ctx, cancel := context.WithTimeout(d.DB.Statement.Context, timeout)
+	defer cancel()
+	holder := migrationLockHolder()
+	waiting := false
+	for {
+		release, err := d.dialect.tryLockMigrations(ctx, d.DB.WithContext(ctx), holder)
+		if err != nil && ctx.Err() == nil {
+			return nil, fmt.Errorf("take migration lock: %w", err)
+		}
+		if release != nil {
+			return release, nil
+		}
+		if !waiting {
+			d.logger.Info("Waiting for another process to finish migrating", "timeout", timeout.String())
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: gave up waiting for its lock after %s (database.migrate_lock_timeout)", ErrMigrationLocked, timeout)
+		case <-time.After(migrationLockPoll):
+		}
+	}
+}
+
+// migrationLockHolder identifies this process in lock rows
+func migrationLockHolder() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// lockOnConn takes a session lock with the lock query, which selects
+// whether it was taken, on a connection of its own: the lock lasts as long
+// as the session, so the connection is held until unlock has run
+func lockOnConn(ctx context.Context, db *gorm.DB, lock, unlock string) (func(), error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked bool
+	if err := conn.QueryRowContext(ctx, lock).Scan(&locked); err != nil || !locked {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(context.Background(), unlock)
+		conn.Close()
+	}, nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationFiles holds the SQL migrations of the databases not migrated
+// with AutoMigrate, a directory per driver. Each file is applied once, in
+// name order, and recorded in schema_migrations. A released file is never
+// edited: changing the schema again takes a new file.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// driverMigrations returns the migration files of driver
+func driverMigrations(driver string) fs.FS {
+	files, err := fs.Sub(migrationFiles, "migrations/"+driver)
+	if err != nil {
+		panic(err)
+	}
+	return files
+}
+
+// sqlMigrations lists the versions of the migrations in files, the file
+// names without .sql, in the order they are applied
+func sqlMigrations(files fs.FS) ([]string, error) {
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	versions := make([]string, len(names))
+	for i, name := range names {
+		versions[i] = strings.TrimSuffix(name, ".sql")
+	}
+	return versions, nil
+}
+
+// pendingSQLMigrations lists the versions of the migrations in files not
+// recorded in schema_migrations
+func (d *Database) pendingSQLMigrations(files fs.FS) ([]string, error) {
+	versions, err := sqlMigrations(files)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[string]bool{}
+	if d.DB.Migrator().HasTable("schema_migrations") {
+		var done []string
+		if err := d.DB.Table("schema_migrations").Pluck("version", &done).Error; err != nil {
+			return nil, err
+		}
+		for _, version := range done {
+			applied[version] = true
+		}
+	}
+	var pending []string
+	for _, version := range versions {
+		if !applied[version] {
+			pending = append(pending, version)
+		}
+	}
+	return pending, nil
+}
+
+// applySQLMigrations applies the migrations in files not yet applied, each
+// in a transaction of its own that also records it, so a failed migration
+// leaves nothing behind and is applied again by the next Migrate
+func (d *Database) applySQLMigrations(files fs.FS) error {
+	err := d.DB.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version VARCHAR(255) PRIMARY KEY, applied_at TIMESTAMP NOT NULL)").Error
+	if err != nil {
+		return err
+	}
+	pending, err := d.pendingSQLMigrations(files)
+	if err != nil {
+		return err
+	}
+	for _, version := range pending {
+		sql, err := fs.ReadFile(files, version+".sql")
+		if err != nil {
+			return err
+		}
+		d.logger.Info("Applying migration", "migration", version)
+		err = d.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(string(sql)).Error; err != nil {
+				return err
+			}
+			return tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", version, time.Now().UTC()).Error
+		})
+		if err != nil {
+			return fmt.Errorf("apply migration %s: %w", version, err)
+		}
+	}
+	return nil
+}
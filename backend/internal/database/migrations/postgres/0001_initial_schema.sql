@@ -0,0 +1,49 @@
+-- Tables created by the initial deployment
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id varchar(36),
+    name varchar(255) NOT NULL,
+    api_key varchar(64) NOT NULL,
+    active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_tenants_deleted_at ON tenants (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenants_api_key ON tenants (api_key);
+
+CREATE TABLE IF NOT EXISTS events (
+    id bigserial,
+    tenant_id varchar(36) NOT NULL,
+    event_type varchar(100) NOT NULL,
+    "timestamp" timestamptz NOT NULL,
+    metadata text,
+    processed_at timestamptz,
+    created_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_tenants_events FOREIGN KEY (tenant_id) REFERENCES tenants (id)
+);
+CREATE INDEX IF NOT EXISTS idx_events_deleted_at ON events (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_events_timestamp ON events ("timestamp");
+CREATE INDEX IF NOT EXISTS idx_events_event_type ON events (event_type);
+CREATE INDEX IF NOT EXISTS idx_events_tenant_id ON events (tenant_id);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id bigserial,
+    tenant_id varchar(36) NOT NULL,
+    url varchar(500) NOT NULL,
+    secret varchar(64) NOT NULL,
+    event_types text,
+    active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    last_triggered timestamptz,
+    failure_count bigint DEFAULT 0,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_tenants_webhooks FOREIGN KEY (tenant_id) REFERENCES tenants (id)
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_deleted_at ON webhooks (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_webhooks_tenant_id ON webhooks (tenant_id);
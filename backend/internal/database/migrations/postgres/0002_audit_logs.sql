@@ -0,0 +1,21 @@
+-- Access audit log of sensitive operations
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id bigserial,
+    actor_type varchar(20) NOT NULL,
+    actor_id varchar(36),
+    action varchar(100) NOT NULL,
+    target_type varchar(50),
+    target_id varchar(100),
+    request_id varchar(128),
+    ip varchar(45),
+    "timestamp" timestamptz NOT NULL,
+    details text,
+    prev_hash varchar(64),
+    hash varchar(64) NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_timestamp ON audit_logs ("timestamp");
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs (action);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_id ON audit_logs (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_type ON audit_logs (actor_type);
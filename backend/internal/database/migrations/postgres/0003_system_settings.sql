@@ -0,0 +1,8 @@
+-- Settings shared by all replicas, such as maintenance mode
+
+CREATE TABLE IF NOT EXISTS system_settings (
+    key varchar(100),
+    value text,
+    updated_at timestamptz,
+    PRIMARY KEY (key)
+);
@@ -0,0 +1,3 @@
+-- Acknowledged events are found by when they were processed
+
+CREATE INDEX IF NOT EXISTS idx_events_processed_at ON events (processed_at);
@@ -0,0 +1,10 @@
+-- Checkpoint offsets of consumer groups
+
+CREATE TABLE IF NOT EXISTS consumer_offsets (
+    tenant_id varchar(36),
+    consumer_name varchar(100),
+    last_event_id bigint NOT NULL DEFAULT 0,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (tenant_id, consumer_name)
+);
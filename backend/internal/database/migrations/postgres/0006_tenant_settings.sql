@@ -0,0 +1,3 @@
+-- Per-tenant settings, starting with redaction rules
+
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS settings text;
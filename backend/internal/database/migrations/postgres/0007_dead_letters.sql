@@ -0,0 +1,18 @@
+-- Failed ingests and deliveries kept for retrying
+
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id bigserial,
+    tenant_id varchar(36),
+    source varchar(20) NOT NULL,
+    target varchar(100),
+    event_id bigint,
+    payload text,
+    error text,
+    attempts bigint NOT NULL DEFAULT 1,
+    first_seen_at timestamptz,
+    last_seen_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_dead_letters_tenant_id ON dead_letters (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_dead_letters_last_seen_at ON dead_letters (last_seen_at);
+CREATE INDEX IF NOT EXISTS idx_dead_letters_source ON dead_letters (source);
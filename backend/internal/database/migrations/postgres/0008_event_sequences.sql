@@ -0,0 +1,11 @@
+-- Per-tenant event sequence numbers and their counters. Events stored
+-- before sequences existed are numbered by Migrate, which then creates the
+-- unique index on (tenant_id, sequence).
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS sequence bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS event_sequences (
+    tenant_id varchar(36),
+    last_sequence bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id)
+);
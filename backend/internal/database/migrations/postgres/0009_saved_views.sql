@@ -0,0 +1,12 @@
+-- Saved event views
+
+CREATE TABLE IF NOT EXISTS saved_views (
+    id bigserial,
+    tenant_id varchar(36) NOT NULL,
+    name varchar(100) NOT NULL,
+    filter text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_saved_views_tenant_name ON saved_views (tenant_id, name);
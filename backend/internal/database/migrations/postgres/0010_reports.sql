@@ -0,0 +1,23 @@
+-- Scheduled report digests
+
+CREATE TABLE IF NOT EXISTS reports (
+    id bigserial,
+    tenant_id varchar(36) NOT NULL,
+    name varchar(100) NOT NULL,
+    schedule varchar(100) NOT NULL,
+    webhook_id bigint,
+    url varchar(500),
+    secret varchar(64),
+    filter text,
+    format varchar(20) NOT NULL,
+    active boolean NOT NULL,
+    next_run_at timestamptz,
+    last_run_at timestamptz,
+    last_status varchar(20),
+    last_error text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_reports_tenant_id ON reports (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_reports_next_run_at ON reports (next_run_at);
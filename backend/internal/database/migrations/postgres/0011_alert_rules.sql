@@ -0,0 +1,41 @@
+-- Alert rules and the history of their firing
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id bigserial,
+    tenant_id varchar(36) NOT NULL,
+    name varchar(100) NOT NULL,
+    condition varchar(20) NOT NULL,
+    event_type varchar(100) NOT NULL,
+    time_window varchar(20) NOT NULL,
+    threshold bigint NOT NULL,
+    metadata_match text,
+    webhook_id bigint,
+    url varchar(500),
+    secret varchar(64),
+    renotify_after varchar(20),
+    active boolean NOT NULL,
+    state varchar(10) NOT NULL DEFAULT 'ok',
+    state_since timestamptz,
+    last_value bigint,
+    last_evaluated_at timestamptz,
+    last_notified_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_alert_rules_tenant_id ON alert_rules (tenant_id);
+
+CREATE TABLE IF NOT EXISTS alert_histories (
+    id bigserial,
+    rule_id bigint NOT NULL,
+    tenant_id varchar(36) NOT NULL,
+    state varchar(10) NOT NULL,
+    value bigint,
+    message text,
+    delivery_error text,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_alert_histories_created_at ON alert_histories (created_at);
+CREATE INDEX IF NOT EXISTS idx_alert_histories_tenant_id ON alert_histories (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_alert_histories_rule_id ON alert_histories (rule_id);
@@ -0,0 +1,18 @@
+-- Admin impersonation tokens, and who impersonated in the audit log
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS impersonated_by varchar(100);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_impersonated_by ON audit_logs (impersonated_by);
+
+CREATE TABLE IF NOT EXISTS impersonations (
+    id varchar(36),
+    tenant_id varchar(36) NOT NULL,
+    impersonated_by varchar(100) NOT NULL,
+    reason varchar(500),
+    scope varchar(10) NOT NULL,
+    expires_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_impersonations_expires_at ON impersonations (expires_at);
+CREATE INDEX IF NOT EXISTS idx_impersonations_tenant_id ON impersonations (tenant_id);
@@ -0,0 +1,20 @@
+-- Tenant users, and which user acted in the audit log
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS user_id bigint;
+CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id ON audit_logs (user_id);
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial,
+    tenant_id varchar(36) NOT NULL,
+    email varchar(254) NOT NULL,
+    password_hash varchar(100),
+    sso_subject varchar(255),
+    role varchar(20) NOT NULL,
+    active boolean DEFAULT true,
+    last_login_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_users_sso_subject ON users (sso_subject);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users (tenant_id, email);
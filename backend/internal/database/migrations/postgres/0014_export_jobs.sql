@@ -0,0 +1,22 @@
+-- Background tenant exports
+
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id varchar(36),
+    tenant_id varchar(36) NOT NULL,
+    active_tenant_id varchar(36),
+    status varchar(20) NOT NULL,
+    attempts bigint NOT NULL DEFAULT 0,
+    error text,
+    object_key varchar(500),
+    size bigint,
+    event_count bigint,
+    heartbeat_at timestamptz,
+    started_at timestamptz,
+    completed_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_tenant_id ON export_jobs (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_status ON export_jobs (status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_export_jobs_active_tenant_id ON export_jobs (active_tenant_id);
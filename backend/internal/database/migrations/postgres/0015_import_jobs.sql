@@ -0,0 +1,24 @@
+-- Tenant imports from export archives
+
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id varchar(36),
+    tenant_id varchar(36) NOT NULL,
+    source_tenant_id varchar(36),
+    tenant_created boolean,
+    status varchar(20) NOT NULL,
+    attempts bigint NOT NULL DEFAULT 0,
+    error text,
+    object_key varchar(500),
+    lines bigint NOT NULL DEFAULT 0,
+    events_imported bigint NOT NULL DEFAULT 0,
+    conflict_count bigint NOT NULL DEFAULT 0,
+    conflict_log text,
+    heartbeat_at timestamptz,
+    started_at timestamptz,
+    completed_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_status ON import_jobs (status);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_tenant_id ON import_jobs (tenant_id);
@@ -0,0 +1,4 @@
+-- Webhook names, unique per tenant, for idempotent PUT
+
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS name varchar(100);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhooks_tenant_name ON webhooks (tenant_id, name);
@@ -0,0 +1,4 @@
+-- Versions of tenant settings and webhooks for optimistic concurrency
+
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+-- Payload version webhooks are delivered
+
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS payload_version bigint NOT NULL DEFAULT 1;
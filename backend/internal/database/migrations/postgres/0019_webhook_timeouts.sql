@@ -0,0 +1,5 @@
+-- Per-webhook delivery timeouts and the status of the last delivery
+
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS connect_timeout varchar(20);
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS last_status varchar(30);
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS timeout varchar(20);
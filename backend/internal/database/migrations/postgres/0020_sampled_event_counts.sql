@@ -0,0 +1,9 @@
+-- Counts of events dropped by sampling rules
+
+CREATE TABLE IF NOT EXISTS sampled_event_counts (
+    tenant_id varchar(36),
+    event_type varchar(100),
+    count bigint NOT NULL DEFAULT 0,
+    updated_at timestamptz,
+    PRIMARY KEY (tenant_id, event_type)
+);
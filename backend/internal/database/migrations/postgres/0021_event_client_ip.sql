@@ -0,0 +1,3 @@
+-- Client IP events were sent from
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS client_ip varchar(45);
@@ -0,0 +1,5 @@
+-- Source and credential events were ingested with
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS credential varchar(100);
+ALTER TABLE events ADD COLUMN IF NOT EXISTS source varchar(100);
+CREATE INDEX IF NOT EXISTS idx_events_source ON events (source);
@@ -0,0 +1,9 @@
+-- Leases electing the replica that runs once-only jobs
+
+CREATE TABLE IF NOT EXISTS leases (
+    name varchar(64),
+    holder varchar(255) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    updated_at timestamptz,
+    PRIMARY KEY (name)
+);
@@ -0,0 +1,3 @@
+-- When each tenant last authenticated
+
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS last_auth_at timestamptz;
@@ -0,0 +1,4 @@
+-- Encoding of stored metadata. Metadata is never compressed on
+-- PostgreSQL, which compresses large values itself, so it stays empty.
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS metadata_encoding varchar(10) NOT NULL DEFAULT '';
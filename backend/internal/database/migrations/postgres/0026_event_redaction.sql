@@ -0,0 +1,24 @@
+-- Redacted events and bulk redaction jobs
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS redacted_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS redaction_jobs (
+    id varchar(36),
+    tenant_id varchar(36) NOT NULL,
+    event_type varchar(100) NOT NULL,
+    since timestamptz NOT NULL,
+    until timestamptz NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts bigint NOT NULL DEFAULT 0,
+    error text,
+    last_event_id bigint NOT NULL DEFAULT 0,
+    events_redacted bigint NOT NULL DEFAULT 0,
+    heartbeat_at timestamptz,
+    started_at timestamptz,
+    completed_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_redaction_jobs_status ON redaction_jobs (status);
+CREATE INDEX IF NOT EXISTS idx_redaction_jobs_tenant_id ON redaction_jobs (tenant_id);
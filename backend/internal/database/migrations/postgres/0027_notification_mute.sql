@@ -0,0 +1,5 @@
+-- Per-tenant notification mute
+
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS notifications_muted boolean NOT NULL DEFAULT false;
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS notifications_muted_at timestamptz;
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS notifications_muted_until timestamptz;
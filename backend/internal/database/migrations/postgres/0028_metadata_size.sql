@@ -0,0 +1,4 @@
+-- Metadata size of each event. Migrate fills it in for events stored
+-- before it existed.
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS metadata_size bigint NOT NULL DEFAULT 0;
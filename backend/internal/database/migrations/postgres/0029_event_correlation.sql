@@ -0,0 +1,5 @@
+-- Correlation and causation IDs of events
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS causation_id varchar(128);
+ALTER TABLE events ADD COLUMN IF NOT EXISTS correlation_id varchar(128);
+CREATE INDEX IF NOT EXISTS idx_events_tenant_correlation ON events (tenant_id, correlation_id);
@@ -0,0 +1,3 @@
+-- When a webhook was paused
+
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS paused_at timestamptz;
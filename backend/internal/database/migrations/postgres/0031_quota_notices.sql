@@ -0,0 +1,11 @@
+-- System events, and the quota thresholds each tenant was notified of
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS is_system boolean NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS quota_notices (
+    tenant_id varchar(36),
+    month varchar(7),
+    threshold bigint,
+    created_at timestamptz,
+    PRIMARY KEY (tenant_id, month, threshold)
+);
@@ -0,0 +1,15 @@
+-- Compression and parts of export archives
+
+ALTER TABLE export_jobs ADD COLUMN IF NOT EXISTS compression varchar(10) NOT NULL DEFAULT 'gzip';
+
+CREATE TABLE IF NOT EXISTS export_parts (
+    job_id varchar(36),
+    number bigint,
+    object_key varchar(500) NOT NULL,
+    events bigint NOT NULL,
+    size bigint NOT NULL,
+    sha256 varchar(64) NOT NULL,
+    last_event_id bigint NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (job_id, number)
+);
@@ -0,0 +1,7 @@
+-- Head of the audit log's hash chain, locked by every append
+
+CREATE TABLE IF NOT EXISTS audit_chain_heads (
+    id bigint,
+    hash varchar(64) NOT NULL,
+    PRIMARY KEY (id)
+);
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func openTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	db, err := NewDatabase("sqlite", filepath.Join(t.TempDir(), "events.db"), 1, 1, time.Hour, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestApplySQLMigrations(t *testing.T) {
+	db := openTestDatabase(t)
+	files := fstest.MapFS{
+		"0002_widgets_color.sql": {Data: []byte("ALTER TABLE widgets ADD COLUMN color TEXT;\nCREATE INDEX idx_widgets_color ON widgets (color);\n")},
+		"0001_widgets.sql":       {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY);\n")},
+		"README":                 {Data: []byte("not a migration")},
+	}
+
+	pending, err := db.pendingSQLMigrations(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0001_widgets", "0002_widgets_color"}; !reflect.DeepEqual(pending, want) {
+		t.Fatalf("pending before migrating = %v, want %v", pending, want)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := db.applySQLMigrations(files); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+	}
+	if !db.DB.Migrator().HasColumn("widgets", "color") {
+		t.Fatal("widgets.color was not added")
+	}
+	pending, err = db.pendingSQLMigrations(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("pending after migrating = %v, want none", pending)
+	}
+}
+
+func TestApplySQLMigrationsRollsBackAFailedFile(t *testing.T) {
+	db := openTestDatabase(t)
+	files := fstest.MapFS{
+		"0001_widgets.sql": {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY);\n")},
+		"0002_broken.sql":  {Data: []byte("CREATE TABLE gadgets (id INTEGER PRIMARY KEY);\nALTER TABLE missing ADD COLUMN color TEXT;\n")},
+	}
+
+	err := db.applySQLMigrations(files)
+	if err == nil || !strings.Contains(err.Error(), "0002_broken") {
+		t.Fatalf("err = %v, want the failure of 0002_broken", err)
+	}
+	if db.DB.Migrator().HasTable("gadgets") {
+		t.Error("the failed migration's first statement was kept")
+	}
+	pending, err := db.pendingSQLMigrations(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0002_broken"}; !reflect.DeepEqual(pending, want) {
+		t.Fatalf("pending = %v, want %v", pending, want)
+	}
+}
+
+var (
+	migrationName      = regexp.MustCompile(`^\d{4}_[a-z0-9_]+$`)
+	createTable        = regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS (\w+) \((.*?)\n\);`)
+	addColumn          = regexp.MustCompile(`ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS "?(\w+)"?`)
+	createIndex        = regexp.MustCompile(`CREATE (?:UNIQUE )?INDEX IF NOT EXISTS (\w+) ON (\w+)`)
+	columnOfCreateLine = regexp.MustCompile(`^\s*"?(\w+)"? `)
+)
+
+// TestPostgresMigrationsCoverModels checks that the PostgreSQL migrations
+// create every table, column and index of migratedModels, so a model
+// change without a migration fails here rather than on a deployment
+func TestPostgresMigrationsCoverModels(t *testing.T) {
+	files := driverMigrations("postgres")
+	versions, err := sqlMigrations(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, indexes := map[string]bool{}, map[string]bool{}
+	for i, version := range versions {
+		if !migrationName.MatchString(version) {
+			t.Errorf("migration %s is not named NNNN_description.sql", version)
+		}
+		if !strings.HasPrefix(version, fmt.Sprintf("%04d_", i+1)) {
+			t.Errorf("migration %s is numbered out of sequence", version)
+		}
+		sql, err := fs.ReadFile(files, version+".sql")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range createTable.FindAllStringSubmatch(string(sql), -1) {
+			for _, line := range strings.Split(m[2], "\n") {
+				if c := columnOfCreateLine.FindStringSubmatch(line); c != nil && c[1] != "PRIMARY" && c[1] != "CONSTRAINT" {
+					columns[m[1]+"."+c[1]] = true
+				}
+			}
+		}
+		for _, m := range addColumn.FindAllStringSubmatch(string(sql), -1) {
+			columns[m[1]+"."+m[2]] = true
+		}
+		for _, m := range createIndex.FindAllStringSubmatch(string(sql), -1) {
+			indexes[m[2]+"."+m[1]] = true
+		}
+	}
+
+	db := openTestDatabase(t)
+	for _, model := range migratedModels {
+		stmt := &gorm.Statement{DB: db.DB}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		table := stmt.Schema.Table
+		for _, column := range stmt.Schema.DBNames {
+			if !columns[table+"."+column] {
+				t.Errorf("no PostgreSQL migration adds %s.%s", table, column)
+			}
+		}
+		for name := range stmt.Schema.ParseIndexes() {
+			if !indexes[table+"."+name] {
+				t.Errorf("no PostgreSQL migration creates index %s on %s", name, table)
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAcquireTimeout is returned when no pooled connection frees up within
+// the acquisition timeout
+var ErrAcquireTimeout = errors.New("timed out waiting for a database connection")
+
+// PoolStats is the connection pool's state
+type PoolStats struct {
+	MaxOpen      int     `json:"max_open"`
+	Open         int     `json:"open"`
+	InUse        int     `json:"in_use"`
+	Idle         int     `json:"idle"`
+	Saturation   float64 `json:"saturation"`
+	WaitCount    int64   `json:"wait_count"`
+	WaitDuration string  `json:"wait_duration"`
+	// AcquireTimeout is "0s" when queries wait as long as their request
+	AcquireTimeout    string `json:"acquire_timeout"`
+	AcquireTimeouts   int64  `json:"acquire_timeouts"`
+	MaxIdleClosed     int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64  `json:"max_lifetime_closed"`
+}
+
+// timedPool is the connection pool as GORM sees it when an acquisition
+// timeout is set. Each statement and transaction first takes a connection
+// of its own, giving up after timeout rather than queueing for as long as
+// its context allows.
+type timedPool struct {
+	db       *sql.DB
+	timeout  time.Duration
+	timeouts *atomic.Int64
+}
+
+var (
+	_ gorm.ConnPool         = (*timedPool)(nil)
+	_ gorm.ConnPoolBeginner = (*timedPool)(nil)
+	_ gorm.GetDBConnector   = (*timedPool)(nil)
+	_ gorm.TxCommitter      = (*timedTx)(nil)
+)
+
+// conn takes a connection from the pool. Running out of the acquisition
+// timeout is ErrAcquireTimeout; ctx ending first is its own error.
+func (p *timedPool) conn(ctx context.Context) (*sql.Conn, error) {
+	acquireCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	conn, err := p.db.Conn(acquireCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		p.timeouts.Add(1)
+		return nil, ErrAcquireTimeout
+	}
+	return conn, err
+}
+
+// GetDBConn lets gorm.DB.DB return the underlying pool
+func (p *timedPool) GetDBConn() (*sql.DB, error) {
+	return p.db, nil
+}
+
+// PrepareContext is only used with prepared statement caching, which holds
+// statements across connections, so it isn't limited
+func (p *timedPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.db.PrepareContext(ctx, query)
+}
+
+func (p *timedPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	conn, err := p.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.ExecContext(ctx, query, args...)
+}
+
+// QueryContext hands the connection back once the rows are closed
+func (p *timedPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	conn, err := p.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Close waits for the rows to be closed
+	go conn.Close()
+	return rows, nil
+}
+
+// QueryRowContext can't report an acquisition timeout through *sql.Row, so
+// on one it falls back to waiting on the pool as usual
+func (p *timedPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	conn, err := p.conn(ctx)
+	if err != nil {
+		return p.db.QueryRowContext(ctx, query, args...)
+	}
+	row := conn.QueryRowContext(ctx, query, args...)
+	go conn.Close()
+	return row
+}
+
+func (p *timedPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	conn, err := p.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := conn.BeginTx(ctx, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &timedTx{Tx: tx, conn: conn}, nil
+}
+
+// timedTx is a transaction on a connection timedPool took, which it hands
+// back when the transaction ends
+type timedTx struct {
+	*sql.Tx
+	conn *sql.Conn
+}
+
+func (t *timedTx) Commit() error {
+	defer t.conn.Close()
+	return t.Tx.Commit()
+}
+
+func (t *timedTx) Rollback() error {
+	defer t.conn.Close()
+	return t.Tx.Rollback()
+}
+
+// PoolStats returns the connection pool's state
+func (d *Database) PoolStats() (PoolStats, error) {
+	sqlDB, err := d.DB.DB()
+	if err != nil {
+		return PoolStats{}, err
+	}
+	stats := sqlDB.Stats()
+	ps := PoolStats{
+		MaxOpen:           stats.MaxOpenConnections,
+		Open:              stats.OpenConnections,
+		InUse:             stats.InUse,
+		Idle:              stats.Idle,
+		WaitCount:         stats.WaitCount,
+		WaitDuration:      stats.WaitDuration.String(),
+		AcquireTimeout:    d.acquireTimeout.String(),
+		AcquireTimeouts:   d.acquireTimeouts.Load(),
+		MaxIdleClosed:     stats.MaxIdleClosed,
+		MaxIdleTimeClosed: stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed: stats.MaxLifetimeClosed,
+	}
+	if stats.MaxOpenConnections > 0 {
+		ps.Saturation = float64(stats.InUse) / float64(stats.MaxOpenConnections)
+	}
+	return ps, nil
+}
+
+// MonitorPool calls record with the pool's state every interval until ctx
+// is done
+func (d *Database) MonitorPool(ctx context.Context, interval time.Duration, record func(PoolStats)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats, err := d.PoolStats()
+			if err != nil {
+				d.logger.Warn("Failed to read connection pool stats", "error", err)
+				continue
+			}
+			record(stats)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"time"
+
+	"event-ingestion-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// RedactEvent replaces the metadata of one of a tenant's events with
+// models.RedactedMetadata, keeping the event itself. Redacting an event
+// again changes nothing; redacted reports whether this call redacted it.
+func (d *Database) RedactEvent(tenantID string, id uint, at time.Time) (event *models.Event, redacted bool, err error) {
+	result := d.DB.Model(&models.Event{}).
+		Where("tenant_id = ? AND id = ? AND redacted_at IS NULL", tenantID, id).
+		UpdateColumns(redactedColumns(at))
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	event, err = d.GetEvent(tenantID, id)
+	if err != nil {
+		return nil, false, err
+	}
+	return event, result.RowsAffected == 1, nil
+}
+
+// redactedColumns are the updates that redact an event at
+func redactedColumns(at time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata":          models.RedactedMetadata(at),
+		"metadata_encoding": models.MetadataPlain,
+		"metadata_size":     len(models.RedactedMetadata(at)),
+		"redacted_at":       at,
+	}
+}
+
+// CreateRedactionJob queues a redaction
+func (d *Database) CreateRedactionJob(job *models.RedactionJob) error {
+	job.Status = models.JobPending
+	return d.DB.Create(job).Error
+}
+
+// GetRedactionJob retrieves a tenant's redaction job by ID
+func (d *Database) GetRedactionJob(tenantID, id string) (*models.RedactionJob, error) {
+	var job models.RedactionJob
+	err := d.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FinishRedactionJob records that a running attempt of a redaction
+// completed, failed, or is pending to be retried. Outcomes of attempts that
+// were taken over are ignored.
+func (d *Database) FinishRedactionJob(job *models.RedactionJob, at time.Time) error {
+	updates := map[string]interface{}{
+		"status":       job.Status,
+		"error":        job.Error,
+		"heartbeat_at": nil,
+	}
+	if job.Status != models.JobPending {
+		updates["completed_at"] = at
+	}
+	return d.DB.Model(&models.RedactionJob{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, models.JobRunning, job.Attempts).
+		Updates(updates).Error
+}
+
+// RedactEventsBatch redacts up to limit of the job's events after its
+// LastEventID, in ID order, together with the job's progress, all or none.
+// It returns the IDs it redacted; fewer than limit means the job is done.
+// The job's counters are updated in place.
+func (d *Database) RedactEventsBatch(job *models.RedactionJob, limit int, at time.Time) ([]uint, error) {
+	var ids []uint
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Event{}).
+			Where("tenant_id = ? AND event_type = ? AND timestamp >= ? AND timestamp < ?", job.TenantID, job.EventType, job.Since, job.Until).
+			Where("id > ? AND redacted_at IS NULL", job.LastEventID).
+			Order("id ASC").
+			Limit(limit).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.Model(&models.Event{}).Where("id IN ? AND redacted_at IS NULL", ids).UpdateColumns(redactedColumns(at)).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&models.RedactionJob{}).
+			Where("id = ? AND status = ? AND attempts = ?", job.ID, models.JobRunning, job.Attempts).
+			Updates(map[string]interface{}{
+				"last_event_id":   ids[len(ids)-1],
+				"events_redacted": job.EventsRedacted + int64(len(ids)),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrJobTakenOver
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		job.LastEventID = ids[len(ids)-1]
+		job.EventsRedacted += int64(len(ids))
+	}
+	return ids, nil
+}
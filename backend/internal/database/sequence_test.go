@@ -0,0 +1,88 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/models"
+)
+
+func newEvent(tenantID string) models.Event {
+	return models.Event{TenantID: tenantID, EventType: "sequence.test", Timestamp: time.Now().UTC(), Metadata: "{}"}
+}
+
+// TestSequencesHaveNoGapsUnderConcurrentInserts ingests from 50 goroutines
+// at once, single events and batches spanning two tenants, and checks that
+// each tenant's sequence runs from 1 without gaps or duplicates and that
+// every batch got a contiguous range
+func TestSequencesHaveNoGapsUnderConcurrentInserts(t *testing.T) {
+	const (
+		goroutines = 50
+		rounds     = 10
+	)
+	db, err := NewDatabase("sqlite", filepath.Join(t.TempDir(), "events.db"), 8, 8, time.Hour, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	tenants := []string{"tenant-a", "tenant-b"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				event := newEvent(tenants[(g+r)%2])
+				if err := db.CreateEvent(&event); err != nil {
+					errs <- err
+					return
+				}
+				batch := []models.Event{newEvent("tenant-a"), newEvent("tenant-b"), newEvent("tenant-a")}
+				if err := db.CreateEvents(batch, 100); err != nil {
+					errs <- err
+					return
+				}
+				if batch[2].Sequence != batch[0].Sequence+1 {
+					errs <- fmt.Errorf("batch got tenant-a sequences %d and %d, want a contiguous range", batch[0].Sequence, batch[2].Sequence)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// Each round stores one single event per goroutine, spread evenly, and
+	// two tenant-a and one tenant-b events in its batch
+	want := map[string]int{
+		"tenant-a": goroutines*rounds/2 + 2*goroutines*rounds,
+		"tenant-b": goroutines*rounds/2 + goroutines*rounds,
+	}
+	for _, tenantID := range tenants {
+		var sequences []uint64
+		if err := db.DB.Model(&models.Event{}).Where("tenant_id = ?", tenantID).Order("sequence").Pluck("sequence", &sequences).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(sequences) != want[tenantID] {
+			t.Fatalf("%s has %d events, want %d", tenantID, len(sequences), want[tenantID])
+		}
+		for i, seq := range sequences {
+			if seq != uint64(i+1) {
+				t.Fatalf("%s: sequence %d at position %d, want %d: a gap or duplicate", tenantID, seq, i+1, i+1)
+			}
+		}
+	}
+}
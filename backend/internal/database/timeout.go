@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrQueryTimeout is returned when an event search runs past the query
+// timeout. The query is cancelled, freeing its connection.
+var ErrQueryTimeout = errors.New("query ran past its timeout")
+
+// WithQueryTimeout returns a copy of the database whose event searches give
+// up after timeout with ErrQueryTimeout; 0 leaves them unbounded
+func (d *Database) WithQueryTimeout(timeout time.Duration) *Database {
+	clone := *d
+	clone.queryTimeout = timeout
+	clone.statementTimeout = false
+	return &clone
+}
+
+// WithStatementTimeout is WithQueryTimeout for long-running readers such as
+// exports. On PostgreSQL each search also runs in a transaction with
+// statement_timeout set, so the server stops it even if the cancellation
+// never reaches it.
+func (d *Database) WithStatementTimeout(timeout time.Duration) *Database {
+	clone := d.WithQueryTimeout(timeout)
+	clone.statementTimeout = true
+	return clone
+}
+
+// bounded runs a search under the query timeout. Running out of it is
+// ErrQueryTimeout; the caller's context ending first is left as it is.
+func (d *Database) bounded(fn func(db *gorm.DB) error) error {
+	if d.queryTimeout <= 0 {
+		return fn(d.DB)
+	}
+	parent := d.DB.Statement.Context
+	ctx, cancel := context.WithTimeout(parent, d.queryTimeout)
+	defer cancel()
+	db := d.DB.WithContext(ctx)
+
+	var err error
+	if stmt := d.dialect.statementTimeout(d.queryTimeout); d.statementTimeout && stmt != "" {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+			return fn(tx)
+		})
+	} else {
+		err = fn(db)
+	}
+	if err != nil && parent.Err() == nil &&
+		(errors.Is(ctx.Err(), context.DeadlineExceeded) || d.dialect.isStatementTimeout(err)) {
+		return ErrQueryTimeout
+	}
+	return err
+}
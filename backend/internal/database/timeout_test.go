@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TestQueryTimeoutFreesTheConnection runs a query that never finishes on
+// a pool of one connection. The timeout must end it with ErrQueryTimeout
+// and give the connection back, or the next query would wait forever.
+func TestQueryTimeoutFreesTheConnection(t *testing.T) {
+	forEachTestDriver(t, func(t *testing.T, driver testDriver) {
+		db := openDriver(t, driver)
+		sqlDB, err := db.DB.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sqlDB.SetMaxOpenConns(1)
+
+		for _, tc := range []struct {
+			name string
+			db   *Database
+		}{
+			{"query timeout", db.WithQueryTimeout(200 * time.Millisecond)},
+			// On PostgreSQL the server also stops the statement
+			{"statement timeout", db.WithStatementTimeout(200 * time.Millisecond)},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				start := time.Now()
+				err := tc.db.bounded(func(db *gorm.DB) error {
+					var n int64
+					return db.Raw(driver.slowQuery).Scan(&n).Error
+				})
+				if !errors.Is(err, ErrQueryTimeout) {
+					t.Fatalf("slow query returned %v, want ErrQueryTimeout", err)
+				}
+				if elapsed := time.Since(start); elapsed > 5*time.Second {
+					t.Fatalf("slow query took %s to be cancelled", elapsed)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				defer cancel()
+				var one int
+				if err := db.DB.WithContext(ctx).Raw("SELECT 1").Scan(&one).Error; err != nil || one != 1 {
+					t.Fatalf("next query on the pool: %d: %v", one, err)
+				}
+				if inUse := sqlDB.Stats().InUse; inUse != 0 {
+					t.Fatalf("%d connections still in use", inUse)
+				}
+			})
+		}
+
+		// The caller's own deadline is not a query timeout
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err = db.WithContext(ctx).WithQueryTimeout(time.Minute).bounded(func(db *gorm.DB) error {
+			var n int64
+			return db.Raw(driver.slowQuery).Scan(&n).Error
+		})
+		if err == nil || errors.Is(err, ErrQueryTimeout) {
+			t.Fatalf("cancelled by the caller: %v, want the context's error", err)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// StaleVersionError is returned by a conditional update of a row whose
+// version is no longer the one expected
+type StaleVersionError struct {
+	Current int64
+}
+
+func (e *StaleVersionError) Error() string {
+	return fmt.Sprintf("stale version: current version is %d", e.Current)
+}
+
+// bumpVersion is the assignment every versioned update makes
+var bumpVersion = gorm.Expr("version + 1")
+
+// checkVersion explains a conditional update of the row model matches
+// under query that changed nothing: the row is gone, or its version moved
+// on. query must not be conditioned on the version.
+func checkVersion(query *gorm.DB, model interface{}) error {
+	var current []int64
+	if err := query.Model(model).Limit(1).Pluck("version", &current).Error; err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return &StaleVersionError{Current: current[0]}
+}
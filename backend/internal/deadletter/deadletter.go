@@ -0,0 +1,219 @@
+// Package deadletter keeps events that could not be stored, and deliveries
+// that sinks or webhooks finally rejected, so operators can inspect and
+// retry them instead of losing them.
+package deadletter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+)
+
+const (
+	// writeTimeout bounds the database write of one dead letter; the
+	// caller's context may be the one that just expired
+	writeTimeout = 2 * time.Second
+	// maintenanceInterval is how often the spill file is imported and
+	// expired dead letters are purged
+	maintenanceInterval = time.Minute
+)
+
+// Store records dead letters in the database, or in a spill file while the
+// database is unavailable. A nil *Store records nothing.
+type Store struct {
+	db        *database.Database
+	spillFile string
+	retention time.Duration
+	logger    *slog.Logger
+
+	// spillMu serialises access to the spill file
+	spillMu sync.Mutex
+}
+
+// NewStore creates a dead letter store
+func NewStore(db *database.Database, cfg config.DeadLettersConfig, logger *slog.Logger) *Store {
+	return &Store{
+		db:        db,
+		spillFile: cfg.SpillFile,
+		retention: cfg.Retention,
+		logger:    logger.With("component", "dead_letters"),
+	}
+}
+
+// Ingest describes an event request that could not be stored
+func Ingest(req models.EventRequest, cause error) models.DeadLetter {
+	payload, _ := json.Marshal(req)
+	return newLetter(models.DeadLetterIngest, req.TenantID, "", 0, payload, 1, cause)
+}
+
+// Sink describes an event a sink failed to publish
+func Sink(name string, event *models.Event, cause error) models.DeadLetter {
+	payload, _ := json.Marshal(event.ToEventResponse())
+	return newLetter(models.DeadLetterSink, event.TenantID, name, event.ID, payload, 1, cause)
+}
+
+// Webhook describes a webhook delivery that failed after every attempt
+func Webhook(webhookID uint, event *models.Event, body []byte, attempts int, cause error) models.DeadLetter {
+	target := strconv.FormatUint(uint64(webhookID), 10)
+	return newLetter(models.DeadLetterWebhook, event.TenantID, target, event.ID, body, attempts, cause)
+}
+
+func newLetter(source, tenantID, target string, eventID uint, payload []byte, attempts int, cause error) models.DeadLetter {
+	now := time.Now().UTC()
+	return models.DeadLetter{
+		TenantID:    tenantID,
+		Source:      source,
+		Target:      target,
+		EventID:     eventID,
+		Payload:     string(payload),
+		Error:       cause.Error(),
+		Attempts:    attempts,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+}
+
+// Record stores a dead letter, falling back to the spill file when the
+// database write fails. It never fails the caller; a letter that cannot be
+// written anywhere is logged.
+func (s *Store) Record(ctx context.Context, letter models.DeadLetter) {
+	if s == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), writeTimeout)
+	defer cancel()
+	err := s.db.WithContext(ctx).CreateDeadLetters([]models.DeadLetter{letter})
+	if err == nil {
+		metrics.DeadLetter(letter.Source, "stored")
+		return
+	}
+
+	if spillErr := s.spill(letter); spillErr != nil {
+		metrics.DeadLetter(letter.Source, "lost")
+		s.logger.ErrorContext(ctx, "Failed to record dead letter",
+			"source", letter.Source, "tenant_id", letter.TenantID, "event_id", letter.EventID,
+			"cause", letter.Error, "error", err, "spill_error", spillErr)
+		return
+	}
+	metrics.DeadLetter(letter.Source, "spilled")
+	s.logger.WarnContext(ctx, "Database unavailable, dead letter spilled to file", "source", letter.Source, "file", s.spillFile, "error", err)
+}
+
+// spill appends a dead letter to the spill file as one JSON line
+func (s *Store) spill(letter models.DeadLetter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.spillFile), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.spillFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Run imports the spill file once at start and then periodically, until ctx
+// is cancelled. Every replica has its own spill file to import.
+func (s *Store) Run(ctx context.Context) {
+	s.every(ctx, func() {
+		if n, err := s.importSpill(ctx); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to import spilled dead letters", "file", s.spillFile, "error", err)
+		} else if n > 0 {
+			s.logger.InfoContext(ctx, "Imported spilled dead letters", "count", n)
+		}
+	})
+}
+
+// RunPurge purges expired dead letters once at start and then
+// periodically, until ctx is cancelled. One replica purging is enough.
+func (s *Store) RunPurge(ctx context.Context) {
+	s.every(ctx, func() {
+		cutoff := time.Now().UTC().Add(-s.retention)
+		if n, err := s.db.WithContext(ctx).PurgeDeadLetters(cutoff); err != nil {
+			if ctx.Err() == nil {
+				s.logger.ErrorContext(ctx, "Failed to purge dead letters", "error", err)
+			}
+		} else if n > 0 {
+			s.logger.InfoContext(ctx, "Purged expired dead letters", "count", n)
+		}
+	})
+}
+
+// every calls fn at once and then every maintenanceInterval until ctx is
+// cancelled
+func (s *Store) every(ctx context.Context, fn func()) {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		fn()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// importSpill moves the spilled dead letters into the database in one
+// transaction and empties the file. Lines that do not parse are skipped.
+func (s *Store) importSpill(ctx context.Context) (int, error) {
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+
+	f, err := os.Open(s.spillFile)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var letters []models.DeadLetter
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var letter models.DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			s.logger.WarnContext(ctx, "Skipping unreadable spilled dead letter", "file", s.spillFile, "line", line, "error", err)
+			continue
+		}
+		letter.ID = 0
+		letters = append(letters, letter)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("read spill file: %w", err)
+	}
+
+	if len(letters) > 0 {
+		if err := s.db.WithContext(ctx).CreateDeadLetters(letters); err != nil {
+			return 0, err
+		}
+	}
+	return len(letters), os.Remove(s.spillFile)
+}
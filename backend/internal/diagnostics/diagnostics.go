@@ -0,0 +1,83 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sync"
+
+	"event-ingestion-system/internal/sink"
+	"event-ingestion-system/internal/webhook"
+	"event-ingestion-system/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sources provides the runtime state exposed on the debug listener
+type Sources struct {
+	Hub        *websocket.Hub
+	Dispatcher *webhook.Dispatcher
+	Sinks      *sink.Pipeline
+	Routes     func() gin.RoutesInfo
+}
+
+var publishOnce sync.Once
+
+// Handler returns the debug mux: net/http/pprof under /debug/pprof/, expvar
+// under /debug/vars, plus /debug/goroutines and /debug/routes. It must only be
+// served on a separate, non-public listener.
+func Handler(src Sources) http.Handler {
+	// expvar names are process-global and cannot be registered twice
+	publishOnce.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() interface{} {
+			return runtime.NumGoroutine()
+		}))
+		expvar.Publish("hub", expvar.Func(func() interface{} {
+			return src.Hub.Stats()
+		}))
+		expvar.Publish("webhook_queue_depth", expvar.Func(func() interface{} {
+			return src.Dispatcher.QueueDepth()
+		}))
+		expvar.Publish("webhook_held_deliveries", expvar.Func(func() interface{} {
+			return src.Dispatcher.HeldDeliveries()
+		}))
+		expvar.Publish("sink_queue_depth", expvar.Func(func() interface{} {
+			return src.Sinks.QueueDepths()
+		}))
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	// Full stack of every goroutine, for spotting leaked WebSocket pumps
+	mux.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+
+	mux.HandleFunc("/debug/routes", func(w http.ResponseWriter, r *http.Request) {
+		// RouteInfo carries the handler func, which cannot be JSON encoded
+		type route struct {
+			Method  string `json:"method"`
+			Path    string `json:"path"`
+			Handler string `json:"handler"`
+		}
+		routes := []route{}
+		for _, ri := range src.Routes() {
+			routes = append(routes, route{Method: ri.Method, Path: ri.Path, Handler: ri.Handler})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"routes": routes})
+	})
+
+	return mux
+}
@@ -3,6 +3,8 @@ package errors
 import (
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // ErrorCode represents a structured error code
@@ -14,7 +16,15 @@ const (
 	CodeInvalidTenantID  ErrorCode = "invalid_tenant_id"
 	CodeInvalidEventType ErrorCode = "invalid_event_type"
 	CodeInvalidTimestamp ErrorCode = "invalid_timestamp"
+	CodeInvalidTimeZone  ErrorCode = "invalid_time_zone"
 	CodeInvalidMetadata  ErrorCode = "invalid_metadata"
+	CodeTransformFailed  ErrorCode = "transform_failed"
+	// CodeMetadataSearchUnsupported rejects a metadata search over events
+	// whose metadata is stored compressed
+	CodeMetadataSearchUnsupported ErrorCode = "metadata_search_unsupported"
+	// CodeBatchRejected rejects an atomic batch some of whose events are
+	// invalid
+	CodeBatchRejected ErrorCode = "batch_rejected"
 
 	// Authentication errors (401)
 	CodeUnauthorized  ErrorCode = "unauthorized"
@@ -22,29 +32,123 @@ const (
 	CodeExpiredToken  ErrorCode = "expired_token"
 	CodeMissingAuth   ErrorCode = "missing_authentication"
 
+	// Authorization errors (403)
+	CodeForbidden ErrorCode = "forbidden"
+
 	// Not found errors (404)
-	CodeTenantNotFound ErrorCode = "tenant_not_found"
-	CodeEventNotFound  ErrorCode = "event_not_found"
+	CodeTenantNotFound        ErrorCode = "tenant_not_found"
+	CodeEventNotFound         ErrorCode = "event_not_found"
+	CodeWebhookNotFound       ErrorCode = "webhook_not_found"
+	CodeDeadLetterNotFound    ErrorCode = "dead_letter_not_found"
+	CodeViewNotFound          ErrorCode = "view_not_found"
+	CodeReportNotFound        ErrorCode = "report_not_found"
+	CodeAlertNotFound         ErrorCode = "alert_not_found"
+	CodeImpersonationNotFound ErrorCode = "impersonation_not_found"
+	CodeUserNotFound          ErrorCode = "user_not_found"
+	CodeExportNotFound        ErrorCode = "export_not_found"
+	CodeArchiveNotFound       ErrorCode = "archive_not_found"
+	CodeImportNotFound        ErrorCode = "import_not_found"
+	CodeRedactionNotFound     ErrorCode = "redaction_not_found"
+	CodeFlagNotFound          ErrorCode = "flag_not_found"
+	CodeRouteNotFound         ErrorCode = "route_not_found"
+
+	// Method errors (405)
+	CodeMethodNotAllowed ErrorCode = "method_not_allowed"
 
 	// Conflict errors (409)
-	CodeTenantExists ErrorCode = "tenant_exists"
+	CodeTenantExists     ErrorCode = "tenant_exists"
+	CodeTenantNotDeleted ErrorCode = "tenant_not_deleted"
+	CodeOffsetBehind     ErrorCode = "offset_behind"
+	CodeViewExists       ErrorCode = "view_exists"
+	CodeWebhookExists    ErrorCode = "webhook_exists"
+	CodeUserExists       ErrorCode = "user_exists"
+	CodeExportInProgress ErrorCode = "export_in_progress"
+	CodeTenantNotEmpty   ErrorCode = "tenant_not_empty"
+	CodeImportNotFailed  ErrorCode = "import_not_failed"
+	CodeDrainInProgress  ErrorCode = "drain_in_progress"
+	CodeWriteConflict    ErrorCode = "write_conflict"
+	// CodeConflictStaleVersion rejects an update made against an outdated
+	// version of the resource
+	CodeConflictStaleVersion ErrorCode = "stale_version"
+
+	// Precondition errors (428)
+	CodeVersionRequired ErrorCode = "version_required"
 
 	// Rate limit errors (429)
 	CodeRateLimitExceeded ErrorCode = "rate_limit_exceeded"
+	CodeQuotaExceeded     ErrorCode = "quota_exceeded"
 
 	// Server errors (500)
 	CodeInternalError  ErrorCode = "internal_error"
 	CodeDatabaseError  ErrorCode = "database_error"
 	CodeWebSocketError ErrorCode = "websocket_error"
+
+	// Not implemented errors (501)
+	CodeEventStoreUnsupported ErrorCode = "event_store_unsupported"
+
+	// Unavailable errors (503)
+	CodeMaintenanceMode  ErrorCode = "maintenance_mode"
+	CodeIngestBufferFull ErrorCode = "ingest_buffer_full"
+	CodeDatabaseBusy     ErrorCode = "database_busy"
+	CodeDraining         ErrorCode = "draining"
+	CodeOverloaded       ErrorCode = "overloaded"
+
+	// Timeout errors (504)
+	CodeTimeout      ErrorCode = "request_timeout"
+	CodeQueryTimeout ErrorCode = "query_timeout"
 )
 
 // AppError represents a structured application error
 type AppError struct {
-	Code       ErrorCode `json:"code"`
-	Message    string    `json:"message"`
-	Details    string    `json:"details,omitempty"`
-	StatusCode int       `json:"-"`
-	Internal   error     `json:"-"`
+	Code       ErrorCode      `json:"code"`
+	Message    string         `json:"message"`
+	Details    string         `json:"details,omitempty"`
+	Fields     []FieldError   `json:"fields,omitempty"` // invalid fields of a rejected request
+	Meta       map[string]any `json:"meta,omitempty"`   // machine-readable context, see the Meta keys
+	StatusCode int            `json:"-"`
+	Internal   error          `json:"-"`
+	RequestID  string         `json:"-"`
+	// DetailsKey names the catalog entry i18n translates Details with,
+	// Params the values of its {placeholders}; without one the details
+	// stay in English
+	DetailsKey string            `json:"-"`
+	Params     map[string]string `json:"-"`
+}
+
+// Meta keys. ErrorHandler mirrors them in the Retry-After and rate limit
+// response headers.
+const (
+	// MetaRetryAfter is the whole seconds to wait before retrying (int)
+	MetaRetryAfter = "retry_after_seconds"
+	// MetaLimit is the requests allowed per window (int)
+	MetaLimit = "limit"
+	// MetaRemaining is the requests left in the window (int)
+	MetaRemaining = "remaining"
+	// MetaReset is when another request will be allowed (time.Time)
+	MetaReset = "reset"
+	// MetaCurrentVersion is the resource's version an update must name
+	// (int64)
+	MetaCurrentVersion = "current_version"
+	// MetaTraceID is the ID of the sampled trace of a request that failed
+	// with a 5xx status (string)
+	MetaTraceID = "trace_id"
+	// MetaAckedThroughLine is the last line of an event stream whose
+	// outcome is settled when the stream failed (int)
+	MetaAckedThroughLine = "acked_through_line"
+	// MetaRejected is the number of events of a batch that were rejected
+	// (int)
+	MetaRejected = "rejected"
+)
+
+// FieldError describes one invalid field of a request. Field is the JSON
+// path, Rule the check that failed.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	// Key and Params translate Message, as DetailsKey does Details
+	Key    string            `json:"-"`
+	Params map[string]string `json:"-"`
 }
 
 // NewAppError creates a new application error
@@ -63,6 +167,16 @@ func ErrInvalidRequest(details string) *AppError {
 	return NewAppError(CodeInvalidRequest, "Invalid request", details, http.StatusBadRequest, nil)
 }
 
+// ErrValidation reports invalid fields. Details repeats them as one string
+// for clients that predate fields.
+func ErrValidation(fields []FieldError) *AppError {
+	details := make([]string, len(fields))
+	for i, f := range fields {
+		details[i] = f.Field + ": " + f.Message
+	}
+	return NewAppError(CodeInvalidRequest, "Invalid request", strings.Join(details, "; "), http.StatusBadRequest, nil).WithFields(fields...)
+}
+
 func ErrBadTenantID(details string) *AppError {
 	return NewAppError(CodeInvalidTenantID, "Invalid tenant ID", details, http.StatusBadRequest, nil)
 }
@@ -75,44 +189,219 @@ func ErrBadTimestamp(details string) *AppError {
 	return NewAppError(CodeInvalidTimestamp, "Invalid timestamp format", details, http.StatusBadRequest, nil)
 }
 
+// ErrBadTimeZone rejects a ?tz= that is not a zone of the tz database
+func ErrBadTimeZone(name string) *AppError {
+	return NewAppError(CodeInvalidTimeZone, "Invalid time zone", strconv.Quote(name)+" is not a time zone; use a tz database name such as Asia/Kolkata", http.StatusBadRequest, nil).translated("invalid_time_zone", "name", name).WithFields(FieldError{
+		Field: "tz", Rule: "timezone", Message: "must be a tz database name", Key: "timezone",
+	})
+}
+
 func ErrBadMetadata(details string) *AppError {
 	return NewAppError(CodeInvalidMetadata, "Invalid metadata", details, http.StatusBadRequest, nil)
 }
 
+// ErrTransformFailed rejects an event a transformation rule set to reject
+// could not apply to
+func ErrTransformFailed(details string) *AppError {
+	return NewAppError(CodeTransformFailed, "Transformation failed", details, http.StatusBadRequest, nil)
+}
+
+// ErrMetadataSearchUnsupported reports a search or tag filter over events
+// whose metadata is stored compressed, which the database cannot match
+func ErrMetadataSearchUnsupported() *AppError {
+	return NewAppError(CodeMetadataSearchUnsupported, "Metadata search unsupported", "Some of the events in range have their metadata stored compressed, which search and tag filters cannot match; narrow the range or event types, or filter without them", http.StatusBadRequest, nil).translated("metadata_search_unsupported")
+}
+
+// ErrBatchRejected rejects an atomic batch, none of which was stored, for
+// its rejected events; fields lists the errors of the first of them
+func ErrBatchRejected(rejected int, fields []FieldError) *AppError {
+	return NewAppError(CodeBatchRejected, "Batch rejected", strconv.Itoa(rejected)+" of the batch's events were rejected, so none were stored", http.StatusBadRequest, nil).
+		translated("batch_rejected", "count", strconv.Itoa(rejected)).
+		WithFields(fields...).
+		WithMeta(MetaRejected, rejected)
+}
+
 // Authentication errors
 func ErrUnauthorized(details string) *AppError {
 	return NewAppError(CodeUnauthorized, "Unauthorized", details, http.StatusUnauthorized, nil)
 }
 
 func ErrBadAPIKey() *AppError {
-	return NewAppError(CodeInvalidAPIKey, "Invalid API key", "The provided API key is not valid", http.StatusUnauthorized, nil)
+	return NewAppError(CodeInvalidAPIKey, "Invalid API key", "The provided API key is not valid", http.StatusUnauthorized, nil).translated("invalid_api_key")
 }
 
 func ErrTokenExpired() *AppError {
-	return NewAppError(CodeExpiredToken, "Token expired", "The authentication token has expired", http.StatusUnauthorized, nil)
+	return NewAppError(CodeExpiredToken, "Token expired", "The authentication token has expired", http.StatusUnauthorized, nil).translated("expired_token")
+}
+
+// ErrTenantInactive keeps the unauthorized body but responds 403, since the
+// credentials are valid and only the tenant is disabled
+func ErrTenantInactive() *AppError {
+	return NewAppError(CodeUnauthorized, "Unauthorized", "Tenant is inactive", http.StatusForbidden, nil).translated("tenant_inactive")
 }
 
 func ErrNoAuth() *AppError {
-	return NewAppError(CodeMissingAuth, "Missing authentication", "No authentication credentials provided", http.StatusUnauthorized, nil)
+	return NewAppError(CodeMissingAuth, "Missing authentication", "No authentication credentials provided", http.StatusUnauthorized, nil).translated("missing_authentication")
+}
+
+// Authorization errors
+func ErrForbidden(details string) *AppError {
+	return NewAppError(CodeForbidden, "Forbidden", details, http.StatusForbidden, nil)
 }
 
 // Not found errors
 func ErrTenantNotFound(tenantID string) *AppError {
-	return NewAppError(CodeTenantNotFound, "Tenant not found", "Tenant with ID '"+tenantID+"' was not found", http.StatusNotFound, nil)
+	return NewAppError(CodeTenantNotFound, "Tenant not found", "Tenant with ID '"+tenantID+"' was not found", http.StatusNotFound, nil).translated("tenant_not_found", "id", tenantID)
 }
 
 func ErrEventNotFound(eventID int) *AppError {
-	return NewAppError(CodeEventNotFound, "Event not found", "Event with ID '"+strconv.Itoa(eventID)+"' was not found", http.StatusNotFound, nil)
+	return NewAppError(CodeEventNotFound, "Event not found", "Event with ID '"+strconv.Itoa(eventID)+"' was not found", http.StatusNotFound, nil).translated("event_not_found", "id", strconv.Itoa(eventID))
+}
+
+func ErrWebhookNotFound(webhookID string) *AppError {
+	return NewAppError(CodeWebhookNotFound, "Webhook not found", "Webhook with ID '"+webhookID+"' was not found", http.StatusNotFound, nil).translated("webhook_not_found", "id", webhookID)
+}
+
+func ErrNamedWebhookNotFound(name string) *AppError {
+	return NewAppError(CodeWebhookNotFound, "Webhook not found", "Webhook '"+name+"' was not found", http.StatusNotFound, nil).translated("named_webhook_not_found", "name", name)
+}
+
+func ErrDeadLetterNotFound(id string) *AppError {
+	return NewAppError(CodeDeadLetterNotFound, "Dead letter not found", "Dead letter with ID '"+id+"' was not found", http.StatusNotFound, nil).translated("dead_letter_not_found", "id", id)
+}
+
+func ErrReportNotFound(id string) *AppError {
+	return NewAppError(CodeReportNotFound, "Report not found", "Report with ID '"+id+"' was not found", http.StatusNotFound, nil).translated("report_not_found", "id", id)
+}
+
+func ErrAlertNotFound(id string) *AppError {
+	return NewAppError(CodeAlertNotFound, "Alert rule not found", "Alert rule with ID '"+id+"' was not found", http.StatusNotFound, nil).translated("alert_not_found", "id", id)
+}
+
+func ErrImpersonationNotFound(id string) *AppError {
+	return NewAppError(CodeImpersonationNotFound, "Impersonation not found", "Impersonation with ID '"+id+"' was not found", http.StatusNotFound, nil).translated("impersonation_not_found", "id", id)
+}
+
+func ErrUserNotFound(id string) *AppError {
+	return NewAppError(CodeUserNotFound, "User not found", "User with ID '"+id+"' was not found", http.StatusNotFound, nil).translated("user_not_found", "id", id)
+}
+
+func ErrExportNotFound(id string) *AppError {
+	return NewAppError(CodeExportNotFound, "Export not found", "Export job with ID '"+id+"' was not found", http.StatusNotFound, nil).translated("export_not_found", "id", id)
+}
+
+func ErrArchiveNotFound() *AppError {
+	return NewAppError(CodeArchiveNotFound, "Archive not found", "The file of this download link no longer exists", http.StatusNotFound, nil).translated("archive_not_found")
+}
+
+func ErrImportNotFound(id string) *AppError {
+	return NewAppError(CodeImportNotFound, "Import not found", "Import job with ID '"+id+"' was not found", http.StatusNotFound, nil).translated("import_not_found", "id", id)
+}
+
+func ErrRedactionNotFound(id string) *AppError {
+	return NewAppError(CodeRedactionNotFound, "Redaction not found", "Redaction job with ID '"+id+"' was not found", http.StatusNotFound, nil).translated("redaction_not_found", "id", id)
+}
+
+// ErrFlagNotFound reports a feature flag the configuration does not define
+func ErrFlagNotFound(name string) *AppError {
+	return NewAppError(CodeFlagNotFound, "Feature flag not found", "Feature flag '"+name+"' is not defined", http.StatusNotFound, nil).translated("flag_not_found", "name", name)
+}
+
+func ErrRouteNotFound(method, path string) *AppError {
+	return NewAppError(CodeRouteNotFound, "Route not found", "No route matches "+method+" "+path, http.StatusNotFound, nil).translated("route_not_found", "method", method, "path", path)
+}
+
+// Method errors
+func ErrMethodNotAllowed(method, path string) *AppError {
+	return NewAppError(CodeMethodNotAllowed, "Method not allowed", method+" is not allowed on "+path, http.StatusMethodNotAllowed, nil).translated("method_not_allowed", "method", method, "path", path)
+}
+
+func ErrViewNotFound(view string) *AppError {
+	return NewAppError(CodeViewNotFound, "View not found", "View '"+view+"' was not found", http.StatusNotFound, nil).translated("view_not_found", "name", view)
 }
 
 // Conflict errors
 func ErrTenantExists(name string) *AppError {
-	return NewAppError(CodeTenantExists, "Tenant already exists", "A tenant with name '"+name+"' already exists", http.StatusConflict, nil)
+	return NewAppError(CodeTenantExists, "Tenant already exists", "A tenant with name '"+name+"' already exists", http.StatusConflict, nil).translated("tenant_exists", "name", name)
+}
+
+func ErrTenantNotDeleted(tenantID string) *AppError {
+	return NewAppError(CodeTenantNotDeleted, "Tenant is not deleted", "Tenant with ID '"+tenantID+"' has not been deleted", http.StatusConflict, nil).translated("tenant_not_deleted", "id", tenantID)
+}
+
+func ErrOffsetBehind(consumer string, current uint) *AppError {
+	return NewAppError(CodeOffsetBehind, "Commit would move the offset backwards", "Consumer '"+consumer+"' is at event "+strconv.FormatUint(uint64(current), 10)+"; pass force=true to rewind", http.StatusConflict, nil).translated("offset_behind", "consumer", consumer, "event", strconv.FormatUint(uint64(current), 10))
+}
+
+func ErrViewExists(name string) *AppError {
+	return NewAppError(CodeViewExists, "View already exists", "A view with name '"+name+"' already exists", http.StatusConflict, nil).translated("view_exists", "name", name)
+}
+
+func ErrWebhookExists(name string) *AppError {
+	return NewAppError(CodeWebhookExists, "Webhook already exists", "A webhook with name '"+name+"' already exists", http.StatusConflict, nil).translated("webhook_exists", "name", name)
+}
+
+func ErrUserExists(email string) *AppError {
+	return NewAppError(CodeUserExists, "User already exists", "A user with email '"+email+"' already exists", http.StatusConflict, nil).translated("user_exists", "email", email)
+}
+
+func ErrExportInProgress(jobID string) *AppError {
+	return NewAppError(CodeExportInProgress, "Export already in progress", "Export job '"+jobID+"' has not finished yet; only one export per tenant may run at a time", http.StatusConflict, nil).translated("export_in_progress", "id", jobID)
+}
+
+func ErrTenantNotEmpty(tenantID string) *AppError {
+	return NewAppError(CodeTenantNotEmpty, "Tenant is not empty", "Tenant with ID '"+tenantID+"' already has events, webhooks or views; imports only map into an empty tenant", http.StatusConflict, nil).translated("tenant_not_empty", "id", tenantID)
+}
+
+func ErrImportNotFailed(jobID, status string) *AppError {
+	return NewAppError(CodeImportNotFailed, "Import has not failed", "Import job '"+jobID+"' is "+status+"; only failed imports can be resumed", http.StatusConflict, nil).translated("import_not_failed", "id", jobID, "status", status)
+}
+
+// ErrDrainInProgress reports a drain requested while one is under way;
+// it runs until the instance restarts
+func ErrDrainInProgress() *AppError {
+	return NewAppError(CodeDrainInProgress, "Drain in progress", "WebSocket connections are already draining", http.StatusConflict, nil).translated("drain_in_progress")
+}
+
+// ErrWriteConflict reports a write the database kept aborting for
+// conflicting with concurrent ones. Nothing was written, so the client may
+// send it again.
+func ErrWriteConflict(internal error) *AppError {
+	return NewAppError(CodeWriteConflict, "Write conflict", "The write conflicted with concurrent writes and was not applied; it is safe to retry", http.StatusConflict, internal).translated("write_conflict")
+}
+
+// ErrStaleVersion reports an update conditioned on a version the resource
+// has moved past
+func ErrStaleVersion(resource string, current int64) *AppError {
+	return NewAppError(CodeConflictStaleVersion, "Version conflict", "The "+resource+" was changed since the version you sent; fetch it again and reapply your change", http.StatusConflict, nil).
+		WithMeta(MetaCurrentVersion, current)
+}
+
+// Precondition errors
+func ErrVersionRequired(resource string) *AppError {
+	return NewAppError(CodeVersionRequired, "Version required", "Updating the "+resource+" requires its current version in If-Match or the version field", http.StatusPreconditionRequired, nil)
 }
 
 // Rate limit errors
-func ErrRateLimit() *AppError {
-	return NewAppError(CodeRateLimitExceeded, "Rate limit exceeded", "Too many requests. Please try again later.", http.StatusTooManyRequests, nil)
+
+// ErrRateLimit reports an exhausted window of limit requests that resets at
+// reset, retryAfter seconds from now
+func ErrRateLimit(limit, remaining int, reset time.Time, retryAfter int) *AppError {
+	return NewAppError(CodeRateLimitExceeded, "Rate limit exceeded", "Too many requests. Please try again later.", http.StatusTooManyRequests, nil).translated("rate_limit_exceeded").
+		WithMeta(MetaLimit, limit).
+		WithMeta(MetaRemaining, remaining).
+		WithMeta(MetaReset, reset.UTC()).
+		WithMeta(MetaRetryAfter, retryAfter)
+}
+
+// ErrQuotaExceeded reports a tenant that has ingested its monthly events;
+// the quota resets at reset, retryAfter seconds from now
+func ErrQuotaExceeded(limit int, reset time.Time, retryAfter int) *AppError {
+	return NewAppError(CodeQuotaExceeded, "Quota exceeded", "The tenant has used its monthly event quota", http.StatusTooManyRequests, nil).translated("quota_exceeded").
+		WithMeta(MetaLimit, limit).
+		WithMeta(MetaRemaining, 0).
+		WithMeta(MetaReset, reset.UTC()).
+		WithMeta(MetaRetryAfter, retryAfter)
 }
 
 // Server errors
@@ -125,7 +414,62 @@ func ErrDB(operation string, internal error) *AppError {
 }
 
 func ErrWS(internal error) *AppError {
-	return NewAppError(CodeWebSocketError, "WebSocket connection failed", "Unable to establish WebSocket connection", http.StatusInternalServerError, internal)
+	return NewAppError(CodeWebSocketError, "WebSocket connection failed", "Unable to establish WebSocket connection", http.StatusInternalServerError, internal).translated("websocket_error")
+}
+
+// Not implemented errors
+
+// ErrEventStoreUnsupported rejects a feature that reads or writes events
+// in the database, when they are kept elsewhere
+func ErrEventStoreUnsupported(feature, store string) *AppError {
+	return NewAppError(CodeEventStoreUnsupported, "Not supported by the event store", feature+" need the sql event store; this server keeps events in "+store, http.StatusNotImplemented, nil)
+}
+
+// Unavailable errors
+func ErrMaintenance(message string) *AppError {
+	if message == "" {
+		return NewAppError(CodeMaintenanceMode, "Service in maintenance mode", "The service is undergoing maintenance and is not accepting writes", http.StatusServiceUnavailable, nil).translated("maintenance_mode")
+	}
+	return NewAppError(CodeMaintenanceMode, "Service in maintenance mode", message, http.StatusServiceUnavailable, nil)
+}
+
+// ErrIngestBufferFull reports that no queued write could be accepted; the
+// client may retry after retryAfter seconds or ask for ack=durable
+func ErrIngestBufferFull(retryAfter int) *AppError {
+	return NewAppError(CodeIngestBufferFull, "Ingest buffer full", "Too many events are waiting to be written; retry later or use ack=durable", http.StatusServiceUnavailable, nil).translated("ingest_buffer_full").
+		WithMeta(MetaRetryAfter, retryAfter)
+}
+
+// ErrDatabaseBusy reports that no database connection freed up within the
+// acquisition timeout; the client may retry after retryAfter seconds
+func ErrDatabaseBusy(retryAfter int, internal error) *AppError {
+	return NewAppError(CodeDatabaseBusy, "Database busy", "All database connections are in use; retry later", http.StatusServiceUnavailable, internal).translated("database_busy").
+		WithMeta(MetaRetryAfter, retryAfter)
+}
+
+// ErrOverloaded reports that too many requests of a route group are
+// running and waiting; the client may retry after retryAfter seconds
+func ErrOverloaded(group string, retryAfter int) *AppError {
+	return NewAppError(CodeOverloaded, "Server overloaded", "Too many "+group+" requests are in progress; retry later", http.StatusServiceUnavailable, nil).
+		WithMeta(MetaRetryAfter, retryAfter)
+}
+
+// ErrDraining reports that this instance is draining its WebSocket
+// connections ahead of a restart; the client should connect to another
+// instance, or retry here after retryAfter seconds
+func ErrDraining(retryAfter int) *AppError {
+	return NewAppError(CodeDraining, "Instance draining", "This instance is restarting and accepts no new WebSocket connections; reconnect to another instance", http.StatusServiceUnavailable, nil).translated("draining").
+		WithMeta(MetaRetryAfter, retryAfter)
+}
+
+// Timeout errors
+func ErrTimeout() *AppError {
+	return NewAppError(CodeTimeout, "Request timed out", "The server did not finish processing the request in time", http.StatusGatewayTimeout, nil).translated("request_timeout")
+}
+
+// ErrQueryTimeout reports a search cancelled for running too long
+func ErrQueryTimeout(internal error) *AppError {
+	return NewAppError(CodeQueryTimeout, "Query timed out", "The search took too long; narrow the filters, e.g. a shorter range, an event type or a tag, or drop the metadata search", http.StatusGatewayTimeout, internal).translated("query_timeout")
 }
 
 // Error returns the error message
@@ -141,6 +485,40 @@ func (e *AppError) Unwrap() error {
 	return e.Internal
 }
 
+// WithRequestID tags the error with the ID of the request that produced it
+func (e *AppError) WithRequestID(id string) *AppError {
+	e.RequestID = id
+	return e
+}
+
+// WithFields attaches the invalid fields behind the error
+func (e *AppError) WithFields(fields ...FieldError) *AppError {
+	e.Fields = append(e.Fields, fields...)
+	return e
+}
+
+// translated names the catalog entry Details is translated with and the
+// values of its placeholders, given as name, value pairs
+func (e *AppError) translated(key string, params ...string) *AppError {
+	e.DetailsKey = key
+	if len(params) > 0 {
+		e.Params = make(map[string]string, len(params)/2)
+		for i := 0; i+1 < len(params); i += 2 {
+			e.Params[params[i]] = params[i+1]
+		}
+	}
+	return e
+}
+
+// WithMeta adds a machine-readable detail to the error
+func (e *AppError) WithMeta(key string, value any) *AppError {
+	if e.Meta == nil {
+		e.Meta = make(map[string]any)
+	}
+	e.Meta[key] = value
+	return e
+}
+
 // Response returns a structured error response
 func (e *AppError) Response() map[string]interface{} {
 	response := map[string]interface{}{
@@ -152,10 +530,19 @@ func (e *AppError) Response() map[string]interface{} {
 	if e.Details != "" {
 		response["error"].(map[string]interface{})["details"] = e.Details
 	}
+	if len(e.Fields) > 0 {
+		response["error"].(map[string]interface{})["fields"] = e.Fields
+	}
+	if len(e.Meta) > 0 {
+		response["error"].(map[string]interface{})["meta"] = e.Meta
+	}
+	if e.RequestID != "" {
+		response["error"].(map[string]interface{})["request_id"] = e.RequestID
+	}
 	return response
 }
 
-// Is checks if the error is of a specific type
-func (e *AppError) Is(code ErrorCode) bool {
+// HasCode checks if the error is of a specific type
+func (e *AppError) HasCode(code ErrorCode) bool {
 	return e.Code == code
 }
@@ -0,0 +1,136 @@
+// Package eventtype matches event types against filter patterns, so that
+// event queries, WebSocket subscriptions and webhooks select the same
+// events. A pattern is one of:
+//
+//	checkout.completed   the type itself
+//	checkout.*           types starting with "checkout."
+//	*                    every type
+//	!heartbeat           excludes a type; "!heartbeat.*" a prefix
+//
+// An event matches a list of patterns when it matches one of the includes,
+// or there are none, and none of the excludes: excludes take precedence.
+package eventtype
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Wildcard ends a prefix pattern
+	Wildcard = "*"
+	// Not starts an exclusion
+	Not = "!"
+)
+
+// namePattern is what ingest.ValidateEventType allows, and what is left
+// of a pattern once its ! and trailing * are removed
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]*$`)
+
+// Validate checks a pattern: a wildcard may only end it
+func Validate(pattern string) error {
+	p := parse(pattern)
+	if p.value == "" && !p.prefix {
+		return fmt.Errorf("pattern %q names no event type", pattern)
+	}
+	if len(p.value) > 100 {
+		return fmt.Errorf("pattern %q must be at most 100 characters", pattern)
+	}
+	if strings.Contains(p.value, Wildcard) {
+		return fmt.Errorf("pattern %q may only have a wildcard at the end", pattern)
+	}
+	if !namePattern.MatchString(p.value) {
+		return fmt.Errorf("pattern %q can only contain alphanumeric characters, underscores, hyphens and dots, ending in an optional *, after an optional !", pattern)
+	}
+	return nil
+}
+
+// Pattern is a parsed pattern
+type Pattern struct {
+	value  string
+	prefix bool
+}
+
+// Value is the type, or the prefix of a wildcard pattern
+func (p Pattern) Value() string { return p.value }
+
+// Prefix reports whether the pattern ends in a wildcard
+func (p Pattern) Prefix() bool { return p.prefix }
+
+func (p Pattern) match(eventType string) bool {
+	if p.prefix {
+		return strings.HasPrefix(eventType, p.value)
+	}
+	return eventType == p.value
+}
+
+// Matcher matches event types against a list of patterns. The nil Matcher,
+// from an empty list, matches every type.
+type Matcher struct {
+	include []Pattern
+	exclude []Pattern
+}
+
+// Compile parses a list of patterns, which should have been validated;
+// invalid ones match nothing
+func Compile(patterns []string) *Matcher {
+	if len(patterns) == 0 {
+		return nil
+	}
+	m := &Matcher{}
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, Not) {
+			m.exclude = append(m.exclude, parse(pattern))
+		} else {
+			m.include = append(m.include, parse(pattern))
+		}
+	}
+	return m
+}
+
+// parse splits a pattern into the type or prefix it names, dropping any !
+func parse(pattern string) Pattern {
+	value := strings.TrimPrefix(pattern, Not)
+	if strings.HasSuffix(value, Wildcard) {
+		return Pattern{value: strings.TrimSuffix(value, Wildcard), prefix: true}
+	}
+	return Pattern{value: value}
+}
+
+// Match reports whether an event type is selected
+func (m *Matcher) Match(eventType string) bool {
+	if m == nil {
+		return true
+	}
+	for _, p := range m.exclude {
+		if p.match(eventType) {
+			return false
+		}
+	}
+	if len(m.include) == 0 {
+		return true
+	}
+	for _, p := range m.include {
+		if p.match(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Include returns the patterns an event type must match one of, or none
+func (m *Matcher) Include() []Pattern {
+	if m == nil {
+		return nil
+	}
+	return m.include
+}
+
+// Exclude returns the patterns an event type must match none of
+func (m *Matcher) Exclude() []Pattern {
+	if m == nil {
+		return nil
+	}
+	return m.exclude
+}
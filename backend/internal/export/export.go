@@ -0,0 +1,392 @@
+// Package export builds tenant data exports: NDJSON with the tenant record,
+// its webhooks without their secrets, its saved views and every event,
+// compressed with gzip or zstd and stored in the archive. Archives larger
+// than exports.part_size are stored in parts, listed with their checksums
+// in a manifest. Jobs and their stored parts are kept in the database, so a
+// job whose server stopped is taken over once its heartbeat goes stale and
+// resumed after its last stored part.
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/archive"
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/jobs"
+	"event-ingestion-system/internal/models"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// FormatVersion is the version of the archive's layout
+const FormatVersion = 1
+
+// Record is one line of an archive. Type is export for the first line, then
+// tenant, webhook, view and event.
+type Record struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// Header describes the archive in its first line
+type Header struct {
+	JobID      string    `json:"job_id"`
+	TenantID   string    `json:"tenant_id"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// tenantRecord is the tenant with its settings
+type tenantRecord struct {
+	*models.Tenant
+	Settings models.TenantSettings `json:"settings"`
+}
+
+// webhookRecord is a webhook without its secret
+type webhookRecord struct {
+	ID            uint            `json:"id"`
+	Name          *string         `json:"name,omitempty"`
+	URL           string          `json:"url"`
+	EventTypes    json.RawMessage `json:"event_types,omitempty"`
+	Active        bool            `json:"active"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+	LastTriggered *time.Time      `json:"last_triggered,omitempty"`
+	FailureCount  int             `json:"failure_count"`
+	// PayloadVersion is absent from archives made before payload versions
+	PayloadVersion int    `json:"payload_version"`
+	Timeout        string `json:"timeout,omitempty"`
+	ConnectTimeout string `json:"connect_timeout,omitempty"`
+}
+
+// Manifest lists the parts of an archive in order. It is stored next to
+// them, and the parts concatenated in its order are one archive that
+// imports as a whole.
+type Manifest struct {
+	JobID       string         `json:"job_id"`
+	TenantID    string         `json:"tenant_id"`
+	Version     int            `json:"version"`
+	Compression string         `json:"compression"`
+	Events      int64          `json:"events"`
+	Size        int64          `json:"size"`
+	Parts       []ManifestPart `json:"parts"`
+}
+
+// ManifestPart is a part as the manifest lists it, under the name it is
+// downloaded as
+type ManifestPart struct {
+	Number   int    `json:"number"`
+	Filename string `json:"filename"`
+	Events   int64  `json:"events"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+// PartKey is where a part of a job's archive is stored
+func PartKey(job *models.ExportJob, number int) string {
+	extension := ".gz"
+	if job.Compression == models.CompressionZstd {
+		extension = ".zst"
+	}
+	return fmt.Sprintf("exports/%s/%s/part-%04d.ndjson%s", job.TenantID, job.ID, number, extension)
+}
+
+// ManifestKey is where the manifest of a job's archive is stored
+func ManifestKey(job *models.ExportJob) string {
+	return "exports/" + job.TenantID + "/" + job.ID + "/manifest.json"
+}
+
+// Filename is the name the file of a job's archive stored under key is
+// downloaded as, such as export-<tenant>-<job>-part-0001.ndjson.gz
+func Filename(job *models.ExportJob, key string) string {
+	name := path.Base(key)
+	if !strings.HasPrefix(name, job.ID) {
+		// Archives from before parts are named after the job alone
+		name = job.ID + "-" + name
+	}
+	return "export-" + job.TenantID + "-" + name
+}
+
+// Runner claims queued export jobs and builds their archives, one at a time
+type Runner struct {
+	*jobs.Runner[models.ExportJob, *models.ExportJob]
+	db    *database.Database
+	store archive.Store
+	cfg   config.ExportsConfig
+}
+
+// NewRunner creates an export runner
+func NewRunner(db *database.Database, store archive.Store, cfg config.ExportsConfig, logger *slog.Logger) *Runner {
+	r := &Runner{db: db, store: store, cfg: cfg}
+	r.Runner = jobs.NewRunner(db, jobs.Kind[*models.ExportJob]{
+		Name: "export",
+		Run:  r.build,
+		Finish: func(db *database.Database, job *models.ExportJob, at time.Time) error {
+			return db.FinishExportJob(job, at)
+		},
+		Completed: func(job *models.ExportJob) []any {
+			return []any{"events", job.EventCount, "bytes", job.Size}
+		},
+	}, cfg.PollInterval, logger)
+	return r
+}
+
+// build writes the archive part by part, storing each as it is done, and
+// then the manifest listing them. Parts an earlier attempt stored are kept
+// and the export continues after the last of them.
+func (r *Runner) build(ctx context.Context, job *models.ExportJob, logger *slog.Logger) error {
+	parts, err := r.db.WithContext(ctx).ListExportParts(job.ID)
+	if err != nil {
+		return fmt.Errorf("load stored parts: %w", err)
+	}
+	var after uint
+	switch {
+	case len(parts) > 0:
+		after = parts[len(parts)-1].LastEventID
+		logger.InfoContext(ctx, "Resuming export job", "after_part", len(parts))
+	case job.Attempts > 1:
+		logger.WarnContext(ctx, "Resuming export job from the start")
+	}
+
+	for {
+		part, more, err := r.writePart(ctx, job, len(parts)+1, after)
+		if err != nil {
+			return err
+		}
+		if part != nil {
+			parts = append(parts, *part)
+			after = part.LastEventID
+		}
+		if !more {
+			break
+		}
+	}
+	return r.storeManifest(ctx, job, parts)
+}
+
+// writePart writes the part numbered number, holding the events after
+// after, to a temporary file, stores and records it, and reports whether
+// more events remain. The first part begins with the tenant; any other is
+// only written when there are events left for it.
+func (r *Runner) writePart(ctx context.Context, job *models.ExportJob, number int, after uint) (*models.ExportPart, bool, error) {
+	// Event batches may take longer than interactive searches
+	db := r.db.WithContext(ctx).WithStatementTimeout(r.cfg.QueryTimeout)
+	events, err := db.GetEventsAfter(job.TenantID, after, r.cfg.BatchSize)
+	if err != nil {
+		return nil, false, fmt.Errorf("load events: %w", err)
+	}
+	if len(events) == 0 && number > 1 {
+		return nil, false, nil
+	}
+
+	tmp, err := os.CreateTemp("", "export-*.part")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w, err := newPartWriter(tmp, job.Compression)
+	if err != nil {
+		return nil, false, err
+	}
+	if number == 1 {
+		if err := writeTenant(db, w, job); err != nil {
+			return nil, false, err
+		}
+	}
+
+	part := &models.ExportPart{JobID: job.ID, Number: number, ObjectKey: PartKey(job, number), LastEventID: after}
+	more := false
+	for {
+		for i := range events {
+			if err := w.emit("event", events[i].ToEventResponse()); err != nil {
+				return nil, false, err
+			}
+		}
+		part.Events += int64(len(events))
+		if len(events) > 0 {
+			part.LastEventID = events[len(events)-1].ID
+		}
+		if len(events) < r.cfg.BatchSize {
+			break
+		}
+		if r.cfg.PartSize > 0 && w.size() >= r.cfg.PartSize {
+			more = true
+			break
+		}
+		if events, err = db.GetEventsAfter(job.TenantID, part.LastEventID, r.cfg.BatchSize); err != nil {
+			return nil, false, fmt.Errorf("load events: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, false, err
+	}
+	part.Size, part.SHA256 = w.size(), hex.EncodeToString(w.hash.Sum(nil))
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	if err := r.store.Put(ctx, part.ObjectKey, tmp, part.Size); err != nil {
+		return nil, false, fmt.Errorf("store part %d: %w", number, err)
+	}
+	if err := r.db.WithContext(ctx).SaveExportPart(part); err != nil {
+		return nil, false, fmt.Errorf("record part %d: %w", number, err)
+	}
+	return part, more, nil
+}
+
+// storeManifest stores the manifest listing the archive's parts and notes
+// the archive on the job
+func (r *Runner) storeManifest(ctx context.Context, job *models.ExportJob, parts []models.ExportPart) error {
+	manifest := Manifest{JobID: job.ID, TenantID: job.TenantID, Version: FormatVersion, Compression: job.Compression}
+	for _, part := range parts {
+		manifest.Events += part.Events
+		manifest.Size += part.Size
+		manifest.Parts = append(manifest.Parts, ManifestPart{
+			Number:   part.Number,
+			Filename: Filename(job, part.ObjectKey),
+			Events:   part.Events,
+			Size:     part.Size,
+			SHA256:   part.SHA256,
+		})
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	key := ManifestKey(job)
+	if err := r.store.Put(ctx, key, bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("store manifest: %w", err)
+	}
+	job.ObjectKey, job.Size, job.EventCount = key, manifest.Size, manifest.Events
+	return nil
+}
+
+// writeTenant writes the archive's header, the tenant, its webhooks and its
+// saved views
+func writeTenant(db *database.Database, w *partWriter, job *models.ExportJob) error {
+	tenant, err := db.GetTenantByID(job.TenantID)
+	if err != nil {
+		return fmt.Errorf("load tenant: %w", err)
+	}
+	settings, err := tenant.ParseSettings()
+	if err != nil {
+		return fmt.Errorf("parse tenant settings: %w", err)
+	}
+	header := Header{JobID: job.ID, TenantID: job.TenantID, Version: FormatVersion, ExportedAt: time.Now().UTC()}
+	if err := w.emit("export", header); err != nil {
+		return err
+	}
+	if err := w.emit("tenant", tenantRecord{Tenant: tenant, Settings: settings}); err != nil {
+		return err
+	}
+
+	webhooks, err := db.ListWebhooks(job.TenantID)
+	if err != nil {
+		return fmt.Errorf("load webhooks: %w", err)
+	}
+	for _, wh := range webhooks {
+		record := webhookRecord{
+			ID:             wh.ID,
+			Name:           wh.Name,
+			URL:            wh.URL,
+			Active:         wh.Active,
+			CreatedAt:      wh.CreatedAt,
+			UpdatedAt:      wh.UpdatedAt,
+			LastTriggered:  wh.LastTriggered,
+			FailureCount:   wh.FailureCount,
+			PayloadVersion: wh.PayloadVersion,
+			Timeout:        wh.Timeout,
+			ConnectTimeout: wh.ConnectTimeout,
+		}
+		if json.Valid([]byte(wh.EventTypes)) {
+			record.EventTypes = json.RawMessage(wh.EventTypes)
+		}
+		if err := w.emit("webhook", record); err != nil {
+			return err
+		}
+	}
+
+	views, err := db.ListSavedViews(job.TenantID)
+	if err != nil {
+		return fmt.Errorf("load saved views: %w", err)
+	}
+	for _, view := range views {
+		if err := w.emit("view", view); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partWriter streams records through the part's compressor, counting and
+// hashing the compressed bytes as they are written
+type partWriter struct {
+	written int64
+	hash    hash.Hash
+	zw      io.WriteCloser
+	buf     *bufio.Writer
+	enc     *json.Encoder
+}
+
+func newPartWriter(w io.Writer, compression string) (*partWriter, error) {
+	p := &partWriter{hash: sha256.New()}
+	out := io.MultiWriter(w, p.hash, (*byteCounter)(&p.written))
+	if compression == models.CompressionZstd {
+		// A single encoder goroutine keeps memory flat however large the
+		// export
+		zw, err := zstd.NewWriter(out, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		p.zw = zw
+	} else {
+		p.zw = gzip.NewWriter(out)
+	}
+	p.buf = bufio.NewWriter(p.zw)
+	p.enc = json.NewEncoder(p.buf)
+	return p, nil
+}
+
+func (p *partWriter) emit(kind string, data any) error {
+	return p.enc.Encode(Record{Type: kind, Data: data})
+}
+
+// size is the compressed bytes written so far, short of what the
+// compressor still holds until Close
+func (p *partWriter) size() int64 {
+	return p.written
+}
+
+// Close flushes the records and ends the compressed stream
+func (p *partWriter) Close() error {
+	if err := p.buf.Flush(); err != nil {
+		return err
+	}
+	return p.zw.Close()
+}
+
+// byteCounter counts the bytes written to it
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
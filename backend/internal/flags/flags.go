@@ -0,0 +1,142 @@
+// Package flags turns behaviors on for some tenants before all of them.
+// The flags and their defaults come from the configuration; a tenant's
+// settings may override any of them, and admins change the overrides at
+// runtime. Overrides of flags the configuration no longer defines are
+// ignored, so removing a flag turns it off everywhere.
+//
+// Code asks IsEnabled(ctx, name) at the point where behavior branches. A
+// request resolves its tenant's flags the first time it asks and reuses
+// them afterwards, so asking is cheap.
+package flags
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"event-ingestion-system/internal/cache"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The flags code branches on
+const (
+	// AsyncIngest acknowledges events sent without ?ack once they are
+	// queued, as ack=received does, instead of once they are stored
+	AsyncIngest = "async_ingest"
+	// PayloadV2 sends payload version 2 to webhooks and WebSocket clients
+	// that name no version
+	PayloadV2 = "payload_v2"
+)
+
+// Flags holds the defined flags and their defaults
+type Flags struct {
+	defaults map[string]bool
+}
+
+// New defines flags with their defaults
+func New(defaults map[string]bool) *Flags {
+	copied := make(map[string]bool, len(defaults))
+	for name, enabled := range defaults {
+		copied[name] = enabled
+	}
+	return &Flags{defaults: copied}
+}
+
+// Defined reports whether the configuration defines a flag
+func (f *Flags) Defined(name string) bool {
+	_, ok := f.defaults[name]
+	return ok
+}
+
+// Tenant returns every defined flag as it applies to a tenant with the
+// given settings, by name
+func (f *Flags) Tenant(settings models.TenantSettings) []models.FeatureFlag {
+	names := make([]string, 0, len(f.defaults))
+	for name := range f.defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	flags := make([]models.FeatureFlag, len(names))
+	for i, name := range names {
+		flag := models.FeatureFlag{Name: name, Default: f.defaults[name], Enabled: f.defaults[name]}
+		if enabled, ok := settings.Flags[name]; ok {
+			flag.Override = &enabled
+			flag.Enabled = enabled
+		}
+		flags[i] = flag
+	}
+	return flags
+}
+
+// resolve returns the flags enabled for a tenant, or the defaults without
+// one. Settings that cannot be read leave the defaults in place.
+func (f *Flags) resolve(tenant *models.Tenant) map[string]bool {
+	enabled := make(map[string]bool, len(f.defaults))
+	for name, on := range f.defaults {
+		enabled[name] = on
+	}
+	if tenant == nil {
+		return enabled
+	}
+	settings, err := tenant.ParseSettings()
+	if err != nil {
+		return enabled
+	}
+	for name, on := range settings.Flags {
+		if f.Defined(name) {
+			enabled[name] = on
+		}
+	}
+	return enabled
+}
+
+type contextKey struct{}
+
+// request caches the flags of a request's tenant. The tenant is only known
+// once authentication has run, so they are resolved again should it change.
+type request struct {
+	flags *Flags
+
+	mu       sync.Mutex
+	tenantID string
+	enabled  map[string]bool
+}
+
+// NewContext returns a copy of ctx in which IsEnabled resolves f
+func (f *Flags) NewContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, &request{flags: f})
+}
+
+// Middleware makes the flags available to IsEnabled during each request
+func Middleware(f *Flags) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(f.NewContext(c.Request.Context()))
+		c.Next()
+	}
+}
+
+// IsEnabled reports whether a flag is on for the tenant authenticated in
+// ctx, or by default when there is none. It is false for undefined flags
+// and outside requests.
+func IsEnabled(ctx context.Context, name string) bool {
+	r, _ := ctx.Value(contextKey{}).(*request)
+	if r == nil {
+		return false
+	}
+
+	tenant := cache.FromContext(ctx)
+	tenantID := ""
+	if tenant != nil {
+		tenantID = tenant.ID
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.enabled == nil || r.tenantID != tenantID {
+		r.enabled = r.flags.resolve(tenant)
+		r.tenantID = tenantID
+	}
+	return r.enabled[name]
+}
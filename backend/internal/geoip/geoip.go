@@ -0,0 +1,173 @@
+// Package geoip resolves client IP addresses to where they are, from
+// MaxMind-format databases that are reloaded when their files change.
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"event-ingestion-system/internal/config"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Field is the metadata key events' locations are stored under
+const Field = "_geo"
+
+// Location is where an address is, as far as the databases know
+type Location struct {
+	Country string `json:"country,omitempty"` // ISO 3166-1 alpha-2 code
+	City    string `json:"city,omitempty"`    // English name
+	ASN     uint   `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+}
+
+// cityRecord is the part of a City or Country database record that is
+// read; decoding no more keeps lookups to a few microseconds
+type cityRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names struct {
+			EN string `maxminddb:"en"`
+		} `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// asnRecord is the part of an ASN database record that is read
+type asnRecord struct {
+	Number uint   `maxminddb:"autonomous_system_number"`
+	Org    string `maxminddb:"autonomous_system_organization"`
+}
+
+// database is a loaded file with the modification time it was read at
+type database struct {
+	path    string
+	reader  *maxminddb.Reader
+	modTime time.Time
+}
+
+// Resolver looks addresses up. It is safe for concurrent use; a reload
+// swaps whole readers, so a lookup uses one file or the other.
+type Resolver struct {
+	cfg    config.GeoIPConfig
+	city   atomic.Pointer[database]
+	asn    atomic.Pointer[database]
+	logger *slog.Logger
+}
+
+// Open loads the configured databases. It returns nil without any, so
+// callers skip lookups altogether.
+func Open(cfg config.GeoIPConfig, logger *slog.Logger) (*Resolver, error) {
+	if cfg.Database == "" && cfg.ASNDatabase == "" {
+		return nil, nil
+	}
+	r := &Resolver{cfg: cfg, logger: logger}
+	for _, slot := range r.slots() {
+		if slot.path == "" {
+			continue
+		}
+		db, err := load(slot.path)
+		if err != nil {
+			return nil, err
+		}
+		slot.current.Store(db)
+	}
+	return r, nil
+}
+
+type slot struct {
+	path    string
+	current *atomic.Pointer[database]
+}
+
+// slots pairs the configured paths with where their readers are kept
+func (r *Resolver) slots() []slot {
+	return []slot{{r.cfg.Database, &r.city}, {r.cfg.ASNDatabase, &r.asn}}
+}
+
+// load reads a database file into memory. Readers are not memory-mapped,
+// so one replaced by a reload stays valid for lookups still using it.
+func load(path string) (*database, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip database: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip database: %w", err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("geoip database %s: %w", path, err)
+	}
+	return &database{path: path, reader: reader, modTime: info.ModTime()}, nil
+}
+
+// Run reloads the databases whose files changed every reload interval
+// until ctx is cancelled. A file that fails to load leaves the previous
+// one in use.
+func (r *Resolver) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reload()
+		}
+	}
+}
+
+// reload loads the databases whose files changed since they were read
+func (r *Resolver) reload() {
+	for _, slot := range r.slots() {
+		current := slot.current.Load()
+		if current == nil {
+			continue
+		}
+		info, err := os.Stat(current.path)
+		if err != nil {
+			r.logger.Warn("Failed to check GeoIP database", "path", current.path, "error", err)
+			continue
+		}
+		if info.ModTime().Equal(current.modTime) {
+			continue
+		}
+		db, err := load(current.path)
+		if err != nil {
+			r.logger.Error("Failed to reload GeoIP database, keeping the previous one", "path", current.path, "error", err)
+			continue
+		}
+		slot.current.Store(db)
+		r.logger.Info("Reloaded GeoIP database", "path", current.path, "type", db.reader.Metadata.DatabaseType,
+			"built", time.Unix(int64(db.reader.Metadata.BuildEpoch), 0).UTC())
+	}
+}
+
+// Lookup returns where addr is, and false when no database knows it
+func (r *Resolver) Lookup(addr netip.Addr) (Location, bool) {
+	ip := net.IP(addr.Unmap().AsSlice())
+	var loc Location
+	if db := r.city.Load(); db != nil {
+		var rec cityRecord
+		if err := db.reader.Lookup(ip, &rec); err == nil {
+			loc.Country, loc.City = rec.Country.ISOCode, rec.City.Names.EN
+		}
+	}
+	if db := r.asn.Load(); db != nil {
+		var rec asnRecord
+		if err := db.reader.Lookup(ip, &rec); err == nil {
+			loc.ASN, loc.ASOrg = rec.Number, rec.Org
+		}
+	}
+	return loc, loc != Location{}
+}
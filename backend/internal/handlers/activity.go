@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetTenantActivity answers whether a tenant is alive: when it last sent an
+// event and how many it sent lately, its WebSocket clients, its latest
+// webhook delivery and when it last authenticated. The queries run
+// concurrently.
+func (h *Handler) GetTenantActivity(c *gin.Context) {
+	tenantID, ok := ownTenant(c, "Tenants can only read their own activity")
+	if !ok {
+		return
+	}
+
+	db := h.dbFor(c)
+	store := h.eventsFor(c)
+	now := time.Now().UTC()
+	activity := models.TenantActivity{
+		TenantID:         tenantID,
+		WebSocketClients: h.hub.TenantConnections(tenantID),
+	}
+	var tenant *models.Tenant
+	var webhook *models.Webhook
+	queries := []func() error{
+		func() (err error) {
+			activity.LastEventAt, err = store.GetLastEventReceived(tenantID)
+			return err
+		},
+		func() (err error) {
+			activity.EventsLastHour, err = store.CountEventsCreatedSince(tenantID, now.Add(-time.Hour))
+			return err
+		},
+		func() (err error) {
+			activity.EventsLastDay, err = store.CountEventsCreatedSince(tenantID, now.Add(-24*time.Hour))
+			return err
+		},
+		func() (err error) {
+			webhook, err = db.GetLastWebhookDelivery(tenantID)
+			return err
+		},
+		func() (err error) {
+			tenant, err = db.GetTenantByID(tenantID)
+			return err
+		},
+	}
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		go func(i int, query func() error) {
+			defer wg.Done()
+			errs[i] = query()
+		}(i, query)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			c.Error(errors.ErrTenantNotFound(tenantID))
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.Error(errors.ErrDB("get tenant activity", err))
+			c.Abort()
+			return
+		}
+	}
+
+	if webhook != nil {
+		activity.LastWebhookDelivery = &models.WebhookDelivery{
+			WebhookID:    webhook.ID,
+			URL:          webhook.URL,
+			Status:       webhook.LastStatus,
+			FailureCount: webhook.FailureCount,
+			At:           webhook.LastTriggered.UTC(),
+		}
+	}
+	// An authentication on this replica may not be written yet
+	activity.LastAuthAt = tenant.LastAuthAt
+	if at, ok := h.auth.PendingAuth(tenantID); ok && (activity.LastAuthAt == nil || at.After(*activity.LastAuthAt)) {
+		activity.LastAuthAt = &at
+	}
+	c.JSON(http.StatusOK, activity)
+}
+
+// GetTenantsActivity lists the limit tenants most recently active and the
+// limit longest inactive, for account review. Tenants never active count
+// as inactive since they were created.
+func (h *Handler) GetTenantsActivity(c *gin.Context) {
+	limit := 10
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 {
+			c.Error(errors.ErrInvalidRequest("Invalid limit parameter"))
+			c.Abort()
+			return
+		}
+		if parsed > 100 {
+			parsed = 100 // Cap at 100
+		}
+		limit = parsed
+	}
+
+	summaries, err := h.dbFor(c).ListTenantActivity()
+	if err != nil {
+		c.Error(errors.ErrDB("list tenant activity", err))
+		c.Abort()
+		return
+	}
+
+	lastActive := func(s models.TenantActivitySummary) time.Time {
+		if s.LastActiveAt != nil {
+			return *s.LastActiveAt
+		}
+		return s.CreatedAt
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return lastActive(summaries[i]).After(lastActive(summaries[j]))
+	})
+	recent := make([]models.TenantActivitySummary, 0, min(limit, len(summaries)))
+	for _, summary := range summaries {
+		if len(recent) == limit {
+			break
+		}
+		if summary.LastActiveAt != nil {
+			recent = append(recent, summary)
+		}
+	}
+	inactive := make([]models.TenantActivitySummary, 0, min(limit, len(summaries)))
+	for i := len(summaries) - 1; i >= 0 && len(inactive) < limit; i-- {
+		inactive = append(inactive, summaries[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"most_recently_active": recent,
+		"longest_inactive":     inactive,
+		"tenants":              len(summaries),
+		"limit":                limit,
+	})
+}
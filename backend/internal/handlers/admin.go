@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"event-ingestion-system/internal/audit"
+	"event-ingestion-system/internal/capture"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/ingest"
+	"event-ingestion-system/internal/maintenance"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/redact"
+	"event-ingestion-system/internal/transform"
+	"event-ingestion-system/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditAdminAccess records every request made with the admin token
+func (h *Handler) AuditAdminAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		h.recordAudit(c, "admin.access", "route", c.FullPath(), map[string]interface{}{
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+			"status": c.Writer.Status(),
+		})
+	}
+}
+
+// maxBulkTenants bounds the tenants of one bulk provisioning request
+const maxBulkTenants = 500
+
+// CreateTenantsBulk provisions tenants from an array of name, settings and
+// quota. Items that are invalid, repeat an earlier item's name or take an
+// existing tenant's name are reported and skipped; the rest are created in
+// one transaction, all or none. API keys are shown only in this response.
+func (h *Handler) CreateTenantsBulk(c *gin.Context) {
+	var items []models.BulkTenantRequest
+	if err := c.ShouldBindJSON(&items); err != nil {
+		c.Error(invalidRequest(err))
+		c.Abort()
+		return
+	}
+	if len(items) == 0 || len(items) > maxBulkTenants {
+		c.Error(errors.ErrInvalidRequest(fmt.Sprintf("A bulk request must hold between 1 and %d tenants, got %d", maxBulkTenants, len(items))))
+		c.Abort()
+		return
+	}
+
+	results := make([]models.BulkTenantResult, len(items))
+	tenants := make([]*models.Tenant, len(items))
+	first := make(map[string]int, len(items))
+	names := make([]string, 0, len(items))
+	for i, item := range items {
+		results[i] = models.BulkTenantResult{Index: i, Name: item.Name}
+		tenant, err := newBulkTenant(item)
+		if err != nil {
+			results[i].Status, results[i].Error = "invalid", err
+			continue
+		}
+		if j, ok := first[item.Name]; ok {
+			results[i].Status = "conflict"
+			results[i].Error = errors.ErrTenantExists(item.Name)
+			results[i].Error.Details = fmt.Sprintf("Tenant name '%s' is already used by item %d of this request", item.Name, j)
+			continue
+		}
+		first[item.Name] = i
+		tenants[i] = tenant
+		names = append(names, item.Name)
+	}
+
+	db := h.dbFor(c)
+	taken, err := db.FindTenantNames(names)
+	if err != nil {
+		c.Error(errors.ErrDB("check existing tenants", err))
+		c.Abort()
+		return
+	}
+	create := make([]models.Tenant, 0, len(names))
+	for i, tenant := range tenants {
+		if tenant == nil {
+			continue
+		}
+		if taken[tenant.Name] {
+			results[i].Status, results[i].Error = "conflict", errors.ErrTenantExists(tenant.Name)
+			tenants[i] = nil
+			continue
+		}
+		create = append(create, *tenant)
+	}
+	if len(create) > 0 {
+		if err := db.CreateTenants(create); err != nil {
+			c.Error(errors.ErrDB("create tenants", err))
+			c.Abort()
+			return
+		}
+	}
+
+	counts := map[string]int{}
+	for i, tenant := range tenants {
+		if tenant != nil {
+			results[i].Status, results[i].ID, results[i].APIKey = "created", tenant.ID, tenant.APIKey
+			h.recordAudit(c, "tenant.create", "tenant", tenant.ID, map[string]interface{}{"name": tenant.Name, "bulk": true})
+		}
+		counts[results[i].Status]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"created":   counts["created"],
+		"conflicts": counts["conflict"],
+		"invalid":   counts["invalid"],
+		"results":   results,
+	})
+}
+
+// newBulkTenant validates one item of a bulk request and builds its tenant.
+// A quota given alongside the settings replaces theirs.
+func newBulkTenant(item models.BulkTenantRequest) (*models.Tenant, *errors.AppError) {
+	if err := validateTenantName(item.Name); err != nil {
+		return nil, invalidRequest(err)
+	}
+
+	tenant := &models.Tenant{
+		ID:     uuid.New().String(),
+		Name:   item.Name,
+		APIKey: uuid.New().String(),
+		Active: true,
+	}
+
+	var settings models.TenantSettings
+	if item.Settings != nil {
+		settings = *item.Settings
+	}
+	if item.Quota != nil {
+		settings.Quota = item.Quota
+	}
+	if settings.Quota != nil && settings.Quota.MonthlyEvents < 0 {
+		return nil, errors.ErrValidation([]errors.FieldError{{Field: "quota.monthly_events", Rule: "gte", Message: "must be at least 0"}})
+	}
+	if _, err := redact.Compile(settings.RedactionRules, tenant.ID); err != nil {
+		return nil, errors.ErrValidation([]errors.FieldError{{Field: "settings.redaction_rules", Rule: "valid", Message: err.Error()}})
+	}
+	if err := ingest.ValidateSamplingRules(settings.SamplingRules); err != nil {
+		return nil, errors.ErrValidation([]errors.FieldError{{Field: "settings.sampling_rules", Rule: "valid", Message: err.Error()}})
+	}
+	if _, err := transform.Compile(settings.TransformRules, 0); err != nil {
+		return nil, errors.ErrValidation([]errors.FieldError{{Field: "settings.transform_rules", Rule: "valid", Message: err.Error()}})
+	}
+	if len(settings.RedactionRules) > 0 || len(settings.SamplingRules) > 0 || len(settings.TransformRules) > 0 || settings.Quota != nil || len(settings.Flags) > 0 {
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return nil, errors.ErrInvalidRequest("Settings cannot be encoded")
+		}
+		tenant.Settings = string(data)
+	}
+	return tenant, nil
+}
+
+// DeleteTenant deactivates and soft-deletes a tenant and its webhooks
+func (h *Handler) DeleteTenant(c *gin.Context) {
+	tenantID := c.Param("id")
+
+	// Validate UUID format
+	if _, err := uuid.Parse(tenantID); err != nil {
+		c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+		c.Abort()
+		return
+	}
+
+	if err := h.dbFor(c).DeleteTenant(tenantID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrTenantNotFound(tenantID))
+			c.Abort()
+			return
+		}
+		c.Error(errors.ErrDB("delete tenant", err))
+		c.Abort()
+		return
+	}
+	h.tenants.Invalidate(tenantID)
+
+	h.recordAudit(c, "tenant.delete", "tenant", tenantID, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// RestoreTenant undeletes a soft-deleted tenant and reactivates it. The API
+// key is replaced because the old one may have been shared during
+// offboarding. The request body is optional.
+func (h *Handler) RestoreTenant(c *gin.Context) {
+	tenantID := c.Param("id")
+
+	// Validate UUID format
+	if _, err := uuid.Parse(tenantID); err != nil {
+		c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+		c.Abort()
+		return
+	}
+
+	var req models.RestoreTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !stderrors.Is(err, io.EOF) {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+
+	db := h.dbFor(c)
+	tenant, err := db.GetTenantByIDIncludingDeleted(tenantID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrTenantNotFound(tenantID))
+			c.Abort()
+			return
+		}
+		c.Error(errors.ErrDB("get tenant", err))
+		c.Abort()
+		return
+	}
+	if !tenant.DeletedAt.Valid {
+		c.Error(errors.ErrTenantNotDeleted(tenantID))
+		c.Abort()
+		return
+	}
+
+	// The name may have been taken since the tenant was deleted
+	existing, err := db.GetTenantByName(tenant.Name)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		c.Error(errors.ErrInternal("Failed to check existing tenant", err))
+		c.Abort()
+		return
+	}
+	if existing != nil {
+		c.Error(errors.ErrTenantExists(tenant.Name))
+		c.Abort()
+		return
+	}
+
+	apiKey := uuid.New().String()
+	webhooks, err := db.RestoreTenant(tenant, apiKey, req.Webhooks)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			// Restored concurrently
+			c.Error(errors.ErrTenantNotDeleted(tenantID))
+			c.Abort()
+			return
+		}
+		c.Error(errors.ErrDB("restore tenant", err))
+		c.Abort()
+		return
+	}
+	h.tenants.Invalidate(tenantID)
+
+	h.recordAudit(c, "tenant.restore", "tenant", tenantID, map[string]interface{}{
+		"name":              tenant.Name,
+		"webhooks_restored": webhooks,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":                tenant.ID,
+		"name":              tenant.Name,
+		"api_key":           apiKey,
+		"active":            true,
+		"webhooks_restored": webhooks,
+	})
+}
+
+// GetConfig returns the effective runtime configuration with secrets redacted
+func (h *Handler) GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"config": h.cfg.Redacted()})
+}
+
+// GetAnomalies lists the tenants whose ingestion rate is currently flagged
+// as anomalous
+func (h *Handler) GetAnomalies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":   h.anomalies.Enabled(),
+		"anomalies": h.anomalies.Anomalies(),
+	})
+}
+
+// GetLeader reports which replica runs the background jobs that run once,
+// and whether it is this one
+func (h *Handler) GetLeader(c *gin.Context) {
+	status, err := h.leader.Status(c.Request.Context())
+	if err != nil {
+		c.Error(errors.ErrDB("get leader lease", err))
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// GetDatabasePool reports the database connection pool's saturation: the
+// connections open and in use against the maximum, how often queries had
+// to wait for one and how many gave up after database.acquire_timeout
+func (h *Handler) GetDatabasePool(c *gin.Context) {
+	stats, err := h.db.PoolStats()
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to read connection pool stats", err))
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetRecentErrors lists the failed requests captured in memory, newest first,
+// optionally filtered by tenant, route and status or error code
+func (h *Handler) GetRecentErrors(c *gin.Context) {
+	filter := capture.Filter{
+		TenantID: c.Query("tenant_id"),
+		Route:    c.Query("route"),
+		Code:     c.Query("code"),
+		Limit:    50,
+	}
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 0 {
+			c.Error(errors.ErrInvalidRequest("Invalid limit parameter"))
+			c.Abort()
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": h.recentErrors.Enabled(),
+		"entries": h.recentErrors.List(filter),
+	})
+}
+
+// GetMaintenance returns the current maintenance state
+func (h *Handler) GetMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, h.maint.State())
+}
+
+// SetMaintenance switches maintenance mode on or off and notifies connected
+// WebSocket clients
+func (h *Handler) SetMaintenance(c *gin.Context) {
+	var req models.MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+
+	state, err := h.maint.Set(maintenance.State{
+		Enabled:    *req.Enabled,
+		Message:    req.Message,
+		RetryAfter: req.RetryAfter,
+	})
+	if err != nil {
+		c.Error(errors.ErrDB("update maintenance mode", err))
+		c.Abort()
+		return
+	}
+
+	action := "maintenance.disable"
+	if state.Enabled {
+		action = "maintenance.enable"
+	}
+	h.recordAudit(c, action, "system", "maintenance", map[string]interface{}{
+		"message":     state.Message,
+		"retry_after": state.RetryAfter,
+	})
+
+	if err := h.hub.Notify("maintenance", state); err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to notify WebSocket clients", "error", err)
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+// maxDrainDeadline bounds how long a WebSocket drain may take
+const maxDrainDeadline = time.Hour
+
+// DrainWebSockets asks this instance's WebSocket clients to reconnect
+// elsewhere ahead of a restart, refuses new connections and closes the
+// remaining ones at the deadline
+func (h *Handler) DrainWebSockets(c *gin.Context) {
+	var req models.WebSocketDrainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		c.Abort()
+		return
+	}
+	deadline, err := time.ParseDuration(req.Deadline)
+	if err != nil || deadline <= 0 || deadline > maxDrainDeadline {
+		c.Error(errors.ErrInvalidRequest("deadline must be a positive duration of at most " + maxDrainDeadline.String()))
+		c.Abort()
+		return
+	}
+
+	status, err := h.hub.Drain(deadline, req.Message)
+	if stderrors.Is(err, websocket.ErrAlreadyDraining) {
+		c.Error(errors.ErrDrainInProgress())
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to notify WebSocket clients", err))
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "websocket.drain", "system", "websocket", map[string]interface{}{
+		"deadline":    status.Deadline,
+		"message":     req.Message,
+		"connections": status.Connections,
+	})
+	c.JSON(http.StatusAccepted, status)
+}
+
+// GetWebSocketStats returns this instance's WebSocket hub counters
+func (h *Handler) GetWebSocketStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.hub.Stats())
+}
+
+// GetWebSocketDrain returns the state of this instance's WebSocket drain
+func (h *Handler) GetWebSocketDrain(c *gin.Context) {
+	c.JSON(http.StatusOK, h.hub.DrainStatus())
+}
+
+// VerifyAuditLog checks the audit log's hash chain from its first entry
+func (h *Handler) VerifyAuditLog(c *gin.Context) {
+	verification, err := audit.Verify(c.Request.Context(), h.dbFor(c))
+	if err != nil {
+		c.Error(errors.ErrDB("verify audit log", err))
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusOK, verification)
+}
+
+// GetAuditLogs returns audit log entries filtered by actor, action and time range
+func (h *Handler) GetAuditLogs(c *gin.Context) {
+	filter := database.AuditLogFilter{
+		ActorType:      c.Query("actor_type"),
+		ActorID:        c.Query("actor"),
+		Action:         c.Query("action"),
+		ImpersonatedBy: c.Query("impersonated_by"),
+		Limit:          50,
+	}
+
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 0 {
+			c.Error(errors.ErrInvalidRequest("Invalid limit parameter"))
+			c.Abort()
+			return
+		}
+		if parsed > 500 {
+			parsed = 500 // Cap at 500
+		}
+		filter.Limit = parsed
+	}
+
+	if o := c.Query("offset"); o != "" {
+		parsed, err := strconv.Atoi(o)
+		if err != nil || parsed < 0 {
+			c.Error(errors.ErrInvalidRequest("Invalid offset parameter"))
+			c.Abort()
+			return
+		}
+		filter.Offset = parsed
+	}
+
+	var err error
+	if filter.Since, err = parseTimeParam(c, "from"); err != nil {
+		c.Error(errors.ErrBadTimestamp("from must be in ISO8601 format"))
+		c.Abort()
+		return
+	}
+	if filter.Until, err = parseTimeParam(c, "to"); err != nil {
+		c.Error(errors.ErrBadTimestamp("to must be in ISO8601 format"))
+		c.Abort()
+		return
+	}
+
+	entries, err := h.dbFor(c).GetAuditLogs(filter)
+	if err != nil {
+		c.Error(errors.ErrDB("get audit logs", err))
+		c.Abort()
+		return
+	}
+
+	response := make([]models.AuditLogResponse, 0, len(entries))
+	for _, e := range entries {
+		response = append(response, e.ToAuditLogResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": response,
+		"limit":   filter.Limit,
+		"offset":  filter.Offset,
+	})
+}
+
+// parseTimeParam parses an optional ISO8601 query parameter
+func parseTimeParam(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return ingest.ParseTimestamp(value)
+}
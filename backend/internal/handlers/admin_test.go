@@ -0,0 +1,25 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"event-ingestion-system/internal/testsupport"
+)
+
+func TestDeletedTenantIsRefusedAtOnce(t *testing.T) {
+	s := testsupport.Start(t)
+	// Authenticating caches the tenant
+	if status, err := s.Client.JSON(http.MethodGet, "/api/v1/events", nil, nil); err != nil || status != http.StatusOK {
+		t.Fatalf("list events: status %d: %v", status, err)
+	}
+
+	if status, err := s.Admin.JSON(http.MethodDelete, "/api/v1/admin/tenants/"+s.Tenant.ID, nil, nil); err != nil || status != http.StatusNoContent {
+		t.Fatalf("delete tenant: status %d: %v", status, err)
+	}
+	// Deleting invalidates the cached tenant on this replica, so its API key
+	// is refused without waiting for auth.tenant_cache_ttl
+	if status, err := s.Client.JSON(http.MethodGet, "/api/v1/events", nil, nil); err != nil || status != http.StatusUnauthorized {
+		t.Fatalf("list events after delete: status %d, want %d: %v", status, http.StatusUnauthorized, err)
+	}
+}
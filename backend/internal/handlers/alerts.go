@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"event-ingestion-system/internal/alert"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/ingest"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loadAlertRule returns the :id alert rule of the authenticated tenant
+func (h *Handler) loadAlertRule(c *gin.Context) (*models.AlertRule, bool) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid alert rule ID"))
+		c.Abort()
+		return nil, false
+	}
+
+	rule, err := h.dbFor(c).GetAlertRule(c.GetString("tenant_id"), uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrAlertNotFound(idParam))
+		} else {
+			c.Error(errors.ErrDB("get alert rule", err))
+		}
+		c.Abort()
+		return nil, false
+	}
+	return rule, true
+}
+
+// applyAlertRuleRequest validates a request and copies it onto rule,
+// starting its state over. It returns a newly generated signing secret, if
+// the rule now needs one.
+func (h *Handler) applyAlertRuleRequest(c *gin.Context, rule *models.AlertRule) (string, bool) {
+	var req models.AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return "", false
+	}
+
+	if err := ingest.ValidateEventType(req.EventType); err != nil {
+		c.Error(errors.ErrBadEventType(err.Error()))
+		c.Abort()
+		return "", false
+	}
+	if err := alert.Validate(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return "", false
+	}
+	if req.WebhookID != nil && req.URL != "" {
+		c.Error(errors.ErrInvalidRequest("At most one of webhook_id and url may be set"))
+		c.Abort()
+		return "", false
+	}
+	if req.URL != "" && !h.checkTargetURL(c, req.URL) {
+		return "", false
+	}
+
+	if req.WebhookID != nil {
+		if _, err := h.dbFor(c).GetWebhook(rule.TenantID, *req.WebhookID); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.Error(errors.ErrWebhookNotFound(strconv.FormatUint(uint64(*req.WebhookID), 10)))
+			} else {
+				c.Error(errors.ErrDB("get webhook", err))
+			}
+			c.Abort()
+			return "", false
+		}
+	}
+
+	match := ""
+	if len(req.Match) > 0 {
+		encoded, err := json.Marshal(req.Match)
+		if err != nil {
+			c.Error(errors.ErrInternal("Failed to encode alert match", err))
+			c.Abort()
+			return "", false
+		}
+		match = string(encoded)
+	}
+
+	rule.Name = req.Name
+	rule.Condition = req.Condition
+	rule.EventType = req.EventType
+	rule.Window = req.Window
+	rule.Threshold = req.Threshold
+	rule.Match = match
+	rule.WebhookID = req.WebhookID
+	rule.URL = req.URL
+	rule.RenotifyAfter = req.RenotifyAfter
+	rule.Active = req.Active == nil || *req.Active
+	rule.State = models.AlertOK
+	rule.StateSince = time.Now().UTC()
+
+	// Deliveries to a URL are signed with a secret of the rule's own
+	secret := ""
+	if rule.URL == "" {
+		rule.Secret = ""
+	} else if rule.Secret == "" {
+		var err error
+		if secret, err = generateSecret(); err != nil {
+			c.Error(errors.ErrInternal("Failed to generate alert secret", err))
+			c.Abort()
+			return "", false
+		}
+		rule.Secret = secret
+	}
+	return secret, true
+}
+
+// alertRuleResult is the body of a create or update; the secret is only
+// included when one was generated
+func alertRuleResult(rule *models.AlertRule, secret string) gin.H {
+	result := gin.H{"alert": rule.ToAlertRuleResponse()}
+	if secret != "" {
+		result["secret"] = secret
+	}
+	return result
+}
+
+// CreateAlertRule adds an alert rule for the authenticated tenant
+func (h *Handler) CreateAlertRule(c *gin.Context) {
+	rule := &models.AlertRule{TenantID: c.GetString("tenant_id")}
+	secret, ok := h.applyAlertRuleRequest(c, rule)
+	if !ok {
+		return
+	}
+
+	if err := h.dbFor(c).CreateAlertRule(rule); err != nil {
+		c.Error(errors.ErrDB("create alert rule", err))
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "alert.create", "alert", strconv.FormatUint(uint64(rule.ID), 10), map[string]interface{}{
+		"name":      rule.Name,
+		"condition": rule.Condition,
+	})
+
+	c.JSON(http.StatusCreated, alertRuleResult(rule, secret))
+}
+
+// ListAlertRules returns the authenticated tenant's alert rules
+func (h *Handler) ListAlertRules(c *gin.Context) {
+	rules, err := h.dbFor(c).ListAlertRules(c.GetString("tenant_id"))
+	if err != nil {
+		c.Error(errors.ErrDB("list alert rules", err))
+		c.Abort()
+		return
+	}
+
+	response := make([]models.AlertRuleResponse, 0, len(rules))
+	for _, rule := range rules {
+		response = append(response, rule.ToAlertRuleResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alerts": response})
+}
+
+// GetAlertRule returns one of the authenticated tenant's alert rules
+func (h *Handler) GetAlertRule(c *gin.Context) {
+	rule, ok := h.loadAlertRule(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rule.ToAlertRuleResponse())
+}
+
+// UpdateAlertRule replaces an alert rule's definition. The rule starts over
+// as ok, so one that still matches fires again on its next evaluation.
+func (h *Handler) UpdateAlertRule(c *gin.Context) {
+	rule, ok := h.loadAlertRule(c)
+	if !ok {
+		return
+	}
+	secret, ok := h.applyAlertRuleRequest(c, rule)
+	if !ok {
+		return
+	}
+
+	if err := h.dbFor(c).UpdateAlertRule(rule); err != nil {
+		c.Error(errors.ErrDB("update alert rule", err))
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "alert.update", "alert", strconv.FormatUint(uint64(rule.ID), 10), map[string]interface{}{
+		"name":      rule.Name,
+		"condition": rule.Condition,
+		"active":    rule.Active,
+	})
+
+	c.JSON(http.StatusOK, alertRuleResult(rule, secret))
+}
+
+// DeleteAlertRule removes one of the authenticated tenant's alert rules and
+// its history
+func (h *Handler) DeleteAlertRule(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	idParam := c.Param("id")
+
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid alert rule ID"))
+		c.Abort()
+		return
+	}
+
+	if err := h.dbFor(c).DeleteAlertRule(tenantID, uint(id)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrAlertNotFound(idParam))
+		} else {
+			c.Error(errors.ErrDB("delete alert rule", err))
+		}
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "alert.delete", "alert", idParam, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetAlertHistory returns an alert rule's firing and resolved transitions,
+// newest first
+func (h *Handler) GetAlertHistory(c *gin.Context) {
+	rule, ok := h.loadAlertRule(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 0 {
+			c.Error(errors.ErrInvalidRequest("Invalid limit parameter"))
+			c.Abort()
+			return
+		}
+		if parsed > 500 {
+			parsed = 500 // Cap at 500
+		}
+		limit = parsed
+	}
+
+	history, err := h.dbFor(c).GetAlertHistory(rule.TenantID, rule.ID, limit)
+	if err != nil {
+		c.Error(errors.ErrDB("get alert history", err))
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alert_id": rule.ID,
+		"history":  history,
+		"limit":    limit,
+	})
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"event-ingestion-system/internal/auth"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/realip"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	// maxBatchEvents bounds the events of one batch
+	maxBatchEvents = 1000
+	// maxBatchErrors bounds the events an atomic batch's error lists
+	maxBatchErrors = 5
+)
+
+// BatchResultHeader summarizes a batch's outcome for clients that do not
+// read the body
+const BatchResultHeader = "X-Batch-Result"
+
+// IngestBatch ingests a JSON array of events, each as POST /events takes
+// it, and stores those that are valid in one transaction. The response
+// lists every event's outcome by index: 201 when all were stored or sampled
+// out, 207 when some were rejected. With ?atomic=true any rejected event
+// rejects the batch with 400 batch_rejected and nothing is stored.
+//
+// Only client errors reject single events. A server error, while checking
+// an event or storing the batch, fails the whole request with nothing
+// stored, so the batch can be sent again as it is.
+func (h *Handler) IngestBatch(c *gin.Context) {
+	atomic := false
+	if a := c.Query("atomic"); a != "" {
+		parsed, err := strconv.ParseBool(a)
+		if err != nil {
+			c.Error(errors.ErrInvalidRequest("Invalid atomic parameter"))
+			c.Abort()
+			return
+		}
+		atomic = parsed
+	}
+
+	var items []json.RawMessage
+	if err := c.ShouldBindJSON(&items); err != nil {
+		c.Error(invalidRequest(err))
+		c.Abort()
+		return
+	}
+	if len(items) == 0 || len(items) > maxBatchEvents {
+		c.Error(errors.ErrInvalidRequest(fmt.Sprintf("A batch must hold between 1 and %d events, got %d", maxBatchEvents, len(items))))
+		c.Abort()
+		return
+	}
+
+	ctx := c.Request.Context()
+	source, credential, clientIP := c.GetHeader(EventSourceHeader), auth.Credential(c), realip.Get(c)
+	chunk := h.ingest.NewChunk()
+	results := make([]models.BatchEventResult, len(items))
+	// held are the indexes of the events the chunk holds, in its order
+	var held []int
+	var rejected []int
+	for i, item := range items {
+		results[i].Index = i
+		var req models.EventRequest
+		err := json.Unmarshal(item, &req)
+		if err == nil {
+			err = binding.Validator.ValidateStruct(&req)
+		}
+		if err != nil {
+			results[i].Status, results[i].Error = http.StatusBadRequest, invalidRequest(err)
+			rejected = append(rejected, i)
+			continue
+		}
+
+		if req.Source == "" {
+			req.Source = source
+		}
+		req.Credential, req.ClientIP = credential, clientIP
+		event, err := chunk.Add(ctx, req)
+		if err != nil {
+			appErr, ok := err.(*errors.AppError)
+			if !ok || appErr.StatusCode >= http.StatusInternalServerError {
+				c.Error(err)
+				c.Abort()
+				return
+			}
+			results[i].Status, results[i].Error = appErr.StatusCode, appErr
+			rejected = append(rejected, i)
+			continue
+		}
+		if event.Sampled {
+			results[i].Status, results[i].Sampled = http.StatusAccepted, true
+			continue
+		}
+		held = append(held, i)
+	}
+
+	if atomic && len(rejected) > 0 {
+		c.Error(errors.ErrBatchRejected(len(rejected), batchErrors(results, rejected)))
+		c.Abort()
+		return
+	}
+
+	stored, err := chunk.Commit(ctx)
+	if err != nil {
+		c.Error(err)
+		c.Abort()
+		return
+	}
+	for j, i := range held {
+		results[i].Status = http.StatusCreated
+		results[i].ID, results[i].Sequence = uint64(stored[j].ID), stored[j].Sequence
+	}
+
+	resp := models.BatchEventResponse{
+		Status:   models.BatchAccepted,
+		Accepted: len(items) - len(rejected),
+		Rejected: len(rejected),
+		Items:    results,
+	}
+	status := http.StatusCreated
+	switch {
+	case resp.Accepted == 0:
+		resp.Status, status = models.BatchRejected, http.StatusMultiStatus
+	case resp.Rejected > 0:
+		resp.Status, status = models.BatchPartial, http.StatusMultiStatus
+	}
+	c.Header(BatchResultHeader, fmt.Sprintf("accepted=%d; rejected=%d", resp.Accepted, resp.Rejected))
+	c.JSON(status, resp)
+}
+
+// batchErrors lists the errors of the first rejected events as fields
+// under their index, such as [3].event_type, or [3] for errors of the
+// whole event
+func batchErrors(results []models.BatchEventResult, rejected []int) []errors.FieldError {
+	var fields []errors.FieldError
+	for _, i := range rejected[:min(len(rejected), maxBatchErrors)] {
+		appErr := results[i].Error
+		prefix := "[" + strconv.Itoa(i) + "]"
+		if len(appErr.Fields) == 0 {
+			fields = append(fields, errors.FieldError{Field: prefix, Rule: string(appErr.Code), Message: appErr.Details})
+			continue
+		}
+		for _, f := range appErr.Fields {
+			f.Field = prefix + "." + f.Field
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,212 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/handlers"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/testsupport"
+)
+
+// batchError is an error as the batch endpoint reports it, per event or for
+// the whole request
+type batchError struct {
+	Code   string `json:"code"`
+	Fields []struct {
+		Field string `json:"field"`
+		Rule  string `json:"rule"`
+	} `json:"fields"`
+}
+
+// batchResponse is models.BatchEventResponse with errors decoded as
+// clients see them
+type batchResponse struct {
+	Status   string `json:"status"`
+	Accepted int    `json:"accepted"`
+	Rejected int    `json:"rejected"`
+	Items    []struct {
+		Index    int         `json:"index"`
+		Status   int         `json:"status"`
+		ID       uint64      `json:"id"`
+		Sequence uint64      `json:"sequence"`
+		Error    *batchError `json:"error"`
+	} `json:"items"`
+}
+
+// batchOf returns a valid event of s's tenant for each metadata, with the
+// events at the invalid indexes missing their event_type
+func batchOf(s *testsupport.Server, metadata []string, invalid ...int) []map[string]any {
+	events := make([]map[string]any, len(metadata))
+	for i, m := range metadata {
+		events[i] = map[string]any{
+			"tenant_id":  s.Tenant.ID,
+			"event_type": "batch.test",
+			"timestamp":  time.Now().UTC().Format(time.RFC3339),
+			"metadata":   json.RawMessage(m),
+		}
+	}
+	for _, i := range invalid {
+		delete(events[i], "event_type")
+	}
+	return events
+}
+
+// storedEvents returns the tenant's stored events
+func storedEvents(t *testing.T, s *testsupport.Server) []models.EventResponse {
+	t.Helper()
+	var page struct {
+		Events []models.EventResponse `json:"events"`
+	}
+	status, err := s.Client.JSON(http.MethodGet, "/api/v1/events", nil, &page)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("list events: status %d: %v", status, err)
+	}
+	return page.Events
+}
+
+func TestIngestBatchStoresValidEventsOfAPartialBatch(t *testing.T) {
+	s := testsupport.Start(t)
+	// The batch path applies the tenant's redaction rules like POST /events
+	status, err := s.Client.JSON(http.MethodPut, "/api/v1/tenants/"+s.Tenant.ID+"/redaction-rules", models.RedactionRulesRequest{
+		Rules: []models.RedactionRule{{Name: "drop-email", Path: "$.email", Action: "remove"}},
+	}, nil)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("set redaction rules: status %d: %v", status, err)
+	}
+
+	resp, err := s.Client.Request(http.MethodPost, "/api/v1/events/batch", batchOf(s, []string{
+		`{"n":0,"email":"a@example.com"}`, `{"n":1}`, `{"n":2}`,
+	}, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var batch batchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusMultiStatus)
+	}
+	if got, want := resp.Header.Get(handlers.BatchResultHeader), "accepted=2; rejected=1"; got != want {
+		t.Errorf("%s = %q, want %q", handlers.BatchResultHeader, got, want)
+	}
+	if batch.Status != models.BatchPartial || batch.Accepted != 2 || batch.Rejected != 1 || len(batch.Items) != 3 {
+		t.Fatalf("batch = %+v, want partial with 2 accepted and 1 rejected", batch)
+	}
+	for _, i := range []int{0, 2} {
+		if item := batch.Items[i]; item.Index != i || item.Status != http.StatusCreated || item.ID == 0 || item.Sequence == 0 {
+			t.Errorf("item %d = %+v, want stored", i, item)
+		}
+	}
+	rejected := batch.Items[1]
+	if rejected.Status != http.StatusBadRequest || rejected.Error == nil || rejected.Error.Code != "invalid_request" ||
+		len(rejected.Error.Fields) != 1 || rejected.Error.Fields[0].Field != "event_type" || rejected.Error.Fields[0].Rule != "required" {
+		t.Fatalf("item 1 = %+v, want rejected for the missing event_type field", rejected)
+	}
+
+	events := storedEvents(t, s)
+	if len(events) != 2 {
+		t.Fatalf("%d events stored, want 2", len(events))
+	}
+	for _, event := range events {
+		var metadata map[string]any
+		if err := json.Unmarshal(event.Metadata, &metadata); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := metadata["email"]; ok {
+			t.Errorf("event %d kept the email the redaction rule removes: %s", event.ID, event.Metadata)
+		}
+	}
+}
+
+func TestIngestBatchRejectsAnAtomicBatchWithInvalidEvents(t *testing.T) {
+	s := testsupport.Start(t)
+
+	var body struct {
+		Error batchError `json:"error"`
+	}
+	status, err := s.Client.JSON(http.MethodPost, "/api/v1/events/batch?atomic=true", batchOf(s, []string{
+		`{"n":0}`, `{"n":1}`, `{"n":2}`, `{"n":3}`,
+	}, 1, 3), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != http.StatusBadRequest || body.Error.Code != "batch_rejected" {
+		t.Fatalf("status %d, error %+v, want 400 batch_rejected", status, body.Error)
+	}
+	var fields []string
+	for _, f := range body.Error.Fields {
+		fields = append(fields, f.Field)
+	}
+	if got, want := fmt.Sprint(fields), "[[1].event_type [3].event_type]"; got != want {
+		t.Errorf("fields = %s, want %s", got, want)
+	}
+	if events := storedEvents(t, s); len(events) != 0 {
+		t.Fatalf("%d events stored from a rejected atomic batch", len(events))
+	}
+}
+
+// TestIngestBatchStoresNothingWhenTheDatabaseFailsMidBatch makes the
+// database refuse one event after others of the batch were inserted in
+// the same transaction. In either mode the request fails with nothing
+// stored, not even a sequence number, and sending it again as it is
+// stores the whole batch.
+func TestIngestBatchStoresNothingWhenTheDatabaseFailsMidBatch(t *testing.T) {
+	for _, mode := range []struct{ name, path string }{
+		{"partial", "/api/v1/events/batch"},
+		{"atomic", "/api/v1/events/batch?atomic=true"},
+	} {
+		t.Run(mode.name, func(t *testing.T) {
+			// Two rows per INSERT, so the failing row is in a later
+			// statement than the first events
+			s := testsupport.Start(t, func(cfg *config.Config) { cfg.Ingest.BatchSize = 2 })
+			db := s.App.DB.DB
+			err := db.Exec(`CREATE TRIGGER fail_marked_events BEFORE INSERT ON events
+				WHEN NEW.metadata LIKE '%"fail":true%'
+				BEGIN SELECT RAISE(ABORT, 'injected failure'); END`).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			batch := batchOf(s, []string{`{"n":0}`, `{"n":1}`, `{"n":2}`, `{"n":3,"fail":true}`, `{"n":4}`})
+
+			var body struct {
+				Error batchError `json:"error"`
+			}
+			status, err := s.Client.JSON(http.MethodPost, mode.path, batch, &body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != http.StatusInternalServerError || body.Error.Code != "database_error" {
+				t.Fatalf("status %d, error %+v, want 500 database_error", status, body.Error)
+			}
+			if events := storedEvents(t, s); len(events) != 0 {
+				t.Fatalf("%d events stored from a failed batch", len(events))
+			}
+
+			if err := db.Exec("DROP TRIGGER fail_marked_events").Error; err != nil {
+				t.Fatal(err)
+			}
+			var stored batchResponse
+			status, err = s.Client.JSON(http.MethodPost, mode.path, batch, &stored)
+			if err != nil || status != http.StatusCreated {
+				t.Fatalf("resend: status %d: %v", status, err)
+			}
+			for i, item := range stored.Items {
+				if item.Status != http.StatusCreated || item.Sequence != uint64(i+1) {
+					t.Errorf("resent item %d = %+v, want stored with sequence %d", i, item, i+1)
+				}
+			}
+			if events := storedEvents(t, s); len(events) != len(batch) {
+				t.Fatalf("%d events stored after the resend, want %d", len(events), len(batch))
+			}
+		})
+	}
+}
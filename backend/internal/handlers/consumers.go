@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// consumerNamePattern restricts consumer names to what is safe in a URL path
+var consumerNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,100}$`)
+
+// consumerName returns the validated :name parameter
+func consumerName(c *gin.Context) (string, bool) {
+	name := c.Param("name")
+	if !consumerNamePattern.MatchString(name) {
+		c.Error(errors.ErrInvalidRequest("Consumer name must be 1-100 letters, digits, dots, dashes or underscores"))
+		c.Abort()
+		return "", false
+	}
+	return name, true
+}
+
+// ListConsumers returns the caller's consumers with their checkpoints and
+// the number of events each has yet to commit
+func (h *Handler) ListConsumers(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	db := h.dbFor(c)
+	store := h.eventsFor(c)
+
+	offsets, err := db.ListConsumerOffsets(tenantID)
+	if err != nil {
+		c.Error(errors.ErrDB("list consumers", err))
+		c.Abort()
+		return
+	}
+
+	consumers := make([]models.ConsumerStatus, 0, len(offsets))
+	for _, o := range offsets {
+		lag, err := store.CountEventsAfter(tenantID, o.LastEventID)
+		if err != nil {
+			c.Error(errors.ErrDB("list consumers", err))
+			c.Abort()
+			return
+		}
+		consumers = append(consumers, models.ConsumerStatus{
+			Name:        o.ConsumerName,
+			LastEventID: o.LastEventID,
+			Lag:         lag,
+			UpdatedAt:   o.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"consumers": consumers})
+}
+
+// PollConsumer returns the events after a consumer's checkpoint, oldest
+// first. Polling does not move the checkpoint: concurrent polls by one
+// consumer see the same events until one of them commits, and committing
+// is monotonic, so duplicate work is possible but lost events are not.
+func (h *Handler) PollConsumer(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	name, ok := consumerName(c)
+	if !ok {
+		return
+	}
+
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 {
+			c.Error(errors.ErrInvalidRequest("Invalid limit parameter"))
+			c.Abort()
+			return
+		}
+		if parsed > 1000 {
+			parsed = 1000 // Cap at 1000
+		}
+		limit = parsed
+	}
+
+	db := h.dbFor(c)
+	offset, err := db.GetConsumerOffset(tenantID, name)
+	if err != nil {
+		c.Error(errors.ErrDB("get consumer offset", err))
+		c.Abort()
+		return
+	}
+	events, err := h.eventsFor(c).GetEventsAfter(tenantID, offset.LastEventID, limit)
+	if err != nil {
+		c.Error(errors.ErrDB("get events", err))
+		c.Abort()
+		return
+	}
+
+	response := make([]models.EventResponse, 0, len(events))
+	for _, e := range events {
+		response = append(response, e.ToEventResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"consumer": name,
+		"offset":   offset.LastEventID,
+		"events":   response,
+	})
+}
+
+// CommitConsumer moves a consumer's checkpoint. A commit behind the stored
+// offset is rejected unless ?force=true, which rewinds the consumer.
+func (h *Handler) CommitConsumer(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	name, ok := consumerName(c)
+	if !ok {
+		return
+	}
+
+	force := false
+	if f := c.Query("force"); f != "" {
+		parsed, err := strconv.ParseBool(f)
+		if err != nil {
+			c.Error(errors.ErrInvalidRequest("Invalid force parameter"))
+			c.Abort()
+			return
+		}
+		force = parsed
+	}
+
+	var req models.CommitOffsetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+
+	// A checkpoint past the newest event would silently skip events that
+	// have not been ingested yet
+	db := h.dbFor(c)
+	latest, err := h.eventsFor(c).GetLatestEventID(tenantID)
+	if err != nil {
+		c.Error(errors.ErrDB("get latest event", err))
+		c.Abort()
+		return
+	}
+	if *req.LastEventID > latest {
+		c.Error(errors.ErrInvalidRequest("last_event_id is beyond the latest event (" + strconv.FormatUint(uint64(latest), 10) + ")"))
+		c.Abort()
+		return
+	}
+
+	offset, err := db.CommitConsumerOffset(tenantID, name, *req.LastEventID, force)
+	if err != nil {
+		if stderrors.Is(err, database.ErrOffsetBehind) {
+			c.Error(errors.ErrOffsetBehind(name, offset.LastEventID))
+			c.Abort()
+			return
+		}
+		c.Error(errors.ErrDB("commit consumer offset", err))
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, offset)
+}
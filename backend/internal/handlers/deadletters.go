@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetDeadLetters lists dead letters, most recently failed first, optionally
+// narrowed to one tenant or source
+func (h *Handler) GetDeadLetters(c *gin.Context) {
+	filter := database.DeadLetterFilter{
+		TenantID: c.Query("tenant_id"),
+		Source:   c.Query("source"),
+		Limit:    50,
+	}
+
+	switch filter.Source {
+	case "", models.DeadLetterIngest, models.DeadLetterSink, models.DeadLetterWebhook:
+	default:
+		c.Error(errors.ErrInvalidRequest("source must be ingest, sink or webhook"))
+		c.Abort()
+		return
+	}
+
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 0 {
+			c.Error(errors.ErrInvalidRequest("Invalid limit parameter"))
+			c.Abort()
+			return
+		}
+		if parsed > 500 {
+			parsed = 500 // Cap at 500
+		}
+		filter.Limit = parsed
+	}
+
+	if o := c.Query("offset"); o != "" {
+		parsed, err := strconv.Atoi(o)
+		if err != nil || parsed < 0 {
+			c.Error(errors.ErrInvalidRequest("Invalid offset parameter"))
+			c.Abort()
+			return
+		}
+		filter.Offset = parsed
+	}
+
+	letters, err := h.dbFor(c).GetDeadLetters(filter)
+	if err != nil {
+		c.Error(errors.ErrDB("get dead letters", err))
+		c.Abort()
+		return
+	}
+
+	response := make([]models.DeadLetterResponse, 0, len(letters))
+	for _, l := range letters {
+		response = append(response, l.ToDeadLetterResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dead_letters": response,
+		"limit":        filter.Limit,
+		"offset":       filter.Offset,
+	})
+}
+
+// RetryDeadLetter processes a dead letter again through the ingest service.
+// On success the dead letter is removed; on failure its attempt count and
+// error are updated. Either way the outcome is reported with 200, like a
+// webhook test.
+func (h *Handler) RetryDeadLetter(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid dead letter ID"))
+		c.Abort()
+		return
+	}
+
+	db := h.dbFor(c)
+	letter, err := db.GetDeadLetter(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrDeadLetterNotFound(idParam))
+			c.Abort()
+			return
+		}
+		c.Error(errors.ErrDB("get dead letter", err))
+		c.Abort()
+		return
+	}
+
+	event, retryErr := h.ingest.RetryDeadLetter(c.Request.Context(), letter)
+	if retryErr != nil {
+		cause := retryErr.Error()
+		var appErr *errors.AppError
+		if stderrors.As(retryErr, &appErr) && appErr.Internal == nil && appErr.Details != "" {
+			cause = appErr.Message + ": " + appErr.Details
+		}
+		if err := db.RecordDeadLetterAttempt(letter.ID, cause, time.Now().UTC()); err != nil {
+			c.Error(errors.ErrDB("update dead letter", err))
+			c.Abort()
+			return
+		}
+
+		h.recordAudit(c, "dead_letter.retry", "dead_letter", idParam, map[string]interface{}{
+			"source":    letter.Source,
+			"succeeded": false,
+		})
+		c.JSON(http.StatusOK, gin.H{
+			"id":        letter.ID,
+			"succeeded": false,
+			"error":     cause,
+			"attempts":  letter.Attempts + 1,
+		})
+		return
+	}
+
+	if err := db.DeleteDeadLetter(letter.ID); err != nil && err != gorm.ErrRecordNotFound {
+		c.Error(errors.ErrDB("delete dead letter", err))
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "dead_letter.retry", "dead_letter", idParam, map[string]interface{}{
+		"source":    letter.Source,
+		"succeeded": true,
+	})
+	response := gin.H{
+		"id":        letter.ID,
+		"succeeded": true,
+		"attempts":  letter.Attempts + 1,
+	}
+	if event != nil {
+		response["event_id"] = event.ID
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/testsupport"
+)
+
+// requestID is sent with every request, so the error bodies are fixed
+const requestID = "error-body-test"
+
+// TestErrorBodies pins the bytes of error responses, which clients parse
+// and must not change when errors move between handlers and ErrorHandler
+func TestErrorBodies(t *testing.T) {
+	s := testsupport.Start(t)
+	client := s.Client.With("X-Request-ID", requestID)
+	event := func(tenantID, eventType string) models.EventRequest {
+		return models.EventRequest{
+			TenantID:  tenantID,
+			EventType: eventType,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Metadata:  []byte(`{}`),
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		client *testsupport.Client
+		method string
+		path   string
+		body   any
+		status int
+		want   string
+	}{
+		{
+			name: "event not found", client: client, method: http.MethodGet, path: "/api/v1/events/999999",
+			status: http.StatusNotFound,
+			want:   `{"error":{"code":"event_not_found","details":"Event with ID '999999' was not found","message":"Event not found","request_id":"error-body-test"}}`,
+		},
+		{
+			name: "malformed tenant ID", client: client, method: http.MethodGet, path: "/api/v1/tenants/not-a-uuid",
+			status: http.StatusBadRequest,
+			want:   `{"error":{"code":"invalid_tenant_id","details":"Invalid UUID format","message":"Invalid tenant ID","request_id":"error-body-test"}}`,
+		},
+		{
+			name: "tenant not found", client: client, method: http.MethodPost, path: "/api/v1/events",
+			body:   event("00000000-0000-4000-8000-000000000000", "page.view"),
+			status: http.StatusNotFound,
+			want:   `{"error":{"code":"tenant_not_found","details":"Tenant with ID '00000000-0000-4000-8000-000000000000' was not found","message":"Tenant not found","request_id":"error-body-test"}}`,
+		},
+		{
+			name: "invalid field", client: client, method: http.MethodPost, path: "/api/v1/events",
+			body:   event(s.Tenant.ID, "not a type"),
+			status: http.StatusBadRequest,
+			want:   `{"error":{"code":"invalid_event_type","details":"event_type: can only contain alphanumeric characters, underscores, hyphens, and dots","fields":[{"field":"event_type","rule":"pattern","message":"can only contain alphanumeric characters, underscores, hyphens, and dots"}],"message":"Invalid event type","request_id":"error-body-test"}}`,
+		},
+		{
+			name: "missing credentials", client: s.Anonymous.With("X-Request-ID", requestID), method: http.MethodGet, path: "/api/v1/events",
+			status: http.StatusUnauthorized,
+			want:   `{"error":"unauthorized","message":"Invalid or missing authentication credentials"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assertErrorBody(t, tc.client, tc.method, tc.path, tc.body, tc.status, tc.want)
+		})
+	}
+}
+
+// TestInactiveTenantErrorBody pins the 403 for a tenant deactivated after
+// its token was issued
+func TestInactiveTenantErrorBody(t *testing.T) {
+	// Every lookup reads the database, so deactivation is seen at once
+	s := testsupport.Start(t, func(cfg *config.Config) { cfg.Auth.TenantCacheTTL = time.Nanosecond })
+	var issued struct {
+		Token string `json:"token"`
+	}
+	if status, err := s.Client.JSON(http.MethodGet, "/api/v1/tenants/"+s.Tenant.ID+"/token", nil, &issued); err != nil || status != http.StatusOK {
+		t.Fatalf("get token: status %d: %v", status, err)
+	}
+	if err := s.App.DB.DB.Model(&models.Tenant{}).Where("id = ?", s.Tenant.ID).Update("active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	client := s.Anonymous.With("Authorization", "Bearer "+issued.Token).With("X-Request-ID", requestID)
+	assertErrorBody(t, client, http.MethodPost, "/api/v1/events", models.EventRequest{
+		TenantID:  s.Tenant.ID,
+		EventType: "page.view",
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Metadata:  []byte(`{}`),
+	}, http.StatusForbidden, `{"error":{"code":"unauthorized","details":"Tenant is inactive","message":"Unauthorized","request_id":"error-body-test"}}`)
+}
+
+func assertErrorBody(t *testing.T, client *testsupport.Client, method, path string, body any, status int, want string) {
+	t.Helper()
+	resp, err := client.Request(method, path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != status || string(got) != want {
+		t.Fatalf("%s %s: status %d, body\n%s\nwant status %d, body\n%s", method, path, resp.StatusCode, got, status, want)
+	}
+}
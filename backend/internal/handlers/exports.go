@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/archive"
+	"event-ingestion-system/internal/auth"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/export"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StartExport queues an export of all of the tenant's data, compressed as
+// ?compress= asks: gzip, the default, or zstd. A tenant may have one export
+// pending or running at a time.
+func (h *Handler) StartExport(c *gin.Context) {
+	if !h.requireSQLEvents(c, "Exports") {
+		return
+	}
+	tenantID := c.Param("id")
+	if _, err := uuid.Parse(tenantID); err != nil {
+		c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+		c.Abort()
+		return
+	}
+	if tenantID != auth.GetTenantIDFromContext(c) {
+		c.Error(errors.ErrForbidden("Tenants can only export their own data"))
+		c.Abort()
+		return
+	}
+
+	compression := c.DefaultQuery("compress", models.CompressionGzip)
+	if compression != models.CompressionGzip && compression != models.CompressionZstd {
+		c.Error(errors.ErrInvalidRequest("compress must be gzip or zstd"))
+		c.Abort()
+		return
+	}
+
+	job := &models.ExportJob{Job: models.Job{ID: uuid.New().String(), TenantID: tenantID}, Compression: compression}
+	active, err := h.dbFor(c).CreateExportJob(job)
+	if err != nil {
+		c.Error(errors.ErrDB("create export job", err))
+		c.Abort()
+		return
+	}
+	if active != nil {
+		c.Error(errors.ErrExportInProgress(active.ID))
+		c.Abort()
+		return
+	}
+	h.exports.Notify()
+
+	h.recordAudit(c, "tenant.export", "tenant", tenantID, map[string]interface{}{"job_id": job.ID, "compression": compression})
+
+	c.Header("Location", c.Request.URL.Path+"/"+job.ID)
+	c.JSON(http.StatusAccepted, models.ExportJobResponse{ExportJob: *job})
+}
+
+// GetExport returns an export job's status and, once it has completed,
+// time-limited download links for its manifest and each part of its
+// archive
+func (h *Handler) GetExport(c *gin.Context) {
+	tenantID, jobID := c.Param("id"), c.Param("job_id")
+	if tenantID != auth.GetTenantIDFromContext(c) {
+		c.Error(errors.ErrForbidden("Tenants can only see their own exports"))
+		c.Abort()
+		return
+	}
+
+	job, err := h.dbFor(c).GetExportJob(tenantID, jobID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrExportNotFound(jobID))
+		} else {
+			c.Error(errors.ErrDB("get export job", err))
+		}
+		c.Abort()
+		return
+	}
+
+	resp := models.ExportJobResponse{ExportJob: *job}
+	if job.Status == models.JobCompleted {
+		parts, err := h.dbFor(c).ListExportParts(job.ID)
+		if err != nil {
+			c.Error(errors.ErrDB("list export parts", err))
+			c.Abort()
+			return
+		}
+		expires := time.Now().Add(h.cfg.Archive.URLExpiry).UTC().Truncate(time.Second)
+		link := func(key string) (string, error) {
+			link, err := h.archive.URL(key, export.Filename(job, key), expires)
+			return absoluteURL(c, link), err
+		}
+
+		// Archives from before parts are a single file without a manifest
+		if len(parts) == 0 {
+			resp.DownloadURL, err = link(job.ObjectKey)
+		} else {
+			resp.ManifestURL, err = link(job.ObjectKey)
+		}
+		for _, part := range parts {
+			if err != nil {
+				break
+			}
+			partResp := models.ExportPartResponse{ExportPart: part}
+			partResp.DownloadURL, err = link(part.ObjectKey)
+			resp.Parts = append(resp.Parts, partResp)
+		}
+		if err != nil {
+			c.Error(errors.ErrInternal("Failed to create download link", err))
+			c.Abort()
+			return
+		}
+		if len(parts) == 1 {
+			resp.DownloadURL = resp.Parts[0].DownloadURL
+		}
+		resp.URLExpiresAt = &expires
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DownloadArchive serves a file of the local archive through a signed link.
+// The link is the credential, so the route takes no other authentication.
+func (h *Handler) DownloadArchive(c *gin.Context) {
+	local, ok := h.archive.(*archive.Local)
+	if !ok {
+		RouteNotFound(c)
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	file, err := local.OpenLink(key, c.Request.URL.Query())
+	if err != nil {
+		switch {
+		case stderrors.Is(err, archive.ErrInvalidLink):
+			c.Error(errors.ErrForbidden("The download link is invalid or has expired"))
+		case stderrors.Is(err, fs.ErrNotExist):
+			c.Error(errors.ErrArchiveNotFound())
+		default:
+			c.Error(errors.ErrInternal("Failed to open archive", err))
+		}
+		c.Abort()
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to open archive", err))
+		c.Abort()
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+strings.ReplaceAll(c.Query("filename"), `"`, "")+`"`)
+	c.Header("Cache-Control", "private, no-store")
+	c.DataFromReader(http.StatusOK, info.Size(), archive.ContentType(key), file, nil)
+}
+
+// absoluteURL resolves a link relative to this server against the request's
+// origin
+func absoluteURL(c *gin.Context, link string) string {
+	if !strings.HasPrefix(link, "/") {
+		return link
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + link
+}
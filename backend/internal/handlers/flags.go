@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetTenantFlags lists every feature flag with its default, the tenant's
+// override and whether it is enabled for the tenant
+func (h *Handler) GetTenantFlags(c *gin.Context) {
+	tenantID := c.Param("id")
+	if _, err := uuid.Parse(tenantID); err != nil {
+		c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+		c.Abort()
+		return
+	}
+	tenant, settings, ok := h.loadTenantSettings(c, tenantID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"flags": h.flags.Tenant(settings), "version": tenant.Version})
+}
+
+// SetTenantFlag overrides a feature flag for the tenant. The change applies
+// to the tenant's next requests once its cached settings expire.
+func (h *Handler) SetTenantFlag(c *gin.Context) {
+	var req models.FeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		c.Abort()
+		return
+	}
+	h.changeTenantFlag(c, req.Enabled)
+}
+
+// ResetTenantFlag removes the tenant's override, so the flag's default
+// applies again
+func (h *Handler) ResetTenantFlag(c *gin.Context) {
+	h.changeTenantFlag(c, nil)
+}
+
+// changeTenantFlag sets the tenant's override of the flag named in the
+// path, or removes it when enabled is nil. The settings are saved at the
+// version they were read, so concurrent changes to them are not lost.
+func (h *Handler) changeTenantFlag(c *gin.Context, enabled *bool) {
+	tenantID := c.Param("id")
+	if _, err := uuid.Parse(tenantID); err != nil {
+		c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+		c.Abort()
+		return
+	}
+	name := c.Param("name")
+	if !h.flags.Defined(name) {
+		c.Error(errors.ErrFlagNotFound(name))
+		c.Abort()
+		return
+	}
+
+	tenant, settings, ok := h.loadTenantSettings(c, tenantID)
+	if !ok {
+		return
+	}
+	previous, overridden := settings.Flags[name]
+	action := "tenant.flag.reset"
+	if enabled != nil {
+		action = "tenant.flag.update"
+		if settings.Flags == nil {
+			settings.Flags = make(map[string]bool)
+		}
+		settings.Flags[name] = *enabled
+	} else {
+		delete(settings.Flags, name)
+	}
+	updated, ok := h.saveTenantSettings(c, tenantID, settings, tenant.Version)
+	if !ok {
+		return
+	}
+
+	details := map[string]interface{}{"flag": name, "version": updated}
+	if overridden {
+		details["previous"] = previous
+	}
+	if enabled != nil {
+		details["enabled"] = *enabled
+	}
+	h.recordAudit(c, action, "tenant", tenantID, details)
+
+	for _, flag := range h.flags.Tenant(settings) {
+		if flag.Name == name {
+			c.JSON(http.StatusOK, gin.H{"flag": flag, "version": updated})
+			return
+		}
+	}
+}
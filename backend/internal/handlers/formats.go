@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ugorji/go/codec"
+)
+
+// Media types events can be exchanged in besides JSON
+const (
+	MIMEMsgPack = "application/msgpack"
+	MIMECBOR    = "application/cbor"
+	// mimeMsgPackLegacy is the unregistered name many msgpack clients send
+	mimeMsgPackLegacy = "application/x-msgpack"
+)
+
+var (
+	// Times are encoded natively: the msgpack timestamp extension and CBOR
+	// tag 0, both with nanoseconds
+	msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+	cborHandle    = &codec.CborHandle{TimeRFC3339: true}
+)
+
+func init() {
+	for _, h := range []*codec.BasicHandle{&msgpackHandle.BasicHandle, &cborHandle.BasicHandle} {
+		// Decode maps the way encoding/json does, so they can be stored as
+		// JSON metadata
+		h.MapType = reflect.TypeOf(map[string]any(nil))
+		h.RawToString = true
+	}
+}
+
+// codecFor returns the encoding of a media type; nil means JSON
+func codecFor(mime string) codec.Handle {
+	switch mime {
+	case MIMEMsgPack, mimeMsgPackLegacy:
+		return msgpackHandle
+	case MIMECBOR:
+		return cborHandle
+	}
+	return nil
+}
+
+// render writes body in the format the Accept header prefers, JSON unless
+// it asks for msgpack or CBOR. Events in body have their metadata sent as a
+// nested map in the binary formats. Errors are always JSON.
+func render(c *gin.Context, status int, body any) {
+	c.Writer.Header().Add("Vary", "Accept")
+	format := c.NegotiateFormat(binding.MIMEJSON, MIMEMsgPack, mimeMsgPackLegacy, MIMECBOR)
+	handle := codecFor(format)
+	if handle == nil {
+		c.JSON(status, body)
+		return
+	}
+
+	var out []byte
+	if err := codec.NewEncoderBytes(&out, handle).Encode(binaryValue(body)); err != nil {
+		c.Error(errors.ErrInternal("Failed to encode response", err))
+		c.Abort()
+		return
+	}
+	c.Data(status, format, out)
+}
+
+// bindEventRequest reads an event in the format of the request's
+// Content-Type, JSON unless it is msgpack or CBOR, and validates it. Binary
+// requests send metadata as a map and may send a native timestamp; the CBOR
+// decoder rounds those to the microsecond, so finer ones go as strings.
+func bindEventRequest(c *gin.Context, req *models.EventRequest) error {
+	handle := codecFor(c.ContentType())
+	if handle == nil {
+		return c.ShouldBindJSON(req)
+	}
+
+	var in binaryEventRequest
+	if err := codec.NewDecoder(c.Request.Body, handle).Decode(&in); err != nil {
+		return err
+	}
+	req.TenantID, req.EventType, req.Source = in.TenantID, in.EventType, in.Source
+	req.CorrelationID, req.CausationID = in.CorrelationID, in.CausationID
+	switch ts := in.Timestamp.(type) {
+	case nil:
+	case string:
+		req.Timestamp = ts
+	case time.Time:
+		req.Timestamp = ts.Format(time.RFC3339Nano)
+	default:
+		return &ValidationError{Field: "timestamp", Rule: "type", Message: "must be a string or a timestamp"}
+	}
+	if in.Metadata != nil {
+		metadata, err := json.Marshal(in.Metadata)
+		if err != nil {
+			return &ValidationError{Field: "metadata", Rule: "type", Message: "must be a map of JSON-compatible values"}
+		}
+		req.Metadata = metadata
+	}
+	return binding.Validator.ValidateStruct(req)
+}
+
+// binaryEventRequest is models.EventRequest as msgpack and CBOR clients send it
+type binaryEventRequest struct {
+	TenantID  string `json:"tenant_id"`
+	EventType string `json:"event_type"`
+	Timestamp any    `json:"timestamp"`
+	Metadata  any    `json:"metadata"`
+	Source    string `json:"source"`
+
+	CorrelationID string `json:"correlation_id"`
+	CausationID   string `json:"causation_id"`
+}
+
+// binaryEvent is models.EventResponse with the metadata decoded, since the
+// binary formats would otherwise carry the JSON text as bytes
+type binaryEvent struct {
+	ID          uint64     `json:"id"`
+	TenantID    string     `json:"tenant_id"`
+	EventType   string     `json:"event_type"`
+	Sequence    uint64     `json:"sequence"`
+	Timestamp   time.Time  `json:"timestamp"`
+	Metadata    any        `json:"metadata"`
+	ClientIP    string     `json:"client_ip,omitempty"`
+	Source      string     `json:"source,omitempty"`
+	Credential  string     `json:"credential,omitempty"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+	RedactedAt  *time.Time `json:"redacted_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	CorrelationID string `json:"correlation_id,omitempty"`
+	CausationID   string `json:"causation_id,omitempty"`
+
+	System bool `json:"system,omitempty"`
+
+	MetadataRef *models.MetadataRef `json:"metadata_ref,omitempty"`
+}
+
+// binaryValue replaces the events in a response body with binaryEvents
+func binaryValue(v any) any {
+	switch v := v.(type) {
+	case gin.H:
+		out := make(gin.H, len(v))
+		for key, value := range v {
+			out[key] = binaryValue(value)
+		}
+		return out
+	case []models.EventResponse:
+		out := make([]binaryEvent, len(v))
+		for i, e := range v {
+			out[i] = toBinaryEvent(e)
+		}
+		return out
+	case models.EventResponse:
+		return toBinaryEvent(v)
+	}
+	return v
+}
+
+func toBinaryEvent(e models.EventResponse) binaryEvent {
+	return binaryEvent{
+		ID:          e.ID,
+		TenantID:    e.TenantID,
+		EventType:   e.EventType,
+		Sequence:    e.Sequence,
+		Timestamp:   e.Timestamp,
+		Metadata:    decodeMetadata(e.Metadata),
+		ClientIP:    e.ClientIP,
+		Source:      e.Source,
+		Credential:  e.Credential,
+		ProcessedAt: e.ProcessedAt,
+		RedactedAt:  e.RedactedAt,
+		CreatedAt:   e.CreatedAt,
+
+		CorrelationID: e.CorrelationID,
+		CausationID:   e.CausationID,
+
+		System: e.System,
+
+		MetadataRef: e.MetadataRef,
+	}
+}
+
+// decodeMetadata parses stored metadata, keeping integers as integers
+func decodeMetadata(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return string(raw)
+	}
+	return plainNumbers(doc)
+}
+
+func plainNumbers(node any) any {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = plainNumbers(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = plainNumbers(value)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return node
+}
@@ -0,0 +1,103 @@
+package handlers_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+
+	"event-ingestion-system/internal/handlers"
+	"event-ingestion-system/internal/testsupport"
+)
+
+// TestBinaryFormatsRoundTripEvents ingests an event in msgpack and in CBOR
+// and reads it back in the same format, with a native timestamp and nested
+// metadata
+func TestBinaryFormatsRoundTripEvents(t *testing.T) {
+	msgpack := &codec.MsgpackHandle{WriteExt: true}
+	cbor := &codec.CborHandle{TimeRFC3339: true}
+	for _, h := range []*codec.BasicHandle{&msgpack.BasicHandle, &cbor.BasicHandle} {
+		// Decode metadata as the JSON the server stores it from would
+		h.MapType = reflect.TypeOf(map[string]any(nil))
+		h.RawToString = true
+		h.SignedInteger = true
+	}
+
+	for _, tc := range []struct {
+		mime   string
+		handle codec.Handle
+	}{
+		{handlers.MIMEMsgPack, msgpack},
+		{handlers.MIMECBOR, cbor},
+	} {
+		t.Run(tc.mime, func(t *testing.T) {
+			s := testsupport.Start(t)
+			client := s.Client.With("Content-Type", tc.mime).With("Accept", tc.mime)
+			// CBOR timestamps are read to the microsecond
+			timestamp := time.Date(2026, 3, 14, 15, 9, 26, 535897000, time.UTC)
+			metadata := map[string]any{
+				"user":  map[string]any{"id": int64(7), "roles": []any{"admin", "viewer"}},
+				"score": 1.5,
+				"items": []any{map[string]any{"sku": "a-1", "qty": int64(2)}},
+			}
+
+			var body []byte
+			if err := codec.NewEncoderBytes(&body, tc.handle).Encode(map[string]any{
+				"tenant_id":  s.Tenant.ID,
+				"event_type": "format.test",
+				"timestamp":  timestamp,
+				"metadata":   metadata,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			var accepted struct {
+				ID uint64 `codec:"id"`
+			}
+			if status := decodeBinary(t, tc.handle, client, http.MethodPost, "/api/v1/events", body, &accepted); status != http.StatusCreated {
+				t.Fatalf("ingest: status %d, want %d", status, http.StatusCreated)
+			}
+
+			var event struct {
+				EventType string         `codec:"event_type"`
+				Timestamp time.Time      `codec:"timestamp"`
+				Metadata  map[string]any `codec:"metadata"`
+			}
+			if status := decodeBinary(t, tc.handle, client, http.MethodGet, fmt.Sprintf("/api/v1/events/%d", accepted.ID), nil, &event); status != http.StatusOK {
+				t.Fatalf("get event: status %d, want %d", status, http.StatusOK)
+			}
+			if event.EventType != "format.test" || !event.Timestamp.Equal(timestamp) {
+				t.Errorf("event = %s at %s, want format.test at %s", event.EventType, event.Timestamp, timestamp)
+			}
+			if !reflect.DeepEqual(event.Metadata, metadata) {
+				t.Errorf("metadata = %#v, want %#v", event.Metadata, metadata)
+			}
+		})
+	}
+}
+
+// decodeBinary sends body and decodes the response, which must be in the
+// requested format, into out. It returns the status code.
+func decodeBinary(t *testing.T, handle codec.Handle, client *testsupport.Client, method, path string, body []byte, out any) int {
+	t.Helper()
+	resp, err := client.Raw(method, path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := resp.Request.Header.Get("Accept")
+	if got := resp.Header.Get("Content-Type"); got != want {
+		t.Fatalf("%s %s: status %d, Content-Type %q, want %q: %s", method, path, resp.StatusCode, got, want, data)
+	}
+	if err := codec.NewDecoderBytes(data, handle).Decode(out); err != nil {
+		t.Fatalf("%s %s: decode: %v", method, path, err)
+	}
+	return resp.StatusCode
+}
@@ -1,16 +1,39 @@
 package handlers
 
 import (
-	"encoding/json"
+	"log/slog"
 	"net/http"
-	"regexp"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"event-ingestion-system/internal/anomaly"
+	"event-ingestion-system/internal/archive"
+	"event-ingestion-system/internal/audit"
 	"event-ingestion-system/internal/auth"
+	"event-ingestion-system/internal/cache"
+	"event-ingestion-system/internal/capture"
+	"event-ingestion-system/internal/config"
 	"event-ingestion-system/internal/database"
 	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/eventtype"
+	"event-ingestion-system/internal/export"
+	"event-ingestion-system/internal/flags"
+	"event-ingestion-system/internal/importer"
+	"event-ingestion-system/internal/ingest"
+	"event-ingestion-system/internal/latency"
+	"event-ingestion-system/internal/leader"
+	"event-ingestion-system/internal/maintenance"
 	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/oidc"
+	"event-ingestion-system/internal/realip"
+	"event-ingestion-system/internal/receipt"
+	"event-ingestion-system/internal/redaction"
+	"event-ingestion-system/internal/report"
+	"event-ingestion-system/internal/version"
+	"event-ingestion-system/internal/views"
+	"event-ingestion-system/internal/webhook"
 	"event-ingestion-system/internal/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -20,20 +43,87 @@ import (
 
 // Handler holds dependencies for HTTP handlers
 type Handler struct {
-	db   *database.Database
-	hub  *websocket.Hub
-	auth *auth.AuthMiddleware
+	db           *database.Database
+	events       database.EventStore
+	tenants      cache.Tenants
+	hub          *websocket.Hub
+	auth         *auth.AuthMiddleware
+	sso          *oidc.Provider // nil unless auth.oidc is configured
+	ingest       *ingest.Service
+	webhooks     *webhook.Dispatcher
+	reports      *report.Scheduler
+	anomalies    *anomaly.Tracker
+	latency      *latency.Tracker
+	flags        *flags.Flags
+	leader       *leader.Elector
+	auditLog     *audit.Logger
+	maint        *maintenance.Mode
+	recentErrors *capture.Recorder // captures failed requests when debug.capture_failed_requests is on
+	exports      *export.Runner
+	imports      *importer.Runner
+	redactions   *redaction.Runner
+	archive      archive.Store
+	receipts     *receipt.Signer // nil unless receipts.keys is configured
+	cfg          *config.Config
+	logger       *slog.Logger
+
+	// draining is set when shutdown begins and fails readiness checks
+	draining atomic.Bool
+	// components are optional integrations reported by readiness checks
+	components []component
+}
+
+// component is an optional integration whose health /ready reports
+type component struct {
+	name   string
+	health func() error
 }
 
 // NewHandler creates a new handler
-func NewHandler(db *database.Database, hub *websocket.Hub, authMiddleware *auth.AuthMiddleware) *Handler {
+func NewHandler(db *database.Database, events database.EventStore, tenants cache.Tenants, hub *websocket.Hub, authMiddleware *auth.AuthMiddleware, sso *oidc.Provider, ingestSvc *ingest.Service, dispatcher *webhook.Dispatcher, reports *report.Scheduler, anomalies *anomaly.Tracker, latencies *latency.Tracker, featureFlags *flags.Flags, elector *leader.Elector, auditLog *audit.Logger, maint *maintenance.Mode, recentErrors *capture.Recorder, exports *export.Runner, imports *importer.Runner, redactions *redaction.Runner, archiveStore archive.Store, receipts *receipt.Signer, cfg *config.Config, logger *slog.Logger) *Handler {
 	return &Handler{
-		db:   db,
-		hub:  hub,
-		auth: authMiddleware,
+		db:           db,
+		events:       events,
+		tenants:      tenants,
+		hub:          hub,
+		auth:         authMiddleware,
+		sso:          sso,
+		ingest:       ingestSvc,
+		webhooks:     dispatcher,
+		reports:      reports,
+		anomalies:    anomalies,
+		latency:      latencies,
+		flags:        featureFlags,
+		leader:       elector,
+		auditLog:     auditLog,
+		maint:        maint,
+		recentErrors: recentErrors,
+		exports:      exports,
+		imports:      imports,
+		redactions:   redactions,
+		archive:      archiveStore,
+		receipts:     receipts,
+		cfg:          cfg,
+		logger:       logger,
 	}
 }
 
+// SetDraining marks the server as shutting down so readiness checks fail
+// and load balancers stop routing new traffic here
+func (h *Handler) SetDraining() {
+	h.draining.Store(true)
+	// Answer parked long polls now rather than holding up the HTTP drain
+	h.hub.ReleaseWaiters()
+}
+
+// AddReadinessCheck reports an optional integration in /ready. Register
+// checks before serving. A failing check marks the server degraded but
+// keeps it ready, since the API itself still works, and so does one that
+// takes longer than health.check_timeout.
+func (h *Handler) AddReadinessCheck(name string, health func() error) {
+	h.components = append(h.components, component{name: name, health: health})
+}
+
 // GetDB returns the database instance
 func (h *Handler) GetDB() *database.Database {
 	return h.db
@@ -44,39 +134,93 @@ func (h *Handler) GetHub() *websocket.Hub {
 	return h.hub
 }
 
+// dbFor returns the database bound to the request context
+func (h *Handler) dbFor(c *gin.Context) *database.Database {
+	return h.db.WithContext(c.Request.Context())
+}
+
+// requireSQLEvents rejects a request for a feature that works on the events
+// table directly, such as exports, unless events are kept there
+func (h *Handler) requireSQLEvents(c *gin.Context, feature string) bool {
+	if store := h.cfg.Database.EventStore; store != database.EventStoreSQL {
+		c.Error(errors.ErrEventStoreUnsupported(feature, store))
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// eventsFor returns the event store bound to the request context
+func (h *Handler) eventsFor(c *gin.Context) database.EventStore {
+	return h.events.EventsWithContext(c.Request.Context())
+}
+
+// recordAudit queues an audit entry for a sensitive operation performed by
+// the caller of the current request
+func (h *Handler) recordAudit(c *gin.Context, action, targetType, targetID string, details map[string]interface{}) {
+	entry := audit.Entry{
+		ActorType:  audit.ActorAnonymous,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RequestID:  c.GetString("request_id"),
+		IP:         realip.Get(c),
+		Details:    details,
+		// Set when a tenant is impersonated, so entries show who acted
+		ImpersonatedBy: auth.GetImpersonatorFromContext(c),
+		UserID:         auth.GetUserIDFromContext(c),
+	}
+	if auth.IsAdmin(c) {
+		entry.ActorType = audit.ActorAdmin
+	} else if tenantID := auth.GetTenantIDFromContext(c); tenantID != "" {
+		entry.ActorType = audit.ActorTenant
+		entry.ActorID = tenantID
+	}
+	h.auditLog.Record(entry)
+}
+
 // HealthCheck returns the health status of the API
 func (h *Handler) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "healthy",
 		"timestamp": time.Now().Format(time.RFC3339),
-		"version":   "1.0.0",
+		"version":   version.Get().Version,
 	})
 }
 
+// GetVersion returns the build information of the running server
+func (h *Handler) GetVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, version.Get())
+}
+
 // CreateTenant creates a new tenant with validation
 func (h *Handler) CreateTenant(c *gin.Context) {
 	var req models.CreateTenantRequest
 
 	// Parse and validate JSON
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, errors.ErrInvalidRequest(err.Error()).Response())
+		c.Error(invalidRequest(err))
+		c.Abort()
 		return
 	}
 
 	// Validate tenant name
 	if err := validateTenantName(req.Name); err != nil {
-		c.JSON(http.StatusBadRequest, errors.ErrInvalidRequest(err.Error()).Response())
+		c.Error(invalidRequest(err))
+		c.Abort()
 		return
 	}
 
 	// Check if tenant with same name exists
-	existing, err := h.db.GetTenantByName(req.Name)
+	existing, err := h.dbFor(c).GetTenantByName(req.Name)
 	if err != nil && err != gorm.ErrRecordNotFound {
-		c.JSON(http.StatusInternalServerError, errors.ErrInternal("Failed to check existing tenant", err).Response())
+		c.Error(errors.ErrInternal("Failed to check existing tenant", err))
+		c.Abort()
 		return
 	}
 	if existing != nil {
-		c.JSON(http.StatusConflict, errors.ErrTenantExists(req.Name).Response())
+		c.Error(errors.ErrTenantExists(req.Name))
+		c.Abort()
 		return
 	}
 
@@ -87,11 +231,14 @@ func (h *Handler) CreateTenant(c *gin.Context) {
 		Active: true,
 	}
 
-	if err := h.db.CreateTenant(tenant); err != nil {
-		c.JSON(http.StatusInternalServerError, errors.ErrDB("create tenant", err).Response())
+	if err := h.dbFor(c).CreateTenant(tenant); err != nil {
+		c.Error(errors.ErrDB("create tenant", err))
+		c.Abort()
 		return
 	}
 
+	h.recordAudit(c, "tenant.create", "tenant", tenant.ID, map[string]interface{}{"name": tenant.Name})
+
 	// Generate JWT token
 	token, _ := h.auth.GenerateJWT(tenant)
 
@@ -107,9 +254,10 @@ func (h *Handler) CreateTenant(c *gin.Context) {
 
 // GetTenants returns all tenants (without API keys for security)
 func (h *Handler) GetTenants(c *gin.Context) {
-	tenants, err := h.db.GetAllTenants()
+	tenants, err := h.dbFor(c).GetAllTenants()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errors.ErrDB("get tenants", err).Response())
+		c.Error(errors.ErrDB("get tenants", err))
+		c.Abort()
 		return
 	}
 
@@ -136,9 +284,10 @@ func (h *Handler) GetTenants(c *gin.Context) {
 
 // GetTenantsWithKeys returns all tenants WITH API keys (for frontend use only)
 func (h *Handler) GetTenantsWithKeys(c *gin.Context) {
-	tenants, err := h.db.GetAllTenants()
+	tenants, err := h.dbFor(c).GetAllTenants()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errors.ErrDB("get tenants", err).Response())
+		c.Error(errors.ErrDB("get tenants", err))
+		c.Abort()
 		return
 	}
 
@@ -156,112 +305,165 @@ func (h *Handler) GetTenantsWithKeys(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"tenants": response})
 }
 
-// GetTenant returns a specific tenant
+// GetTenant returns a specific tenant. ?include= embeds the caller's own
+// webhooks, recent events and event stats, so a page needs one request.
 func (h *Handler) GetTenant(c *gin.Context) {
 	tenantID := c.Param("id")
 
 	// Validate UUID format
 	if _, err := uuid.Parse(tenantID); err != nil {
-		c.JSON(http.StatusBadRequest, errors.ErrBadTenantID("Invalid UUID format").Response())
+		c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+		c.Abort()
+		return
+	}
+	includes, ok := parseTenantIncludes(c)
+	if !ok {
+		return
+	}
+	// The tenant's webhooks and events are only its own to see
+	if includes.requested() && tenantID != auth.GetTenantIDFromContext(c) {
+		c.Error(errors.ErrForbidden("Tenants can only include their own webhooks, events and stats"))
+		c.Abort()
 		return
 	}
 
-	tenant, err := h.db.GetTenantByID(tenantID)
+	tenant, err := h.dbFor(c).GetTenantByID(tenantID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, errors.ErrTenantNotFound(tenantID).Response())
+			c.Error(errors.ErrTenantNotFound(tenantID))
+			c.Abort()
 			return
 		}
-		c.JSON(http.StatusInternalServerError, errors.ErrDB("get tenant", err).Response())
+		c.Error(errors.ErrDB("get tenant", err))
+		c.Abort()
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":         tenant.ID,
-		"name":       tenant.Name,
-		"active":     tenant.Active,
-		"api_key":    tenant.APIKey,
-		"created_at": tenant.CreatedAt.Format(time.RFC3339),
-	})
-}
-
-// IngestEvent ingests a new event with comprehensive validation
-func (h *Handler) IngestEvent(c *gin.Context) {
-	var req models.EventRequest
-
-	// Parse and validate JSON
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, errors.ErrInvalidRequest(err.Error()).Response())
+	resp := gin.H{
+		"id":                        tenant.ID,
+		"name":                      tenant.Name,
+		"active":                    tenant.Active,
+		"api_key":                   tenant.APIKey,
+		"version":                   tenant.Version,
+		"created_at":                tenant.CreatedAt.Format(time.RFC3339),
+		"notifications_muted":       tenant.Muted(time.Now()),
+		"notifications_muted_until": tenant.NotificationsMutedUntil,
+	}
+	if includes.requested() && !h.embedTenantIncludes(c, tenantID, includes, resp) {
 		return
 	}
+	setVersionTag(c, tenant.Version)
+	c.JSON(http.StatusOK, resp)
+}
+
+// EventSourceHeader names the integration sending an event, for producers
+// that cannot add a source field to the body
+const EventSourceHeader = "X-Event-Source"
 
-	// Validate tenant ID
-	if _, err := uuid.Parse(req.TenantID); err != nil {
-		c.JSON(http.StatusBadRequest, errors.ErrBadTenantID("Invalid tenant ID format").Response())
+// IngestEvent ingests a new event with comprehensive validation. ?ack
+// chooses whether to answer once the event is valid (none), queued
+// (received) or committed (durable, the default unless the tenant has the
+// async_ingest flag). ?receipt=true adds a signed receipt for the stored
+// event.
+func (h *Handler) IngestEvent(c *gin.Context) {
+	ack, ok := ingest.ParseAck(c.Query("ack"))
+	if !ok {
+		c.Error(errors.ErrInvalidRequest("Invalid ack parameter: must be none, received or durable"))
+		c.Abort()
 		return
 	}
-
-	// Check tenant exists and is active
-	tenant, err := h.db.GetTenantByID(req.TenantID)
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, errors.ErrTenantNotFound(req.TenantID).Response())
+	var wantReceipt bool
+	if r := c.Query("receipt"); r != "" {
+		parsed, err := strconv.ParseBool(r)
+		if err != nil {
+			c.Error(errors.ErrInvalidRequest("Invalid receipt parameter"))
+			c.Abort()
 			return
 		}
-		c.JSON(http.StatusInternalServerError, errors.ErrDB("verify tenant", err).Response())
+		wantReceipt = parsed
+	}
+	if wantReceipt && h.receipts == nil {
+		c.Error(errors.ErrInvalidRequest("Receipts are not configured on this server"))
+		c.Abort()
 		return
 	}
-	if !tenant.Active {
-		c.JSON(http.StatusForbidden, errors.ErrUnauthorized("Tenant is inactive").Response())
+	if c.Query("ack") == "" && !wantReceipt {
+		ack = ingest.DefaultAck(c.Request.Context())
+	}
+	if wantReceipt && ack != ingest.AckDurable {
+		// Only a stored event has an ID to attest
+		c.Error(errors.ErrInvalidRequest("Receipts require ack=durable"))
+		c.Abort()
 		return
 	}
 
-	// Validate event type
-	if err := validateEventType(req.EventType); err != nil {
-		c.JSON(http.StatusBadRequest, errors.ErrBadEventType(err.Error()).Response())
+	var req models.EventRequest
+
+	// Parse and validate the body, JSON, msgpack or CBOR
+	if err := bindEventRequest(c, &req); err != nil {
+		c.Error(invalidRequest(err))
+		c.Abort()
 		return
 	}
 
-	// Parse timestamp - support multiple formats
-	timestamp, err := parseTimestamp(req.Timestamp)
+	if req.Source == "" {
+		req.Source = c.GetHeader(EventSourceHeader)
+	}
+	req.Credential = auth.Credential(c)
+	req.ClientIP = realip.Get(c)
+	event, err := h.ingest.IngestWithAck(c.Request.Context(), req, ack)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errors.ErrBadTimestamp("Timestamp must be in ISO8601 format (e.g., 2026-02-10T19:07:41Z or 2026-02-10T19:07:41.701Z)").Response())
+		c.Error(err)
+		c.Abort()
 		return
 	}
 
-	// Validate metadata is valid JSON
-	if req.Metadata != nil {
-		if _, err := json.Marshal(req.Metadata); err != nil {
-			c.JSON(http.StatusBadRequest, errors.ErrBadMetadata("Metadata must be a valid JSON object").Response())
-			return
-		}
-	}
-
-	metadata, _ := json.Marshal(req.Metadata)
-	event := &models.Event{
-		TenantID:  req.TenantID,
-		EventType: req.EventType,
-		Timestamp: timestamp,
-		Metadata:  string(metadata),
+	if event.Sampled {
+		// Valid, but a sampling rule keeps it from being stored
+		render(c, http.StatusAccepted, gin.H{
+			"tenant_id":  event.TenantID,
+			"event_type": event.EventType,
+			"timestamp":  event.Timestamp.Format(time.RFC3339),
+			"ack":        ack,
+			"sampled":    true,
+		})
+		return
 	}
-
-	if err := h.db.CreateEvent(event); err != nil {
-		c.JSON(http.StatusInternalServerError, errors.ErrDB("create event", err).Response())
+	if ack != ingest.AckDurable {
+		// Not written yet, so there is no ID to report
+		render(c, http.StatusAccepted, gin.H{
+			"tenant_id":  event.TenantID,
+			"event_type": event.EventType,
+			"timestamp":  event.Timestamp.Format(time.RFC3339),
+			"ack":        ack,
+		})
 		return
 	}
-
-	// Broadcast to WebSocket clients (non-blocking)
-	go h.hub.BroadcastToTenant(req.TenantID, event)
-
-	c.JSON(http.StatusCreated, gin.H{
+	resp := gin.H{
 		"id":         event.ID,
 		"tenant_id":  event.TenantID,
 		"event_type": event.EventType,
 		"timestamp":  event.Timestamp.Format(time.RFC3339),
-	})
+		"ack":        ack,
+	}
+	if wantReceipt {
+		// The event is stored either way; a receipt failure is not
+		// reported as a failed ingest the client would retry
+		if token, err := h.receipts.Sign(event); err != nil {
+			h.logger.Error("Failed to sign receipt", "event_id", event.ID, "error", err)
+		} else {
+			resp["receipt"] = token
+		}
+	}
+	render(c, http.StatusCreated, resp)
 }
 
-// GetEvents returns events for a tenant with filtering and pagination
+// GetEvents returns events for a tenant with filtering and pagination. The
+// filter may come from a saved view, named by ?view=. ?tz= sets the zone
+// that from and to without an offset, and the days of today and
+// yesterday, are in; ?tz_render=true also gives times in it.
+// ?metadata=summary or none leaves large metadata out in favor of a
+// reference to GetEventMetadata, for clients that only scan the list.
 func (h *Handler) GetEvents(c *gin.Context) {
 	tenantID := c.GetString("tenant_id")
 
@@ -272,7 +474,8 @@ func (h *Handler) GetEvents(c *gin.Context) {
 	if l := c.Query("limit"); l != "" {
 		parsed, err := strconv.Atoi(l)
 		if err != nil || parsed < 0 {
-			c.JSON(http.StatusBadRequest, errors.ErrInvalidRequest("Invalid limit parameter").Response())
+			c.Error(errors.ErrInvalidRequest("Invalid limit parameter"))
+			c.Abort()
 			return
 		}
 		if parsed > 100 {
@@ -284,84 +487,606 @@ func (h *Handler) GetEvents(c *gin.Context) {
 	if o := c.Query("offset"); o != "" {
 		parsed, err := strconv.Atoi(o)
 		if err != nil || parsed < 0 {
-			c.JSON(http.StatusBadRequest, errors.ErrInvalidRequest("Invalid offset parameter").Response())
+			c.Error(errors.ErrInvalidRequest("Invalid offset parameter"))
+			c.Abort()
 			return
 		}
 		offset = parsed
 	}
 
-	eventType := c.Query("event_type")
-	search := c.Query("search")
+	loc, ok := requestZone(c)
+	if !ok {
+		return
+	}
+	zone, ok := renderZone(c, loc)
+	if !ok {
+		return
+	}
+	mode, ok := metadataMode(c)
+	if !ok {
+		return
+	}
+
+	filter := database.EventFilter{TenantID: tenantID, Limit: limit, Offset: offset}
+	if p := c.Query("processed"); p != "" {
+		processed, err := strconv.ParseBool(p)
+		if err != nil {
+			c.Error(errors.ErrInvalidRequest("Invalid processed parameter"))
+			c.Abort()
+			return
+		}
+		filter.Processed = &processed
+	}
+	if p := c.Query("exclude_system"); p != "" {
+		exclude, err := strconv.ParseBool(p)
+		if err != nil {
+			c.Error(errors.ErrInvalidRequest("Invalid exclude_system parameter"))
+			c.Abort()
+			return
+		}
+		filter.ExcludeSystem = exclude
+	}
 
-	var events []models.Event
-	var fetchErr error
+	// A saved view supplies the filter; explicit parameters, even empty
+	// ones, override its fields
+	db := h.dbFor(c)
+	var query models.ViewFilter
+	var viewName string
+	if ref := c.Query("view"); ref != "" {
+		view, ok := findView(c, db, tenantID, ref)
+		if !ok {
+			return
+		}
+		parsed, err := view.ParseFilter()
+		if err != nil {
+			c.Error(errors.ErrInternal("Failed to decode view filter", err))
+			c.Abort()
+			return
+		}
+		query, viewName = parsed, view.Name
+	}
 
-	if eventType != "" {
-		// Validate event type
-		if err := validateEventType(eventType); err != nil {
-			c.JSON(http.StatusBadRequest, errors.ErrBadEventType(err.Error()).Response())
+	if _, ok := c.GetQuery("event_type"); ok {
+		if query.EventTypes, ok = eventTypePatterns(c); !ok {
 			return
 		}
-		events, fetchErr = h.db.GetEventsByTenantAndType(tenantID, eventType, limit, offset)
-	} else if search != "" {
-		events, fetchErr = h.db.SearchEventsByMetadata(tenantID, search, limit, offset)
-	} else {
-		events, fetchErr = h.db.GetEventsByTenant(tenantID, limit, offset)
+	}
+	if source := c.Query("source"); source != "" {
+		filter.Sources = strings.Split(source, ",")
+		for _, s := range filter.Sources {
+			if err := ingest.ValidateSource(s); err != nil {
+				c.Error(errors.ErrInvalidRequest(err.Error()))
+				c.Abort()
+				return
+			}
+		}
+	}
+	if correlationID := c.Query("correlation_id"); correlationID != "" {
+		if err := ingest.ValidateCorrelationID("correlation_id", correlationID); err != nil {
+			c.Error(errors.ErrInvalidRequest(err.Error()))
+			c.Abort()
+			return
+		}
+		filter.CorrelationID = correlationID
+	}
+	if tags, ok := c.GetQueryArray("tag"); ok {
+		query.Tags = nil
+		for _, tag := range tags {
+			if tag != "" {
+				query.Tags = append(query.Tags, tag)
+			}
+		}
+	}
+	if r, ok := c.GetQuery("range"); ok {
+		query.Range = r
+	}
+	if sort, ok := c.GetQuery("sort"); ok {
+		query.Sort = sort
+	}
+	// An explicit event type takes precedence over an explicit metadata search
+	if search, ok := c.GetQuery("search"); ok && c.Query("event_type") == "" {
+		query.Search = search
 	}
 
+	if err := views.Validate(query); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	filter.EventTypes = query.EventTypes
+	filter.Tags = query.Tags
+	filter.Search = query.Search
+	// A workflow reads in the order it happened unless asked otherwise
+	filter.Oldest = query.Sort == views.SortOldest || (filter.CorrelationID != "" && query.Sort == "")
+	if query.Range != "" {
+		// Relative ranges are evaluated now, not when the view was saved
+		since, until, _ := views.RangeIn(query.Range, time.Now(), loc)
+		filter.Since, filter.Until = &since, until
+	}
+	// Absolute bounds replace the range, the view's included
+	from, err := parseTimeParamIn(c, "from", loc)
+	if err != nil {
+		c.Error(errors.ErrBadTimestamp("from must be in ISO8601 format, with or without an offset"))
+		c.Abort()
+		return
+	}
+	to, err := parseTimeParamIn(c, "to", loc)
+	if err != nil {
+		c.Error(errors.ErrBadTimestamp("to must be in ISO8601 format, with or without an offset"))
+		c.Abort()
+		return
+	}
+	if from != nil && to != nil && !to.After(*from) {
+		c.Error(errors.ErrInvalidRequest("to must be after from"))
+		c.Abort()
+		return
+	}
+	if from != nil || to != nil {
+		filter.Since, filter.Until = from, to
+	}
+
+	events, fetchErr := h.eventsFor(c).GetEvents(filter)
 	if fetchErr != nil {
-		c.JSON(http.StatusInternalServerError, errors.ErrDB("get events", fetchErr).Response())
+		c.Error(errors.ErrDB("get events", fetchErr))
+		c.Abort()
 		return
 	}
 
 	response := make([]models.EventResponse, 0, len(events))
 	for _, e := range events {
-		response = append(response, e.ToEventResponse())
+		response = append(response, eventResponse(&e, zone).WithMetadata(mode))
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	body := gin.H{
 		"events": response,
 		"limit":  limit,
 		"offset": offset,
+	}
+	if viewName != "" {
+		body["view"] = viewName
+	}
+	render(c, http.StatusOK, body)
+}
+
+// eventTypePatterns returns the comma-separated eventtype patterns of the
+// event_type parameter, answering 400 and false when one is invalid
+func eventTypePatterns(c *gin.Context) ([]string, bool) {
+	var patterns []string
+	if t := c.Query("event_type"); t != "" {
+		patterns = strings.Split(t, ",")
+	}
+	for _, p := range patterns {
+		if err := eventtype.Validate(p); err != nil {
+			c.Error(errors.ErrBadEventType(err.Error()))
+			c.Abort()
+			return nil, false
+		}
+	}
+	return patterns, true
+}
+
+// GetEvent returns one of the caller's events
+func (h *Handler) GetEvent(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid event ID"))
+		c.Abort()
+		return
+	}
+	zone, ok := responseZone(c)
+	if !ok {
+		return
+	}
+	mode, ok := metadataMode(c)
+	if !ok {
+		return
+	}
+
+	event, err := h.eventsFor(c).GetEvent(c.GetString("tenant_id"), uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrEventNotFound(int(id)))
+		} else {
+			c.Error(errors.ErrDB("get event", err))
+		}
+		c.Abort()
+		return
+	}
+	render(c, http.StatusOK, eventResponse(event, zone).WithMetadata(mode))
+}
+
+// maxRelatedEvents bounds the events GetRelatedEvents returns
+const maxRelatedEvents = 1000
+
+// GetRelatedEvents returns the events sharing an event's correlation ID,
+// the event included, oldest first; an event without one is alone in its
+// chain. Each event's causation_id tells how the chain branches.
+func (h *Handler) GetRelatedEvents(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid event ID"))
+		c.Abort()
+		return
+	}
+	zone, ok := responseZone(c)
+	if !ok {
+		return
+	}
+	mode, ok := metadataMode(c)
+	if !ok {
+		return
+	}
+
+	tenantID := c.GetString("tenant_id")
+	store := h.eventsFor(c)
+	event, err := store.GetEvent(tenantID, uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrEventNotFound(int(id)))
+		} else {
+			c.Error(errors.ErrDB("get event", err))
+		}
+		c.Abort()
+		return
+	}
+
+	events := []models.Event{*event}
+	if event.CorrelationID != "" {
+		events, err = store.GetEvents(database.EventFilter{
+			TenantID:      tenantID,
+			CorrelationID: event.CorrelationID,
+			Oldest:        true,
+			Limit:         maxRelatedEvents + 1,
+		})
+		if err != nil {
+			c.Error(errors.ErrDB("get related events", err))
+			c.Abort()
+			return
+		}
+	}
+	truncated := len(events) > maxRelatedEvents
+	if truncated {
+		events = events[:maxRelatedEvents]
+	}
+
+	response := make([]models.EventResponse, 0, len(events))
+	for _, e := range events {
+		response = append(response, eventResponse(&e, zone).WithMetadata(mode))
+	}
+	render(c, http.StatusOK, gin.H{
+		"correlation_id": event.CorrelationID,
+		"events":         response,
+		"truncated":      truncated,
 	})
 }
 
-// GetEventStats returns event statistics for a tenant
+// PollEvents long-polls for the caller's events after after_id, or after
+// after_sequence. It answers at once when there are some; otherwise it
+// parks until the hub broadcasts an event for the tenant or the wait runs
+// out, then returns whatever has arrived. Only broadcasts in this process
+// wake it; events ingested by another replica are picked up when the wait
+// ends.
+func (h *Handler) PollEvents(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	mode, ok := metadataMode(c)
+	if !ok {
+		return
+	}
+
+	var afterID uint64
+	if a := c.Query("after_id"); a != "" {
+		parsed, err := strconv.ParseUint(a, 10, 32)
+		if err != nil {
+			c.Error(errors.ErrInvalidRequest("Invalid after_id parameter"))
+			c.Abort()
+			return
+		}
+		afterID = parsed
+	}
+
+	// after_sequence resumes from the tenant's gap-free sequence instead
+	var afterSequence uint64
+	bySequence := c.Query("after_sequence") != ""
+	if bySequence {
+		if c.Query("after_id") != "" {
+			c.Error(errors.ErrInvalidRequest("after_id and after_sequence cannot be combined"))
+			c.Abort()
+			return
+		}
+		parsed, err := strconv.ParseUint(c.Query("after_sequence"), 10, 64)
+		if err != nil {
+			c.Error(errors.ErrInvalidRequest("Invalid after_sequence parameter"))
+			c.Abort()
+			return
+		}
+		afterSequence = parsed
+	}
+
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 {
+			c.Error(errors.ErrInvalidRequest("Invalid limit parameter"))
+			c.Abort()
+			return
+		}
+		if parsed > 1000 {
+			parsed = 1000 // Cap at 1000
+		}
+		limit = parsed
+	}
+
+	wait := h.cfg.App.LongPollMaxWait
+	if w := c.Query("wait"); w != "" {
+		parsed, err := time.ParseDuration(w)
+		if err != nil {
+			// Plain numbers are seconds
+			seconds, serr := strconv.Atoi(w)
+			parsed, err = time.Duration(seconds)*time.Second, serr
+		}
+		if err != nil || parsed < 0 {
+			c.Error(errors.ErrInvalidRequest("Invalid wait parameter"))
+			c.Abort()
+			return
+		}
+		wait = min(parsed, wait)
+	}
+
+	// Leave time to answer before the request timeout fires
+	ctx := c.Request.Context()
+	if deadline, ok := ctx.Deadline(); ok {
+		wait = min(wait, time.Until(deadline)-time.Second)
+	}
+
+	// Register before querying so an event stored in between still wakes us
+	wake, cancel := h.hub.WaitForEvent(tenantID)
+	defer cancel()
+
+	store := h.eventsFor(c)
+	fetch := func() ([]models.Event, error) {
+		if bySequence {
+			return store.GetEventsAfterSequence(tenantID, afterSequence, limit)
+		}
+		return store.GetEventsAfter(tenantID, uint(afterID), limit)
+	}
+	events, err := fetch()
+	if err != nil {
+		c.Error(errors.ErrDB("get events", err))
+		c.Abort()
+		return
+	}
+
+	if len(events) == 0 && wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-wake:
+		case <-timer.C:
+		case <-ctx.Done():
+			// The client went away or the request timed out
+			return
+		}
+
+		events, err = fetch()
+		if err != nil {
+			c.Error(errors.ErrDB("get events", err))
+			c.Abort()
+			return
+		}
+	}
+
+	response := make([]models.EventResponse, 0, len(events))
+	lastID, lastSequence := afterID, afterSequence
+	for _, e := range events {
+		response = append(response, e.ToEventResponse().WithMetadata(mode))
+		lastID, lastSequence = uint64(e.ID), e.Sequence
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":        response,
+		"last_event_id": lastID,
+		"last_sequence": lastSequence,
+	})
+}
+
+// GetEventStats returns event statistics for a tenant. Event types that
+// sampling rules have thinned out also get the counts they stand for, and
+// while latency tracking is on, the recent end-to-end latencies this
+// replica measured are included by stage. ?event_type= patterns limit the
+// counts by type, sizes and sampling to the types they match, and total
+// and unprocessed_count to their events.
 func (h *Handler) GetEventStats(c *gin.Context) {
 	tenantID := c.GetString("tenant_id")
+	types, ok := eventTypePatterns(c)
+	if !ok {
+		return
+	}
+	matcher := eventtype.Compile(types)
+
+	stats, err := h.eventsFor(c).GetEventStats(tenantID)
+	if err != nil {
+		c.Error(errors.ErrDB("get event stats", err))
+		c.Abort()
+		return
+	}
+
+	var unprocessed int64
+	if matcher == nil {
+		unprocessed, err = h.eventsFor(c).CountUnprocessedEvents(tenantID)
+	} else {
+		processed := false
+		unprocessed, err = h.eventsFor(c).CountEvents(database.EventFilter{TenantID: tenantID, EventTypes: types, Processed: &processed})
+	}
+	if err != nil {
+		c.Error(errors.ErrDB("get event stats", err))
+		c.Abort()
+		return
+	}
+
+	sampled, err := h.dbFor(c).GetSampledEventCounts(tenantID)
+	if err != nil {
+		c.Error(errors.ErrDB("get event stats", err))
+		c.Abort()
+		return
+	}
+
+	sources, err := h.eventsFor(c).CountEventsBySource(tenantID)
+	if err != nil {
+		c.Error(errors.ErrDB("get event stats", err))
+		c.Abort()
+		return
+	}
+
+	sizes, err := h.eventsFor(c).GetEventSizeStats(tenantID)
+	if err != nil {
+		c.Error(errors.ErrDB("get event stats", err))
+		c.Abort()
+		return
+	}
+	if matcher != nil {
+		var total int64
+		for eventType, n := range stats {
+			if eventType == "total" {
+				continue
+			}
+			if matcher.Match(eventType) {
+				total += n
+			} else {
+				delete(stats, eventType)
+			}
+		}
+		stats["total"] = total
+		for eventType := range sizes {
+			if !matcher.Match(eventType) {
+				delete(sizes, eventType)
+			}
+		}
+		for eventType := range sampled {
+			if !matcher.Match(eventType) {
+				delete(sampled, eventType)
+			}
+		}
+	}
+	var metadataBytes int64
+	for _, size := range sizes {
+		metadataBytes += size.Total
+	}
+
+	resp := gin.H{"stats": stats, "by_source": sources, "unprocessed_count": unprocessed, "sizes": sizes, "metadata_bytes": metadataBytes}
+	if len(sampled) > 0 {
+		sampling := make(map[string]models.SampledTypeStats, len(sampled))
+		for eventType, out := range sampled {
+			st := models.SampledTypeStats{Stored: stats[eventType], SampledOut: out, Represented: stats[eventType] + out}
+			if st.Stored > 0 {
+				st.Factor = float64(st.Represented) / float64(st.Stored)
+			}
+			sampling[eventType] = st
+		}
+		resp["sampling"] = sampling
+	}
+	if latencies := h.latency.TenantStats(tenantID); len(latencies) > 0 {
+		resp["latency"] = latencies
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetThroughput returns the caller's ingest rates over the last 1, 10 and
+// 60 seconds, as subscribed WebSocket clients receive them. They cover the
+// events this replica ingested.
+func (h *Handler) GetThroughput(c *gin.Context) {
+	c.JSON(http.StatusOK, h.hub.Throughput(c.GetString("tenant_id")))
+}
+
+// AckEvents marks the caller's events as processed so consumers can resume
+// after a crash. Listed IDs are reported one by one; an ID that is already
+// acknowledged, unknown or another tenant's does not fail the call.
+func (h *Handler) AckEvents(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+
+	var req models.AckEventsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	if (len(req.IDs) == 0) == (req.UpToID == 0) {
+		c.Error(errors.ErrInvalidRequest("Provide either ids or up_to_id"))
+		c.Abort()
+		return
+	}
 
-	stats, err := h.db.GetEventStats(tenantID)
+	now := time.Now().UTC()
+	if req.UpToID != 0 {
+		acked, err := h.eventsFor(c).MarkEventsProcessedUpTo(tenantID, req.UpToID, now)
+		if err != nil {
+			c.Error(errors.ErrDB("acknowledge events", err))
+			c.Abort()
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"acked": acked, "up_to_id": req.UpToID})
+		return
+	}
+
+	marked, already, err := h.eventsFor(c).MarkEventsProcessed(tenantID, req.IDs, now)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errors.ErrDB("get event stats", err).Response())
+		c.Error(errors.ErrDB("acknowledge events", err))
+		c.Abort()
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"stats": stats})
+	status := make(map[uint]string, len(req.IDs))
+	for _, id := range marked {
+		status[id] = "acked"
+	}
+	for _, id := range already {
+		status[id] = "already_acked"
+	}
+	results := make([]models.AckResult, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		s, ok := status[id]
+		if !ok {
+			s = "not_found"
+		}
+		results = append(results, models.AckResult{ID: id, Status: s})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"acked": len(marked), "results": results})
 }
 
-// GetAuthToken generates a JWT token for a tenant
+// GetAuthToken generates a JWT token for a tenant. Impersonation tokens
+// cannot be exchanged for one.
 func (h *Handler) GetAuthToken(c *gin.Context) {
 	tenantID := c.Param("id")
 
+	if auth.IsImpersonated(c) {
+		c.Error(errors.ErrForbidden("Impersonation tokens cannot be refreshed"))
+		c.Abort()
+		return
+	}
+
 	// Validate UUID format
 	if _, err := uuid.Parse(tenantID); err != nil {
-		c.JSON(http.StatusBadRequest, errors.ErrBadTenantID("Invalid UUID format").Response())
+		c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+		c.Abort()
 		return
 	}
 
-	tenant, err := h.db.GetTenantByID(tenantID)
+	tenant, err := h.dbFor(c).GetTenantByID(tenantID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, errors.ErrTenantNotFound(tenantID).Response())
+			c.Error(errors.ErrTenantNotFound(tenantID))
+			c.Abort()
 			return
 		}
-		c.JSON(http.StatusInternalServerError, errors.ErrDB("get tenant", err).Response())
+		c.Error(errors.ErrDB("get tenant", err))
+		c.Abort()
 		return
 	}
 
 	token, err := h.auth.GenerateJWT(tenant)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errors.ErrInternal("Failed to generate token", err).Response())
+		c.Error(errors.ErrInternal("Failed to generate token", err))
+		c.Abort()
 		return
 	}
 
@@ -372,58 +1097,68 @@ func (h *Handler) GetAuthToken(c *gin.Context) {
 	})
 }
 
-// Helper functions for validation
+// RotateAPIKey replaces the caller's API key. The old key stops working
+// immediately on this replica and within auth.tenant_cache_ttl on others;
+// JWTs issued before the rotation remain valid until they expire.
+func (h *Handler) RotateAPIKey(c *gin.Context) {
+	tenantID := c.Param("id")
 
-// validateTenantName validates the tenant name
-func validateTenantName(name string) error {
-	if len(name) < 3 {
-		return &ValidationError{Field: "name", Message: "must be at least 3 characters"}
-	}
-	if len(name) > 50 {
-		return &ValidationError{Field: "name", Message: "must be at most 50 characters"}
+	// Validate UUID format
+	if _, err := uuid.Parse(tenantID); err != nil {
+		c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+		c.Abort()
+		return
 	}
-	return nil
-}
 
-// validateEventType validates the event type
-func validateEventType(eventType string) error {
-	if len(eventType) < 1 {
-		return &ValidationError{Field: "event_type", Message: "cannot be empty"}
+	if tenantID != auth.GetTenantIDFromContext(c) {
+		c.Error(errors.ErrForbidden("Tenants can only rotate their own API key"))
+		c.Abort()
+		return
 	}
-	if len(eventType) > 100 {
-		return &ValidationError{Field: "event_type", Message: "must be at most 100 characters"}
+	if auth.IsImpersonated(c) {
+		c.Error(errors.ErrForbidden("Impersonation tokens cannot rotate the API key"))
+		c.Abort()
+		return
 	}
-	// Allow alphanumeric characters, underscores, hyphens, and dots
-	matched, _ := regexp.MatchString(`^[a-zA-Z0-9_.-]+$`, eventType)
-	if !matched {
-		return &ValidationError{Field: "event_type", Message: "can only contain alphanumeric characters, underscores, hyphens, and dots"}
+
+	apiKey := uuid.New().String()
+	if err := h.dbFor(c).RotateTenantAPIKey(tenantID, apiKey); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrTenantNotFound(tenantID))
+			c.Abort()
+			return
+		}
+		c.Error(errors.ErrDB("rotate API key", err))
+		c.Abort()
+		return
 	}
-	return nil
+	h.tenants.Invalidate(tenantID)
+
+	h.recordAudit(c, "tenant.rotate_key", "tenant", tenantID, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":      tenantID,
+		"api_key": apiKey,
+	})
 }
 
-// parseTimestamp parses timestamp in various ISO8601 formats
-func parseTimestamp(ts string) (time.Time, error) {
-	// Try multiple formats
-	formats := []string{
-		time.RFC3339,
-		time.RFC3339Nano,
-		"2006-01-02T15:04:05Z",
-		"2006-01-02T15:04:05.000Z",
-		"2006-01-02T15:04:05.000000Z",
-	}
+// Helper functions for validation
 
-	for _, format := range formats {
-		if t, err := time.Parse(format, ts); err == nil {
-			return t, nil
-		}
+// validateTenantName validates the tenant name
+func validateTenantName(name string) error {
+	if len(name) < 3 {
+		return &ValidationError{Field: "name", Rule: "min", Message: "must be at least 3 characters"}
 	}
-
-	return time.Time{}, &ValidationError{Field: "timestamp", Message: "invalid format"}
+	if len(name) > 50 {
+		return &ValidationError{Field: "name", Rule: "max", Message: "must be at most 50 characters"}
+	}
+	return nil
 }
 
 // ValidationError represents a validation error
 type ValidationError struct {
 	Field   string
+	Rule    string
 	Message string
 }
 
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImpersonateTenant mints a short-lived token that authenticates as a tenant
+// on behalf of an operator. The token is read-only unless the write scope is
+// asked for, and is recorded so it can be listed and revoked.
+func (h *Handler) ImpersonateTenant(c *gin.Context) {
+	tenantID := c.Param("id")
+
+	// Validate UUID format
+	if _, err := uuid.Parse(tenantID); err != nil {
+		c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+		c.Abort()
+		return
+	}
+
+	var req models.ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+
+	scope := req.Scope
+	switch scope {
+	case "":
+		scope = models.ScopeRead
+	case models.ScopeRead, models.ScopeWrite:
+	default:
+		c.Error(errors.ErrInvalidRequest("scope must be read or write"))
+		c.Abort()
+		return
+	}
+
+	maxTTL := h.cfg.Auth.ImpersonationTTL
+	ttl := maxTTL
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil || parsed <= 0 || parsed > maxTTL {
+			c.Error(errors.ErrInvalidRequest("ttl must be a positive duration of at most " + maxTTL.String()))
+			c.Abort()
+			return
+		}
+		ttl = parsed
+	}
+
+	tenant, err := h.dbFor(c).GetTenantByID(tenantID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrTenantNotFound(tenantID))
+		} else {
+			c.Error(errors.ErrDB("get tenant", err))
+		}
+		c.Abort()
+		return
+	}
+	if !tenant.Active {
+		c.Error(errors.ErrTenantNotFound(tenantID))
+		c.Abort()
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	imp := &models.Impersonation{
+		ID:             uuid.New().String(),
+		TenantID:       tenant.ID,
+		ImpersonatedBy: req.ImpersonatedBy,
+		Reason:         req.Reason,
+		Scope:          scope,
+		ExpiresAt:      now.Add(ttl),
+		CreatedAt:      now,
+	}
+
+	token, err := h.auth.GenerateImpersonationJWT(imp)
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to generate token", err))
+		c.Abort()
+		return
+	}
+	if err := h.dbFor(c).CreateImpersonation(imp); err != nil {
+		c.Error(errors.ErrDB("create impersonation", err))
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "tenant.impersonate", "tenant", tenant.ID, map[string]interface{}{
+		"impersonation_id": imp.ID,
+		"impersonated_by":  imp.ImpersonatedBy,
+		"reason":           imp.Reason,
+		"scope":            imp.Scope,
+		"expires_at":       imp.ExpiresAt,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":         token,
+		"token_type":    "Bearer",
+		"expires_in":    int(ttl.Seconds()),
+		"expires_at":    imp.ExpiresAt,
+		"impersonation": imp,
+	})
+}
+
+// ListImpersonations returns impersonation tokens, newest first, optionally
+// of one tenant and only those still usable
+func (h *Handler) ListImpersonations(c *gin.Context) {
+	tenantID := c.Query("tenant_id")
+	if tenantID != "" {
+		if _, err := uuid.Parse(tenantID); err != nil {
+			c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+			c.Abort()
+			return
+		}
+	}
+
+	activeOnly := false
+	if a := c.Query("active"); a != "" {
+		parsed, err := strconv.ParseBool(a)
+		if err != nil {
+			c.Error(errors.ErrInvalidRequest("Invalid active parameter"))
+			c.Abort()
+			return
+		}
+		activeOnly = parsed
+	}
+
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 0 {
+			c.Error(errors.ErrInvalidRequest("Invalid limit parameter"))
+			c.Abort()
+			return
+		}
+		if parsed > 500 {
+			parsed = 500 // Cap at 500
+		}
+		limit = parsed
+	}
+
+	imps, err := h.dbFor(c).ListImpersonations(tenantID, activeOnly, limit)
+	if err != nil {
+		c.Error(errors.ErrDB("list impersonations", err))
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impersonations": imps, "limit": limit})
+}
+
+// RevokeImpersonation revokes an impersonation token; requests made with it
+// are rejected from then on
+func (h *Handler) RevokeImpersonation(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid impersonation ID"))
+		c.Abort()
+		return
+	}
+
+	imp, err := h.dbFor(c).RevokeImpersonation(id, time.Now().UTC())
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrImpersonationNotFound(id))
+		} else {
+			c.Error(errors.ErrDB("revoke impersonation", err))
+		}
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "impersonation.revoke", "tenant", imp.TenantID, map[string]interface{}{
+		"impersonation_id": imp.ID,
+		"impersonated_by":  imp.ImpersonatedBy,
+	})
+
+	c.JSON(http.StatusOK, imp)
+}
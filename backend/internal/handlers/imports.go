@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/importer"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StartImport queues an import of an export archive, sent gzip- or
+// zstd-compressed as the request body. With tenant_id the data goes into that existing,
+// empty tenant; otherwise a tenant is created with the archive's settings
+// and its name, or name when given, and its API key is returned here only.
+func (h *Handler) StartImport(c *gin.Context) {
+	if !h.requireSQLEvents(c, "Imports") {
+		return
+	}
+	tenantID, name := c.Query("tenant_id"), c.Query("name")
+	if tenantID != "" {
+		if _, err := uuid.Parse(tenantID); err != nil {
+			c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+			c.Abort()
+			return
+		}
+	}
+
+	// The archive is spooled to disk, as its manifest is read before it is
+	// stored
+	tmp, err := os.CreateTemp("", "import-*.ndjson.gz")
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to receive archive", err))
+		c.Abort()
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, c.Request.Body)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Failed to read the archive: " + err.Error()))
+		c.Abort()
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.Error(errors.ErrInternal("Failed to receive archive", err))
+		c.Abort()
+		return
+	}
+	manifest, err := importer.ReadManifest(tmp)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.Error(errors.ErrInternal("Failed to receive archive", err))
+		c.Abort()
+		return
+	}
+
+	db := h.dbFor(c)
+	var tenant *models.Tenant
+	if tenantID != "" {
+		if tenant, err = db.GetTenantByID(tenantID); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.Error(errors.ErrTenantNotFound(tenantID))
+			} else {
+				c.Error(errors.ErrDB("get tenant", err))
+			}
+			c.Abort()
+			return
+		}
+		hasData, err := db.TenantHasData(tenantID)
+		if err != nil {
+			c.Error(errors.ErrDB("check tenant data", err))
+			c.Abort()
+			return
+		}
+		if hasData {
+			c.Error(errors.ErrTenantNotEmpty(tenantID))
+			c.Abort()
+			return
+		}
+	} else {
+		if name == "" {
+			name = manifest.Tenant.Name
+		}
+		settings := manifest.Tenant.Settings
+		var appErr *errors.AppError
+		if tenant, appErr = newBulkTenant(models.BulkTenantRequest{Name: name, Settings: &settings}); appErr != nil {
+			c.Error(appErr)
+			c.Abort()
+			return
+		}
+		existing, err := db.GetTenantByName(name)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			c.Error(errors.ErrDB("check existing tenant", err))
+			c.Abort()
+			return
+		}
+		if existing != nil {
+			c.Error(errors.ErrTenantExists(name))
+			c.Abort()
+			return
+		}
+	}
+
+	job := &models.ImportJob{
+		Job:            models.Job{ID: uuid.New().String(), TenantID: tenant.ID},
+		SourceTenantID: manifest.Header.TenantID,
+		TenantCreated:  tenantID == "",
+	}
+	job.ObjectKey = importer.Key(job)
+	if err := h.archive.Put(c.Request.Context(), job.ObjectKey, tmp, size); err != nil {
+		c.Error(errors.ErrInternal("Failed to store archive", err))
+		c.Abort()
+		return
+	}
+	if job.TenantCreated {
+		if err := db.CreateTenant(tenant); err != nil {
+			c.Error(errors.ErrDB("create tenant", err))
+			c.Abort()
+			return
+		}
+		h.recordAudit(c, "tenant.create", "tenant", tenant.ID, map[string]interface{}{"name": tenant.Name, "import_job_id": job.ID})
+	}
+	if err := db.CreateImportJob(job); err != nil {
+		c.Error(errors.ErrDB("create import job", err))
+		c.Abort()
+		return
+	}
+	h.imports.Notify()
+
+	h.recordAudit(c, "tenant.import", "tenant", tenant.ID, map[string]interface{}{
+		"job_id":           job.ID,
+		"source_tenant_id": job.SourceTenantID,
+		"tenant_created":   job.TenantCreated,
+	})
+
+	resp := models.ImportJobResponse{ImportJob: *job, Conflicts: []models.ImportConflict{}}
+	if job.TenantCreated {
+		resp.APIKey = tenant.APIKey
+	}
+	c.Header("Location", c.Request.URL.Path+"/"+job.ID)
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// GetImport returns an import job's progress and the conflicts it logged
+func (h *Handler) GetImport(c *gin.Context) {
+	jobID := c.Param("id")
+	job, err := h.dbFor(c).GetImportJob(jobID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrImportNotFound(jobID))
+		} else {
+			c.Error(errors.ErrDB("get import job", err))
+		}
+		c.Abort()
+		return
+	}
+
+	resp, err := importResponse(job)
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to read import conflicts", err))
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ResumeImport queues a failed import again. It carries on after the last
+// batch it committed.
+func (h *Handler) ResumeImport(c *gin.Context) {
+	jobID := c.Param("id")
+	db := h.dbFor(c)
+	job, err := db.GetImportJob(jobID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrImportNotFound(jobID))
+		} else {
+			c.Error(errors.ErrDB("get import job", err))
+		}
+		c.Abort()
+		return
+	}
+
+	resumed, err := db.ResumeImportJob(jobID)
+	if err != nil {
+		c.Error(errors.ErrDB("resume import job", err))
+		c.Abort()
+		return
+	}
+	if !resumed {
+		c.Error(errors.ErrImportNotFailed(jobID, job.Status))
+		c.Abort()
+		return
+	}
+	h.imports.Notify()
+
+	h.recordAudit(c, "tenant.import_resume", "tenant", job.TenantID, map[string]interface{}{"job_id": job.ID, "after_line": job.Lines})
+
+	job.Status, job.Attempts, job.Error, job.CompletedAt = models.JobPending, 0, "", nil
+	resp, err := importResponse(job)
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to read import conflicts", err))
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// importResponse adds the conflicts a job logged to it
+func importResponse(job *models.ImportJob) (models.ImportJobResponse, error) {
+	resp := models.ImportJobResponse{ImportJob: *job, Conflicts: []models.ImportConflict{}}
+	if job.ConflictLog != "" {
+		if err := json.Unmarshal([]byte(job.ConflictLog), &resp.Conflicts); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	stderrors "errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds of the collections ?include= embeds in a tenant
+const (
+	defaultIncludedEvents = 5
+	maxIncludedEvents     = 50
+	maxIncludedWebhooks   = 100
+)
+
+// tenantIncludes are the relations ?include= asked to embed in a tenant
+type tenantIncludes struct {
+	webhooks bool
+	// events is how many recent events to embed; 0 embeds none
+	events int
+	stats  bool
+}
+
+// parseTenantIncludes reads ?include=, a comma-separated list of webhooks,
+// recent_events, optionally with a count such as recent_events(10), and
+// stats
+func parseTenantIncludes(c *gin.Context) (tenantIncludes, bool) {
+	var includes tenantIncludes
+	for _, name := range strings.Split(c.Query("include"), ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case name == "webhooks":
+			includes.webhooks = true
+		case name == "stats":
+			includes.stats = true
+		case name == "recent_events":
+			includes.events = defaultIncludedEvents
+		case strings.HasPrefix(name, "recent_events(") && strings.HasSuffix(name, ")"):
+			n, err := strconv.Atoi(name[len("recent_events(") : len(name)-1])
+			if err != nil || n < 1 || n > maxIncludedEvents {
+				c.Error(errors.ErrInvalidRequest("recent_events takes a count from 1 to " + strconv.Itoa(maxIncludedEvents)))
+				c.Abort()
+				return tenantIncludes{}, false
+			}
+			includes.events = n
+		default:
+			c.Error(errors.ErrInvalidRequest("Unknown include '" + name + "'; expected webhooks, recent_events, recent_events(n) or stats"))
+			c.Abort()
+			return tenantIncludes{}, false
+		}
+	}
+	return includes, true
+}
+
+// requested reports whether anything is to be embedded
+func (i tenantIncludes) requested() bool {
+	return i.webhooks || i.events > 0 || i.stats
+}
+
+// embedTenantIncludes adds the included relations of a tenant to its
+// response. Each is fetched with its own bounded query, all concurrently
+// and under one query timeout; running out of it fails the request as a
+// search would.
+func (h *Handler) embedTenantIncludes(c *gin.Context, tenantID string, includes tenantIncludes, resp gin.H) bool {
+	parent := c.Request.Context()
+	ctx := parent
+	if timeout := h.cfg.Database.QueryTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(parent, timeout)
+		defer cancel()
+	}
+	db := h.db.WithContext(ctx)
+	store := h.events.EventsWithContext(ctx)
+
+	var (
+		webhooks    []models.Webhook
+		events      []models.Event
+		counts      map[string]int64
+		unprocessed int64
+		queries     []func() error
+	)
+	if includes.webhooks {
+		queries = append(queries, func() (err error) {
+			// One more than is embedded tells whether there are more
+			webhooks, err = db.ListWebhooksLimit(tenantID, maxIncludedWebhooks+1)
+			return err
+		})
+	}
+	if includes.events > 0 {
+		queries = append(queries, func() (err error) {
+			events, err = store.GetEvents(database.EventFilter{TenantID: tenantID, Limit: includes.events})
+			return err
+		})
+	}
+	if includes.stats {
+		queries = append(queries,
+			func() (err error) {
+				counts, err = store.GetEventStats(tenantID)
+				return err
+			},
+			func() (err error) {
+				unprocessed, err = store.CountUnprocessedEvents(tenantID)
+				return err
+			},
+		)
+	}
+
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		go func(i int, query func() error) {
+			defer wg.Done()
+			errs[i] = query()
+		}(i, query)
+	}
+	wg.Wait()
+	if err := stderrors.Join(errs...); err != nil {
+		if parent.Err() == nil && stderrors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = database.ErrQueryTimeout
+		}
+		c.Error(errors.ErrDB("get tenant includes", err))
+		c.Abort()
+		return false
+	}
+
+	if includes.webhooks {
+		response := make([]models.WebhookResponse, 0, min(len(webhooks), maxIncludedWebhooks))
+		for _, wh := range webhooks[:min(len(webhooks), maxIncludedWebhooks)] {
+			response = append(response, wh.ToWebhookResponse())
+		}
+		resp["webhooks"] = response
+		resp["webhooks_truncated"] = len(webhooks) > maxIncludedWebhooks
+	}
+	if includes.events > 0 {
+		response := make([]models.EventResponse, 0, len(events))
+		for _, e := range events {
+			response = append(response, e.ToEventResponse())
+		}
+		resp["recent_events"] = response
+	}
+	if includes.stats {
+		resp["stats"] = gin.H{"stats": counts, "unprocessed_count": unprocessed}
+	}
+	return true
+}
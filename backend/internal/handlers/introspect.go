@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"event-ingestion-system/internal/auth"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/middleware"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Introspect describes the credential the request was made with: its
+// tenant, how it authenticated, what it may do and until when, and the
+// limits it is held to. Clients call it on startup to find a misconfigured
+// credential before their first real request fails.
+func (h *Handler) Introspect(c *gin.Context) {
+	tenant, settings, ok := h.loadTenantSettings(c, auth.GetTenantIDFromContext(c))
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	info := models.CredentialInfo{
+		TenantID:       tenant.ID,
+		TenantName:     tenant.Name,
+		AuthType:       c.GetString("auth_type"),
+		Credential:     auth.Credential(c),
+		Scopes:         credentialScopes(c),
+		Role:           auth.GetRoleFromContext(c),
+		ImpersonatedBy: auth.GetImpersonatorFromContext(c),
+		ExpiresAt:      auth.GetExpiryFromContext(c),
+		Maintenance:    h.maint.Enabled(),
+	}
+	if tenant.Muted(now) {
+		info.NotificationsMuted, info.NotificationsMutedUntil = true, tenant.NotificationsMutedUntil
+	}
+	if result, ok := middleware.RateLimitFromContext(c); ok {
+		info.RateLimit = &models.CredentialRateLimit{
+			RequestsPerMinute: result.Limit,
+			Remaining:         result.Remaining,
+			ResetsAt:          result.Reset.UTC(),
+		}
+	}
+	if quota := settings.Quota; quota != nil && quota.MonthlyEvents > 0 {
+		used, reset, err := h.ingest.QuotaUsage(c.Request.Context(), tenant.ID)
+		if err != nil {
+			c.Error(errors.ErrDB("count monthly events", err))
+			c.Abort()
+			return
+		}
+		info.Quota = &models.CredentialQuota{
+			MonthlyEvents: quota.MonthlyEvents,
+			Used:          used,
+			Remaining:     max(int64(quota.MonthlyEvents)-used, 0),
+			ResetsAt:      reset,
+		}
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// credentialScopes lists what the request's credential may do, as the
+// routes check it: users as their role allows, impersonation tokens as
+// their scope does, and API keys and tenant tokens everything
+func credentialScopes(c *gin.Context) []string {
+	all := []string{models.ScopeRead, models.ScopeWrite, models.ScopeManage}
+	if auth.IsImpersonated(c) {
+		if auth.GetScopeFromContext(c) != models.ScopeWrite {
+			return all[:1]
+		}
+		return all
+	}
+	switch auth.GetRoleFromContext(c) {
+	case models.RoleViewer:
+		return all[:1]
+	case models.RoleDeveloper:
+		return all[:2]
+	}
+	return all
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// metadataMode reads ?metadata=, how much of their metadata the events of
+// a response carry: full, the default, summary or none
+func metadataMode(c *gin.Context) (string, bool) {
+	switch mode := c.Query("metadata"); mode {
+	case "":
+		return models.MetadataFull, true
+	case models.MetadataFull, models.MetadataSummary, models.MetadataNone:
+		return mode, true
+	}
+	c.Error(errors.ErrInvalidRequest("metadata must be full, summary or none"))
+	c.Abort()
+	return "", false
+}
+
+// GetEventMetadata returns one of the caller's events' metadata as it is
+// stored, the document metadata references point at. Its ETag is a hash of
+// the metadata, which only redaction ever changes, so a client holding it
+// revalidates with If-None-Match instead of fetching it again.
+func (h *Handler) GetEventMetadata(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid event ID"))
+		c.Abort()
+		return
+	}
+
+	event, err := h.eventsFor(c).GetEvent(c.GetString("tenant_id"), uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrEventNotFound(int(id)))
+		} else {
+			c.Error(errors.ErrDB("get event", err))
+		}
+		c.Abort()
+		return
+	}
+	metadata := []byte(event.Metadata)
+	if len(metadata) == 0 {
+		metadata = []byte("null")
+	}
+
+	sum := sha256.Sum256(metadata)
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", tag)
+	// Cached copies are checked first, since redaction replaces metadata
+	c.Header("Cache-Control", "private, no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), tag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", metadata)
+}
+
+// etagMatches reports whether an If-None-Match header names tag, weakly
+// compared
+func etagMatches(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/oidc"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// oidcCookiePath limits the flow cookie to the sign-in routes
+const oidcCookiePath = "/api/v1/auth/oidc"
+
+// OIDCLogin sends the user to the identity provider
+func (h *Handler) OIDCLogin(c *gin.Context) {
+	target, flow, err := h.sso.Begin(c.Request.Context())
+	if err != nil {
+		c.Error(errors.ErrInternal("Identity provider is unavailable", err))
+		c.Abort()
+		return
+	}
+
+	h.setOIDCCookie(c, flow, int(oidc.FlowTimeout.Seconds()))
+	c.Redirect(http.StatusFound, target)
+}
+
+// OIDCCallback completes sign-in with the code the identity provider sent
+// the user back with, then signs in the matching user, linking or
+// provisioning them as needed, with a token of our own
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	flow, _ := c.Cookie(oidc.CookieName)
+	// The flow is single use whatever the outcome
+	h.setOIDCCookie(c, "", -1)
+
+	if reason := c.Query("error"); reason != "" {
+		c.Error(errors.ErrUnauthorized("Sign-in was refused by the identity provider: " + reason))
+		c.Abort()
+		return
+	}
+
+	identity, err := h.sso.Finish(c.Request.Context(), flow, c.Query("state"), c.Query("code"))
+	if err != nil {
+		h.logger.WarnContext(c.Request.Context(), "OIDC sign-in failed", "error", err)
+		c.Error(errors.ErrUnauthorized("Sign-in failed or expired; start again"))
+		c.Abort()
+		return
+	}
+
+	user, ok := h.oidcUser(c, identity)
+	if !ok {
+		return
+	}
+
+	token, err := h.auth.GenerateUserJWT(user)
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to generate token", err))
+		c.Abort()
+		return
+	}
+
+	now := time.Now().UTC()
+	if err := h.dbFor(c).RecordUserLogin(user.ID, now); err != nil {
+		h.logger.WarnContext(c.Request.Context(), "Failed to record login", "user_id", user.ID, "error", err)
+	}
+	user.LastLoginAt = &now
+
+	c.Set("tenant_id", user.TenantID)
+	c.Set("user_id", user.ID)
+	h.recordAudit(c, "user.login", "user", strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{"method": "oidc"})
+
+	expiresIn := int(h.auth.JWTExpiry().Seconds())
+	if dashboard := h.cfg.Auth.OIDC.DashboardURL; dashboard != "" {
+		// A fragment never reaches servers or their logs
+		fragment := url.Values{
+			"token":      {token},
+			"token_type": {"Bearer"},
+			"expires_in": {strconv.Itoa(expiresIn)},
+		}
+		c.Redirect(http.StatusFound, strings.SplitN(dashboard, "#", 2)[0]+"#"+fragment.Encode())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_in": expiresIn,
+		"user":       user.ToUserResponse(),
+	})
+}
+
+// oidcUser returns the user an identity signs in as. The tenant is the one
+// the email domain maps to or, for unmapped domains, the one tenant where
+// the email is already a user. Within it the user is found by subject, then
+// by email, linking the subject; unknown users of a mapped domain are
+// provisioned with the default role.
+func (h *Handler) oidcUser(c *gin.Context, identity *oidc.Identity) (*models.User, bool) {
+	cfg := h.cfg.Auth.OIDC
+	db := h.dbFor(c)
+
+	if identity.Email == "" || !identity.EmailVerified {
+		c.Error(errors.ErrForbidden("The identity provider did not supply a verified email"))
+		c.Abort()
+		return nil, false
+	}
+	domain := identity.Email[strings.LastIndex(identity.Email, "@")+1:]
+	if !domainAllowed(cfg.AllowedDomains, domain) {
+		c.Error(errors.ErrForbidden("Email domain '" + domain + "' may not sign in"))
+		c.Abort()
+		return nil, false
+	}
+
+	mapped := mappedTenant(cfg.DomainTenants, domain)
+	tenantID := mapped
+	if tenantID == "" {
+		users, err := db.FindUsersByEmail(identity.Email)
+		if err != nil {
+			c.Error(errors.ErrDB("find user", err))
+			c.Abort()
+			return nil, false
+		}
+		if len(users) != 1 {
+			c.Error(errors.ErrForbidden("No single account matches " + identity.Email))
+			c.Abort()
+			return nil, false
+		}
+		tenantID = users[0].TenantID
+	}
+
+	tenant, err := db.GetTenantByID(tenantID)
+	if err != nil || !tenant.Active {
+		if err != nil && err != gorm.ErrRecordNotFound {
+			c.Error(errors.ErrDB("get tenant", err))
+		} else {
+			c.Error(errors.ErrForbidden("The account's tenant is not active"))
+		}
+		c.Abort()
+		return nil, false
+	}
+
+	user, err := db.GetUserBySSOSubject(tenantID, identity.Subject)
+	if err == gorm.ErrRecordNotFound {
+		user, err = db.GetUserByEmail(tenantID, identity.Email)
+		if err == nil {
+			if user.SSOSubject != "" && user.SSOSubject != identity.Subject {
+				c.Error(errors.ErrForbidden("The account is linked to a different identity"))
+				c.Abort()
+				return nil, false
+			}
+			user.SSOSubject = identity.Subject
+			err = db.UpdateUser(user)
+		}
+	}
+	if err == gorm.ErrRecordNotFound {
+		if mapped == "" {
+			c.Error(errors.ErrForbidden("No account matches " + identity.Email))
+			c.Abort()
+			return nil, false
+		}
+		user = &models.User{
+			TenantID:   tenantID,
+			Email:      identity.Email,
+			SSOSubject: identity.Subject,
+			Role:       cfg.DefaultRole,
+			Active:     true,
+		}
+		if err = db.CreateUser(user); err == nil {
+			c.Set("tenant_id", tenantID)
+			h.recordAudit(c, "user.provision", "user", strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+				"email": user.Email,
+				"role":  user.Role,
+			})
+		}
+	}
+	if err != nil {
+		c.Error(errors.ErrDB("sign in user", err))
+		c.Abort()
+		return nil, false
+	}
+
+	if !user.Active {
+		c.Error(errors.ErrForbidden("User is deactivated"))
+		c.Abort()
+		return nil, false
+	}
+	return user, true
+}
+
+// setOIDCCookie sets the flow cookie; a negative maxAge deletes it. The
+// cookie is Lax so it comes back on the provider's top-level redirect.
+func (h *Handler) setOIDCCookie(c *gin.Context, value string, maxAge int) {
+	secure := strings.HasPrefix(h.cfg.Auth.OIDC.RedirectURL, "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidc.CookieName, value, maxAge, oidcCookiePath, "", secure, true)
+}
+
+func domainAllowed(allowed []string, domain string) bool {
+	for _, d := range allowed {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func mappedTenant(tenants map[string]string, domain string) string {
+	for d, tenantID := range tenants {
+		if strings.EqualFold(d, domain) {
+			return tenantID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/testsupport"
+)
+
+// startWithOIDC starts a server that signs in through a fake provider for
+// the example.com domain
+func startWithOIDC(t *testing.T, identity testsupport.OIDCIdentity) (*testsupport.Server, *testsupport.OIDCProvider, *config.OIDCConfig) {
+	t.Helper()
+	provider := testsupport.StartOIDCProvider(t, identity)
+	oidc := provider.Config("https://events.example.com/api/v1/auth/oidc/callback", "example.com")
+	s := testsupport.Start(t, func(cfg *config.Config) { cfg.Auth.OIDC = oidc })
+	return s, provider, oidc
+}
+
+// signIn completes the flow and returns the status and, on success, the
+// signed-in user and their token
+func signIn(t *testing.T, s *testsupport.Server, provider *testsupport.OIDCProvider) (int, models.UserResponse, string) {
+	t.Helper()
+	resp, err := provider.SignIn(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Token string              `json:"token"`
+		User  models.UserResponse `json:"user"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, body.User, body.Token
+}
+
+func TestOIDCSignInLinksAnExistingUser(t *testing.T) {
+	identity := testsupport.OIDCIdentity{Subject: "sub-alice", Email: "alice@example.com", EmailVerified: true}
+	s, provider, _ := startWithOIDC(t, identity)
+	var created models.UserResponse
+	status, err := s.Client.JSON(http.MethodPost, "/api/v1/users", models.CreateUserRequest{Email: identity.Email, Password: "correct horse battery", Role: "developer"}, &created)
+	if err != nil || status != http.StatusCreated {
+		t.Fatalf("create user: status %d: %v", status, err)
+	}
+
+	status, user, token := signIn(t, s, provider)
+	if status != http.StatusOK {
+		t.Fatalf("sign in: status %d, want %d", status, http.StatusOK)
+	}
+	if user.ID != created.ID || user.Role != "developer" || user.SSOSubject != identity.Subject {
+		t.Fatalf("user = %+v, want user %d linked to %s", user, created.ID, identity.Subject)
+	}
+	if status, err := s.Anonymous.With("Authorization", "Bearer "+token).JSON(http.MethodGet, "/api/v1/events", nil, nil); err != nil || status != http.StatusOK {
+		t.Fatalf("list events with the issued token: status %d: %v", status, err)
+	}
+
+	// Once linked, the subject finds the same user
+	if status, user, _ := signIn(t, s, provider); status != http.StatusOK || user.ID != created.ID {
+		t.Fatalf("sign in again: status %d, user %d, want user %d", status, user.ID, created.ID)
+	}
+
+	// A different subject with the linked email is refused
+	provider.SetIdentity(testsupport.OIDCIdentity{Subject: "sub-mallory", Email: identity.Email, EmailVerified: true})
+	if status, _, _ := signIn(t, s, provider); status != http.StatusForbidden {
+		t.Fatalf("sign in as another subject: status %d, want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestOIDCSignInProvisionsUsersOfMappedDomains(t *testing.T) {
+	s, provider, oidc := startWithOIDC(t, testsupport.OIDCIdentity{Subject: "sub-bob", Email: "bob@example.com", EmailVerified: true})
+	// The tenant to map to exists only once the server has started
+	oidc.DomainTenants = map[string]string{"example.com": s.Tenant.ID}
+
+	status, user, _ := signIn(t, s, provider)
+	if status != http.StatusOK {
+		t.Fatalf("sign in: status %d, want %d", status, http.StatusOK)
+	}
+	if user.Email != "bob@example.com" || user.Role != "viewer" || user.SSOSubject != "sub-bob" {
+		t.Fatalf("user = %+v, want bob provisioned as a viewer", user)
+	}
+}
+
+func TestOIDCSignInRefusals(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		identity testsupport.OIDCIdentity
+		offset   time.Duration
+		want     int
+	}{
+		{"provider clock within the skew", testsupport.OIDCIdentity{Email: "carol@example.com", EmailVerified: true}, 30 * time.Second, http.StatusOK},
+		{"unverified email", testsupport.OIDCIdentity{Email: "carol@example.com"}, 0, http.StatusForbidden},
+		{"domain not allowed", testsupport.OIDCIdentity{Email: "carol@example.org", EmailVerified: true}, 0, http.StatusForbidden},
+		// The default clock_skew is a minute
+		{"token issued in the future", testsupport.OIDCIdentity{Email: "carol@example.com", EmailVerified: true}, 5 * time.Minute, http.StatusUnauthorized},
+		{"token expired", testsupport.OIDCIdentity{Email: "carol@example.com", EmailVerified: true}, -10 * time.Minute, http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.identity.Subject = "sub-carol"
+			s, provider, oidc := startWithOIDC(t, tc.identity)
+			oidc.DomainTenants = map[string]string{"example.com": s.Tenant.ID}
+			provider.SetClockOffset(tc.offset)
+			if status, _, _ := signIn(t, s, provider); status != tc.want {
+				t.Fatalf("sign in: status %d, want %d", status, tc.want)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRequiresTheFlowItStarted(t *testing.T) {
+	s, _, _ := startWithOIDC(t, testsupport.OIDCIdentity{Subject: "sub-dave", Email: "dave@example.com", EmailVerified: true})
+
+	// No flow cookie, as in a forged or replayed callback
+	status, err := s.Anonymous.JSON(http.MethodGet, "/api/v1/auth/oidc/callback?state=forged&code=forged", nil, nil)
+	if err != nil || status != http.StatusUnauthorized {
+		t.Fatalf("callback without a flow: status %d, want %d: %v", status, http.StatusUnauthorized, err)
+	}
+}
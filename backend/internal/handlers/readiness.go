@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Readiness levels, from best to worst. Only unhealthy fails /ready, so
+// load balancers keep routing to a degraded instance.
+const (
+	healthOK        = "ok"
+	healthDegraded  = "degraded"
+	healthUnhealthy = "unhealthy"
+)
+
+// healthRank orders the levels, to take the worst of several
+var healthRank = map[string]int{healthOK: 0, healthDegraded: 1, healthUnhealthy: 2}
+
+// componentHealth is one component's entry in the /ready payload. Only the
+// details that apply to the component are set.
+type componentHealth struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	LatencyMs   *float64 `json:"latency_ms,omitempty"`
+	QueueDepth  *int     `json:"queue_depth,omitempty"`
+	Connections *int     `json:"connections,omitempty"`
+	Buffered    *int     `json:"buffered_messages,omitempty"`
+}
+
+// readinessCheck reports one component's health. A check that does not
+// return within health.check_timeout is graded onTimeout.
+type readinessCheck struct {
+	name      string
+	onTimeout string
+	run       func(ctx context.Context) componentHealth
+}
+
+// Readiness reports whether the server can take traffic: it can't while
+// shutting down or draining WebSocket connections, or while a component is
+// unhealthy. Components are checked concurrently, each within
+// health.check_timeout, and the overall status is the worst of theirs.
+// During maintenance the server stays ready, since reads are still served,
+// but reports the mode.
+func (h *Handler) Readiness(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+		return
+	}
+	if h.hub.Draining() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining", "drain": h.hub.DrainStatus()})
+		return
+	}
+
+	checks := h.readinessChecks()
+	components := h.runReadinessChecks(c.Request.Context(), checks)
+	status := healthOK
+	for name, component := range components {
+		if healthRank[component.Status] > healthRank[status] {
+			status = component.Status
+		}
+		if component.Status == healthUnhealthy {
+			h.logger.ErrorContext(c.Request.Context(), "Readiness check failed", "component", name, "error", component.Error)
+		}
+	}
+
+	response := gin.H{"status": status, "components": components}
+	if state := h.maint.State(); state.Enabled {
+		response["maintenance"] = state
+	}
+	code := http.StatusOK
+	if status == healthUnhealthy {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, response)
+}
+
+// readinessChecks lists the components /ready reports: the database, the
+// webhook dispatcher, the WebSocket hub and the registered integrations,
+// whose failure only degrades the server since the API itself still works
+func (h *Handler) readinessChecks() []readinessCheck {
+	cfg := h.cfg.Health
+	checks := []readinessCheck{
+		{name: "database", onTimeout: healthUnhealthy, run: func(ctx context.Context) componentHealth {
+			start := time.Now()
+			sqlDB, err := h.db.DB.DB()
+			if err == nil {
+				err = sqlDB.PingContext(ctx)
+			}
+			latency := time.Since(start)
+			ms := float64(latency.Microseconds()) / 1000
+			switch {
+			case err != nil:
+				return componentHealth{Status: healthUnhealthy, Error: err.Error(), LatencyMs: &ms}
+			case cfg.DatabaseLatencyDegraded > 0 && latency > cfg.DatabaseLatencyDegraded:
+				return componentHealth{Status: healthDegraded, Error: "ping slower than " + cfg.DatabaseLatencyDegraded.String(), LatencyMs: &ms}
+			}
+			return componentHealth{Status: healthOK, LatencyMs: &ms}
+		}},
+		{name: "webhook_dispatcher", onTimeout: healthDegraded, run: func(ctx context.Context) componentHealth {
+			depth := h.webhooks.QueueDepth()
+			switch {
+			case cfg.WebhookQueueUnhealthy > 0 && depth >= cfg.WebhookQueueUnhealthy:
+				return componentHealth{Status: healthUnhealthy, Error: fmt.Sprintf("%d deliveries queued", depth), QueueDepth: &depth}
+			case cfg.WebhookQueueDegraded > 0 && depth >= cfg.WebhookQueueDegraded:
+				return componentHealth{Status: healthDegraded, Error: fmt.Sprintf("%d deliveries queued", depth), QueueDepth: &depth}
+			}
+			return componentHealth{Status: healthOK, QueueDepth: &depth}
+		}},
+		{name: "hub", onTimeout: healthDegraded, run: func(ctx context.Context) componentHealth {
+			stats := h.hub.Stats()
+			return componentHealth{Status: healthOK, Connections: &stats.Connections, Buffered: &stats.BufferedMessages}
+		}},
+	}
+	for _, comp := range h.components {
+		comp := comp
+		checks = append(checks, readinessCheck{name: comp.name, onTimeout: healthDegraded, run: func(ctx context.Context) componentHealth {
+			if err := comp.health(); err != nil {
+				return componentHealth{Status: healthDegraded, Error: err.Error()}
+			}
+			return componentHealth{Status: healthOK}
+		}})
+	}
+	return checks
+}
+
+// runReadinessChecks runs the checks concurrently. A check still running
+// at health.check_timeout is reported as timed out and left to finish on
+// its own, so one hung dependency cannot hold up the others.
+func (h *Handler) runReadinessChecks(ctx context.Context, checks []readinessCheck) map[string]componentHealth {
+	timeout := h.cfg.Health.CheckTimeout
+	type result struct {
+		name   string
+		health componentHealth
+	}
+	results := make(chan result, len(checks))
+	for _, check := range checks {
+		go func(check readinessCheck) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			done := make(chan componentHealth, 1)
+			go func() { done <- check.run(ctx) }()
+			select {
+			case health := <-done:
+				results <- result{check.name, health}
+			case <-ctx.Done():
+				results <- result{check.name, componentHealth{Status: check.onTimeout, Error: "check timed out after " + timeout.String()}}
+			}
+		}(check)
+	}
+
+	components := make(map[string]componentHealth, len(checks))
+	for range checks {
+		r := <-results
+		components[r.name] = r.health
+	}
+	return components
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sort"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/receipt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyReceipt checks the signature of ?receipt= and returns what it
+// attests. It reads only the configured keys, never the database, so it
+// answers for receipts of deleted events too.
+func (h *Handler) VerifyReceipt(c *gin.Context) {
+	token := c.Query("receipt")
+	if token == "" {
+		c.Error(errors.ErrInvalidRequest("receipt parameter is required"))
+		c.Abort()
+		return
+	}
+
+	r, err := h.receipts.Verify(token)
+	if err != nil {
+		resp := gin.H{"valid": false, "reason": err.Error()}
+		if err != receipt.ErrMalformed {
+			resp["receipt"] = r
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"valid": true, "receipt": r})
+}
+
+// GetReceiptKeys lists the public keys receipts are verified with, for
+// customers verifying them offline
+func (h *Handler) GetReceiptKeys(c *gin.Context) {
+	keys := make([]gin.H, 0, len(h.receipts.PublicKeys()))
+	for id, key := range h.receipts.PublicKeys() {
+		keys = append(keys, gin.H{"kid": id, "public_key": base64.StdEncoding.EncodeToString(key)})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i]["kid"].(string) < keys[j]["kid"].(string)
+	})
+	c.JSON(http.StatusOK, gin.H{"algorithm": receipt.Algorithm, "keys": keys})
+}
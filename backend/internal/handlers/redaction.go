@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"event-ingestion-system/internal/auth"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/redact"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ownTenant returns the :id parameter if it is the caller's tenant
+func ownTenant(c *gin.Context, forbidden string) (string, bool) {
+	tenantID := c.Param("id")
+	if _, err := uuid.Parse(tenantID); err != nil {
+		c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+		c.Abort()
+		return "", false
+	}
+	if tenantID != auth.GetTenantIDFromContext(c) {
+		c.Error(errors.ErrForbidden(forbidden))
+		c.Abort()
+		return "", false
+	}
+	return tenantID, true
+}
+
+// loadTenantSettings fetches the tenant and its decoded settings
+func (h *Handler) loadTenantSettings(c *gin.Context, tenantID string) (*models.Tenant, models.TenantSettings, bool) {
+	tenant, err := h.dbFor(c).GetTenantByID(tenantID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrTenantNotFound(tenantID))
+		} else {
+			c.Error(errors.ErrDB("fetch tenant", err))
+		}
+		c.Abort()
+		return nil, models.TenantSettings{}, false
+	}
+	settings, err := tenant.ParseSettings()
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to read tenant settings", err))
+		c.Abort()
+		return nil, models.TenantSettings{}, false
+	}
+	return tenant, settings, true
+}
+
+// saveTenantSettings stores the tenant's settings while it is at version,
+// or whatever its version when that is 0, and returns its new version. The
+// cached tenant is dropped so ingestion picks the settings up.
+func (h *Handler) saveTenantSettings(c *gin.Context, tenantID string, settings models.TenantSettings, version int64) (int64, bool) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to encode tenant settings", err))
+		c.Abort()
+		return 0, false
+	}
+	updated, err := h.dbFor(c).UpdateTenantSettings(tenantID, string(data), version)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrTenantNotFound(tenantID))
+		} else if appErr, ok := staleVersion(err, "tenant"); ok {
+			c.Error(appErr)
+		} else {
+			c.Error(errors.ErrDB("update tenant settings", err))
+		}
+		c.Abort()
+		return 0, false
+	}
+	h.tenants.Invalidate(tenantID)
+	return updated, true
+}
+
+// GetRedactionRules returns the rules applied to the tenant's event metadata
+// before it is stored
+func (h *Handler) GetRedactionRules(c *gin.Context) {
+	tenantID, ok := ownTenant(c, "Tenants can only read their own redaction rules")
+	if !ok {
+		return
+	}
+	tenant, settings, ok := h.loadTenantSettings(c, tenantID)
+	if !ok {
+		return
+	}
+
+	rules := settings.RedactionRules
+	if rules == nil {
+		rules = []models.RedactionRule{}
+	}
+	setVersionTag(c, tenant.Version)
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "version": tenant.Version})
+}
+
+// SetRedactionRules replaces the tenant's redaction rules. Rules are
+// compiled before they are saved so ingestion never meets an invalid one;
+// an empty list turns redaction off. The rules are tenant settings, so
+// If-Match or version make the update conditional on the tenant's version.
+func (h *Handler) SetRedactionRules(c *gin.Context) {
+	tenantID, ok := ownTenant(c, "Tenants can only change their own redaction rules")
+	if !ok {
+		return
+	}
+
+	var req models.RedactionRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	if _, err := redact.Compile(req.Rules, tenantID); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	version, given, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+	if h.versionRequired(given) {
+		c.Error(errors.ErrVersionRequired("tenant"))
+		c.Abort()
+		return
+	}
+
+	tenant, settings, ok := h.loadTenantSettings(c, tenantID)
+	if !ok {
+		return
+	}
+	if version != 0 && tenant.Version != version {
+		c.Error(errors.ErrStaleVersion("tenant", tenant.Version))
+		c.Abort()
+		return
+	}
+	settings.RedactionRules = req.Rules
+	updated, ok := h.saveTenantSettings(c, tenantID, settings, version)
+	if !ok {
+		return
+	}
+
+	names := make([]string, 0, len(req.Rules))
+	for _, rule := range req.Rules {
+		names = append(names, rule.Name)
+	}
+	h.recordAudit(c, "tenant.redaction_rules.update", "tenant", tenantID, map[string]interface{}{
+		"rules":   names,
+		"version": updated,
+	})
+
+	setVersionTag(c, updated)
+	c.JSON(http.StatusOK, gin.H{"rules": req.Rules, "version": updated})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RedactEvent replaces the metadata of one of the caller's events with a
+// redaction marker, keeping the event for counts and audits. Redacting it
+// again returns the event as it is, without a new audit entry or notice.
+func (h *Handler) RedactEvent(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid event ID"))
+		c.Abort()
+		return
+	}
+
+	tenantID := c.GetString("tenant_id")
+	event, redacted, err := h.eventsFor(c).RedactEvent(tenantID, uint(id), time.Now().UTC())
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrEventNotFound(int(id)))
+		} else {
+			c.Error(errors.ErrDB("redact event", err))
+		}
+		c.Abort()
+		return
+	}
+
+	resp := event.ToEventResponse()
+	if redacted {
+		h.recordAudit(c, "event.redact", "event", strconv.FormatUint(id, 10), map[string]interface{}{
+			"event_type": event.EventType,
+			"sequence":   event.Sequence,
+		})
+		if err := h.hub.NotifyTenant(tenantID, "event.updated", resp); err != nil {
+			h.logger.Warn("Failed to notify event redaction", "event_id", id, "error", err)
+		}
+	}
+	render(c, http.StatusOK, resp)
+}
+
+// StartRedaction queues a job redacting the caller's events of one type
+// with a timestamp in [since, until)
+func (h *Handler) StartRedaction(c *gin.Context) {
+	if !h.requireSQLEvents(c, "Bulk redactions") {
+		return
+	}
+	var req models.RedactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		c.Abort()
+		return
+	}
+	if !req.Until.After(req.Since) {
+		c.Error(errors.ErrInvalidRequest("until must be after since"))
+		c.Abort()
+		return
+	}
+
+	job := &models.RedactionJob{
+		Job:       models.Job{ID: uuid.New().String(), TenantID: c.GetString("tenant_id")},
+		EventType: req.EventType,
+		Since:     req.Since.UTC(),
+		Until:     req.Until.UTC(),
+	}
+	if err := h.dbFor(c).CreateRedactionJob(job); err != nil {
+		c.Error(errors.ErrDB("create redaction job", err))
+		c.Abort()
+		return
+	}
+	h.redactions.Notify()
+
+	h.recordAudit(c, "events.redact", "redaction", job.ID, map[string]interface{}{
+		"event_type": job.EventType,
+		"since":      job.Since,
+		"until":      job.Until,
+	})
+
+	c.Header("Location", c.Request.URL.Path+"/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetRedaction returns a redaction job's status and progress
+func (h *Handler) GetRedaction(c *gin.Context) {
+	jobID := c.Param("id")
+	job, err := h.dbFor(c).GetRedactionJob(c.GetString("tenant_id"), jobID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrRedactionNotFound(jobID))
+		} else {
+			c.Error(errors.ErrDB("get redaction job", err))
+		}
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/report"
+	"event-ingestion-system/internal/views"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loadReport returns the :id report of the authenticated tenant
+func (h *Handler) loadReport(c *gin.Context) (*models.Report, bool) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid report ID"))
+		c.Abort()
+		return nil, false
+	}
+
+	r, err := h.dbFor(c).GetReport(c.GetString("tenant_id"), uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrReportNotFound(idParam))
+		} else {
+			c.Error(errors.ErrDB("get report", err))
+		}
+		c.Abort()
+		return nil, false
+	}
+	return r, true
+}
+
+// applyReportRequest validates a request and copies it onto r, computing
+// the next run. It returns a newly generated signing secret, if the report
+// now needs one.
+func (h *Handler) applyReportRequest(c *gin.Context, r *models.Report) (string, bool) {
+	var req models.ReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return "", false
+	}
+
+	next, err := report.NextRun(req.Schedule, time.Now())
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("schedule: " + err.Error()))
+		c.Abort()
+		return "", false
+	}
+	if (req.WebhookID == nil) == (req.URL == "") {
+		c.Error(errors.ErrInvalidRequest("Exactly one of webhook_id and url is required"))
+		c.Abort()
+		return "", false
+	}
+	if req.URL != "" && !h.checkTargetURL(c, req.URL) {
+		return "", false
+	}
+	if err := views.Validate(models.ViewFilter{EventTypes: req.Filter.EventTypes, Tags: req.Filter.Tags, Search: req.Filter.Search}); err != nil {
+		c.Error(errors.ErrInvalidRequest("filter." + err.Error()))
+		c.Abort()
+		return "", false
+	}
+	switch req.Format {
+	case "":
+		req.Format = models.ReportFormatJSON
+	case models.ReportFormatJSON, models.ReportFormatText:
+	default:
+		c.Error(errors.ErrInvalidRequest("format must be json or text"))
+		c.Abort()
+		return "", false
+	}
+
+	if req.WebhookID != nil {
+		if _, err := h.dbFor(c).GetWebhook(r.TenantID, *req.WebhookID); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.Error(errors.ErrWebhookNotFound(strconv.FormatUint(uint64(*req.WebhookID), 10)))
+			} else {
+				c.Error(errors.ErrDB("get webhook", err))
+			}
+			c.Abort()
+			return "", false
+		}
+	}
+
+	filter, err := json.Marshal(req.Filter)
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to encode report filter", err))
+		c.Abort()
+		return "", false
+	}
+
+	r.Name = req.Name
+	r.Schedule = req.Schedule
+	r.WebhookID = req.WebhookID
+	r.URL = req.URL
+	r.Filter = string(filter)
+	r.Format = req.Format
+	r.Active = req.Active == nil || *req.Active
+	r.NextRunAt = next
+
+	// Deliveries to a URL are signed with a secret of the report's own
+	secret := ""
+	if r.URL == "" {
+		r.Secret = ""
+	} else if r.Secret == "" {
+		if secret, err = generateSecret(); err != nil {
+			c.Error(errors.ErrInternal("Failed to generate report secret", err))
+			c.Abort()
+			return "", false
+		}
+		r.Secret = secret
+	}
+	return secret, true
+}
+
+// reportResult is the body of a create or update; the secret is only
+// included when one was generated
+func reportResult(r *models.Report, secret string) gin.H {
+	result := gin.H{"report": r.ToReportResponse()}
+	if secret != "" {
+		result["secret"] = secret
+	}
+	return result
+}
+
+// CreateReport schedules a report for the authenticated tenant
+func (h *Handler) CreateReport(c *gin.Context) {
+	r := &models.Report{TenantID: c.GetString("tenant_id")}
+	secret, ok := h.applyReportRequest(c, r)
+	if !ok {
+		return
+	}
+
+	if err := h.dbFor(c).CreateReport(r); err != nil {
+		c.Error(errors.ErrDB("create report", err))
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "report.create", "report", strconv.FormatUint(uint64(r.ID), 10), map[string]interface{}{
+		"name":     r.Name,
+		"schedule": r.Schedule,
+	})
+
+	c.JSON(http.StatusCreated, reportResult(r, secret))
+}
+
+// ListReports returns the authenticated tenant's reports
+func (h *Handler) ListReports(c *gin.Context) {
+	reports, err := h.dbFor(c).ListReports(c.GetString("tenant_id"))
+	if err != nil {
+		c.Error(errors.ErrDB("list reports", err))
+		c.Abort()
+		return
+	}
+
+	response := make([]models.ReportResponse, 0, len(reports))
+	for _, r := range reports {
+		response = append(response, r.ToReportResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reports": response})
+}
+
+// GetReport returns one of the authenticated tenant's reports
+func (h *Handler) GetReport(c *gin.Context) {
+	r, ok := h.loadReport(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, r.ToReportResponse())
+}
+
+// UpdateReport replaces a report's definition. The next run is computed
+// afresh, so reactivating a report does not run the periods it missed.
+func (h *Handler) UpdateReport(c *gin.Context) {
+	r, ok := h.loadReport(c)
+	if !ok {
+		return
+	}
+	secret, ok := h.applyReportRequest(c, r)
+	if !ok {
+		return
+	}
+
+	if err := h.dbFor(c).UpdateReport(r); err != nil {
+		c.Error(errors.ErrDB("update report", err))
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "report.update", "report", strconv.FormatUint(uint64(r.ID), 10), map[string]interface{}{
+		"name":     r.Name,
+		"schedule": r.Schedule,
+		"active":   r.Active,
+	})
+
+	c.JSON(http.StatusOK, reportResult(r, secret))
+}
+
+// DeleteReport removes one of the authenticated tenant's reports
+func (h *Handler) DeleteReport(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	idParam := c.Param("id")
+
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid report ID"))
+		c.Abort()
+		return
+	}
+
+	if err := h.dbFor(c).DeleteReport(tenantID, uint(id)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrReportNotFound(idParam))
+		} else {
+			c.Error(errors.ErrDB("delete report", err))
+		}
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "report.delete", "report", idParam, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// RunReport computes and delivers a report immediately, once, without
+// moving its schedule. Like a webhook test, a failed delivery is a result
+// rather than an API error.
+func (h *Handler) RunReport(c *gin.Context) {
+	r, ok := h.loadReport(c)
+	if !ok {
+		return
+	}
+
+	summary, err := h.reports.RunNow(c.Request.Context(), *r)
+	if summary == nil && err != nil {
+		c.Error(errors.ErrInternal("Failed to compute report", err))
+		c.Abort()
+		return
+	}
+
+	response := gin.H{"report_id": r.ID, "delivered": err == nil, "summary": summary}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"sort"
+	"strings"
+
+	"event-ingestion-system/internal/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteNotFound answers requests no route matched with the error envelope.
+// It goes last in the NoRoute chain, so it leaves responses an earlier
+// handler, such as the dashboard, already wrote alone.
+func RouteNotFound(c *gin.Context) {
+	if c.Writer.Written() {
+		return
+	}
+	c.Error(errors.ErrRouteNotFound(c.Request.Method, c.Request.URL.Path))
+	c.Abort()
+}
+
+// MethodNotAllowed answers requests whose path only matches routes of other
+// methods, listing those methods in the Allow header
+func MethodNotAllowed(routes gin.RoutesInfo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		seen := make(map[string]bool)
+		var allowed []string
+		for _, route := range routes {
+			if !seen[route.Method] && routeMatches(route.Path, path) {
+				seen[route.Method] = true
+				allowed = append(allowed, route.Method)
+			}
+		}
+		sort.Strings(allowed)
+
+		c.Header("Allow", strings.Join(allowed, ", "))
+		c.Error(errors.ErrMethodNotAllowed(c.Request.Method, path))
+		c.Abort()
+	}
+}
+
+// routeMatches reports whether path fits a Gin route pattern, where :name
+// matches one segment and *name the rest of the path
+func routeMatches(pattern, path string) bool {
+	patternSegments := strings.Split(pattern, "/")
+	pathSegments := strings.Split(path, "/")
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if strings.HasPrefix(segment, ":") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/ingest"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSamplingRules returns the rules that keep some of the tenant's events
+// from being stored
+func (h *Handler) GetSamplingRules(c *gin.Context) {
+	tenantID, ok := ownTenant(c, "Tenants can only read their own sampling rules")
+	if !ok {
+		return
+	}
+	tenant, settings, ok := h.loadTenantSettings(c, tenantID)
+	if !ok {
+		return
+	}
+
+	rules := settings.SamplingRules
+	if rules == nil {
+		rules = []models.SamplingRule{}
+	}
+	setVersionTag(c, tenant.Version)
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "version": tenant.Version})
+}
+
+// SetSamplingRules replaces the tenant's sampling rules; an empty list
+// stores every event again. Like redaction rules they are tenant settings,
+// so If-Match or version make the update conditional on the tenant's
+// version.
+func (h *Handler) SetSamplingRules(c *gin.Context) {
+	tenantID, ok := ownTenant(c, "Tenants can only change their own sampling rules")
+	if !ok {
+		return
+	}
+
+	var req models.SamplingRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	if err := ingest.ValidateSamplingRules(req.Rules); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	version, given, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+	if h.versionRequired(given) {
+		c.Error(errors.ErrVersionRequired("tenant"))
+		c.Abort()
+		return
+	}
+
+	tenant, settings, ok := h.loadTenantSettings(c, tenantID)
+	if !ok {
+		return
+	}
+	if version != 0 && tenant.Version != version {
+		c.Error(errors.ErrStaleVersion("tenant", tenant.Version))
+		c.Abort()
+		return
+	}
+	settings.SamplingRules = req.Rules
+	updated, ok := h.saveTenantSettings(c, tenantID, settings, version)
+	if !ok {
+		return
+	}
+
+	types := make([]string, 0, len(req.Rules))
+	for _, rule := range req.Rules {
+		types = append(types, rule.EventType)
+	}
+	h.recordAudit(c, "tenant.sampling_rules.update", "tenant", tenantID, map[string]interface{}{
+		"event_types": types,
+		"version":     updated,
+	})
+
+	setVersionTag(c, updated)
+	c.JSON(http.StatusOK, gin.H{"rules": req.Rules, "version": updated})
+}
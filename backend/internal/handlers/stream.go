@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/auth"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/realip"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// MIMENDJSON is newline-delimited JSON, one value per line
+const MIMENDJSON = "application/x-ndjson"
+
+const (
+	// maxStreamLine bounds one line of an event stream
+	maxStreamLine = 2 << 20
+	// maxStreamRejections bounds the rejected lines listed in the summary
+	// answered at the end of a stream
+	maxStreamRejections = 1000
+)
+
+// streamAck acknowledges lines of an event stream. Every line up to
+// AckedThroughLine is settled: stored, or rejected and listed.
+type streamAck struct {
+	AckedThroughLine int `json:"acked_through_line"`
+	// Accepted counts the lines stored, or kept out by sampling rules,
+	// since the previous record
+	Accepted          int               `json:"accepted"`
+	Rejected          []streamRejection `json:"rejected"`
+	RejectedTruncated bool              `json:"rejected_truncated,omitempty"`
+	// Done marks the last record of a stream read to the end
+	Done  bool             `json:"done,omitempty"`
+	Error *errors.AppError `json:"error,omitempty"`
+}
+
+// streamRejection is a line of an event stream that was not stored
+type streamRejection struct {
+	Line  int              `json:"line"`
+	Error *errors.AppError `json:"error"`
+}
+
+// eventStream is the state of one IngestStream request
+type eventStream struct {
+	c  *gin.Context
+	rc *http.ResponseController
+	// progress is set for clients that read progress records as they
+	// come; others get a single summary at the end
+	progress     bool
+	writeTimeout time.Duration
+
+	// acked is the last line acknowledged, current what was read since,
+	// and summary the sum of the acknowledged chunks when progress is off
+	acked            int
+	current, summary streamAck
+}
+
+// IngestStream ingests newline-delimited events, each line a body as
+// IngestEvent takes. Every ingest.stream_ack_every accepted lines are
+// committed in one transaction and, for clients that accept
+// application/x-ndjson, acknowledged with a progress record while the body
+// is still being read. Other clients get one summary once the body ends. A
+// stream cut off part way leaves the acknowledged lines stored and nothing
+// after them.
+func (h *Handler) IngestStream(c *gin.Context) {
+	s := &eventStream{
+		c:            c,
+		rc:           http.NewResponseController(c.Writer),
+		progress:     strings.Contains(c.GetHeader("Accept"), MIMENDJSON),
+		writeTimeout: h.cfg.App.WriteTimeout,
+	}
+	// The server's timeouts would cut a long stream short; instead each
+	// line, and each record written, must go through within them
+	extendDeadline(s.rc.SetWriteDeadline, s.writeTimeout)
+	if s.progress {
+		// HTTP/1.1 stops reading the body once the response starts unless
+		// told otherwise; HTTP/2 needs nothing and reports it unsupported
+		s.rc.EnableFullDuplex()
+		c.Header("Content-Type", MIMENDJSON)
+		c.Writer.WriteHeaderNow()
+		if s.rc.Flush() != nil {
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	every := h.cfg.Ingest.StreamAckEvery
+	source, credential, clientIP := c.GetHeader(EventSourceHeader), auth.Credential(c), realip.Get(c)
+	chunk := h.ingest.NewChunk()
+	ack := func(line int, done bool) bool {
+		if _, err := chunk.Commit(ctx); err != nil {
+			h.failStream(s, err)
+			return false
+		}
+		return s.ack(line, done)
+	}
+
+	lines := bufio.NewScanner(c.Request.Body)
+	lines.Buffer(make([]byte, 64*1024), maxStreamLine)
+	line := 0
+	for {
+		extendDeadline(s.rc.SetReadDeadline, h.cfg.App.ReadTimeout)
+		if !lines.Scan() {
+			break
+		}
+		line++
+		text := bytes.TrimSpace(lines.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var req models.EventRequest
+		err := json.Unmarshal(text, &req)
+		if err == nil {
+			err = binding.Validator.ValidateStruct(&req)
+		}
+		if err != nil {
+			s.reject(line, invalidRequest(err))
+		} else {
+			if req.Source == "" {
+				req.Source = source
+			}
+			req.Credential, req.ClientIP = credential, clientIP
+			if _, err := chunk.Add(ctx, req); err != nil {
+				appErr, ok := err.(*errors.AppError)
+				if !ok || appErr.StatusCode >= http.StatusInternalServerError {
+					// The event may well be fine, so the stream fails for
+					// the producer to send it again
+					h.failStream(s, err)
+					return
+				}
+				s.reject(line, appErr)
+			} else {
+				s.current.Accepted++
+			}
+		}
+
+		if s.current.Accepted == every || len(s.current.Rejected) == every {
+			if !ack(line, false) {
+				return
+			}
+		}
+	}
+	if err := lines.Err(); err != nil {
+		// The connection dropped or a line was too long; the chunk read so
+		// far is dropped, leaving the database as last acknowledged
+		if err == bufio.ErrTooLong {
+			h.failStream(s, errors.ErrInvalidRequest("Line "+strconv.Itoa(line+1)+" is longer than "+strconv.Itoa(maxStreamLine)+" bytes"))
+		} else {
+			h.failStream(s, errors.ErrInvalidRequest("Failed to read the stream: "+err.Error()))
+		}
+		return
+	}
+
+	if ack(line, true) && !s.progress {
+		extendDeadline(s.rc.SetWriteDeadline, s.writeTimeout)
+		c.JSON(http.StatusOK, s.summary)
+	}
+}
+
+// reject lists a line that will not be stored
+func (s *eventStream) reject(line int, appErr *errors.AppError) {
+	s.current.Rejected = append(s.current.Rejected, streamRejection{Line: line, Error: appErr})
+}
+
+// ack acknowledges the lines read through line, once their chunk is
+// committed. It returns false if the client can no longer be written to.
+func (s *eventStream) ack(line int, done bool) bool {
+	s.acked = line
+	s.current.AckedThroughLine, s.current.Done = line, done
+	if s.progress {
+		ok := s.send(s.current)
+		s.current = streamAck{}
+		return ok
+	}
+
+	s.summary.AckedThroughLine, s.summary.Done = line, done
+	s.summary.Accepted += s.current.Accepted
+	for _, r := range s.current.Rejected {
+		if len(s.summary.Rejected) == maxStreamRejections {
+			s.summary.RejectedTruncated = true
+			break
+		}
+		s.summary.Rejected = append(s.summary.Rejected, r)
+	}
+	if s.summary.Rejected == nil {
+		s.summary.Rejected = []streamRejection{}
+	}
+	s.current = streamAck{}
+	return true
+}
+
+// send writes a progress record and flushes it to the client
+func (s *eventStream) send(record streamAck) bool {
+	extendDeadline(s.rc.SetWriteDeadline, s.writeTimeout)
+	if record.Rejected == nil {
+		record.Rejected = []streamRejection{}
+	}
+	data, _ := json.Marshal(record)
+	if _, err := s.c.Writer.Write(append(data, '\n')); err != nil {
+		return false
+	}
+	return s.rc.Flush() == nil
+}
+
+// failStream ends a stream that failed after its last acknowledged line,
+// with a final progress record or, when progress is off, an error response
+func (h *Handler) failStream(s *eventStream, err error) {
+	appErr, ok := err.(*errors.AppError)
+	if !ok {
+		appErr = errors.ErrInternal("Failed to ingest the stream", err)
+	}
+	appErr.WithMeta(errors.MetaAckedThroughLine, s.acked)
+	if !s.progress {
+		extendDeadline(s.rc.SetWriteDeadline, s.writeTimeout)
+		s.c.Error(appErr)
+		s.c.Abort()
+		return
+	}
+
+	// The response has started, so the error handler cannot answer it
+	if appErr.Internal != nil {
+		h.logger.ErrorContext(s.c.Request.Context(), appErr.Message, "code", appErr.Code, "error", appErr.Internal)
+	}
+	s.send(streamAck{AckedThroughLine: s.acked, Error: appErr})
+}
+
+// extendDeadline moves a connection deadline timeout from now, or lifts it
+// when there is no timeout. Writers that cannot set one are left alone.
+func extendDeadline(set func(time.Time) error, timeout time.Duration) {
+	if timeout > 0 {
+		set(time.Now().Add(timeout))
+	} else {
+		set(time.Time{})
+	}
+}
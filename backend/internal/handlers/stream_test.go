@@ -0,0 +1,106 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/testsupport"
+)
+
+// TestStreamCutOffKeepsAcknowledgedLines sends a stream in progress mode,
+// reads the acknowledgement of the first two chunks, writes part of a third
+// and drops the connection. Exactly the acknowledged lines must be stored:
+// the third chunk was never committed.
+func TestStreamCutOffKeepsAcknowledgedLines(t *testing.T) {
+	const every = 10
+	s := testsupport.Start(t, func(cfg *config.Config) { cfg.Ingest.StreamAckEvery = every })
+
+	ctx, kill := context.WithCancel(context.Background())
+	defer kill()
+	body, producer := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL+"/api/v1/events/stream", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(s.App.Config.Auth.APIKeyHeader, s.Tenant.APIKey)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Accept", "application/x-ndjson")
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			producer.CloseWithError(err)
+			close(responses)
+			return
+		}
+		responses <- resp
+	}()
+
+	send := func(from, to int) {
+		t.Helper()
+		for n := from; n <= to; n++ {
+			line, _ := json.Marshal(models.EventRequest{
+				TenantID:  s.Tenant.ID,
+				EventType: "stream.line",
+				Timestamp: time.Now().UTC().Format(time.RFC3339),
+				Metadata:  []byte(fmt.Sprintf(`{"line":%d}`, n)),
+			})
+			if _, err := producer.Write(append(line, '\n')); err != nil {
+				t.Fatalf("write line %d: %v", n, err)
+			}
+		}
+	}
+
+	send(1, 2*every)
+	resp, ok := <-responses
+	if !ok {
+		t.Fatal("the stream was not answered")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	records := bufio.NewScanner(resp.Body)
+	acked := 0
+	for acked < 2*every && records.Scan() {
+		var record struct {
+			AckedThroughLine int `json:"acked_through_line"`
+			Accepted         int `json:"accepted"`
+		}
+		if err := json.Unmarshal(records.Bytes(), &record); err != nil {
+			t.Fatalf("progress record %q: %v", records.Text(), err)
+		}
+		if record.Accepted != every {
+			t.Fatalf("record %q accepted %d lines, want %d", records.Text(), record.Accepted, every)
+		}
+		acked = record.AckedThroughLine
+	}
+	if acked != 2*every {
+		t.Fatalf("acknowledged through line %d, want %d: %v", acked, 2*every, records.Err())
+	}
+
+	// Half a chunk the server reads but never acknowledges
+	send(2*every+1, 2*every+every/2)
+	kill()
+
+	// The handler drops the open chunk when the read fails; nothing may
+	// appear after the acknowledged lines in the meantime
+	for deadline := time.Now().Add(300 * time.Millisecond); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		var stored int64
+		if err := s.App.DB.DB.Model(&models.Event{}).Where("tenant_id = ?", s.Tenant.ID).Count(&stored).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stored != int64(acked) {
+			t.Fatalf("stored %d events, acknowledged %d", stored, acked)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+	// Zones are looked up in the embedded tz database, so ?tz= works the
+	// same on hosts and images without one
+	_ "time/tzdata"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/ingest"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestZone returns the zone named by ?tz=, UTC without one. Anything
+// but a tz database name, including "Local", is answered 400 and false.
+func requestZone(c *gin.Context) (*time.Location, bool) {
+	name := c.Query("tz")
+	if name == "" {
+		return time.UTC, true
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		c.Error(errors.ErrBadTimeZone(name))
+		c.Abort()
+		return nil, false
+	}
+	return loc, true
+}
+
+// renderZone returns the zone response times are given in: loc with
+// ?tz_render=true, otherwise nil, leaving them in UTC as stored. An invalid
+// value is answered 400 and false.
+func renderZone(c *gin.Context, loc *time.Location) (*time.Location, bool) {
+	render := c.Query("tz_render")
+	if render == "" {
+		return nil, true
+	}
+	on, err := strconv.ParseBool(render)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid tz_render parameter"))
+		c.Abort()
+		return nil, false
+	}
+	if !on {
+		return nil, true
+	}
+	return loc, true
+}
+
+// eventResponse converts an event for a response, with its times in zone
+// unless that is nil
+func eventResponse(e *models.Event, zone *time.Location) models.EventResponse {
+	if zone == nil {
+		return e.ToEventResponse()
+	}
+	return e.ToEventResponse().In(zone)
+}
+
+// responseZone combines requestZone and renderZone for handlers that only
+// render times
+func responseZone(c *gin.Context) (*time.Location, bool) {
+	loc, ok := requestZone(c)
+	if !ok {
+		return nil, false
+	}
+	return renderZone(c, loc)
+}
+
+// parseTimeParamIn parses an optional ISO8601 query parameter, taking one
+// without an offset to be in loc. The time is returned in UTC, as stored:
+// SQLite compares times as text.
+func parseTimeParamIn(c *gin.Context, name string, loc *time.Location) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := ingest.ParseTimestampIn(value, loc)
+	if err != nil {
+		return nil, err
+	}
+	t = t.UTC()
+	return &t, nil
+}
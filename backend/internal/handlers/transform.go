@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/ingest"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/transform"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTransformRules returns the rules that reshape the tenant's events
+// before they are stored
+func (h *Handler) GetTransformRules(c *gin.Context) {
+	tenantID, ok := ownTenant(c, "Tenants can only read their own transformation rules")
+	if !ok {
+		return
+	}
+	tenant, settings, ok := h.loadTenantSettings(c, tenantID)
+	if !ok {
+		return
+	}
+
+	rules := settings.TransformRules
+	if rules == nil {
+		rules = []models.TransformRule{}
+	}
+	setVersionTag(c, tenant.Version)
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "version": tenant.Version})
+}
+
+// SetTransformRules replaces the tenant's transformation rules. Like
+// redaction rules they are compiled before they are saved, an empty list
+// turns transformation off, and If-Match or version make the update
+// conditional on the tenant's version.
+func (h *Handler) SetTransformRules(c *gin.Context) {
+	tenantID, ok := ownTenant(c, "Tenants can only change their own transformation rules")
+	if !ok {
+		return
+	}
+
+	var req models.TransformRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	if _, err := transform.Compile(req.Rules, h.cfg.Ingest.TransformBudget); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	version, given, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+	if h.versionRequired(given) {
+		c.Error(errors.ErrVersionRequired("tenant"))
+		c.Abort()
+		return
+	}
+
+	tenant, settings, ok := h.loadTenantSettings(c, tenantID)
+	if !ok {
+		return
+	}
+	if version != 0 && tenant.Version != version {
+		c.Error(errors.ErrStaleVersion("tenant", tenant.Version))
+		c.Abort()
+		return
+	}
+	settings.TransformRules = req.Rules
+	updated, ok := h.saveTenantSettings(c, tenantID, settings, version)
+	if !ok {
+		return
+	}
+
+	names := make([]string, 0, len(req.Rules))
+	for _, rule := range req.Rules {
+		names = append(names, rule.Name)
+	}
+	h.recordAudit(c, "tenant.transform_rules.update", "tenant", tenantID, map[string]interface{}{
+		"rules":   names,
+		"version": updated,
+	})
+
+	setVersionTag(c, updated)
+	c.JSON(http.StatusOK, gin.H{"rules": req.Rules, "version": updated})
+}
+
+// PreviewTransform runs transformation rules over a sample event without
+// storing it: the rules given, or the tenant's own. Rules that would reject
+// the event are reported in error rather than failing the request.
+func (h *Handler) PreviewTransform(c *gin.Context) {
+	tenantID, ok := ownTenant(c, "Tenants can only preview their own transformation rules")
+	if !ok {
+		return
+	}
+
+	var req models.TransformPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	if err := ingest.ValidateEventType(req.EventType); err != nil {
+		c.Error(errors.ErrBadEventType(err.Error()).WithFields(err.(*ingest.ValidationError).FieldError()))
+		c.Abort()
+		return
+	}
+
+	rules := req.Rules
+	if rules == nil {
+		_, settings, ok := h.loadTenantSettings(c, tenantID)
+		if !ok {
+			return
+		}
+		rules = settings.TransformRules
+	}
+	transformer, err := transform.Compile(rules, h.cfg.Ingest.TransformBudget)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+
+	result, err := transformer.Apply(req.EventType, req.Metadata)
+	var ruleErr *transform.RuleError
+	if err != nil && !stderrors.As(err, &ruleErr) {
+		c.Error(errors.ErrBadMetadata("Metadata must be a valid JSON object"))
+		c.Abort()
+		return
+	}
+
+	if result.Applied == nil {
+		result.Applied = []string{}
+	}
+	if result.Skipped == nil {
+		result.Skipped = []transform.Failure{}
+	}
+	resp := gin.H{
+		"event_type": result.EventType,
+		"metadata":   json.RawMessage(result.Metadata),
+		"applied":    result.Applied,
+		"skipped":    result.Skipped,
+	}
+	if len(result.Metadata) == 0 {
+		resp["metadata"] = nil
+	}
+	if ruleErr != nil {
+		resp["error"] = ruleErr.Error()
+	} else if err := ingest.ValidateEventType(result.EventType); err != nil {
+		resp["error"] = "transformed " + err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
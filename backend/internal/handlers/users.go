@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/auth"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// dummyHash is compared against when a login names no user, so that the
+// response time does not reveal which emails exist
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// validRole reports whether role is one a user can have
+func validRole(role string) bool {
+	switch role {
+	case models.RoleAdmin, models.RoleDeveloper, models.RoleViewer:
+		return true
+	}
+	return false
+}
+
+// loadUser returns the :id user of the authenticated tenant
+func (h *Handler) loadUser(c *gin.Context) (*models.User, bool) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid user ID"))
+		c.Abort()
+		return nil, false
+	}
+
+	user, err := h.dbFor(c).GetUser(c.GetString("tenant_id"), uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrUserNotFound(idParam))
+		} else {
+			c.Error(errors.ErrDB("get user", err))
+		}
+		c.Abort()
+		return nil, false
+	}
+	return user, true
+}
+
+// CreateUser adds a user to the authenticated tenant
+func (h *Handler) CreateUser(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	if !validRole(req.Role) {
+		c.Error(errors.ErrInvalidRequest("role must be admin, developer or viewer"))
+		c.Abort()
+		return
+	}
+	if req.Password == "" && req.SSOSubject == "" {
+		c.Error(errors.ErrInvalidRequest("password or sso_subject is required"))
+		c.Abort()
+		return
+	}
+
+	user := &models.User{
+		TenantID:   tenantID,
+		Email:      strings.ToLower(req.Email),
+		SSOSubject: req.SSOSubject,
+		Role:       req.Role,
+		Active:     true,
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.Error(errors.ErrInternal("Failed to hash password", err))
+			c.Abort()
+			return
+		}
+		user.PasswordHash = string(hash)
+	}
+
+	db := h.dbFor(c)
+	if _, err := db.GetUserByEmail(tenantID, user.Email); err == nil {
+		c.Error(errors.ErrUserExists(user.Email))
+		c.Abort()
+		return
+	} else if err != gorm.ErrRecordNotFound {
+		c.Error(errors.ErrDB("check existing user", err))
+		c.Abort()
+		return
+	}
+
+	if err := db.CreateUser(user); err != nil {
+		// A concurrent create may have won the unique index
+		if db.IsUniqueViolation(err) {
+			c.Error(errors.ErrUserExists(user.Email))
+		} else {
+			c.Error(errors.ErrDB("create user", err))
+		}
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "user.create", "user", strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+		"email": user.Email,
+		"role":  user.Role,
+	})
+
+	c.JSON(http.StatusCreated, user.ToUserResponse())
+}
+
+// ListUsers returns the authenticated tenant's users
+func (h *Handler) ListUsers(c *gin.Context) {
+	users, err := h.dbFor(c).ListUsers(c.GetString("tenant_id"))
+	if err != nil {
+		c.Error(errors.ErrDB("list users", err))
+		c.Abort()
+		return
+	}
+
+	response := make([]models.UserResponse, 0, len(users))
+	for _, user := range users {
+		response = append(response, user.ToUserResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": response})
+}
+
+// GetUser returns one of the authenticated tenant's users
+func (h *Handler) GetUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, user.ToUserResponse())
+}
+
+// UpdateUser changes a user's password, SSO subject, role or active flag.
+// Users cannot change their own role or deactivate themselves, so a tenant
+// admin cannot lock themselves out by mistake.
+func (h *Handler) UpdateUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+
+	self := auth.GetUserIDFromContext(c) == user.ID
+	details := map[string]interface{}{"email": user.Email}
+
+	if req.Role != nil && *req.Role != user.Role {
+		if !validRole(*req.Role) {
+			c.Error(errors.ErrInvalidRequest("role must be admin, developer or viewer"))
+			c.Abort()
+			return
+		}
+		if self {
+			c.Error(errors.ErrForbidden("Users cannot change their own role"))
+			c.Abort()
+			return
+		}
+		details["previous_role"] = user.Role
+		details["role"] = *req.Role
+		user.Role = *req.Role
+	}
+	if req.Active != nil && *req.Active != user.Active {
+		if self {
+			c.Error(errors.ErrForbidden("Users cannot deactivate themselves"))
+			c.Abort()
+			return
+		}
+		details["active"] = *req.Active
+		user.Active = *req.Active
+	}
+	if req.SSOSubject != nil {
+		user.SSOSubject = *req.SSOSubject
+	}
+	if req.Password != nil {
+		hash, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.Error(errors.ErrInternal("Failed to hash password", err))
+			c.Abort()
+			return
+		}
+		user.PasswordHash = string(hash)
+		details["password_changed"] = true
+	}
+	if user.PasswordHash == "" && user.SSOSubject == "" {
+		c.Error(errors.ErrInvalidRequest("A user needs a password or an sso_subject"))
+		c.Abort()
+		return
+	}
+
+	if err := h.dbFor(c).UpdateUser(user); err != nil {
+		c.Error(errors.ErrDB("update user", err))
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "user.update", "user", strconv.FormatUint(uint64(user.ID), 10), details)
+
+	c.JSON(http.StatusOK, user.ToUserResponse())
+}
+
+// DeleteUser removes one of the authenticated tenant's users. Their tokens
+// stop working at once.
+func (h *Handler) DeleteUser(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	idParam := c.Param("id")
+
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid user ID"))
+		c.Abort()
+		return
+	}
+	if uint(id) == auth.GetUserIDFromContext(c) {
+		c.Error(errors.ErrForbidden("Users cannot delete themselves"))
+		c.Abort()
+		return
+	}
+
+	if err := h.dbFor(c).DeleteUser(tenantID, uint(id)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrUserNotFound(idParam))
+		} else {
+			c.Error(errors.ErrDB("delete user", err))
+		}
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "user.delete", "user", idParam, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// Login signs a user in with their email and password and issues a token
+// scoped to their tenant and role
+func (h *Handler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	if _, err := uuid.Parse(req.TenantID); err != nil {
+		c.Error(errors.ErrBadTenantID("Invalid UUID format"))
+		c.Abort()
+		return
+	}
+
+	db := h.dbFor(c)
+	user, err := db.GetUserByEmail(req.TenantID, strings.ToLower(req.Email))
+	if err != nil && err != gorm.ErrRecordNotFound {
+		c.Error(errors.ErrDB("get user", err))
+		c.Abort()
+		return
+	}
+
+	hash := dummyHash
+	if user != nil && user.PasswordHash != "" {
+		hash = []byte(user.PasswordHash)
+	}
+	matched := bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) == nil
+	if user == nil || user.PasswordHash == "" || !user.Active || !matched {
+		c.Error(errors.ErrUnauthorized("Invalid email or password"))
+		c.Abort()
+		return
+	}
+
+	tenant, err := db.GetTenantByID(user.TenantID)
+	if err != nil || !tenant.Active {
+		c.Error(errors.ErrUnauthorized("Invalid email or password"))
+		c.Abort()
+		return
+	}
+
+	token, err := h.auth.GenerateUserJWT(user)
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to generate token", err))
+		c.Abort()
+		return
+	}
+
+	now := time.Now().UTC()
+	if err := db.RecordUserLogin(user.ID, now); err != nil {
+		h.logger.WarnContext(c.Request.Context(), "Failed to record login", "user_id", user.ID, "error", err)
+	}
+	user.LastLoginAt = &now
+
+	c.Set("tenant_id", user.TenantID)
+	c.Set("user_id", user.ID)
+	h.recordAudit(c, "user.login", "user", strconv.FormatUint(uint64(user.ID), 10), nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_in": int(h.auth.JWTExpiry().Seconds()),
+		"user":       user.ToUserResponse(),
+	})
+}
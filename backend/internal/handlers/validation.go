@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"reflect"
+	"strings"
+
+	"event-ingestion-system/internal/errors"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Name fields in validation errors as clients send them
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// invalidRequest converts a binding or validation failure into a response
+// that lists the invalid fields, without Go type names. Errors it cannot
+// attribute to a field, such as malformed JSON, keep their message.
+func invalidRequest(err error) *errors.AppError {
+	var (
+		rules   validator.ValidationErrors
+		typeErr *json.UnmarshalTypeError
+		own     *ValidationError
+	)
+	switch {
+	case stderrors.As(err, &rules):
+		fields := make([]errors.FieldError, len(rules))
+		for i, fe := range rules {
+			message, key, param := ruleMessage(fe)
+			fields[i] = errors.FieldError{
+				Field: fieldPath(fe.Namespace()), Rule: fe.Tag(), Message: message,
+				Key: key, Params: map[string]string{"param": param},
+			}
+		}
+		return errors.ErrValidation(fields)
+	case stderrors.As(err, &typeErr) && typeErr.Field != "":
+		name, key := jsonType(typeErr.Type)
+		return errors.ErrValidation([]errors.FieldError{{
+			Field: typeErr.Field, Rule: "type", Message: "must be " + name, Key: key,
+		}})
+	case stderrors.As(err, &own):
+		return errors.ErrValidation([]errors.FieldError{{Field: own.Field, Rule: own.Rule, Message: own.Message}})
+	}
+	return errors.ErrInvalidRequest(err.Error())
+}
+
+// fieldPath drops the struct name validator puts first in a namespace
+func fieldPath(namespace string) string {
+	if _, path, ok := strings.Cut(namespace, "."); ok {
+		return path
+	}
+	return namespace
+}
+
+// ruleMessage describes a failed validator rule in English, and returns
+// the catalog key that translates the description and the value of its
+// {param}
+func ruleMessage(fe validator.FieldError) (message, key, param string) {
+	param = fe.Param()
+	switch fe.Tag() {
+	case "required":
+		return "is required", "required", param
+	case "uuid", "uuid4":
+		return "must be a valid UUID", "uuid", param
+	case "email":
+		return "must be a valid email address", "email", param
+	case "url", "http_url":
+		return "must be a valid URL", "url", param
+	case "oneof":
+		param = strings.Join(strings.Fields(param), ", ")
+		return "must be one of: " + param, "oneof", param
+	case "min", "max", "len":
+		bound := map[string]string{"min": "at least ", "max": "at most ", "len": "exactly "}[fe.Tag()]
+		switch fe.Kind() {
+		case reflect.String:
+			return "must be " + bound + param + " characters", fe.Tag() + ".string", param
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return "must have " + bound + param + " items", fe.Tag() + ".items", param
+		}
+		return "must be " + bound + param, fe.Tag(), param
+	case "gt":
+		return "must be greater than " + param, "gt", param
+	case "gte":
+		return "must be at least " + param, "gte", param
+	case "lt":
+		return "must be less than " + param, "lt", param
+	case "lte":
+		return "must be at most " + param, "lte", param
+	}
+	return "failed the " + fe.Tag() + " rule", "rule", fe.Tag()
+}
+
+// jsonType names a Go type as the JSON value it decodes from, and returns
+// the catalog key of "must be" that value
+func jsonType(t reflect.Type) (name, key string) {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string", "type.string"
+	case reflect.Bool:
+		return "a boolean", "type.boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer", "type.integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number", "type.number"
+	case reflect.Slice, reflect.Array:
+		return "an array", "type.array"
+	case reflect.Map, reflect.Struct:
+		return "an object", "type.object"
+	}
+	return "a " + t.String(), ""
+}
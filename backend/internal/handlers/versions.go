@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"strconv"
+	"strings"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// expectedVersion reads the version an update is conditioned on, from the
+// If-Match header or else the body's version field. given is false when
+// neither was sent; If-Match: * is given without a version, an explicit
+// last write wins. ok is false once an error has been reported.
+func expectedVersion(c *gin.Context, body *int64) (version int64, given, ok bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		if body == nil {
+			return 0, false, true
+		}
+		return *body, true, true
+	}
+	if header == "*" {
+		return 0, true, true
+	}
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version < 1 {
+		c.Error(errors.ErrInvalidRequest(`If-Match must be a version such as "3"`))
+		c.Abort()
+		return 0, false, false
+	}
+	if body != nil && *body != version {
+		c.Error(errors.ErrInvalidRequest("If-Match and version name different versions"))
+		c.Abort()
+		return 0, false, false
+	}
+	return version, true, true
+}
+
+// versionRequired reports whether an update that names no version must be
+// rejected, per app.missing_version
+func (h *Handler) versionRequired(given bool) bool {
+	return !given && h.cfg.App.MissingVersion == "reject"
+}
+
+// setVersionTag sets the ETag that If-Match takes back
+func setVersionTag(c *gin.Context, version int64) {
+	c.Header("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+// staleVersion returns the conflict for err when it is a stale version
+func staleVersion(err error, resource string) (*errors.AppError, bool) {
+	var stale *database.StaleVersionError
+	if !stderrors.As(err, &stale) {
+		return nil, false
+	}
+	return errors.ErrStaleVersion(resource, stale.Current), true
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/views"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// findView looks up one of the tenant's saved views by ID or, when ref is
+// not a number, by name
+func findView(c *gin.Context, db *database.Database, tenantID, ref string) (*models.SavedView, bool) {
+	var view *models.SavedView
+	var err error
+	if id, parseErr := strconv.ParseUint(ref, 10, 32); parseErr == nil {
+		view, err = db.GetSavedView(tenantID, uint(id))
+	} else {
+		view, err = db.GetSavedViewByName(tenantID, ref)
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrViewNotFound(ref))
+		} else {
+			c.Error(errors.ErrDB("get view", err))
+		}
+		c.Abort()
+		return nil, false
+	}
+	return view, true
+}
+
+// bindView parses and validates a saved view request
+func bindView(c *gin.Context) (models.SavedViewRequest, string, bool) {
+	var req models.SavedViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return req, "", false
+	}
+	if err := views.ValidateName(req.Name); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return req, "", false
+	}
+	if err := views.Validate(req.Filter); err != nil {
+		c.Error(errors.ErrInvalidRequest("filter." + err.Error()))
+		c.Abort()
+		return req, "", false
+	}
+
+	encoded, err := json.Marshal(req.Filter)
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to encode view filter", err))
+		c.Abort()
+		return req, "", false
+	}
+	return req, string(encoded), true
+}
+
+// nameTaken reports whether another of the tenant's views has the name
+func nameTaken(db *database.Database, tenantID, name string, id uint) (bool, error) {
+	existing, err := db.GetSavedViewByName(tenantID, name)
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return existing.ID != id, nil
+}
+
+// CreateView saves a named event filter for the authenticated tenant
+func (h *Handler) CreateView(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	req, filter, ok := bindView(c)
+	if !ok {
+		return
+	}
+
+	db := h.dbFor(c)
+	taken, err := nameTaken(db, tenantID, req.Name, 0)
+	if err != nil {
+		c.Error(errors.ErrDB("check existing view", err))
+		c.Abort()
+		return
+	}
+	if taken {
+		c.Error(errors.ErrViewExists(req.Name))
+		c.Abort()
+		return
+	}
+
+	view := &models.SavedView{TenantID: tenantID, Name: req.Name, Filter: filter}
+	if err := db.CreateSavedView(view); err != nil {
+		// A concurrent create may have won the unique index
+		if db.IsUniqueViolation(err) {
+			c.Error(errors.ErrViewExists(req.Name))
+		} else {
+			c.Error(errors.ErrDB("create view", err))
+		}
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "view.create", "view", strconv.FormatUint(uint64(view.ID), 10), map[string]interface{}{"name": view.Name})
+
+	c.JSON(http.StatusCreated, view.ToSavedViewResponse())
+}
+
+// ListViews returns the authenticated tenant's saved views
+func (h *Handler) ListViews(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+
+	saved, err := h.dbFor(c).ListSavedViews(tenantID)
+	if err != nil {
+		c.Error(errors.ErrDB("list views", err))
+		c.Abort()
+		return
+	}
+
+	response := make([]models.SavedViewResponse, 0, len(saved))
+	for _, v := range saved {
+		response = append(response, v.ToSavedViewResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"views": response})
+}
+
+// GetView returns one saved view, by ID or name
+func (h *Handler) GetView(c *gin.Context) {
+	view, ok := findView(c, h.dbFor(c), c.GetString("tenant_id"), c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, view.ToSavedViewResponse())
+}
+
+// UpdateView replaces the name and filter of a saved view
+func (h *Handler) UpdateView(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	db := h.dbFor(c)
+
+	view, ok := findView(c, db, tenantID, c.Param("id"))
+	if !ok {
+		return
+	}
+	req, filter, ok := bindView(c)
+	if !ok {
+		return
+	}
+
+	if req.Name != view.Name {
+		taken, err := nameTaken(db, tenantID, req.Name, view.ID)
+		if err != nil {
+			c.Error(errors.ErrDB("check existing view", err))
+			c.Abort()
+			return
+		}
+		if taken {
+			c.Error(errors.ErrViewExists(req.Name))
+			c.Abort()
+			return
+		}
+	}
+
+	previous := view.Name
+	view.Name = req.Name
+	view.Filter = filter
+	if err := db.UpdateSavedView(view); err != nil {
+		if taken, _ := nameTaken(db, tenantID, req.Name, view.ID); taken {
+			c.Error(errors.ErrViewExists(req.Name))
+		} else {
+			c.Error(errors.ErrDB("update view", err))
+		}
+		c.Abort()
+		return
+	}
+
+	details := map[string]interface{}{"name": view.Name}
+	if previous != view.Name {
+		details["previous_name"] = previous
+	}
+	h.recordAudit(c, "view.update", "view", strconv.FormatUint(uint64(view.ID), 10), details)
+
+	c.JSON(http.StatusOK, view.ToSavedViewResponse())
+}
+
+// DeleteView removes a saved view
+func (h *Handler) DeleteView(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	db := h.dbFor(c)
+
+	view, ok := findView(c, db, tenantID, c.Param("id"))
+	if !ok {
+		return
+	}
+	if err := db.DeleteSavedView(tenantID, view.ID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrViewNotFound(c.Param("id")))
+		} else {
+			c.Error(errors.ErrDB("delete view", err))
+		}
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "view.delete", "view", strconv.FormatUint(uint64(view.ID), 10), map[string]interface{}{"name": view.Name})
+
+	c.Status(http.StatusNoContent)
+}
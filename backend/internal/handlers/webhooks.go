@@ -0,0 +1,556 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/eventtype"
+	"event-ingestion-system/internal/flags"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/views"
+	"event-ingestion-system/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateWebhook registers a webhook for the authenticated tenant. The signing
+// secret is only returned in this response.
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+
+	var req models.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+
+	eventTypes, encoded, appErr := webhookEventTypes(req.EventTypes)
+	if appErr != nil {
+		c.Error(appErr)
+		c.Abort()
+		return
+	}
+	if _, _, err := webhook.ParseTimeouts(req.Timeout, req.ConnectTimeout); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	if !h.checkTargetURL(c, req.URL) {
+		return
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to generate webhook secret", err))
+		c.Abort()
+		return
+	}
+
+	wh := &models.Webhook{
+		TenantID:       tenantID,
+		URL:            req.URL,
+		Secret:         secret,
+		EventTypes:     encoded,
+		Active:         true,
+		Version:        1,
+		PayloadVersion: payloadVersion(c, req.PayloadVersion),
+		Timeout:        req.Timeout,
+		ConnectTimeout: req.ConnectTimeout,
+	}
+	if err := h.dbFor(c).CreateWebhook(wh); err != nil {
+		c.Error(errors.ErrDB("create webhook", err))
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "webhook.create", "webhook", strconv.FormatUint(uint64(wh.ID), 10), map[string]interface{}{
+		"url":             wh.URL,
+		"event_types":     eventTypes,
+		"payload_version": wh.PayloadVersion,
+		"timeout":         wh.Timeout,
+		"connect_timeout": wh.ConnectTimeout,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": wh.ToWebhookResponse(),
+		"secret":  secret,
+	})
+}
+
+// PutWebhook creates or updates the authenticated tenant's webhook with the
+// name in the path, so applying the same definition again changes nothing.
+// A created webhook is answered 201 with its signing secret; an updated one
+// keeps its ID and secret and is answered 200. If-Match or version only
+// update the webhook while it is at that version.
+func (h *Handler) PutWebhook(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	name := c.Param("name")
+	if err := views.ValidateName(name); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+
+	var req models.UpsertWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	eventTypes, encoded, appErr := webhookEventTypes(req.EventTypes)
+	if appErr != nil {
+		c.Error(appErr)
+		c.Abort()
+		return
+	}
+	if _, _, err := webhook.ParseTimeouts(req.Timeout, req.ConnectTimeout); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	if !h.checkTargetURL(c, req.URL) {
+		return
+	}
+	version, given, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		c.Error(errors.ErrInternal("Failed to generate webhook secret", err))
+		c.Abort()
+		return
+	}
+
+	wh := &models.Webhook{
+		TenantID:       tenantID,
+		Name:           &name,
+		URL:            req.URL,
+		Secret:         secret,
+		EventTypes:     encoded,
+		Active:         req.Active == nil || *req.Active,
+		Version:        1,
+		PayloadVersion: payloadVersion(c, req.PayloadVersion),
+		Timeout:        req.Timeout,
+		ConnectTimeout: req.ConnectTimeout,
+	}
+	db := h.dbFor(c)
+	var created bool
+	switch {
+	case version != 0:
+		err = db.UpdateWebhook(wh, version)
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrNamedWebhookNotFound(name))
+			c.Abort()
+			return
+		}
+	case h.versionRequired(given):
+		// Without a version the webhook may only be created
+		active := wh.Active
+		created, err = true, db.CreateWebhook(wh)
+		if err != nil && db.IsUniqueViolation(err) {
+			c.Error(errors.ErrVersionRequired("webhook"))
+			c.Abort()
+			return
+		}
+		// Create writes the column's default of true for a false Active
+		if err == nil && !active {
+			wh.Active = false
+			err = db.SetWebhookActive(wh.ID, false)
+		}
+	default:
+		created, err = db.UpsertWebhook(wh)
+	}
+	if err != nil {
+		if appErr, ok := staleVersion(err, "webhook"); ok {
+			c.Error(appErr)
+		} else {
+			c.Error(errors.ErrDB("save webhook", err))
+		}
+		c.Abort()
+		return
+	}
+
+	action := "webhook.update"
+	if created {
+		action = "webhook.create"
+	}
+	h.recordAudit(c, action, "webhook", strconv.FormatUint(uint64(wh.ID), 10), map[string]interface{}{
+		"name":            name,
+		"url":             wh.URL,
+		"event_types":     eventTypes,
+		"active":          wh.Active,
+		"version":         wh.Version,
+		"payload_version": wh.PayloadVersion,
+		"timeout":         wh.Timeout,
+		"connect_timeout": wh.ConnectTimeout,
+	})
+
+	setVersionTag(c, wh.Version)
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"webhook": wh.ToWebhookResponse()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": wh.ToWebhookResponse(),
+		"secret":  secret,
+	})
+}
+
+// webhookEventTypes validates a webhook's event types and returns them,
+// never nil, with their JSON encoding
+func webhookEventTypes(types []string) ([]string, string, *errors.AppError) {
+	for _, t := range types {
+		if err := eventtype.Validate(t); err != nil {
+			return nil, "", errors.ErrBadEventType(err.Error())
+		}
+	}
+	if types == nil {
+		types = []string{}
+	}
+	encoded, _ := json.Marshal(types)
+	return types, string(encoded), nil
+}
+
+// checkTargetURL refuses a delivery URL aimed at a blocked address, such
+// as a private IP or localhost, reporting whether it may be used
+func (h *Handler) checkTargetURL(c *gin.Context, url string) bool {
+	if err := h.webhooks.CheckURL(url); err != nil {
+		c.Error(errors.ErrInvalidRequest("url: " + err.Error()))
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// GetWebhooks returns the authenticated tenant's webhooks
+func (h *Handler) GetWebhooks(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+
+	webhooks, err := h.dbFor(c).ListWebhooks(tenantID)
+	if err != nil {
+		c.Error(errors.ErrDB("get webhooks", err))
+		c.Abort()
+		return
+	}
+
+	response := make([]models.WebhookResponse, 0, len(webhooks))
+	for _, wh := range webhooks {
+		response = append(response, wh.ToWebhookResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": response})
+}
+
+// DeleteWebhook removes one of the authenticated tenant's webhooks
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	idParam := c.Param("id")
+
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid webhook ID"))
+		c.Abort()
+		return
+	}
+
+	if err := h.dbFor(c).DeleteWebhook(tenantID, uint(id)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrWebhookNotFound(idParam))
+			c.Abort()
+			return
+		}
+		c.Error(errors.ErrDB("delete webhook", err))
+		c.Abort()
+		return
+	}
+
+	h.recordAudit(c, "webhook.delete", "webhook", idParam, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// TestWebhook sends a signed test payload to one of the tenant's webhooks
+// and reports whether the endpoint accepted it. A failed delivery is a
+// result, not an API error.
+func (h *Handler) TestWebhook(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+	idParam := c.Param("id")
+
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		c.Error(errors.ErrInvalidRequest("Invalid webhook ID"))
+		c.Abort()
+		return
+	}
+
+	wh, err := h.dbFor(c).GetWebhook(tenantID, uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Error(errors.ErrWebhookNotFound(idParam))
+			c.Abort()
+			return
+		}
+		c.Error(errors.ErrDB("get webhook", err))
+		c.Abort()
+		return
+	}
+
+	start := time.Now()
+	response := gin.H{"webhook_id": wh.ID, "delivered": true}
+	if err := h.webhooks.Test(c.Request.Context(), *wh); err != nil {
+		response["delivered"] = false
+		response["status"] = webhook.Status(err)
+		response["error"] = err.Error()
+	}
+	response["duration_ms"] = time.Since(start).Milliseconds()
+
+	c.JSON(http.StatusOK, response)
+}
+
+// maxBulkWebhooks bounds the webhooks one bulk request may change, and the
+// tenants a template may be applied to at once
+const maxBulkWebhooks = 1000
+
+// bulkWebhookStatus is the result status of a webhook a bulk action changed
+var bulkWebhookStatus = map[string]string{
+	models.WebhookActionPause:  "paused",
+	models.WebhookActionResume: "resumed",
+	models.WebhookActionDelete: "deleted",
+}
+
+// ChangeWebhooksBulk pauses, resumes or deletes the webhooks of any tenant
+// matching a URL pattern, a list of tenants or both, in one transaction,
+// and reports what became of each. A paused webhook's deliveries are held
+// until it is resumed, then delivered in order.
+func (h *Handler) ChangeWebhooksBulk(c *gin.Context) {
+	var req models.BulkWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		c.Abort()
+		return
+	}
+	if req.URLPattern == "" && len(req.TenantIDs) == 0 {
+		c.Error(errors.ErrInvalidRequest("Select the webhooks with url_pattern, tenant_ids or both"))
+		c.Abort()
+		return
+	}
+	if len(req.TenantIDs) > maxBulkWebhooks {
+		c.Error(errors.ErrInvalidRequest(fmt.Sprintf("At most %d tenant_ids may be given, got %d", maxBulkWebhooks, len(req.TenantIDs))))
+		c.Abort()
+		return
+	}
+
+	sel := database.WebhookSelector{URLPattern: req.URLPattern, TenantIDs: req.TenantIDs}
+	changes, err := h.dbFor(c).ChangeWebhooks(sel, req.Action, time.Now().UTC(), maxBulkWebhooks)
+	if err != nil {
+		if err == database.ErrTooManyWebhooks {
+			c.Error(errors.ErrInvalidRequest(fmt.Sprintf("More than %d webhooks match; narrow url_pattern or tenant_ids", maxBulkWebhooks)))
+		} else {
+			c.Error(errors.ErrDB("change webhooks", err))
+		}
+		c.Abort()
+		return
+	}
+
+	results := make([]models.BulkWebhookResult, 0, len(changes))
+	var resumed []string
+	seen := make(map[string]bool)
+	changed := 0
+	for _, change := range changes {
+		wh := change.Webhook
+		result := models.BulkWebhookResult{WebhookID: wh.ID, TenantID: wh.TenantID, URL: wh.URL, Status: "unchanged"}
+		if change.Changed {
+			result.Status = bulkWebhookStatus[req.Action]
+			changed++
+			h.recordAudit(c, "webhook."+req.Action, "webhook", strconv.FormatUint(uint64(wh.ID), 10), map[string]interface{}{
+				"tenant_id": wh.TenantID,
+				"url":       wh.URL,
+				"bulk":      true,
+			})
+			if req.Action == models.WebhookActionResume && !seen[wh.TenantID] {
+				seen[wh.TenantID] = true
+				resumed = append(resumed, wh.TenantID)
+			}
+		}
+		results = append(results, result)
+	}
+	h.webhooks.Resume(resumed...)
+
+	c.JSON(http.StatusOK, gin.H{
+		"action":  req.Action,
+		"matched": len(results),
+		"changed": changed,
+		"results": results,
+	})
+}
+
+// CreateWebhooksFromTemplate creates the same webhook for each of a list
+// of tenants, each with its own signing secret shown only in this
+// response. Tenants that do not exist, or already have a webhook of the
+// template's name, are reported and skipped; the rest get theirs in one
+// transaction, all or none.
+func (h *Handler) CreateWebhooksFromTemplate(c *gin.Context) {
+	var req models.WebhookTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		c.Abort()
+		return
+	}
+	if len(req.TenantIDs) > maxBulkWebhooks {
+		c.Error(errors.ErrInvalidRequest(fmt.Sprintf("At most %d tenant_ids may be given, got %d", maxBulkWebhooks, len(req.TenantIDs))))
+		c.Abort()
+		return
+	}
+	if req.Name != "" {
+		if err := views.ValidateName(req.Name); err != nil {
+			c.Error(errors.ErrInvalidRequest("name: " + err.Error()))
+			c.Abort()
+			return
+		}
+	}
+	template := req.Webhook
+	eventTypes, encoded, appErr := webhookEventTypes(template.EventTypes)
+	if appErr != nil {
+		c.Error(appErr)
+		c.Abort()
+		return
+	}
+	if _, _, err := webhook.ParseTimeouts(template.Timeout, template.ConnectTimeout); err != nil {
+		c.Error(errors.ErrInvalidRequest(err.Error()))
+		c.Abort()
+		return
+	}
+	if !h.checkTargetURL(c, template.URL) {
+		return
+	}
+
+	// A tenant listed twice gets one webhook
+	tenantIDs := make([]string, 0, len(req.TenantIDs))
+	listed := make(map[string]bool, len(req.TenantIDs))
+	for _, id := range req.TenantIDs {
+		if !listed[id] {
+			listed[id] = true
+			tenantIDs = append(tenantIDs, id)
+		}
+	}
+
+	db := h.dbFor(c)
+	exists, err := db.FindTenantIDs(tenantIDs)
+	if err != nil {
+		c.Error(errors.ErrDB("check tenants", err))
+		c.Abort()
+		return
+	}
+	taken := map[string]bool{}
+	var name *string
+	if req.Name != "" {
+		name = &req.Name
+		if taken, err = db.FindWebhookName(tenantIDs, req.Name); err != nil {
+			c.Error(errors.ErrDB("check existing webhooks", err))
+			c.Abort()
+			return
+		}
+	}
+
+	results := make([]models.WebhookTemplateResult, len(tenantIDs))
+	create := make([]models.Webhook, 0, len(tenantIDs))
+	for i, tenantID := range tenantIDs {
+		results[i] = models.WebhookTemplateResult{TenantID: tenantID}
+		switch {
+		case !exists[tenantID]:
+			results[i].Status, results[i].Error = "not_found", errors.ErrTenantNotFound(tenantID)
+			continue
+		case taken[tenantID]:
+			results[i].Status, results[i].Error = "conflict", errors.ErrWebhookExists(req.Name)
+			continue
+		}
+		secret, err := generateSecret()
+		if err != nil {
+			c.Error(errors.ErrInternal("Failed to generate webhook secret", err))
+			c.Abort()
+			return
+		}
+		create = append(create, models.Webhook{
+			TenantID:       tenantID,
+			Name:           name,
+			URL:            template.URL,
+			Secret:         secret,
+			EventTypes:     encoded,
+			Active:         true,
+			Version:        1,
+			PayloadVersion: models.PayloadVersionOrDefault(template.PayloadVersion),
+			Timeout:        template.Timeout,
+			ConnectTimeout: template.ConnectTimeout,
+		})
+	}
+	if len(create) > 0 {
+		if err := db.CreateWebhooks(create); err != nil {
+			if db.IsUniqueViolation(err) {
+				// A webhook of the name was created since the check
+				c.Error(errors.ErrWebhookExists(req.Name))
+			} else {
+				c.Error(errors.ErrDB("create webhooks", err))
+			}
+			c.Abort()
+			return
+		}
+	}
+
+	created := make(map[string]*models.Webhook, len(create))
+	for i := range create {
+		created[create[i].TenantID] = &create[i]
+	}
+	counts := map[string]int{}
+	for i := range results {
+		if wh := created[results[i].TenantID]; wh != nil {
+			response := wh.ToWebhookResponse()
+			results[i].Status, results[i].Webhook, results[i].Secret = "created", &response, wh.Secret
+			h.recordAudit(c, "webhook.create", "webhook", strconv.FormatUint(uint64(wh.ID), 10), map[string]interface{}{
+				"tenant_id":       wh.TenantID,
+				"name":            req.Name,
+				"url":             wh.URL,
+				"event_types":     eventTypes,
+				"payload_version": wh.PayloadVersion,
+				"template":        true,
+			})
+		}
+		counts[results[i].Status]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"created":   counts["created"],
+		"conflicts": counts["conflict"],
+		"not_found": counts["not_found"],
+		"results":   results,
+	})
+}
+
+// generateSecret returns a random hex-encoded webhook signing secret
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// payloadVersion returns the payload version a webhook request asks for.
+// Without one it is version 2 for tenants with the payload_v2 flag and
+// version 1 for the others.
+func payloadVersion(c *gin.Context, requested int) int {
+	if requested == 0 && flags.IsEnabled(c.Request.Context(), flags.PayloadV2) {
+		return models.PayloadV2
+	}
+	return models.PayloadVersionOrDefault(requested)
+}
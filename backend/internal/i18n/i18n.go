@@ -0,0 +1,174 @@
+// Package i18n translates the message, details and field messages of API
+// errors into the language a client asks for with Accept-Language. English
+// is written in the errors package itself and stays the source of truth;
+// the catalogs in locales/ hold the other languages, keyed by:
+//
+//	messages   the error code
+//	details    the AppError's DetailsKey
+//	fields     the FieldError's Key
+//
+// Entries may use the {placeholders} named by the error's Params. A
+// missing or empty entry falls back to the base language, "de" for
+// "de-AT", and then to English, so a partial catalog never blanks a
+// message. Codes and the response structure are never translated.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"event-ingestion-system/internal/errors"
+)
+
+// Default is the language errors are written in
+const Default = "en"
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// catalog holds one language's translations
+type catalog struct {
+	Messages map[string]string `json:"messages"`
+	Details  map[string]string `json:"details"`
+	Fields   map[string]string `json:"fields"`
+}
+
+// catalogs maps a lowercase language tag to its translations
+var catalogs = load()
+
+func load() map[string]*catalog {
+	files, err := fs.Glob(locales, "locales/*.json")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]*catalog, len(files))
+	for _, file := range files {
+		data, err := locales.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		var c catalog
+		if err := json.Unmarshal(data, &c); err != nil {
+			panic("i18n: " + file + ": " + err.Error())
+		}
+		loaded[strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))] = &c
+	}
+	return loaded
+}
+
+// Negotiate picks the language for an Accept-Language header: the
+// supported one the client weights highest, a regional tag matching its
+// base language, or Default
+func Negotiate(acceptLanguage string) string {
+	type choice struct {
+		tag string
+		q   float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && q > 0 {
+			choices = append(choices, choice{tag, q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+
+	for _, c := range choices {
+		if c.tag == "*" {
+			return Default
+		}
+		for tag := c.tag; tag != ""; tag = parent(tag) {
+			if tag == Default || catalogs[tag] != nil {
+				return tag
+			}
+		}
+	}
+	return Default
+}
+
+// parent drops a tag's last subtag: "de-at" becomes "de", "de" nothing
+func parent(tag string) string {
+	if i := strings.LastIndexByte(tag, '-'); i > 0 {
+		return tag[:i]
+	}
+	return ""
+}
+
+// Localize returns a copy of err translated into the language, or err
+// itself for Default
+func Localize(err *errors.AppError, language string) *errors.AppError {
+	language = strings.ToLower(language)
+	if err == nil || language == Default {
+		return err
+	}
+
+	localized := *err
+	localized.Message = lookup(language, func(c *catalog) string { return c.Messages[string(err.Code)] }, err.Message, nil)
+	if err.DetailsKey != "" {
+		localized.Details = lookup(language, func(c *catalog) string { return c.Details[err.DetailsKey] }, err.Details, err.Params)
+	}
+	if len(err.Fields) > 0 {
+		localized.Fields = make([]errors.FieldError, len(err.Fields))
+		for i, f := range err.Fields {
+			if f.Key != "" {
+				key := f.Key
+				f.Message = lookup(language, func(c *catalog) string { return c.Fields[key] }, f.Message, f.Params)
+			}
+			localized.Fields[i] = f
+		}
+		// Details repeats the fields of a validation error; keep it in step
+		if err.DetailsKey == "" && err.Details == fieldList(err.Fields) {
+			localized.Details = fieldList(localized.Fields)
+		}
+	}
+	return &localized
+}
+
+// lookup finds an entry in the language's catalog or its base language's,
+// falling back to the English text, and fills in its placeholders
+func lookup(language string, entry func(*catalog) string, english string, params map[string]string) string {
+	for tag := language; tag != ""; tag = parent(tag) {
+		c := catalogs[tag]
+		if c == nil {
+			continue
+		}
+		if text := entry(c); text != "" {
+			return fill(text, params)
+		}
+	}
+	return english
+}
+
+// fill replaces each {name} with its parameter
+func fill(text string, params map[string]string) string {
+	if len(params) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// fieldList joins fields as errors.ErrValidation does for Details
+func fieldList(fields []errors.FieldError) string {
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,352 @@
+// Package importer loads tenant export archives back in: the tenant's
+// saved views, its webhooks, inactive and with a new secret, and its events
+// with their original timestamps and sequence numbers under new IDs. Events
+// are written straight to the database, so imports neither notify
+// WebSocket subscribers nor trigger webhooks, sinks or alerts. Each batch is
+// committed with the number of archive lines it covers, so an interrupted
+// or failed import carries on after the last committed batch.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"event-ingestion-system/internal/archive"
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/export"
+	"event-ingestion-system/internal/jobs"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/webhook"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxLine bounds the length of an archive line
+const maxLine = 16 << 20
+
+// ErrInvalidArchive is returned for a file that is not an export archive
+// this version can import
+var ErrInvalidArchive = errors.New("invalid export archive")
+
+// Manifest is what an archive's first two lines say about it
+type Manifest struct {
+	Header export.Header
+	Tenant TenantRecord
+}
+
+// TenantRecord is the exported tenant
+type TenantRecord struct {
+	ID       string                `json:"id"`
+	Name     string                `json:"name"`
+	Settings models.TenantSettings `json:"settings"`
+}
+
+// webhookRecord is an exported webhook
+type webhookRecord struct {
+	Name       string          `json:"name"`
+	URL        string          `json:"url"`
+	EventTypes json.RawMessage `json:"event_types"`
+	// PayloadVersion is 0 in archives made before payload versions
+	PayloadVersion int    `json:"payload_version"`
+	Timeout        string `json:"timeout"`
+	ConnectTimeout string `json:"connect_timeout"`
+}
+
+// eventRecord is an exported event
+type eventRecord struct {
+	EventType  string          `json:"event_type"`
+	Sequence   uint64          `json:"sequence"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Metadata   json.RawMessage `json:"metadata"`
+	ClientIP   string          `json:"client_ip"`
+	Source     string          `json:"source"`
+	Credential string          `json:"credential"`
+
+	CorrelationID string `json:"correlation_id"`
+	CausationID   string `json:"causation_id"`
+
+	System bool `json:"system"`
+}
+
+// zstdMagic begins every zstd frame
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Key is where a job's uploaded archive is stored
+func Key(job *models.ImportJob) string {
+	return "imports/" + job.ID + ".ndjson.gz"
+}
+
+// ReadManifest reads the header and tenant lines of a compressed
+// archive, checking that this version can import it
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	lines, closer, err := newScanner(r)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var manifest Manifest
+	if err := readRecord(lines, "export", &manifest.Header); err != nil {
+		return nil, err
+	}
+	if manifest.Header.Version != export.FormatVersion {
+		return nil, fmt.Errorf("%w: version %d, expected %d", ErrInvalidArchive, manifest.Header.Version, export.FormatVersion)
+	}
+	if err := readRecord(lines, "tenant", &manifest.Tenant); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// Runner claims queued import jobs and loads their archives, one at a time
+type Runner struct {
+	*jobs.Runner[models.ImportJob, *models.ImportJob]
+	db    *database.Database
+	store archive.Store
+	cfg   config.ImportsConfig
+}
+
+// NewRunner creates an import runner. Imports commit cfg.BatchSize records
+// at a time.
+func NewRunner(db *database.Database, store archive.Store, cfg config.ImportsConfig, logger *slog.Logger) *Runner {
+	r := &Runner{db: db, store: store, cfg: cfg}
+	r.Runner = jobs.NewRunner(db, jobs.Kind[*models.ImportJob]{
+		Name: "import",
+		Run:  r.load,
+		Finish: func(db *database.Database, job *models.ImportJob, at time.Time) error {
+			return db.FinishImportJob(job, at)
+		},
+		// An archive that cannot be read now never will be
+		Permanent: func(err error) bool { return errors.Is(err, ErrInvalidArchive) },
+		Completed: func(job *models.ImportJob) []any {
+			return []any{"events", job.EventsImported, "conflicts", job.ConflictCount}
+		},
+	}, cfg.PollInterval, logger)
+	return r
+}
+
+// load reads the archive from the line after the last committed batch and
+// commits the rest in batches
+func (r *Runner) load(ctx context.Context, job *models.ImportJob, logger *slog.Logger) error {
+	if job.Lines > 0 {
+		logger.InfoContext(ctx, "Resuming import job", "after_line", job.Lines)
+	}
+	file, err := r.store.Open(ctx, job.ObjectKey)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	defer file.Close()
+
+	lines, closer, err := newScanner(file)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	var header export.Header
+	if err := readRecord(lines, "export", &header); err != nil {
+		return err
+	}
+	if header.Version != export.FormatVersion {
+		return fmt.Errorf("%w: version %d, expected %d", ErrInvalidArchive, header.Version, export.FormatVersion)
+	}
+	line := int64(1)
+	for ; line < job.Lines; line++ {
+		if !lines.Scan() {
+			return fmt.Errorf("%w: archive ends before line %d, where the import stopped", ErrInvalidArchive, job.Lines)
+		}
+	}
+
+	db := r.db.WithContext(ctx)
+	var batch []database.ImportItem
+	commit := func() error {
+		if line == job.Lines {
+			return nil
+		}
+		if _, err := db.ImportBatch(job, line, batch); err != nil {
+			return fmt.Errorf("import batch ending at line %d: %w", line, err)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for lines.Scan() {
+		line++
+		item, conflict, err := r.item(job, lines.Bytes())
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %v", ErrInvalidArchive, line, err)
+		}
+		item.Line = line
+		if conflict != "" {
+			// Recorded with the batch, so the line's fate commits with it
+			batch = append(batch, database.ImportItem{Line: line, Invalid: conflict})
+		} else if item.Event != nil || item.View != nil || item.Webhook != nil {
+			batch = append(batch, item)
+		}
+		if len(batch) >= r.cfg.BatchSize {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return fmt.Errorf("read archive: %w", err)
+	}
+	return commit()
+}
+
+// item turns an archive line into a record of the job's tenant. A line
+// whose record cannot be imported is described by conflict; one that is
+// not JSON fails the import.
+func (r *Runner) item(job *models.ImportJob, line []byte) (item database.ImportItem, conflict string, err error) {
+	var record struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return item, "", err
+	}
+
+	switch record.Type {
+	case "tenant":
+		// Applied when the job was created
+	case "view":
+		var view models.SavedView
+		if err := json.Unmarshal(record.Data, &view); err != nil {
+			return item, "view: " + err.Error(), nil
+		}
+		if view.Name == "" {
+			return item, "view: name is required", nil
+		}
+		item.View = &models.SavedView{TenantID: job.TenantID, Name: view.Name, Filter: view.Filter}
+	case "webhook":
+		var wh webhookRecord
+		if err := json.Unmarshal(record.Data, &wh); err != nil {
+			return item, "webhook: " + err.Error(), nil
+		}
+		if wh.URL == "" {
+			return item, "webhook: url is required", nil
+		}
+		if wh.PayloadVersion < 0 || wh.PayloadVersion > models.PayloadV2 {
+			return item, "webhook: payload_version must be 1 or 2", nil
+		}
+		if _, _, err := webhook.ParseTimeouts(wh.Timeout, wh.ConnectTimeout); err != nil {
+			return item, "webhook: " + err.Error(), nil
+		}
+		secret, err := generateSecret()
+		if err != nil {
+			return item, "", err
+		}
+		item.Webhook = &models.Webhook{
+			TenantID:       job.TenantID,
+			URL:            wh.URL,
+			Secret:         secret,
+			EventTypes:     string(wh.EventTypes),
+			PayloadVersion: models.PayloadVersionOrDefault(wh.PayloadVersion),
+			Timeout:        wh.Timeout,
+			ConnectTimeout: wh.ConnectTimeout,
+		}
+		if wh.Name != "" {
+			item.Webhook.Name = &wh.Name
+		}
+	case "event":
+		var ev eventRecord
+		if err := json.Unmarshal(record.Data, &ev); err != nil {
+			return item, "event: " + err.Error(), nil
+		}
+		switch {
+		case ev.EventType == "":
+			return item, "event: event_type is required", nil
+		case ev.Timestamp.IsZero():
+			return item, "event: timestamp is required", nil
+		case ev.Sequence == 0:
+			return item, "event: sequence is required", nil
+		}
+		item.Event = &models.Event{
+			TenantID:   job.TenantID,
+			EventType:  ev.EventType,
+			Sequence:   ev.Sequence,
+			Timestamp:  ev.Timestamp,
+			Metadata:   string(ev.Metadata),
+			ClientIP:   ev.ClientIP,
+			Source:     ev.Source,
+			Credential: ev.Credential,
+
+			CorrelationID: ev.CorrelationID,
+			CausationID:   ev.CausationID,
+
+			System: ev.System,
+		}
+	default:
+		return item, fmt.Sprintf("unknown record type %q", record.Type), nil
+	}
+	return item, "", nil
+}
+
+// newScanner reads the lines of an archive compressed with gzip or zstd,
+// told apart by their magic numbers. Parts of an archive concatenated in
+// order read as one. Closing the returned closer releases the
+// decompressor.
+func newScanner(r io.Reader) (*bufio.Scanner, io.Closer, error) {
+	br := bufio.NewReader(r)
+	var zr io.ReadCloser
+	magic, err := br.Peek(len(zstdMagic))
+	if err == nil && bytes.Equal(magic, zstdMagic) {
+		var dec *zstd.Decoder
+		if dec, err = zstd.NewReader(br, zstd.WithDecoderConcurrency(1)); err == nil {
+			zr = dec.IOReadCloser()
+		}
+	} else {
+		zr, err = gzip.NewReader(br)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	lines := bufio.NewScanner(zr)
+	lines.Buffer(make([]byte, 64*1024), maxLine)
+	return lines, zr, nil
+}
+
+// readRecord reads the next line as a record of type kind into data
+func readRecord(lines *bufio.Scanner, kind string, data any) error {
+	if !lines.Scan() {
+		if err := lines.Err(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		return fmt.Errorf("%w: missing %s record", ErrInvalidArchive, kind)
+	}
+	var record struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(lines.Bytes(), &record); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if record.Type != kind {
+		return fmt.Errorf("%w: expected a %s record, got %q", ErrInvalidArchive, kind, record.Type)
+	}
+	if err := json.Unmarshal(record.Data, data); err != nil {
+		return fmt.Errorf("%w: %s record: %v", ErrInvalidArchive, kind, err)
+	}
+	return nil
+}
+
+// generateSecret returns a random hex-encoded webhook signing secret
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
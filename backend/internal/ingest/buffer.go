@@ -0,0 +1,192 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"event-ingestion-system/internal/deadletter"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/flags"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+)
+
+// Ack is how far an event has got when ingestion answers
+type Ack string
+
+const (
+	// AckNone answers once the event is valid. It is queued if the buffer
+	// has room and otherwise dropped, so it may be lost.
+	AckNone Ack = "none"
+	// AckReceived answers once the event is queued, waiting for room as
+	// long as the request allows
+	AckReceived Ack = "received"
+	// AckDurable answers once the event is committed
+	AckDurable Ack = "durable"
+)
+
+// ParseAck parses an ack level; empty means AckDurable
+func ParseAck(s string) (Ack, bool) {
+	switch ack := Ack(s); ack {
+	case "":
+		return AckDurable, true
+	case AckNone, AckReceived, AckDurable:
+		return ack, true
+	}
+	return "", false
+}
+
+// DefaultAck is the ack of a request that names none: AckReceived for
+// tenants with the async_ingest flag, AckDurable for the others
+func DefaultAck(ctx context.Context) Ack {
+	if flags.IsEnabled(ctx, flags.AsyncIngest) {
+		return AckReceived
+	}
+	return AckDurable
+}
+
+// pending is a queued event with the request it came from, redacted, for
+// the dead letter should the write fail
+type pending struct {
+	event *models.Event
+	req   models.EventRequest
+}
+
+// enqueue hands an event to the buffer writer
+func (s *Service) enqueue(ctx context.Context, p pending, ack Ack) error {
+	s.enqueuing.RLock()
+	defer s.enqueuing.RUnlock()
+	select {
+	case <-s.draining:
+		return errors.ErrIngestBufferFull(1)
+	default:
+	}
+
+	if ack == AckNone {
+		select {
+		case s.queue <- p:
+			metrics.IngestQueueDepth(len(s.queue))
+		default:
+			metrics.IngestBufferEvent("dropped")
+			s.logger.WarnContext(ctx, "Ingest buffer full, dropping event", "tenant_id", p.event.TenantID, "event_type", p.event.EventType)
+		}
+		return nil
+	}
+
+	// The writer keeps taking events until Shutdown, which waits for this
+	select {
+	case s.queue <- p:
+		metrics.IngestQueueDepth(len(s.queue))
+		return nil
+	case <-ctx.Done():
+	}
+	metrics.IngestBufferEvent("rejected")
+	return errors.ErrIngestBufferFull(1)
+}
+
+// QueueDepth returns the number of events waiting to be written
+func (s *Service) QueueDepth() int {
+	return len(s.queue)
+}
+
+// Run writes queued events in batches of up to ingest.batch_size, waiting
+// at most ingest.flush_interval to fill one, until ctx is cancelled or
+// Shutdown has drained the buffer. It also starts the workers that fan
+// accepted events out and write sampled-out counts, which run until ctx is
+// cancelled.
+func (s *Service) Run(ctx context.Context) {
+	defer close(s.stopped)
+
+	for _, shard := range s.shards {
+		go s.runShard(ctx, shard)
+	}
+	go s.runSampledCounts(ctx)
+	go func() {
+		<-ctx.Done()
+		close(s.fanoutStopped)
+	}()
+
+	batch := make([]pending, 0, s.cfg.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			s.write(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+	timer := time.NewTimer(s.cfg.FlushInterval)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-s.queue:
+			batch = append(batch, p)
+			if len(batch) == 1 {
+				timer.Reset(s.cfg.FlushInterval)
+			}
+			if len(batch) == s.cfg.BatchSize {
+				timer.Stop()
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		case <-s.draining:
+			timer.Stop()
+			for {
+				select {
+				case p := <-s.queue:
+					batch = append(batch, p)
+					if len(batch) == s.cfg.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// write stores a batch in one transaction and fans the events out. A batch
+// that fails becomes dead letters, since its requests were already
+// answered.
+func (s *Service) write(ctx context.Context, batch []pending) {
+	metrics.IngestQueueDepth(len(s.queue))
+
+	events := make([]models.Event, len(batch))
+	for i, p := range batch {
+		events[i] = *p.event
+	}
+	if err := s.events.EventsWithContext(ctx).CreateEvents(events, len(events)); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to write buffered events", "count", len(batch), "error", err)
+		for _, p := range batch {
+			metrics.IngestBufferEvent("failed")
+			s.dlq.Record(ctx, deadletter.Ingest(p.req, err))
+		}
+		return
+	}
+
+	for i := range events {
+		metrics.IngestBufferEvent("written")
+		s.accepted(ctx, &events[i])
+	}
+}
+
+// Shutdown stops taking queued events, writes the buffered ones and waits
+// for the writer. If ctx expires first, cancel Run's context to abandon
+// the rest.
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.enqueuing.Lock()
+	s.drainOnce.Do(func() { close(s.draining) })
+	s.enqueuing.Unlock()
+
+	select {
+	case <-s.stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d events still buffered: %w", s.QueueDepth(), ctx.Err())
+	}
+}
@@ -0,0 +1,228 @@
+package ingest
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	"event-ingestion-system/internal/latency"
+	"event-ingestion-system/internal/models"
+)
+
+// Accepted events reach WebSocket clients, webhooks and sinks in each
+// tenant's sequence order. Events are sharded by tenant onto ordered
+// queues, each drained by one worker, so a tenant's events are handed on
+// one at a time. Requests commit concurrently, though, and may be
+// answered in a different order from their sequence numbers; a worker
+// holds an event back until the events numbered before it have been
+// handed on, or for at most reorderWindow, after which the missing numbers
+// are skipped. Numbers go missing when events are stored without being
+// fanned out, as imports are. A worker does not know where a tenant's
+// sequence stands until it has seen the tenant's events, so the first
+// event it sees of a tenant, other than sequence 1, is held for the window
+// as well: events numbered before it arriving meanwhile go first. Events
+// still held at shutdown are handed on in sequence order.
+const (
+	// fanoutShards is the number of ordered queues and workers
+	fanoutShards = 16
+	// fanoutQueueSize bounds each queue; accepting an event waits for room
+	fanoutQueueSize = 1024
+	// reorderWindow bounds how long an event waits for earlier ones
+	reorderWindow = 500 * time.Millisecond
+	// idleTenant is how long a tenant's order is kept after its last event
+	idleTenant = time.Minute
+)
+
+// delivery is an accepted event waiting to be fanned out, with the context
+// of the request that produced it
+type delivery struct {
+	ctx   context.Context
+	event *models.Event
+}
+
+// tenantOrder is a worker's view of one tenant's sequence
+type tenantOrder struct {
+	// next is the sequence number to hand on next, or 0 until the first
+	// events seen of the tenant have been held for the reorder window
+	next uint64
+	// held are events that came before next was handed on, by sequence;
+	// the oldest has waited since heldSince
+	held      map[uint64]delivery
+	heldSince time.Time
+	lastSeen  time.Time
+}
+
+// newShards makes the ordered queues
+func newShards() []chan delivery {
+	shards := make([]chan delivery, fanoutShards)
+	for i := range shards {
+		shards[i] = make(chan delivery, fanoutQueueSize)
+	}
+	return shards
+}
+
+// shardFor returns the queue a tenant's events go through
+func (s *Service) shardFor(tenantID string) chan delivery {
+	h := fnv.New32a()
+	h.Write([]byte(tenantID))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// fanOut queues an accepted event for its tenant's worker. Once the
+// workers have stopped, the event is dropped.
+func (s *Service) fanOut(ctx context.Context, event *models.Event) {
+	s.background.Add(1)
+	select {
+	case s.shardFor(event.TenantID) <- delivery{ctx: context.WithoutCancel(ctx), event: event}:
+	case <-s.fanoutStopped:
+		s.background.Done()
+	}
+}
+
+// runShard hands on one queue's events in each tenant's sequence order
+// until ctx is cancelled
+func (s *Service) runShard(ctx context.Context, queue <-chan delivery) {
+	tenants := make(map[string]*tenantOrder)
+	ticker := time.NewTicker(reorderWindow / 5)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.flush(tenants, queue)
+			return
+		case d := <-queue:
+			s.order(tenants, d, time.Now())
+		case now := <-ticker.C:
+			for tenantID, t := range tenants {
+				s.deliverAll(t.expire(now))
+				if len(t.held) == 0 && now.Sub(t.lastSeen) >= idleTenant {
+					delete(tenants, tenantID)
+				}
+			}
+		}
+	}
+}
+
+// order hands d on, along with the held events it lets through, once its
+// tenant's earlier events have been
+func (s *Service) order(tenants map[string]*tenantOrder, d delivery, now time.Time) {
+	t := tenants[d.event.TenantID]
+	if t == nil {
+		t = newTenantOrder()
+		tenants[d.event.TenantID] = t
+	}
+	s.deliverAll(t.add(d, now))
+}
+
+// flush hands on the events left in queue and those held, each tenant's in
+// sequence order, without waiting for missing numbers
+func (s *Service) flush(tenants map[string]*tenantOrder, queue <-chan delivery) {
+	now := time.Now()
+	// This worker is the queue's only reader
+	for len(queue) > 0 {
+		s.order(tenants, <-queue, now)
+	}
+	for _, t := range tenants {
+		s.deliverAll(t.drain(now))
+	}
+}
+
+func newTenantOrder() *tenantOrder {
+	return &tenantOrder{held: make(map[uint64]delivery)}
+}
+
+// add returns the events to hand on now that d arrived, in order: d if it
+// is next in sequence, followed by the held events that come after it.
+// Otherwise d is held and nothing is returned. An event older than the next
+// number is returned at once.
+func (t *tenantOrder) add(d delivery, now time.Time) []delivery {
+	seq := d.event.Sequence
+	t.lastSeen = now
+	if t.next == 0 && seq == 1 {
+		// Nothing can come before a tenant's first event
+		t.next = 1
+	}
+
+	switch {
+	case t.next != 0 && seq < t.next:
+		return []delivery{d}
+	case seq == t.next:
+		t.next++
+		return append([]delivery{d}, t.release(now)...)
+	default:
+		if len(t.held) == 0 {
+			t.heldSince = now
+		}
+		t.held[seq] = d
+		return nil
+	}
+}
+
+// expire gives up on the missing numbers once the oldest held event has
+// waited reorderWindow, returning the held events that are then next
+func (t *tenantOrder) expire(now time.Time) []delivery {
+	if len(t.held) == 0 || now.Sub(t.heldSince) < reorderWindow {
+		return nil
+	}
+	t.next = t.lowestHeld()
+	return t.release(now)
+}
+
+// drain returns every held event in sequence order
+func (t *tenantOrder) drain(now time.Time) []delivery {
+	var ready []delivery
+	for len(t.held) > 0 {
+		t.next = t.lowestHeld()
+		ready = append(ready, t.release(now)...)
+	}
+	return ready
+}
+
+// release returns the held events that are next in sequence
+func (t *tenantOrder) release(now time.Time) []delivery {
+	var ready []delivery
+	for {
+		d, ok := t.held[t.next]
+		if !ok {
+			break
+		}
+		delete(t.held, t.next)
+		ready = append(ready, d)
+		t.next++
+	}
+	t.heldSince = now
+	return ready
+}
+
+// lowestHeld returns the smallest held sequence number
+func (t *tenantOrder) lowestHeld() uint64 {
+	first := true
+	var lowest uint64
+	for seq := range t.held {
+		if first || seq < lowest {
+			lowest, first = seq, false
+		}
+	}
+	return lowest
+}
+
+// deliverAll hands on ds in order
+func (s *Service) deliverAll(ds []delivery) {
+	for _, d := range ds {
+		s.deliver(d)
+	}
+}
+
+// deliver hands an event to WebSocket clients, webhooks and sinks. Only
+// webhooks may block, waiting for room in the tenant's delivery queue.
+func (s *Service) deliver(d delivery) {
+	defer s.background.Done()
+	if err := s.hub.BroadcastToTenant(d.ctx, d.event.TenantID, d.event); err != nil {
+		s.logger.ErrorContext(d.ctx, "Failed to broadcast event", "event_id", d.event.ID, "tenant_id", d.event.TenantID, "error", err)
+	} else {
+		s.latency.Observe(latency.StageBroadcast, d.event, time.Now())
+	}
+	s.webhooks.Dispatch(d.ctx, d.event)
+	s.sinks.Publish(d.event)
+}
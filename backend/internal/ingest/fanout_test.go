@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/models"
+)
+
+func sequenced(seq uint64) delivery {
+	return delivery{ctx: context.Background(), event: &models.Event{TenantID: "tenant-1", Sequence: seq}}
+}
+
+func sequencesOf(ds []delivery) []uint64 {
+	seqs := []uint64{}
+	for _, d := range ds {
+		seqs = append(seqs, d.event.Sequence)
+	}
+	return seqs
+}
+
+func TestTenantOrderHoldsFirstEventForEarlierOnes(t *testing.T) {
+	start := time.Now()
+	order := newTenantOrder()
+
+	if got := sequencesOf(order.add(sequenced(7), start)); len(got) != 0 {
+		t.Fatalf("first event handed on at once: %v", got)
+	}
+	if got := sequencesOf(order.add(sequenced(5), start.Add(100*time.Millisecond))); len(got) != 0 {
+		t.Fatalf("event before the first handed on at once: %v", got)
+	}
+	if got := sequencesOf(order.expire(start.Add(reorderWindow / 2))); len(got) != 0 {
+		t.Fatalf("events handed on before the reorder window: %v", got)
+	}
+	// 6 never comes
+	if got, want := sequencesOf(order.expire(start.Add(reorderWindow))), []uint64{5}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after the reorder window got %v, want %v", got, want)
+	}
+	if got, want := sequencesOf(order.expire(start.Add(2*reorderWindow))), []uint64{7}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after another window got %v, want %v", got, want)
+	}
+	if got, want := sequencesOf(order.add(sequenced(8), start.Add(2*reorderWindow))), []uint64{8}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("next event got %v, want %v", got, want)
+	}
+}
+
+func TestTenantOrderHandsOnSequenceOneAtOnce(t *testing.T) {
+	now := time.Now()
+	order := newTenantOrder()
+
+	if got, want := sequencesOf(order.add(sequenced(1), now)), []uint64{1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got := sequencesOf(order.add(sequenced(3), now)); len(got) != 0 {
+		t.Fatalf("event after a gap handed on at once: %v", got)
+	}
+	if got, want := sequencesOf(order.add(sequenced(2), now)), []uint64{2, 3}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := sequencesOf(order.add(sequenced(2), now)), []uint64{2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("late event got %v, want %v", got, want)
+	}
+}
+
+func TestTenantOrderDrainsHeldEventsInOrder(t *testing.T) {
+	now := time.Now()
+	order := newTenantOrder()
+	for _, seq := range []uint64{9, 4, 6, 5} {
+		order.add(sequenced(seq), now)
+	}
+
+	if got, want := sequencesOf(order.drain(now)), []uint64{4, 5, 6, 9}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if len(order.held) != 0 {
+		t.Fatalf("%d events still held", len(order.held))
+	}
+}
@@ -0,0 +1,64 @@
+package ingest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/testsupport"
+)
+
+// TestInactiveTenantsAreRejected deactivates the tenant and ingests as it
+// through each way of authenticating. Ingest reuses the tenant
+// authentication loaded, so each path must still refuse it.
+func TestInactiveTenantsAreRejected(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		client func(s *testsupport.Server, token string) *testsupport.Client
+		want   int
+	}{
+		// Authentication refuses an inactive tenant's API key
+		{"api key", func(s *testsupport.Server, _ string) *testsupport.Client { return s.Client }, http.StatusUnauthorized},
+		// A token stays valid, so ingest refuses the tenant it loaded
+		{"jwt", func(s *testsupport.Server, token string) *testsupport.Client {
+			return s.Anonymous.With("Authorization", "Bearer "+token)
+		}, http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Every lookup reads the database, so deactivation is seen at once
+			s := testsupport.Start(t, func(cfg *config.Config) { cfg.Auth.TenantCacheTTL = time.Nanosecond })
+			var issued struct {
+				Token string `json:"token"`
+			}
+			if status, err := s.Client.JSON(http.MethodGet, "/api/v1/tenants/"+s.Tenant.ID+"/token", nil, &issued); err != nil || status != http.StatusOK {
+				t.Fatalf("get token: status %d: %v", status, err)
+			}
+			client := tc.client(s, issued.Token)
+			event := models.EventRequest{
+				TenantID:  s.Tenant.ID,
+				EventType: "page.view",
+				Timestamp: time.Now().UTC().Format(time.RFC3339),
+				Metadata:  []byte(`{}`),
+			}
+			if status, err := client.JSON(http.MethodPost, "/api/v1/events", event, nil); err != nil || status != http.StatusCreated {
+				t.Fatalf("ingest while active: status %d: %v", status, err)
+			}
+
+			if err := s.App.DB.DB.Model(&models.Tenant{}).Where("id = ?", s.Tenant.ID).Update("active", false).Error; err != nil {
+				t.Fatal(err)
+			}
+			if status, err := client.JSON(http.MethodPost, "/api/v1/events", event, nil); err != nil || status != tc.want {
+				t.Fatalf("ingest while inactive: status %d, want %d: %v", status, tc.want, err)
+			}
+			var stored int64
+			if err := s.App.DB.DB.Model(&models.Event{}).Where("tenant_id = ?", s.Tenant.ID).Count(&stored).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored != 1 {
+				t.Fatalf("stored %d events, want only the one ingested while active", stored)
+			}
+		})
+	}
+}
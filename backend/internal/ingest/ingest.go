@@ -0,0 +1,578 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"event-ingestion-system/internal/alert"
+	"event-ingestion-system/internal/anomaly"
+	"event-ingestion-system/internal/cache"
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/deadletter"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/geoip"
+	"event-ingestion-system/internal/latency"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/quota"
+	"event-ingestion-system/internal/redact"
+	"event-ingestion-system/internal/sink"
+	"event-ingestion-system/internal/tracing"
+	"event-ingestion-system/internal/transform"
+	"event-ingestion-system/internal/webhook"
+	"event-ingestion-system/internal/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var eventTypePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// Service validates, stores and fans out events. The HTTP API and message
+// bus consumers share it so every entry point applies the same rules.
+type Service struct {
+	db        *database.Database
+	events    database.EventStore
+	tenants   cache.Tenants
+	hub       *websocket.Hub
+	webhooks  *webhook.Dispatcher
+	sinks     *sink.Pipeline
+	dlq       *deadletter.Store
+	alerts    *alert.Evaluator
+	anomalies *anomaly.Tracker
+	latency   *latency.Tracker
+	quotas    *quota.Tracker
+	geo       *geoip.Resolver
+	cfg       config.IngestConfig
+	geoCfg    config.GeoIPConfig
+	logger    *slog.Logger
+
+	// queue holds events acknowledged before being written; the buffer
+	// writer started by Run inserts them. enqueue holds enqueuing for
+	// reading, so once Shutdown has closed draining no event can join the
+	// queue after the writer's last drain.
+	queue     chan pending
+	enqueuing sync.RWMutex
+	draining  chan struct{}
+	drainOnce sync.Once
+	stopped   chan struct{}
+
+	// settings caches decoded tenant settings by tenant ID as
+	// cachedSettings, decoded again when they change
+	settings sync.Map
+
+	// sampled counts the events sampling rules kept from being stored
+	sampled sampledCounts
+
+	// shards are the ordered queues accepted events are fanned out
+	// through, drained by workers Run starts; fanoutStopped is closed once
+	// they stop
+	shards        []chan delivery
+	fanoutStopped chan struct{}
+
+	// background tracks accepted events not yet fanned out, so shutdown
+	// can wait for them
+	background sync.WaitGroup
+}
+
+// NewService creates an ingest service
+func NewService(db *database.Database, events database.EventStore, tenants cache.Tenants, hub *websocket.Hub, dispatcher *webhook.Dispatcher, sinks *sink.Pipeline, dlq *deadletter.Store, alerts *alert.Evaluator, anomalies *anomaly.Tracker, latencies *latency.Tracker, quotas *quota.Tracker, geo *geoip.Resolver, cfg config.IngestConfig, geoCfg config.GeoIPConfig, logger *slog.Logger) *Service {
+	return &Service{
+		db:        db,
+		events:    events,
+		tenants:   tenants,
+		hub:       hub,
+		webhooks:  dispatcher,
+		sinks:     sinks,
+		dlq:       dlq,
+		alerts:    alerts,
+		anomalies: anomalies,
+		latency:   latencies,
+		quotas:    quotas,
+		geo:       geo,
+		cfg:       cfg,
+		geoCfg:    geoCfg,
+		logger:    logger,
+		queue:     make(chan pending, cfg.BufferSize),
+		draining:  make(chan struct{}),
+		stopped:   make(chan struct{}),
+
+		shards:        newShards(),
+		fanoutStopped: make(chan struct{}),
+	}
+}
+
+// Ingest validates req, persists the event and hands it to WebSocket
+// clients, webhooks and sinks without waiting for them. Returned errors are
+// *errors.AppError; a 5xx status means the event may succeed if retried.
+// Events that fail to persist are also kept as dead letters.
+func (s *Service) Ingest(ctx context.Context, req models.EventRequest) (*models.Event, error) {
+	return s.IngestWithAck(ctx, req, AckDurable)
+}
+
+// IngestWithAck validates req and returns once the event has got as far as
+// ack asks. Below AckDurable the event is queued for the buffer writer and
+// returned without an ID or sequence number; it is fanned out once written,
+// and becomes a dead letter if the write fails.
+func (s *Service) IngestWithAck(ctx context.Context, req models.EventRequest, ack Ack) (*models.Event, error) {
+	start := time.Now()
+	if ack == AckDurable {
+		event, err := s.ingest(ctx, req, false)
+		if err == nil {
+			acked(ctx, ack, start)
+		}
+		return event, err
+	}
+
+	event, err := s.prepare(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	if event.Sampled {
+		acked(ctx, ack, start)
+		return event, nil
+	}
+	req.EventType, req.Metadata = event.EventType, json.RawMessage(event.Metadata)
+	if err := s.enqueue(ctx, pending{event: event, req: req}, ack); err != nil {
+		return nil, err
+	}
+	acked(ctx, ack, start)
+	return event, nil
+}
+
+// acked counts an event acknowledged at ack and records how long it took
+// since start, linked to the request's trace when it is sampled
+func acked(ctx context.Context, ack Ack, start time.Time) {
+	metrics.EventAcked(string(ack))
+	metrics.IngestDuration(string(ack), time.Since(start), tracing.SampledTraceID(ctx))
+}
+
+// ingest implements Ingest. A retry of a dead letter is neither transformed
+// nor redacted again, since it already was, nor dead-lettered again; the
+// caller updates the existing dead letter instead.
+func (s *Service) ingest(ctx context.Context, req models.EventRequest, retry bool) (*models.Event, error) {
+	event, err := s.prepare(ctx, req, retry)
+	if err != nil || event.Sampled {
+		return event, err
+	}
+
+	if err := s.create(ctx, event); err != nil {
+		// A write conflict stored nothing and the client is told to retry,
+		// so a dead letter would only duplicate the event
+		if !retry && !stderrors.Is(err, database.ErrWriteConflict) {
+			// Keep the transformed and redacted request, never the
+			// original metadata
+			req.EventType, req.Metadata = event.EventType, json.RawMessage(event.Metadata)
+			s.dlq.Record(ctx, deadletter.Ingest(req, err))
+		}
+		return nil, errors.ErrDB("create event", err)
+	}
+
+	s.accepted(ctx, event)
+	return event, nil
+}
+
+// prepare validates req and builds the event to store, transformed and with
+// its metadata redacted unless this is a retry. An event the tenant's sampling rules
+// keep from being stored is counted and returned with Sampled set; retries
+// are never sampled.
+func (s *Service) prepare(ctx context.Context, req models.EventRequest, retry bool) (*models.Event, error) {
+	var received time.Time
+	if !retry && s.latency.Sample() {
+		received = time.Now()
+	}
+
+	// The tenant the request authenticated as was loaded by the auth
+	// middleware; any other is validated and looked up
+	tenant := cache.FromContext(ctx)
+	if tenant == nil || tenant.ID != req.TenantID {
+		if _, err := uuid.Parse(req.TenantID); err != nil {
+			return nil, errors.ErrBadTenantID("Invalid tenant ID format").WithFields(errors.FieldError{
+				Field: "tenant_id", Rule: "uuid", Message: "must be a valid UUID",
+			})
+		}
+		var err error
+		if tenant, err = s.tenants.ByID(ctx, req.TenantID); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, errors.ErrTenantNotFound(req.TenantID)
+			}
+			return nil, errors.ErrDB("verify tenant", err)
+		}
+	}
+	if !tenant.Active {
+		return nil, errors.ErrTenantInactive()
+	}
+
+	// Validate event type
+	if err := ValidateEventType(req.EventType); err != nil {
+		return nil, errors.ErrBadEventType(err.Error()).WithFields(err.(*ValidationError).FieldError())
+	}
+
+	// Parse timestamp - support multiple formats
+	timestamp, err := ParseTimestamp(req.Timestamp)
+	if err != nil {
+		return nil, errors.ErrBadTimestamp("Timestamp must be in ISO8601 format (e.g., 2026-02-10T19:07:41Z or 2026-02-10T19:07:41.701Z)").WithFields(err.(*ValidationError).FieldError())
+	}
+
+	// Validate metadata is valid JSON
+	if req.Metadata != nil {
+		if _, err := json.Marshal(req.Metadata); err != nil {
+			return nil, errors.ErrBadMetadata("Metadata must be a valid JSON object")
+		}
+	}
+
+	if err := ValidateSource(req.Source); err != nil {
+		return nil, errors.ErrInvalidRequest(err.Error()).WithFields(err.(*ValidationError).FieldError())
+	}
+	if err := ValidateCorrelationID("correlation_id", req.CorrelationID); err != nil {
+		return nil, errors.ErrInvalidRequest(err.Error()).WithFields(err.(*ValidationError).FieldError())
+	}
+	if err := ValidateCorrelationID("causation_id", req.CausationID); err != nil {
+		return nil, errors.ErrInvalidRequest(err.Error()).WithFields(err.(*ValidationError).FieldError())
+	}
+
+	metadata, _ := json.Marshal(req.Metadata)
+	eventType := req.EventType
+	var clientIP string
+	if !retry {
+		if s.geoCfg.RecordClientIP {
+			clientIP = req.ClientIP
+		}
+		if s.geo != nil {
+			metadata = s.locate(req.ClientIP, metadata)
+		}
+		settings, err := s.tenantSettings(tenant)
+		if err != nil {
+			return nil, errors.ErrInternal("Failed to load tenant settings", err)
+		}
+		if settings.transformer != nil {
+			if eventType, metadata, err = s.transform(ctx, settings.transformer, eventType, metadata); err != nil {
+				return nil, err
+			}
+		}
+		if !settings.sampler.keep(eventType, time.Now()) {
+			event := &models.Event{TenantID: req.TenantID, EventType: eventType, Timestamp: timestamp, Sampled: true}
+			s.sampledOut(event)
+			return event, nil
+		}
+		if settings.redactor != nil {
+			if metadata, err = settings.redactor.Apply(metadata); err != nil {
+				return nil, errors.ErrBadMetadata("Metadata must be a valid JSON object")
+			}
+		}
+		if err := s.quotas.Check(ctx, tenant.ID, settings.quota); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.Event{
+		TenantID:   req.TenantID,
+		EventType:  eventType,
+		Timestamp:  timestamp,
+		Metadata:   string(metadata),
+		ClientIP:   clientIP,
+		Source:     req.Source,
+		Credential: req.Credential,
+
+		CorrelationID: req.CorrelationID,
+		CausationID:   req.CausationID,
+
+		ReceivedAt: received,
+	}, nil
+}
+
+// locate sets the client's location under geoip.Field in metadata, before
+// transformation rules so they can use it. A location sent by the client is
+// dropped, so the field only ever holds what the databases said. Metadata
+// that is not an object is left alone.
+func (s *Service) locate(clientIP string, metadata []byte) []byte {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(metadata, &doc); err != nil {
+		return metadata
+	}
+	_, sent := doc[geoip.Field]
+	delete(doc, geoip.Field)
+
+	addr, err := netip.ParseAddr(clientIP)
+	found := false
+	if err == nil {
+		var loc geoip.Location
+		if loc, found = s.geo.Lookup(addr); found {
+			doc[geoip.Field], _ = json.Marshal(loc)
+		}
+	}
+	if !found && !sent {
+		return metadata
+	}
+	if doc == nil {
+		doc = map[string]json.RawMessage{}
+	}
+	located, err := json.Marshal(doc)
+	if err != nil {
+		return metadata
+	}
+	return located
+}
+
+// transform runs the tenant's transformation rules over an event and
+// validates the event type they leave. Skipped rules are counted and
+// logged; a rule set to reject fails the event.
+func (s *Service) transform(ctx context.Context, t *transform.Transformer, eventType string, metadata []byte) (string, []byte, error) {
+	result, err := t.Apply(eventType, metadata)
+	for _, skipped := range result.Skipped {
+		metrics.TransformRuleFailed("skipped")
+		s.logger.DebugContext(ctx, "Skipped transformation rule", "rule", skipped.Rule, "error", skipped.Error)
+	}
+	if err != nil {
+		var ruleErr *transform.RuleError
+		if stderrors.As(err, &ruleErr) {
+			metrics.TransformRuleFailed("rejected")
+			return "", nil, errors.ErrTransformFailed(err.Error())
+		}
+		return "", nil, errors.ErrBadMetadata("Metadata must be a valid JSON object")
+	}
+	if err := ValidateEventType(result.EventType); err != nil {
+		return "", nil, errors.ErrBadEventType("Transformed " + err.Error())
+	}
+	return result.EventType, result.Metadata, nil
+}
+
+// create writes an event at once
+func (s *Service) create(ctx context.Context, event *models.Event) error {
+	store := s.events.EventsWithContext(ctx)
+	if s.cfg.SynchronousCommit {
+		return store.CreateEventSynchronous(event)
+	}
+	return store.CreateEvent(event)
+}
+
+// accepted counts a stored event and queues it for WebSocket clients,
+// webhooks and sinks, which get each tenant's events in sequence order.
+// Reaching a threshold of the tenant's quota adds a system event after it.
+func (s *Service) accepted(ctx context.Context, event *models.Event) {
+	metrics.EventIngested(event.TenantID)
+	var tenantQuota *models.TenantQuota
+	if cached, ok := s.settings.Load(event.TenantID); ok {
+		tenantQuota = cached.(cachedSettings).quota
+	}
+	notices := s.quotas.Observe(event.TenantID, tenantQuota)
+	s.alerts.Observe(event)
+	s.anomalies.Observe(event.TenantID)
+	s.hub.ObserveIngest(event.TenantID)
+	s.latency.Observe(latency.StageReceived, event, event.ReceivedAt)
+
+	s.fanOut(ctx, event)
+	s.notifyQuota(ctx, notices)
+}
+
+// cachedSettings is what ingestion needs from a tenant's settings, with
+// the settings it was decoded from
+type cachedSettings struct {
+	settings    string
+	transformer *transform.Transformer
+	redactor    *redact.Redactor
+	sampler     *sampler
+	quota       *models.TenantQuota
+}
+
+// tenantSettings returns the tenant's compiled transformation and
+// redaction rules and its sampler, each nil when it has no such rules, and
+// its quota. An error means stored settings no longer compile; events are
+// then rejected rather than stored unredacted.
+func (s *Service) tenantSettings(tenant *models.Tenant) (cachedSettings, error) {
+	if cached, ok := s.settings.Load(tenant.ID); ok && cached.(cachedSettings).settings == tenant.Settings {
+		return cached.(cachedSettings), nil
+	}
+
+	settings, err := tenant.ParseSettings()
+	if err != nil {
+		return cachedSettings{}, err
+	}
+	compiled := cachedSettings{settings: tenant.Settings, sampler: newSampler(settings.SamplingRules), quota: settings.Quota}
+	if len(settings.TransformRules) > 0 {
+		if compiled.transformer, err = transform.Compile(settings.TransformRules, s.cfg.TransformBudget); err != nil {
+			return cachedSettings{}, err
+		}
+	}
+	if len(settings.RedactionRules) > 0 {
+		if compiled.redactor, err = redact.Compile(settings.RedactionRules, tenant.ID); err != nil {
+			return cachedSettings{}, err
+		}
+	}
+	s.settings.Store(tenant.ID, compiled)
+	return compiled, nil
+}
+
+// QuotaUsage returns the tenant's events this month, as its quota counts
+// them, and when the count resets
+func (s *Service) QuotaUsage(ctx context.Context, tenantID string) (int64, time.Time, error) {
+	return s.quotas.Usage(ctx, tenantID)
+}
+
+// RetryDeadLetter processes a dead letter again: an event that failed to
+// persist is ingested, a failed sink or webhook delivery is sent to the same
+// target once more. It returns the stored event for ingest retries.
+func (s *Service) RetryDeadLetter(ctx context.Context, letter *models.DeadLetter) (*models.Event, error) {
+	switch letter.Source {
+	case models.DeadLetterIngest:
+		var req models.EventRequest
+		if err := json.Unmarshal([]byte(letter.Payload), &req); err != nil {
+			return nil, fmt.Errorf("decode event request: %w", err)
+		}
+		return s.ingest(ctx, req, true)
+
+	case models.DeadLetterSink:
+		var stored models.EventResponse
+		if err := json.Unmarshal([]byte(letter.Payload), &stored); err != nil {
+			return nil, fmt.Errorf("decode event: %w", err)
+		}
+		event := &models.Event{
+			ID:         uint(stored.ID),
+			TenantID:   stored.TenantID,
+			Sequence:   stored.Sequence,
+			EventType:  stored.EventType,
+			Timestamp:  stored.Timestamp,
+			Metadata:   string(stored.Metadata),
+			ClientIP:   stored.ClientIP,
+			Source:     stored.Source,
+			Credential: stored.Credential,
+			CreatedAt:  stored.CreatedAt,
+
+			CorrelationID: stored.CorrelationID,
+			CausationID:   stored.CausationID,
+
+			System: stored.System,
+		}
+		return nil, s.sinks.Retry(ctx, letter.Target, event)
+
+	case models.DeadLetterWebhook:
+		webhookID, err := strconv.ParseUint(letter.Target, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook ID %q", letter.Target)
+		}
+		return nil, s.webhooks.Redeliver(ctx, letter.TenantID, uint(webhookID), []byte(letter.Payload))
+	}
+	return nil, fmt.Errorf("unknown dead letter source %q", letter.Source)
+}
+
+// WaitBackground waits for events that were already ingested to be handed
+// to WebSocket clients, webhooks and sinks
+func (s *Service) WaitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ValidateEventType validates the event type
+func ValidateEventType(eventType string) error {
+	if len(eventType) < 1 {
+		return &ValidationError{Field: "event_type", Rule: "required", Message: "cannot be empty"}
+	}
+	if len(eventType) > 100 {
+		return &ValidationError{Field: "event_type", Rule: "max", Message: "must be at most 100 characters"}
+	}
+	// Allow alphanumeric characters, underscores, hyphens, and dots
+	if !eventTypePattern.MatchString(eventType) {
+		return &ValidationError{Field: "event_type", Rule: "pattern", Message: "can only contain alphanumeric characters, underscores, hyphens, and dots"}
+	}
+	return nil
+}
+
+// ValidateSource validates an event's optional source, named like an event
+// type
+func ValidateSource(source string) error {
+	if source == "" {
+		return nil
+	}
+	if len(source) > 100 {
+		return &ValidationError{Field: "source", Rule: "max", Message: "must be at most 100 characters"}
+	}
+	if !eventTypePattern.MatchString(source) {
+		return &ValidationError{Field: "source", Rule: "pattern", Message: "can only contain alphanumeric characters, underscores, hyphens, and dots"}
+	}
+	return nil
+}
+
+// ValidateCorrelationID validates a correlation or causation ID, named by
+// field. IDs are optional and otherwise free-form, up to 128 characters.
+func ValidateCorrelationID(field, id string) error {
+	if utf8.RuneCountInString(id) > 128 {
+		return &ValidationError{Field: field, Rule: "max", Message: "must be at most 128 characters"}
+	}
+	return nil
+}
+
+// ParseTimestamp parses timestamp in various ISO8601 formats
+func ParseTimestamp(ts string) (time.Time, error) {
+	// Try multiple formats
+	formats := []string{
+		time.RFC3339,
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05Z",
+		"2006-01-02T15:04:05.000Z",
+		"2006-01-02T15:04:05.000000Z",
+	}
+
+	for _, format := range formats {
+		if t, err := time.Parse(format, ts); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, &ValidationError{Field: "timestamp", Rule: "iso8601", Message: "must be an ISO8601 timestamp"}
+}
+
+// ParseTimestampIn parses a timestamp like ParseTimestamp, also accepting
+// dates and times without an offset, which are taken to be in loc
+func ParseTimestampIn(ts string, loc *time.Location) (time.Time, error) {
+	if t, err := ParseTimestamp(ts); err == nil {
+		return t, nil
+	}
+
+	formats := []string{
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02",
+	}
+	for _, format := range formats {
+		if t, err := time.ParseInLocation(format, ts, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, &ValidationError{Field: "timestamp", Rule: "iso8601", Message: "must be an ISO8601 timestamp"}
+}
+
+// ValidationError represents a validation error
+type ValidationError struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// FieldError converts the error for an API response
+func (e *ValidationError) FieldError() errors.FieldError {
+	return errors.FieldError{Field: e.Field, Rule: e.Rule, Message: e.Message}
+}
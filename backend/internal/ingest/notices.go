@@ -0,0 +1,81 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/quota"
+)
+
+// Event types of the system events telling a tenant how much of its
+// monthly quota it has used
+const (
+	QuotaWarningEventType  = "system.quota.warning"
+	QuotaExceededEventType = "system.quota.exceeded"
+)
+
+// quotaNoticeMetadata is the metadata of a quota system event
+type quotaNoticeMetadata struct {
+	ThresholdPercent int       `json:"threshold_percent"`
+	Usage            int64     `json:"usage"`
+	Quota            int       `json:"quota"`
+	ResetsAt         time.Time `json:"resets_at"`
+}
+
+// notifyQuota writes a system event into the tenant's stream for each
+// threshold of its quota its events reached, and fans it out like any
+// other, in the background. A threshold another replica already wrote an
+// event for this month is skipped; one whose event fails to write is
+// logged and not tried again, so a tenant hears of each at most once.
+func (s *Service) notifyQuota(ctx context.Context, notices []quota.Notice) {
+	if len(notices) == 0 {
+		return
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		ctx := context.WithoutCancel(ctx)
+		for _, notice := range notices {
+			s.writeQuotaNotice(ctx, notice)
+		}
+	}()
+}
+
+// writeQuotaNotice writes and fans out the system event of one notice
+func (s *Service) writeQuotaNotice(ctx context.Context, notice quota.Notice) {
+	logger := s.logger.With("tenant_id", notice.TenantID, "threshold_percent", notice.Percent)
+	claimed, err := s.db.WithContext(ctx).ClaimQuotaNotice(notice.TenantID, notice.Month.Format("2006-01"), notice.Percent)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to record quota notice", "error", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	eventType := QuotaWarningEventType
+	if notice.Percent >= quota.ExceededPercent {
+		eventType = QuotaExceededEventType
+	}
+	metadata, _ := json.Marshal(quotaNoticeMetadata{
+		ThresholdPercent: notice.Percent,
+		Usage:            notice.Usage,
+		Quota:            notice.Quota,
+		ResetsAt:         notice.Reset,
+	})
+	event := &models.Event{
+		TenantID:  notice.TenantID,
+		EventType: eventType,
+		Timestamp: time.Now().UTC(),
+		Metadata:  string(metadata),
+		System:    true,
+	}
+	if err := s.create(ctx, event); err != nil {
+		logger.ErrorContext(ctx, "Failed to write quota notice event", "error", err)
+		return
+	}
+	logger.InfoContext(ctx, "Notified tenant of quota usage", "event_type", eventType, "usage", notice.Usage, "quota", notice.Quota)
+	s.fanOut(ctx, event)
+}
@@ -0,0 +1,142 @@
+package ingest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/testsupport"
+)
+
+// sequenced is the part of a WebSocket message or webhook payload the
+// ordering test looks at
+type sequenced struct {
+	Sequence uint64 `json:"sequence"`
+	Event    struct {
+		Sequence uint64 `json:"sequence"`
+	} `json:"event"`
+}
+
+// sequences records the sequence numbers one consumer received
+type sequences struct {
+	mu   sync.Mutex
+	seen []uint64
+}
+
+func (s *sequences) add(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen = append(s.seen, seq)
+}
+
+func (s *sequences) snapshot() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint64(nil), s.seen...)
+}
+
+// TestFanOutKeepsTenantOrder ingests events for one tenant from many
+// concurrent requests and checks that a WebSocket client and a webhook
+// receiver each get every one of them in sequence order. The webhook
+// worker's queue fills at this rate, so the fan-out has to wait for it
+// rather than drop events.
+func TestFanOutKeepsTenantOrder(t *testing.T) {
+	const (
+		total   = 10000
+		senders = 32
+	)
+	s := testsupport.Start(t, func(cfg *config.Config) {
+		cfg.Webhooks.Enabled = true
+	})
+
+	var hooked sequences
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload sequenced
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &payload); err == nil && payload.Event.Sequence > 0 {
+			hooked.add(payload.Event.Sequence)
+		}
+	}))
+	defer receiver.Close()
+	status, err := s.Client.JSON(http.MethodPost, "/api/v1/webhooks", models.CreateWebhookRequest{URL: receiver.URL}, nil)
+	if err != nil || status != http.StatusCreated {
+		t.Fatalf("create webhook: status %d: %v", status, err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(s.WebSocketURL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var streamed sequences
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var message sequenced
+			if json.Unmarshal(data, &message) == nil && message.Sequence > 0 {
+				streamed.add(message.Sequence)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, senders)
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(sender int) {
+			defer wg.Done()
+			for n := sender; n < total; n += senders {
+				status, err := s.Client.JSON(http.MethodPost, "/api/v1/events", map[string]any{
+					"tenant_id":  s.Tenant.ID,
+					"event_type": "order.test",
+					"timestamp":  time.Now().UTC(),
+					"metadata":   map[string]any{"n": n},
+				}, nil)
+				if err == nil && status != http.StatusCreated {
+					err = fmt.Errorf("ingest event %d: status %d", n, status)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for (len(streamed.snapshot()) < total || len(hooked.snapshot()) < total) && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	for _, consumer := range []struct {
+		name string
+		seen *sequences
+	}{{"WebSocket client", &streamed}, {"webhook receiver", &hooked}} {
+		seen := consumer.seen.snapshot()
+		if len(seen) != total {
+			t.Errorf("%s got %d events, want %d", consumer.name, len(seen), total)
+		}
+		for i := 1; i < len(seen); i++ {
+			if seen[i] <= seen[i-1] {
+				t.Errorf("%s got sequence %d after %d", consumer.name, seen[i], seen[i-1])
+				break
+			}
+		}
+	}
+}
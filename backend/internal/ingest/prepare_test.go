@@ -0,0 +1,84 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/cache"
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/latency"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/quota"
+)
+
+// uncachedTenants reads every tenant from the database, as ingest did
+// before it reused the authenticated tenant
+type uncachedTenants struct {
+	db *database.Database
+}
+
+func (u uncachedTenants) ByID(_ context.Context, id string) (*models.Tenant, error) {
+	return u.db.GetTenantByID(id)
+}
+
+func (u uncachedTenants) ByAPIKey(_ context.Context, apiKey string) (*models.Tenant, error) {
+	return u.db.GetTenantByAPIKey(apiKey)
+}
+
+func (uncachedTenants) Invalidate(string) {}
+
+// BenchmarkPrepareTenant compares the p99 latency of validating an event
+// with the tenant the auth middleware put in the context and with a
+// database lookup of the tenant per event
+func BenchmarkPrepareTenant(b *testing.B) {
+	db, err := database.NewDatabase("sqlite", filepath.Join(b.TempDir(), "events.db"), 1, 1, time.Hour, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(time.Minute); err != nil {
+		b.Fatal(err)
+	}
+	tenant := models.Tenant{ID: "6f1c2f0e-8d4b-4b8e-9a56-3f7e2c1d0a9b", Name: "Bench", APIKey: "bench-key", Active: true}
+	if err := db.CreateTenant(&tenant); err != nil {
+		b.Fatal(err)
+	}
+	s := NewService(db, db, uncachedTenants{db}, nil, nil, nil, nil, nil, nil, latency.New(0), quota.NewTracker(db), nil, config.IngestConfig{}, config.GeoIPConfig{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	req := models.EventRequest{
+		TenantID:  tenant.ID,
+		EventType: "page.view",
+		Timestamp: "2026-03-14T15:09:26Z",
+		Metadata:  json.RawMessage(`{"path":"/pricing","referrer":"https://example.com"}`),
+	}
+
+	for _, bc := range []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"context-tenant", cache.WithTenant(context.Background(), &tenant)},
+		{"lookup-per-event", context.Background()},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			latencies := make([]time.Duration, b.N)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := range latencies {
+				start := time.Now()
+				if _, err := s.prepare(bc.ctx, req, false); err != nil {
+					b.Fatal(err)
+				}
+				latencies[i] = time.Since(start)
+			}
+			b.StopTimer()
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+)
+
+// Sampling rules thin out a tenant's noisy event types. An event a rule
+// samples out is validated and answered as accepted, but neither stored nor
+// fanned out; it is counted instead, in memory and in the database every
+// sampledFlushInterval, so stats can tell how many events the stored ones
+// stand for. A sampler lives with the tenant's cached settings, so its
+// counts start over when the rules change. Replicas sample on their own, so
+// a per-minute limit holds per replica.
+const (
+	// sampledFlushInterval is how often sampled-out counts are written
+	sampledFlushInterval = 10 * time.Second
+	// sampledFlushTimeout bounds the write of the last counts on shutdown
+	sampledFlushTimeout = 5 * time.Second
+)
+
+// MaxSamplingRules bounds the sampling rules of one tenant
+const MaxSamplingRules = 100
+
+// sampler applies a tenant's sampling rules by event type
+type sampler struct {
+	rules map[string]*sampling
+}
+
+// sampling is a rule with what it has counted
+type sampling struct {
+	rule models.SamplingRule
+
+	mu sync.Mutex
+	// seen counts the events a sample rate was applied to
+	seen uint64
+	// kept counts the events stored in the minute starting at window
+	window time.Time
+	kept   int
+}
+
+// ValidateSamplingRules checks rules before they are saved: each names a
+// valid event type once and sets a sample rate, a per-minute limit or both
+func ValidateSamplingRules(rules []models.SamplingRule) error {
+	if len(rules) > MaxSamplingRules {
+		return fmt.Errorf("at most %d rules are allowed", MaxSamplingRules)
+	}
+	seen := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if err := ValidateEventType(rule.EventType); err != nil {
+			return fmt.Errorf("rule %d: event_type %s", i, err.(*ValidationError).Message)
+		}
+		if seen[rule.EventType] {
+			return fmt.Errorf("rule %d: event type %q already has a rule", i, rule.EventType)
+		}
+		seen[rule.EventType] = true
+		if rule.SampleRate < 0 || rule.MaxPerMinute < 0 {
+			return fmt.Errorf("rule %d: sample_rate and max_per_minute cannot be negative", i)
+		}
+		if rule.SampleRate == 1 {
+			return fmt.Errorf("rule %d: sample_rate must be at least 2", i)
+		}
+		if rule.SampleRate == 0 && rule.MaxPerMinute == 0 {
+			return fmt.Errorf("rule %d: set sample_rate, max_per_minute or both", i)
+		}
+	}
+	return nil
+}
+
+// newSampler returns a sampler for rules, or nil without any
+func newSampler(rules []models.SamplingRule) *sampler {
+	if len(rules) == 0 {
+		return nil
+	}
+	s := &sampler{rules: make(map[string]*sampling, len(rules))}
+	for _, rule := range rules {
+		s.rules[rule.EventType] = &sampling{rule: rule}
+	}
+	return s
+}
+
+// keep reports whether an event of eventType arriving at now is stored. A
+// sample rate keeps the first of every SampleRate events; a per-minute
+// limit the first MaxPerMinute of each minute that the rate kept.
+func (s *sampler) keep(eventType string, now time.Time) bool {
+	if s == nil {
+		return true
+	}
+	r := s.rules[eventType]
+	if r == nil {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rate := r.rule.SampleRate; rate > 0 {
+		n := r.seen
+		r.seen++
+		if n%uint64(rate) != 0 {
+			return false
+		}
+	}
+	if limit := r.rule.MaxPerMinute; limit > 0 {
+		minute := now.Truncate(time.Minute)
+		if !minute.Equal(r.window) {
+			r.window, r.kept = minute, 0
+		}
+		if r.kept >= limit {
+			return false
+		}
+		r.kept++
+	}
+	return true
+}
+
+// sampledCounts are the sampled-out events not yet written, by tenant ID
+// and then event type
+type sampledCounts struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int64
+}
+
+// sampledOut counts an event kept from being stored
+func (s *Service) sampledOut(event *models.Event) {
+	metrics.EventSampled(event.TenantID)
+
+	s.sampled.mu.Lock()
+	defer s.sampled.mu.Unlock()
+	if s.sampled.counts == nil {
+		s.sampled.counts = make(map[string]map[string]int64)
+	}
+	types := s.sampled.counts[event.TenantID]
+	if types == nil {
+		types = make(map[string]int64)
+		s.sampled.counts[event.TenantID] = types
+	}
+	types[event.EventType]++
+}
+
+// runSampledCounts writes sampled-out counts every sampledFlushInterval
+// until ctx is cancelled, and once more then
+func (s *Service) runSampledCounts(ctx context.Context) {
+	ticker := time.NewTicker(sampledFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sampledFlushTimeout)
+			s.flushSampled(ctx)
+			cancel()
+			return
+		case <-ticker.C:
+			s.flushSampled(ctx)
+		}
+	}
+}
+
+// flushSampled writes the sampled-out counts; counts that fail to write are
+// kept for the next flush
+func (s *Service) flushSampled(ctx context.Context) {
+	s.sampled.mu.Lock()
+	counts := s.sampled.counts
+	s.sampled.counts = nil
+	s.sampled.mu.Unlock()
+	if len(counts) == 0 {
+		return
+	}
+
+	if err := s.db.WithContext(ctx).AddSampledEventCounts(counts); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to write sampled event counts", "tenants", len(counts), "error", err)
+		s.sampled.mu.Lock()
+		defer s.sampled.mu.Unlock()
+		if s.sampled.counts == nil {
+			s.sampled.counts = counts
+			return
+		}
+		for tenantID, types := range counts {
+			if s.sampled.counts[tenantID] == nil {
+				s.sampled.counts[tenantID] = types
+				continue
+			}
+			for eventType, n := range types {
+				s.sampled.counts[tenantID][eventType] += n
+			}
+		}
+	}
+}
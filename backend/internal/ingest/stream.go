@@ -0,0 +1,69 @@
+package ingest
+
+import (
+	"context"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+)
+
+// Chunk collects the events of a stream so they can be committed together.
+// Each Commit is its own transaction, so a stream cut off part way leaves
+// exactly the committed chunks stored.
+type Chunk struct {
+	s      *Service
+	events []models.Event
+}
+
+// NewChunk starts an empty chunk
+func (s *Service) NewChunk() *Chunk {
+	return &Chunk{s: s}
+}
+
+// Add validates req as Ingest does and holds the event for the next
+// Commit. An event sampling rules keep from being stored is counted and
+// returned with Sampled set, but not held.
+func (c *Chunk) Add(ctx context.Context, req models.EventRequest) (*models.Event, error) {
+	event, err := c.s.prepare(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	if !event.Sampled {
+		c.events = append(c.events, *event)
+	}
+	return event, nil
+}
+
+// Len returns the number of events held for the next Commit
+func (c *Chunk) Len() int {
+	return len(c.events)
+}
+
+// Commit stores the held events in one transaction, fans them out and
+// empties the chunk, returning the events with their IDs and sequence
+// numbers in the order they were added. On error none of them were stored;
+// they are not kept as dead letters, since the producer still has them to
+// send again.
+func (c *Chunk) Commit(ctx context.Context) ([]models.Event, error) {
+	if len(c.events) == 0 {
+		return nil, nil
+	}
+	events := c.events
+	c.events = nil
+
+	store := c.s.events.EventsWithContext(ctx)
+	create := store.CreateEvents
+	if c.s.cfg.SynchronousCommit {
+		create = store.CreateEventsSynchronous
+	}
+	if err := create(events, c.s.cfg.BatchSize); err != nil {
+		return nil, errors.ErrDB("create events", err)
+	}
+
+	for i := range events {
+		metrics.EventAcked(string(AckDurable))
+		c.s.accepted(ctx, &events[i])
+	}
+	return events, nil
+}
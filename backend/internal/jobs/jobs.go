@@ -0,0 +1,181 @@
+// Package jobs runs background jobs kept in the database, such as tenant
+// exports and imports. A runner claims a queued job by counting an attempt
+// on its row and keeps it for as long as it heartbeats; a job whose
+// heartbeat stops, as when its server died, is taken over by another
+// runner and carries on from the progress its row records. A failed
+// attempt is retried at the next poll, up to maxAttempts runs, and one
+// interrupted by shutdown is queued again without counting.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/models"
+)
+
+const (
+	// heartbeatInterval is how often a running job shows it is alive
+	heartbeatInterval = 15 * time.Second
+	// staleAfter is how long a running job may go without a heartbeat
+	// before another worker takes it over
+	staleAfter = time.Minute
+	// maxAttempts bounds the runs of a job before it fails for good
+	maxAttempts = 3
+)
+
+// Job is a pointer to a background job's model, which embeds models.Job
+type Job[T any] interface {
+	*T
+	JobState() *models.Job
+}
+
+// Kind is one kind of background job, whose rows are loaded into J
+type Kind[J any] struct {
+	// Name names the kind in logs, as "export"
+	Name string
+	// Run does a claimed job's work, carrying on from the progress its row
+	// records. It returns ctx's error once ctx is cancelled, as when the
+	// job is taken over or the server shuts down.
+	Run func(ctx context.Context, job J, logger *slog.Logger) error
+	// Finish records a job's outcome, set in its models.Job, along with
+	// whatever else of the run is kept in its row
+	Finish func(db *database.Database, job J, at time.Time) error
+	// Permanent reports whether a failure would fail every attempt, so the
+	// job fails at once; nil retries every failure
+	Permanent func(err error) bool
+	// Completed returns the attributes logged when a job completes, or is
+	// nil
+	Completed func(job J) []any
+}
+
+// Runner claims queued jobs of one kind and runs them, one at a time
+type Runner[T any, J Job[T]] struct {
+	db     *database.Database
+	kind   Kind[J]
+	poll   time.Duration
+	logger *slog.Logger
+	wake   chan struct{}
+}
+
+// NewRunner creates a runner of kind's jobs that looks for them every
+// pollInterval
+func NewRunner[T any, J Job[T]](db *database.Database, kind Kind[J], pollInterval time.Duration, logger *slog.Logger) *Runner[T, J] {
+	return &Runner[T, J]{
+		db:     db,
+		kind:   kind,
+		poll:   pollInterval,
+		logger: logger.With("component", kind.Name+"s"),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Notify makes Run look for jobs now rather than at the next poll
+func (r *Runner[T, J]) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs claimable jobs every poll interval, or when notified, until ctx
+// is cancelled. A job interrupted by cancellation is queued again.
+func (r *Runner[T, J]) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.poll)
+	defer ticker.Stop()
+
+	for {
+		r.runClaimable(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+func (r *Runner[T, J]) runClaimable(ctx context.Context) {
+	for ctx.Err() == nil {
+		job := J(new(T))
+		now := time.Now().UTC()
+		claimed, err := r.db.WithContext(ctx).ClaimJob(job, now.Add(-staleAfter), now)
+		if err != nil {
+			r.logger.ErrorContext(ctx, "Failed to claim job", "error", err)
+			return
+		}
+		// A failed job is retried at the next poll rather than right away
+		if !claimed || !r.run(ctx, job) {
+			return
+		}
+	}
+}
+
+// run runs a claimed job, heartbeating meanwhile, and records the outcome.
+// It reports whether the job completed.
+func (r *Runner[T, J]) run(ctx context.Context, job J) bool {
+	state := job.JobState()
+	logger := r.logger.With("job_id", state.ID, "tenant_id", state.TenantID, "attempt", state.Attempts)
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go r.heartbeat(jobCtx, cancel, state, logger)
+
+	err := r.kind.Run(jobCtx, job, logger)
+	// The outcome is written even when ctx was cancelled for shutdown
+	db := r.db.WithContext(context.WithoutCancel(ctx))
+	switch {
+	case err == nil:
+		state.Status, state.Error = models.JobCompleted, ""
+		var attrs []any
+		if r.kind.Completed != nil {
+			attrs = r.kind.Completed(job)
+		}
+		logger.InfoContext(ctx, "Job completed", attrs...)
+	case ctx.Err() != nil:
+		// Shutting down; the next run carries on without counting this one
+		if err := db.RequeueJob(J(new(T)), state.ID, state.Attempts); err != nil {
+			logger.Error("Failed to requeue interrupted job", "error", err)
+		}
+		return false
+	case jobCtx.Err() != nil, errors.Is(err, database.ErrJobTakenOver):
+		logger.WarnContext(ctx, "Job was taken over by another worker")
+		return false
+	case state.Attempts < maxAttempts && (r.kind.Permanent == nil || !r.kind.Permanent(err)):
+		state.Status, state.Error = models.JobPending, err.Error()
+		logger.WarnContext(ctx, "Job failed, will retry", "error", err)
+	default:
+		state.Status, state.Error = models.JobFailed, err.Error()
+		logger.ErrorContext(ctx, "Job failed", "error", err)
+	}
+	if err := r.kind.Finish(db, job, time.Now().UTC()); err != nil {
+		logger.ErrorContext(ctx, "Failed to record job outcome", "error", err)
+	}
+	return state.Status == models.JobCompleted
+}
+
+// heartbeat keeps the job claimed, cancelling its run if another worker
+// took it over
+func (r *Runner[T, J]) heartbeat(ctx context.Context, cancel context.CancelFunc, state *models.Job, logger *slog.Logger) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		owned, err := r.db.WithContext(ctx).HeartbeatJob(J(new(T)), state.ID, state.Attempts, time.Now().UTC())
+		if err != nil {
+			logger.WarnContext(ctx, "Failed to record job heartbeat", "error", err)
+			continue
+		}
+		if !owned {
+			cancel()
+			return
+		}
+	}
+}
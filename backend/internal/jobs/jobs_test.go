@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/models"
+)
+
+var errBroken = errors.New("broken")
+
+func setup(t *testing.T, run func(ctx context.Context, job *models.ExportJob, logger *slog.Logger) error, permanent func(error) bool) (*database.Database, *Runner[models.ExportJob, *models.ExportJob]) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db, err := database.NewDatabase("sqlite", filepath.Join(t.TempDir(), "events.db"), 1, 1, time.Hour, 0, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateExportJob(&models.ExportJob{Job: models.Job{ID: "job-1", TenantID: "tenant-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner(db, Kind[*models.ExportJob]{
+		Name: "export",
+		Run:  run,
+		Finish: func(db *database.Database, job *models.ExportJob, at time.Time) error {
+			return db.FinishExportJob(job, at)
+		},
+		Permanent: permanent,
+	}, time.Hour, logger)
+	return db, runner
+}
+
+func loadJob(t *testing.T, db *database.Database) *models.ExportJob {
+	t.Helper()
+	job, err := db.GetExportJob("tenant-1", "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestRunnerCompletesJob(t *testing.T) {
+	db, runner := setup(t, func(_ context.Context, job *models.ExportJob, _ *slog.Logger) error {
+		job.EventCount = 42
+		return nil
+	}, nil)
+
+	runner.runClaimable(context.Background())
+
+	job := loadJob(t, db)
+	if job.Status != models.JobCompleted || job.Attempts != 1 || job.EventCount != 42 || job.CompletedAt == nil {
+		t.Fatalf("job = %+v, want completed on its first attempt with its event count", job)
+	}
+}
+
+func TestRunnerRetriesUntilMaxAttempts(t *testing.T) {
+	runs := 0
+	db, runner := setup(t, func(context.Context, *models.ExportJob, *slog.Logger) error {
+		runs++
+		return errBroken
+	}, nil)
+
+	for poll := 1; poll < maxAttempts; poll++ {
+		runner.runClaimable(context.Background())
+		if job := loadJob(t, db); job.Status != models.JobPending || job.Error != errBroken.Error() {
+			t.Fatalf("after poll %d job = %+v, want pending with the error", poll, job)
+		}
+	}
+	runner.runClaimable(context.Background())
+	runner.runClaimable(context.Background())
+
+	job := loadJob(t, db)
+	if job.Status != models.JobFailed || job.Attempts != maxAttempts || runs != maxAttempts {
+		t.Fatalf("job = %+v after %d runs, want failed after %d", job, runs, maxAttempts)
+	}
+}
+
+func TestRunnerFailsPermanentErrorsAtOnce(t *testing.T) {
+	db, runner := setup(t, func(context.Context, *models.ExportJob, *slog.Logger) error {
+		return errBroken
+	}, func(err error) bool { return errors.Is(err, errBroken) })
+
+	runner.runClaimable(context.Background())
+
+	if job := loadJob(t, db); job.Status != models.JobFailed || job.Attempts != 1 {
+		t.Fatalf("job = %+v, want failed on its first attempt", job)
+	}
+}
+
+func TestRunnerRequeuesJobInterruptedByShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db, runner := setup(t, func(ctx context.Context, _ *models.ExportJob, _ *slog.Logger) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil)
+
+	runner.runClaimable(ctx)
+
+	if job := loadJob(t, db); job.Status != models.JobPending || job.Attempts != 0 || job.Error != "" {
+		t.Fatalf("job = %+v, want pending again without the attempt counted", job)
+	}
+}
@@ -0,0 +1,166 @@
+// Package latency measures how long events take from their producer's
+// timestamp to being received, broadcast to WebSocket clients and delivered
+// to webhooks. Only a sampled share of events is tracked: ingestion stamps
+// ReceivedAt on those, and the later stages skip any event without it, so
+// the others cost a zero check.
+//
+// Each replica keeps the recent samples of the events it handled itself.
+package latency
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+)
+
+// Stages an event's latency is measured at
+const (
+	StageReceived  = "received"
+	StageBroadcast = "broadcast"
+	StageWebhook   = "webhook"
+)
+
+var stages = [...]string{StageReceived, StageBroadcast, StageWebhook}
+
+// windowSize is how many recent samples are kept per tenant and stage
+const windowSize = 256
+
+// Stats summarizes a tenant's recent samples at one stage
+type Stats struct {
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	Samples int     `json:"samples"`
+	// ClockSkewed counts the samples that reached the stage before their
+	// producer timestamp, observed as 0
+	ClockSkewed int64 `json:"clock_skewed"`
+}
+
+// window is a ring of recent samples
+type window struct {
+	samples [windowSize]time.Duration
+	n       int // samples written, the next one going to n % windowSize
+	skewed  int64
+}
+
+// Tracker samples events and records their latencies. A nil Tracker
+// samples nothing.
+type Tracker struct {
+	rate float64
+
+	mu      sync.Mutex
+	tenants map[string]*[len(stages)]window
+}
+
+// New creates a tracker sampling the given share of events, from 0 to 1
+func New(rate float64) *Tracker {
+	return &Tracker{rate: rate, tenants: make(map[string]*[len(stages)]window)}
+}
+
+// Sample reports whether an event being received should be tracked
+func (t *Tracker) Sample() bool {
+	if t == nil || t.rate <= 0 {
+		return false
+	}
+	return t.rate >= 1 || rand.Float64() < t.rate
+}
+
+// Observe records how long a tracked event took to reach stage at the given
+// time. A producer clock ahead of the server's gives a negative delta, which
+// is clamped to 0 and counted as skewed.
+func (t *Tracker) Observe(stage string, event *models.Event, at time.Time) {
+	if t == nil || event.ReceivedAt.IsZero() {
+		return
+	}
+	i := stageIndex(stage)
+	if i < 0 {
+		return
+	}
+	d := at.Sub(event.Timestamp)
+	skewed := d < 0
+	if skewed {
+		d = 0
+	}
+	metrics.EndToEndLatency(stage, d, skewed)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	windows := t.tenants[event.TenantID]
+	if windows == nil {
+		windows = new([len(stages)]window)
+		t.tenants[event.TenantID] = windows
+	}
+	w := &windows[i]
+	w.samples[w.n%windowSize] = d
+	w.n++
+	if skewed {
+		w.skewed++
+	}
+}
+
+// TenantStats returns the tenant's recent latencies by stage, leaving out
+// stages with no samples
+func (t *Tracker) TenantStats(tenantID string) map[string]Stats {
+	stats := make(map[string]Stats)
+	if t == nil {
+		return stats
+	}
+
+	t.mu.Lock()
+	windows := t.tenants[tenantID]
+	if windows == nil {
+		t.mu.Unlock()
+		return stats
+	}
+	copied := *windows
+	t.mu.Unlock()
+
+	for i, stage := range stages {
+		w := copied[i]
+		n := w.n
+		if n > windowSize {
+			n = windowSize
+		}
+		if n == 0 {
+			continue
+		}
+		samples := w.samples[:n]
+		sort.Slice(samples, func(a, b int) bool { return samples[a] < samples[b] })
+		stats[stage] = Stats{
+			P50Ms:       milliseconds(percentile(samples, 0.50)),
+			P95Ms:       milliseconds(percentile(samples, 0.95)),
+			Samples:     n,
+			ClockSkewed: w.skewed,
+		}
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of sorted samples
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func stageIndex(stage string) int {
+	for i, s := range stages {
+		if s == stage {
+			return i
+		}
+	}
+	return -1
+}
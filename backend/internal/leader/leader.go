@@ -0,0 +1,233 @@
+// Package leader elects one replica to run the background jobs that must
+// run once however many replicas share the database. The leader holds a
+// lease row it renews every third of the lease TTL; when it stops renewing,
+// because it shut down, crashed or lost the database, another replica takes
+// the lease once it expires. Replicas compare expiry times with their own
+// clocks, so clock skew between them shortens or lengthens the takeover.
+package leader
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/metrics"
+)
+
+const (
+	// leaseName is the lease row the jobs are elected by
+	leaseName = "background-jobs"
+	// releaseTimeout bounds giving up the lease on shutdown
+	releaseTimeout = 2 * time.Second
+)
+
+// Elector takes part in the election. With election disabled it always
+// leads.
+type Elector struct {
+	db     *database.Database
+	cfg    config.LeaderConfig
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	leading bool
+	// gained is closed when this replica becomes leader, and lost when it
+	// stops; each is replaced by an open channel when the other closes
+	gained chan struct{}
+	lost   chan struct{}
+	// since is when this replica last became leader, and renewed when it
+	// last took or renewed the lease
+	since   time.Time
+	renewed time.Time
+}
+
+// Status is the election as this replica sees it
+type Status struct {
+	Enabled    bool   `json:"enabled"`
+	InstanceID string `json:"instance_id"`
+	Leading    bool   `json:"leading"`
+	// LeadingSince is when this replica became leader
+	LeadingSince *time.Time `json:"leading_since,omitempty"`
+	// Leader is the lease holder, and LeaseExpiresAt when its lease runs
+	// out unless renewed; both are empty while no one holds it
+	Leader         string     `json:"leader,omitempty"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	LeaseTTL       string     `json:"lease_ttl"`
+}
+
+// New creates an elector
+func New(db *database.Database, cfg config.LeaderConfig, logger *slog.Logger) *Elector {
+	e := &Elector{
+		db:     db,
+		cfg:    cfg,
+		logger: logger.With("component", "leader", "instance_id", cfg.InstanceID),
+		gained: make(chan struct{}),
+		lost:   make(chan struct{}),
+	}
+	if !cfg.Enabled {
+		e.setLeading(true)
+	}
+	return e
+}
+
+// Run takes part in the election until ctx is cancelled, then gives up
+// the lease if it holds it. It returns at once when election is disabled.
+func (e *Elector) Run(ctx context.Context) {
+	if !e.cfg.Enabled {
+		return
+	}
+
+	ticker := time.NewTicker(e.cfg.LeaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		e.campaign(ctx)
+		select {
+		case <-ctx.Done():
+			e.resign()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign takes or renews the lease. A leader that cannot renew steps down
+// after failing twice, before its lease expires and another replica may
+// take it.
+func (e *Elector) campaign(ctx context.Context) {
+	now := time.Now().UTC()
+	acquired, err := e.db.WithContext(ctx).AcquireLease(leaseName, e.cfg.InstanceID, now, now.Add(e.cfg.LeaseTTL))
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		e.logger.ErrorContext(ctx, "Failed to renew leader lease", "error", err)
+		e.mu.Lock()
+		expiring := e.leading && !now.Before(e.renewed.Add(e.cfg.LeaseTTL*2/3))
+		e.mu.Unlock()
+		if expiring {
+			e.setLeading(false)
+		}
+		return
+	}
+
+	if acquired {
+		e.mu.Lock()
+		e.renewed = now
+		e.mu.Unlock()
+	}
+	e.setLeading(acquired)
+}
+
+// resign steps down and releases the lease so another replica takes over
+// without waiting for it to expire
+func (e *Elector) resign() {
+	if !e.IsLeader() {
+		return
+	}
+	e.setLeading(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	if err := e.db.WithContext(ctx).ReleaseLease(leaseName, e.cfg.InstanceID); err != nil {
+		e.logger.Warn("Failed to release leader lease", "error", err)
+	}
+}
+
+// setLeading records whether this replica leads and wakes the jobs waiting
+// for the change
+func (e *Elector) setLeading(leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if leading == e.leading {
+		return
+	}
+	e.leading = leading
+	if leading {
+		e.since = time.Now().UTC()
+		close(e.gained)
+		e.lost = make(chan struct{})
+	} else {
+		close(e.lost)
+		e.gained = make(chan struct{})
+	}
+	metrics.LeaderChanged(leading)
+	if e.cfg.Enabled {
+		if leading {
+			e.logger.Info("Became leader, running background jobs")
+		} else {
+			e.logger.Warn("No longer leader, stopping background jobs")
+		}
+	}
+}
+
+// IsLeader reports whether this replica leads
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// Lead runs job while this replica leads, until ctx is cancelled. job's
+// context is cancelled when leadership is lost, and job is started again
+// when it is regained; Lead returns once job has returned.
+func (e *Elector) Lead(ctx context.Context, job func(context.Context)) {
+	for {
+		e.mu.Lock()
+		gained := e.gained
+		e.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-gained:
+		}
+
+		e.mu.Lock()
+		lost := e.lost
+		e.mu.Unlock()
+		jobCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			job(jobCtx)
+		}()
+		select {
+		case <-ctx.Done():
+		case <-lost:
+		}
+		cancel()
+		<-done
+	}
+}
+
+// Status returns the election as this replica sees it, reading the lease
+// from the database
+func (e *Elector) Status(ctx context.Context) (Status, error) {
+	e.mu.Lock()
+	status := Status{
+		Enabled:    e.cfg.Enabled,
+		InstanceID: e.cfg.InstanceID,
+		Leading:    e.leading,
+		LeaseTTL:   e.cfg.LeaseTTL.String(),
+	}
+	if e.leading {
+		since := e.since
+		status.LeadingSince = &since
+	}
+	e.mu.Unlock()
+	if !e.cfg.Enabled {
+		return status, nil
+	}
+
+	lease, err := e.db.WithContext(ctx).GetLease(leaseName)
+	if err != nil {
+		return status, err
+	}
+	if lease != nil && lease.ExpiresAt.After(time.Now()) {
+		status.Leader = lease.Holder
+		expires := lease.ExpiresAt.UTC()
+		status.LeaseExpiresAt = &expires
+	}
+	return status, nil
+}
@@ -0,0 +1,56 @@
+package lifecycle
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// step is one stage of the shutdown sequence
+type step struct {
+	name    string
+	timeout time.Duration
+	fn      func(ctx context.Context) error
+}
+
+// Manager runs shutdown steps in the order they were added. Each step gets
+// its own timeout, so a stuck step cannot eat the budget of the ones after
+// it, and a failed step does not stop the sequence.
+type Manager struct {
+	steps  []step
+	logger *slog.Logger
+}
+
+// New creates an empty shutdown sequence
+func New(logger *slog.Logger) *Manager {
+	return &Manager{logger: logger.With("component", "lifecycle")}
+}
+
+// Add appends a step. A zero timeout gives the step a background context.
+func (m *Manager) Add(name string, timeout time.Duration, fn func(ctx context.Context) error) {
+	m.steps = append(m.steps, step{name: name, timeout: timeout, fn: fn})
+}
+
+// Shutdown runs every step and reports whether all of them succeeded
+func (m *Manager) Shutdown() bool {
+	ok := true
+	for _, s := range m.steps {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if s.timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		}
+
+		start := time.Now()
+		err := s.fn(ctx)
+		cancel()
+
+		durationMs := float64(time.Since(start).Microseconds()) / 1000
+		if err != nil {
+			ok = false
+			m.logger.Error("Shutdown step failed", "step", s.name, "duration_ms", durationMs, "error", err)
+			continue
+		}
+		m.logger.Info("Shutdown step complete", "step", s.name, "duration_ms", durationMs)
+	}
+	return ok
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	gormlogger "gorm.io/gorm/logger"
+
+	"gorm.io/gorm"
+)
+
+// slowQueryThreshold is the duration above which queries are logged as warnings
+const slowQueryThreshold = 200 * time.Millisecond
+
+// GormLogger adapts slog to GORM's logger interface. SQL statements are
+// logged at debug level, slow queries at warn and failures at error.
+type GormLogger struct {
+	logger *slog.Logger
+}
+
+// NewGormLogger creates a GORM logger writing to the given slog logger
+func NewGormLogger(logger *slog.Logger) *GormLogger {
+	return &GormLogger{logger: logger.With("component", "database")}
+}
+
+// LogMode implements gormlogger.Interface. Verbosity follows the slog level instead.
+func (l *GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+// Info implements gormlogger.Interface
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.InfoContext(ctx, msg, "args", args)
+}
+
+// Warn implements gormlogger.Interface
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.WarnContext(ctx, msg, "args", args)
+}
+
+// Error implements gormlogger.Interface
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.ErrorContext(ctx, msg, "args", args)
+}
+
+// Trace implements gormlogger.Interface
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		l.logger.ErrorContext(ctx, "query failed", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds(), "error", err)
+	case elapsed > slowQueryThreshold:
+		sql, rows := fc()
+		l.logger.WarnContext(ctx, "slow query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	case l.logger.Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		l.logger.DebugContext(ctx, "query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	}
+}
@@ -0,0 +1,143 @@
+package logging_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/logging"
+	"event-ingestion-system/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// records decodes the JSON lines written to buf
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", scanner.Text(), err)
+		}
+		out = append(out, record)
+	}
+	return out
+}
+
+func TestRequestLineFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(config.LoggingConfig{Level: "info", Format: "json"}, &buf)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.RequestID())
+	router.Use(middleware.RequestLogger(logger, func(*gin.Context) string { return "" }))
+	router.GET("/api/v1/events", func(c *gin.Context) {
+		c.Set("tenant_id", "tenant-1")
+		c.String(http.StatusOK, "hello")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/events", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := records(t, &buf)
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines, want one request line", len(lines))
+	}
+	line := lines[0]
+	for field, want := range map[string]any{
+		"level":      "INFO",
+		"msg":        "request",
+		"method":     "GET",
+		"path":       "/api/v1/events",
+		"status":     float64(http.StatusOK),
+		"bytes":      float64(len("hello")),
+		"tenant_id":  "tenant-1",
+		"request_id": "req-1",
+	} {
+		if line[field] != want {
+			t.Errorf("%s = %v, want %v", field, line[field], want)
+		}
+	}
+	if latency, ok := line["latency_ms"].(float64); !ok || latency < 0 {
+		t.Errorf("latency_ms = %v, want a duration", line["latency_ms"])
+	}
+	if _, err := time.Parse(time.RFC3339Nano, line["time"].(string)); err != nil {
+		t.Errorf("time = %v: %v", line["time"], err)
+	}
+}
+
+// TestDebugLevelLogsSQL checks that the GORM adapter logs every statement
+// at debug level and none at info
+func TestDebugLevelLogsSQL(t *testing.T) {
+	for _, tc := range []struct {
+		level   string
+		wantSQL bool
+	}{
+		{"debug", true},
+		{"info", false},
+	} {
+		t.Run(tc.level, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := logging.New(config.LoggingConfig{Level: tc.level, Format: "json"}, &buf)
+			db, err := database.NewDatabase("sqlite", filepath.Join(t.TempDir(), "events.db"), 1, 1, time.Hour, 0, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if err := db.DB.Exec("SELECT 42").Error; err != nil {
+				t.Fatal(err)
+			}
+
+			var found bool
+			for _, line := range records(t, &buf) {
+				if line["msg"] == "query" && line["component"] == "database" && line["sql"] == "SELECT 42" {
+					found = true
+					if line["level"] != "DEBUG" {
+						t.Errorf("query logged at %v, want DEBUG", line["level"])
+					}
+				}
+			}
+			if found != tc.wantSQL {
+				t.Fatalf("SQL logged = %v at %s level, want %v", found, tc.level, tc.wantSQL)
+			}
+		})
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(config.LoggingConfig{Level: "warn", Format: "text"}, &buf)
+	logger.Info("dropped")
+	logger.Warn("kept", "tenant_id", "tenant-1")
+	if got := buf.String(); strings.Contains(got, "dropped") || !strings.Contains(got, "level=WARN msg=kept tenant_id=tenant-1") {
+		t.Fatalf("output = %q, want only the warning in key=value form", got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]slog.Level{
+		"debug":   slog.LevelDebug,
+		"DEBUG":   slog.LevelDebug,
+		"info":    slog.LevelInfo,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+		"verbose": slog.LevelInfo,
+		"":        slog.LevelInfo,
+	} {
+		if got := logging.ParseLevel(name); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package maintenance
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// settingKey is the system setting that persists the maintenance state
+const settingKey = "maintenance"
+
+// DefaultRetryAfter is the Retry-After hint, in seconds, when none is set
+const DefaultRetryAfter = 60
+
+// State describes whether maintenance mode is on and what clients are told
+type State struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message,omitempty"`
+	RetryAfter int        `json:"retry_after"` // seconds
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+// Mode holds the current maintenance state in memory and persists changes
+// so the mode survives restarts
+type Mode struct {
+	db *database.Database
+
+	mu    sync.RWMutex
+	state State
+}
+
+// New creates a Mode backed by db. Call Load to restore the persisted state.
+func New(db *database.Database) *Mode {
+	return &Mode{db: db}
+}
+
+// Load restores the persisted state; a missing setting means disabled
+func (m *Mode) Load() error {
+	setting, err := m.db.GetSetting(settingKey)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state State
+	if err := json.Unmarshal([]byte(setting.Value), &state); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.state = state
+	m.mu.Unlock()
+	return nil
+}
+
+// State returns the current maintenance state
+func (m *Mode) State() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Enabled reports whether maintenance mode is on
+func (m *Mode) Enabled() bool {
+	return m.State().Enabled
+}
+
+// Set persists and applies a new state. Since is stamped when the mode is
+// switched on and kept while it stays on.
+func (m *Mode) Set(state State) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if state.RetryAfter <= 0 {
+		state.RetryAfter = DefaultRetryAfter
+	}
+	switch {
+	case !state.Enabled:
+		state.Since = nil
+	case m.state.Enabled:
+		state.Since = m.state.Since
+	default:
+		now := time.Now().UTC()
+		state.Since = &now
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return m.state, err
+	}
+	if err := m.db.PutSetting(settingKey, string(data)); err != nil {
+		return m.state, err
+	}
+
+	m.state = state
+	return state, nil
+}
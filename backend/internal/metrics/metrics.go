@@ -0,0 +1,483 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/version"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "event_system"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	// tenantLabels controls whether per-tenant series carry the tenant ID
+	tenantLabels bool
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	ingestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ingest_duration_seconds",
+		Help:      "Time from receiving an event to acknowledging it, by acknowledgment level (none, received, durable).",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"ack"})
+
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	eventsIngested = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_ingested_total",
+		Help:      "Events accepted and persisted.",
+	}, []string{"tenant_id"})
+
+	eventsSampled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_sampled_total",
+		Help:      "Events accepted but not persisted or delivered, by a tenant's sampling rules.",
+	}, []string{"tenant_id"})
+
+	transformRuleFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transform_rule_failures_total",
+		Help:      "Transformation rules that could not apply to an event, by outcome (skipped or rejected).",
+	}, []string{"outcome"})
+
+	eventsAcked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_acked_total",
+		Help:      "Events accepted for ingestion by acknowledgment level (none, received, durable).",
+	}, []string{"ack"})
+
+	ingestBufferEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_buffer_events_total",
+		Help:      "Events handled by the ingest buffer by outcome (written, failed, dropped, rejected).",
+	}, []string{"outcome"})
+
+	ingestQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ingest_queue_depth",
+		Help:      "Events acknowledged but not yet written.",
+	})
+
+	rateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the per-tenant rate limiter.",
+	}, []string{"tenant_id"})
+
+	requestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "requests_in_flight",
+		Help:      "Requests running in each concurrency-limited route group.",
+	}, []string{"group"})
+
+	requestsQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "requests_queued",
+		Help:      "Requests waiting for a slot in each concurrency-limited route group.",
+	}, []string{"group"})
+
+	requestsShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_shed_total",
+		Help:      "Requests answered 503 by a route group's concurrency limit, by reason (queue_full, queue_timeout).",
+	}, []string{"group", "reason"})
+
+	wsConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Currently connected WebSocket clients.",
+	})
+
+	wsMessagesSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_messages_sent_total",
+		Help:      "Messages written to WebSocket clients.",
+	})
+
+	sinkEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sink_events_total",
+		Help:      "Events forwarded to external sinks by sink and outcome (published, failed, dropped).",
+	}, []string{"sink", "outcome"})
+
+	sinkQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sink_queue_depth",
+		Help:      "Events buffered for delivery to each external sink.",
+	}, []string{"sink"})
+
+	natsMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nats_messages_total",
+		Help:      "Messages consumed from NATS by outcome (ingested, rejected, retried).",
+	}, []string{"outcome"})
+
+	mqttMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_messages_total",
+		Help:      "Messages received by the MQTT bridge by outcome (ingested, unauthorized, rejected, failed).",
+	}, []string{"outcome"})
+
+	dbPoolSaturation = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "db_pool_saturation",
+		Help:      "Share of the maximum open database connections in use, sampled on an interval.",
+	})
+
+	leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader",
+		Help:      "1 while this instance runs the background jobs that run on one replica, else 0.",
+	})
+
+	dbAcquireTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_acquire_timeouts_total",
+		Help:      "Queries that gave up waiting for a database connection.",
+	})
+
+	// dbAcquireTimeoutsSeen is the pool's timeout count at the last sample
+	dbAcquireTimeoutsSeen int64
+
+	dbWriteConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_write_conflicts_total",
+		Help:      "Write transactions that hit a serialization failure or deadlock, by outcome: retried, or exhausted when out of retries.",
+	}, []string{"outcome"})
+
+	buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Build information; always 1.",
+	}, []string{"version", "commit", "build_date", "go_version"})
+
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by outcome (success, retry, failure, dropped, held).",
+	}, []string{"outcome"})
+
+	webhookDeliveryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_errors_total",
+		Help:      "Failed webhook delivery attempts recorded on the webhook, by status (http_error, timeout, connect_timeout, dns_error, tls_error, connection_error, proxy_error, redirect_refused, forbidden_address, error).",
+	}, []string{"status"})
+
+	deadLetters = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dead_letters_total",
+		Help:      "Dead letters recorded by source (ingest, sink, webhook) and outcome (stored, spilled, lost).",
+	}, []string{"source", "outcome"})
+
+	tenantCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tenant_cache_lookups_total",
+		Help:      "Tenant cache lookups by result (hit, miss).",
+	}, []string{"result"})
+
+	eventPayloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_payloads_total",
+		Help:      "Event payloads pushed by channel (webhook, websocket) and payload version, to see who is still on version 1.",
+	}, []string{"channel", "version"})
+
+	notificationsMuted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_muted_total",
+		Help:      "Messages held back from tenants whose notifications are muted, by channel (websocket, webhook).",
+	}, []string{"channel"})
+
+	endToEndLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "event_end_to_end_latency_seconds",
+		Help:      "Time from a sampled event's producer timestamp to its being received, broadcast to WebSocket clients or delivered to a webhook, by stage. Negative times are observed as 0.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600},
+	}, []string{"stage"})
+
+	clockSkew = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_clock_skew_total",
+		Help:      "Sampled events that reached a stage before their producer timestamp, by stage; their producer's clock is ahead.",
+	}, []string{"stage"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		ingestDuration,
+		httpRequestsTotal,
+		eventsIngested,
+		eventsSampled,
+		transformRuleFailures,
+		eventsAcked,
+		ingestBufferEvents,
+		ingestQueueDepth,
+		rateLimitRejections,
+		requestsInFlight,
+		requestsQueued,
+		requestsShed,
+		wsConnections,
+		wsMessagesSent,
+		webhookDeliveries,
+		webhookDeliveryErrors,
+		deadLetters,
+		sinkEvents,
+		sinkQueueDepth,
+		natsMessages,
+		mqttMessages,
+		dbPoolSaturation,
+		dbAcquireTimeouts,
+		dbWriteConflicts,
+		leader,
+		tenantCacheLookups,
+		eventPayloads,
+		notificationsMuted,
+		endToEndLatency,
+		clockSkew,
+		buildInfo,
+	)
+
+	info := version.Get()
+	buildInfo.WithLabelValues(info.Version, info.Commit, info.BuildDate, info.GoVersion).Set(1)
+}
+
+// Configure applies the metrics configuration
+func Configure(cfg config.MetricsConfig) {
+	tenantLabels = cfg.TenantLabels
+}
+
+// dbStats collects the pool stats of the database last registered
+var dbStats prometheus.Collector
+
+// RegisterDB exposes connection pool stats, collected on every scrape. A
+// later call, from an app started again in the same process, replaces the
+// earlier database.
+func RegisterDB(db *sql.DB) {
+	if dbStats != nil {
+		registry.Unregister(dbStats)
+	}
+	dbStats = collectors.NewDBStatsCollector(db, "main")
+	registry.MustRegister(dbStats)
+}
+
+// DBPoolSampled records a sample of the connection pool: the share of
+// connections in use and the running count of acquisition timeouts. Only
+// the pool monitor calls it.
+func DBPoolSampled(saturation float64, acquireTimeouts int64) {
+	dbPoolSaturation.Set(saturation)
+	if acquireTimeouts > dbAcquireTimeoutsSeen {
+		dbAcquireTimeouts.Add(float64(acquireTimeouts - dbAcquireTimeoutsSeen))
+		dbAcquireTimeoutsSeen = acquireTimeouts
+	}
+}
+
+// DBWriteConflict counts a write transaction that conflicted with
+// concurrent ones and was retried or, out of retries, failed
+func DBWriteConflict(outcome string) {
+	dbWriteConflicts.WithLabelValues(outcome).Inc()
+}
+
+// LeaderChanged records whether this instance leads
+func LeaderChanged(leading bool) {
+	if leading {
+		leader.Set(1)
+	} else {
+		leader.Set(0)
+	}
+}
+
+// Handler returns the HTTP handler serving the metrics registry. Scrapers
+// that accept OpenMetrics get it, with the exemplars linking latencies to
+// traces.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+// observe records v, with the trace as exemplar when traceID is set
+func observe(o prometheus.Observer, v float64, traceID string) {
+	if traceID != "" {
+		if eo, ok := o.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(v, prometheus.Labels{"trace_id": traceID})
+			return
+		}
+	}
+	o.Observe(v)
+}
+
+// Middleware records request count and latency per route. traceID returns
+// the request's sampled trace, or "", which its latency then carries as
+// exemplar; the tracing middleware must run before this one.
+func Middleware(traceID func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		// Use the route template rather than the raw path to bound cardinality
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		observe(httpRequestDuration.WithLabelValues(route, c.Request.Method, status), time.Since(start).Seconds(), traceID(c))
+		httpRequestsTotal.WithLabelValues(route, c.Request.Method, status).Inc()
+	}
+}
+
+// EventIngested counts a persisted event
+func EventIngested(tenantID string) {
+	eventsIngested.WithLabelValues(tenantLabel(tenantID)).Inc()
+}
+
+// EventSampled counts an event sampled out instead of persisted
+func EventSampled(tenantID string) {
+	eventsSampled.WithLabelValues(tenantLabel(tenantID)).Inc()
+}
+
+// TransformRuleFailed counts a transformation rule that could not apply,
+// skipped or rejecting its event
+func TransformRuleFailed(outcome string) {
+	transformRuleFailures.WithLabelValues(outcome).Inc()
+}
+
+// EventAcked counts an event accepted at an acknowledgment level
+func EventAcked(ack string) {
+	eventsAcked.WithLabelValues(ack).Inc()
+}
+
+// IngestDuration records how long an event took to reach its acknowledgment
+// level, with traceID, when set, as exemplar
+func IngestDuration(ack string, d time.Duration, traceID string) {
+	observe(ingestDuration.WithLabelValues(ack), d.Seconds(), traceID)
+}
+
+// IngestBufferEvent counts an event handled by the ingest buffer by outcome
+func IngestBufferEvent(outcome string) {
+	ingestBufferEvents.WithLabelValues(outcome).Inc()
+}
+
+// IngestQueueDepth records the number of events waiting to be written
+func IngestQueueDepth(depth int) {
+	ingestQueueDepth.Set(float64(depth))
+}
+
+// RateLimitRejected counts a request rejected by the rate limiter
+func RateLimitRejected(tenantID string) {
+	rateLimitRejections.WithLabelValues(tenantLabel(tenantID)).Inc()
+}
+
+// RequestsInFlight records the requests running in a route group
+func RequestsInFlight(group string, n int) {
+	requestsInFlight.WithLabelValues(group).Set(float64(n))
+}
+
+// RequestsQueued records the requests waiting in a route group
+func RequestsQueued(group string, n int) {
+	requestsQueued.WithLabelValues(group).Set(float64(n))
+}
+
+// RequestShed counts a request a route group's concurrency limit turned
+// away
+func RequestShed(group, reason string) {
+	requestsShed.WithLabelValues(group, reason).Inc()
+}
+
+// WebSocketMessageSent counts a message written to a WebSocket client
+// outside its send buffer, such as a replayed event
+func WebSocketMessageSent() {
+	wsMessagesSent.Inc()
+}
+
+// WebhookDelivery counts a webhook delivery attempt by outcome
+func WebhookDelivery(outcome string) {
+	webhookDeliveries.WithLabelValues(outcome).Inc()
+}
+
+// WebhookDeliveryError counts a failed webhook delivery attempt by status,
+// such as timeout or dns_error
+func WebhookDeliveryError(status string) {
+	webhookDeliveryErrors.WithLabelValues(status).Inc()
+}
+
+// DeadLetter counts a dead letter by source and where it was written
+func DeadLetter(source, outcome string) {
+	deadLetters.WithLabelValues(source, outcome).Inc()
+}
+
+// SinkEvent counts an event forwarded to an external sink by outcome
+func SinkEvent(sink, outcome string) {
+	sinkEvents.WithLabelValues(sink, outcome).Inc()
+}
+
+// SinkQueueDepth records the number of events buffered for a sink
+func SinkQueueDepth(sink string, depth int) {
+	sinkQueueDepth.WithLabelValues(sink).Set(float64(depth))
+}
+
+// NATSMessage records the outcome of a message consumed from NATS
+func NATSMessage(outcome string) {
+	natsMessages.WithLabelValues(outcome).Inc()
+}
+
+// MQTTMessage records the outcome of a message received by the MQTT bridge
+func MQTTMessage(outcome string) {
+	mqttMessages.WithLabelValues(outcome).Inc()
+}
+
+// TenantCacheLookup counts a tenant cache lookup by result
+func TenantCacheLookup(result string) {
+	tenantCacheLookups.WithLabelValues(result).Inc()
+}
+
+// EventPayload counts an event payload pushed over channel in version
+func EventPayload(channel string, version int) {
+	eventPayloads.WithLabelValues(channel, strconv.Itoa(version)).Inc()
+}
+
+// NotificationMuted counts a message held back from a muted tenant on a
+// channel
+func NotificationMuted(channel string) {
+	notificationsMuted.WithLabelValues(channel).Inc()
+}
+
+// EndToEndLatency records how long a sampled event took to reach stage
+// since its producer timestamp; skewed marks one that arrived before it,
+// observed as 0
+func EndToEndLatency(stage string, d time.Duration, skewed bool) {
+	if skewed {
+		clockSkew.WithLabelValues(stage).Inc()
+	}
+	endToEndLatency.WithLabelValues(stage).Observe(d.Seconds())
+}
+
+// tenantLabel returns the tenant label value, or empty when tenant labels are disabled
+func tenantLabel(tenantID string) string {
+	if !tenantLabels {
+		return ""
+	}
+	return tenantID
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WebSocket hub instrumentation beyond the connection gauge and sent
+// counter. Everything the hub calls while broadcasting is a pre-bound
+// series, so recording takes no lock.
+var (
+	wsTenantConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_tenant_connections",
+		Help:      "Currently connected WebSocket clients per tenant; only recorded with metrics.tenant_labels.",
+	}, []string{"tenant_id"})
+
+	wsRegistrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_registrations_total",
+		Help:      "WebSocket clients registered with the hub.",
+	})
+
+	wsUnregistrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_unregistrations_total",
+		Help:      "WebSocket clients removed from the hub, whether they left or were dropped.",
+	})
+
+	wsMessagesDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_messages_dropped_total",
+		Help:      "Messages not delivered by reason (slow_client: the client was disconnected for a full send buffer, buffer_full: the message was skipped, queue_full: the broadcast queue was full).",
+	}, []string{"reason"})
+
+	wsReplaysTruncated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_replays_truncated_total",
+		Help:      "Replays stopped at the replay limit, leaving the client to page through the rest.",
+	})
+
+	wsOversizedClosures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_oversized_closures_total",
+		Help:      "WebSocket clients closed with 1009 for sending a message over websocket.max_message_size.",
+	})
+
+	wsBroadcastLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "websocket_broadcast_latency_seconds",
+		Help:      "Time from a message being queued for a client to its being written.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	})
+
+	wsSendBuffers = &sendBufferCollector{desc: prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "websocket_send_buffer_length"),
+		"Messages waiting in each WebSocket client's send buffer, sampled on scrape.",
+		nil, nil,
+	)}
+
+	wsDroppedSlowClient = wsMessagesDropped.WithLabelValues("slow_client")
+	wsDroppedBufferFull = wsMessagesDropped.WithLabelValues("buffer_full")
+	wsDroppedQueueFull  = wsMessagesDropped.WithLabelValues("queue_full")
+)
+
+// sendBufferBuckets are the upper bounds of the send buffer histogram; a
+// client's buffer holds 256 messages
+var sendBufferBuckets = []float64{0, 1, 4, 16, 64, 128, 255}
+
+func init() {
+	registry.MustRegister(
+		wsTenantConnections,
+		wsRegistrations,
+		wsUnregistrations,
+		wsMessagesDropped,
+		wsReplaysTruncated,
+		wsOversizedClosures,
+		wsBroadcastLatency,
+		wsSendBuffers,
+	)
+}
+
+// sendBufferCollector turns the send buffer lengths of the hub registered
+// with SampleWebSocketBuffers into a histogram on every scrape
+type sendBufferCollector struct {
+	desc   *prometheus.Desc
+	sample atomic.Pointer[func() []int]
+}
+
+func (s *sendBufferCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.desc
+}
+
+func (s *sendBufferCollector) Collect(ch chan<- prometheus.Metric) {
+	sample := s.sample.Load()
+	if sample == nil {
+		return
+	}
+	lengths := (*sample)()
+	buckets := make(map[float64]uint64, len(sendBufferBuckets))
+	sum := 0
+	for _, n := range lengths {
+		sum += n
+		for _, bound := range sendBufferBuckets {
+			if float64(n) <= bound {
+				buckets[bound]++
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstHistogram(s.desc, uint64(len(lengths)), float64(sum), buckets)
+}
+
+// SampleWebSocketBuffers registers the function returning the length of
+// every client's send buffer, called on each scrape
+func SampleWebSocketBuffers(sample func() []int) {
+	wsSendBuffers.sample.Store(&sample)
+}
+
+// WebSocketRegistered counts a client registered for a tenant
+func WebSocketRegistered(tenantID string) {
+	wsConnections.Inc()
+	wsRegistrations.Inc()
+	if tenantLabels {
+		wsTenantConnections.WithLabelValues(tenantID).Inc()
+	}
+}
+
+// WebSocketUnregistered counts a client of a tenant removed from the hub
+func WebSocketUnregistered(tenantID string) {
+	wsConnections.Dec()
+	wsUnregistrations.Inc()
+	if tenantLabels {
+		wsTenantConnections.WithLabelValues(tenantID).Dec()
+	}
+}
+
+// WebSocketMessageWritten counts a message written to a client queued
+// since queued
+func WebSocketMessageWritten(queued time.Time) {
+	wsMessagesSent.Inc()
+	wsBroadcastLatency.Observe(time.Since(queued).Seconds())
+}
+
+// WebSocketClientDropped counts a message lost with a client disconnected
+// for its full send buffer
+func WebSocketClientDropped() {
+	wsDroppedSlowClient.Inc()
+}
+
+// WebSocketMessageSkipped counts a message skipped for a client whose send
+// buffer was full
+func WebSocketMessageSkipped() {
+	wsDroppedBufferFull.Inc()
+}
+
+// WebSocketNoticeDropped counts a notice dropped for a full broadcast queue
+func WebSocketNoticeDropped() {
+	wsDroppedQueueFull.Inc()
+}
+
+// WebSocketReplayTruncated counts a replay stopped at the replay limit
+func WebSocketReplayTruncated() {
+	wsReplaysTruncated.Inc()
+}
+
+// WebSocketOversizedClosure counts a client closed for a message over the
+// size limit
+func WebSocketOversizedClosure() {
+	wsOversizedClosures.Inc()
+}
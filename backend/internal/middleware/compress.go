@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"event-ingestion-system/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// incompressibleTypes are content types that are already compressed
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/octet-stream",
+}
+
+// Compress gzips responses for clients that accept it. Bodies are buffered
+// up to MinSize so small responses go out uncompressed; an explicit Flush
+// starts compression early so streaming responses still flush incrementally.
+// WebSocket upgrades and server-sent event streams are never compressed.
+func Compress(cfg config.CompressionConfig) gin.HandlerFunc {
+	level := cfg.Level
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+
+	pool := sync.Pool{
+		New: func() interface{} {
+			gz, _ := gzip.NewWriterLevel(nil, level)
+			return gz
+		},
+	}
+
+	return func(c *gin.Context) {
+		if !cfg.Enabled || !acceptsGzip(c.Request) || isStreamingRequest(c.Request) {
+			c.Next()
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: c.Writer,
+			pool:           &pool,
+			minSize:        cfg.MinSize,
+		}
+		c.Writer = cw
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		c.Next()
+
+		cw.finish()
+		c.Writer = cw.ResponseWriter
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.TrimSpace(coding)
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isStreamingRequest reports whether the request is a WebSocket upgrade or
+// asks for a server-sent event stream
+func isStreamingRequest(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// compressWriter buffers the start of the body until it knows whether the
+// response is worth compressing, then either gzips or passes it through
+type compressWriter struct {
+	gin.ResponseWriter
+
+	pool    *sync.Pool
+	minSize int
+
+	buf     []byte
+	gz      *gzip.Writer
+	decided bool
+}
+
+// Write implements http.ResponseWriter
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if w.ResponseWriter.Written() {
+			// Headers already went out, so the encoding can no longer change
+			w.decided = true
+		} else if len(w.buf)+len(b) < w.minSize {
+			w.buf = append(w.buf, b...)
+			return len(b), nil
+		} else {
+			w.start(true)
+		}
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow implements gin.ResponseWriter. Sending headers without a
+// body fixes the response as uncompressed.
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.start(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Written reports whether the response has started, including buffered bytes
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// Flush implements http.Flusher. Flushing commits to compression regardless
+// of size, since the handler is streaming.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.start(true)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes out whatever is still buffered and closes the gzip stream
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.start(len(w.buf) >= w.minSize)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		w.gz.Reset(nil)
+		w.pool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// start decides on the encoding and writes out the buffered bytes
+func (w *compressWriter) start(compress bool) {
+	w.decided = true
+
+	if compress && w.compressible() {
+		header := w.ResponseWriter.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	if len(w.buf) > 0 {
+		buf := w.buf
+		w.buf = nil
+		if w.gz != nil {
+			w.gz.Write(buf)
+		} else {
+			w.ResponseWriter.Write(buf)
+		}
+	}
+}
+
+// compressible reports whether the status and headers allow compression
+func (w *compressWriter) compressible() bool {
+	status := w.ResponseWriter.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	header := w.ResponseWriter.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "text/event-stream") {
+		return false
+	}
+	for _, t := range incompressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compressServer serves router behind Compress and returns a client that
+// leaves the encoding to the test
+func compressServer(t *testing.T, register func(*gin.Engine)) (*httptest.Server, *http.Client) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Compress(config.CompressionConfig{Enabled: true, Level: -1, MinSize: 1024}))
+	register(router)
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	return ts, &http.Client{Transport: &http.Transport{DisableCompression: true}}
+}
+
+func get(t *testing.T, client *http.Client, url, acceptEncoding string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestCompressHeaders(t *testing.T) {
+	large := strings.Repeat(`{"event_type":"page.view"},`, 100)
+	ts, client := compressServer(t, func(r *gin.Engine) {
+		r.GET("/large", func(c *gin.Context) { c.String(http.StatusOK, large) })
+		r.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+		// A length set before compression must not be sent with the
+		// compressed body
+		r.GET("/sized", func(c *gin.Context) {
+			c.Header("Content-Length", strconv.Itoa(len(large)))
+			c.String(http.StatusOK, large)
+		})
+		r.GET("/image", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(large)) })
+		r.GET("/empty", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	})
+
+	for _, tc := range []struct {
+		path, acceptEncoding string
+		gzipped              bool
+		body                 string
+	}{
+		{"/large", "gzip", true, large},
+		{"/large", "br, gzip;q=0.5", true, large},
+		{"/large", "", false, large},
+		{"/large", "gzip;q=0", false, large},
+		{"/small", "gzip", false, "ok"},
+		{"/sized", "gzip", true, large},
+		{"/image", "gzip", false, large},
+		{"/empty", "gzip", false, ""},
+	} {
+		t.Run(tc.path+" "+tc.acceptEncoding, func(t *testing.T) {
+			resp := get(t, client, ts.URL+tc.path, tc.acceptEncoding)
+			raw, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Whatever length is sent is that of the bytes sent, which
+			// net/http may set itself for bodies it buffered whole
+			if resp.ContentLength >= 0 && resp.ContentLength != int64(len(raw)) {
+				t.Fatalf("Content-Length = %d, want the %d bytes sent", resp.ContentLength, len(raw))
+			}
+			data := raw
+			if tc.gzipped {
+				if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+					t.Fatalf("Content-Encoding = %q, want gzip", got)
+				}
+				gz, err := gzip.NewReader(bytes.NewReader(raw))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if data, err = io.ReadAll(gz); err != nil {
+					t.Fatal(err)
+				}
+			} else if got := resp.Header.Get("Content-Encoding"); got != "" {
+				t.Fatalf("Content-Encoding = %q, want none", got)
+			}
+			if string(data) != tc.body {
+				t.Fatalf("body = %d bytes, want %d", len(data), len(tc.body))
+			}
+			if tc.gzipped && !strings.Contains(resp.Header.Get("Vary"), "Accept-Encoding") {
+				t.Fatalf("Vary = %q, want Accept-Encoding", resp.Header.Get("Vary"))
+			}
+		})
+	}
+}
+
+// TestCompressFlushesStreamsIncrementally streams an export-like response
+// whose second line is only written once the client has read the first, so
+// it deadlocks unless the first line reaches the client compressed at Flush
+func TestCompressFlushesStreamsIncrementally(t *testing.T) {
+	read := make(chan struct{})
+	ts, client := compressServer(t, func(r *gin.Engine) {
+		r.GET("/export", func(c *gin.Context) {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			c.Writer.WriteString(`{"id":1}` + "\n")
+			c.Writer.Flush()
+			select {
+			case <-read:
+			case <-time.After(5 * time.Second):
+				return
+			}
+			c.Writer.WriteString(`{"id":2}` + "\n")
+		})
+	})
+
+	resp := get(t, client, ts.URL+"/export", "gzip")
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip once flushed below min_size", got)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bufio.NewReader(gz)
+	first, err := lines.ReadString('\n')
+	if err != nil || first != `{"id":1}`+"\n" {
+		t.Fatalf("first line = %q, %v", first, err)
+	}
+	close(read)
+	second, err := lines.ReadString('\n')
+	if err != nil || second != `{"id":2}`+"\n" {
+		t.Fatalf("second line = %q, %v, want it once the first was read", second, err)
+	}
+}
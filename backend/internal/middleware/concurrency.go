@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConcurrencyLimiter bounds how many requests of a route group run at once.
+// Requests over the limit wait in a short queue for a slot; when the queue
+// is full or their wait runs out they are answered 503 overloaded.
+type ConcurrencyLimiter struct {
+	group   string
+	slots   chan struct{}
+	waiting chan struct{}
+	timeout time.Duration
+	// retryAfter is the queue timeout in whole seconds, at least one
+	retryAfter int
+}
+
+// NewConcurrencyLimiter returns a limiter letting limit requests of group
+// run at once and queueDepth more wait up to queueTimeout, or nil when limit
+// is not positive
+func NewConcurrencyLimiter(group string, limit, queueDepth int, queueTimeout time.Duration) *ConcurrencyLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	metrics.RequestsInFlight(group, 0)
+	metrics.RequestsQueued(group, 0)
+	return &ConcurrencyLimiter{
+		group:      group,
+		slots:      make(chan struct{}, limit),
+		waiting:    make(chan struct{}, max(queueDepth, 0)),
+		timeout:    queueTimeout,
+		retryAfter: max(int(math.Ceil(queueTimeout.Seconds())), 1),
+	}
+}
+
+// ConcurrencyLimit holds a slot of the limiter while the request runs. The
+// slot is given back as soon as the request context ends, when the client
+// disconnects or the request times out, even if the handler has yet to
+// return. A nil limiter lets every request through.
+func ConcurrencyLimit(limiter *ConcurrencyLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		release, err := limiter.acquire(ctx)
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		stop := context.AfterFunc(ctx, release)
+		defer func() {
+			stop()
+			release()
+		}()
+		c.Next()
+	}
+}
+
+// acquire takes a slot, waiting in the queue if there is room, and returns
+// the function that gives it back
+func (l *ConcurrencyLimiter) acquire(ctx context.Context) (func(), *errors.AppError) {
+	select {
+	case l.slots <- struct{}{}:
+		return l.acquired(), nil
+	default:
+	}
+
+	select {
+	case l.waiting <- struct{}{}:
+	default:
+		metrics.RequestShed(l.group, "queue_full")
+		return nil, errors.ErrOverloaded(l.group, l.retryAfter)
+	}
+	metrics.RequestsQueued(l.group, len(l.waiting))
+	defer func() {
+		<-l.waiting
+		metrics.RequestsQueued(l.group, len(l.waiting))
+	}()
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return l.acquired(), nil
+	case <-timer.C:
+		metrics.RequestShed(l.group, "queue_timeout")
+		return nil, errors.ErrOverloaded(l.group, l.retryAfter)
+	case <-ctx.Done():
+		// The client is gone or the request timed out; either way no one
+		// reads this answer
+		return nil, errors.ErrOverloaded(l.group, l.retryAfter)
+	}
+}
+
+// acquired records a slot taken and returns the function that gives it
+// back, once however often it is called
+func (l *ConcurrencyLimiter) acquired() func() {
+	metrics.RequestsInFlight(l.group, len(l.slots))
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-l.slots
+			metrics.RequestsInFlight(l.group, len(l.slots))
+		})
+	}
+}
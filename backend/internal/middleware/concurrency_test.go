@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/capture"
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitedRouter serves GET /export through limiter, holding each request
+// until hold is closed and reporting on started when it runs, and POST
+// /ingest without a limit
+func limitedRouter(limiter *ConcurrencyLimiter, hold <-chan struct{}, started chan<- struct{}) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), capture.New(config.DebugConfig{}), func(*gin.Context) string { return "" }))
+	router.GET("/export", ConcurrencyLimit(limiter), func(c *gin.Context) {
+		if c.Query("hold") != "" {
+			started <- struct{}{}
+			// Like a handler that does not watch its context
+			<-hold
+		}
+		c.Status(http.StatusOK)
+	})
+	router.POST("/ingest", ConcurrencyLimit(nil), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	return router
+}
+
+// serve runs a request in the background and delivers its recorder
+func serve(router http.Handler, req *http.Request) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		done <- w
+	}()
+	return done
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// assertOverloaded checks w is the 503 asking to retry after retryAfter,
+// the queue timeout in whole seconds
+func assertOverloaded(t *testing.T, w *httptest.ResponseRecorder, retryAfter string) {
+	t.Helper()
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusServiceUnavailable || body.Error.Code != string(errors.CodeOverloaded) || w.Header().Get("Retry-After") != retryAfter {
+		t.Fatalf("status %d, code %q, Retry-After %q, want 503 %s with Retry-After %s", w.Code, body.Error.Code, w.Header().Get("Retry-After"), errors.CodeOverloaded, retryAfter)
+	}
+}
+
+func TestConcurrencyLimitShedsLoad(t *testing.T) {
+	limiter := NewConcurrencyLimiter("test", 1, 1, 100*time.Millisecond)
+	hold, started := make(chan struct{}), make(chan struct{}, 4)
+	router := limitedRouter(limiter, hold, started)
+
+	running := serve(router, httptest.NewRequest(http.MethodGet, "/export?hold=1", nil))
+	<-started
+	queued := serve(router, httptest.NewRequest(http.MethodGet, "/export", nil))
+	waitFor(t, "the request to queue", func() bool { return len(limiter.waiting) == 1 })
+
+	// The queue is full
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	assertOverloaded(t, w, "1")
+	// The queued request gives up after the queue timeout
+	assertOverloaded(t, <-queued, "1")
+
+	close(hold)
+	if w := <-running; w.Code != http.StatusOK {
+		t.Fatalf("running request: status %d", w.Code)
+	}
+	// Its slot was given back
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("after the release: status %d", w.Code)
+	}
+}
+
+func TestConcurrencyLimitQueuedRequestGetsTheFreedSlot(t *testing.T) {
+	limiter := NewConcurrencyLimiter("test", 1, 1, 5*time.Second)
+	hold, started := make(chan struct{}), make(chan struct{}, 4)
+	router := limitedRouter(limiter, hold, started)
+
+	running := serve(router, httptest.NewRequest(http.MethodGet, "/export?hold=1", nil))
+	<-started
+	queued := serve(router, httptest.NewRequest(http.MethodGet, "/export", nil))
+	waitFor(t, "the request to queue", func() bool { return len(limiter.waiting) == 1 })
+
+	close(hold)
+	<-running
+	if w := <-queued; w.Code != http.StatusOK {
+		t.Fatalf("queued request: status %d, want it run once the slot was freed", w.Code)
+	}
+}
+
+// TestConcurrencyLimitReleasesOnDisconnect checks the slot comes back when
+// the client goes away, although the handler has not returned
+func TestConcurrencyLimitReleasesOnDisconnect(t *testing.T) {
+	limiter := NewConcurrencyLimiter("test", 1, 0, time.Second)
+	hold, started := make(chan struct{}), make(chan struct{}, 4)
+	router := limitedRouter(limiter, hold, started)
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	stuck := serve(router, httptest.NewRequest(http.MethodGet, "/export?hold=1", nil).WithContext(ctx))
+	<-started
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	assertOverloaded(t, w, "1")
+
+	disconnect()
+	waitFor(t, "the slot to be released", func() bool { return len(limiter.slots) == 0 })
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("after the disconnect: status %d, want the released slot used", w.Code)
+	}
+
+	// The stuck handler returning does not give the slot back twice
+	fresh := serve(router, httptest.NewRequest(http.MethodGet, "/export?hold=1", nil))
+	<-started
+	close(hold)
+	<-stuck
+	<-fresh
+	if n := len(limiter.slots); n != 0 {
+		t.Fatalf("slots in use = %d after every request ended, want 0", n)
+	}
+}
+
+// TestIngestionLatencyStaysFlatWhileExportsAreSaturated compares ingestion
+// latency with exports idle and with every export slot and queue place
+// taken
+func TestIngestionLatencyStaysFlatWhileExportsAreSaturated(t *testing.T) {
+	const exports, queueDepth = 2, 2
+	limiter := NewConcurrencyLimiter("test", exports, queueDepth, 5*time.Second)
+	hold, started := make(chan struct{}), make(chan struct{}, exports+queueDepth)
+	router := limitedRouter(limiter, hold, started)
+
+	p99 := func() time.Duration {
+		latencies := make([]time.Duration, 200)
+		for i := range latencies {
+			w := httptest.NewRecorder()
+			start := time.Now()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", nil))
+			latencies[i] = time.Since(start)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("ingest: status %d", w.Code)
+			}
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		return latencies[len(latencies)*99/100]
+	}
+	idle := p99()
+
+	var pending []<-chan *httptest.ResponseRecorder
+	for i := 0; i < exports+queueDepth; i++ {
+		pending = append(pending, serve(router, httptest.NewRequest(http.MethodGet, "/export?hold=1", nil)))
+	}
+	waitFor(t, "exports to saturate", func() bool {
+		return len(limiter.slots) == exports && len(limiter.waiting) == queueDepth
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	assertOverloaded(t, w, "5")
+
+	saturated := p99()
+	// Ingestion shares nothing with the export queue; a request waiting
+	// on it would take the queue timeout
+	if saturated > idle+25*time.Millisecond {
+		t.Fatalf("ingest p99 = %s with exports saturated, %s idle", saturated, idle)
+	}
+
+	close(hold)
+	for _, done := range pending {
+		<-done
+	}
+}
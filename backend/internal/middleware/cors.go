@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults used for CORS settings left empty in the configuration
+var (
+	defaultCorsMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	defaultCorsHeaders = []string{"Origin", "Content-Type", "Authorization", "X-API-Key", "X-Admin-Token", "X-Request-ID"}
+	defaultCorsExposed = []string{"X-Request-ID", "X-Impersonated-By"}
+	defaultCorsMaxAge  = 24 * time.Hour
+)
+
+// CORS answers cross-origin requests according to the configuration. The
+// matched origin is echoed back (with Vary: Origin) rather than "*", except
+// in allow-all mode without credentials. Preflight requests are answered
+// directly with 204.
+func CORS(cfg config.CorsConfig) gin.HandlerFunc {
+	allowAll := len(cfg.AllowedOrigins) == 0
+	var exact []string
+	var wildcards []subdomainPattern
+	for _, origin := range cfg.AllowedOrigins {
+		switch {
+		case origin == "*":
+			allowAll = true
+		case strings.Contains(origin, "://*."):
+			scheme, domain, _ := strings.Cut(strings.ToLower(origin), "://*")
+			wildcards = append(wildcards, subdomainPattern{prefix: scheme + "://", suffix: strings.TrimSuffix(domain, "/")})
+		default:
+			exact = append(exact, strings.TrimSuffix(origin, "/"))
+		}
+	}
+
+	methods := strings.Join(orDefault(cfg.AllowedMethods, defaultCorsMethods), ", ")
+	headers := strings.Join(orDefault(cfg.AllowedHeaders, defaultCorsHeaders), ", ")
+	exposed := strings.Join(orDefault(cfg.ExposedHeaders, defaultCorsExposed), ", ")
+	maxAge := cfg.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultCorsMaxAge
+	}
+	maxAgeSeconds := strconv.Itoa(int(maxAge.Seconds()))
+
+	allowed := func(origin string) bool {
+		if allowAll {
+			return true
+		}
+		for _, o := range exact {
+			if strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		for _, w := range wildcards {
+			if w.match(origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && origin != "" &&
+			c.GetHeader("Access-Control-Request-Method") != ""
+
+		// The response depends on the Origin whenever it is not a plain "*"
+		if !allowAll || cfg.AllowCredentials {
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+
+		if origin == "" || !allowed(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if allowAll && !cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", headers)
+			c.Header("Access-Control-Max-Age", maxAgeSeconds)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Header("Access-Control-Expose-Headers", exposed)
+		c.Next()
+	}
+}
+
+// subdomainPattern is a "scheme://*.domain[:port]" origin split around the
+// wildcard
+type subdomainPattern struct {
+	prefix string // "scheme://"
+	suffix string // ".domain[:port]"
+}
+
+// match reports whether origin is a subdomain of the pattern's domain; the
+// bare domain itself does not match
+func (p subdomainPattern) match(origin string) bool {
+	origin = strings.ToLower(origin)
+	if len(origin) <= len(p.prefix)+len(p.suffix) ||
+		!strings.HasPrefix(origin, p.prefix) || !strings.HasSuffix(origin, p.suffix) {
+		return false
+	}
+	label := origin[len(p.prefix) : len(origin)-len(p.suffix)]
+	return !strings.ContainsAny(label, "/:@")
+}
+
+// orDefault returns values, or fallback when values is empty
+func orDefault(values, fallback []string) []string {
+	if len(values) == 0 {
+		return fallback
+	}
+	return values
+}
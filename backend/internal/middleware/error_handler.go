@@ -1,48 +1,202 @@
 package middleware
 
 import (
-	"log"
+	stderrors "errors"
+	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"strconv"
+	"time"
 
+	"event-ingestion-system/internal/capture"
+	"event-ingestion-system/internal/database"
 	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/i18n"
+	"event-ingestion-system/internal/realip"
+	"event-ingestion-system/internal/requestid"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
-// ErrorHandler is a middleware that handles panics and structured errors
-func ErrorHandler() gin.HandlerFunc {
+// ErrorHandler is a middleware that handles panics and structured errors.
+// Handlers report failures with c.Error(appErr) followed by c.Abort(); the
+// first AppError found in c.Errors is rendered with its own status code and
+// the request ID, and any other error becomes a generic 500. When recent is
+// enabled, failed requests are captured there once answered. 5xx errors
+// carry the request's sampled trace, as traceID returns it, in
+// meta.trace_id. Messages are translated into the language negotiated from
+// Accept-Language, as the i18n package describes.
+func ErrorHandler(logger *slog.Logger, recent *capture.Recorder, traceID func(c *gin.Context) string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if recent.Enabled() {
+			defer recent.Start(c)()
+		}
 		defer func() {
 			if err := recover(); err != nil {
 				// Log the panic with stack trace
-				log.Printf("[PANIC] %v\n%s", err, debug.Stack())
+				logger.ErrorContext(c.Request.Context(), "panic recovered", "panic", err, "stack", string(debug.Stack()))
 
 				// Check if it's an AppError
 				if appErr, ok := err.(*errors.AppError); ok {
-					c.JSON(appErr.StatusCode, appErr.Response())
+					withTraceID(appErr, traceID(c))
+					setMetaHeaders(c, appErr)
+					appErr = localize(c, appErr)
+					c.AbortWithStatusJSON(appErr.StatusCode, appErr.WithRequestID(c.GetString("request_id")).Response())
 					return
 				}
 
 				// Generic panic response
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": gin.H{
-						"code":    errors.CodeInternalError,
-						"message": "An unexpected error occurred",
-					},
-				})
+				body := gin.H{
+					"code":    errors.CodeInternalError,
+					"message": "An unexpected error occurred",
+				}
+				if id := traceID(c); id != "" {
+					body["meta"] = gin.H{errors.MetaTraceID: id}
+				}
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": body})
 			}
 		}()
 
 		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		appErr := firstAppError(c.Errors)
+		if appErr == nil {
+			appErr = errors.ErrInternal("An unexpected error occurred", c.Errors.Last().Err)
+		}
+		// Whatever failed for want of a database connection can be retried
+		if stderrors.Is(appErr.Internal, database.ErrAcquireTimeout) {
+			appErr = errors.ErrDatabaseBusy(1, appErr.Internal)
+		}
+		// as can writes that lost out to concurrent ones, which left nothing
+		if stderrors.Is(appErr.Internal, database.ErrWriteConflict) {
+			appErr = errors.ErrWriteConflict(appErr.Internal)
+		}
+		if stderrors.Is(appErr.Internal, database.ErrQueryTimeout) {
+			appErr = errors.ErrQueryTimeout(appErr.Internal)
+		}
+		if stderrors.Is(appErr.Internal, database.ErrCompressedMetadata) {
+			appErr = errors.ErrMetadataSearchUnsupported()
+		}
+
+		if appErr.Internal != nil {
+			logger.ErrorContext(c.Request.Context(), appErr.Message,
+				"code", appErr.Code,
+				"status", appErr.StatusCode,
+				"error", appErr.Internal,
+			)
+		}
+
+		withTraceID(appErr, traceID(c))
+		setMetaHeaders(c, appErr)
+		appErr = localize(c, appErr)
+		c.JSON(appErr.StatusCode, appErr.WithRequestID(c.GetString("request_id")).Response())
 	}
 }
 
-// RequestLogger logs all requests with timing and status
-func RequestLogger() gin.HandlerFunc {
-	return gin.LoggerWithConfig(gin.LoggerConfig{
-		SkipPaths: []string{"/health", "/debug/routes"},
-	})
+// localize translates an error into the language the client accepts
+func localize(c *gin.Context, appErr *errors.AppError) *errors.AppError {
+	language := i18n.Negotiate(c.GetHeader("Accept-Language"))
+	setLanguageHeaders(c.Writer.Header(), language)
+	return i18n.Localize(appErr, language)
+}
+
+// setLanguageHeaders names the language of an error response, which
+// varies with Accept-Language
+func setLanguageHeaders(h http.Header, language string) {
+	h.Set("Content-Language", language)
+	h.Add("Vary", "Accept-Language")
+}
+
+// withTraceID adds the trace to a 5xx error's meta, so support can hand it
+// to engineering
+func withTraceID(appErr *errors.AppError, traceID string) {
+	if traceID != "" && appErr.StatusCode >= http.StatusInternalServerError {
+		appErr.WithMeta(errors.MetaTraceID, traceID)
+	}
+}
+
+// setMetaHeaders sets the Retry-After and rate limit headers from an
+// error's meta, so headers and body cannot disagree
+func setMetaHeaders(c *gin.Context, appErr *errors.AppError) {
+	seconds, retry := appErr.Meta[errors.MetaRetryAfter].(int)
+	if retry {
+		c.Header("Retry-After", strconv.Itoa(seconds))
+	}
+
+	limit, okLimit := appErr.Meta[errors.MetaLimit].(int)
+	remaining, okRemaining := appErr.Meta[errors.MetaRemaining].(int)
+	reset, okReset := appErr.Meta[errors.MetaReset].(time.Time)
+	if okLimit && okRemaining && okReset {
+		result := RateLimitResult{Limit: limit, Remaining: remaining, Reset: reset}
+		if !retry {
+			seconds = result.RetryAfter(time.Now())
+		}
+		setRateLimitHeaders(c, result, seconds)
+	}
+}
+
+// firstAppError returns the first AppError recorded on the context, if any
+func firstAppError(errs []*gin.Error) *errors.AppError {
+	for _, e := range errs {
+		var appErr *errors.AppError
+		if stderrors.As(e.Err, &appErr) {
+			return appErr
+		}
+	}
+	return nil
+}
+
+// RequestLogger emits one structured log line per request with timing and
+// status. The request ID is attached by the logging handler from the context,
+// and the trace ID, when traceID returns one, by this middleware.
+func RequestLogger(logger *slog.Logger, traceID func(c *gin.Context) string) gin.HandlerFunc {
+	skip := map[string]bool{"/health": true}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+
+		c.Next()
+
+		if skip[path] {
+			return
+		}
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", realip.Get(c)),
+			slog.String("tenant_id", c.GetString("tenant_id")),
+		}
+		if id := traceID(c); id != "" {
+			attrs = append(attrs, slog.String("trace_id", id))
+		}
+		if impersonator := c.GetString("impersonated_by"); impersonator != "" {
+			attrs = append(attrs, slog.String("impersonated_by", impersonator))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
 }
 
 // SecurityHeaders adds security headers to responses
@@ -60,22 +214,19 @@ func SecurityHeaders() gin.HandlerFunc {
 	}
 }
 
-// RequestTimeout adds request timeout handling
-func RequestTimeout(timeoutSeconds int) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Set timeout on context
-		// Note: For Gin, this is handled at server level
-		// This middleware can be used for additional timeout logic if needed
-
-		c.Next()
-	}
-}
-
-// RequestID adds a unique request ID to each request
+// RequestID assigns each request an ID, reusing a well-formed incoming
+// X-Request-ID header, and exposes it in the Gin context, the request
+// context and the response headers
 func RequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Request ID is already handled by Gin in production setups
-		// This can be extended to add custom request ID logic
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = uuid.New().String()
+		}
+
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.Header(requestid.Header, id)
 
 		c.Next()
 	}
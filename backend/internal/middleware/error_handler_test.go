@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"event-ingestion-system/internal/capture"
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestErrorHandlerReportsExhaustedWriteConflictsAsRetryable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), capture.New(config.DebugConfig{}), func(*gin.Context) string { return "" }))
+	router.POST("/events", func(c *gin.Context) {
+		err := fmt.Errorf("%w after 4 attempts: deadlock detected", database.ErrWriteConflict)
+		c.Error(errors.ErrDB("create event", err))
+		c.Abort()
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/events", nil))
+
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusConflict || body.Error.Code != string(errors.CodeWriteConflict) {
+		t.Fatalf("status %d, code %q, want %d %s", w.Code, body.Error.Code, http.StatusConflict, errors.CodeWriteConflict)
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/maintenance"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Maintenance rejects mutating requests with 503 while maintenance mode is
+// on. Safe methods pass through so reads keep working during a migration.
+func Maintenance(mode *maintenance.Mode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isSafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		state := mode.State()
+		if !state.Enabled {
+			c.Next()
+			return
+		}
+
+		c.Error(errors.ErrMaintenance(state.Message).WithMeta(errors.MetaRetryAfter, state.RetryAfter))
+		c.Abort()
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -2,10 +2,14 @@ package middleware
 
 import (
 	"fmt"
-	"net/http"
+	"math"
+	"strconv"
 	"sync"
 	"time"
 
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/metrics"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -17,6 +21,25 @@ type RateLimiter struct {
 	window   time.Duration
 }
 
+// RateLimitResult describes the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the moment the oldest request in the window ages out,
+	// i.e. when at least one more request will be accepted
+	Reset time.Time
+}
+
+// RetryAfter returns the whole seconds until Reset, rounded up
+func (r RateLimitResult) RetryAfter(now time.Time) int {
+	d := r.Reset.Sub(now)
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
 // NewRateLimiter creates a new rate limiter
 func NewRateLimiter(requestsPerMinute int) *RateLimiter {
 	return &RateLimiter{
@@ -26,8 +49,8 @@ func NewRateLimiter(requestsPerMinute int) *RateLimiter {
 	}
 }
 
-// Allow checks if a request should be allowed
-func (rl *RateLimiter) Allow(key string) bool {
+// Allow checks if a request should be allowed and records it when it is
+func (rl *RateLimiter) Allow(key string) RateLimitResult {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
@@ -36,22 +59,36 @@ func (rl *RateLimiter) Allow(key string) bool {
 
 	requests := rl.requests[key]
 
-	validRequests := make([]time.Time, 0, len(requests))
+	validRequests := make([]time.Time, 0, len(requests)+1)
 	for _, t := range requests {
 		if t.After(windowStart) {
 			validRequests = append(validRequests, t)
 		}
 	}
 
-	if len(validRequests) >= rl.limit {
-		rl.requests[key] = validRequests
-		return false
+	allowed := len(validRequests) < rl.limit
+	if allowed {
+		validRequests = append(validRequests, now)
 	}
-
-	validRequests = append(validRequests, now)
 	rl.requests[key] = validRequests
 
-	return true
+	remaining := rl.limit - len(validRequests)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	// Timestamps are appended in order, so the first one is the oldest
+	reset := now
+	if len(validRequests) > 0 {
+		reset = validRequests[0].Add(rl.window)
+	}
+
+	return RateLimitResult{
+		Allowed:   allowed,
+		Limit:     rl.limit,
+		Remaining: remaining,
+		Reset:     reset,
+	}
 }
 
 // GetRemainingRequests returns remaining requests for a key
@@ -91,25 +128,45 @@ func RateLimitMiddleware(rl *RateLimiter, enabled bool) gin.HandlerFunc {
 			return
 		}
 
-		if !rl.Allow(tenantID) {
-			c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", rl.limit))
-			c.Header("X-RateLimit-Remaining", "0")
-			c.Header("X-RateLimit-Reset", time.Now().Add(time.Minute).Format(time.RFC3339))
-			c.Header("Retry-After", "60")
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "rate_limit_exceeded",
-				"message":     "Too many requests. Please try again later.",
-				"retry_after": 60,
-			})
+		result := rl.Allow(tenantID)
+		retryAfter := result.RetryAfter(time.Now())
+
+		if !result.Allowed {
+			// ErrorHandler sets the headers from the error's meta
+			metrics.RateLimitRejected(tenantID)
+			c.Error(errors.ErrRateLimit(result.Limit, result.Remaining, result.Reset, retryAfter))
 			c.Abort()
 			return
 		}
 
-		remaining := rl.GetRemainingRequests(tenantID)
-		c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", rl.limit))
-		c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
-		c.Header("X-RateLimit-Reset", time.Now().Add(time.Minute).Format(time.RFC3339))
-
+		setRateLimitHeaders(c, result, retryAfter)
+		c.Set(rateLimitKey, result)
 		c.Next()
 	}
 }
+
+// rateLimitKey holds the rate limit result of a request in its context
+const rateLimitKey = "rate_limit"
+
+// RateLimitFromContext returns the result of the request's rate limit
+// check, counting the request itself; ok is false when it was not limited
+func RateLimitFromContext(c *gin.Context) (result RateLimitResult, ok bool) {
+	value, exists := c.Get(rateLimitKey)
+	if !exists {
+		return RateLimitResult{}, false
+	}
+	result, ok = value.(RateLimitResult)
+	return result, ok
+}
+
+// setRateLimitHeaders emits both the legacy X-RateLimit-* headers and the
+// IETF draft RateLimit-* headers (reset expressed in delta-seconds)
+func setRateLimitHeaders(c *gin.Context, result RateLimitResult, resetSeconds int) {
+	c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", result.Limit))
+	c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", result.Remaining))
+	c.Header("X-RateLimit-Reset", result.Reset.UTC().Format(time.RFC3339))
+
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(resetSeconds))
+}
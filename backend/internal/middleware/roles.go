@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"event-ingestion-system/internal/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole lets a tenant's users through only when they have one of the
+// roles. Requests made with the tenant's API key or tenant token are machine
+// clients, not users, and always pass.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		allowed[role] = true
+	}
+
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if role == "" || allowed[role] {
+			c.Next()
+			return
+		}
+
+		c.Error(errors.ErrForbidden("The " + role + " role cannot perform this action"))
+		c.Abort()
+	}
+}
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestTimeout bounds request processing time. The request context gets
+// a deadline so database calls are cancelled, and if the handler has not
+// started writing its response when the deadline passes, a 504 is sent
+// immediately and anything the handler writes afterwards is discarded.
+// A zero timeout disables the middleware.
+func RequestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		language := i18n.Negotiate(c.GetHeader("Accept-Language"))
+		tw := &timeoutWriter{
+			ResponseWriter: c.Writer,
+			ctx:            ctx,
+			header:         make(http.Header),
+			timeoutErr:     i18n.Localize(errors.ErrTimeout(), language).WithRequestID(c.GetString("request_id")),
+			language:       language,
+		}
+		c.Writer = tw
+
+		timer := time.AfterFunc(timeout, tw.timeout)
+
+		c.Next()
+
+		timer.Stop()
+		tw.release()
+		c.Writer = tw.ResponseWriter
+	}
+}
+
+// timeoutWriter guards the response so that the handler and the timeout
+// timer can never both write it. Handler headers are staged in a private
+// map and only copied to the real response when the handler writes first.
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	ctx        context.Context
+	timeoutErr *errors.AppError
+	language   string
+
+	mu       sync.Mutex
+	header   http.Header
+	wrote    bool
+	timedOut bool
+}
+
+// Header returns the staged header map until the response is committed
+func (w *timeoutWriter) Header() http.Header {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.wrote {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+// WriteHeader implements http.ResponseWriter. Gin only records the status
+// here; the header is sent on the first write.
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// WriteHeaderNow implements gin.ResponseWriter
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.commit() {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Write implements http.ResponseWriter
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.commit() {
+		return 0, http.ErrHandlerTimeout
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush implements http.Flusher
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.commit() {
+		return
+	}
+	w.ResponseWriter.Flush()
+}
+
+// commit copies staged headers to the real response on the first write and
+// reports whether the handler may write. A handler that only starts
+// responding after the deadline (typically with the error from a cancelled
+// query) gets the 504 instead. Must be called with mu held.
+func (w *timeoutWriter) commit() bool {
+	if w.timedOut {
+		return false
+	}
+	if w.wrote {
+		return true
+	}
+	if w.ctx.Err() == context.DeadlineExceeded {
+		w.writeTimeout()
+		return false
+	}
+	w.wrote = true
+
+	dst := w.ResponseWriter.Header()
+	for k, v := range w.header {
+		dst[k] = v
+	}
+	return true
+}
+
+// release hands staged headers to the real response when the handler
+// returned without writing, so an error rendered further up the chain (for
+// example by ErrorHandler) still carries headers such as Retry-After
+func (w *timeoutWriter) release() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.wrote || w.timedOut {
+		return
+	}
+	dst := w.ResponseWriter.Header()
+	for k, v := range w.header {
+		dst[k] = v
+	}
+}
+
+// timeout writes the 504 response unless the handler already started
+// responding
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.wrote || w.timedOut {
+		return
+	}
+	w.writeTimeout()
+}
+
+// writeTimeout sends the 504 response. Must be called with mu held.
+func (w *timeoutWriter) writeTimeout() {
+	w.timedOut = true
+
+	body, _ := json.Marshal(w.timeoutErr.Response())
+	w.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
+	setLanguageHeaders(w.ResponseWriter.Header(), w.language)
+	w.ResponseWriter.WriteHeader(w.timeoutErr.StatusCode)
+	w.ResponseWriter.Write(body)
+}
@@ -1,9 +1,16 @@
 package models
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"time"
+	"unicode/utf8"
 
+	"event-ingestion-system/internal/errors"
+
+	"github.com/klauspost/compress/zstd"
 	"gorm.io/gorm"
 )
 
@@ -13,34 +20,147 @@ type Tenant struct {
 	Name      string         `gorm:"size:255;not null" json:"name"`
 	APIKey    string         `gorm:"size:64;uniqueIndex;not null" json:"-"`
 	Active    bool           `gorm:"default:true" json:"active"`
+	Settings  string         `gorm:"type:text" json:"-"`                // TenantSettings as JSON
+	Version   int64          `gorm:"not null;default:1" json:"version"` // bumped on every change to the tenant's settings or key
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	// LastAuthAt is when the tenant's API key or tokens were last accepted,
+	// written every few seconds rather than on each request
+	LastAuthAt *time.Time `json:"last_auth_at,omitempty"`
+	// NotificationsMuted keeps the tenant's events from its WebSocket clients
+	// and webhooks, until NotificationsMutedUntil when that is set; they are
+	// still stored. NotificationsMutedAt is when the mute began.
+	NotificationsMuted      bool       `gorm:"not null;default:false" json:"notifications_muted"`
+	NotificationsMutedUntil *time.Time `json:"notifications_muted_until,omitempty"`
+	NotificationsMutedAt    *time.Time `json:"notifications_muted_at,omitempty"`
 
 	// Relations
 	Events   []Event   `gorm:"foreignKey:TenantID" json:"events,omitempty"`
 	Webhooks []Webhook `gorm:"foreignKey:TenantID" json:"webhooks,omitempty"`
 }
 
+// Muted reports whether the tenant's notifications are muted at now
+func (t *Tenant) Muted(now time.Time) bool {
+	return t.NotificationsMuted && (t.NotificationsMutedUntil == nil || now.Before(*t.NotificationsMutedUntil))
+}
+
+// User roles, from most to least privileged
+const (
+	RoleAdmin     = "admin"
+	RoleDeveloper = "developer"
+	RoleViewer    = "viewer"
+)
+
+// User is a member of a tenant's team with credentials of their own. Users
+// sign in with a password or, when SSOSubject is set, through single
+// sign-on; machine clients keep using the tenant's API key.
+type User struct {
+	ID           uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID     string     `gorm:"size:36;not null;uniqueIndex:idx_users_tenant_email" json:"tenant_id"`
+	Email        string     `gorm:"size:254;not null;uniqueIndex:idx_users_tenant_email" json:"email"`
+	PasswordHash string     `gorm:"size:100" json:"-"` // bcrypt; empty for SSO-only users
+	SSOSubject   string     `gorm:"size:255;index" json:"sso_subject,omitempty"`
+	Role         string     `gorm:"size:20;not null" json:"role"` // admin, developer or viewer
+	Active       bool       `gorm:"default:true" json:"active"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
 // Event represents an event ingested from a tenant
 type Event struct {
 	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	TenantID    string         `gorm:"size:36;index;not null" json:"tenant_id"`
+	TenantID    string         `gorm:"size:36;index;index:idx_events_tenant_correlation;not null" json:"tenant_id"`
 	EventType   string         `gorm:"size:100;index;not null" json:"event_type"`
+	Sequence    uint64         `gorm:"not null;default:0" json:"sequence"` // gap-free per tenant, from 1
 	Timestamp   time.Time      `gorm:"not null;index" json:"timestamp"`
-	Metadata    string         `gorm:"type:text" json:"metadata"` // JSON string
-	ProcessedAt *time.Time     `json:"processed_at,omitempty"`
+	Metadata    string         `gorm:"type:text" json:"metadata"` // JSON string, or as MetadataEncoding says
+	ClientIP    string         `gorm:"size:45" json:"client_ip,omitempty"`
+	Source      string         `gorm:"size:100;index" json:"source,omitempty"`
+	Credential  string         `gorm:"size:100" json:"credential,omitempty"`
+	ProcessedAt *time.Time     `gorm:"index" json:"processed_at,omitempty"`
 	CreatedAt   time.Time      `json:"created_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	// MetadataEncoding is how Metadata is stored: MetadataPlain or
+	// MetadataZstd. Events are only ever handed out plain.
+	MetadataEncoding string `gorm:"size:10;not null;default:''" json:"-"`
+	// RedactedAt is when the event's metadata was replaced by
+	// RedactedMetadata; redacted events are left out of metadata searches
+	RedactedAt *time.Time `json:"redacted_at,omitempty"`
+	// MetadataSize is the length in bytes of the metadata JSON as stored
+	// uncompressed, recorded when the event is written
+	MetadataSize int64 `gorm:"not null;default:0" json:"-"`
+	// CorrelationID groups the events of one workflow; CausationID names
+	// what caused the event, such as an earlier step. Both are the
+	// producer's own strings.
+	CorrelationID string `gorm:"size:128;index:idx_events_tenant_correlation" json:"correlation_id,omitempty"`
+	CausationID   string `gorm:"size:128" json:"causation_id,omitempty"`
+	// System marks an event the service wrote into the tenant's stream,
+	// such as a quota notice, rather than one the tenant sent. System
+	// events do not count against the quota. The column is is_system
+	// because SYSTEM is reserved on MySQL.
+	System bool `gorm:"column:is_system;not null;default:false" json:"system,omitempty"`
+
+	// Sampled is set on an event ingestion accepted but a sampling rule
+	// kept from being stored
+	Sampled bool `gorm:"-" json:"-"`
+	// ReceivedAt is when an event latency tracking sampled was received;
+	// zero on the others
+	ReceivedAt time.Time `gorm:"-" json:"-"`
 
 	// Relations
 	Tenant Tenant `gorm:"foreignKey:TenantID" json:"tenant,omitempty"`
 }
 
+// Stored metadata encodings
+const (
+	MetadataPlain = ""
+	// MetadataZstd is base64 of the zstd-compressed JSON, text so that it
+	// fits the metadata column on every database
+	MetadataZstd = "zstd"
+)
+
+// EventSequence is a tenant's event counter: the sequence number of its
+// latest event
+type EventSequence struct {
+	TenantID     string `gorm:"primaryKey;size:36"`
+	LastSequence uint64 `gorm:"not null;default:0"`
+}
+
+// SampledEventCount is how many of a tenant's events of one type sampling
+// rules have kept from being stored
+type SampledEventCount struct {
+	TenantID  string    `gorm:"primaryKey;size:36" json:"tenant_id"`
+	EventType string    `gorm:"primaryKey;size:100" json:"event_type"`
+	Count     int64     `gorm:"not null;default:0" json:"count"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// QuotaNotice records that a tenant was told its events reached a
+// threshold of its quota in a month, such as "2026-10", so it is told once
+// per month whichever replica notices first
+type QuotaNotice struct {
+	TenantID  string `gorm:"primaryKey;size:36"`
+	Month     string `gorm:"primaryKey;size:7"`
+	Threshold int    `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time
+}
+
+// Lease is held by one replica at a time until it expires; the leader
+// election's lease makes its holder the leader
+type Lease struct {
+	Name      string    `gorm:"primaryKey;size:64" json:"name"`
+	Holder    string    `gorm:"size:255;not null" json:"holder"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 // Webhook represents a webhook endpoint for a tenant (bonus feature)
 type Webhook struct {
 	ID            uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	TenantID      string         `gorm:"size:36;index;not null" json:"tenant_id"`
+	TenantID      string         `gorm:"size:36;index;uniqueIndex:idx_webhooks_tenant_name;not null" json:"tenant_id"`
+	Name          *string        `gorm:"size:100;uniqueIndex:idx_webhooks_tenant_name" json:"name,omitempty"` // unique per tenant; only set by PUT /webhooks/:name
 	URL           string         `gorm:"size:500;not null" json:"url"`
 	Secret        string         `gorm:"size:64;not null" json:"-"`
 	EventTypes    string         `gorm:"type:text" json:"event_types"` // JSON array
@@ -50,50 +170,1380 @@ type Webhook struct {
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 	LastTriggered *time.Time     `json:"last_triggered,omitempty"`
 	FailureCount  int            `gorm:"default:0" json:"failure_count"`
+	Version       int64          `gorm:"not null;default:1" json:"version"` // bumped on every change to the definition, not on deliveries
+	// PayloadVersion is the event payload posted: PayloadV1 or PayloadV2
+	PayloadVersion int `gorm:"not null;default:1" json:"payload_version"`
+	// Timeout and ConnectTimeout override webhooks.timeout and
+	// webhooks.connect_timeout when set; Go durations
+	Timeout        string `gorm:"size:20" json:"timeout,omitempty"`
+	ConnectTimeout string `gorm:"size:20" json:"connect_timeout,omitempty"`
+	// LastStatus is the outcome of the latest delivery attempt, such as
+	// "delivered", "timeout" or "dns_error"
+	LastStatus string `gorm:"size:30" json:"last_status,omitempty"`
+	// PausedAt is when an operator paused the webhook. Its deliveries are
+	// held until it is resumed, unlike an inactive webhook's, which are
+	// dropped.
+	PausedAt *time.Time `json:"paused_at,omitempty"`
 
 	// Relations
 	Tenant Tenant `gorm:"foreignKey:TenantID" json:"tenant,omitempty"`
 }
 
+// AuditLog records a sensitive operation. Entries are hash-chained: Hash
+// covers the entry's fields plus the previous entry's hash, so editing or
+// removing a row breaks the chain from that point on.
+type AuditLog struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ActorType  string    `gorm:"size:20;index;not null" json:"actor_type"` // "tenant", "admin" or "anonymous"
+	ActorID    string    `gorm:"size:36;index" json:"actor_id,omitempty"`
+	Action     string    `gorm:"size:100;index;not null" json:"action"`
+	TargetType string    `gorm:"size:50" json:"target_type,omitempty"`
+	TargetID   string    `gorm:"size:100" json:"target_id,omitempty"`
+	RequestID  string    `gorm:"size:128" json:"request_id,omitempty"`
+	IP         string    `gorm:"size:45" json:"ip,omitempty"`
+	Timestamp  time.Time `gorm:"not null;index" json:"timestamp"`
+	Details    string    `gorm:"type:text" json:"details"` // JSON string
+	// ImpersonatedBy names the operator acting through an impersonation
+	// token
+	ImpersonatedBy string `gorm:"size:100;index" json:"impersonated_by,omitempty"`
+	// UserID is the tenant's user who acted, when they signed in as one
+	UserID   uint   `gorm:"index" json:"user_id,omitempty"`
+	PrevHash string `gorm:"size:64" json:"prev_hash"`
+	Hash     string `gorm:"size:64;not null" json:"hash"`
+}
+
+// AuditChainHead is the one row holding the hash of the latest audit log
+// entry. Appending locks it, so entries from every replica form one chain.
+type AuditChainHead struct {
+	ID   uint   `gorm:"primaryKey;autoIncrement:false"`
+	Hash string `gorm:"size:64;not null"`
+}
+
+// Impersonation scopes
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// Impersonation is a short-lived token an operator minted to see a tenant's
+// API as the tenant does. Its ID is the token's jti, so the token stops
+// working as soon as the record is revoked.
+type Impersonation struct {
+	ID             string     `gorm:"primaryKey;size:36" json:"id"`
+	TenantID       string     `gorm:"size:36;index;not null" json:"tenant_id"`
+	ImpersonatedBy string     `gorm:"size:100;not null" json:"impersonated_by"`
+	Reason         string     `gorm:"size:500" json:"reason,omitempty"`
+	Scope          string     `gorm:"size:10;not null" json:"scope"` // read or write
+	ExpiresAt      time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Background job states, shared by export, import and redaction jobs
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Job is what every background job's row holds besides its work: the
+// tenant, the state, and the runs. Attempts counts the runs, and a running
+// job belongs to the worker that claimed that attempt for as long as its
+// heartbeat is fresh.
+type Job struct {
+	ID          string     `gorm:"primaryKey;size:36" json:"id"`
+	TenantID    string     `gorm:"size:36;index;not null" json:"tenant_id"`
+	Status      string     `gorm:"size:20;not null;index" json:"status"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	HeartbeatAt *time.Time `json:"-"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// JobState returns the job's Job, for runners of any kind of job
+func (j *Job) JobState() *Job { return j }
+
+// ExportJob builds an archive of all of a tenant's data. ActiveTenantID is
+// set while the job is pending or running; its unique index allows one such
+// job per tenant. ObjectKey is the archive's manifest, or for jobs completed before
+// archives had parts the archive itself.
+type ExportJob struct {
+	Job
+	ActiveTenantID *string   `gorm:"size:36;uniqueIndex" json:"-"`
+	Compression    string    `gorm:"size:10;not null;default:gzip" json:"compression"` // gzip or zstd
+	ObjectKey      string    `gorm:"size:500" json:"-"`
+	Size           int64     `json:"size,omitempty"` // bytes of the archive, all parts together
+	EventCount     int64     `json:"event_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Archive compressions of export jobs
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// ExportPart is one stored part of an export's archive. Parts are numbered
+// from 1 and hold the events after the previous part's LastEventID, the
+// first also the tenant, its webhooks and views; concatenated in order they
+// are the whole archive. A job resumes after its last stored part.
+type ExportPart struct {
+	JobID       string    `gorm:"primaryKey;size:36" json:"-"`
+	Number      int       `gorm:"primaryKey;autoIncrement:false" json:"number"`
+	ObjectKey   string    `gorm:"size:500;not null" json:"-"`
+	Events      int64     `gorm:"not null" json:"events"`
+	Size        int64     `gorm:"not null" json:"size"`           // bytes
+	SHA256      string    `gorm:"size:64;not null" json:"sha256"` // hex, of the compressed part
+	LastEventID uint      `gorm:"not null" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ExportPartResponse is an archive part with a link that downloads it
+type ExportPartResponse struct {
+	ExportPart
+	DownloadURL string `json:"download_url"`
+}
+
+// ExportJobResponse is an export job with, once it has completed, links
+// that download its archive until URLExpiresAt: the manifest listing its
+// parts and each part, and DownloadURL when there is only one
+type ExportJobResponse struct {
+	ExportJob
+	DownloadURL  string               `json:"download_url,omitempty"`
+	ManifestURL  string               `json:"manifest_url,omitempty"`
+	Parts        []ExportPartResponse `json:"parts,omitempty"`
+	URLExpiresAt *time.Time           `json:"url_expires_at,omitempty"`
+}
+
+// ImportJob loads an export archive into a tenant, created for it or
+// existing and empty. Lines counts the archive lines committed so far, so
+// a resumed job skips them.
+type ImportJob struct {
+	Job
+	SourceTenantID string `gorm:"size:36" json:"source_tenant_id"`
+	// TenantCreated is set when the import created the tenant
+	TenantCreated  bool      `json:"tenant_created"`
+	ObjectKey      string    `gorm:"size:500" json:"-"`
+	Lines          int64     `gorm:"not null;default:0" json:"lines"`
+	EventsImported int64     `gorm:"not null;default:0" json:"events_imported"`
+	ConflictCount  int64     `gorm:"not null;default:0" json:"conflict_count"`
+	ConflictLog    string    `gorm:"type:text" json:"-"` // the first ImportConflicts as JSON
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ImportConflict is an archive line an import skipped
+type ImportConflict struct {
+	Line   int64  `json:"line"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// ImportJobResponse is an import job with the conflicts it logged and,
+// when the import created the tenant, the tenant's new API key
+type ImportJobResponse struct {
+	ImportJob
+	Conflicts []ImportConflict `json:"conflicts"`
+	APIKey    string           `json:"api_key,omitempty"`
+}
+
+// RedactionJob redacts the metadata of a tenant's events of one type with
+// a timestamp in [Since, Until). Each batch is committed with the highest
+// event ID it covered, LastEventID, so an interrupted or failed job carries
+// on after it.
+type RedactionJob struct {
+	Job
+	EventType      string    `gorm:"size:100;not null" json:"event_type"`
+	Since          time.Time `gorm:"not null" json:"since"`
+	Until          time.Time `gorm:"not null" json:"until"`
+	LastEventID    uint      `gorm:"not null;default:0" json:"-"`
+	EventsRedacted int64     `gorm:"not null;default:0" json:"events_redacted"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// RedactionRequest starts a RedactionJob
+type RedactionRequest struct {
+	EventType string    `json:"event_type" binding:"required,min=1,max=100"`
+	Since     time.Time `json:"since" binding:"required"`
+	Until     time.Time `json:"until" binding:"required"`
+}
+
+// ConsumerOffset is the checkpoint of a named consumer of a tenant's event
+// stream: every event up to LastEventID has been handled
+type ConsumerOffset struct {
+	TenantID     string    `gorm:"primaryKey;size:36" json:"-"`
+	ConsumerName string    `gorm:"primaryKey;size:100" json:"name"`
+	LastEventID  uint      `gorm:"not null;default:0" json:"last_event_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// SavedView is a named event filter of a tenant. GET /events?view= expands
+// it server-side.
+type SavedView struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID  string    `gorm:"size:36;not null;uniqueIndex:idx_saved_views_tenant_name" json:"tenant_id"`
+	Name      string    `gorm:"size:100;not null;uniqueIndex:idx_saved_views_tenant_name" json:"name"`
+	Filter    string    `gorm:"type:text" json:"filter"` // ViewFilter as JSON
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Report formats
+const (
+	ReportFormatJSON = "json"
+	ReportFormatText = "text"
+)
+
+// Report is a scheduled summary of a tenant's events, delivered to one of
+// the tenant's webhooks or to a URL of its own
+type Report struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID  string `gorm:"size:36;index;not null" json:"tenant_id"`
+	Name      string `gorm:"size:100;not null" json:"name"`
+	Schedule  string `gorm:"size:100;not null" json:"schedule"` // cron expression, UTC
+	WebhookID *uint  `json:"webhook_id,omitempty"`
+	URL       string `gorm:"size:500" json:"url,omitempty"`
+	// Secret signs deliveries to URL; webhook targets use the webhook's
+	Secret     string     `gorm:"size:64" json:"-"`
+	Filter     string     `gorm:"type:text" json:"filter"` // ReportFilter as JSON
+	Format     string     `gorm:"size:20;not null" json:"format"`
+	Active     bool       `gorm:"not null" json:"active"`
+	NextRunAt  time.Time  `gorm:"index" json:"next_run_at"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastStatus string     `gorm:"size:20" json:"last_status,omitempty"` // delivered or failed
+	LastError  string     `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Alert rule conditions
+const (
+	// AlertThreshold fires when at least Threshold events arrive in Window
+	AlertThreshold = "threshold"
+	// AlertAbsence fires when no event arrives in Window
+	AlertAbsence = "absence"
+	// AlertMetadataMatch fires when at least Threshold events whose metadata
+	// matches Match arrive in Window
+	AlertMetadataMatch = "metadata_match"
+)
+
+// Alert states. A rule is ok or firing; its history records firing and
+// resolved transitions.
+const (
+	AlertOK       = "ok"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertRule is a condition on a tenant's events of one type, evaluated
+// periodically. State changes are sent to one of the tenant's webhooks or
+// to a URL of its own, if set, and to its WebSocket clients.
+type AlertRule struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID  string `gorm:"size:36;index;not null" json:"tenant_id"`
+	Name      string `gorm:"size:100;not null" json:"name"`
+	Condition string `gorm:"size:20;not null" json:"condition"`
+	EventType string `gorm:"size:100;not null" json:"event_type"`
+	Window    string `gorm:"column:time_window;size:20;not null" json:"window"` // Go duration
+	Threshold int64  `gorm:"not null" json:"threshold"`
+	Match     string `gorm:"column:metadata_match;type:text" json:"match"` // JSON object, metadata_match only
+	WebhookID *uint  `json:"webhook_id,omitempty"`
+	URL       string `gorm:"size:500" json:"url,omitempty"`
+	// Secret signs deliveries to URL; webhook targets use the webhook's
+	Secret string `gorm:"size:64" json:"-"`
+	// RenotifyAfter repeats the notification while the rule keeps firing;
+	// empty notifies once per transition
+	RenotifyAfter   string     `gorm:"size:20" json:"renotify_after,omitempty"`
+	Active          bool       `gorm:"not null" json:"active"`
+	State           string     `gorm:"size:10;not null;default:ok" json:"state"`
+	StateSince      time.Time  `json:"state_since"`
+	LastValue       int64      `json:"last_value"`
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at,omitempty"`
+	LastNotifiedAt  *time.Time `json:"last_notified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// AlertHistory records an alert rule starting or stopping to fire
+type AlertHistory struct {
+	ID       uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	RuleID   uint   `gorm:"index;not null" json:"rule_id"`
+	TenantID string `gorm:"size:36;index;not null" json:"tenant_id"`
+	State    string `gorm:"size:10;not null" json:"state"` // firing or resolved
+	// Value is the event count in the window, or for absence rules the
+	// seconds since the last event
+	Value   int64  `json:"value"`
+	Message string `gorm:"type:text" json:"message"`
+	// DeliveryError is set when the webhook or URL notification failed
+	DeliveryError string    `gorm:"type:text" json:"delivery_error,omitempty"`
+	CreatedAt     time.Time `gorm:"index" json:"created_at"`
+}
+
+// Dead letter sources
+const (
+	DeadLetterIngest  = "ingest"
+	DeadLetterSink    = "sink"
+	DeadLetterWebhook = "webhook"
+)
+
+// DeadLetter is an event that could not be stored, or a delivery of one that
+// a sink or webhook finally rejected, kept so it can be inspected and retried
+type DeadLetter struct {
+	ID       uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID string `gorm:"size:36;index" json:"tenant_id"`
+	Source   string `gorm:"size:20;index;not null" json:"source"` // "ingest", "sink" or "webhook"
+	// Target is the sink name or the webhook ID
+	Target      string    `gorm:"size:100" json:"target,omitempty"`
+	EventID     uint      `json:"event_id,omitempty"`
+	Payload     string    `gorm:"type:text" json:"payload"` // JSON string
+	Error       string    `gorm:"type:text" json:"error"`
+	Attempts    int       `gorm:"not null;default:1" json:"attempts"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `gorm:"index" json:"last_seen_at"`
+}
+
+// SystemSetting stores server-wide runtime state, such as maintenance mode,
+// that must survive restarts
+type SystemSetting struct {
+	Key       string    `gorm:"primaryKey;size:100" json:"key"`
+	Value     string    `gorm:"type:text" json:"value"` // JSON string
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 // EventRequest represents the incoming event request
 type EventRequest struct {
 	TenantID  string          `json:"tenant_id" binding:"required,uuid"`
 	EventType string          `json:"event_type" binding:"required,min=1,max=100"`
 	Timestamp string          `json:"timestamp" binding:"required"`
 	Metadata  json.RawMessage `json:"metadata"`
+	// Source names the integration that sent the event, validated like
+	// event_type; over HTTP it may come from the X-Event-Source header
+	Source string `json:"source,omitempty" binding:"max=100"`
+	// CorrelationID and CausationID link the event to a workflow and to
+	// what caused it, at most 128 characters each
+	CorrelationID string `json:"correlation_id,omitempty" binding:"max=128"`
+	CausationID   string `json:"causation_id,omitempty" binding:"max=128"`
+
+	// Credential labels how the sender authenticated, never read from
+	// the body; see auth.Credential
+	Credential string `json:"-"`
+	// ClientIP is the address an HTTP request came from, never read from
+	// the body. The geoip settings decide whether it is stored and
+	// located; dead letters keep the location but not the address.
+	ClientIP string `json:"-"`
 }
 
 // EventResponse represents an event in the API response
 type EventResponse struct {
-	ID        uint64          `json:"id"`
-	TenantID  string          `json:"tenant_id"`
-	EventType string          `json:"event_type"`
-	Timestamp time.Time       `json:"timestamp"`
-	Metadata  json.RawMessage `json:"metadata"`
-	CreatedAt time.Time       `json:"created_at"`
+	ID          uint64          `json:"id"`
+	TenantID    string          `json:"tenant_id"`
+	EventType   string          `json:"event_type"`
+	Sequence    uint64          `json:"sequence"`
+	Timestamp   time.Time       `json:"timestamp"`
+	Metadata    json.RawMessage `json:"metadata"`
+	ClientIP    string          `json:"client_ip,omitempty"`
+	Source      string          `json:"source,omitempty"`
+	Credential  string          `json:"credential,omitempty"`
+	ProcessedAt *time.Time      `json:"processed_at,omitempty"`
+	RedactedAt  *time.Time      `json:"redacted_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+
+	CorrelationID string `json:"correlation_id,omitempty"`
+	CausationID   string `json:"causation_id,omitempty"`
+
+	System bool `json:"system,omitempty"`
+
+	// MetadataRef stands in for metadata the response leaves out
+	MetadataRef *MetadataRef `json:"metadata_ref,omitempty"`
+}
+
+// How much of an event's metadata a response carries, as ?metadata= asks
+const (
+	MetadataFull    = "full"
+	MetadataSummary = "summary"
+	MetadataNone    = "none"
+)
+
+// MetadataPreviewBytes is how much of its metadata a summarized event keeps
+const MetadataPreviewBytes = 256
+
+// MetadataRef describes metadata left out of an event response: its size
+// in bytes, the start of it for summaries, and where to fetch all of it
+type MetadataRef struct {
+	Size    int    `json:"size"`
+	Preview string `json:"preview,omitempty"`
+	URL     string `json:"url"`
+}
+
+// EventMetadataPath is the path serving an event's metadata
+func EventMetadataPath(id uint64) string {
+	return "/api/v1/events/" + strconv.FormatUint(id, 10) + "/metadata"
+}
+
+// WithMetadata returns the response carrying its metadata as mode says:
+// full keeps it, summary replaces metadata longer than
+// MetadataPreviewBytes with a reference previewing its start, and none
+// replaces any metadata with a reference
+func (r EventResponse) WithMetadata(mode string) EventResponse {
+	size := len(r.Metadata)
+	if mode == MetadataFull || mode == "" || size == 0 ||
+		(mode == MetadataSummary && size <= MetadataPreviewBytes) {
+		return r
+	}
+	ref := &MetadataRef{Size: size, URL: EventMetadataPath(r.ID)}
+	if mode == MetadataSummary {
+		// Cut at a character boundary, so the preview stays valid UTF-8
+		cut := MetadataPreviewBytes
+		for cut > 0 && !utf8.RuneStart(r.Metadata[cut]) {
+			cut--
+		}
+		ref.Preview = string(r.Metadata[:cut])
+	}
+	r.Metadata, r.MetadataRef = nil, ref
+	return r
+}
+
+// In returns the response with its times in loc instead of UTC
+func (r EventResponse) In(loc *time.Location) EventResponse {
+	r.Timestamp = r.Timestamp.In(loc)
+	r.CreatedAt = r.CreatedAt.In(loc)
+	if r.ProcessedAt != nil {
+		t := r.ProcessedAt.In(loc)
+		r.ProcessedAt = &t
+	}
+	if r.RedactedAt != nil {
+		t := r.RedactedAt.In(loc)
+		r.RedactedAt = &t
+	}
+	return r
 }
 
 // ToEventResponse converts Event to EventResponse
 func (e *Event) ToEventResponse() EventResponse {
 	var metadata json.RawMessage
-	if e.Metadata != "" {
-		metadata = json.RawMessage(e.Metadata)
+	if plain, err := e.PlainMetadata(); err == nil && plain != "" {
+		metadata = json.RawMessage(plain)
+	}
+	return EventResponse{
+		ID:          uint64(e.ID),
+		TenantID:    e.TenantID,
+		EventType:   e.EventType,
+		Sequence:    e.Sequence,
+		Timestamp:   e.Timestamp,
+		Metadata:    metadata,
+		ClientIP:    e.ClientIP,
+		Source:      e.Source,
+		Credential:  e.Credential,
+		ProcessedAt: e.ProcessedAt,
+		RedactedAt:  e.RedactedAt,
+		CreatedAt:   e.CreatedAt,
+
+		CorrelationID: e.CorrelationID,
+		CausationID:   e.CausationID,
+
+		System: e.System,
+	}
+}
+
+// RedactedMetadata is the metadata a redacted event keeps in place of its
+// own
+func RedactedMetadata(at time.Time) string {
+	data, _ := json.Marshal(struct {
+		Redacted   bool      `json:"_redacted"`
+		RedactedAt time.Time `json:"redacted_at"`
+	}{true, at.UTC()})
+	return string(data)
+}
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// CompressMetadata stores the event's metadata zstd-compressed when it is
+// longer than threshold bytes and compressing makes it smaller, and reports
+// whether it did. Plain metadata is left as it is otherwise.
+func (e *Event) CompressMetadata(threshold int) bool {
+	if e.MetadataEncoding != MetadataPlain || len(e.Metadata) <= threshold {
+		return false
+	}
+	compressed := base64.StdEncoding.EncodeToString(zstdEncoder.EncodeAll([]byte(e.Metadata), nil))
+	if len(compressed) >= len(e.Metadata) {
+		return false
+	}
+	e.Metadata, e.MetadataEncoding = compressed, MetadataZstd
+	return true
+}
+
+// PlainMetadata returns the event's metadata JSON whatever its encoding
+func (e *Event) PlainMetadata() (string, error) {
+	switch e.MetadataEncoding {
+	case MetadataPlain:
+		return e.Metadata, nil
+	case MetadataZstd:
+		compressed, err := base64.StdEncoding.DecodeString(e.Metadata)
+		if err != nil {
+			return "", fmt.Errorf("event %d metadata: %w", e.ID, err)
+		}
+		plain, err := zstdDecoder.DecodeAll(compressed, nil)
+		if err != nil {
+			return "", fmt.Errorf("event %d metadata: %w", e.ID, err)
+		}
+		return string(plain), nil
 	}
+	return "", fmt.Errorf("event %d metadata: unknown encoding %q", e.ID, e.MetadataEncoding)
+}
+
+// DecompressMetadata replaces compressed metadata with its plain JSON
+func (e *Event) DecompressMetadata() error {
+	plain, err := e.PlainMetadata()
+	if err != nil {
+		return err
+	}
+	e.Metadata, e.MetadataEncoding = plain, MetadataPlain
+	return nil
+}
+
+// Versions of the event payload pushed to webhooks and WebSocket clients.
+// Both are built from the same EventResponse, so they carry the same data.
+const (
+	// PayloadV1 is the original shape: an EventResponse, which webhooks
+	// receive wrapped as {"type", "event"}
+	PayloadV1 = 1
+	// PayloadV2 is an EventEnvelope
+	PayloadV2 = 2
+)
+
+// PayloadV1Deprecation is sent to consumers still on PayloadV1
+const PayloadV1Deprecation = "payload_version 1 is deprecated; switch to payload_version 2"
+
+// EventEnvelope is version 2 of the pushed event payload: what identifies
+// and orders the event, with the event itself under data
+type EventEnvelope struct {
+	Version  int       `json:"version"`
+	Type     string    `json:"type"` // "event", or "test" for webhook tests
+	ID       uint64    `json:"id"`
+	TenantID string    `json:"tenant_id"`
+	Sequence uint64    `json:"sequence"`
+	Data     EventData `json:"data"`
+}
+
+// EventData is the body of an EventEnvelope
+type EventData struct {
+	EventType   string          `json:"event_type"`
+	Timestamp   time.Time       `json:"timestamp"`
+	Metadata    json.RawMessage `json:"metadata"`
+	ClientIP    string          `json:"client_ip,omitempty"`
+	Source      string          `json:"source,omitempty"`
+	Credential  string          `json:"credential,omitempty"`
+	ProcessedAt *time.Time      `json:"processed_at,omitempty"`
+	RedactedAt  *time.Time      `json:"redacted_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+
+	CorrelationID string `json:"correlation_id,omitempty"`
+	CausationID   string `json:"causation_id,omitempty"`
+
+	System bool `json:"system,omitempty"`
+
+	MetadataRef *MetadataRef `json:"metadata_ref,omitempty"`
+}
+
+// ToEnvelope converts an EventResponse to a version 2 payload of the given
+// type
+func (r EventResponse) ToEnvelope(messageType string) EventEnvelope {
+	return EventEnvelope{
+		Version:  PayloadV2,
+		Type:     messageType,
+		ID:       r.ID,
+		TenantID: r.TenantID,
+		Sequence: r.Sequence,
+		Data: EventData{
+			EventType:   r.EventType,
+			Timestamp:   r.Timestamp,
+			Metadata:    r.Metadata,
+			ClientIP:    r.ClientIP,
+			Source:      r.Source,
+			Credential:  r.Credential,
+			ProcessedAt: r.ProcessedAt,
+			RedactedAt:  r.RedactedAt,
+			CreatedAt:   r.CreatedAt,
+
+			CorrelationID: r.CorrelationID,
+			CausationID:   r.CausationID,
+
+			System: r.System,
+
+			MetadataRef: r.MetadataRef,
+		},
+	}
+}
+
+// ToEventResponse converts a version 2 payload back to version 1
+func (e EventEnvelope) ToEventResponse() EventResponse {
 	return EventResponse{
-		ID:        uint64(e.ID),
-		TenantID:  e.TenantID,
-		EventType: e.EventType,
-		Timestamp: e.Timestamp,
-		Metadata:  metadata,
-		CreatedAt: e.CreatedAt,
+		ID:          e.ID,
+		TenantID:    e.TenantID,
+		EventType:   e.Data.EventType,
+		Sequence:    e.Sequence,
+		Timestamp:   e.Data.Timestamp,
+		Metadata:    e.Data.Metadata,
+		ClientIP:    e.Data.ClientIP,
+		Source:      e.Data.Source,
+		Credential:  e.Data.Credential,
+		ProcessedAt: e.Data.ProcessedAt,
+		RedactedAt:  e.Data.RedactedAt,
+		CreatedAt:   e.Data.CreatedAt,
+
+		CorrelationID: e.Data.CorrelationID,
+		CausationID:   e.Data.CausationID,
+
+		System: e.Data.System,
+
+		MetadataRef: e.Data.MetadataRef,
+	}
+}
+
+// AuditLogResponse represents an audit log entry in the API response
+type AuditLogResponse struct {
+	ID         uint            `json:"id"`
+	ActorType  string          `json:"actor_type"`
+	ActorID    string          `json:"actor_id,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Details    json.RawMessage `json:"details,omitempty"`
+	// ImpersonatedBy names the operator acting through an impersonation
+	// token
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
+	UserID         uint   `json:"user_id,omitempty"`
+	Hash           string `json:"hash"`
+}
+
+// ToAuditLogResponse converts AuditLog to AuditLogResponse
+func (a *AuditLog) ToAuditLogResponse() AuditLogResponse {
+	var details json.RawMessage
+	if a.Details != "" {
+		details = json.RawMessage(a.Details)
+	}
+	return AuditLogResponse{
+		ID:             a.ID,
+		ActorType:      a.ActorType,
+		ActorID:        a.ActorID,
+		Action:         a.Action,
+		TargetType:     a.TargetType,
+		TargetID:       a.TargetID,
+		RequestID:      a.RequestID,
+		IP:             a.IP,
+		Timestamp:      a.Timestamp,
+		Details:        details,
+		ImpersonatedBy: a.ImpersonatedBy,
+		UserID:         a.UserID,
+		Hash:           a.Hash,
 	}
 }
 
+// UserResponse represents a user in the API response
+type UserResponse struct {
+	ID          uint       `json:"id"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	Active      bool       `json:"active"`
+	HasPassword bool       `json:"has_password"`
+	SSOSubject  string     `json:"sso_subject,omitempty"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ToUserResponse converts User to UserResponse
+func (u *User) ToUserResponse() UserResponse {
+	return UserResponse{
+		ID:          u.ID,
+		Email:       u.Email,
+		Role:        u.Role,
+		Active:      u.Active,
+		HasPassword: u.PasswordHash != "",
+		SSOSubject:  u.SSOSubject,
+		LastLoginAt: u.LastLoginAt,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+	}
+}
+
+// DeadLetterResponse represents a dead letter in the API response
+type DeadLetterResponse struct {
+	ID          uint            `json:"id"`
+	TenantID    string          `json:"tenant_id"`
+	Source      string          `json:"source"`
+	Target      string          `json:"target,omitempty"`
+	EventID     uint            `json:"event_id,omitempty"`
+	Payload     json.RawMessage `json:"payload"`
+	Error       string          `json:"error"`
+	Attempts    int             `json:"attempts"`
+	FirstSeenAt time.Time       `json:"first_seen_at"`
+	LastSeenAt  time.Time       `json:"last_seen_at"`
+}
+
+// ToDeadLetterResponse converts DeadLetter to DeadLetterResponse
+func (d *DeadLetter) ToDeadLetterResponse() DeadLetterResponse {
+	payload := json.RawMessage(d.Payload)
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(d.Payload)
+	}
+	return DeadLetterResponse{
+		ID:          d.ID,
+		TenantID:    d.TenantID,
+		Source:      d.Source,
+		Target:      d.Target,
+		EventID:     d.EventID,
+		Payload:     payload,
+		Error:       d.Error,
+		Attempts:    d.Attempts,
+		FirstSeenAt: d.FirstSeenAt,
+		LastSeenAt:  d.LastSeenAt,
+	}
+}
+
+// AckEventsRequest marks events as processed, either the listed IDs or
+// every event up to and including UpToID; exactly one must be given
+type AckEventsRequest struct {
+	IDs    []uint `json:"ids" binding:"max=1000"`
+	UpToID uint   `json:"up_to_id"`
+}
+
+// AckResult reports what acknowledging one event ID did
+type AckResult struct {
+	ID     uint   `json:"id"`
+	Status string `json:"status"` // acked, already_acked or not_found
+}
+
+// CommitOffsetRequest moves a consumer's checkpoint
+type CommitOffsetRequest struct {
+	LastEventID *uint `json:"last_event_id" binding:"required"`
+}
+
+// ConsumerStatus is a consumer's checkpoint and how far behind it is
+type ConsumerStatus struct {
+	Name        string    `json:"name"`
+	LastEventID uint      `json:"last_event_id"`
+	Lag         int64     `json:"lag"` // events after the checkpoint
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TenantActivity is how recently a tenant used the service
+type TenantActivity struct {
+	TenantID string `json:"tenant_id"`
+	// LastEventAt is when the tenant's newest event was received
+	LastEventAt    *time.Time `json:"last_event_at"`
+	EventsLastHour int64      `json:"events_last_hour"`
+	EventsLastDay  int64      `json:"events_last_day"`
+	// WebSocketClients counts the connections to the replica that answered
+	WebSocketClients    int              `json:"websocket_clients"`
+	LastWebhookDelivery *WebhookDelivery `json:"last_webhook_delivery"`
+	LastAuthAt          *time.Time       `json:"last_auth_at"`
+}
+
+// WebhookDelivery is the outcome of a webhook's latest delivery attempt
+type WebhookDelivery struct {
+	WebhookID    uint      `json:"webhook_id"`
+	URL          string    `json:"url"`
+	Status       string    `json:"status"`
+	FailureCount int       `json:"failure_count"`
+	At           time.Time `json:"at"`
+}
+
+// TenantActivitySummary is a tenant in the activity review: when it last
+// sent an event or authenticated, and LastActiveAt the later of the two
+type TenantActivitySummary struct {
+	TenantID     string     `json:"tenant_id"`
+	Name         string     `json:"name"`
+	Active       bool       `json:"active"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastEventAt  *time.Time `json:"last_event_at"`
+	LastAuthAt   *time.Time `json:"last_auth_at"`
+	LastActiveAt *time.Time `json:"last_active_at"`
+	// MetadataBytes is the metadata size of all the tenant's events,
+	// soft-deleted ones included as they still take space
+	MetadataBytes int64 `json:"metadata_bytes"`
+}
+
+// TenantSettings is per-tenant configuration stored on the tenant
+type TenantSettings struct {
+	RedactionRules []RedactionRule `json:"redaction_rules,omitempty"`
+	SamplingRules  []SamplingRule  `json:"sampling_rules,omitempty"`
+	TransformRules []TransformRule `json:"transform_rules,omitempty"`
+	Quota          *TenantQuota    `json:"quota,omitempty"`
+	// Flags overrides feature flag defaults for the tenant
+	Flags map[string]bool `json:"flags,omitempty"`
+}
+
+// FeatureFlag is a feature flag as it applies to one tenant
+type FeatureFlag struct {
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+	// Override is the tenant's own setting, null when it has none
+	Override *bool `json:"override"`
+	Enabled  bool  `json:"enabled"`
+}
+
+// FeatureFlagRequest overrides a feature flag for a tenant
+type FeatureFlagRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// TenantQuota limits what a tenant may use; zero is unlimited
+type TenantQuota struct {
+	// MonthlyEvents caps the events ingested per calendar month (UTC)
+	MonthlyEvents int `json:"monthly_events"`
+}
+
+// RedactionRule removes, hashes or masks metadata values before an event is
+// stored. Path is dot-separated; "*" matches any key or array element at one
+// level and "**" any number of levels. Pattern, when set, limits the rule to
+// string values matching it, and mask then masks only the matches.
+type RedactionRule struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Action  string `json:"action"` // remove, hash or mask
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// RedactionRulesRequest replaces a tenant's redaction rules
+type RedactionRulesRequest struct {
+	Rules []RedactionRule `json:"rules" binding:"required"`
+	// Version, like If-Match, makes the update conditional on the tenant's
+	// current version
+	Version *int64 `json:"version" binding:"omitempty,min=1"`
+}
+
+// SamplingRule stores only some of a tenant's events of one type: one in
+// every SampleRate, or at most MaxPerMinute each minute. The others are
+// counted but neither stored nor delivered.
+type SamplingRule struct {
+	EventType    string `json:"event_type"`
+	SampleRate   int    `json:"sample_rate,omitempty"`
+	MaxPerMinute int    `json:"max_per_minute,omitempty"`
+}
+
+// SampledTypeStats counts a sampled event type: the events stored, those
+// sampling rules kept out, and the events the stored ones represent.
+// Factor is Represented per stored event.
+type SampledTypeStats struct {
+	Stored      int64   `json:"stored"`
+	SampledOut  int64   `json:"sampled_out"`
+	Represented int64   `json:"represented"`
+	Factor      float64 `json:"sampling_factor"`
+}
+
+// EventSizeStats summarizes the metadata size of a tenant's events of one
+// type, in bytes. The percentiles are nearest-rank values.
+type EventSizeStats struct {
+	P50   int64 `json:"p50_bytes"`
+	P95   int64 `json:"p95_bytes"`
+	Max   int64 `json:"max_bytes"`
+	Total int64 `json:"total_bytes"`
+}
+
+// SamplingRulesRequest replaces a tenant's sampling rules
+type SamplingRulesRequest struct {
+	Rules []SamplingRule `json:"rules" binding:"required"`
+	// Version, like If-Match, makes the update conditional on the tenant's
+	// current version
+	Version *int64 `json:"version" binding:"omitempty,min=1"`
+}
+
+// TransformRule reshapes an event before it is stored. Field and Target are
+// dot-separated metadata paths, or "$event_type" for the event type. Rules
+// run in order, each on the result of the last; OnError decides whether a
+// rule that cannot apply is skipped or rejects the event.
+type TransformRule struct {
+	Name   string `json:"name"`
+	Action string `json:"action"` // rename, set, copy, drop, extract or lowercase
+	Field  string `json:"field,omitempty"`
+	Target string `json:"target,omitempty"`
+	// Value is what set writes
+	Value json.RawMessage `json:"value,omitempty"`
+	// Pattern is extract's regular expression; its first group, or the
+	// whole match without one, is extracted
+	Pattern string `json:"pattern,omitempty"`
+	// Append adds the value to the array at Target instead of replacing it
+	Append  bool   `json:"append,omitempty"`
+	OnError string `json:"on_error,omitempty"` // skip, the default, or reject
+}
+
+// TransformRulesRequest replaces a tenant's transformation rules
+type TransformRulesRequest struct {
+	Rules []TransformRule `json:"rules" binding:"required"`
+	// Version, like If-Match, makes the update conditional on the tenant's
+	// current version
+	Version *int64 `json:"version" binding:"omitempty,min=1"`
+}
+
+// TransformPreviewRequest runs transformation rules over a sample event
+// without storing anything. Without rules the tenant's own apply.
+type TransformPreviewRequest struct {
+	Rules     []TransformRule `json:"rules"`
+	EventType string          `json:"event_type" binding:"required,min=1,max=100"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+// ViewFilter is the event query a saved view stands for. Range is a
+// relative expression such as "last_24h" or "today", evaluated when the view
+// is used. Tags match the strings in the metadata "tags" array.
+type ViewFilter struct {
+	EventTypes []string `json:"event_types,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Range      string   `json:"range,omitempty"`
+	Search     string   `json:"search,omitempty"`
+	Sort       string   `json:"sort,omitempty"` // newest (default) or oldest
+}
+
+// SavedViewRequest creates or replaces a saved view
+type SavedViewRequest struct {
+	Name   string     `json:"name" binding:"required"`
+	Filter ViewFilter `json:"filter"`
+}
+
+// SavedViewResponse represents a saved view in the API response
+type SavedViewResponse struct {
+	ID        uint       `json:"id"`
+	Name      string     `json:"name"`
+	Filter    ViewFilter `json:"filter"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ParseFilter decodes the view's filter
+func (v *SavedView) ParseFilter() (ViewFilter, error) {
+	var filter ViewFilter
+	if v.Filter == "" {
+		return filter, nil
+	}
+	err := json.Unmarshal([]byte(v.Filter), &filter)
+	return filter, err
+}
+
+// ToSavedViewResponse converts SavedView to SavedViewResponse
+func (v *SavedView) ToSavedViewResponse() SavedViewResponse {
+	filter, _ := v.ParseFilter()
+	return SavedViewResponse{
+		ID:        v.ID,
+		Name:      v.Name,
+		Filter:    filter,
+		CreatedAt: v.CreatedAt,
+		UpdatedAt: v.UpdatedAt,
+	}
+}
+
+// ReportFilter narrows the events a report summarises
+type ReportFilter struct {
+	EventTypes []string `json:"event_types,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Search     string   `json:"search,omitempty"`
+}
+
+// ReportRequest creates or replaces a report. Exactly one of WebhookID and
+// URL is the delivery target.
+type ReportRequest struct {
+	Name      string       `json:"name" binding:"required,max=100"`
+	Schedule  string       `json:"schedule" binding:"required,max=100"`
+	WebhookID *uint        `json:"webhook_id"`
+	URL       string       `json:"url" binding:"omitempty,url,max=500"`
+	Filter    ReportFilter `json:"filter"`
+	Format    string       `json:"format"` // json (default) or text
+	// Active defaults to true
+	Active *bool `json:"active"`
+}
+
+// ReportResponse represents a report in the API response
+type ReportResponse struct {
+	ID         uint         `json:"id"`
+	Name       string       `json:"name"`
+	Schedule   string       `json:"schedule"`
+	WebhookID  *uint        `json:"webhook_id,omitempty"`
+	URL        string       `json:"url,omitempty"`
+	Filter     ReportFilter `json:"filter"`
+	Format     string       `json:"format"`
+	Active     bool         `json:"active"`
+	NextRunAt  time.Time    `json:"next_run_at"`
+	LastRunAt  *time.Time   `json:"last_run_at,omitempty"`
+	LastStatus string       `json:"last_status,omitempty"`
+	LastError  string       `json:"last_error,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// ParseFilter decodes the report's filter
+func (r *Report) ParseFilter() (ReportFilter, error) {
+	var filter ReportFilter
+	if r.Filter == "" {
+		return filter, nil
+	}
+	err := json.Unmarshal([]byte(r.Filter), &filter)
+	return filter, err
+}
+
+// ToReportResponse converts Report to ReportResponse
+func (r *Report) ToReportResponse() ReportResponse {
+	filter, _ := r.ParseFilter()
+	return ReportResponse{
+		ID:         r.ID,
+		Name:       r.Name,
+		Schedule:   r.Schedule,
+		WebhookID:  r.WebhookID,
+		URL:        r.URL,
+		Filter:     filter,
+		Format:     r.Format,
+		Active:     r.Active,
+		NextRunAt:  r.NextRunAt,
+		LastRunAt:  r.LastRunAt,
+		LastStatus: r.LastStatus,
+		LastError:  r.LastError,
+		CreatedAt:  r.CreatedAt,
+		UpdatedAt:  r.UpdatedAt,
+	}
+}
+
+// AlertRuleRequest creates or replaces an alert rule. At most one of
+// WebhookID and URL is set; WebSocket clients are always notified.
+type AlertRuleRequest struct {
+	Name      string `json:"name" binding:"required,max=100"`
+	Condition string `json:"condition" binding:"required"`
+	EventType string `json:"event_type" binding:"required,max=100"`
+	Window    string `json:"window" binding:"required,max=20"`
+	// Threshold is required for threshold rules and defaults to 1 for
+	// metadata_match rules
+	Threshold     int64                  `json:"threshold" binding:"min=0"`
+	Match         map[string]interface{} `json:"match"`
+	WebhookID     *uint                  `json:"webhook_id"`
+	URL           string                 `json:"url" binding:"omitempty,url,max=500"`
+	RenotifyAfter string                 `json:"renotify_after" binding:"max=20"`
+	// Active defaults to true
+	Active *bool `json:"active"`
+}
+
+// AlertRuleResponse represents an alert rule in the API response
+type AlertRuleResponse struct {
+	ID              uint                   `json:"id"`
+	Name            string                 `json:"name"`
+	Condition       string                 `json:"condition"`
+	EventType       string                 `json:"event_type"`
+	Window          string                 `json:"window"`
+	Threshold       int64                  `json:"threshold,omitempty"`
+	Match           map[string]interface{} `json:"match,omitempty"`
+	WebhookID       *uint                  `json:"webhook_id,omitempty"`
+	URL             string                 `json:"url,omitempty"`
+	RenotifyAfter   string                 `json:"renotify_after,omitempty"`
+	Active          bool                   `json:"active"`
+	State           string                 `json:"state"`
+	StateSince      time.Time              `json:"state_since"`
+	LastValue       int64                  `json:"last_value"`
+	LastEvaluatedAt *time.Time             `json:"last_evaluated_at,omitempty"`
+	LastNotifiedAt  *time.Time             `json:"last_notified_at,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+// ParseMatch decodes the rule's metadata match
+func (a *AlertRule) ParseMatch() (map[string]interface{}, error) {
+	if a.Match == "" {
+		return nil, nil
+	}
+	var match map[string]interface{}
+	err := json.Unmarshal([]byte(a.Match), &match)
+	return match, err
+}
+
+// ToAlertRuleResponse converts AlertRule to AlertRuleResponse
+func (a *AlertRule) ToAlertRuleResponse() AlertRuleResponse {
+	match, _ := a.ParseMatch()
+	return AlertRuleResponse{
+		ID:              a.ID,
+		Name:            a.Name,
+		Condition:       a.Condition,
+		EventType:       a.EventType,
+		Window:          a.Window,
+		Threshold:       a.Threshold,
+		Match:           match,
+		WebhookID:       a.WebhookID,
+		URL:             a.URL,
+		RenotifyAfter:   a.RenotifyAfter,
+		Active:          a.Active,
+		State:           a.State,
+		StateSince:      a.StateSince,
+		LastValue:       a.LastValue,
+		LastEvaluatedAt: a.LastEvaluatedAt,
+		LastNotifiedAt:  a.LastNotifiedAt,
+		CreatedAt:       a.CreatedAt,
+		UpdatedAt:       a.UpdatedAt,
+	}
+}
+
+// ParseSettings decodes the tenant's settings; a tenant without any has the
+// zero value
+func (t *Tenant) ParseSettings() (TenantSettings, error) {
+	var settings TenantSettings
+	if t.Settings == "" {
+		return settings, nil
+	}
+	err := json.Unmarshal([]byte(t.Settings), &settings)
+	return settings, err
+}
+
+// RestoreTenantRequest controls what restoring a deleted tenant brings back
+type RestoreTenantRequest struct {
+	// Webhooks also restores the webhooks deleted together with the tenant
+	Webhooks bool `json:"restore_webhooks"`
+}
+
+// UpdateTenantRequest changes a tenant's notification mute; fields left
+// out are kept
+type UpdateTenantRequest struct {
+	NotificationsMuted *bool `json:"notifications_muted"`
+	// NotificationsMutedUntil ends a mute by itself; null mutes until
+	// unmuted
+	NotificationsMutedUntil *time.Time `json:"notifications_muted_until"`
+	// ReplayMissed, when unmuting, sends up to this many of the events
+	// stored while muted to the tenant's WebSocket clients and webhooks
+	ReplayMissed int `json:"replay_missed" binding:"min=0,max=10000"`
+}
+
+// ImpersonateRequest mints an impersonation token
+type ImpersonateRequest struct {
+	// ImpersonatedBy identifies the operator, e.g. an email address
+	ImpersonatedBy string `json:"impersonated_by" binding:"required,max=100"`
+	Reason         string `json:"reason" binding:"max=500"`
+	Scope          string `json:"scope"` // read (default) or write
+	// TTL is a Go duration, at most and by default auth.impersonation_ttl
+	TTL string `json:"ttl"`
+}
+
+// CreateUserRequest adds a user to a tenant. A password, an SSO subject or
+// both are required.
+type CreateUserRequest struct {
+	Email      string `json:"email" binding:"required,email,max=254"`
+	Password   string `json:"password" binding:"omitempty,min=8,max=72"`
+	SSOSubject string `json:"sso_subject" binding:"max=255"`
+	Role       string `json:"role" binding:"required"`
+}
+
+// UpdateUserRequest changes a user; omitted fields are left as they are
+type UpdateUserRequest struct {
+	Password   *string `json:"password" binding:"omitempty,min=8,max=72"`
+	SSOSubject *string `json:"sso_subject" binding:"omitempty,max=255"`
+	Role       *string `json:"role"`
+	Active     *bool   `json:"active"`
+}
+
+// LoginRequest signs a user in with their password
+type LoginRequest struct {
+	TenantID string `json:"tenant_id" binding:"required"`
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// MaintenanceRequest toggles maintenance mode
+type MaintenanceRequest struct {
+	Enabled    *bool  `json:"enabled" binding:"required"`
+	Message    string `json:"message" binding:"max=500"`
+	RetryAfter int    `json:"retry_after" binding:"min=0,max=86400"` // seconds
+}
+
+// WebSocketDrainRequest starts draining WebSocket connections
+type WebSocketDrainRequest struct {
+	// Deadline is a Go duration after which remaining connections close
+	Deadline string `json:"deadline" binding:"required"`
+	Message  string `json:"message" binding:"max=500"`
+}
+
+// CreateWebhookRequest represents the request to register a webhook
+type CreateWebhookRequest struct {
+	URL        string   `json:"url" binding:"required,url,max=500"`
+	EventTypes []string `json:"event_types"`
+	// PayloadVersion defaults to 1
+	PayloadVersion int `json:"payload_version" binding:"omitempty,oneof=1 2"`
+	// Timeout and ConnectTimeout override the configured delivery timeouts
+	Timeout        string `json:"timeout" binding:"max=20"`
+	ConnectTimeout string `json:"connect_timeout" binding:"max=20"`
+}
+
+// UpsertWebhookRequest creates or updates a webhook by name. Active
+// defaults to true.
+type UpsertWebhookRequest struct {
+	URL        string   `json:"url" binding:"required,url,max=500"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+	// PayloadVersion defaults to 1
+	PayloadVersion int `json:"payload_version" binding:"omitempty,oneof=1 2"`
+	// Timeout and ConnectTimeout override the configured delivery timeouts
+	Timeout        string `json:"timeout" binding:"max=20"`
+	ConnectTimeout string `json:"connect_timeout" binding:"max=20"`
+	// Version, like If-Match, makes the update conditional on the
+	// webhook's current version
+	Version *int64 `json:"version" binding:"omitempty,min=1"`
+}
+
+// WebhookResponse represents a webhook in the API response
+type WebhookResponse struct {
+	ID            uint       `json:"id"`
+	TenantID      string     `json:"tenant_id"`
+	Name          string     `json:"name,omitempty"`
+	URL           string     `json:"url"`
+	EventTypes    []string   `json:"event_types"`
+	Active        bool       `json:"active"`
+	FailureCount  int        `json:"failure_count"`
+	LastTriggered *time.Time `json:"last_triggered,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Version       int64      `json:"version"`
+	// PayloadVersion is the event payload posted: 1 or 2
+	PayloadVersion int    `json:"payload_version"`
+	Timeout        string `json:"timeout,omitempty"`
+	ConnectTimeout string `json:"connect_timeout,omitempty"`
+	// LastStatus is the outcome of the latest delivery attempt
+	LastStatus string     `json:"last_status,omitempty"`
+	PausedAt   *time.Time `json:"paused_at,omitempty"`
+}
+
+// ToWebhookResponse converts Webhook to WebhookResponse
+func (w *Webhook) ToWebhookResponse() WebhookResponse {
+	eventTypes := []string{}
+	if w.EventTypes != "" {
+		_ = json.Unmarshal([]byte(w.EventTypes), &eventTypes)
+	}
+	var name string
+	if w.Name != nil {
+		name = *w.Name
+	}
+	return WebhookResponse{
+		ID:             w.ID,
+		TenantID:       w.TenantID,
+		Name:           name,
+		URL:            w.URL,
+		EventTypes:     eventTypes,
+		Active:         w.Active,
+		FailureCount:   w.FailureCount,
+		LastTriggered:  w.LastTriggered,
+		CreatedAt:      w.CreatedAt,
+		Version:        w.Version,
+		PayloadVersion: w.PayloadVersion,
+		Timeout:        w.Timeout,
+		ConnectTimeout: w.ConnectTimeout,
+		LastStatus:     w.LastStatus,
+		PausedAt:       w.PausedAt,
+	}
+}
+
+// PayloadVersionOrDefault returns version, or PayloadV1 when it is unset
+func PayloadVersionOrDefault(version int) int {
+	if version == 0 {
+		return PayloadV1
+	}
+	return version
+}
+
 // CreateTenantRequest represents the request to create a tenant
 type CreateTenantRequest struct {
 	Name string `json:"name" binding:"required,min=1,max=255"`
 }
 
+// BulkTenantRequest is one tenant of a bulk provisioning request
+type BulkTenantRequest struct {
+	Name     string          `json:"name"`
+	Settings *TenantSettings `json:"settings"`
+	Quota    *TenantQuota    `json:"quota"`
+}
+
+// BulkTenantResult reports what became of one tenant of a bulk request.
+// The API key is shown only here.
+type BulkTenantResult struct {
+	Index  int              `json:"index"`
+	Name   string           `json:"name"`
+	Status string           `json:"status"` // created, conflict or invalid
+	ID     string           `json:"id,omitempty"`
+	APIKey string           `json:"api_key,omitempty"`
+	Error  *errors.AppError `json:"error,omitempty"`
+}
+
+// Overall outcomes of an event batch
+const (
+	BatchAccepted = "accepted"
+	BatchPartial  = "partial"
+	BatchRejected = "rejected"
+)
+
+// BatchEventResult reports what became of one event of a batch. Status is
+// what POST /events would have answered it with: 201 when stored, 202 when
+// sampling rules kept it out, or the status of its error.
+type BatchEventResult struct {
+	Index    int              `json:"index"`
+	Status   int              `json:"status"`
+	ID       uint64           `json:"id,omitempty"`
+	Sequence uint64           `json:"sequence,omitempty"`
+	Sampled  bool             `json:"sampled,omitempty"`
+	Error    *errors.AppError `json:"error,omitempty"`
+}
+
+// BatchEventResponse reports an event batch: accepted when every event was
+// stored or sampled out, partial when some were rejected, rejected when all
+// were. Items are in request order.
+type BatchEventResponse struct {
+	Status   string             `json:"status"`
+	Accepted int                `json:"accepted"`
+	Rejected int                `json:"rejected"`
+	Items    []BatchEventResult `json:"items"`
+}
+
+// Actions of a bulk webhook request
+const (
+	WebhookActionPause  = "pause"
+	WebhookActionResume = "resume"
+	WebhookActionDelete = "delete"
+)
+
+// BulkWebhookRequest pauses, resumes or deletes webhooks across tenants.
+// At least one of URLPattern and TenantIDs selects them; given both, a
+// webhook must match both. In URLPattern, * matches any characters.
+type BulkWebhookRequest struct {
+	Action     string   `json:"action" binding:"required,oneof=pause resume delete"`
+	URLPattern string   `json:"url_pattern" binding:"max=500"`
+	TenantIDs  []string `json:"tenant_ids" binding:"omitempty,dive,uuid"`
+}
+
+// BulkWebhookResult reports what a bulk request did to one webhook
+type BulkWebhookResult struct {
+	WebhookID uint   `json:"webhook_id"`
+	TenantID  string `json:"tenant_id"`
+	URL       string `json:"url"`
+	Status    string `json:"status"` // paused, resumed, deleted or unchanged
+}
+
+// WebhookTemplateRequest creates the same webhook for each of a list of
+// tenants. A named webhook is created under Name, as PUT /webhooks/:name
+// would.
+type WebhookTemplateRequest struct {
+	TenantIDs []string             `json:"tenant_ids" binding:"required,min=1,dive,uuid"`
+	Name      string               `json:"name"`
+	Webhook   CreateWebhookRequest `json:"webhook" binding:"required"`
+}
+
+// WebhookTemplateResult reports what became of one tenant of a template
+// request. The signing secret is shown only here.
+type WebhookTemplateResult struct {
+	TenantID string           `json:"tenant_id"`
+	Status   string           `json:"status"` // created, conflict or not_found
+	Webhook  *WebhookResponse `json:"webhook,omitempty"`
+	Secret   string           `json:"secret,omitempty"`
+	Error    *errors.AppError `json:"error,omitempty"`
+}
+
 // CreateTenantResponse represents the response after creating a tenant
 type CreateTenantResponse struct {
 	ID     string `json:"id"`
@@ -107,3 +1557,47 @@ type AuthToken struct {
 	APIKey   string `json:"api_key"`
 	Type     string `json:"type"` // "api_key" or "jwt"
 }
+
+// ScopeManage is held, besides ScopeRead and ScopeWrite, by credentials
+// that may manage the tenant's users, credentials and settings
+const ScopeManage = "manage"
+
+// CredentialInfo describes the credential a request was made with and
+// what it may do. It never carries the credential itself.
+type CredentialInfo struct {
+	TenantID   string `json:"tenant_id"`
+	TenantName string `json:"tenant_name"`
+	// AuthType is api_key or jwt, and Credential which kind of either, as
+	// events record it: api_key, token, user:<id> or impersonation
+	AuthType       string   `json:"auth_type"`
+	Credential     string   `json:"credential"`
+	Scopes         []string `json:"scopes"`
+	Role           string   `json:"role,omitempty"`
+	ImpersonatedBy string   `json:"impersonated_by,omitempty"`
+	// ExpiresAt is null for API keys, which are valid until rotated
+	ExpiresAt *time.Time `json:"expires_at"`
+	// RateLimit is null when rate limiting is off, and Quota when the
+	// tenant's monthly events are unlimited
+	RateLimit               *CredentialRateLimit `json:"rate_limit"`
+	Quota                   *CredentialQuota     `json:"quota"`
+	Maintenance             bool                 `json:"maintenance"`
+	NotificationsMuted      bool                 `json:"notifications_muted"`
+	NotificationsMutedUntil *time.Time           `json:"notifications_muted_until,omitempty"`
+}
+
+// CredentialRateLimit is the tenant's request rate limit, counting the
+// request that asked for it
+type CredentialRateLimit struct {
+	RequestsPerMinute int       `json:"requests_per_minute"`
+	Remaining         int       `json:"remaining"`
+	ResetsAt          time.Time `json:"resets_at"`
+}
+
+// CredentialQuota is the tenant's monthly event quota and how much of it
+// is left
+type CredentialQuota struct {
+	MonthlyEvents int       `json:"monthly_events"`
+	Used          int64     `json:"used"`
+	Remaining     int64     `json:"remaining"`
+	ResetsAt      time.Time `json:"resets_at"`
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// filledEventResponse returns an EventResponse with every field set, so a
+// field a conversion drops shows up as a difference
+func filledEventResponse(t *testing.T) EventResponse {
+	t.Helper()
+	var r EventResponse
+	v := reflect.ValueOf(&r).Elem()
+	base := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	for i := 0; i < v.NumField(); i++ {
+		field, name := v.Field(i), v.Type().Field(i).Name
+		switch field.Interface().(type) {
+		case string:
+			field.SetString(name + "-value")
+		case uint64:
+			field.SetUint(uint64(i + 1))
+		case bool:
+			field.SetBool(true)
+		case time.Time:
+			field.Set(reflect.ValueOf(base.Add(time.Duration(i) * time.Second)))
+		case *time.Time:
+			at := base.Add(time.Duration(i) * time.Minute)
+			field.Set(reflect.ValueOf(&at))
+		case json.RawMessage:
+			field.Set(reflect.ValueOf(json.RawMessage(`{"user":{"id":7},"tags":["a","b"]}`)))
+		case *MetadataRef:
+			field.Set(reflect.ValueOf(&MetadataRef{Size: 300, Preview: `{"user"`, URL: EventMetadataPath(1)}))
+		default:
+			t.Fatalf("EventResponse.%s has type %s, which filledEventResponse does not fill", name, field.Type())
+		}
+	}
+	return r
+}
+
+func TestPayloadVersionsRoundTrip(t *testing.T) {
+	event := filledEventResponse(t)
+
+	envelope := event.ToEnvelope("event")
+	if envelope.Version != PayloadV2 || envelope.Type != "event" {
+		t.Fatalf("envelope version %d, type %q, want %d, event", envelope.Version, envelope.Type, PayloadV2)
+	}
+	if got := envelope.ToEventResponse(); !reflect.DeepEqual(got, event) {
+		t.Fatalf("v1 -> v2 -> v1 = %+v, want %+v", got, event)
+	}
+
+	// Through the wire format of each version
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded EventEnvelope
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded.ToEventResponse(); !reflect.DeepEqual(got, event) {
+		t.Fatalf("v2 JSON -> v1 = %+v, want %+v", got, event)
+	}
+
+	if data, err = json.Marshal(event); err != nil {
+		t.Fatal(err)
+	}
+	var v1 EventResponse
+	if err := json.Unmarshal(data, &v1); err != nil {
+		t.Fatal(err)
+	}
+	if got := v1.ToEnvelope("event"); !reflect.DeepEqual(got, envelope) {
+		t.Fatalf("v1 JSON -> v2 = %+v, want %+v", got, envelope)
+	}
+}
+
+func TestPayloadVersionsRoundTripAMinimalEvent(t *testing.T) {
+	event := EventResponse{
+		ID:        1,
+		TenantID:  "tenant-1",
+		EventType: "page.view",
+		Timestamp: time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC),
+		Metadata:  json.RawMessage(`{}`),
+		CreatedAt: time.Date(2026, 3, 14, 15, 9, 27, 0, time.UTC),
+	}
+	data, err := json.Marshal(event.ToEnvelope("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Optional fields stay out of the envelope as they do of version 1
+	want := `{"version":2,"type":"test","id":1,"tenant_id":"tenant-1","sequence":0,"data":{"event_type":"page.view","timestamp":"2026-03-14T15:09:26Z","metadata":{},"created_at":"2026-03-14T15:09:27Z"}}`
+	if string(data) != want {
+		t.Fatalf("envelope = %s, want %s", data, want)
+	}
+	var decoded EventEnvelope
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded.ToEventResponse(); !reflect.DeepEqual(got, event) {
+		t.Fatalf("round trip = %+v, want %+v", got, event)
+	}
+}
+
+func TestPayloadVersionOrDefault(t *testing.T) {
+	for version, want := range map[int]int{0: PayloadV1, PayloadV1: PayloadV1, PayloadV2: PayloadV2} {
+		if got := PayloadVersionOrDefault(version); got != want {
+			t.Errorf("PayloadVersionOrDefault(%d) = %d, want %d", version, got, want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/cache"
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/ingest"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"gorm.io/gorm"
+)
+
+// Bridge subscribes to device topics on an MQTT broker and ingests each
+// message as an event. The tenant is identified by the API key in the topic.
+// Messages are acknowledged once handled, whatever the outcome, so a bad
+// message is never redelivered.
+type Bridge struct {
+	cfg     config.MQTTConfig
+	tenants cache.Tenants
+	ingest  *ingest.Service
+	logger  *slog.Logger
+
+	// keyLevel and typeLevel are the topic levels holding the API key and
+	// the event type; filter is the pattern with both replaced by "+"
+	keyLevel  int
+	typeLevel int
+	filter    string
+
+	conn *autopaho.ConnectionManager
+
+	mu     sync.Mutex
+	status string // empty while connected and subscribed
+}
+
+// New creates a bridge; call Start to connect
+func New(cfg config.MQTTConfig, tenants cache.Tenants, ingestSvc *ingest.Service, logger *slog.Logger) *Bridge {
+	b := &Bridge{
+		cfg:     cfg,
+		tenants: tenants,
+		ingest:  ingestSvc,
+		logger:  logger.With("component", "mqtt"),
+		status:  "connecting",
+	}
+
+	levels := strings.Split(cfg.Topic, "/")
+	for i, level := range levels {
+		switch level {
+		case "{tenant_api_key}":
+			b.keyLevel = i
+			levels[i] = "+"
+		case "{event_type}":
+			b.typeLevel = i
+			levels[i] = "+"
+		}
+	}
+	b.filter = strings.Join(levels, "/")
+	return b
+}
+
+// Start connects in the background and keeps reconnecting until Shutdown;
+// an unreachable broker is reported by Health, not returned here
+func (b *Bridge) Start(ctx context.Context) error {
+	broker, err := url.Parse(b.cfg.Broker)
+	if err != nil {
+		return err
+	}
+
+	var tlsConfig *tls.Config
+	switch broker.Scheme {
+	case "tls", "ssl", "mqtts":
+		if tlsConfig, err = b.tlsConfig(); err != nil {
+			return err
+		}
+	}
+
+	subscribeTo := b.filter
+	if b.cfg.SharedGroup != "" {
+		subscribeTo = "$share/" + b.cfg.SharedGroup + "/" + b.filter
+	}
+
+	conn, err := autopaho.NewConnection(context.WithoutCancel(ctx), autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{broker},
+		TlsCfg:                        tlsConfig,
+		KeepAlive:                     uint16(b.cfg.KeepAlive / time.Second),
+		CleanStartOnInitialConnection: b.cfg.CleanSession,
+		SessionExpiryInterval:         uint32(b.cfg.SessionExpiry / time.Second),
+		ConnectRetryDelay:             b.cfg.ReconnectWait,
+		ConnectUsername:               b.cfg.Username,
+		ConnectPassword:               []byte(b.cfg.Password),
+		ConnectPacketBuilder: func(cp *paho.Connect, _ *url.URL) *paho.Connect {
+			// autopaho sends Request Problem Information = 0 whenever it sets
+			// connect properties, and some brokers then strip user
+			// properties, including the timestamp, from delivered messages
+			if cp.Properties != nil {
+				cp.Properties.RequestProblemInfo = true
+			}
+			return cp
+		},
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+			// Retained messages were ingested when first published; skip
+			// them so reconnecting does not store them again
+			_, err := cm.Subscribe(context.Background(), &paho.Subscribe{
+				Subscriptions: []paho.SubscribeOptions{{
+					Topic:          subscribeTo,
+					QoS:            byte(b.cfg.QoS),
+					RetainHandling: 2,
+				}},
+			})
+			if err != nil {
+				b.setStatus("subscribe failed: " + err.Error())
+				b.logger.Error("Failed to subscribe", "topic", subscribeTo, "error", err)
+				return
+			}
+			b.setStatus("")
+			b.logger.Info("Connected to MQTT broker", "broker", broker.Redacted(), "topic", subscribeTo)
+		},
+		OnConnectError: func(err error) {
+			b.setStatus("connect failed: " + err.Error())
+			b.logger.Warn("Failed to connect to MQTT broker", "broker", broker.Redacted(), "error", err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: b.cfg.ClientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(pr paho.PublishReceived) (bool, error) {
+					b.handle(pr.Packet)
+					return true, nil
+				},
+			},
+			OnClientError: func(err error) {
+				b.setStatus("disconnected: " + err.Error())
+				b.logger.Warn("MQTT connection lost", "error", err)
+			},
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				reason := fmt.Sprintf("reason code %d", d.ReasonCode)
+				if d.Properties != nil && d.Properties.ReasonString != "" {
+					reason = d.Properties.ReasonString
+				}
+				b.setStatus("disconnected by broker: " + reason)
+				b.logger.Warn("MQTT broker closed the connection", "reason", reason)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	b.conn = conn
+	return nil
+}
+
+// Health returns an error while the bridge is not connected and subscribed
+func (b *Bridge) Health() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.status != "" {
+		return stderrors.New(b.status)
+	}
+	return nil
+}
+
+// Shutdown disconnects from the broker after the message in progress
+func (b *Bridge) Shutdown(ctx context.Context) error {
+	if b.conn == nil {
+		return nil
+	}
+	return b.conn.Disconnect(ctx)
+}
+
+func (b *Bridge) setStatus(status string) {
+	b.mu.Lock()
+	b.status = status
+	b.mu.Unlock()
+}
+
+// handle ingests one message: the payload is the event metadata
+func (b *Bridge) handle(msg *paho.Publish) {
+	levels := strings.Split(msg.Topic, "/")
+	if len(levels) <= b.keyLevel || len(levels) <= b.typeLevel {
+		metrics.MQTTMessage("rejected")
+		b.logger.Warn("Rejected message on unexpected topic", "topic", msg.Topic)
+		return
+	}
+	apiKey, eventType := levels[b.keyLevel], levels[b.typeLevel]
+
+	// Never log the key itself; the topic is redacted for the same reason
+	levels[b.keyLevel] = "***"
+	topic := strings.Join(levels, "/")
+
+	ctx := context.Background()
+	tenant, err := b.tenants.ByAPIKey(ctx, apiKey)
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			metrics.MQTTMessage("unauthorized")
+			b.logger.Warn("Rejected message with unknown API key", "topic", topic)
+			return
+		}
+		metrics.MQTTMessage("failed")
+		b.logger.Error("Failed to look up tenant", "topic", topic, "error", err)
+		return
+	}
+
+	receivedAt := time.Now().UTC().Format(time.RFC3339Nano)
+	timestamp := receivedAt
+	if msg.Properties != nil {
+		if ts := msg.Properties.User.Get(b.cfg.TimestampProperty); ts != "" {
+			timestamp = ts
+		}
+	}
+
+	_, err = b.ingest.Ingest(cache.WithTenant(ctx, tenant), models.EventRequest{
+		TenantID:  tenant.ID,
+		EventType: eventType,
+		Timestamp: timestamp,
+		Metadata:  msg.Payload,
+	})
+	if err != nil {
+		var appErr *errors.AppError
+		if stderrors.As(err, &appErr) && appErr.StatusCode >= 500 {
+			metrics.MQTTMessage("failed")
+			b.logger.Error("Failed to ingest message", "topic", topic, "tenant_id", tenant.ID, "error", err)
+			return
+		}
+		metrics.MQTTMessage("rejected")
+		attrs := []any{"topic", topic, "tenant_id", tenant.ID, "error", err}
+		if appErr != nil && appErr.Details != "" {
+			attrs = append(attrs, "details", appErr.Details)
+		}
+		b.logger.Warn("Rejected message", attrs...)
+		return
+	}
+	metrics.MQTTMessage("ingested")
+}
+
+// tlsConfig builds the client TLS configuration from CA and client
+// certificate files
+func (b *Bridge) tlsConfig() (*tls.Config, error) {
+	cfg := b.cfg.TLS
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read MQTT CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in MQTT CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load MQTT client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,232 @@
+package natsbus
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/ingest"
+	"event-ingestion-system/internal/maintenance"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// fetchWait bounds each pull so the loop notices shutdown promptly
+	fetchWait = 5 * time.Second
+	// retryDelay is the pause before re-subscribing or redelivering after a
+	// transient failure
+	retryDelay = 5 * time.Second
+)
+
+// Consumer ingests messages from a JetStream pull consumer. A message is
+// acknowledged only after its event is persisted; invalid messages are
+// terminated, and messages that fail for transient reasons are redelivered
+// up to MaxDeliver times.
+type Consumer struct {
+	js     nats.JetStreamContext
+	cfg    config.NatsConsumeConfig
+	ingest *ingest.Service
+	maint  *maintenance.Mode
+	logger *slog.Logger
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// NewConsumer creates a consumer on a shared connection
+func NewConsumer(nc *nats.Conn, cfg config.NatsConsumeConfig, ingestSvc *ingest.Service, maint *maintenance.Mode, logger *slog.Logger) (*Consumer, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	return &Consumer{
+		js:      js,
+		cfg:     cfg,
+		ingest:  ingestSvc,
+		maint:   maint,
+		logger:  logger.With("component", "nats_consumer", "subject", cfg.Subject),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}, nil
+}
+
+// Run fetches and ingests messages until ctx is cancelled or Shutdown is
+// called. Messages are processed one at a time, in stream order.
+func (c *Consumer) Run(ctx context.Context) {
+	defer close(c.stopped)
+
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stop:
+			cancel()
+		case <-fetchCtx.Done():
+		}
+	}()
+
+	sub := c.subscribe(fetchCtx)
+	if sub == nil {
+		return
+	}
+
+	// Messages already fetched are finished even if fetching stops
+	handleCtx := context.WithoutCancel(ctx)
+	for fetchCtx.Err() == nil {
+		// Writes are rejected during maintenance; leave messages in the
+		// stream rather than burning their delivery attempts
+		if c.maint.Enabled() {
+			sleep(fetchCtx, time.Second)
+			continue
+		}
+
+		waitCtx, cancelWait := context.WithTimeout(fetchCtx, fetchWait)
+		msgs, err := sub.Fetch(c.cfg.BatchSize, nats.Context(waitCtx))
+		cancelWait()
+		if err != nil {
+			if fetchCtx.Err() == nil && !stderrors.Is(err, context.DeadlineExceeded) && !stderrors.Is(err, nats.ErrTimeout) {
+				c.logger.Warn("Failed to fetch messages", "error", err)
+				sleep(fetchCtx, time.Second)
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			c.handle(handleCtx, msg)
+		}
+	}
+}
+
+// Shutdown stops fetching and waits for fetched messages to be handled.
+// Unacknowledged messages are redelivered after a restart.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	c.stopOnce.Do(func() { close(c.stop) })
+
+	select {
+	case <-c.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// subscribe binds the durable pull consumer, retrying until the server and
+// a stream for the subject are available
+func (c *Consumer) subscribe(ctx context.Context) *nats.Subscription {
+	for {
+		sub, err := c.js.PullSubscribe(c.cfg.Subject, c.cfg.Durable,
+			nats.AckWait(c.cfg.AckWait),
+			nats.MaxDeliver(c.cfg.MaxDeliver),
+		)
+		if err == nil {
+			c.logger.Info("NATS consumer started", "durable", c.cfg.Durable)
+			return sub
+		}
+
+		c.logger.Warn("Failed to subscribe, retrying", "durable", c.cfg.Durable, "error", err)
+		if !sleep(ctx, retryDelay) {
+			return nil
+		}
+	}
+}
+
+// handle ingests one message and settles it with the server
+func (c *Consumer) handle(ctx context.Context, msg *nats.Msg) {
+	req, err := c.decode(msg)
+	if err == nil {
+		_, err = c.ingest.Ingest(ctx, req)
+	}
+
+	if err != nil {
+		var appErr *errors.AppError
+		if stderrors.As(err, &appErr) && appErr.StatusCode >= 500 {
+			metrics.NATSMessage("retried")
+			c.logger.Error("Failed to ingest message, will retry", "msg_subject", msg.Subject, "error", err)
+			if err := msg.NakWithDelay(retryDelay); err != nil {
+				c.logger.Warn("Failed to nak message", "error", err)
+			}
+			return
+		}
+
+		// Redelivering an invalid message cannot help
+		metrics.NATSMessage("rejected")
+		attrs := []any{"msg_subject", msg.Subject, "error", err}
+		if appErr != nil && appErr.Details != "" {
+			attrs = append(attrs, "details", appErr.Details)
+		}
+		c.logger.Warn("Rejected message", attrs...)
+		if err := msg.Term(); err != nil {
+			c.logger.Warn("Failed to terminate message", "error", err)
+		}
+		return
+	}
+
+	metrics.NATSMessage("ingested")
+	// The event is stored; if this ack is lost the message is redelivered
+	// and ingested again, so delivery is at least once
+	if err := msg.Ack(); err != nil {
+		c.logger.Warn("Failed to ack message", "msg_subject", msg.Subject, "error", err)
+	}
+}
+
+// decode builds an event request from the message body, filling tenant and
+// event type from headers or subject tokens and the timestamp from the time
+// the stream stored the message
+func (c *Consumer) decode(msg *nats.Msg) (models.EventRequest, error) {
+	var req models.EventRequest
+	if len(msg.Data) > 0 {
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return req, errors.ErrInvalidRequest("Message body must be a JSON event: " + err.Error())
+		}
+	}
+
+	if req.TenantID == "" {
+		req.TenantID = c.lookup(msg, c.cfg.TenantHeader, c.cfg.TenantToken)
+	}
+	if req.EventType == "" {
+		req.EventType = c.lookup(msg, c.cfg.EventTypeHeader, c.cfg.EventTypeToken)
+	}
+	if req.Timestamp == "" {
+		stored := time.Now()
+		if meta, err := msg.Metadata(); err == nil {
+			stored = meta.Timestamp
+		}
+		req.Timestamp = stored.UTC().Format(time.RFC3339Nano)
+	}
+	return req, nil
+}
+
+// lookup returns a header value, falling back to a 1-based subject token
+func (c *Consumer) lookup(msg *nats.Msg, header string, token int) string {
+	if v := msg.Header.Get(header); v != "" {
+		return v
+	}
+	if token > 0 {
+		if tokens := strings.Split(msg.Subject, "."); token <= len(tokens) {
+			return tokens[token-1]
+		}
+	}
+	return ""
+}
+
+// sleep waits for d and reports whether ctx is still live
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,75 @@
+package natsbus
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"event-ingestion-system/internal/config"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Connect opens the NATS connection shared by the publisher and the
+// consumer. It reconnects forever and does not wait for the first
+// connection, so an unavailable server delays delivery but never startup.
+func Connect(cfg config.NatsConfig, logger *slog.Logger) (*nats.Conn, error) {
+	logger = logger.With("component", "nats")
+
+	opts := []nats.Option{
+		nats.Name(cfg.Name),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(cfg.ReconnectWait),
+		nats.RetryOnFailedConnect(true),
+		nats.ConnectHandler(func(nc *nats.Conn) {
+			logger.Info("Connected to NATS", "url", nc.ConnectedUrlRedacted())
+		}),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.Warn("Disconnected from NATS", "error", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.Info("Reconnected to NATS", "url", nc.ConnectedUrlRedacted())
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, sub *nats.Subscription, err error) {
+			attrs := []any{"error", err}
+			if sub != nil {
+				attrs = append(attrs, "subject", sub.Subject)
+			}
+			logger.Error("NATS error", attrs...)
+		}),
+	}
+
+	return nats.Connect(cfg.URL, append(opts, credentials(cfg)...)...)
+}
+
+// Check connects once with the configured credentials and disconnects,
+// for the startup self-check
+func Check(ctx context.Context, cfg config.NatsConfig) error {
+	opts := []nats.Option{nats.Name(cfg.Name), nats.NoReconnect()}
+	if deadline, ok := ctx.Deadline(); ok {
+		opts = append(opts, nats.Timeout(time.Until(deadline)))
+	}
+	nc, err := nats.Connect(cfg.URL, append(opts, credentials(cfg)...)...)
+	if err != nil {
+		return err
+	}
+	nc.Close()
+	return nil
+}
+
+// credentials returns the options that authenticate the connection
+func credentials(cfg config.NatsConfig) []nats.Option {
+	var opts []nats.Option
+	switch {
+	case cfg.Token != "":
+		opts = append(opts, nats.Token(cfg.Token))
+	case cfg.Username != "":
+		opts = append(opts, nats.UserInfo(cfg.Username, cfg.Password))
+	}
+	if cfg.CredsFile != "" {
+		opts = append(opts, nats.UserCredentials(cfg.CredsFile))
+	}
+	return opts
+}
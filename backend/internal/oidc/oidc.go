@@ -0,0 +1,364 @@
+// Package oidc is the relying party of the OpenID Connect authorization code
+// flow: it sends users to the provider, exchanges the code they come back
+// with and validates the ID token. State, nonce and the PKCE verifier travel
+// in a signed cookie, so any replica can finish a flow another one began.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// CookieName carries the flow in progress between login and callback
+	CookieName = "oidc_flow"
+	// FlowTimeout bounds how long a user may take at the provider
+	FlowTimeout = 10 * time.Minute
+
+	// keysRefreshInterval bounds how often an unknown key ID refetches the
+	// provider's keys
+	keysRefreshInterval = time.Minute
+)
+
+// Identity is what a validated ID token says about the user
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider talks to one OpenID Connect provider. Its discovery document and
+// signing keys are fetched on first use and cached.
+type Provider struct {
+	cfg    config.OIDCConfig
+	secret []byte
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *metadata
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// metadata is the part of the discovery document the flow needs
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// flowClaims is the signed content of the flow cookie
+type flowClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// idClaims are the ID token claims that are checked or used
+type idClaims struct {
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	Name          string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// New creates a provider. secret signs the flow cookie.
+func New(cfg config.OIDCConfig, secret string) *Provider {
+	return &Provider{
+		cfg:    cfg,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Begin starts a flow. It returns the provider URL to send the user to and
+// the value of the flow cookie to set alongside.
+func (p *Provider) Begin(ctx context.Context) (string, string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	var state, nonce, verifier string
+	for _, s := range []*string{&state, &nonce, &verifier} {
+		if *s, err = randomString(); err != nil {
+			return "", "", err
+		}
+	}
+	now := time.Now()
+	cookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, flowClaims{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(FlowTimeout)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}).SignedString(p.secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + query.Encode(), cookie, nil
+}
+
+// Finish completes a flow: it checks state against the flow cookie,
+// exchanges the code and validates the ID token, its nonce included
+func (p *Provider) Finish(ctx context.Context, cookie, state, code string) (*Identity, error) {
+	var flow flowClaims
+	_, err := jwt.ParseWithClaims(cookie, &flow, func(*jwt.Token) (interface{}, error) {
+		return p.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("sign-in expired or was not started here: %w", err)
+	}
+	if state == "" || state != flow.State {
+		return nil, errors.New("state does not match")
+	}
+	if code == "" {
+		return nil, errors.New("code is missing")
+	}
+
+	raw, err := p.exchange(ctx, code, flow.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	return p.validate(ctx, raw, flow.Nonce)
+}
+
+// exchange trades a code for the ID token
+func (p *Provider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return token.IDToken, nil
+}
+
+// validate checks an ID token's signature, issuer, audience, lifetime, with
+// the configured clock skew, and nonce
+func (p *Provider) validate(ctx context.Context, raw, nonce string) (*Identity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims idClaims
+	_, err = jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithLeeway(p.cfg.ClockSkew),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid ID token: nonce does not match")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid ID token: no subject")
+	}
+
+	return &Identity{
+		Subject: claims.Subject,
+		Email:   strings.ToLower(claims.Email),
+		// Not every provider sends the claim; only an explicit false counts
+		EmailVerified: claims.EmailVerified == nil || *claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+// metadata returns the discovery document, fetching it on first use
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if meta.Issuer != p.cfg.Issuer && meta.Issuer != strings.TrimSuffix(p.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("discovery: document lacks an endpoint")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// key returns the provider's signing key with the given ID. The keys are
+// refetched when the ID is unknown, at most once per keysRefreshInterval, so
+// rotated keys are picked up.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < keysRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	p.keysFetched = time.Now()
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("signing keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds a cached key; a token without a key ID matches the only key.
+// The caller holds mu.
+func (p *Provider) lookup(kid string) *rsa.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// randomString returns 32 random bytes, base64url-encoded
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
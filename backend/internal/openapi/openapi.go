@@ -0,0 +1,389 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/auth"
+	"event-ingestion-system/internal/maintenance"
+	"event-ingestion-system/internal/version"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Document is an OpenAPI 3.0 document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Tags       []Tag                            `json:"tags,omitempty"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Tag groups operations in the rendered documentation
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation describes one method on a path
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter describes a path, query or header parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes a JSON request body
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes one response status
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of the OpenAPI schema object the generator emits
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Components holds the schemas and security schemes operations refer to
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme describes how a request authenticates
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Options adjusts the document to the running configuration
+type Options struct {
+	// APIKeyHeader is the header tenants send their API key in
+	APIKeyHeader string
+	// MetricsPath is documented when metrics are enabled
+	MetricsPath string
+	// OIDC documents the identity provider sign-in routes
+	OIDC bool
+	// Receipts documents the receipt verification routes
+	Receipts bool
+}
+
+// Build generates the document for every route the server registers.
+// Request and response schemas are reflected from the Go types the handlers
+// bind and render, so they follow the models as those change.
+func Build(opts Options) *Document {
+	g := &generator{schemas: make(map[string]*Schema)}
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "Event Ingestion System API",
+			Description: "Multi-tenant event ingestion with real-time WebSocket delivery, webhooks and event sinks. Errors share one envelope; see the ErrorResponse schema for the codes.",
+			Version:     version.Get().Version,
+		},
+		Tags:  tags,
+		Paths: make(map[string]map[string]*Operation),
+		Components: Components{
+			Schemas: g.schemas,
+			SecuritySchemes: map[string]*SecurityScheme{
+				"apiKey": {
+					Type:        "apiKey",
+					Description: "Tenant API key",
+					Name:        opts.APIKeyHeader,
+					In:          "header",
+				},
+				"bearer": {
+					Type:         "http",
+					Description:  "Tenant JWT from GET /api/v1/tenants/{id}/token",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+				},
+				"adminToken": {
+					Type:        "apiKey",
+					Description: "Operator token; may also be sent as a bearer token",
+					Name:        auth.AdminTokenHeader,
+					In:          "header",
+				},
+			},
+		},
+	}
+
+	ops := append([]operation(nil), operations...)
+	if opts.MetricsPath != "" {
+		ops = append(ops, metricsOperation(opts.MetricsPath))
+	}
+	if opts.OIDC {
+		ops = append(ops, oidcOperations...)
+	}
+	if opts.Receipts {
+		ops = append(ops, receiptOperations...)
+	}
+	for _, op := range ops {
+		path := ginPath(op.path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Operation)
+		}
+		doc.Paths[path][strings.ToLower(op.method)] = op.build(g)
+	}
+	return doc
+}
+
+// Handler serves the document as JSON
+func Handler(doc *Document) gin.HandlerFunc {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		// Every type in the document marshals; this is a programming error
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
+
+// DocsHandler serves Swagger UI for the document at specURL. The UI assets
+// are loaded from a public CDN, so the page needs internet access to render.
+func DocsHandler(specURL string) gin.HandlerFunc {
+	page := strings.ReplaceAll(docsPage, "{{SPEC_URL}}", strconv.Quote(specURL))
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+	}
+}
+
+// Missing returns the routes that have no operation in doc, as "METHOD path"
+// in the router's own notation
+func Missing(doc *Document, routes gin.RoutesInfo) []string {
+	var missing []string
+	for _, r := range routes {
+		if _, ok := doc.Paths[ginPath(r.Path)][strings.ToLower(r.Method)]; !ok {
+			missing = append(missing, r.Method+" "+r.Path)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// ginPath converts :param and *param segments to OpenAPI {param} templates
+func ginPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// generator reflects Go types into schemas, registering each named struct
+// once as a component
+type generator struct {
+	schemas map[string]*Schema
+}
+
+// schemaFor returns the schema for v's type
+func (g *generator) schemaFor(v any) *Schema {
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *generator) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{Description: "Any JSON value"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := componentName(t)
+		if _, ok := g.schemas[name]; !ok {
+			// Reserve the name first so self-referencing types terminate
+			g.schemas[name] = &Schema{}
+			*g.schemas[name] = *g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+// object builds an object schema from exported fields, following the
+// encoding/json rules for names, omitted fields and embedded structs.
+// Fields are required where the binding tag requires them.
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := g.object(f.Type)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		prop := g.schema(f.Type)
+		binding := f.Tag.Get("binding")
+		applyBinding(prop, binding)
+		s.Properties[name] = prop
+
+		if hasRule(binding, "required") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// applyBinding maps the validator rules the handlers enforce onto s
+func applyBinding(s *Schema, binding string) {
+	for _, rule := range strings.Split(binding, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		n, err := strconv.Atoi(value)
+		switch {
+		case key == "uuid":
+			s.Format = "uuid"
+		case key == "url":
+			s.Format = "uri"
+		case key == "min" && err == nil && s.Type == "string":
+			s.MinLength = &n
+		case key == "max" && err == nil && s.Type == "string":
+			s.MaxLength = &n
+		case key == "min" && err == nil:
+			s.Minimum = &n
+		case key == "max" && err == nil:
+			s.Maximum = &n
+		}
+	}
+}
+
+func hasRule(binding, rule string) bool {
+	for _, r := range strings.Split(binding, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// componentNames renames types whose own names are too generic to stand
+// alone in the document
+var componentNames = map[reflect.Type]string{
+	reflect.TypeOf(maintenance.State{}): "MaintenanceState",
+	reflect.TypeOf(version.Info{}):      "VersionInfo",
+}
+
+// componentName is the type name with its first letter upper-cased, so
+// unexported documentation types read like the models beside them
+func componentName(t reflect.Type) string {
+	if name, ok := componentNames[t]; ok {
+		return name
+	}
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Event Ingestion System API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: {{SPEC_URL}}, dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,1313 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"event-ingestion-system/internal/anomaly"
+	"event-ingestion-system/internal/audit"
+	"event-ingestion-system/internal/capture"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/latency"
+	"event-ingestion-system/internal/leader"
+	"event-ingestion-system/internal/maintenance"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/receipt"
+	"event-ingestion-system/internal/report"
+	"event-ingestion-system/internal/transform"
+	"event-ingestion-system/internal/version"
+	"event-ingestion-system/internal/websocket"
+)
+
+// Access levels of an operation
+const (
+	public = iota
+	tenant
+	admin
+)
+
+var tags = []Tag{
+	{Name: "System", Description: "Health, readiness and build information"},
+	{Name: "Tenants", Description: "Tenant registration and credentials"},
+	{Name: "Users", Description: "A tenant's team members and their roles; tenant admins only"},
+	{Name: "Events", Description: "Event ingestion and queries"},
+	{Name: "Views", Description: "Saved event filters"},
+	{Name: "Reports", Description: "Scheduled event summaries delivered by webhook"},
+	{Name: "Alerts", Description: "Rules that notify when event patterns match"},
+	{Name: "Webhooks", Description: "Webhook subscriptions"},
+	{Name: "Consumers", Description: "Pull-based consumption with per-consumer checkpoints"},
+	{Name: "Admin", Description: "Operator API; requires the admin token"},
+}
+
+// operation is one row of the route table. errors lists the failure
+// statuses beyond those implied by access: tenant routes add 401, with the
+// authenticator's own body, and 429, and those that write add 403 for
+// read-only tokens and roles; admin routes add 401, and every route can fail
+// with 500.
+type operation struct {
+	method  string
+	path    string // router notation, e.g. /tenants/:id
+	id      string
+	tag     string
+	summary string
+	desc    string
+	access  int
+	params  []Parameter
+	body    any
+	// bodyType is the media type of a request body that is not JSON
+	bodyType string
+	status   int // success status; 200 when zero
+	ok       any // success body; nil when there is none
+	okType   string
+	// formats lists further media types the body and success response may
+	// take, with the same schema
+	formats []string
+	errors  []int
+	// other documents further statuses whose body is not the error
+	// envelope; a nil body documents a response without one
+	other map[int]any
+}
+
+// Documentation types for responses the handlers build with gin.H; keep
+// them in step with the handlers
+type (
+	health struct {
+		Status    string `json:"status"`
+		Timestamp string `json:"timestamp"`
+		Version   string `json:"version"`
+	}
+	readiness struct {
+		Status      string                     `json:"status"` // ok, degraded, unhealthy, shutting_down or draining
+		Components  map[string]componentHealth `json:"components,omitempty"`
+		Maintenance *maintenance.State         `json:"maintenance,omitempty"`
+		Drain       *websocket.DrainStatus     `json:"drain,omitempty"`
+	}
+	componentHealth struct {
+		Status      string   `json:"status"` // ok, degraded or unhealthy
+		Error       string   `json:"error,omitempty"`
+		LatencyMs   *float64 `json:"latency_ms,omitempty"`        // database
+		QueueDepth  *int     `json:"queue_depth,omitempty"`       // webhook_dispatcher
+		Connections *int     `json:"connections,omitempty"`       // hub
+		Buffered    *int     `json:"buffered_messages,omitempty"` // hub
+	}
+	createdTenant struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		APIKey    string    `json:"api_key"`
+		Token     string    `json:"token"`
+		Active    bool      `json:"active"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	tenantSummary struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		Active    bool      `json:"active"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	tenantWithKey struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		Active    bool      `json:"active"`
+		APIKey    string    `json:"api_key"`
+		Version   int64     `json:"version"`
+		CreatedAt time.Time `json:"created_at"`
+		// NotificationsMuted is false again once the mute's until has passed
+		NotificationsMuted      bool       `json:"notifications_muted"`
+		NotificationsMutedUntil *time.Time `json:"notifications_muted_until,omitempty"`
+		// Webhooks, RecentEvents and Stats are set when ?include= names
+		// them; WebhooksTruncated tells whether there were more webhooks
+		Webhooks          []models.WebhookResponse `json:"webhooks,omitempty"`
+		WebhooksTruncated bool                     `json:"webhooks_truncated,omitempty"`
+		RecentEvents      []models.EventResponse   `json:"recent_events,omitempty"`
+		Stats             *tenantStats             `json:"stats,omitempty"`
+	}
+	tenantStats struct {
+		// Stats counts events by type, plus "total"
+		Stats            map[string]int64 `json:"stats"`
+		UnprocessedCount int64            `json:"unprocessed_count"`
+	}
+	tenantMute struct {
+		ID                      string     `json:"id"`
+		NotificationsMuted      bool       `json:"notifications_muted"`
+		NotificationsMutedUntil *time.Time `json:"notifications_muted_until"`
+		NotificationsMutedAt    *time.Time `json:"notifications_muted_at"`
+		Replayed                int        `json:"replayed"` // missed events sent on unmuting
+	}
+	redactionRules struct {
+		Rules   []models.RedactionRule `json:"rules"`
+		Version int64                  `json:"version"` // the tenant's
+	}
+	samplingRules struct {
+		Rules   []models.SamplingRule `json:"rules"`
+		Version int64                 `json:"version"` // the tenant's
+	}
+	transformRules struct {
+		Rules   []models.TransformRule `json:"rules"`
+		Version int64                  `json:"version"` // the tenant's
+	}
+	transformPreview struct {
+		EventType string          `json:"event_type"`
+		Metadata  json.RawMessage `json:"metadata"`
+		// Applied names the rules that changed the event, in order
+		Applied []string            `json:"applied"`
+		Skipped []transform.Failure `json:"skipped"`
+		// Error is why ingestion would reject the event, if it would
+		Error string `json:"error,omitempty"`
+	}
+	tenantList struct {
+		Tenants []tenantSummary `json:"tenants"`
+	}
+	tenantWithKeyList struct {
+		Tenants []tenantWithKey `json:"tenants"`
+	}
+	authToken struct {
+		Token     string `json:"token"`
+		TokenType string `json:"token_type"`
+		ExpiresIn int    `json:"expires_in"` // seconds
+	}
+	bulkTenants struct {
+		Created   int                       `json:"created"`
+		Conflicts int                       `json:"conflicts"`
+		Invalid   int                       `json:"invalid"`
+		Results   []models.BulkTenantResult `json:"results"`
+	}
+	bulkWebhooks struct {
+		Action  string                     `json:"action"`
+		Matched int                        `json:"matched"`
+		Changed int                        `json:"changed"`
+		Results []models.BulkWebhookResult `json:"results"`
+	}
+	templateWebhooks struct {
+		Created   int                            `json:"created"`
+		Conflicts int                            `json:"conflicts"`
+		NotFound  int                            `json:"not_found"`
+		Results   []models.WebhookTemplateResult `json:"results"`
+	}
+	tenantsActivity struct {
+		MostRecentlyActive []models.TenantActivitySummary `json:"most_recently_active"`
+		LongestInactive    []models.TenantActivitySummary `json:"longest_inactive"`
+		Tenants            int                            `json:"tenants"`
+		Limit              int                            `json:"limit"`
+	}
+	tenantFlags struct {
+		Flags   []models.FeatureFlag `json:"flags"`
+		Version int64                `json:"version"`
+	}
+	tenantFlag struct {
+		Flag    models.FeatureFlag `json:"flag"`
+		Version int64              `json:"version"`
+	}
+	restoredTenant struct {
+		ID               string `json:"id"`
+		Name             string `json:"name"`
+		APIKey           string `json:"api_key"`
+		Active           bool   `json:"active"`
+		WebhooksRestored int64  `json:"webhooks_restored"`
+	}
+	rotatedKey struct {
+		ID     string `json:"id"`
+		APIKey string `json:"api_key"`
+	}
+	ingestedEvent struct {
+		ID        uint      `json:"id"`
+		TenantID  string    `json:"tenant_id"`
+		EventType string    `json:"event_type"`
+		Timestamp time.Time `json:"timestamp"`
+		Ack       string    `json:"ack"` // durable
+		// Receipt is the signed receipt asked for with receipt=true
+		Receipt string `json:"receipt,omitempty"`
+	}
+	receiptVerification struct {
+		Valid bool `json:"valid"`
+		// Reason says why an invalid receipt was rejected
+		Reason string `json:"reason,omitempty"`
+		// Receipt is what the receipt attests; left out when it cannot be
+		// decoded
+		Receipt *receipt.Receipt `json:"receipt,omitempty"`
+	}
+	receiptKey struct {
+		KeyID     string `json:"kid"`
+		PublicKey string `json:"public_key"` // base64
+	}
+	receiptKeys struct {
+		Algorithm string       `json:"algorithm"` // Ed25519
+		Keys      []receiptKey `json:"keys"`
+	}
+	queuedEvent struct {
+		TenantID  string    `json:"tenant_id"`
+		EventType string    `json:"event_type"`
+		Timestamp time.Time `json:"timestamp"`
+		Ack       string    `json:"ack"` // none or received, or any when sampled
+		// Sampled is set when a sampling rule kept the event from being stored
+		Sampled bool `json:"sampled,omitempty"`
+	}
+	// streamAck is a progress record of an event stream, or its summary
+	streamAck struct {
+		AckedThroughLine  int               `json:"acked_through_line"`
+		Accepted          int               `json:"accepted"`
+		Rejected          []streamRejection `json:"rejected"`
+		RejectedTruncated bool              `json:"rejected_truncated,omitempty"`
+		Done              bool              `json:"done,omitempty"`
+		// Error ends a stream that failed after acked_through_line
+		Error *errors.AppError `json:"error,omitempty"`
+	}
+	streamRejection struct {
+		Line  int             `json:"line"`
+		Error errors.AppError `json:"error"`
+	}
+	eventPage struct {
+		Events []models.EventResponse `json:"events"`
+		Limit  int                    `json:"limit"`
+		Offset int                    `json:"offset"`
+		// View is the name of the saved view applied, if any
+		View string `json:"view,omitempty"`
+	}
+	relatedEvents struct {
+		CorrelationID string                 `json:"correlation_id"`
+		Events        []models.EventResponse `json:"events"`
+		// Truncated is set when the chain has more than 1000 events
+		Truncated bool `json:"truncated"`
+	}
+	eventStats struct {
+		// Stats counts events by type, plus "total"
+		Stats map[string]int64 `json:"stats"`
+		// BySource counts events by source; events without one are left out
+		BySource         map[string]int64 `json:"by_source"`
+		UnprocessedCount int64            `json:"unprocessed_count"`
+		// Sizes summarizes metadata sizes by type; MetadataBytes is their
+		// total
+		Sizes         map[string]models.EventSizeStats `json:"sizes"`
+		MetadataBytes int64                            `json:"metadata_bytes"`
+		// Sampling covers the event types sampling rules kept events of
+		Sampling map[string]models.SampledTypeStats `json:"sampling,omitempty"`
+		// Latency gives recent end-to-end latencies by stage: received,
+		// broadcast and webhook
+		Latency map[string]latency.Stats `json:"latency,omitempty"`
+	}
+	polledEvents struct {
+		Events []models.EventResponse `json:"events"`
+		// LastEventID is the after_id for the next poll
+		LastEventID uint64 `json:"last_event_id"`
+		// LastSequence is the after_sequence for the next poll
+		LastSequence uint64 `json:"last_sequence"`
+	}
+	ackedEvents struct {
+		Acked int64 `json:"acked"`
+		// Results has one entry per listed ID; absent for up_to_id
+		Results []models.AckResult `json:"results,omitempty"`
+		UpToID  uint               `json:"up_to_id,omitempty"`
+	}
+	viewList struct {
+		Views []models.SavedViewResponse `json:"views"`
+	}
+	savedReport struct {
+		Report models.ReportResponse `json:"report"`
+		// Secret signs deliveries to the report's url; only returned when
+		// generated
+		Secret string `json:"secret,omitempty"`
+	}
+	reportList struct {
+		Reports []models.ReportResponse `json:"reports"`
+	}
+	reportRun struct {
+		ReportID  uint            `json:"report_id"`
+		Delivered bool            `json:"delivered"`
+		Error     string          `json:"error,omitempty"`
+		Summary   *report.Summary `json:"summary"`
+	}
+	savedAlert struct {
+		Alert models.AlertRuleResponse `json:"alert"`
+		// Secret signs deliveries to the rule's url; only returned when
+		// generated
+		Secret string `json:"secret,omitempty"`
+	}
+	userList struct {
+		Users []models.UserResponse `json:"users"`
+	}
+	userToken struct {
+		Token     string              `json:"token"`
+		TokenType string              `json:"token_type"`
+		ExpiresIn int                 `json:"expires_in"` // seconds
+		User      models.UserResponse `json:"user"`
+	}
+	alertList struct {
+		Alerts []models.AlertRuleResponse `json:"alerts"`
+	}
+	alertHistory struct {
+		AlertID uint                  `json:"alert_id"`
+		History []models.AlertHistory `json:"history"`
+		Limit   int                   `json:"limit"`
+	}
+	createdWebhook struct {
+		Webhook models.WebhookResponse `json:"webhook"`
+		Secret  string                 `json:"secret"`
+	}
+	webhookResult struct {
+		Webhook models.WebhookResponse `json:"webhook"`
+	}
+	webhookTest struct {
+		WebhookID uint `json:"webhook_id"`
+		Delivered bool `json:"delivered"`
+		// Status classifies a failed delivery, such as timeout or dns_error
+		Status     string `json:"status,omitempty"`
+		Error      string `json:"error,omitempty"`
+		DurationMS int64  `json:"duration_ms"`
+	}
+	consumerList struct {
+		Consumers []models.ConsumerStatus `json:"consumers"`
+	}
+	consumerPoll struct {
+		Consumer string                 `json:"consumer"`
+		Offset   uint                   `json:"offset"` // the checkpoint the events follow
+		Events   []models.EventResponse `json:"events"`
+	}
+	webhookList struct {
+		Webhooks []models.WebhookResponse `json:"webhooks"`
+	}
+	auditPage struct {
+		Entries []models.AuditLogResponse `json:"entries"`
+		Limit   int                       `json:"limit"`
+		Offset  int                       `json:"offset"`
+	}
+	deadLetterPage struct {
+		DeadLetters []models.DeadLetterResponse `json:"dead_letters"`
+		Limit       int                         `json:"limit"`
+		Offset      int                         `json:"offset"`
+	}
+	deadLetterRetry struct {
+		ID        uint   `json:"id"`
+		Succeeded bool   `json:"succeeded"`
+		Error     string `json:"error,omitempty"`
+		Attempts  int    `json:"attempts"`
+		// EventID is the stored event when an ingest failure was retried
+		EventID uint `json:"event_id,omitempty"`
+	}
+	redactedConfig struct {
+		Config map[string]any `json:"config"`
+	}
+	impersonationToken struct {
+		Token         string               `json:"token"`
+		TokenType     string               `json:"token_type"`
+		ExpiresIn     int                  `json:"expires_in"` // seconds
+		ExpiresAt     time.Time            `json:"expires_at"`
+		Impersonation models.Impersonation `json:"impersonation"`
+	}
+	impersonationList struct {
+		Impersonations []models.Impersonation `json:"impersonations"`
+		Limit          int                    `json:"limit"`
+	}
+	recentErrorList struct {
+		Enabled bool            `json:"enabled"`
+		Entries []capture.Entry `json:"entries"`
+	}
+	anomalyList struct {
+		Enabled   bool              `json:"enabled"`
+		Anomalies []anomaly.Anomaly `json:"anomalies"`
+	}
+
+	// errorResponse is the envelope AppError.Response renders
+	errorResponse struct {
+		Error errorBody `json:"error"`
+	}
+	errorBody struct {
+		errors.AppError
+		RequestID string `json:"request_id,omitempty"`
+	}
+	// unauthorized is the flat body tenant authentication rejects with
+	unauthorized struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+)
+
+// errorCodes lists every code an error response can carry
+var errorCodes = []errors.ErrorCode{
+	errors.CodeInvalidRequest, errors.CodeInvalidTenantID, errors.CodeInvalidEventType,
+	errors.CodeInvalidTimestamp, errors.CodeInvalidTimeZone, errors.CodeInvalidMetadata, errors.CodeTransformFailed,
+	errors.CodeMetadataSearchUnsupported, errors.CodeBatchRejected,
+	errors.CodeUnauthorized, errors.CodeInvalidAPIKey, errors.CodeExpiredToken, errors.CodeMissingAuth,
+	errors.CodeForbidden,
+	errors.CodeTenantNotFound, errors.CodeEventNotFound, errors.CodeWebhookNotFound, errors.CodeDeadLetterNotFound,
+	errors.CodeViewNotFound, errors.CodeReportNotFound, errors.CodeAlertNotFound,
+	errors.CodeImpersonationNotFound, errors.CodeUserNotFound, errors.CodeExportNotFound, errors.CodeArchiveNotFound, errors.CodeImportNotFound, errors.CodeRedactionNotFound, errors.CodeFlagNotFound, errors.CodeRouteNotFound,
+	errors.CodeMethodNotAllowed,
+	errors.CodeTenantExists, errors.CodeTenantNotDeleted, errors.CodeOffsetBehind, errors.CodeViewExists, errors.CodeWebhookExists,
+	errors.CodeUserExists, errors.CodeExportInProgress, errors.CodeTenantNotEmpty, errors.CodeImportNotFailed, errors.CodeConflictStaleVersion, errors.CodeDrainInProgress, errors.CodeWriteConflict,
+	errors.CodeVersionRequired,
+	errors.CodeRateLimitExceeded, errors.CodeQuotaExceeded,
+	errors.CodeInternalError, errors.CodeDatabaseError, errors.CodeWebSocketError,
+	errors.CodeEventStoreUnsupported,
+	errors.CodeMaintenanceMode, errors.CodeIngestBufferFull, errors.CodeDatabaseBusy, errors.CodeDraining, errors.CodeOverloaded,
+	errors.CodeTimeout, errors.CodeQueryTimeout,
+}
+
+func pathParam(name, desc string) Parameter {
+	return Parameter{Name: name, In: "path", Description: desc, Required: true, Schema: &Schema{Type: "string"}}
+}
+
+func queryParam(name, typ, desc string) Parameter {
+	return Parameter{Name: name, In: "query", Description: desc, Schema: &Schema{Type: typ}}
+}
+
+var (
+	tenantIDParam  = pathParam("id", "Tenant ID (UUID)")
+	offsetParam    = queryParam("offset", "integer", "Number of entries to skip")
+	tzParam        = queryParam("tz", "string", "tz database zone, such as Asia/Kolkata, that times without an offset and the days of today and yesterday are in; default UTC")
+	tzRenderParam  = queryParam("tz_render", "boolean", "Give the response's times in tz rather than UTC; storage is UTC either way")
+	metadataParam  = queryParam("metadata", "string", "How much metadata events carry: full (default); summary, which replaces metadata over 256 bytes with metadata_ref previewing its start; or none, which replaces all of it with metadata_ref")
+	eventTypeParam = queryParam("event_type", "string", "Only events of these types, comma-separated. checkout.* matches types starting with checkout. and !heartbeat leaves heartbeat out; exclusions take precedence over the other patterns")
+	ifMatchParam   = Parameter{Name: "If-Match", In: "header", Description: `Version the update is conditioned on, as in the ETag, e.g. "3"; * for none`, Schema: &Schema{Type: "string"}}
+
+	consumerNameParam = pathParam("name", "Consumer name: letters, digits, dots, dashes or underscores")
+	flagNameParam     = pathParam("name", "Feature flag name, as defined under flags in the configuration")
+	viewParam         = pathParam("id", "View ID or name")
+	reportIDParam     = pathParam("id", "Report ID")
+	alertIDParam      = pathParam("id", "Alert rule ID")
+	userIDParam       = pathParam("id", "User ID")
+)
+
+// binaryFormats are the media types events may also be exchanged in
+var binaryFormats = []string{"application/msgpack", "application/cbor"}
+
+const binaryFormatsDesc = "Send Accept: application/msgpack or application/cbor for a binary response, in which metadata is a nested map and times are native timestamps. Errors are always JSON."
+
+// operations documents every route registered by the main and admin
+// routers except the metrics endpoint, whose path is configurable
+var operations = []operation{
+	{method: "GET", path: "/health", id: "getHealth", tag: "System", summary: "Liveness check", ok: health{}},
+	{
+		method: "GET", path: "/ready", id: "getReadiness", tag: "System", summary: "Readiness check",
+		desc: "Reports the database, webhook_dispatcher, hub and each configured integration with a status of ok, degraded or unhealthy, and an overall status that is the worst of them. " +
+			"Degraded answers 200, so load balancers keep the instance; unhealthy, as when the database is unreachable, answers 503, as does shutting down or draining WebSocket connections. " +
+			"Each component is checked within health.check_timeout; the database's latency and the webhook queue are graded by the health thresholds.",
+		ok: readiness{}, other: map[int]any{http.StatusServiceUnavailable: readiness{}},
+	},
+	{method: "GET", path: "/version", id: "getVersion", tag: "System", summary: "Build information", ok: version.Info{}},
+	{method: "GET", path: "/openapi.json", id: "getOpenAPI", tag: "System", summary: "This OpenAPI document", ok: map[string]any{}},
+	{method: "GET", path: "/docs", id: "getDocs", tag: "System", summary: "Swagger UI for this document", okType: "text/html"},
+
+	{
+		method: "POST", path: "/api/v1/tenants", id: "createTenant", tag: "Tenants", summary: "Register a tenant",
+		desc: "The API key is only returned here and by the key listing; store it securely.",
+		body: models.CreateTenantRequest{}, status: http.StatusCreated, ok: createdTenant{},
+		errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/tenants", id: "listTenants", tag: "Tenants", summary: "List tenants without API keys",
+		ok: tenantList{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/tenants-with-keys", id: "listTenantsWithKeys", tag: "Tenants", summary: "List tenants with API keys",
+		ok: tenantWithKeyList{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/tenants/:id", id: "getTenant", tag: "Tenants", summary: "Get a tenant",
+		desc: "?include= embeds the caller's own relations, so a page needs one request: webhooks (at most 100, by ID), recent_events (the newest 5, or recent_events(n) for up to 50) and stats (event counts by type and unprocessed_count, as /events/stats gives them). " +
+			"They are fetched concurrently and share database.query_timeout; running out of it answers 504 query_timeout. Including another tenant's relations is forbidden.",
+		access: tenant, params: []Parameter{tenantIDParam, queryParam("include", "string", "Relations to embed, comma-separated: webhooks, recent_events, recent_events(n), stats")}, ok: tenantWithKey{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "PATCH", path: "/api/v1/tenants/:id", id: "updateTenant", tag: "Tenants", summary: "Mute or unmute the caller's notifications",
+		desc: "While muted, the tenant's events are stored as usual but neither sent to its WebSocket clients nor queued for its webhooks; notifications_muted_until ends the mute by itself. " +
+			"Muting a muted tenant keeps when the mute began. Unmuting with replay_missed sends up to that many of the events stored while muted, oldest first. The mute does not change the tenant's version.",
+		access: tenant, params: []Parameter{tenantIDParam}, body: models.UpdateTenantRequest{}, ok: tenantMute{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/tenants/:id/activity", id: "getTenantActivity", tag: "Tenants", summary: "Whether the caller is active",
+		desc: "Reports when the newest event was received, the events received in the last hour and day, WebSocket clients connected to the replica that answered, the latest webhook delivery attempt and when the tenant last authenticated. " +
+			"Authentication times are written every 30 seconds, so another replica's may show late; requests made with impersonation tokens are not counted.",
+		access: tenant, params: []Parameter{tenantIDParam}, ok: models.TenantActivity{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/tenants/:id/token", id: "getAuthToken", tag: "Tenants", summary: "Issue a JWT for the tenant",
+		desc:   "Only tenant admins among users may issue one. Impersonation tokens cannot be exchanged for a JWT and are rejected with 403.",
+		access: tenant, params: []Parameter{tenantIDParam}, ok: authToken{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/tenants/:id/rotate-key", id: "rotateAPIKey", tag: "Tenants", summary: "Replace the caller's API key",
+		desc:   "The old key stops working immediately on the replica serving the request and within auth.tenant_cache_ttl on others; JWTs issued before the rotation remain valid until they expire. Impersonation tokens are rejected with 403.",
+		access: tenant, params: []Parameter{tenantIDParam}, ok: rotatedKey{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/tenants/:id/redaction-rules", id: "getRedactionRules", tag: "Tenants", summary: "List the caller's metadata redaction rules",
+		access: tenant, params: []Parameter{tenantIDParam}, ok: redactionRules{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "PUT", path: "/api/v1/tenants/:id/redaction-rules", id: "setRedactionRules", tag: "Tenants", summary: "Replace the caller's metadata redaction rules",
+		desc: "Rules apply to events ingested afterwards; each stored event lists the rules that changed it in its _redactions metadata field. An empty list turns redaction off. " +
+			"With If-Match or version the rules are only saved while the tenant is at that version; otherwise 409 stale_version carries the current one. Under app.missing_version reject, a request naming no version gets 428.",
+		access: tenant, params: []Parameter{tenantIDParam, ifMatchParam}, body: models.RedactionRulesRequest{}, ok: redactionRules{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionRequired, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/tenants/:id/sampling-rules", id: "getSamplingRules", tag: "Tenants", summary: "List the caller's event sampling rules",
+		access: tenant, params: []Parameter{tenantIDParam}, ok: samplingRules{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "PUT", path: "/api/v1/tenants/:id/sampling-rules", id: "setSamplingRules", tag: "Tenants", summary: "Replace the caller's event sampling rules",
+		desc: "Each rule names an event type once and stores one in every sample_rate of its events, at most max_per_minute a minute, or both. The others are answered 202 with sampled true and are neither stored nor delivered, but counted in the event stats. An empty list stores every event. " +
+			"With If-Match or version the rules are only saved while the tenant is at that version; otherwise 409 stale_version carries the current one. Under app.missing_version reject, a request naming no version gets 428.",
+		access: tenant, params: []Parameter{tenantIDParam, ifMatchParam}, body: models.SamplingRulesRequest{}, ok: samplingRules{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionRequired, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/tenants/:id/transform-rules", id: "getTransformRules", tag: "Tenants", summary: "List the caller's event transformation rules",
+		access: tenant, params: []Parameter{tenantIDParam}, ok: transformRules{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "PUT", path: "/api/v1/tenants/:id/transform-rules", id: "setTransformRules", tag: "Tenants", summary: "Replace the caller's event transformation rules",
+		desc: "Rules run in order on events ingested afterwards, before sampling and redaction, within ingest.transform_budget per event. A rule that cannot apply is skipped, or with on_error reject fails the event with 400 transform_failed. An empty list turns transformation off. " +
+			"With If-Match or version the rules are only saved while the tenant is at that version; otherwise 409 stale_version carries the current one. Under app.missing_version reject, a request naming no version gets 428.",
+		access: tenant, params: []Parameter{tenantIDParam, ifMatchParam}, body: models.TransformRulesRequest{}, ok: transformRules{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionRequired, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/tenants/:id/transform-rules/preview", id: "previewTransform", tag: "Tenants", summary: "Dry-run transformation rules on a sample event",
+		desc:   "Runs the rules given, or the caller's saved ones when rules is omitted, over the event_type and metadata given, and stores nothing. An event the rules would reject is answered 200 with the reason in error.",
+		access: tenant, params: []Parameter{tenantIDParam}, body: models.TransformPreviewRequest{}, ok: transformPreview{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/tenants/:id/export", id: "startExport", tag: "Tenants", summary: "Export all of the caller's data",
+		desc: "Queues a background job that bundles the tenant record, its webhooks (without secrets), saved views and every event into an NDJSON archive compressed with gzip or zstd. " +
+			"Each line is {\"type\", \"data\"}, starting with an export header. Archives larger than exports.part_size are stored in parts, which concatenated in order are the whole archive. " +
+			"A tenant may have one export pending or running at a time; another request gets 409 naming it. Not available when database.event_store is memory.",
+		access: tenant, params: []Parameter{tenantIDParam, queryParam("compress", "string", "Archive compression: gzip (default) or zstd")}, status: http.StatusAccepted, ok: models.ExportJobResponse{},
+		errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusNotImplemented, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/tenants/:id/export/:job_id", id: "getExport", tag: "Tenants", summary: "Show an export job",
+		desc: "Once the job has completed, manifest_url fetches the manifest listing the archive's parts with their event counts, sizes and SHA-256 checksums, and each of parts has its download_url, all until url_expires_at; ask again for fresh links. " +
+			"download_url fetches an archive that is a single part. Jobs interrupted while exporting resume after their last stored part.",
+		access: tenant, params: []Parameter{tenantIDParam, pathParam("job_id", "Export job ID")}, ok: models.ExportJobResponse{},
+		errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/archive/*key", id: "downloadArchive", tag: "Tenants", summary: "Download an archive file",
+		desc: "Serves the local archive backend's files through the signed links export jobs hand out; the link is the only credential. " +
+			"Parts are served as application/gzip or application/zstd without a Content-Encoding, and manifests as application/json. With the s3 backend, links point at the bucket instead.",
+		params: []Parameter{
+			pathParam("key", "Archive key"),
+			queryParam("filename", "string", "Name to save the file as"),
+			queryParam("expires", "integer", "Expiry of the link, in Unix seconds"),
+			queryParam("signature", "string", "Signature of the link"),
+		},
+		okType: "application/gzip",
+		errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusServiceUnavailable},
+	},
+
+	{
+		method: "POST", path: "/api/v1/auth/login", id: "login", tag: "Users", summary: "Sign a user in with their password",
+		desc: "Returns a token scoped to the user's tenant and role. Deactivated users and users without a password cannot sign in.",
+		body: models.LoginRequest{}, ok: userToken{},
+		errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/auth/introspect", id: "introspect", tag: "Users", summary: "Describe the caller's credential",
+		desc: "Returns the tenant the credential belongs to, how it authenticated, its scopes (read, write and manage, as its role or impersonation scope allows; API keys and tenant tokens hold all three) and when it expires, null for API keys. " +
+			"rate_limit counts this request and is null when rate limiting is off; quota is null when the tenant's monthly events are unlimited. The credential itself is never returned.",
+		access: tenant, ok: models.CredentialInfo{},
+		errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/users", id: "createUser", tag: "Users", summary: "Add a user to the caller's tenant",
+		desc:   "role is admin, developer or viewer. Viewers may only read; developers may also write everything but users and credentials.",
+		access: tenant, body: models.CreateUserRequest{}, status: http.StatusCreated, ok: models.UserResponse{},
+		errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/users", id: "listUsers", tag: "Users", summary: "List the caller's users",
+		access: tenant, ok: userList{}, errors: []int{http.StatusForbidden, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/users/:id", id: "getUser", tag: "Users", summary: "Get a user",
+		access: tenant, params: []Parameter{userIDParam}, ok: models.UserResponse{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "PUT", path: "/api/v1/users/:id", id: "updateUser", tag: "Users", summary: "Change a user",
+		desc:   "Omitted fields are left as they are. Users cannot change their own role or deactivate themselves.",
+		access: tenant, params: []Parameter{userIDParam}, body: models.UpdateUserRequest{}, ok: models.UserResponse{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "DELETE", path: "/api/v1/users/:id", id: "deleteUser", tag: "Users", summary: "Remove a user",
+		desc:   "The user's tokens stop working at once. Users cannot delete themselves.",
+		access: tenant, params: []Parameter{userIDParam}, status: http.StatusNoContent,
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+
+	{
+		method: "POST", path: "/api/v1/events", id: "ingestEvent", tag: "Events", summary: "Ingest an event",
+		desc: "With ack=durable, the default unless the tenant has the async_ingest feature flag, the event is stored before the 201 response; with the flag the default is received. With ack=none or received the response is 202, without an id, and the event is written in a batch shortly after; a failed write makes it a dead letter. " +
+			"WebSocket clients, webhooks and sinks receive events asynchronously once stored. An event the tenant's sampling rules keep out is answered 202 with sampled true, and is neither stored nor delivered. " +
+			"The body may also be msgpack or CBOR, named by Content-Type, with metadata as a map and the timestamp as a string or native timestamp (CBOR ones are read to the microsecond); the response then follows Accept.",
+		access: tenant,
+		params: []Parameter{
+			queryParam("ack", "string", "Answer once the event is valid (none; dropped if the buffer is full), queued for the buffer writer (received) or committed (durable, the default)"),
+			queryParam("receipt", "boolean", "Add a signed receipt of the stored event to the response; requires ack=durable and configured receipt keys"),
+			{Name: "X-Event-Source", In: "header", Description: "Integration sending the event, when the body has no source", Schema: &Schema{Type: "string"}},
+		},
+		body: models.EventRequest{}, status: http.StatusCreated, ok: ingestedEvent{}, formats: binaryFormats,
+		other:  map[int]any{http.StatusAccepted: queuedEvent{}},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/events/stream", id: "ingestEventStream", tag: "Events", summary: "Ingest a stream of events",
+		desc: "The body is newline-delimited JSON, each line an event as POST /events takes; blank lines are skipped. Every ingest.stream_ack_every accepted lines (1000 by default) are committed in one transaction, and every line through acked_through_line is then settled: stored, or listed in rejected with its error. " +
+			"With Accept: application/x-ndjson, a progress record follows each commit while the body is still being read, so producers can trim their spool; the client must read them as it sends, and the last record has done true or an error. Other clients get one summary once the body ends, listing at most 1000 rejected lines. " +
+			"A stream cut off part way, or failing to store a chunk, leaves exactly the acknowledged lines stored; resend from the line after acked_through_line (error meta.acked_through_line without progress records). The request timeout does not apply; each line must arrive within app.read_timeout.",
+		access: tenant, bodyType: "application/x-ndjson", ok: streamAck{},
+		params: []Parameter{
+			{Name: "X-Event-Source", In: "header", Description: "Integration sending the events, for lines without a source", Schema: &Schema{Type: "string"}},
+		},
+		errors: []int{http.StatusBadRequest, http.StatusServiceUnavailable},
+	},
+	{
+		method: "POST", path: "/api/v1/events/batch", id: "ingestEventBatch", tag: "Events", summary: "Ingest a batch of events",
+		desc: "The body is an array of at most 1000 events, each as POST /events takes it. The valid ones are stored in one transaction, and items reports every event by index with the status POST /events would have answered: 201 with its id and sequence, 202 when sampled out, or the error's status with the error. " +
+			"The response is 201 when no event was rejected and 207 otherwise, with status accepted, partial or rejected; the X-Batch-Result header repeats the counts as accepted=<n>; rejected=<n>. " +
+			"With atomic=true a rejected event rejects the whole batch, 400 batch_rejected with the number rejected in meta.rejected and the errors of the first five in fields, keyed by index. " +
+			"A server error, while checking an event or storing the batch, fails the request with nothing stored, so the same batch can be sent again.",
+		access: tenant,
+		params: []Parameter{
+			queryParam("atomic", "boolean", "Store nothing unless every event is valid"),
+			{Name: "X-Event-Source", In: "header", Description: "Integration sending the events, for those without a source", Schema: &Schema{Type: "string"}},
+		},
+		body: []models.EventRequest{}, status: http.StatusCreated, ok: models.BatchEventResponse{},
+		other:  map[int]any{http.StatusMultiStatus: models.BatchEventResponse{}},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/events", id: "listEvents", tag: "Events", summary: "List the caller's events, newest first",
+		desc: "With view, the saved view's filter applies; each explicit filter parameter, even an empty one, replaces the view's value for that field. Relative ranges are evaluated per request. " +
+			"A search running past database.query_timeout is cancelled and answered 504 query_timeout; narrower filters avoid it. " +
+			binaryFormatsDesc,
+		access: tenant,
+		params: []Parameter{
+			queryParam("limit", "integer", "Page size, at most 100"),
+			offsetParam,
+			queryParam("view", "string", "ID or name of a saved view to apply"),
+			eventTypeParam,
+			queryParam("source", "string", "Only events from these sources, comma-separated"),
+			queryParam("correlation_id", "string", "Only events of this workflow, oldest first unless sort says otherwise"),
+			queryParam("tag", "string", "Only events whose metadata tags array holds this tag; repeat for several"),
+			queryParam("range", "string", "Only events in this relative range: today, yesterday or last_<n><m|h|d|w>"),
+			queryParam("from", "string", "Only events from this time on, ISO8601; without an offset it is in tz. Replaces range"),
+			queryParam("to", "string", "Only events before this time, ISO8601; without an offset it is in tz. Replaces range"),
+			tzParam,
+			tzRenderParam,
+			queryParam("search", "string", "Only events whose metadata contains this text; ignored with event_type"),
+			queryParam("sort", "string", "newest (default) or oldest"),
+			queryParam("processed", "boolean", "Only acknowledged (true) or unacknowledged (false) events"),
+			queryParam("exclude_system", "boolean", "Leave out system events, such as quota notices"),
+			metadataParam,
+		},
+		ok: eventPage{}, formats: binaryFormats, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/events/:id", id: "getEvent", tag: "Events", summary: "Get one of the caller's events",
+		desc:   binaryFormatsDesc,
+		access: tenant, params: []Parameter{pathParam("id", "Event ID"), tzParam, tzRenderParam, metadataParam}, ok: models.EventResponse{}, formats: binaryFormats,
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/events/:id/metadata", id: "getEventMetadata", tag: "Events", summary: "Get an event's metadata",
+		desc:   "Returns the metadata as stored, the document an event's metadata_ref.url points at. The ETag is a hash of the metadata; send it back in If-None-Match to get 304 while it is unchanged. Only redaction changes stored metadata.",
+		access: tenant, params: []Parameter{pathParam("id", "Event ID"), {Name: "If-None-Match", In: "header", Description: "ETag of a copy already held", Schema: &Schema{Type: "string"}}},
+		ok: map[string]any{}, other: map[int]any{http.StatusNotModified: nil},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/events/:id/related", id: "getRelatedEvents", tag: "Events", summary: "Get the events of an event's workflow",
+		desc: "Returns the events sharing the event's correlation_id, itself included, oldest first and at most 1000; an event without one is returned alone. Each event's causation_id tells which step caused it. " +
+			binaryFormatsDesc,
+		access: tenant, params: []Parameter{pathParam("id", "Event ID"), tzParam, tzRenderParam, metadataParam}, ok: relatedEvents{}, formats: binaryFormats,
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/events/stats", id: "getEventStats", tag: "Events", summary: "Count the caller's events by type",
+		desc: "sizes gives the p50, p95 and largest metadata size of each event type and the total, in bytes of the metadata JSON as sent once transformed and redacted, and metadata_bytes the total over all types. " +
+			"Event types the tenant's sampling rules have kept events of are listed under sampling, with the events stored, sampled out and represented, and the sampling factor: events represented per stored event. " +
+			"While metrics.latency_sample_rate is set, latency gives the p50 and p95 milliseconds from the producer timestamp to each stage over the last 256 sampled events this replica handled, and how many of those were stamped ahead of the server's clock.",
+		access: tenant, params: []Parameter{eventTypeParam}, ok: eventStats{},
+		errors: []int{http.StatusBadRequest, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/events/throughput", id: "getThroughput", tag: "Events", summary: "Get the caller's live ingest rates",
+		desc:   "Events per second over the last 1, 10 and 60 whole seconds, counted as events are stored on this replica. WebSocket clients receive the same figures after sending {\"type\":\"subscribe\",\"channels\":[\"throughput\"]}.",
+		access: tenant, ok: websocket.Throughput{},
+	},
+	{
+		method: "GET", path: "/api/v1/events/poll", id: "pollEvents", tag: "Events", summary: "Long-poll for the caller's events after an id or sequence number",
+		desc:   "Returns at once when events newer than after_id, or after after_sequence, exist, oldest first. Sequence numbers are per tenant and gap-free; a gap in the results means events were deleted. Otherwise the request waits until one is ingested or the wait ends, and returns what has arrived, possibly nothing. The wait is capped by app.long_poll_max_wait and the request timeout.",
+		access: tenant,
+		params: []Parameter{
+			queryParam("after_id", "integer", "Return events with a greater id; default 0"),
+			queryParam("after_sequence", "integer", "Return events with a greater sequence number; not combined with after_id"),
+			queryParam("wait", "string", "How long to wait, e.g. 25s or 25; default and cap app.long_poll_max_wait"),
+			queryParam("limit", "integer", "Page size, at most 1000; default 100"),
+			metadataParam,
+		},
+		ok: polledEvents{}, errors: []int{http.StatusBadRequest, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/events/ack", id: "ackEvents", tag: "Events", summary: "Mark events as processed",
+		desc:   "Sets processed_at on the listed ids (at most 1000), or on every event up to and including up_to_id. Listed IDs are reported one by one as acked, already_acked or not_found; IDs of other tenants count as not_found.",
+		access: tenant, body: models.AckEventsRequest{}, ok: ackedEvents{},
+		errors: []int{http.StatusBadRequest, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/events/:id/redact", id: "redactEvent", tag: "Events", summary: "Purge an event's metadata, keeping the event",
+		desc: "Replaces the metadata with {\"_redacted\": true, \"redacted_at\"}, dropping its tags, and returns the event. The tenant's WebSocket clients get an event.updated message with it. " +
+			"Redacted events still count in stats but no longer match search or tag filters. Redacting an event again returns it unchanged. Users need the admin role.",
+		access: tenant, params: []Parameter{pathParam("id", "Event ID")}, ok: models.EventResponse{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/events/redactions", id: "startRedaction", tag: "Events", summary: "Purge the metadata of events of a type within a time range",
+		desc: "Queues a background job redacting, as POST /api/v1/events/{id}/redact does, every event of event_type with a timestamp from since up to but excluding until. " +
+			"After each batch the tenant's WebSocket clients get an events.redacted message with the job_id and event_ids. Users need the admin role. Not available when database.event_store is memory.",
+		access: tenant, body: models.RedactionRequest{}, status: http.StatusAccepted, ok: models.RedactionJob{},
+		errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotImplemented, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/events/redactions/:id", id: "getRedaction", tag: "Events", summary: "Show a redaction job",
+		access: tenant, params: []Parameter{pathParam("id", "Redaction job ID")}, ok: models.RedactionJob{},
+		errors: []int{http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+
+	{
+		method: "POST", path: "/api/v1/views", id: "createView", tag: "Views", summary: "Save a named event filter",
+		desc:   "Names are unique per tenant and may not be all digits, so a view can be referenced by ID or name.",
+		access: tenant, body: models.SavedViewRequest{}, status: http.StatusCreated, ok: models.SavedViewResponse{},
+		errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/views", id: "listViews", tag: "Views", summary: "List the caller's saved views",
+		access: tenant, ok: viewList{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/views/:id", id: "getView", tag: "Views", summary: "Get a saved view",
+		access: tenant, params: []Parameter{viewParam}, ok: models.SavedViewResponse{},
+		errors: []int{http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "PUT", path: "/api/v1/views/:id", id: "updateView", tag: "Views", summary: "Replace a saved view's name and filter",
+		access: tenant, params: []Parameter{viewParam}, body: models.SavedViewRequest{}, ok: models.SavedViewResponse{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "DELETE", path: "/api/v1/views/:id", id: "deleteView", tag: "Views", summary: "Delete a saved view",
+		access: tenant, params: []Parameter{viewParam}, status: http.StatusNoContent,
+		errors: []int{http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+
+	{
+		method: "POST", path: "/api/v1/reports", id: "createReport", tag: "Reports", summary: "Schedule a report",
+		desc:   "schedule is a five-field cron expression in UTC, or a macro such as @daily. Each run summarises the events since the previous scheduled time and compares them to the period before; a run missed while the server was down happens once. Reports are posted as a signed payload of type \"report\" to webhook_id, one of the caller's webhooks, or to url, signed with the returned secret.",
+		access: tenant, body: models.ReportRequest{}, status: http.StatusCreated, ok: savedReport{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/reports", id: "listReports", tag: "Reports", summary: "List the caller's reports",
+		access: tenant, ok: reportList{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/reports/:id", id: "getReport", tag: "Reports", summary: "Get a report",
+		access: tenant, params: []Parameter{reportIDParam}, ok: models.ReportResponse{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "PUT", path: "/api/v1/reports/:id", id: "updateReport", tag: "Reports", summary: "Replace a report's definition",
+		desc:   "The next run is computed from now, so runs missed while a report was inactive are skipped.",
+		access: tenant, params: []Parameter{reportIDParam}, body: models.ReportRequest{}, ok: savedReport{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "DELETE", path: "/api/v1/reports/:id", id: "deleteReport", tag: "Reports", summary: "Delete a report",
+		access: tenant, params: []Parameter{reportIDParam}, status: http.StatusNoContent,
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/reports/:id/run", id: "runReport", tag: "Reports", summary: "Run a report now",
+		desc:   "Delivers once, without retries, a summary of the period ending now that is as long as the schedule's latest interval. The schedule is not moved.",
+		access: tenant, params: []Parameter{reportIDParam}, ok: reportRun{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+
+	{
+		method: "POST", path: "/api/v1/alerts", id: "createAlert", tag: "Alerts", summary: "Add an alert rule",
+		desc:   "condition is threshold (at least threshold events of event_type in window), absence (none in window) or metadata_match (at least threshold events, default 1, whose metadata has the values in match, keyed by dotted path). window and renotify_after are durations such as 5m, from 1m to 168h. Firing and resolving are sent to the caller's WebSocket clients as messages of type \"alert\", and posted as a signed payload of type \"alert\" to webhook_id or to url, signed with the returned secret. While a rule keeps firing it is notified again every renotify_after, or never when that is empty.",
+		access: tenant, body: models.AlertRuleRequest{}, status: http.StatusCreated, ok: savedAlert{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/alerts", id: "listAlerts", tag: "Alerts", summary: "List the caller's alert rules",
+		access: tenant, ok: alertList{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/alerts/:id", id: "getAlert", tag: "Alerts", summary: "Get an alert rule and its state",
+		access: tenant, params: []Parameter{alertIDParam}, ok: models.AlertRuleResponse{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "PUT", path: "/api/v1/alerts/:id", id: "updateAlert", tag: "Alerts", summary: "Replace an alert rule's definition",
+		desc:   "The rule starts over as ok, so one that still matches fires again at its next evaluation.",
+		access: tenant, params: []Parameter{alertIDParam}, body: models.AlertRuleRequest{}, ok: savedAlert{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "DELETE", path: "/api/v1/alerts/:id", id: "deleteAlert", tag: "Alerts", summary: "Delete an alert rule and its history",
+		access: tenant, params: []Parameter{alertIDParam}, status: http.StatusNoContent,
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/alerts/:id/history", id: "getAlertHistory", tag: "Alerts", summary: "List an alert rule's firing and resolved transitions",
+		access: tenant, params: []Parameter{alertIDParam, queryParam("limit", "integer", "Page size, at most 500; default 50")}, ok: alertHistory{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+
+	{
+		method: "POST", path: "/api/v1/webhooks", id: "createWebhook", tag: "Webhooks", summary: "Subscribe a URL to events",
+		desc: "Deliveries are signed with the returned secret, which is not shown again. An empty event_types subscribes to every type; entries are patterns as for the event_type parameter of GET /api/v1/events. payload_version 2 posts events as an envelope with the event under data; version 1, the default unless the tenant has the payload_v2 feature flag, is deprecated. " +
+			"timeout and connect_timeout override the configured delivery timeouts, up to 1m. last_status records the outcome of the latest attempt: delivered, http_error, timeout, connect_timeout, dns_error, tls_error, connection_error, proxy_error, redirect_refused, forbidden_address or error. " +
+			"A url whose host is localhost or a private, loopback or link-local address is refused unless webhooks.allowed_networks admits it; hostnames are checked on every delivery.",
+		access: tenant, body: models.CreateWebhookRequest{}, status: http.StatusCreated, ok: createdWebhook{},
+		errors: []int{http.StatusBadRequest, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/webhooks", id: "listWebhooks", tag: "Webhooks", summary: "List the caller's webhooks",
+		access: tenant, ok: webhookList{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "PUT", path: "/api/v1/webhooks/:name", id: "putWebhook", tag: "Webhooks", summary: "Create or update a webhook by name",
+		desc: "Idempotent for infrastructure-as-code tooling: the webhook named name is created, answered 201 with its signing secret, or its URL, event types, payload version, timeouts and active flag are replaced, answered 200 with its ID and secret kept. " +
+			"Concurrent requests for a name leave one webhook. Deleting the webhook frees its name. " +
+			"With If-Match or version only a webhook at that version is updated; otherwise 409 stale_version carries the current one. Under app.missing_version reject, a request naming no version may only create the webhook, and gets 428 when it exists.",
+		access: tenant, params: []Parameter{pathParam("name", "Webhook name: letters, digits, dots, dashes or underscores, not all digits"), ifMatchParam},
+		body: models.UpsertWebhookRequest{}, status: http.StatusCreated, ok: createdWebhook{}, other: map[int]any{http.StatusOK: webhookResult{}},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionRequired, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "DELETE", path: "/api/v1/webhooks/:id", id: "deleteWebhook", tag: "Webhooks", summary: "Delete a webhook",
+		access: tenant, params: []Parameter{pathParam("id", "Webhook ID")}, status: http.StatusNoContent,
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/webhooks/:id/test", id: "testWebhook", tag: "Webhooks", summary: "Send a test delivery",
+		desc:   "Posts a signed payload of type \"test\" once, without retries, and reports whether the endpoint answered 2xx, with the status of a failure as in last_status. The webhook's failure count is not changed.",
+		access: tenant, params: []Parameter{pathParam("id", "Webhook ID")}, ok: webhookTest{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+
+	{
+		method: "GET", path: "/api/v1/consumers", id: "listConsumers", tag: "Consumers", summary: "List consumers with their checkpoints and lag",
+		desc:   "Lag is the number of the caller's events after the consumer's checkpoint.",
+		access: tenant, ok: consumerList{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/consumers/:name/events", id: "pollConsumer", tag: "Consumers", summary: "Fetch the events after a consumer's checkpoint",
+		desc:   "Events are ordered by id, oldest first. Polling does not move the checkpoint; commit the last handled id. A consumer that never committed starts from the first event.",
+		access: tenant,
+		params: []Parameter{consumerNameParam, queryParam("limit", "integer", "Page size, at most 1000; default 100")},
+		ok:     consumerPoll{}, errors: []int{http.StatusBadRequest, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/consumers/:name/commit", id: "commitConsumer", tag: "Consumers", summary: "Move a consumer's checkpoint",
+		desc:   "Commits are monotonic: an id behind the stored checkpoint fails with 409 unless force=true. Committing the same id again succeeds. The id may not be beyond the caller's latest event.",
+		access: tenant,
+		params: []Parameter{consumerNameParam, queryParam("force", "boolean", "Allow moving the checkpoint backwards")},
+		body:   models.CommitOffsetRequest{}, ok: models.ConsumerOffset{},
+		errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+
+	{
+		method: "GET", path: "/api/v1/ws", id: "openWebSocket", tag: "Events", summary: "Stream the caller's events over a WebSocket",
+		desc: "Authenticate with the usual headers or an api_key query parameter. With after_sequence, stored events after that sequence number are replayed first, up to 10000; a replay_truncated message carries the last_sequence to continue from. " +
+			"payload_version 2 sends events as an envelope with the event under data; clients on version 1, the default unless the tenant has the payload_v2 feature flag, are first sent a deprecation message. " +
+			"correlation_id limits the events sent, replayed or live, to one workflow's.",
+		access: tenant, params: []Parameter{
+			queryParam("api_key", "string", "Tenant API key, for clients that cannot set headers"),
+			queryParam("after_sequence", "integer", "Replay stored events with a greater sequence number before streaming"),
+			queryParam("payload_version", "integer", "Event payload version, 1 or 2; default 1, or 2 with the payload_v2 feature flag"),
+			queryParam("correlation_id", "string", "Only events of this workflow"),
+			metadataParam,
+		},
+		status: http.StatusSwitchingProtocols, errors: []int{http.StatusServiceUnavailable},
+	},
+
+	{
+		method: "GET", path: "/api/v1/admin/tenants/activity", id: "listTenantsActivity", tag: "Admin", summary: "Most and least recently active tenants",
+		desc: "Lists the limit tenants that most recently received an event or authenticated, and the limit inactive the longest, for account review. Tenants never active count as inactive since they were created. " +
+			"Reads the newest event of every tenant, so it is slower than the other admin endpoints.",
+		access: admin, params: []Parameter{queryParam("limit", "integer", "Tenants in each list (default 10, at most 100)")}, ok: tenantsActivity{},
+		errors: []int{http.StatusBadRequest, http.StatusInternalServerError, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/admin/tenants/bulk", id: "createTenantsBulk", tag: "Admin", summary: "Provision many tenants at once",
+		desc: "The body is an array of at most 500 tenants, each with a name and optional settings and quota; a quota given alongside settings replaces theirs. " +
+			"Items that are invalid, repeat an earlier item's name or take an existing tenant's name are reported and skipped. The rest are created in one transaction, all or none. " +
+			"Results follow the request order; API keys are shown only here.",
+		access: admin, body: []models.BulkTenantRequest{}, ok: bulkTenants{},
+		errors: []int{http.StatusBadRequest, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/admin/imports", id: "startImport", tag: "Admin", summary: "Import a tenant from an export archive",
+		desc: "The body is an archive from POST /tenants/{id}/export, gzip- or zstd-compressed, with its parts concatenated in order. Its header and version are checked before the job is queued. " +
+			"With tenant_id the data goes into that existing tenant, which must have no events, webhooks or views; otherwise a tenant is created with the archive's name, or name, and settings, and its API key is shown only here. " +
+			"Events keep their timestamps and sequence numbers under new IDs; webhooks come back inactive with new secrets. Imports notify no subscribers or webhooks. " +
+			"Events whose sequence number the tenant already has and views whose name it already has are skipped and reported as conflicts. Not available when database.event_store is memory.",
+		access: admin, bodyType: "application/gzip", ok: models.ImportJobResponse{}, status: http.StatusAccepted,
+		params: []Parameter{
+			queryParam("tenant_id", "string", "Existing, empty tenant to import into"),
+			queryParam("name", "string", "Name of the created tenant instead of the archive's"),
+		},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusNotImplemented, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/imports/:id", id: "getImport", tag: "Admin", summary: "Show an import job",
+		desc:   "lines is how many archive lines are committed. conflicts holds the first 100 lines that were skipped; conflict_count counts them all.",
+		access: admin, params: []Parameter{pathParam("id", "Import job ID")}, ok: models.ImportJobResponse{},
+		errors: []int{http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/admin/imports/:id/resume", id: "resumeImport", tag: "Admin", summary: "Resume a failed import",
+		desc:   "Queues the job again with its attempts reset; it carries on after the last committed batch. Fails with 409 unless the job has failed.",
+		access: admin, params: []Parameter{pathParam("id", "Import job ID")}, ok: models.ImportJobResponse{}, status: http.StatusAccepted,
+		errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "PATCH", path: "/api/v1/admin/tenants/:id", id: "adminUpdateTenant", tag: "Admin", summary: "Mute or unmute a tenant's notifications",
+		desc: "While muted, the tenant's events are stored as usual but neither sent to its WebSocket clients nor queued for its webhooks; notifications_muted_until ends the mute by itself. " +
+			"Muting a muted tenant keeps when the mute began. Unmuting with replay_missed sends up to that many of the events stored while muted, oldest first. The mute does not change the tenant's version.",
+		access: admin, params: []Parameter{tenantIDParam}, body: models.UpdateTenantRequest{}, ok: tenantMute{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "DELETE", path: "/api/v1/admin/tenants/:id", id: "deleteTenant", tag: "Admin", summary: "Deactivate and delete a tenant and its webhooks",
+		access: admin, params: []Parameter{tenantIDParam}, status: http.StatusNoContent,
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/admin/tenants/:id/restore", id: "restoreTenant", tag: "Admin", summary: "Restore a deleted tenant",
+		desc:   "Undeletes and reactivates the tenant under a new API key. With restore_webhooks, the webhooks deleted together with the tenant come back too. Fails with 409 when the tenant is not deleted or another tenant has taken its name.",
+		access: admin, params: []Parameter{tenantIDParam}, body: models.RestoreTenantRequest{}, ok: restoredTenant{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/tenants/:id/flags", id: "getTenantFlags", tag: "Admin", summary: "List feature flags as they apply to a tenant",
+		desc:   "Every flag defined in the configuration, with its default, the tenant's override (null when it has none) and whether it is enabled for the tenant.",
+		access: admin, params: []Parameter{tenantIDParam}, ok: tenantFlags{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "PUT", path: "/api/v1/admin/tenants/:id/flags/:name", id: "setTenantFlag", tag: "Admin", summary: "Override a feature flag for a tenant",
+		desc:   "Turns the flag on or off for the tenant regardless of its default. Other replicas apply the change once their cached tenant expires (auth.tenant_cache_ttl). Audited as tenant.flag.update.",
+		access: admin, params: []Parameter{tenantIDParam, flagNameParam}, body: models.FeatureFlagRequest{}, ok: tenantFlag{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusGatewayTimeout},
+	},
+	{
+		method: "DELETE", path: "/api/v1/admin/tenants/:id/flags/:name", id: "resetTenantFlag", tag: "Admin", summary: "Remove a tenant's feature flag override",
+		desc:   "The flag's default applies to the tenant again. Audited as tenant.flag.reset.",
+		access: admin, params: []Parameter{tenantIDParam, flagNameParam}, ok: tenantFlag{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/admin/tenants/:id/impersonate", id: "impersonateTenant", tag: "Admin", summary: "Mint a token that acts as the tenant",
+		desc:   "The token authenticates as the tenant without its API key, for at most auth.impersonation_ttl. It is read-only unless scope is write, cannot be refreshed, and stops working once revoked. Responses to requests made with it carry an X-Impersonated-By header, and audit entries they cause record the operator.",
+		access: admin, params: []Parameter{tenantIDParam}, body: models.ImpersonateRequest{}, ok: impersonationToken{},
+		status: http.StatusCreated,
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/impersonations", id: "listImpersonations", tag: "Admin", summary: "List impersonation tokens, newest first",
+		access: admin,
+		params: []Parameter{
+			queryParam("tenant_id", "string", "Only this tenant's impersonations"),
+			queryParam("active", "boolean", "Only tokens neither expired nor revoked"),
+			queryParam("limit", "integer", "Page size, at most 500"),
+		},
+		ok: impersonationList{}, errors: []int{http.StatusBadRequest, http.StatusGatewayTimeout},
+	},
+	{
+		method: "DELETE", path: "/api/v1/admin/impersonations/:id", id: "revokeImpersonation", tag: "Admin", summary: "Revoke an impersonation token",
+		desc:   "Requests made with the token are rejected with 401 from then on. Revoking a token again keeps the first revocation time.",
+		access: admin, params: []Parameter{pathParam("id", "Impersonation ID, the token's jti")}, ok: models.Impersonation{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/audit", id: "listAuditLogs", tag: "Admin", summary: "Query the audit log",
+		access: admin,
+		params: []Parameter{
+			queryParam("actor_type", "string", "tenant, admin or anonymous"),
+			queryParam("actor", "string", "Actor ID"),
+			queryParam("action", "string", "Action, e.g. tenant.create"),
+			queryParam("impersonated_by", "string", "Only entries recorded through this operator's impersonation tokens"),
+			queryParam("from", "string", "Earliest timestamp, ISO8601"),
+			queryParam("to", "string", "Latest timestamp, ISO8601"),
+			queryParam("limit", "integer", "Page size, at most 500"),
+			offsetParam,
+		},
+		ok: auditPage{}, errors: []int{http.StatusBadRequest, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/audit/verify", id: "verifyAuditLog", tag: "Admin", summary: "Check the audit log's hash chain",
+		desc: "Walks the audit log in ID order, checking that each entry's hash matches its fields and its predecessor's hash, and that the last entry is the chain head. " +
+			"A broken chain is reported with 200, valid false, the ID of the first bad entry in broken_at, or 0 when only the head is wrong, and a reason.",
+		access: admin, ok: audit.Verification{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/admin/webhooks/bulk", id: "changeWebhooksBulk", tag: "Admin", summary: "Pause, resume or delete webhooks across tenants",
+		desc: "Selects webhooks by url_pattern, where * matches any characters, by tenant_ids, or by both, and applies action to all of them in one transaction; more than 1000 matches are refused. " +
+			"A paused webhook keeps its settings, but its deliveries are held, up to webhooks.paused_buffer_size per webhook, and sent in order once it is resumed; deliveries beyond that, or still held at shutdown, become dead letters. " +
+			"Each matched webhook is reported as paused, resumed, deleted or unchanged, and each change is audited.",
+		access: admin, body: models.BulkWebhookRequest{}, ok: bulkWebhooks{},
+		errors: []int{http.StatusBadRequest, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/admin/webhooks/from-template", id: "createWebhooksFromTemplate", tag: "Admin", summary: "Create the same webhook for many tenants",
+		desc: "Creates webhook, named name when given, for each of at most 1000 tenant_ids, each with its own signing secret, shown only here. " +
+			"Tenants that do not exist or already have a webhook of that name are reported and skipped. The rest are created in one transaction, all or none.",
+		access: admin, body: models.WebhookTemplateRequest{}, ok: templateWebhooks{},
+		errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/dead-letters", id: "listDeadLetters", tag: "Admin", summary: "List dead letters, most recently failed first",
+		desc:   "Events that could not be stored and sink or webhook deliveries that failed every attempt. Dead letters expire after dead_letters.retention.",
+		access: admin,
+		params: []Parameter{
+			queryParam("tenant_id", "string", "Only this tenant's dead letters"),
+			queryParam("source", "string", "ingest, sink or webhook"),
+			queryParam("limit", "integer", "Page size, at most 500"),
+			offsetParam,
+		},
+		ok: deadLetterPage{}, errors: []int{http.StatusBadRequest, http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/admin/dead-letters/:id/retry", id: "retryDeadLetter", tag: "Admin", summary: "Process a dead letter again",
+		desc:   "Ingest failures are ingested again; sink and webhook failures are delivered once more to the same target. The dead letter is removed on success and its attempt count raised on failure; both are reported with 200.",
+		access: admin, params: []Parameter{pathParam("id", "Dead letter ID")}, ok: deadLetterRetry{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/config", id: "getConfig", tag: "Admin", summary: "Effective configuration with secrets redacted",
+		access: admin, ok: redactedConfig{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/anomalies", id: "listAnomalies", tag: "Admin", summary: "Tenants with an anomalous ingestion rate",
+		desc:   "Lists tenants whose events per minute over the latest interval are anomalies.factor times above (spike) or below (drop) their learned baseline. Tenants in their learning window or with a baseline under anomalies.min_rate are never listed. Each replica reports the traffic it received.",
+		access: admin, ok: anomalyList{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/database/pool", id: "getDatabasePool", tag: "Admin", summary: "Database connection pool saturation",
+		desc: "Reports the connections open, in use and idle against max_open, the share in use, and how often and how long queries waited for a connection. " +
+			"acquire_timeouts counts the queries that gave up after database.acquire_timeout, failing their request with 503 database_busy. Each replica reports its own pool.",
+		access: admin, ok: database.PoolStats{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/leader", id: "getLeader", tag: "Admin", summary: "Leader of the background jobs",
+		desc: "With leader.enabled, only the replica holding the lease runs the report scheduler and the dead letter purge. Reports this replica's instance_id and whether it leads, and the current lease holder and expiry. " +
+			"With election disabled every replica leads and no lease is kept.",
+		access: admin, ok: leader.Status{}, errors: []int{http.StatusInternalServerError},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/recent-errors", id: "listRecentErrors", tag: "Admin", summary: "Recently failed requests",
+		desc: "Lists the latest 4xx and 5xx requests kept in memory while debug.capture_failed_requests is on, newest first. Credential headers and secret-looking query parameters and body fields are redacted, and bodies are cut at debug.capture_body_bytes. " +
+			"Each replica reports the requests it served.",
+		access: admin,
+		params: []Parameter{
+			queryParam("tenant_id", "string", "Only this tenant's requests"),
+			queryParam("route", "string", "Only this route pattern or path, e.g. /api/v1/events"),
+			queryParam("code", "string", "Only this HTTP status, e.g. 400, or error code, e.g. invalid_request"),
+			queryParam("limit", "integer", "Maximum entries (default 50)"),
+		},
+		ok: recentErrorList{}, errors: []int{http.StatusBadRequest, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/maintenance", id: "getMaintenance", tag: "Admin", summary: "Maintenance mode state",
+		access: admin, ok: maintenance.State{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/admin/maintenance", id: "setMaintenance", tag: "Admin", summary: "Switch maintenance mode",
+		desc:   "While enabled, writes are rejected with 503 and a Retry-After header; reads are still served.",
+		access: admin, body: models.MaintenanceRequest{}, ok: maintenance.State{},
+		errors: []int{http.StatusBadRequest, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/ws/stats", id: "getWebSocketStats", tag: "Admin", summary: "WebSocket hub counters",
+		desc: "Connections in total and per tenant, messages waiting to be written, and counters since startup: registrations, messages sent and dropped, truncated replays and the mean time from queueing a message to writing it. " +
+			"messages_dropped counts messages lost to a full send buffer, whether the client was disconnected for it or the message skipped, and notices dropped for a full broadcast queue. Each replica reports its own hub.",
+		access: admin, ok: websocket.HubStats{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/admin/ws/drain", id: "getWebSocketDrain", tag: "Admin", summary: "WebSocket drain state",
+		desc:   "draining is false until a drain starts; closed is set once the connections left at the deadline are closed. Each replica reports its own drain.",
+		access: admin, ok: websocket.DrainStatus{}, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "POST", path: "/api/v1/admin/ws/drain", id: "drainWebSockets", tag: "Admin", summary: "Drain WebSocket connections before a restart",
+		desc: "Sends every client of this replica a reconnect_requested message carrying message and deadline, then refuses new connections with 503 draining and a Retry-After header, and fails /ready. " +
+			"Connections still open at the deadline, a Go duration of at most 1h, are closed with code 1012 (service restart). The drain lasts until the process restarts; a second request gets 409 drain_in_progress.",
+		access: admin, body: models.WebSocketDrainRequest{}, ok: websocket.DrainStatus{}, status: http.StatusAccepted,
+		errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/debug/*path", id: "getDebug", tag: "Admin", summary: "Diagnostics: pprof profiles and expvar",
+		desc:   "Only served on the admin listener.",
+		access: admin, params: []Parameter{pathParam("path", "e.g. pprof/heap or vars")}, okType: "application/octet-stream",
+	},
+}
+
+// oidcOperations are served when auth.oidc is configured
+var oidcOperations = []operation{
+	{
+		method: "GET", path: "/api/v1/auth/oidc/login", id: "oidcLogin", tag: "Users", summary: "Start signing in with the identity provider",
+		desc:   "Redirects to the provider and sets the cookie that carries the flow's state to the callback.",
+		status: http.StatusFound, errors: []int{http.StatusGatewayTimeout},
+	},
+	{
+		method: "GET", path: "/api/v1/auth/oidc/callback", id: "oidcCallback", tag: "Users", summary: "Finish signing in with the identity provider",
+		desc: "The provider redirects here. The user is found by the provider's subject, then by email, or provisioned with the default role when the email domain maps to a tenant. " +
+			"With auth.oidc.dashboard_url set, the response redirects there with the token in the URL fragment instead.",
+		params: []Parameter{queryParam("code", "string", "Authorization code"), queryParam("state", "string", "State sent to the provider")},
+		ok:     userToken{}, other: map[int]any{http.StatusFound: nil},
+		errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusGatewayTimeout},
+	},
+}
+
+// receiptOperations are served when receipts.keys is configured
+var receiptOperations = []operation{
+	{
+		method: "GET", path: "/api/v1/receipts/verify", id: "verifyReceipt", tag: "Events", summary: "Verify an event receipt",
+		desc: "Checks the receipt's signature against the configured keys, retired ones included, without reading the database. " +
+			"An invalid receipt is answered 200 with valid false and the reason.",
+		params: []Parameter{queryParam("receipt", "string", "Receipt from POST /api/v1/events?receipt=true")},
+		ok:     receiptVerification{}, errors: []int{http.StatusBadRequest},
+	},
+	{
+		method: "GET", path: "/api/v1/receipts/keys", id: "listReceiptKeys", tag: "Events", summary: "List the public keys receipts are verified with",
+		desc: "A receipt is two base64url parts joined by a dot: the JSON receipt and its Ed25519 signature over those JSON bytes. Its kid names the key.",
+		ok:   receiptKeys{},
+	},
+}
+
+// metricsOperation documents the Prometheus endpoint at path
+func metricsOperation(path string) operation {
+	return operation{
+		method: "GET", path: path, id: "getMetrics", tag: "System", summary: "Prometheus metrics",
+		desc:   "Requires the admin token when served on the admin or metrics listener.",
+		okType: "text/plain",
+	}
+}
+
+// build renders the row as an OpenAPI operation
+func (op operation) build(g *generator) *Operation {
+	out := &Operation{
+		Tags:        []string{op.tag},
+		Summary:     op.summary,
+		Description: op.desc,
+		OperationID: op.id,
+		Parameters:  op.params,
+		Responses:   make(map[string]*Response),
+	}
+
+	switch op.access {
+	case tenant:
+		out.Security = []map[string][]string{{"apiKey": {}}, {"bearer": {}}}
+	case admin:
+		out.Security = []map[string][]string{{"adminToken": {}}}
+	}
+
+	switch {
+	case op.body != nil:
+		out.RequestBody = &RequestBody{
+			Required: true,
+			Content:  g.content(op.body, op.formats),
+		}
+	case op.bodyType != "":
+		out.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{op.bodyType: {Schema: &Schema{Type: "string"}}},
+		}
+	}
+
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := &Response{Description: http.StatusText(status)}
+	switch {
+	case op.ok != nil:
+		success.Content = g.content(op.ok, op.formats)
+	case op.okType != "":
+		success.Content = map[string]MediaType{op.okType: {Schema: &Schema{Type: "string"}}}
+	}
+	out.Responses[strconv.Itoa(status)] = success
+
+	failures := append([]int{http.StatusInternalServerError}, op.errors...)
+	switch op.access {
+	case tenant:
+		failures = append(failures, http.StatusUnauthorized, http.StatusTooManyRequests)
+		if op.method != http.MethodGet {
+			failures = append(failures, http.StatusForbidden)
+		}
+	case admin:
+		failures = append(failures, http.StatusUnauthorized)
+	}
+	sort.Ints(failures)
+	errSchema := g.errorSchema()
+	for _, code := range failures {
+		schema := errSchema
+		if code == http.StatusUnauthorized && op.access == tenant {
+			schema = g.schemaFor(unauthorized{})
+		}
+		out.Responses[strconv.Itoa(code)] = &Response{
+			Description: http.StatusText(code),
+			Content:     map[string]MediaType{"application/json": {Schema: schema}},
+		}
+	}
+	for code, body := range op.other {
+		response := &Response{Description: http.StatusText(code)}
+		if body != nil {
+			response.Content = map[string]MediaType{"application/json": {Schema: g.schemaFor(body)}}
+		}
+		out.Responses[strconv.Itoa(code)] = response
+	}
+	return out
+}
+
+// content describes a JSON body that may also come in the further formats
+func (g *generator) content(body any, formats []string) map[string]MediaType {
+	schema := g.schemaFor(body)
+	content := map[string]MediaType{"application/json": {Schema: schema}}
+	for _, format := range formats {
+		content[format] = MediaType{Schema: schema}
+	}
+	return content
+}
+
+// errorSchema returns the reference to the error envelope, registering it
+// with the code enumerated on first use
+func (g *generator) errorSchema() *Schema {
+	ref := g.schemaFor(errorResponse{})
+	if body := g.schemas["ErrorBody"]; body != nil && body.Properties["code"].Enum == nil {
+		code := body.Properties["code"]
+		for _, c := range errorCodes {
+			code.Enum = append(code.Enum, string(c))
+		}
+	}
+	return ref
+}
@@ -0,0 +1,143 @@
+// Package quota enforces tenants' monthly event quotas. Each replica keeps
+// a count of the tenant's events this calendar month (UTC), loaded from the
+// database and topped up as it ingests; the count is reloaded every
+// refreshInterval so events ingested by other replicas are taken into
+// account, at the cost of overshooting by what they ingested meanwhile.
+// Reaching WarningPercent and then all of the quota is reported once a
+// month per replica, for the caller to notify the tenant.
+package quota
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/models"
+)
+
+// refreshInterval bounds how long a count goes without a reload
+const refreshInterval = time.Minute
+
+// Thresholds of the quota a tenant is notified of reaching, in percent
+const (
+	WarningPercent  = 80
+	ExceededPercent = 100
+)
+
+// thresholds are the notified thresholds in ascending order
+var thresholds = []int{WarningPercent, ExceededPercent}
+
+// Notice is a threshold of its quota a tenant's events have reached
+type Notice struct {
+	TenantID string
+	// Percent is the threshold reached, WarningPercent or ExceededPercent
+	Percent int
+	Usage   int64
+	Quota   int
+	// Month is the start of the month counted, Reset the start of the next
+	Month time.Time
+	Reset time.Time
+}
+
+// Tracker counts events against quotas. It is safe for concurrent use.
+type Tracker struct {
+	events database.EventStore
+	now    func() time.Time
+
+	mu    sync.Mutex
+	usage map[string]*usage
+}
+
+type usage struct {
+	month  time.Time // start of the month counted
+	count  int64
+	loaded time.Time
+	// reached is the highest threshold already reported this month
+	reached int
+}
+
+// NewTracker creates a tracker
+func NewTracker(events database.EventStore) *Tracker {
+	return &Tracker{events: events, now: time.Now, usage: make(map[string]*usage)}
+}
+
+// Check returns a quota_exceeded error when the tenant has used up its
+// monthly events. A nil quota or zero limit is unlimited.
+func (t *Tracker) Check(ctx context.Context, tenantID string, quota *models.TenantQuota) error {
+	if quota == nil || quota.MonthlyEvents == 0 {
+		return nil
+	}
+
+	used, reset, err := t.Usage(ctx, tenantID)
+	if err != nil {
+		return errors.ErrDB("count monthly events", err)
+	}
+	if used < int64(quota.MonthlyEvents) {
+		return nil
+	}
+	return errors.ErrQuotaExceeded(quota.MonthlyEvents, reset, int(time.Until(reset).Seconds())+1)
+}
+
+// Usage returns the tenant's events this month and when the count resets
+func (t *Tracker) Usage(ctx context.Context, tenantID string) (int64, time.Time, error) {
+	now := t.now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	reset := month.AddDate(0, 1, 0)
+
+	t.mu.Lock()
+	u := t.usage[tenantID]
+	if u != nil && u.month.Equal(month) && now.Sub(u.loaded) < refreshInterval {
+		count := u.count
+		t.mu.Unlock()
+		return count, reset, nil
+	}
+	t.mu.Unlock()
+
+	count, err := t.events.EventsWithContext(ctx).CountEventsCreatedSince(tenantID, month)
+	if err != nil {
+		return 0, reset, err
+	}
+	t.mu.Lock()
+	reloaded := &usage{month: month, count: count, loaded: now}
+	if u := t.usage[tenantID]; u != nil && u.month.Equal(month) {
+		reloaded.reached = u.reached
+	}
+	t.usage[tenantID] = reloaded
+	t.mu.Unlock()
+	return count, reset, nil
+}
+
+// Observe counts an event stored for the tenant, and returns the
+// thresholds of its quota the count has reached that were not reported
+// before this month. A nil quota or zero limit has none.
+func (t *Tracker) Observe(tenantID string, quota *models.TenantQuota) []Notice {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.usage[tenantID]
+	if u == nil {
+		return nil
+	}
+	u.count++
+	if quota == nil || quota.MonthlyEvents == 0 {
+		return nil
+	}
+
+	var notices []Notice
+	for _, percent := range thresholds {
+		if percent <= u.reached || u.count*100 < int64(quota.MonthlyEvents)*int64(percent) {
+			continue
+		}
+		u.reached = percent
+		notices = append(notices, Notice{
+			TenantID: tenantID,
+			Percent:  percent,
+			Usage:    u.count,
+			Quota:    quota.MonthlyEvents,
+			Month:    u.month,
+			Reset:    u.month.AddDate(0, 1, 0),
+		})
+	}
+	return notices
+}
@@ -0,0 +1,28 @@
+// Package realip determines the address of the client behind a request.
+// Proxies in front of the server name the client in X-Forwarded-For or
+// X-Real-IP, but anyone can send those headers, so they are only believed
+// when the peer is a trusted proxy: X-Forwarded-For is read from the right,
+// past the trusted proxies it lists, and the first other address is the
+// client. A request from any other peer is attributed to the peer itself.
+package realip
+
+import "github.com/gin-gonic/gin"
+
+// Headers name the client a trusted proxy forwarded the request for, the
+// first one present winning
+var Headers = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// Trust makes engine believe Headers only from peers in proxies, CIDR
+// ranges or addresses. With none, every request is attributed to its peer.
+func Trust(engine *gin.Engine, proxies []string) error {
+	engine.ForwardedByClientIP = true
+	engine.RemoteIPHeaders = Headers
+	return engine.SetTrustedProxies(proxies)
+}
+
+// Get returns the address of the client of a request, as Trust set up its
+// engine to find it. Audit entries, events' client IPs and request logs
+// all take it from here, so they agree on who sent a request.
+func Get(c *gin.Context) string {
+	return c.ClientIP()
+}
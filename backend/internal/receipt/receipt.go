@@ -0,0 +1,163 @@
+// Package receipt signs and verifies event receipts: proof that the server
+// accepted a given event at a given time. Receipts are signed with Ed25519
+// and name their key, so anyone holding the server's public keys can verify
+// them offline, without access to the database.
+package receipt
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/models"
+)
+
+// Algorithm is the signature algorithm of every receipt
+const Algorithm = "Ed25519"
+
+// Verification errors
+var (
+	ErrMalformed    = errors.New("malformed receipt")
+	ErrUnknownKey   = errors.New("receipt signed with an unknown key")
+	ErrBadSignature = errors.New("receipt signature does not match")
+)
+
+// Receipt is what a receipt attests. Each names one stored event by ID and
+// per-tenant sequence, so it cannot be passed off as the receipt of another.
+type Receipt struct {
+	KeyID     string    `json:"kid"`
+	EventID   uint      `json:"event_id"`
+	TenantID  string    `json:"tenant_id"`
+	Sequence  uint64    `json:"sequence"`
+	EventType string    `json:"event_type"`
+	Timestamp time.Time `json:"timestamp"`
+	// MetadataSHA256 is the hex SHA-256 of the metadata as stored, after
+	// any transform and redaction rules
+	MetadataSHA256 string `json:"metadata_sha256"`
+	// ReceivedAt is when the server stored the event
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// Signer signs receipts with the configured key and verifies them with
+// every configured key
+type Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+	keys  map[string]ed25519.PublicKey
+}
+
+// New creates the signer of cfg, or nil when no key is configured. cfg is
+// expected to be validated.
+func New(cfg config.ReceiptsConfig) (*Signer, error) {
+	if len(cfg.Keys) == 0 {
+		return nil, nil
+	}
+
+	s := &Signer{keyID: cfg.KeyID, keys: make(map[string]ed25519.PublicKey)}
+	for id, encoded := range cfg.Keys {
+		seed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("receipt key %q: must be a base64 %d-byte Ed25519 seed", id, ed25519.SeedSize)
+		}
+		key := ed25519.NewKeyFromSeed(seed)
+		s.keys[id] = key.Public().(ed25519.PublicKey)
+		if id == cfg.KeyID {
+			s.key = key
+		}
+	}
+	for id, encoded := range cfg.PublicKeys {
+		key, err := DecodePublicKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("receipt public key %q: %w", id, err)
+		}
+		s.keys[id] = key
+	}
+	if s.key == nil {
+		return nil, fmt.Errorf("receipt key %q is not configured", cfg.KeyID)
+	}
+	return s, nil
+}
+
+// Sign returns the receipt of a stored event
+func (s *Signer) Sign(event *models.Event) (string, error) {
+	payload, err := json.Marshal(Receipt{
+		KeyID:          s.keyID,
+		EventID:        event.ID,
+		TenantID:       event.TenantID,
+		Sequence:       event.Sequence,
+		EventType:      event.EventType,
+		Timestamp:      event.Timestamp.UTC(),
+		MetadataSHA256: HashMetadata(event.Metadata),
+		ReceivedAt:     event.CreatedAt.UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signature := ed25519.Sign(s.key, payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks a receipt against the signer's keys
+func (s *Signer) Verify(token string) (Receipt, error) {
+	return Verify(token, s.keys)
+}
+
+// PublicKeys returns the keys receipts are verified with, by key ID
+func (s *Signer) PublicKeys() map[string]ed25519.PublicKey {
+	return s.keys
+}
+
+// Verify checks that token was signed by the key it names, one of keys, and
+// returns what it attests. It needs nothing but the public keys, so
+// customers can verify receipts offline.
+func Verify(token string, keys map[string]ed25519.PublicKey) (Receipt, error) {
+	var r Receipt
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return r, ErrMalformed
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return r, ErrMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return r, ErrMalformed
+	}
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return r, ErrMalformed
+	}
+
+	key, ok := keys[r.KeyID]
+	if !ok {
+		return r, ErrUnknownKey
+	}
+	if !ed25519.Verify(key, payload, signature) {
+		return r, ErrBadSignature
+	}
+	return r, nil
+}
+
+// DecodePublicKey decodes a base64 Ed25519 public key, as listed by
+// GET /api/v1/receipts/keys
+func DecodePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("must be a base64 %d-byte Ed25519 public key", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// HashMetadata returns the hex SHA-256 of an event's stored metadata, to
+// compare with a receipt's MetadataSHA256
+func HashMetadata(metadata string) string {
+	sum := sha256.Sum256([]byte(metadata))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,289 @@
+// Package redact strips or masks personal data in event metadata before it
+// is stored, following per-tenant rules.
+package redact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"event-ingestion-system/internal/models"
+)
+
+// Actions a rule can take on the values it selects
+const (
+	ActionRemove = "remove"
+	ActionHash   = "hash"
+	ActionMask   = "mask"
+)
+
+// MaxRules bounds the rules of one tenant
+const MaxRules = 50
+
+// Field is the metadata key listing the names of the rules that changed an
+// event
+const Field = "_redactions"
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,100}$`)
+
+// rule is a compiled models.RedactionRule
+type rule struct {
+	name    string
+	path    []string
+	action  string
+	pattern *regexp.Regexp
+}
+
+// Redactor applies one tenant's rules
+type Redactor struct {
+	rules []rule
+	// key keys the hash action, so equal values hash alike within a tenant
+	// but not across tenants
+	key []byte
+}
+
+// Compile validates rules and prepares them for Apply. Errors name the
+// offending rule and are meant for the API caller.
+func Compile(rules []models.RedactionRule, key string) (*Redactor, error) {
+	if len(rules) > MaxRules {
+		return nil, fmt.Errorf("at most %d rules are allowed", MaxRules)
+	}
+
+	r := &Redactor{key: []byte(key)}
+	seen := make(map[string]bool, len(rules))
+	for i, in := range rules {
+		prefix := fmt.Sprintf("rules[%d]", i)
+		if !namePattern.MatchString(in.Name) {
+			return nil, fmt.Errorf("%s.name: must be 1-100 letters, digits, dots, dashes or underscores", prefix)
+		}
+		if seen[in.Name] {
+			return nil, fmt.Errorf("%s.name: duplicate name %q", prefix, in.Name)
+		}
+		seen[in.Name] = true
+
+		path, err := parsePath(in.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s.path: %v", prefix, err)
+		}
+
+		switch in.Action {
+		case ActionRemove, ActionHash, ActionMask:
+		default:
+			return nil, fmt.Errorf("%s.action: must be remove, hash or mask, got %q", prefix, in.Action)
+		}
+
+		compiled := rule{name: in.Name, path: path, action: in.Action}
+		if in.Pattern != "" {
+			if compiled.pattern, err = regexp.Compile(in.Pattern); err != nil {
+				return nil, fmt.Errorf("%s.pattern: %v", prefix, err)
+			}
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+// parsePath splits a dot-separated path. "$." may prefix it, "*" matches
+// every key or element at one level and "**" any number of levels.
+func parsePath(path string) ([]string, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, fmt.Errorf("is required")
+	}
+	if len(path) > 500 {
+		return nil, fmt.Errorf("must be at most 500 characters")
+	}
+	segments := strings.Split(path, ".")
+	for _, s := range segments {
+		if s == "" {
+			return nil, fmt.Errorf("empty segment in %q", path)
+		}
+	}
+	if segments[len(segments)-1] == "**" {
+		return nil, fmt.Errorf("must not end with **")
+	}
+	return segments, nil
+}
+
+// Apply runs the rules over a JSON metadata document and returns the result.
+// When the document is an object, the names of the rules that changed
+// something are stored under Field, replacing any value the client sent.
+func (r *Redactor) Apply(metadata []byte) ([]byte, error) {
+	if len(r.rules) == 0 || len(metadata) == 0 {
+		return metadata, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(metadata))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	for _, rl := range r.rules {
+		var changed bool
+		doc, changed = r.apply(doc, rl.path, rl)
+		if changed {
+			applied = append(applied, rl.name)
+		}
+	}
+
+	if obj, ok := doc.(map[string]any); ok {
+		delete(obj, Field)
+		if len(applied) > 0 {
+			obj[Field] = applied
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// apply runs rl on the values below node selected by path. It returns the
+// possibly replaced node and whether anything changed.
+func (r *Redactor) apply(node any, path []string, rl rule) (any, bool) {
+	if len(path) == 0 {
+		return r.act(node, rl)
+	}
+
+	segment, rest := path[0], path[1:]
+	if segment == "**" {
+		// Zero levels, then one more level keeping ** in the path
+		node, changed := r.apply(node, rest, rl)
+		next, changedBelow := r.children(node, path, rl)
+		return next, changed || changedBelow
+	}
+
+	switch v := node.(type) {
+	case map[string]any:
+		changed := false
+		for key, child := range v {
+			if segment != "*" && segment != key {
+				continue
+			}
+			if len(rest) == 0 && rl.action == ActionRemove && r.matches(child, rl) {
+				delete(v, key)
+				changed = true
+				continue
+			}
+			var c bool
+			v[key], c = r.apply(child, rest, rl)
+			changed = changed || c
+		}
+		return v, changed
+	case []any:
+		index := -1
+		if segment != "*" {
+			i, err := strconv.Atoi(segment)
+			if err != nil {
+				return v, false
+			}
+			index = i
+		}
+		changed := false
+		kept := v[:0]
+		for i, child := range v {
+			if index >= 0 && i != index {
+				kept = append(kept, child)
+				continue
+			}
+			if len(rest) == 0 && rl.action == ActionRemove && r.matches(child, rl) {
+				changed = true
+				continue
+			}
+			var c bool
+			child, c = r.apply(child, rest, rl)
+			kept = append(kept, child)
+			changed = changed || c
+		}
+		return kept, changed
+	}
+	return node, false
+}
+
+// children applies path, which starts with **, to every child of node
+func (r *Redactor) children(node any, path []string, rl rule) (any, bool) {
+	changed := false
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			var c bool
+			v[key], c = r.apply(child, path, rl)
+			changed = changed || c
+		}
+	case []any:
+		for i, child := range v {
+			var c bool
+			v[i], c = r.apply(child, path, rl)
+			changed = changed || c
+		}
+	}
+	return node, changed
+}
+
+// matches reports whether a selected value is subject to rl: every value
+// without a pattern, only matching strings with one
+func (r *Redactor) matches(value any, rl rule) bool {
+	if rl.pattern == nil {
+		return true
+	}
+	s, ok := value.(string)
+	return ok && rl.pattern.MatchString(s)
+}
+
+// act hashes or masks a selected value. Removal is handled by the parent,
+// except for a whole document, which becomes null.
+func (r *Redactor) act(value any, rl rule) (any, bool) {
+	if value == nil || !r.matches(value, rl) {
+		return value, false
+	}
+
+	switch rl.action {
+	case ActionRemove:
+		return nil, true
+	case ActionHash:
+		mac := hmac.New(sha256.New, r.key)
+		mac.Write([]byte(scalar(value)))
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil)), true
+	case ActionMask:
+		if rl.pattern != nil {
+			return rl.pattern.ReplaceAllStringFunc(value.(string), func(m string) string {
+				return strings.Repeat("*", len([]rune(m)))
+			}), true
+		}
+		return mask(scalar(value)), true
+	}
+	return value, false
+}
+
+// scalar renders a value as text; objects and arrays as their JSON
+func scalar(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// mask keeps the last four characters of values longer than eight and
+// replaces the rest with asterisks
+func mask(s string) string {
+	runes := []rune(s)
+	keep := 0
+	if len(runes) > 8 {
+		keep = 4
+	}
+	for i := 0; i < len(runes)-keep; i++ {
+		runes[i] = '*'
+	}
+	return string(runes)
+}
@@ -0,0 +1,180 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"event-ingestion-system/internal/models"
+)
+
+const testKey = "tenant-1"
+
+func hashOf(value string) string {
+	mac := hmac.New(sha256.New, []byte(testKey))
+	mac.Write([]byte(value))
+	return "sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestApply(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		rules []models.RedactionRule
+		in    string
+		want  string
+	}{
+		{
+			name:  "top-level field removed",
+			rules: []models.RedactionRule{{Name: "drop-email", Path: "$.email", Action: ActionRemove}},
+			in:    `{"email":"alice@example.com","n":1}`,
+			want:  `{"n":1,"_redactions":["drop-email"]}`,
+		},
+		{
+			name:  "nested object field masked",
+			rules: []models.RedactionRule{{Name: "mask-email", Path: "user.contact.email", Action: ActionMask}},
+			in:    `{"user":{"contact":{"email":"alice@example.com","phone":"555"}}}`,
+			want:  `{"user":{"contact":{"email":"*************.com","phone":"555"}},"_redactions":["mask-email"]}`,
+		},
+		{
+			name:  "field of every array element removed",
+			rules: []models.RedactionRule{{Name: "drop-cards", Path: "items.*.card", Action: ActionRemove}},
+			in:    `{"items":[{"sku":"a","card":"4111"},{"sku":"b","card":"5500"},{"sku":"c"}]}`,
+			want:  `{"items":[{"sku":"a"},{"sku":"b"},{"sku":"c"}],"_redactions":["drop-cards"]}`,
+		},
+		{
+			name:  "one array element hashed",
+			rules: []models.RedactionRule{{Name: "hash-first", Path: "ips.0", Action: ActionHash}},
+			in:    `{"ips":["203.0.113.7","198.51.100.9"]}`,
+			want:  `{"ips":["` + hashOf("203.0.113.7") + `","198.51.100.9"],"_redactions":["hash-first"]}`,
+		},
+		{
+			name:  "object value hashed as its JSON",
+			rules: []models.RedactionRule{{Name: "hash-user", Path: "user", Action: ActionHash}},
+			in:    `{"user":{"id":7}}`,
+			want:  `{"user":"` + hashOf(`{"id":7}`) + `","_redactions":["hash-user"]}`,
+		},
+		{
+			name:  "matching strings at any depth masked",
+			rules: []models.RedactionRule{{Name: "ssn", Path: "$.**.ssn", Action: ActionMask, Pattern: `^\d{3}-\d{2}-\d{4}$`}},
+			in:    `{"ssn":"123-45-6789","people":[{"ssn":"987-65-4321"},{"ssn":"unknown"},{"family":{"ssn":"111-22-3333"}}]}`,
+			want:  `{"ssn":"***********","people":[{"ssn":"***********"},{"ssn":"unknown"},{"family":{"ssn":"***********"}}],"_redactions":["ssn"]}`,
+		},
+		{
+			name:  "pattern masks only the matched part",
+			rules: []models.RedactionRule{{Name: "digits", Path: "notes.*", Action: ActionMask, Pattern: `\d{4,}`}},
+			in:    `{"notes":["call 5551234 today","no number"]}`,
+			want:  `{"notes":["call ******* today","no number"],"_redactions":["digits"]}`,
+		},
+		{
+			name:  "matching array elements removed",
+			rules: []models.RedactionRule{{Name: "drop-emails", Path: "tags.*", Action: ActionRemove, Pattern: `@`}},
+			in:    `{"tags":["vip","bob@example.com","beta"]}`,
+			want:  `{"tags":["vip","beta"],"_redactions":["drop-emails"]}`,
+		},
+		{
+			name: "only rules that changed something recorded",
+			rules: []models.RedactionRule{
+				{Name: "drop-email", Path: "email", Action: ActionRemove},
+				{Name: "drop-ssn", Path: "ssn", Action: ActionRemove},
+			},
+			in:   `{"email":"alice@example.com","n":1.5}`,
+			want: `{"n":1.5,"_redactions":["drop-email"]}`,
+		},
+		{
+			name:  "client-sent _redactions dropped",
+			rules: []models.RedactionRule{{Name: "drop-ssn", Path: "ssn", Action: ActionRemove}},
+			in:    `{"n":1,"_redactions":["forged"]}`,
+			want:  `{"n":1}`,
+		},
+		{
+			name:  "large integers kept exact",
+			rules: []models.RedactionRule{{Name: "drop-email", Path: "email", Action: ActionRemove}},
+			in:    `{"email":"a@example.com","id":9007199254740993}`,
+			want:  `{"id":9007199254740993,"_redactions":["drop-email"]}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := Compile(tc.rules, testKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := r.Apply([]byte(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalJSON(t, out, []byte(tc.want)) {
+				t.Fatalf("Apply(%s) = %s, want %s", tc.in, out, tc.want)
+			}
+		})
+	}
+}
+
+func TestHashIsKeyedPerTenant(t *testing.T) {
+	rules := []models.RedactionRule{{Name: "hash-email", Path: "email", Action: ActionHash}}
+	in := []byte(`{"email":"alice@example.com"}`)
+	outputs := make(map[string]bool)
+	for _, key := range []string{"tenant-1", "tenant-1", "tenant-2"} {
+		r, err := Compile(rules, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := r.Apply(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs[string(out)] = true
+	}
+	if len(outputs) != 2 {
+		t.Fatalf("got %d distinct hashes from two tenants, want equal values to hash alike within a tenant only", len(outputs))
+	}
+}
+
+func TestCompileRejectsInvalidRules(t *testing.T) {
+	tooMany := make([]models.RedactionRule, MaxRules+1)
+	for i := range tooMany {
+		tooMany[i] = models.RedactionRule{Name: strings.Repeat("r", i+1), Path: "email", Action: ActionRemove}
+	}
+	for _, tc := range []struct {
+		name  string
+		rules []models.RedactionRule
+		want  string
+	}{
+		{"too many rules", tooMany, "at most 50 rules"},
+		{"invalid name", []models.RedactionRule{{Name: "drop email", Path: "email", Action: ActionRemove}}, "rules[0].name"},
+		{"duplicate name", []models.RedactionRule{
+			{Name: "drop", Path: "email", Action: ActionRemove},
+			{Name: "drop", Path: "ip", Action: ActionRemove},
+		}, "rules[1].name: duplicate"},
+		{"missing path", []models.RedactionRule{{Name: "drop", Path: "$", Action: ActionRemove}}, "rules[0].path: is required"},
+		{"empty segment", []models.RedactionRule{{Name: "drop", Path: "user..email", Action: ActionRemove}}, "rules[0].path: empty segment"},
+		{"trailing **", []models.RedactionRule{{Name: "drop", Path: "user.**", Action: ActionRemove}}, "rules[0].path: must not end with **"},
+		{"unknown action", []models.RedactionRule{{Name: "drop", Path: "email", Action: "encrypt"}}, "rules[0].action"},
+		{"invalid pattern", []models.RedactionRule{{Name: "drop", Path: "email", Action: ActionMask, Pattern: "("}}, "rules[0].pattern"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Compile(tc.rules, testKey)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Compile error = %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// equalJSON reports whether two JSON documents hold the same values,
+// comparing numbers by their text
+func equalJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var docs [2]any
+	for i, data := range [][]byte{a, b} {
+		dec := json.NewDecoder(strings.NewReader(string(data)))
+		dec.UseNumber()
+		if err := dec.Decode(&docs[i]); err != nil {
+			t.Fatalf("decode %s: %v", data, err)
+		}
+	}
+	return reflect.DeepEqual(docs[0], docs[1])
+}
@@ -0,0 +1,75 @@
+// Package redaction runs bulk redaction jobs: each replaces the metadata
+// of a tenant's events of one type within a time range by a redaction
+// marker, keeping the events themselves. Each batch is committed with the
+// highest event ID it covered, so an interrupted or failed job carries on
+// after the last committed batch. Jobs are kept in the database and run by
+// a jobs.Runner.
+package redaction
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/jobs"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/websocket"
+)
+
+// Notice is the payload of the events.redacted message sent to the
+// tenant's WebSocket clients after each batch
+type Notice struct {
+	JobID    string `json:"job_id"`
+	EventIDs []uint `json:"event_ids"`
+}
+
+// Runner claims queued redaction jobs and runs them, one at a time
+type Runner struct {
+	*jobs.Runner[models.RedactionJob, *models.RedactionJob]
+	db  *database.Database
+	hub *websocket.Hub
+	cfg config.RedactionsConfig
+}
+
+// NewRunner creates a redaction runner. Jobs redact cfg.BatchSize events
+// per transaction.
+func NewRunner(db *database.Database, hub *websocket.Hub, cfg config.RedactionsConfig, logger *slog.Logger) *Runner {
+	r := &Runner{db: db, hub: hub, cfg: cfg}
+	r.Runner = jobs.NewRunner(db, jobs.Kind[*models.RedactionJob]{
+		Name: "redaction",
+		Run:  r.redact,
+		Finish: func(db *database.Database, job *models.RedactionJob, at time.Time) error {
+			return db.FinishRedactionJob(job, at)
+		},
+		Completed: func(job *models.RedactionJob) []any {
+			return []any{"events", job.EventsRedacted}
+		},
+	}, cfg.PollInterval, logger)
+	return r
+}
+
+// redact commits the job's events in batches, telling the tenant's
+// WebSocket clients which events each batch redacted
+func (r *Runner) redact(ctx context.Context, job *models.RedactionJob, logger *slog.Logger) error {
+	if job.LastEventID > 0 {
+		logger.InfoContext(ctx, "Resuming redaction job", "after_event_id", job.LastEventID)
+	}
+	db := r.db.WithContext(ctx)
+	for ctx.Err() == nil {
+		ids, err := db.RedactEventsBatch(job, r.cfg.BatchSize, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if err := r.hub.NotifyTenant(job.TenantID, "events.redacted", Notice{JobID: job.ID, EventIDs: ids}); err != nil {
+				logger.WarnContext(ctx, "Failed to notify redaction", "error", err)
+			}
+		}
+		if len(ids) < r.cfg.BatchSize {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
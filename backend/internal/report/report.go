@@ -0,0 +1,331 @@
+// Package report runs tenants' scheduled report digests: a summary of the
+// events in the last period of the schedule, compared to the period before,
+// delivered through the webhook dispatcher.
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/webhook"
+)
+
+const (
+	// batchSize bounds the due reports handled per check
+	batchSize = 100
+	// topTypes is the number of event types listed in a summary
+	topTypes = 5
+)
+
+// Run triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Run outcomes stored on the report
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// TypeCount is the number of events of one type in the period and in the
+// period before
+type TypeCount struct {
+	EventType     string `json:"event_type"`
+	Count         int64  `json:"count"`
+	PreviousCount int64  `json:"previous_count"`
+}
+
+// Summary describes the events of one report period
+type Summary struct {
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `json:"period_end"`
+	Total         int64     `json:"total"`
+	PreviousTotal int64     `json:"previous_total"`
+	// ChangePercent compares Total to PreviousTotal; nil when the previous
+	// period had no events
+	ChangePercent *float64         `json:"change_percent"`
+	Counts        map[string]int64 `json:"counts"`
+	TopTypes      []TypeCount      `json:"top_types"`
+}
+
+// Payload is the JSON body posted for a report, distinguished from event
+// deliveries by its type
+type Payload struct {
+	Type    string  `json:"type"` // always "report"
+	Trigger string  `json:"trigger"`
+	Report  Info    `json:"report"`
+	Summary Summary `json:"summary"`
+	// Text is a one-paragraph rendering, present with format "text"
+	Text string `json:"text,omitempty"`
+}
+
+// Info identifies the report a payload belongs to
+type Info struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+}
+
+// Scheduler runs due reports periodically
+type Scheduler struct {
+	db       *database.Database
+	events   database.EventStore
+	webhooks *webhook.Dispatcher
+	cfg      config.ReportsConfig
+	logger   *slog.Logger
+}
+
+// NewScheduler creates a report scheduler
+func NewScheduler(db *database.Database, events database.EventStore, webhooks *webhook.Dispatcher, cfg config.ReportsConfig, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		events:   events,
+		webhooks: webhooks,
+		cfg:      cfg,
+		logger:   logger.With("component", "reports"),
+	}
+}
+
+// NextRun returns the first time after now that a schedule fires
+func NextRun(schedule string, now time.Time) (time.Time, error) {
+	s, err := ParseSchedule(schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next, _ := s.Next(now)
+	return next, nil
+}
+
+// Run runs due reports every check interval until ctx is cancelled. It
+// returns at once when reports are disabled.
+func (s *Scheduler) Run(ctx context.Context) {
+	if !s.cfg.Enabled {
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.runDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue runs every report whose next run has passed. A report that missed
+// several runs, for example while the server was down, runs once for its
+// latest period.
+func (s *Scheduler) runDue(ctx context.Context) {
+	now := time.Now().UTC()
+	db := s.db.WithContext(ctx)
+
+	due, err := db.GetDueReports(now, batchSize)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to load due reports", "error", err)
+		return
+	}
+
+	for _, r := range due {
+		if ctx.Err() != nil {
+			return
+		}
+
+		schedule, err := ParseSchedule(r.Schedule)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Report has an invalid schedule", "report_id", r.ID, "schedule", r.Schedule, "error", err)
+			continue
+		}
+		end, _ := schedule.Prev(now)
+		next, _ := schedule.Next(now)
+
+		// Claiming the run first keeps replicas, and a slow delivery
+		// overlapping the next check, from running it twice
+		claimed, err := db.ClaimReportRun(r.ID, r.NextRunAt, next)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to claim report run", "report_id", r.ID, "error", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if end.After(r.NextRunAt) {
+			s.logger.WarnContext(ctx, "Report missed scheduled runs, running once for the latest period", "report_id", r.ID, "missed_since", r.NextRunAt)
+		}
+
+		start, _ := schedule.Prev(end.Add(-time.Minute))
+		if _, err := s.run(ctx, r, start, end, TriggerSchedule); err != nil {
+			s.logger.WarnContext(ctx, "Report delivery failed", "report_id", r.ID, "tenant_id", r.TenantID, "error", err)
+		}
+	}
+}
+
+// RunNow runs a report immediately, without retries, over a period ending
+// now as long as its schedule's latest interval. The next scheduled run is
+// unchanged.
+func (s *Scheduler) RunNow(ctx context.Context, r models.Report) (*Summary, error) {
+	schedule, err := ParseSchedule(r.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	now := time.Now().UTC()
+	last, _ := schedule.Prev(now)
+	before, _ := schedule.Prev(last.Add(-time.Minute))
+
+	return s.run(ctx, r, now.Add(-last.Sub(before)), now, TriggerManual)
+}
+
+// run summarises [start, end), delivers the summary and records the
+// outcome on the report. The summary is returned even when delivery fails.
+func (s *Scheduler) run(ctx context.Context, r models.Report, start, end time.Time, trigger string) (*Summary, error) {
+	summary, err := s.summarize(ctx, r, start, end)
+	if err != nil {
+		s.record(ctx, r.ID, err)
+		return nil, err
+	}
+
+	err = s.deliver(ctx, r, Payload{
+		Type:    "report",
+		Trigger: trigger,
+		Report:  Info{ID: r.ID, Name: r.Name, Schedule: r.Schedule},
+		Summary: *summary,
+	}, trigger == TriggerSchedule)
+	s.record(ctx, r.ID, err)
+	return summary, err
+}
+
+func (s *Scheduler) deliver(ctx context.Context, r models.Report, payload Payload, retry bool) error {
+	target := models.Webhook{TenantID: r.TenantID, URL: r.URL, Secret: r.Secret}
+	if r.WebhookID != nil {
+		wh, err := s.db.WithContext(ctx).GetWebhook(r.TenantID, *r.WebhookID)
+		if err != nil {
+			return fmt.Errorf("load webhook %d: %w", *r.WebhookID, err)
+		}
+		if !wh.Active {
+			return fmt.Errorf("webhook %d is inactive", wh.ID)
+		}
+		target = *wh
+	}
+
+	if r.Format == models.ReportFormatText {
+		payload.Text = render(r.Name, payload.Summary)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.webhooks.Deliver(ctx, target, body, retry)
+}
+
+// record stores the outcome of a run; cause is nil on success
+func (s *Scheduler) record(ctx context.Context, id uint, cause error) {
+	status, text := StatusDelivered, ""
+	if cause != nil {
+		status, text = StatusFailed, cause.Error()
+	}
+	ctx = context.WithoutCancel(ctx)
+	if err := s.db.WithContext(ctx).RecordReportRun(id, time.Now().UTC(), status, text); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to record report run", "report_id", id, "error", err)
+	}
+}
+
+// summarize counts the report's events by type in [start, end) and in the
+// period of the same length before it
+func (s *Scheduler) summarize(ctx context.Context, r models.Report, start, end time.Time) (*Summary, error) {
+	filter, err := r.ParseFilter()
+	if err != nil {
+		return nil, fmt.Errorf("decode filter: %w", err)
+	}
+
+	events := s.events.EventsWithContext(ctx)
+	count := func(since, until time.Time) (map[string]int64, int64, error) {
+		counts, err := events.CountEventsByType(database.EventFilter{
+			TenantID:   r.TenantID,
+			EventTypes: filter.EventTypes,
+			Tags:       filter.Tags,
+			Search:     filter.Search,
+			Since:      &since,
+			Until:      &until,
+		})
+		var total int64
+		for _, n := range counts {
+			total += n
+		}
+		return counts, total, err
+	}
+
+	counts, total, err := count(start, end)
+	if err != nil {
+		return nil, fmt.Errorf("count events: %w", err)
+	}
+	previous, previousTotal, err := count(start.Add(-end.Sub(start)), start)
+	if err != nil {
+		return nil, fmt.Errorf("count events: %w", err)
+	}
+
+	summary := &Summary{
+		PeriodStart:   start,
+		PeriodEnd:     end,
+		Total:         total,
+		PreviousTotal: previousTotal,
+		Counts:        counts,
+		TopTypes:      []TypeCount{},
+	}
+	if previousTotal > 0 {
+		change := math.Round(float64(total-previousTotal)/float64(previousTotal)*1000) / 10
+		summary.ChangePercent = &change
+	}
+
+	for eventType, n := range counts {
+		summary.TopTypes = append(summary.TopTypes, TypeCount{EventType: eventType, Count: n, PreviousCount: previous[eventType]})
+	}
+	sort.Slice(summary.TopTypes, func(i, j int) bool {
+		a, b := summary.TopTypes[i], summary.TopTypes[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.EventType < b.EventType
+	})
+	if len(summary.TopTypes) > topTypes {
+		summary.TopTypes = summary.TopTypes[:topTypes]
+	}
+	return summary, nil
+}
+
+// render describes a summary in one paragraph for chat-style endpoints
+func render(name string, s Summary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Report %q: %d events from %s to %s UTC", name, s.Total,
+		s.PeriodStart.Format("2006-01-02 15:04"), s.PeriodEnd.Format("2006-01-02 15:04"))
+	if s.ChangePercent != nil {
+		fmt.Fprintf(&b, " (%+.1f%% on the previous period)", *s.ChangePercent)
+	} else {
+		b.WriteString(" (none in the previous period)")
+	}
+	b.WriteString(".")
+	if len(s.TopTypes) > 0 {
+		b.WriteString(" Top types:")
+		for i, t := range s.TopTypes {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, " %s %d", t.EventType, t.Count)
+		}
+		b.WriteString(".")
+	}
+	return b.String()
+}
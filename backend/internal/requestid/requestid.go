@@ -0,0 +1,32 @@
+package requestid
+
+import (
+	"context"
+	"regexp"
+)
+
+// Header is the HTTP header carrying the request ID
+const Header = "X-Request-ID"
+
+// MaxLength caps client-supplied request IDs
+const MaxLength = 128
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying the request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, if any
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Valid reports whether a client-supplied request ID can be reused
+func Valid(id string) bool {
+	return len(id) > 0 && len(id) <= MaxLength && validID.MatchString(id)
+}
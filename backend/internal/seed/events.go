@@ -0,0 +1,165 @@
+package seed
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"event-ingestion-system/internal/models"
+)
+
+// eventKind is a weighted event type with a metadata generator
+type eventKind struct {
+	name     string
+	weight   int
+	metadata func(rng *rand.Rand) map[string]any
+}
+
+// kinds approximates the mix of a product analytics stream: mostly page
+// views and clicks, with rarer sessions, sign-ups, purchases and errors
+var kinds = []eventKind{
+	{"page.view", 40, func(rng *rand.Rand) map[string]any {
+		return map[string]any{
+			"path":        pick(rng, paths),
+			"referrer":    pick(rng, referrers),
+			"duration_ms": 200 + rng.Intn(30000),
+			"device":      pick(rng, devices),
+		}
+	}},
+	{"click", 22, func(rng *rand.Rand) map[string]any {
+		return map[string]any{
+			"path":    pick(rng, paths),
+			"element": pick(rng, []string{"nav.pricing", "hero.cta", "footer.docs", "card.learn_more", "search.submit"}),
+		}
+	}},
+	{"session.start", 8, func(rng *rand.Rand) map[string]any {
+		return map[string]any{
+			"session_id": fmt.Sprintf("s_%012x", rng.Int63()&0xffffffffffff),
+			"device":     pick(rng, devices),
+			"country":    pick(rng, countries),
+		}
+	}},
+	{"session.end", 7, func(rng *rand.Rand) map[string]any {
+		return map[string]any{
+			"session_id":   fmt.Sprintf("s_%012x", rng.Int63()&0xffffffffffff),
+			"duration_sec": 10 + rng.Intn(3600),
+			"pages":        1 + rng.Intn(20),
+		}
+	}},
+	{"login", 8, func(rng *rand.Rand) map[string]any {
+		return map[string]any{
+			"user_id": userID(rng),
+			"method":  pick(rng, []string{"password", "google", "github", "sso"}),
+		}
+	}},
+	{"signup", 3, func(rng *rand.Rand) map[string]any {
+		return map[string]any{
+			"user_id": userID(rng),
+			"plan":    pick(rng, []string{"free", "free", "free", "pro", "team"}),
+			"source":  pick(rng, referrers),
+		}
+	}},
+	{"cart.add", 6, func(rng *rand.Rand) map[string]any {
+		p := pick(rng, products)
+		return map[string]any{
+			"user_id":  userID(rng),
+			"sku":      p.sku,
+			"price":    p.price,
+			"quantity": 1 + rng.Intn(3),
+		}
+	}},
+	{"purchase", 4, func(rng *rand.Rand) map[string]any {
+		n := 1 + rng.Intn(4)
+		items := make([]map[string]any, n)
+		total := 0.0
+		for i := range items {
+			p := pick(rng, products)
+			qty := 1 + rng.Intn(2)
+			items[i] = map[string]any{"sku": p.sku, "quantity": qty}
+			total += p.price * float64(qty)
+		}
+		return map[string]any{
+			"order_id": fmt.Sprintf("ord_%08d", rng.Intn(100000000)),
+			"user_id":  userID(rng),
+			"amount":   math.Round(total*100) / 100,
+			"currency": pick(rng, []string{"USD", "USD", "EUR", "GBP"}),
+			"items":    items,
+		}
+	}},
+	{"error", 2, func(rng *rand.Rand) map[string]any {
+		return map[string]any{
+			"message": pick(rng, []string{"TypeError: undefined is not a function", "NetworkError: request timed out", "ChunkLoadError: loading chunk 7 failed"}),
+			"path":    pick(rng, paths),
+			"browser": pick(rng, []string{"Chrome 128", "Firefox 130", "Safari 17"}),
+		}
+	}},
+}
+
+var totalWeight = func() int {
+	total := 0
+	for _, k := range kinds {
+		total += k.weight
+	}
+	return total
+}()
+
+var (
+	paths     = []string{"/", "/pricing", "/docs", "/docs/getting-started", "/blog", "/signup", "/dashboard", "/settings", "/checkout"}
+	referrers = []string{"direct", "google", "twitter", "newsletter", "github", "partner"}
+	devices   = []string{"desktop", "desktop", "mobile", "mobile", "tablet"}
+	countries = []string{"US", "US", "GB", "DE", "FR", "IN", "BR", "JP", "CA"}
+	products  = []product{{"TSHIRT-M", 24.00}, {"MUG-01", 12.50}, {"HOODIE-L", 59.00}, {"STICKERS", 4.99}, {"CAP-01", 19.00}}
+)
+
+type product struct {
+	sku   string
+	price float64
+}
+
+// randomEvent generates one event at a random time in the last span,
+// weighted towards daytime hours
+func randomEvent(rng *rand.Rand, tenantID string, now time.Time, span time.Duration) models.Event {
+	r := rng.Intn(totalWeight)
+	kind := kinds[0]
+	for _, k := range kinds {
+		if r < k.weight {
+			kind = k
+			break
+		}
+		r -= k.weight
+	}
+
+	ts := randomTime(rng, now, span)
+	metadata, _ := json.Marshal(kind.metadata(rng))
+	return models.Event{
+		TenantID:  tenantID,
+		EventType: kind.name,
+		Timestamp: ts,
+		Metadata:  string(metadata),
+		CreatedAt: ts.Add(time.Duration(20+rng.Intn(500)) * time.Millisecond),
+	}
+}
+
+// randomTime picks a time in (now-span, now], rejecting night-time samples
+// often enough that traffic peaks in the afternoon (UTC)
+func randomTime(rng *rand.Rand, now time.Time, span time.Duration) time.Time {
+	for {
+		ts := now.Add(-time.Duration(rng.Int63n(int64(span))))
+		// 0.15 at 03:00 rising to 1.0 at 15:00
+		hour := float64(ts.Hour()) + float64(ts.Minute())/60
+		activity := 0.575 - 0.425*math.Cos((hour-3)/24*2*math.Pi)
+		if rng.Float64() < activity {
+			return ts
+		}
+	}
+}
+
+func pick[T any](rng *rand.Rand, options []T) T {
+	return options[rng.Intn(len(options))]
+}
+
+func userID(rng *rand.Rand) string {
+	return fmt.Sprintf("u_%06d", rng.Intn(50000))
+}
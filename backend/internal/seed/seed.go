@@ -0,0 +1,168 @@
+package seed
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// chunkSize is the number of events generated and committed at a time,
+	// bounding memory for large runs
+	chunkSize = 10000
+	// batchSize is the number of rows per INSERT statement, lowered where
+	// the database's bind parameter limit requires
+	batchSize = 1000
+)
+
+// Options controls what Run generates
+type Options struct {
+	Tenants int
+	Events  int
+	// Range is how far back event timestamps reach from now
+	Range time.Duration
+	// Env is the configured app.env; production is refused unless Force
+	Env   string
+	Force bool
+}
+
+// tenantNames are the demo tenants, created in this order. Re-running with
+// the same or a smaller count reuses them.
+var tenantNames = []string{
+	"Acme Corp", "Globex", "Initech", "Umbrella", "Hooli",
+	"Stark Industries", "Wayne Enterprises", "Soylent", "Vandelay Industries", "Pied Piper",
+}
+
+// Run creates the demo tenants that do not exist yet, each with webhooks,
+// then adds opts.Events events spread across all of them. Existing tenants
+// are reused, so running again tops up events. The tenants and their API
+// keys are printed to out.
+func Run(ctx context.Context, db *database.Database, opts Options, out io.Writer) error {
+	if opts.Env == "production" && !opts.Force {
+		return stderrors.New("refusing to seed a production environment; pass -seed-force to override")
+	}
+	if opts.Tenants < 1 {
+		return stderrors.New("at least one tenant is required")
+	}
+	if opts.Events < 0 || opts.Range <= 0 {
+		return stderrors.New("event count must not be negative and the range must be positive")
+	}
+
+	db = db.WithContext(ctx)
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TENANT\tID\tAPI KEY\t")
+	tenants := make([]*models.Tenant, 0, opts.Tenants)
+	for i := 0; i < opts.Tenants; i++ {
+		tenant, created, err := ensureTenant(db, tenantName(i))
+		if err != nil {
+			return err
+		}
+		tenants = append(tenants, tenant)
+		note := ""
+		if created {
+			note = "new"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", tenant.Name, tenant.ID, tenant.APIKey, note)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	now := start.UTC()
+	for done := 0; done < opts.Events; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := min(chunkSize, opts.Events-done)
+		events := make([]models.Event, n)
+		for i := range events {
+			events[i] = randomEvent(rng, tenants[rng.Intn(len(tenants))].ID, now, opts.Range)
+		}
+		if err := db.CreateEvents(events, batchSize); err != nil {
+			return fmt.Errorf("insert events: %w", err)
+		}
+		done += n
+	}
+
+	fmt.Fprintf(out, "\nInserted %d events across %d tenants in %s\n", opts.Events, len(tenants), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func tenantName(i int) string {
+	if i < len(tenantNames) {
+		return tenantNames[i]
+	}
+	return fmt.Sprintf("Demo Tenant %d", i+1)
+}
+
+// ensureTenant returns the tenant named name, creating it and its webhooks
+// when missing
+func ensureTenant(db *database.Database, name string) (*models.Tenant, bool, error) {
+	tenant, err := db.GetTenantByName(name)
+	if err == nil {
+		return tenant, false, nil
+	}
+	if !stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, fmt.Errorf("look up tenant %q: %w", name, err)
+	}
+
+	tenant = &models.Tenant{
+		ID:     uuid.New().String(),
+		Name:   name,
+		APIKey: uuid.New().String(),
+		Active: true,
+	}
+	if err := db.CreateTenant(tenant); err != nil {
+		return nil, false, fmt.Errorf("create tenant %q: %w", name, err)
+	}
+
+	if err := createWebhooks(db, tenant); err != nil {
+		return nil, false, err
+	}
+	return tenant, true, nil
+}
+
+// createWebhooks adds one catch-all webhook and one filtered webhook. They
+// point at example.com and are created inactive so seeded tenants never
+// send deliveries anywhere.
+func createWebhooks(db *database.Database, tenant *models.Tenant) error {
+	slug := strings.ReplaceAll(strings.ToLower(tenant.Name), " ", "-")
+	filtered, _ := json.Marshal([]string{"purchase", "signup"})
+	hooks := []models.Webhook{
+		{URL: "https://" + slug + ".example.com/webhooks/events"},
+		{URL: "https://" + slug + ".example.com/webhooks/sales", EventTypes: string(filtered)},
+	}
+	for i := range hooks {
+		wh := &hooks[i]
+		wh.TenantID = tenant.ID
+		secret := make([]byte, 32)
+		if _, err := crand.Read(secret); err != nil {
+			return err
+		}
+		wh.Secret = hex.EncodeToString(secret)
+		if err := db.CreateWebhook(wh); err != nil {
+			return fmt.Errorf("create webhook for %q: %w", tenant.Name, err)
+		}
+		if err := db.SetWebhookActive(wh.ID, false); err != nil {
+			return fmt.Errorf("deactivate webhook for %q: %w", tenant.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// unixPrefix marks a listen address as a Unix domain socket path
+const unixPrefix = "unix:"
+
+// ParseListenAddress splits a listen address into a network and an address.
+// "unix:/path/to.sock" selects a Unix domain socket; anything else must be a
+// TCP "host:port", optionally prefixed with "tcp:".
+func ParseListenAddress(listen string) (network, address string, err error) {
+	if path, ok := strings.CutPrefix(listen, unixPrefix); ok {
+		if path == "" {
+			return "", "", fmt.Errorf("listen address %q has an empty socket path", listen)
+		}
+		return "unix", path, nil
+	}
+
+	address = strings.TrimPrefix(listen, "tcp:")
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", "", fmt.Errorf("listen address %q must be host:port or unix:/path: %w", listen, err)
+	}
+	return "tcp", address, nil
+}
+
+// Listen opens a listener for a parsed listen address. For Unix sockets a
+// stale socket file left by a previous run is removed first, and the new
+// socket is chmod'ed to mode. A socket that still accepts connections is
+// reported as in use rather than removed.
+func Listen(listen string, mode os.FileMode) (net.Listener, error) {
+	network, address, err := ParseListenAddress(listen)
+	if err != nil {
+		return nil, err
+	}
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+
+	if err := removeStaleSocket(address); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(address, mode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("chmod socket %s: %w", address, err)
+	}
+	return l, nil
+}
+
+// removeStaleSocket deletes a socket file nobody is listening on
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("socket path %s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	for _, tc := range []struct {
+		listen           string
+		network, address string
+		err              string
+	}{
+		{listen: "unix:/run/events.sock", network: "unix", address: "/run/events.sock"},
+		{listen: "unix:", err: "empty socket path"},
+		{listen: "127.0.0.1:8080", network: "tcp", address: "127.0.0.1:8080"},
+		{listen: "tcp::8080", network: "tcp", address: ":8080"},
+		{listen: "tcp:[::1]:8080", network: "tcp", address: "[::1]:8080"},
+		{listen: "localhost", err: "must be host:port or unix:/path"},
+		{listen: "/run/events.sock", err: "must be host:port or unix:/path"},
+	} {
+		t.Run(tc.listen, func(t *testing.T) {
+			network, address, err := ParseListenAddress(tc.listen)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("ParseListenAddress(%q) error = %v, want one containing %q", tc.listen, err, tc.err)
+				}
+				return
+			}
+			if err != nil || network != tc.network || address != tc.address {
+				t.Fatalf("ParseListenAddress(%q) = %q, %q, %v, want %q, %q", tc.listen, network, address, err, tc.network, tc.address)
+			}
+		})
+	}
+}
+
+func TestListenOnUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	l, err := Listen("unix:"+path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode = %v, want a socket with 0600", info.Mode())
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial the socket: %v", err)
+	}
+	conn.Close()
+}
+
+func TestListenReplacesAStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	// A listener that exited without removing its socket file
+	old, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.SetUnlinkOnClose(false)
+	old.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("stale socket file missing: %v", err)
+	}
+
+	l, err := Listen("unix:"+path, 0o660)
+	if err != nil {
+		t.Fatalf("Listen over a stale socket: %v", err)
+	}
+	l.Close()
+}
+
+func TestListenRefusesAnOccupiedSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	running, err := Listen("unix:"+path, 0o660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer running.Close()
+
+	if l, err := Listen("unix:"+path, 0o660); err == nil || !strings.Contains(err.Error(), "in use by another process") {
+		if l != nil {
+			l.Close()
+		}
+		t.Fatalf("Listen on an occupied socket error = %v, want it reported in use", err)
+	}
+	// The running server's socket is left alone
+	if conn, err := net.Dial("unix", path); err != nil {
+		t.Fatalf("dial the running server: %v", err)
+	} else {
+		conn.Close()
+	}
+}
+
+func TestListenRefusesANonSocketFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := Listen("unix:"+path, 0o660); err == nil || !strings.Contains(err.Error(), "is not a socket") {
+		if l != nil {
+			l.Close()
+		}
+		t.Fatalf("Listen over a regular file error = %v, want it refused", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "data" {
+		t.Fatalf("the file was changed: %q, %v", data, err)
+	}
+}
+
+func TestListenRefusesAnEmptySocketPath(t *testing.T) {
+	if l, err := Listen("unix:", 0o660); err == nil {
+		l.Close()
+		t.Fatal("Listen accepted an empty socket path")
+	}
+}
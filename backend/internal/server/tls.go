@@ -0,0 +1,76 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+
+	"event-ingestion-system/internal/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLS holds the TLS settings for the API listener
+type TLS struct {
+	// Config is set on http.Server; net/http adds "h2" to its NextProtos so
+	// HTTP/2 is negotiated via ALPN. WebSocket clients negotiate HTTP/1.1,
+	// which the upgrade requires.
+	Config *tls.Config
+	// CertFile and KeyFile are passed to ListenAndServeTLS; both are empty
+	// when certificates come from autocert
+	CertFile string
+	KeyFile  string
+
+	manager *autocert.Manager
+}
+
+// NewTLS builds the TLS configuration from static files or, when autocert
+// hosts are configured, from Let's Encrypt
+func NewTLS(cfg config.TLSConfig) *TLS {
+	minVersion := uint16(tls.VersionTLS12)
+	if cfg.MinVersion == "1.3" {
+		minVersion = tls.VersionTLS13
+	}
+
+	if len(cfg.AutocertHosts) == 0 {
+		return &TLS{
+			Config:   &tls.Config{MinVersion: minVersion},
+			CertFile: cfg.CertFile,
+			KeyFile:  cfg.KeyFile,
+		}
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.AutocertHosts...),
+		Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+		Email:      cfg.AutocertEmail,
+	}
+	tlsConfig := manager.TLSConfig()
+	tlsConfig.MinVersion = minVersion
+
+	return &TLS{Config: tlsConfig, manager: manager}
+}
+
+// RedirectHandler redirects plain HTTP requests to HTTPS on httpsPort. With
+// autocert it also answers ACME HTTP-01 challenges.
+func (t *TLS) RedirectHandler(httpsPort int) http.Handler {
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+
+	if t.manager != nil {
+		return t.manager.HTTPHandler(redirect)
+	}
+	return redirect
+}
@@ -0,0 +1,178 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/models"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// Kafka publishes events to a Kafka topic, keyed by tenant ID
+type Kafka struct {
+	writer *kafka.Writer
+}
+
+// NewKafka creates a Kafka sink. Brokers are contacted lazily, on the first
+// publish, so an unreachable cluster does not block startup.
+func NewKafka(cfg config.KafkaSinkConfig) (*Kafka, error) {
+	transport := &kafka.Transport{ClientID: cfg.ClientID}
+
+	if cfg.TLS.Enabled {
+		tlsConfig, err := kafkaTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLS = tlsConfig
+	}
+
+	if cfg.SASL.Mechanism != "" {
+		mechanism, err := kafkaSASLMechanism(cfg.SASL)
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = mechanism
+	}
+
+	acks := kafka.RequireAll
+	switch cfg.RequiredAcks {
+	case "one":
+		acks = kafka.RequireOne
+	case "none":
+		acks = kafka.RequireNone
+	}
+
+	return &Kafka{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: acks,
+			BatchTimeout: cfg.BatchTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			Transport:    transport,
+		},
+	}, nil
+}
+
+// Name implements Sink
+func (k *Kafka) Name() string {
+	return "kafka"
+}
+
+// Publish implements Sink. The message value is the event as returned by
+// the API; the key is the tenant ID so a tenant's events share a partition.
+func (k *Kafka) Publish(ctx context.Context, event *models.Event) error {
+	value, err := json.Marshal(event.ToEventResponse())
+	if err != nil {
+		return err
+	}
+
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.TenantID),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "tenant_id", Value: []byte(event.TenantID)},
+			{Key: "event_type", Value: []byte(event.EventType)},
+		},
+	})
+}
+
+// Close implements Sink
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
+
+// CheckKafka connects to the first reachable broker with the sink's
+// credentials and checks that the topic exists, for the startup self-check
+func CheckKafka(ctx context.Context, cfg config.KafkaSinkConfig) error {
+	dialer := &kafka.Dialer{ClientID: cfg.ClientID}
+	if cfg.TLS.Enabled {
+		tlsConfig, err := kafkaTLSConfig(cfg.TLS)
+		if err != nil {
+			return err
+		}
+		dialer.TLS = tlsConfig
+	}
+	if cfg.SASL.Mechanism != "" {
+		mechanism, err := kafkaSASLMechanism(cfg.SASL)
+		if err != nil {
+			return err
+		}
+		dialer.SASLMechanism = mechanism
+	}
+
+	var errs []error
+	for _, broker := range cfg.Brokers {
+		conn, err := dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		_, err = conn.ReadPartitions(cfg.Topic)
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("topic %s: %w", cfg.Topic, err)
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// kafkaTLSConfig builds the client TLS configuration from CA and client
+// certificate files
+func kafkaTLSConfig(cfg config.KafkaTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read kafka CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in kafka CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// kafkaSASLMechanism returns the configured SASL mechanism
+func kafkaSASLMechanism(cfg config.KafkaSASLConfig) (sasl.Mechanism, error) {
+	switch cfg.Mechanism {
+	case "plain":
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+	default:
+		return nil, fmt.Errorf("unsupported kafka SASL mechanism %q", cfg.Mechanism)
+	}
+}
@@ -0,0 +1,60 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/models"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS publishes events to JetStream under <prefix>.<tenant_id>
+type NATS struct {
+	js      nats.JetStreamContext
+	prefix  string
+	timeout time.Duration
+}
+
+// NewNATS creates a NATS sink on a shared connection, which the caller owns
+func NewNATS(nc *nats.Conn, cfg config.NatsConfig) (*NATS, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	return &NATS{js: js, prefix: cfg.SubjectPrefix, timeout: cfg.PublishTimeout}, nil
+}
+
+// Name implements Sink
+func (n *NATS) Name() string {
+	return "nats"
+}
+
+// Publish implements Sink. The event ID is sent as Nats-Msg-Id so the
+// stream discards duplicates when a publish is retried.
+func (n *NATS) Publish(ctx context.Context, event *models.Event) error {
+	data, err := json.Marshal(event.ToEventResponse())
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(n.prefix + "." + event.TenantID)
+	msg.Data = data
+	msg.Header.Set(nats.MsgIdHdr, strconv.FormatUint(uint64(event.ID), 10))
+	msg.Header.Set("Tenant-Id", event.TenantID)
+	msg.Header.Set("Event-Type", event.EventType)
+
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+	_, err = n.js.PublishMsg(msg, nats.Context(ctx))
+	return err
+}
+
+// Close implements Sink. Publishes are acknowledged synchronously, so there
+// is nothing to flush; the shared connection is closed by its owner.
+func (n *NATS) Close() error {
+	return nil
+}
@@ -0,0 +1,208 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"event-ingestion-system/internal/deadletter"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+)
+
+// workers is the number of concurrent publishers per sink. Sinks batch
+// internally, so a few concurrent callers keep batches full.
+const workers = 4
+
+// Sink is an external system that accepted events are mirrored to
+type Sink interface {
+	// Name identifies the sink in logs and metrics
+	Name() string
+	// Publish delivers one event; it may block until the sink acknowledges
+	Publish(ctx context.Context, event *models.Event) error
+	// Close flushes buffered messages and releases connections
+	Close() error
+}
+
+// Forwarder feeds one sink from a bounded buffer so ingestion never waits
+// on it. Events that do not fit in the buffer are dropped and counted;
+// events the sink rejects become dead letters.
+type Forwarder struct {
+	sink        Sink
+	queue       chan *models.Event
+	deadLetters *deadletter.Store
+	logger      *slog.Logger
+
+	draining  chan struct{}
+	drainOnce sync.Once
+	stopped   chan struct{}
+}
+
+// NewForwarder creates a forwarder with room for bufferSize events
+func NewForwarder(s Sink, bufferSize int, deadLetters *deadletter.Store, logger *slog.Logger) *Forwarder {
+	return &Forwarder{
+		sink:        s,
+		queue:       make(chan *models.Event, bufferSize),
+		deadLetters: deadLetters,
+		logger:      logger.With("component", "sink", "sink", s.Name()),
+		draining:    make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+}
+
+// Enqueue buffers an event for delivery without blocking the caller
+func (f *Forwarder) Enqueue(event *models.Event) {
+	select {
+	case f.queue <- event:
+		metrics.SinkQueueDepth(f.sink.Name(), len(f.queue))
+	default:
+		metrics.SinkEvent(f.sink.Name(), "dropped")
+		f.logger.Warn("Sink buffer full, dropping event", "event_id", event.ID, "tenant_id", event.TenantID)
+	}
+}
+
+// QueueDepth returns the number of events waiting for delivery
+func (f *Forwarder) QueueDepth() int {
+	return len(f.queue)
+}
+
+// Run publishes buffered events until ctx is cancelled or Shutdown has
+// drained the buffer
+func (f *Forwarder) Run(ctx context.Context) {
+	defer close(f.stopped)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event := <-f.queue:
+					f.publish(ctx, event)
+				case <-f.draining:
+					f.drain(ctx)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// drain publishes whatever is still buffered, then returns
+func (f *Forwarder) drain(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-f.queue:
+			f.publish(ctx, event)
+		default:
+			return
+		}
+	}
+}
+
+func (f *Forwarder) publish(ctx context.Context, event *models.Event) {
+	metrics.SinkQueueDepth(f.sink.Name(), len(f.queue))
+
+	if err := f.sink.Publish(ctx, event); err != nil {
+		metrics.SinkEvent(f.sink.Name(), "failed")
+		f.logger.Error("Failed to publish event", "event_id", event.ID, "tenant_id", event.TenantID, "error", err)
+		f.deadLetters.Record(ctx, deadletter.Sink(f.sink.Name(), event, err))
+		return
+	}
+	metrics.SinkEvent(f.sink.Name(), "published")
+}
+
+// Shutdown publishes the buffered events, waits for the workers and closes
+// the sink. If ctx expires first, cancel Run's context to abandon the rest.
+func (f *Forwarder) Shutdown(ctx context.Context) error {
+	f.drainOnce.Do(func() { close(f.draining) })
+
+	select {
+	case <-f.stopped:
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %d events still buffered: %w", f.sink.Name(), f.QueueDepth(), ctx.Err())
+	}
+	return f.sink.Close()
+}
+
+// Pipeline fans accepted events out to every configured sink. A pipeline
+// without sinks does nothing.
+type Pipeline struct {
+	forwarders []*Forwarder
+}
+
+// NewPipeline creates a pipeline over the given forwarders
+func NewPipeline(forwarders ...*Forwarder) *Pipeline {
+	return &Pipeline{forwarders: forwarders}
+}
+
+// Publish hands an event to every sink without blocking
+func (p *Pipeline) Publish(event *models.Event) {
+	for _, f := range p.forwarders {
+		f.Enqueue(event)
+	}
+}
+
+// Retry publishes an event to the named sink directly, bypassing the
+// buffer, and returns the sink's error
+func (p *Pipeline) Retry(ctx context.Context, name string, event *models.Event) error {
+	for _, f := range p.forwarders {
+		if f.sink.Name() == name {
+			if err := f.sink.Publish(ctx, event); err != nil {
+				metrics.SinkEvent(name, "failed")
+				return err
+			}
+			metrics.SinkEvent(name, "published")
+			return nil
+		}
+	}
+	return fmt.Errorf("sink %q is not configured", name)
+}
+
+// QueueDepths returns the number of buffered events per sink
+func (p *Pipeline) QueueDepths() map[string]int {
+	depths := make(map[string]int, len(p.forwarders))
+	for _, f := range p.forwarders {
+		depths[f.sink.Name()] = f.QueueDepth()
+	}
+	return depths
+}
+
+// Run starts every forwarder and blocks until they have all stopped
+func (p *Pipeline) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, f := range p.forwarders {
+		wg.Add(1)
+		go func(f *Forwarder) {
+			defer wg.Done()
+			f.Run(ctx)
+		}(f)
+	}
+	wg.Wait()
+}
+
+// Shutdown drains and closes every sink concurrently, reporting the first
+// failure
+func (p *Pipeline) Shutdown(ctx context.Context) error {
+	errs := make(chan error, len(p.forwarders))
+	for _, f := range p.forwarders {
+		go func(f *Forwarder) {
+			errs <- f.Shutdown(ctx)
+		}(f)
+	}
+
+	var first error
+	for range p.forwarders {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,237 @@
+package testsupport
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCClientID and OIDCClientSecret are the credentials the fake provider
+// accepts
+const (
+	OIDCClientID     = "testsupport-client"
+	OIDCClientSecret = "testsupport-client-secret"
+)
+
+// OIDCIdentity is the user the fake provider signs in
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// OIDCProvider is a fake OpenID Connect provider. Its authorization endpoint
+// approves every request at once, redirecting back with a code for the
+// current Identity, and its token endpoint checks the PKCE verifier.
+type OIDCProvider struct {
+	// URL is the issuer
+	URL string
+
+	mu       sync.Mutex
+	identity OIDCIdentity
+	// clockOffset shifts the times in issued ID tokens
+	clockOffset time.Duration
+	codes       map[string]grant
+	key         *rsa.PrivateKey
+}
+
+type grant struct {
+	identity  OIDCIdentity
+	nonce     string
+	challenge string
+}
+
+// StartOIDCProvider starts a fake provider that signs in identity. It is
+// closed when the test ends.
+func StartOIDCProvider(tb testing.TB, identity OIDCIdentity) *OIDCProvider {
+	tb.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tb.Fatalf("testsupport: generate OIDC key: %v", err)
+	}
+	p := &OIDCProvider{identity: identity, codes: make(map[string]grant), key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/keys", p.keys)
+	ts := httptest.NewServer(mux)
+	tb.Cleanup(ts.Close)
+
+	p.URL = ts.URL
+	return p
+}
+
+// Config returns an auth.oidc section for the provider. redirectURL is the
+// callback as the test reaches it.
+func (p *OIDCProvider) Config(redirectURL string, allowedDomains ...string) *config.OIDCConfig {
+	return &config.OIDCConfig{
+		Issuer:         p.URL,
+		ClientID:       OIDCClientID,
+		ClientSecret:   OIDCClientSecret,
+		RedirectURL:    redirectURL,
+		AllowedDomains: allowedDomains,
+	}
+}
+
+// SetIdentity changes the user signed in from now on
+func (p *OIDCProvider) SetIdentity(identity OIDCIdentity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.identity = identity
+}
+
+// SetClockOffset makes the provider's clock run ahead, or behind when
+// negative, of the server's
+func (p *OIDCProvider) SetClockOffset(offset time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clockOffset = offset
+}
+
+// SignIn goes through the flow as a browser would: it starts at the login
+// route, lets the provider approve and follows its redirect to the callback
+// of s, whatever host the configured redirect URL names. The caller closes
+// the response body.
+func (p *OIDCProvider) SignIn(s *Server) (*http.Response, error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	login, err := client.Get(s.URL + "/api/v1/auth/oidc/login")
+	if err != nil {
+		return nil, err
+	}
+	login.Body.Close()
+	if login.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("login returned %d", login.StatusCode)
+	}
+
+	approve, err := client.Get(login.Header.Get("Location"))
+	if err != nil {
+		return nil, err
+	}
+	approve.Body.Close()
+	callback, err := url.Parse(approve.Header.Get("Location"))
+	if err != nil || approve.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("provider returned %d", approve.StatusCode)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.URL+callback.RequestURI(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, cookie := range login.Cookies() {
+		req.AddCookie(cookie)
+	}
+	return client.Do(req)
+}
+
+func (p *OIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/keys",
+	})
+}
+
+func (p *OIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("client_id") != OIDCClientID || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomID()
+	p.mu.Lock()
+	p.codes[code] = grant{identity: p.identity, nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	p.mu.Unlock()
+
+	back := redirect.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirect.RawQuery = back.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *OIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if id != OIDCClientID || secret != OIDCClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+	p.mu.Lock()
+	g, ok := p.codes[code]
+	delete(p.codes, code)
+	offset := p.clockOffset
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now().Add(offset)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.URL,
+		"aud":            OIDCClientID,
+		"sub":            g.identity.Subject,
+		"email":          g.identity.Email,
+		"email_verified": g.identity.EmailVerified,
+		"nonce":          g.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	token.Header["kid"] = "testsupport"
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+func (p *OIDCProvider) keys(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kid": "testsupport",
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
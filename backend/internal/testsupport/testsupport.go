@@ -0,0 +1,186 @@
+// Package testsupport runs the whole server in-process for integration
+// tests: an in-memory SQLite database, the real router behind an
+// httptest.Server, one tenant and clients that authenticate as that tenant
+// and as the admin.
+package testsupport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"event-ingestion-system/internal/app"
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/models"
+)
+
+// AdminToken is the admin token of every test server
+const AdminToken = "testsupport-admin-token"
+
+// TenantName is the name of the tenant Start creates
+const TenantName = "Test Tenant"
+
+// databases numbers the in-memory databases so parallel tests get their own
+var databases atomic.Int64
+
+// Server is a running app and the credentials to call it
+type Server struct {
+	App *app.App
+	// URL is the base URL of the server, without a trailing slash
+	URL    string
+	Tenant models.CreateTenantResponse
+	// Client authenticates with the tenant's API key
+	Client *Client
+	// Admin authenticates with AdminToken
+	Admin *Client
+	// Anonymous sends no credentials
+	Anonymous *Client
+}
+
+// Start builds the app on a fresh in-memory database, serves it from an
+// httptest.Server and creates a tenant. configure may adjust the config
+// before defaults are applied. Everything is shut down when the test ends.
+func Start(tb testing.TB, configure ...func(*config.Config)) *Server {
+	tb.Helper()
+
+	cfg := &config.Config{}
+	cfg.App.Mode = "test"
+	cfg.App.Env = "test"
+	cfg.Auth.JWTSecret = "testsupport-jwt-secret"
+	cfg.Auth.AdminToken = AdminToken
+	cfg.Frontend.Mode = "disabled"
+	// Every connection to a named shared-cache memory database sees the same
+	// data, and the data lives as long as one connection does. A single
+	// connection keeps it alive and avoids SQLite table locks between them.
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.Host = fmt.Sprintf("file:testsupport-%d?mode=memory&cache=shared", databases.Add(1))
+	cfg.Database.MaxOpenConns = 1
+	cfg.Database.MaxIdleConns = 1
+	cfg.Archive.Dir = tb.TempDir()
+	// Test receivers are httptest servers on loopback
+	cfg.Webhooks.AllowedNetworks = []string{"127.0.0.0/8", "::1"}
+	for _, fn := range configure {
+		fn(cfg)
+	}
+	cfg.Defaults()
+	if err := cfg.Validate(); err != nil {
+		tb.Fatalf("testsupport: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a, err := app.New(cfg, logger)
+	if err != nil {
+		tb.Fatalf("testsupport: start app: %v", err)
+	}
+	ts := httptest.NewServer(a.Handler)
+	tb.Cleanup(func() {
+		ts.Close()
+		if !a.Shutdown() {
+			tb.Errorf("testsupport: app shut down with errors")
+		}
+	})
+
+	s := &Server{
+		App:       a,
+		URL:       ts.URL,
+		Anonymous: &Client{base: ts.URL, http: ts.Client()},
+	}
+	s.Admin = s.Anonymous.With("X-Admin-Token", AdminToken)
+
+	status, err := s.Anonymous.JSON(http.MethodPost, "/api/v1/tenants", models.CreateTenantRequest{Name: TenantName}, &s.Tenant)
+	if err != nil || status != http.StatusCreated {
+		tb.Fatalf("testsupport: create tenant: status %d: %v", status, err)
+	}
+	s.Client = s.Anonymous.With(cfg.Auth.APIKeyHeader, s.Tenant.APIKey)
+	return s
+}
+
+// WebSocketURL returns the URL of the event stream, authenticated by the
+// tenant's API key in the query string
+func (s *Server) WebSocketURL() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http") + "/api/v1/ws?api_key=" + s.Tenant.APIKey
+}
+
+// Client calls the test server with a fixed set of headers
+type Client struct {
+	base    string
+	http    *http.Client
+	headers http.Header
+}
+
+// With returns a copy of c that also sends header
+func (c *Client) With(name, value string) *Client {
+	headers := c.headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set(name, value)
+	return &Client{base: c.base, http: c.http, headers: headers}
+}
+
+// Request sends a request to path, encoding body as JSON unless it is nil.
+// The caller closes the response body.
+func (c *Client) Request(method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	contentType := ""
+	if body != nil {
+		contentType = "application/json"
+	}
+	return c.send(method, path, reader, contentType)
+}
+
+// Raw sends body as it is, with the Content-Type set by With. The caller
+// closes the response body.
+func (c *Client) Raw(method, path string, body []byte) (*http.Response, error) {
+	return c.send(method, path, bytes.NewReader(body), "")
+}
+
+// send sends a request with c's headers, and contentType unless it is empty
+func (c *Client) send(method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.http.Do(req)
+}
+
+// JSON sends a request like Request and decodes the response body into out,
+// whatever the status, so error envelopes can be inspected too. It returns
+// the status code.
+func (c *Client) JSON(method, path string, body, out any) (int, error) {
+	resp, err := c.Request(method, path, body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,38 @@
+package testsupport_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/testsupport"
+)
+
+func TestStartAuthenticatesClients(t *testing.T) {
+	s := testsupport.Start(t)
+
+	var event struct {
+		ID       uint   `json:"id"`
+		TenantID string `json:"tenant_id"`
+	}
+	status, err := s.Client.JSON(http.MethodPost, "/api/v1/events", models.EventRequest{
+		TenantID:  s.Tenant.ID,
+		EventType: "harness.test",
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Metadata:  []byte(`{"ok":true}`),
+	}, &event)
+	if err != nil || status != http.StatusCreated {
+		t.Fatalf("ingest as the tenant: status %d: %v", status, err)
+	}
+	if event.ID == 0 || event.TenantID != s.Tenant.ID {
+		t.Fatalf("event = %+v, want the tenant's stored event", event)
+	}
+
+	if status, err := s.Admin.JSON(http.MethodGet, "/api/v1/admin/leader", nil, nil); err != nil || status != http.StatusOK {
+		t.Fatalf("admin request: status %d: %v", status, err)
+	}
+	if status, err := s.Anonymous.JSON(http.MethodGet, "/api/v1/events", nil, nil); err != nil || status != http.StatusUnauthorized {
+		t.Fatalf("anonymous request: status %d, want %d: %v", status, http.StatusUnauthorized, err)
+	}
+}
@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// gormPlugin turns every GORM operation into a child span of the
+// context the query was issued with (see Database.WithContext)
+type gormPlugin struct{}
+
+// GormPlugin returns the GORM tracing plugin
+func GormPlugin() gorm.Plugin {
+	return gormPlugin{}
+}
+
+// Name implements gorm.Plugin
+func (gormPlugin) Name() string {
+	return "otel-tracing"
+}
+
+// Initialize implements gorm.Plugin
+func (gormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+
+	if err := cb.Create().Before("gorm:create").Register("otel:before_create", startSpan("gorm.create")); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register("otel:after_create", endSpan); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("otel:before_query", startSpan("gorm.query")); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register("otel:after_query", endSpan); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("otel:before_update", startSpan("gorm.update")); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("otel:after_update", endSpan); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("otel:before_delete", startSpan("gorm.delete")); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register("otel:after_delete", endSpan); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("otel:before_row", startSpan("gorm.row")); err != nil {
+		return err
+	}
+	if err := cb.Row().After("gorm:row").Register("otel:after_row", endSpan); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register("otel:before_raw", startSpan("gorm.raw")); err != nil {
+		return err
+	}
+	return cb.Raw().After("gorm:raw").Register("otel:after_raw", endSpan)
+}
+
+// startSpan opens a client span and stores it on the statement context
+func startSpan(name string) func(*gorm.DB) {
+	tracer := Tracer()
+	return func(db *gorm.DB) {
+		if db.Statement == nil || db.Statement.Context == nil {
+			return
+		}
+		ctx, _ := tracer.Start(db.Statement.Context, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", db.Dialector.Name())),
+		)
+		db.Statement.Context = ctx
+	}
+}
+
+// endSpan annotates and finishes the span started by startSpan
+func endSpan(db *gorm.DB) {
+	if db.Statement == nil || db.Statement.Context == nil {
+		return
+	}
+	span := trace.SpanFromContext(db.Statement.Context)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.String("db.sql.table", db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,465 @@
+// Package transform reshapes events at ingestion following per-tenant rules:
+// metadata fields are renamed, set, copied, dropped or extracted from other
+// fields, and the event type can be rewritten.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/models"
+)
+
+// Actions a rule can take
+const (
+	ActionRename    = "rename"
+	ActionSet       = "set"
+	ActionCopy      = "copy"
+	ActionDrop      = "drop"
+	ActionExtract   = "extract"
+	ActionLowercase = "lowercase"
+)
+
+// What happens when a rule cannot apply to an event
+const (
+	OnErrorSkip   = "skip"
+	OnErrorReject = "reject"
+)
+
+// MaxRules bounds the rules of one tenant
+const MaxRules = 50
+
+// EventType names the event type in a rule's field or target
+const EventType = "$event_type"
+
+// ErrBudget fails the rules left once an event's budget is spent
+var ErrBudget = errors.New("execution budget exhausted")
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,100}$`)
+
+// rule is a compiled models.TransformRule. A nil field or target is the
+// event type.
+type rule struct {
+	name    string
+	action  string
+	field   []string
+	target  []string
+	value   any
+	pattern *regexp.Regexp
+	append  bool
+	reject  bool
+}
+
+// Transformer applies one tenant's rules
+type Transformer struct {
+	rules  []rule
+	budget time.Duration
+}
+
+// Failure is a rule that could not apply and was skipped
+type Failure struct {
+	Rule  string `json:"rule"`
+	Error string `json:"error"`
+}
+
+// Result is an event after the rules ran
+type Result struct {
+	EventType string
+	Metadata  []byte
+	// Applied names the rules that changed the event, in order
+	Applied []string
+	Skipped []Failure
+}
+
+// RuleError is a failure of a rule that rejects the event
+type RuleError struct {
+	Rule string
+	Err  error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("rule %q: %v", e.Rule, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// Compile validates rules and prepares them for Apply, which stops running
+// them once budget is spent. Errors name the offending rule and are meant
+// for the API caller.
+func Compile(rules []models.TransformRule, budget time.Duration) (*Transformer, error) {
+	if len(rules) > MaxRules {
+		return nil, fmt.Errorf("at most %d rules are allowed", MaxRules)
+	}
+
+	t := &Transformer{budget: budget}
+	seen := make(map[string]bool, len(rules))
+	for i, in := range rules {
+		prefix := fmt.Sprintf("rules[%d]", i)
+		if !namePattern.MatchString(in.Name) {
+			return nil, fmt.Errorf("%s.name: must be 1-100 letters, digits, dots, dashes or underscores", prefix)
+		}
+		if seen[in.Name] {
+			return nil, fmt.Errorf("%s.name: duplicate name %q", prefix, in.Name)
+		}
+		seen[in.Name] = true
+
+		compiled, err := compileRule(in)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%v", prefix, err)
+		}
+		t.rules = append(t.rules, compiled)
+	}
+	return t, nil
+}
+
+// compileRule checks the fields one action needs. Errors start with the
+// name of the field at fault.
+func compileRule(in models.TransformRule) (rule, error) {
+	r := rule{name: in.Name, action: in.Action, append: in.Append}
+	switch in.OnError {
+	case "", OnErrorSkip:
+	case OnErrorReject:
+		r.reject = true
+	default:
+		return rule{}, fmt.Errorf("on_error: must be skip or reject, got %q", in.OnError)
+	}
+
+	// Which of field and target the action reads and writes, and whether
+	// either may be the event type
+	var needField, needTarget, fieldType, targetType bool
+	switch in.Action {
+	case ActionRename:
+		needField, needTarget = true, true
+	case ActionSet:
+		needTarget, targetType = true, true
+	case ActionCopy, ActionExtract:
+		needField, needTarget, fieldType, targetType = true, true, true, true
+	case ActionDrop:
+		needField = true
+	case ActionLowercase:
+		// Lowercases in place without a target
+		needField, fieldType, targetType = true, true, true
+	default:
+		return rule{}, fmt.Errorf("action: must be rename, set, copy, drop, extract or lowercase, got %q", in.Action)
+	}
+
+	var err error
+	if needField {
+		if r.field, err = parsePath(in.Field, fieldType); err != nil {
+			return rule{}, fmt.Errorf("field: %v", err)
+		}
+	} else if in.Field != "" {
+		return rule{}, fmt.Errorf("field: not used by %s", in.Action)
+	}
+	switch {
+	case needTarget || in.Target != "":
+		if !needTarget && in.Action != ActionLowercase {
+			return rule{}, fmt.Errorf("target: not used by %s", in.Action)
+		}
+		if r.target, err = parsePath(in.Target, targetType); err != nil {
+			return rule{}, fmt.Errorf("target: %v", err)
+		}
+	case in.Action == ActionLowercase:
+		r.target = r.field
+	}
+	if r.append && (r.target == nil || in.Action == ActionLowercase) {
+		return rule{}, fmt.Errorf("append: only set, copy, extract and rename can append, to a metadata field")
+	}
+
+	if in.Action == ActionSet {
+		if len(in.Value) == 0 {
+			return rule{}, fmt.Errorf("value: is required")
+		}
+		if r.value, err = decode(in.Value); err != nil {
+			return rule{}, fmt.Errorf("value: %v", err)
+		}
+		if _, ok := r.value.(string); r.target == nil && !ok {
+			return rule{}, fmt.Errorf("value: the event type must be set to a string")
+		}
+	} else if len(in.Value) > 0 {
+		return rule{}, fmt.Errorf("value: not used by %s", in.Action)
+	}
+
+	if in.Action == ActionExtract {
+		if in.Pattern == "" {
+			return rule{}, fmt.Errorf("pattern: is required")
+		}
+		if r.pattern, err = regexp.Compile(in.Pattern); err != nil {
+			return rule{}, fmt.Errorf("pattern: %v", err)
+		}
+	} else if in.Pattern != "" {
+		return rule{}, fmt.Errorf("pattern: not used by %s", in.Action)
+	}
+	return r, nil
+}
+
+// parsePath splits a dot-separated path of object keys, which "$." may
+// prefix. The event type parses as nil where allowed.
+func parsePath(path string, eventType bool) ([]string, error) {
+	if path == EventType {
+		if !eventType {
+			return nil, fmt.Errorf("cannot be %s", EventType)
+		}
+		return nil, nil
+	}
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, fmt.Errorf("is required")
+	}
+	if len(path) > 500 {
+		return nil, fmt.Errorf("must be at most 500 characters")
+	}
+	segments := strings.Split(path, ".")
+	for _, s := range segments {
+		if s == "" {
+			return nil, fmt.Errorf("empty segment in %q", path)
+		}
+	}
+	return segments, nil
+}
+
+// decode parses JSON keeping numbers as they were written
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Apply runs the rules over an event's type and JSON metadata. A rule that
+// cannot apply is skipped, or ends the run with a *RuleError when it
+// rejects the event, returned with what the rules before it made of the
+// event. Once the budget is spent every rule left fails with ErrBudget.
+// Metadata that no rule changed is returned as it was.
+func (t *Transformer) Apply(eventType string, metadata []byte) (Result, error) {
+	result := Result{EventType: eventType, Metadata: metadata}
+	if len(t.rules) == 0 {
+		return result, nil
+	}
+
+	// Rules may add fields to missing metadata, but not to an array or a
+	// scalar
+	doc := map[string]any{}
+	var docErr error
+	if trimmed := bytes.TrimSpace(metadata); len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")) {
+		v, err := decode(metadata)
+		if err != nil {
+			return result, err
+		}
+		var ok bool
+		if doc, ok = v.(map[string]any); !ok {
+			docErr = errors.New("metadata is not an object")
+		}
+	}
+
+	start := time.Now()
+	changed := false
+	var rejected error
+	for _, r := range t.rules {
+		var err error
+		switch {
+		case time.Since(start) > t.budget:
+			err = ErrBudget
+		case docErr != nil && (r.field != nil || r.target != nil):
+			err = docErr
+		default:
+			err = r.apply(&result.EventType, doc)
+		}
+		if err == errUnchanged {
+			continue
+		}
+		if err != nil {
+			if r.reject {
+				rejected = &RuleError{Rule: r.name, Err: err}
+				break
+			}
+			result.Skipped = append(result.Skipped, Failure{Rule: r.name, Error: err.Error()})
+			continue
+		}
+		result.Applied = append(result.Applied, r.name)
+		changed = changed || r.field != nil || r.target != nil
+	}
+
+	if changed {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return result, err
+		}
+		result.Metadata = data
+	}
+	return result, rejected
+}
+
+// errUnchanged is a rule that applied without changing anything, such as
+// dropping a field that is not there
+var errUnchanged = errors.New("unchanged")
+
+// apply runs the rule on the event type and metadata
+func (r rule) apply(eventType *string, doc map[string]any) error {
+	switch r.action {
+	case ActionDrop:
+		if _, ok := lookup(doc, r.field); !ok {
+			return errUnchanged
+		}
+		remove(doc, r.field)
+		return nil
+	case ActionSet:
+		return r.write(eventType, doc, clone(r.value))
+	}
+
+	value, ok := r.read(*eventType, doc)
+	if !ok {
+		return fmt.Errorf("field %s not found", r.describe(r.field))
+	}
+	switch r.action {
+	case ActionRename:
+		if err := r.write(eventType, doc, value); err != nil {
+			return err
+		}
+		remove(doc, r.field)
+		return nil
+	case ActionCopy:
+		return r.write(eventType, doc, clone(value))
+	case ActionExtract:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("field %s is not a string", r.describe(r.field))
+		}
+		m := r.pattern.FindStringSubmatch(s)
+		if m == nil {
+			return fmt.Errorf("field %s does not match the pattern", r.describe(r.field))
+		}
+		if len(m) > 1 {
+			return r.write(eventType, doc, m[1])
+		}
+		return r.write(eventType, doc, m[0])
+	case ActionLowercase:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("field %s is not a string", r.describe(r.field))
+		}
+		return r.write(eventType, doc, strings.ToLower(s))
+	}
+	return fmt.Errorf("unknown action %q", r.action)
+}
+
+// read returns the value of the rule's field
+func (r rule) read(eventType string, doc map[string]any) (any, bool) {
+	if r.field == nil {
+		return eventType, true
+	}
+	return lookup(doc, r.field)
+}
+
+// write stores value at the rule's target, appending it when the rule
+// appends
+func (r rule) write(eventType *string, doc map[string]any, value any) error {
+	if r.target == nil {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("the event type must be a string")
+		}
+		*eventType = s
+		return nil
+	}
+
+	parent, err := parentOf(doc, r.target)
+	if err != nil {
+		return err
+	}
+	key := r.target[len(r.target)-1]
+	if !r.append {
+		parent[key] = value
+		return nil
+	}
+	switch existing := parent[key].(type) {
+	case nil:
+		parent[key] = []any{value}
+	case []any:
+		parent[key] = append(existing, value)
+	default:
+		return fmt.Errorf("target %s is not an array", r.describe(r.target))
+	}
+	return nil
+}
+
+// describe renders a path for an error
+func (r rule) describe(path []string) string {
+	if path == nil {
+		return EventType
+	}
+	return strings.Join(path, ".")
+}
+
+// lookup returns the value at path
+func lookup(doc map[string]any, path []string) (any, bool) {
+	var node any = doc
+	for _, key := range path {
+		obj, ok := node.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if node, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// remove deletes the value at path, if there is one
+func remove(doc map[string]any, path []string) {
+	if parent, ok := lookup(doc, path[:len(path)-1]); ok {
+		if obj, ok := parent.(map[string]any); ok {
+			delete(obj, path[len(path)-1])
+		}
+	}
+}
+
+// parentOf returns the object holding the last key of path, creating
+// missing objects on the way
+func parentOf(doc map[string]any, path []string) (map[string]any, error) {
+	node := doc
+	for i, key := range path[:len(path)-1] {
+		switch next := node[key].(type) {
+		case map[string]any:
+			node = next
+		case nil:
+			child := map[string]any{}
+			node[key] = child
+			node = child
+		default:
+			return nil, fmt.Errorf("%s is not an object", strings.Join(path[:i+1], "."))
+		}
+	}
+	return node, nil
+}
+
+// clone copies a decoded JSON value, so a copy and its source can change
+// independently
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, child := range v {
+			out[key] = clone(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = clone(child)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,93 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X event-ingestion-system/internal/version.Version=v1.2.0 \
+//	  -X event-ingestion-system/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X event-ingestion-system/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Values left empty are filled from the Go build info where possible.
+var (
+	Version   string
+	Commit    string
+	BuildDate string
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+var (
+	info     Info
+	infoOnce sync.Once
+)
+
+// Get returns the build information, resolved once
+func Get() Info {
+	infoOnce.Do(func() {
+		bi, _ := debug.ReadBuildInfo()
+		info = resolve(Version, Commit, BuildDate, bi)
+	})
+	return info
+}
+
+// resolve prefers ldflags values and falls back to the module version and
+// VCS stamps recorded by the Go toolchain
+func resolve(version, commit, buildDate string, bi *debug.BuildInfo) Info {
+	out := Info{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi != nil {
+		if out.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			out.Version = bi.Main.Version
+		}
+		var modified bool
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if out.Commit == "" {
+					out.Commit = s.Value
+				}
+			case "vcs.time":
+				if out.BuildDate == "" {
+					out.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if modified && commit == "" && out.Commit != "" {
+			out.Commit += "-dirty"
+		}
+	}
+
+	if out.Version == "" {
+		out.Version = "dev"
+	}
+	if out.Commit == "" {
+		out.Commit = "unknown"
+	}
+	if out.BuildDate == "" {
+		out.BuildDate = "unknown"
+	}
+	return out
+}
+
+// String formats the version for the Server header and startup logs
+func (i Info) String() string {
+	return "event-ingestion-system/" + i.Version
+}
@@ -0,0 +1,82 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	stamped := &debug.BuildInfo{
+		Main: debug.Module{Path: "event-ingestion-system", Version: "v1.4.0"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123abcd"},
+			{Key: "vcs.time", Value: "2026-03-14T15:09:26Z"},
+			{Key: "vcs.modified", Value: "false"},
+		},
+	}
+	dirty := &debug.BuildInfo{
+		Main: debug.Module{Path: "event-ingestion-system", Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123abcd"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name                       string
+		version, commit, buildDate string
+		bi                         *debug.BuildInfo
+		want                       Info
+	}{
+		{
+			name: "ldflags unset, build info stamped", bi: stamped,
+			want: Info{Version: "v1.4.0", Commit: "0123abcd", BuildDate: "2026-03-14T15:09:26Z"},
+		},
+		{
+			name: "ldflags win over build info", version: "v2.0.0", commit: "feedface", buildDate: "2026-04-01T00:00:00Z", bi: stamped,
+			want: Info{Version: "v2.0.0", Commit: "feedface", BuildDate: "2026-04-01T00:00:00Z"},
+		},
+		{
+			name: "ldflags set in part", version: "v2.0.0", bi: stamped,
+			want: Info{Version: "v2.0.0", Commit: "0123abcd", BuildDate: "2026-03-14T15:09:26Z"},
+		},
+		{
+			name: "modified checkout of a devel build", bi: dirty,
+			want: Info{Version: "dev", Commit: "0123abcd-dirty", BuildDate: "unknown"},
+		},
+		{
+			name: "commit from ldflags is not marked dirty", commit: "feedface", bi: dirty,
+			want: Info{Version: "dev", Commit: "feedface", BuildDate: "unknown"},
+		},
+		{
+			name: "no build info",
+			want: Info{Version: "dev", Commit: "unknown", BuildDate: "unknown"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.want.GoVersion = runtime.Version()
+			if got := resolve(tc.version, tc.commit, tc.buildDate, tc.bi); got != tc.want {
+				t.Fatalf("resolve() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestGetFallsBackToBuildInfo runs with the ldflags unset, as go test
+// builds, so every field comes from the build info or its defaults
+func TestGetFallsBackToBuildInfo(t *testing.T) {
+	if Version != "" || Commit != "" || BuildDate != "" {
+		t.Skip("built with ldflags")
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Skip("no build info")
+	}
+	if got, want := Get(), resolve("", "", "", bi); got != want {
+		t.Fatalf("Get() = %+v, want %+v", got, want)
+	}
+	if got := Get(); got.Version == "" || got.Commit == "" || got.BuildDate == "" {
+		t.Fatalf("Get() = %+v, want every field filled", got)
+	}
+}
@@ -0,0 +1,114 @@
+// Package views validates saved event views and evaluates their relative
+// time ranges.
+package views
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"event-ingestion-system/internal/eventtype"
+	"event-ingestion-system/internal/models"
+)
+
+const (
+	// MaxEventTypes bounds the event types one filter may list
+	MaxEventTypes = 50
+	// MaxTags bounds the tags one filter may list
+	MaxTags = 20
+)
+
+const (
+	SortNewest = "newest"
+	SortOldest = "oldest"
+)
+
+var (
+	// namePattern restricts view names to what is safe in a URL path; an
+	// all-digit name would be mistaken for an ID
+	namePattern   = regexp.MustCompile(`^[A-Za-z0-9._-]{1,100}$`)
+	digitsPattern = regexp.MustCompile(`^[0-9]+$`)
+	rangePattern  = regexp.MustCompile(`^last_([1-9][0-9]{0,3})(m|h|d|w)$`)
+)
+
+// ValidateName checks a view name
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("name must be 1-100 letters, digits, dots, dashes or underscores")
+	}
+	if digitsPattern.MatchString(name) {
+		return fmt.Errorf("name must not be all digits")
+	}
+	return nil
+}
+
+// Validate checks every field of a filter
+func Validate(filter models.ViewFilter) error {
+	if len(filter.EventTypes) > MaxEventTypes {
+		return fmt.Errorf("event_types: at most %d allowed", MaxEventTypes)
+	}
+	for i, t := range filter.EventTypes {
+		if err := eventtype.Validate(t); err != nil {
+			return fmt.Errorf("event_types[%d]: %v", i, err)
+		}
+	}
+	if len(filter.Tags) > MaxTags {
+		return fmt.Errorf("tags: at most %d allowed", MaxTags)
+	}
+	for i, tag := range filter.Tags {
+		if tag == "" || len(tag) > 100 {
+			return fmt.Errorf("tags[%d]: must be 1-100 characters", i)
+		}
+	}
+	if filter.Range != "" {
+		if _, _, err := Range(filter.Range, time.Now()); err != nil {
+			return fmt.Errorf("range: %v", err)
+		}
+	}
+	if len(filter.Search) > 200 {
+		return fmt.Errorf("search: must be at most 200 characters")
+	}
+	switch filter.Sort {
+	case "", SortNewest, SortOldest:
+	default:
+		return fmt.Errorf("sort: must be %s or %s", SortNewest, SortOldest)
+	}
+	return nil
+}
+
+// Range evaluates a relative time range expression at now. "last_<n><unit>"
+// with unit m, h, d or w covers the span up to now; "today" and "yesterday"
+// are UTC calendar days. until is nil when the range is open-ended.
+func Range(expr string, now time.Time) (since time.Time, until *time.Time, err error) {
+	return RangeIn(expr, now, time.UTC)
+}
+
+// RangeIn evaluates a range like Range, with "today" and "yesterday" the
+// calendar days of loc. Times are returned in UTC.
+func RangeIn(expr string, now time.Time, loc *time.Location) (since time.Time, until *time.Time, err error) {
+	local := now.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	now = now.UTC()
+
+	switch expr {
+	case "today":
+		return midnight.UTC(), nil, nil
+	case "yesterday":
+		since, until := midnight.AddDate(0, 0, -1).UTC(), midnight.UTC()
+		return since, &until, nil
+	}
+
+	m := rangePattern.FindStringSubmatch(expr)
+	if m == nil {
+		return time.Time{}, nil, fmt.Errorf("%q is not a range; use today, yesterday or last_<n><m|h|d|w>, e.g. last_24h", expr)
+	}
+	n, _ := strconv.Atoi(m[1])
+	unit := map[string]time.Duration{
+		"m": time.Minute,
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}[m[2]]
+	return now.Add(-time.Duration(n) * unit), nil, nil
+}
@@ -0,0 +1,144 @@
+package web
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"event-ingestion-system/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dist holds the built dashboard. The Docker build copies frontend/dist
+// here before compiling; a plain `go build` embeds only the placeholder.
+//
+//go:embed all:dist
+var dist embed.FS
+
+// reservedPaths are served by the API; unknown paths beneath them must get
+// the API's 404 rather than the dashboard
+var reservedPaths = []string{"/api", "/health", "/ready", "/version", "/metrics"}
+
+// Handler returns the NoRoute handler that serves the dashboard according to
+// cfg.Mode, or nil when the dashboard is disabled. Registered routes always
+// take priority; the handler only sees requests nothing else matched.
+func Handler(cfg config.FrontendConfig) (gin.HandlerFunc, error) {
+	switch cfg.Mode {
+	case "embedded":
+		sub, err := fs.Sub(dist, "dist")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fs.Stat(sub, "index.html"); err != nil {
+			return nil, fmt.Errorf("embedded frontend has no index.html; build it with `npm run build` and copy frontend/dist to internal/web/dist")
+		}
+		return staticHandler(sub), nil
+	case "dir":
+		return staticHandler(os.DirFS(cfg.Dir)), nil
+	case "proxy":
+		target, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		return proxyHandler(httputil.NewSingleHostReverseProxy(target)), nil
+	default:
+		return nil, nil
+	}
+}
+
+// staticHandler serves files from fsys and falls back to index.html for
+// client-side routes
+func staticHandler(fsys fs.FS) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !servable(c.Request) {
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean(c.Request.URL.Path), "/")
+		if name == "" {
+			name = "index.html"
+		}
+
+		if !isFile(fsys, name) {
+			// A missing asset is a real 404; only extension-less paths are
+			// client-side routes
+			if path.Ext(name) != "" {
+				return
+			}
+			name = "index.html"
+		}
+
+		serveFile(c, fsys, name)
+	}
+}
+
+// proxyHandler forwards dashboard requests, including the dev server's
+// hot-reload WebSocket, to an upstream
+func proxyHandler(proxy *httputil.ReverseProxy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isReserved(c.Request.URL.Path) {
+			return
+		}
+		proxy.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// serveFile writes a file with its content type and cache headers. Vite
+// fingerprints everything under assets/, so those files never change;
+// everything else, index.html in particular, must be revalidated.
+func serveFile(c *gin.Context, fsys fs.FS, name string) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		return
+	}
+
+	if strings.HasPrefix(name, "assets/") {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), content)
+}
+
+// servable reports whether a request may be answered with a dashboard file
+func servable(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return !isReserved(r.URL.Path)
+}
+
+func isReserved(p string) bool {
+	for _, prefix := range reservedPaths {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isFile(fsys fs.FS, name string) bool {
+	if strings.HasPrefix(name, ".") || strings.Contains(name, "/.") {
+		return false // never serve dotfiles
+	}
+	info, err := fs.Stat(fsys, name)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,191 @@
+package web_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/testsupport"
+)
+
+const indexHTML = "<!doctype html><title>Events</title>"
+
+// startWithDashboard starts a server serving a dashboard from a directory
+// holding index.html and one fingerprinted asset
+func startWithDashboard(t *testing.T) *testsupport.Server {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"index.html":          indexHTML,
+		"assets/app-1a2b.js":  "console.log('events')",
+		".env":                "SECRET=1",
+		"assets/.hidden.json": "{}",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return testsupport.Start(t, func(cfg *config.Config) {
+		cfg.Frontend.Mode = "dir"
+		cfg.Frontend.Dir = dir
+	})
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   string
+	code   string
+}
+
+func send(t *testing.T, client *testsupport.Client, method, path string) response {
+	t.Helper()
+	resp, err := client.Request(method, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := response{status: resp.StatusCode, header: resp.Header, body: string(body)}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var envelope struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, body)
+		}
+		r.code = envelope.Error.Code
+	}
+	return r
+}
+
+// TestDashboardDoesNotShadowAPIErrors checks that unknown paths under the
+// API get the JSON 404 while other paths fall back to the dashboard
+func TestDashboardDoesNotShadowAPIErrors(t *testing.T) {
+	s := startWithDashboard(t)
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		// code is the error code of a JSON error, or "" for the dashboard
+		code string
+	}{
+		{http.MethodGet, "/api/v1/nothing-here", http.StatusNotFound, "route_not_found"},
+		{http.MethodGet, "/api/v2/events/nothing-here", http.StatusNotFound, "route_not_found"},
+		{http.MethodGet, "/api", http.StatusNotFound, "route_not_found"},
+		{http.MethodGet, "/health/deep", http.StatusNotFound, "route_not_found"},
+		{http.MethodGet, "/metrics", http.StatusNotFound, "route_not_found"},
+		{http.MethodGet, "/", http.StatusOK, ""},
+		{http.MethodGet, "/settings/webhooks", http.StatusOK, ""},
+		// Paths that only start like a reserved one are the dashboard's
+		{http.MethodGet, "/apis", http.StatusOK, ""},
+		{http.MethodGet, "/healthy", http.StatusOK, ""},
+		// A missing file is not a client-side route
+		{http.MethodGet, "/assets/missing.js", http.StatusNotFound, "route_not_found"},
+		{http.MethodGet, "/.env", http.StatusNotFound, "route_not_found"},
+		{http.MethodGet, "/assets/.hidden.json", http.StatusNotFound, "route_not_found"},
+		// The dashboard only answers reads
+		{http.MethodPost, "/settings/webhooks", http.StatusNotFound, "route_not_found"},
+	} {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			r := send(t, s.Anonymous, tc.method, tc.path)
+			if r.status != tc.status || r.code != tc.code {
+				t.Fatalf("status %d, code %q, want %d, %q: %s", r.status, r.code, tc.status, tc.code, r.body)
+			}
+			if tc.code == "" && r.body != indexHTML {
+				t.Fatalf("body = %q, want index.html", r.body)
+			}
+		})
+	}
+
+	// A registered API route still wins
+	if r := send(t, s.Anonymous, http.MethodGet, "/health"); r.status != http.StatusOK || r.body == indexHTML {
+		t.Fatalf("GET /health: status %d, body %q, want the health check", r.status, r.body)
+	}
+	if r := send(t, s.Anonymous, http.MethodGet, "/assets/app-1a2b.js"); r.status != http.StatusOK || !strings.Contains(r.header.Get("Cache-Control"), "immutable") {
+		t.Fatalf("GET asset: status %d, Cache-Control %q, want an immutable asset", r.status, r.header.Get("Cache-Control"))
+	}
+}
+
+// TestNotFoundAndMethodEnvelopes compares API and non-API paths with and
+// without the dashboard
+func TestNotFoundAndMethodEnvelopes(t *testing.T) {
+	for _, dashboard := range []bool{false, true} {
+		name := "without dashboard"
+		if dashboard {
+			name = "with dashboard"
+		}
+		t.Run(name, func(t *testing.T) {
+			var s *testsupport.Server
+			if dashboard {
+				s = startWithDashboard(t)
+			} else {
+				s = testsupport.Start(t)
+			}
+			for _, tc := range []struct {
+				method, path string
+				status       int
+				code         string
+				allow        string
+			}{
+				{http.MethodGet, "/api/v1/nothing-here", http.StatusNotFound, "route_not_found", ""},
+				{http.MethodDelete, "/api/v1/nothing-here", http.StatusNotFound, "route_not_found", ""},
+				{http.MethodDelete, "/api/v1/events", http.StatusMethodNotAllowed, "method_not_allowed", "GET, POST"},
+				{http.MethodPut, "/api/v1/tenants", http.StatusMethodNotAllowed, "method_not_allowed", "GET, POST"},
+				{http.MethodPost, "/health", http.StatusMethodNotAllowed, "method_not_allowed", "GET"},
+				{http.MethodPost, "/version", http.StatusMethodNotAllowed, "method_not_allowed", "GET"},
+				{http.MethodDelete, "/settings", http.StatusNotFound, "route_not_found", ""},
+			} {
+				r := send(t, s.Anonymous, tc.method, tc.path)
+				if r.status != tc.status || r.code != tc.code {
+					t.Errorf("%s %s: status %d, code %q, want %d, %q: %s", tc.method, tc.path, r.status, r.code, tc.status, tc.code, r.body)
+				}
+				if got := r.header.Get("Allow"); got != tc.allow {
+					t.Errorf("%s %s: Allow = %q, want %q", tc.method, tc.path, got, tc.allow)
+				}
+			}
+
+			// Only the dashboard answers non-API reads
+			want := http.StatusNotFound
+			if dashboard {
+				want = http.StatusOK
+			}
+			if r := send(t, s.Anonymous, http.MethodGet, "/settings"); r.status != want {
+				t.Errorf("GET /settings: status %d, want %d", r.status, want)
+			}
+		})
+	}
+}
+
+// TestProxyLeavesReservedPathsToTheAPI checks the development proxy
+// forwards dashboard paths only
+func TestProxyLeavesReservedPathsToTheAPI(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "vite:"+r.URL.Path)
+	}))
+	defer upstream.Close()
+	s := testsupport.Start(t, func(cfg *config.Config) {
+		cfg.Frontend.Mode = "proxy"
+		cfg.Frontend.ProxyURL = upstream.URL
+	})
+
+	if r := send(t, s.Anonymous, http.MethodGet, "/src/main.ts"); r.status != http.StatusOK || r.body != "vite:/src/main.ts" {
+		t.Fatalf("GET /src/main.ts: status %d, body %q, want it proxied", r.status, r.body)
+	}
+	if r := send(t, s.Anonymous, http.MethodGet, "/api/v1/nothing-here"); r.status != http.StatusNotFound || r.code != "route_not_found" {
+		t.Fatalf("GET /api/v1/nothing-here: status %d, body %q, want the API's 404", r.status, r.body)
+	}
+}
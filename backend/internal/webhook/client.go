@@ -0,0 +1,243 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/models"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	// maxIdleConnsPerHost keeps connections to busy endpoints warm
+	maxIdleConnsPerHost = 16
+	// maxRedirects matches net/http's default limit
+	maxRedirects = 10
+	// MaxTimeout bounds a webhook's own timeouts, as a slow endpoint holds
+	// up the tenants sharing its worker
+	MaxTimeout = time.Minute
+)
+
+// Outcomes of a delivery attempt, recorded as the webhook's last_status
+const (
+	StatusDelivered       = "delivered"
+	StatusHTTPError       = "http_error"
+	StatusTimeout         = "timeout"
+	StatusConnectTimeout  = "connect_timeout"
+	StatusDNSError        = "dns_error"
+	StatusTLSError        = "tls_error"
+	StatusConnectionError = "connection_error"
+	StatusProxyError      = "proxy_error"
+	StatusRedirectRefused = "redirect_refused"
+	StatusForbidden       = "forbidden_address"
+	StatusError           = "error"
+)
+
+// errInsecureRedirect stops a redirect from an https URL to plain http
+var errInsecureRedirect = errors.New("refused redirect from https to http")
+
+// DeliveryError is a failed delivery attempt with its status
+type DeliveryError struct {
+	Status string
+	Err    error
+}
+
+func (e *DeliveryError) Error() string {
+	return e.Status + ": " + e.Err.Error()
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the status of a delivery attempt that ended with err
+func Status(err error) string {
+	if err == nil {
+		return StatusDelivered
+	}
+	var delivery *DeliveryError
+	if errors.As(err, &delivery) {
+		return delivery.Status
+	}
+	return StatusError
+}
+
+// classify wraps a transport error with its status
+func classify(err error) *DeliveryError {
+	var (
+		forbidden  *ForbiddenAddressError
+		opErr      *net.OpError
+		dnsErr     *net.DNSError
+		verifyErr  *tls.CertificateVerificationError
+		authErr    x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+		recordErr  tls.RecordHeaderError
+		alertErr   tls.AlertError
+		netErr     net.Error
+	)
+	status := StatusError
+	switch {
+	case errors.Is(err, errInsecureRedirect):
+		status = StatusRedirectRefused
+	case errors.As(err, &forbidden):
+		status = StatusForbidden
+	case errors.As(err, &opErr) && opErr.Op == "proxyconnect":
+		status = StatusProxyError
+	case errors.As(err, &dnsErr):
+		status = StatusDNSError
+	case strings.Contains(err.Error(), "TLS handshake timeout"):
+		// net/http's handshake timeout has no exported type
+		status = StatusConnectTimeout
+	case errors.As(err, &verifyErr), errors.As(err, &authErr), errors.As(err, &hostErr),
+		errors.As(err, &invalidErr), errors.As(err, &recordErr), errors.As(err, &alertErr):
+		status = StatusTLSError
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		status = StatusConnectionError
+		if opErr.Timeout() {
+			status = StatusConnectTimeout
+		}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		status = StatusTimeout
+	case errors.As(err, &opErr):
+		status = StatusConnectionError
+	}
+	return &DeliveryError{Status: status, Err: err}
+}
+
+// ParseTimeouts validates a webhook's timeout overrides, either of which
+// may be empty
+func ParseTimeouts(timeout, connectTimeout string) (time.Duration, time.Duration, error) {
+	parse := func(name, value string) (time.Duration, error) {
+		if value == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > MaxTimeout {
+			return 0, fmt.Errorf("%s must be a duration between 1ms and %s, got %q", name, MaxTimeout, value)
+		}
+		return d, nil
+	}
+	t, err := parse("timeout", timeout)
+	if err != nil {
+		return 0, 0, err
+	}
+	c, err := parse("connect_timeout", connectTimeout)
+	if err != nil {
+		return 0, 0, err
+	}
+	if t != 0 && c > t {
+		return 0, 0, fmt.Errorf("connect_timeout must not exceed timeout")
+	}
+	return t, c, nil
+}
+
+// timeouts returns the overall and connect timeouts of a delivery to wh
+func (d *Dispatcher) timeouts(wh models.Webhook) (time.Duration, time.Duration) {
+	t, c, err := ParseTimeouts(wh.Timeout, wh.ConnectTimeout)
+	if err != nil || t == 0 {
+		t = d.cfg.Timeout
+	}
+	if err != nil || c == 0 {
+		c = d.cfg.ConnectTimeout
+	}
+	return t, min(c, t)
+}
+
+type connectTimeoutKey struct{}
+
+// withConnectTimeout bounds the connection made for a request with ctx
+func withConnectTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, connectTimeoutKey{}, timeout)
+}
+
+// newClient builds the client deliveries share. Requests bound their own
+// duration, so the client has no timeout; connections, to the endpoint or
+// the proxy, take the request's connect timeout, and TLS handshakes
+// webhooks.connect_timeout. Endpoints are connected to through g.
+func newClient(cfg config.WebhooksConfig, g *guard) *http.Client {
+	dialer := &net.Dialer{KeepAlive: 30 * time.Second}
+	proxyAddr := proxyAddress(cfg.Proxy)
+	transport := &http.Transport{
+		Proxy: proxyFunc(cfg.Proxy, g),
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			timeout, ok := ctx.Value(connectTimeoutKey{}).(time.Duration)
+			if !ok {
+				timeout = cfg.ConnectTimeout
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			// The proxy is the operator's, and may well be internal
+			if addr == proxyAddr {
+				return dialer.DialContext(ctx, network, addr)
+			}
+			return g.dial(ctx, network, addr, dialer.DialContext)
+		},
+		TLSHandshakeTimeout:   cfg.ConnectTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{Transport: transport, CheckRedirect: checkRedirect}
+}
+
+// proxyFunc returns the transport's proxy selection; without a proxy URL
+// every request connects directly. A request to be proxied is checked by g
+// first, as the proxy connects to it instead of the transport.
+func proxyFunc(cfg config.ProxyConfig, g *guard) func(*http.Request) (*url.URL, error) {
+	if cfg.URL == "" {
+		return nil
+	}
+	proxy := (&httpproxy.Config{
+		HTTPProxy:  cfg.URL,
+		HTTPSProxy: cfg.URL,
+		NoProxy:    strings.Join(cfg.NoProxy, ","),
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := proxy(req.URL)
+		if err != nil || proxyURL == nil {
+			return proxyURL, err
+		}
+		if _, err := g.resolve(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		return proxyURL, nil
+	}
+}
+
+// proxyAddress returns the host:port the transport dials for the proxy, or
+// "" without one
+func proxyAddress(cfg config.ProxyConfig) string {
+	u, err := url.Parse(cfg.URL)
+	if cfg.URL == "" || err != nil {
+		return ""
+	}
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443", "socks5": "1080"}[u.Scheme]
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// checkRedirect follows redirects like net/http, except from https to http
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if via[0].URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return errInsecureRedirect
+	}
+	return nil
+}
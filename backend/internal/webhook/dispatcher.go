@@ -0,0 +1,544 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/database"
+	"event-ingestion-system/internal/deadletter"
+	"event-ingestion-system/internal/eventtype"
+	"event-ingestion-system/internal/latency"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/requestid"
+	"event-ingestion-system/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// queueSize bounds the number of events waiting for each worker
+	queueSize = 1024
+	// workers is the number of concurrent delivery goroutines
+	workers = 4
+)
+
+// errShuttingDown is why an event dispatched during shutdown was not queued
+var errShuttingDown = errors.New("webhook dispatcher was shutting down")
+
+// Payload is the JSON body posted to webhook endpoints at payload version
+// 1; version 2 posts a models.EventEnvelope
+type Payload struct {
+	Type  string               `json:"type"`
+	Event models.EventResponse `json:"event"`
+	// Deprecation asks the endpoint's owner to move to version 2
+	Deprecation string `json:"deprecation"`
+}
+
+// encodePayload returns the body posted for an event at version
+func encodePayload(version int, messageType string, event models.EventResponse) ([]byte, error) {
+	if version == models.PayloadV2 {
+		return json.Marshal(event.ToEnvelope(messageType))
+	}
+	return json.Marshal(Payload{Type: messageType, Event: event, Deprecation: models.PayloadV1Deprecation})
+}
+
+// job is a queued delivery carrying the trace context and request ID of
+// the request that produced the event, or, without an event, a release of
+// the deliveries held for a tenant's resumed webhooks
+type job struct {
+	ctx     context.Context
+	event   *models.Event
+	release string // tenant ID
+}
+
+// Dispatcher delivers ingested events to tenant webhooks. Deliveries that
+// fail every attempt become dead letters. Each tenant's events go through
+// one worker's queue and are delivered in the order dispatched, each after
+// the previous one's retries; a slow endpoint therefore also delays the
+// tenants sharing its worker and, once their queue fills, the ingest
+// fan-out of their events. Deliveries to paused webhooks are held until
+// they are resumed.
+type Dispatcher struct {
+	db          *database.Database
+	tenants     TenantSource
+	cfg         config.WebhooksConfig
+	client      *http.Client
+	guard       *guard
+	queues      []chan job
+	held        holds
+	deadLetters *deadletter.Store
+	latency     *latency.Tracker
+	logger      *slog.Logger
+
+	// enqueuing is held while an event waits for room in its queue;
+	// Shutdown takes it to start draining, so no event is queued behind
+	// a worker that has finished draining
+	enqueuing sync.RWMutex
+	draining  chan struct{}
+	drainOnce sync.Once
+	stopped   chan struct{}
+}
+
+// NewDispatcher creates a new webhook dispatcher
+func NewDispatcher(db *database.Database, tenants TenantSource, cfg config.WebhooksConfig, deadLetters *deadletter.Store, latencies *latency.Tracker, logger *slog.Logger) *Dispatcher {
+	queues := make([]chan job, workers)
+	for i := range queues {
+		queues[i] = make(chan job, queueSize)
+	}
+	g := newGuard(net.DefaultResolver, cfg.AllowedNetworks)
+	return &Dispatcher{
+		db:          db,
+		tenants:     tenants,
+		cfg:         cfg,
+		client:      newClient(cfg, g),
+		guard:       g,
+		queues:      queues,
+		held:        holds{queues: make(map[uint]*heldQueue)},
+		deadLetters: deadLetters,
+		latency:     latencies,
+		logger:      logger.With("component", "webhooks"),
+
+		draining: make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Run starts the delivery workers and blocks until the context is cancelled
+// or Shutdown has drained the queue. Deliveries still held for paused
+// webhooks then become dead letters.
+func (d *Dispatcher) Run(ctx context.Context) {
+	defer close(d.stopped)
+	defer d.spillHeld()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.releaseHeld(ctx)
+	}()
+	for _, queue := range d.queues {
+		wg.Add(1)
+		go func(queue chan job) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-queue:
+					d.run(ctx, j)
+				case <-d.draining:
+					d.drain(ctx, queue)
+					return
+				}
+			}
+		}(queue)
+	}
+	wg.Wait()
+}
+
+// drain delivers whatever is still in queue, then returns
+func (d *Dispatcher) drain(ctx context.Context, queue chan job) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-queue:
+			d.run(ctx, j)
+		default:
+			return
+		}
+	}
+}
+
+// Shutdown lets the workers deliver the queued events and waits for them
+// to finish. If ctx expires first, cancel Run's context to abandon
+// in-flight retries.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.enqueuing.Lock()
+	d.drainOnce.Do(func() { close(d.draining) })
+	d.enqueuing.Unlock()
+
+	select {
+	case <-d.stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d webhook deliveries still queued: %w", d.QueueDepth(), ctx.Err())
+	}
+}
+
+// Dispatch queues an event for delivery. When the tenant's queue is full
+// it waits for room, which holds back the ingest fan-out worker calling it
+// and, once that worker's queue fills too, the acceptance of new events.
+// An event that cannot be queued, because ctx ends or the dispatcher is
+// shutting down, becomes a dead letter for each webhook it was meant for.
+// Events of tenants whose notifications are muted are not delivered.
+func (d *Dispatcher) Dispatch(ctx context.Context, event *models.Event) {
+	if !d.cfg.Enabled {
+		return
+	}
+	if d.muted(ctx, event.TenantID) {
+		metrics.NotificationMuted("webhook")
+		return
+	}
+
+	if err := d.enqueue(ctx, job{ctx: context.WithoutCancel(ctx), event: event}); err != nil {
+		d.spill(context.WithoutCancel(ctx), event, err)
+	}
+}
+
+// enqueue queues an event on its tenant's worker, waiting for room until
+// ctx ends or the dispatcher starts draining
+func (d *Dispatcher) enqueue(ctx context.Context, j job) error {
+	d.enqueuing.RLock()
+	defer d.enqueuing.RUnlock()
+
+	queue := d.queueFor(j.event.TenantID)
+	select {
+	case <-d.draining:
+		return errShuttingDown
+	default:
+	}
+	select {
+	case queue <- j:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-d.stopped:
+		// Run returned without a drain, its context cancelled
+		return errShuttingDown
+	}
+}
+
+// queueRelease queues a release of the tenant's held deliveries, unless
+// its queue is full; releases are retried every releaseInterval
+func (d *Dispatcher) queueRelease(tenantID string) {
+	select {
+	case d.queueFor(tenantID) <- job{ctx: context.Background(), release: tenantID}:
+	default:
+	}
+}
+
+// queueFor returns the queue of the worker delivering a tenant's events
+func (d *Dispatcher) queueFor(tenantID string) chan job {
+	h := fnv.New32a()
+	h.Write([]byte(tenantID))
+	return d.queues[h.Sum32()%uint32(len(d.queues))]
+}
+
+// spill records an event that could not be queued as a dead letter for
+// each of its tenant's webhooks it matches
+func (d *Dispatcher) spill(ctx context.Context, event *models.Event, cause error) {
+	webhooks, err := d.db.WithContext(ctx).GetWebhooksByTenant(event.TenantID)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "Failed to load webhooks, dropping event", "event_id", event.ID, "tenant_id", event.TenantID, "error", err)
+		return
+	}
+	response := event.ToEventResponse()
+	for _, wh := range webhooks {
+		if !matchesEventType(wh, event.EventType) {
+			continue
+		}
+		body, err := encodePayload(wh.PayloadVersion, "event", response)
+		if err != nil {
+			d.logger.ErrorContext(ctx, "Failed to encode webhook payload", "event_id", event.ID, "error", err)
+			return
+		}
+		metrics.WebhookDelivery("dropped")
+		d.deadLetters.Record(ctx, deadletter.Webhook(wh.ID, event, body, 0, cause))
+	}
+	d.logger.WarnContext(ctx, "Webhook event not queued", "event_id", event.ID, "tenant_id", event.TenantID, "error", cause)
+}
+
+// run carries out a queued job
+func (d *Dispatcher) run(runCtx context.Context, j job) {
+	if j.event == nil {
+		d.release(runCtx, j.release)
+		return
+	}
+	d.deliver(runCtx, j)
+}
+
+// TenantSource looks tenants up, to hold back the events of those whose
+// notifications are muted
+type TenantSource interface {
+	ByID(ctx context.Context, id string) (*models.Tenant, error)
+}
+
+// muted reports whether the tenant's notifications are muted. A tenant that
+// cannot be looked up is not muted.
+func (d *Dispatcher) muted(ctx context.Context, tenantID string) bool {
+	tenant, err := d.tenants.ByID(ctx, tenantID)
+	if err != nil {
+		d.logger.DebugContext(ctx, "Failed to look up tenant mute", "tenant_id", tenantID, "error", err)
+		return false
+	}
+	return tenant.Muted(time.Now())
+}
+
+// Test sends one signed "test" payload to wh with a sample event and
+// returns the delivery error, if any. It is not retried and does not
+// affect the webhook's failure count.
+func (d *Dispatcher) Test(ctx context.Context, wh models.Webhook) error {
+	body, err := encodePayload(wh.PayloadVersion, "test", models.EventResponse{
+		TenantID:  wh.TenantID,
+		EventType: "webhook.test",
+		Timestamp: time.Now().UTC(),
+		Metadata:  json.RawMessage(`{}`),
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return d.send(ctx, wh, body)
+}
+
+// QueueDepth returns the number of events waiting for delivery
+func (d *Dispatcher) QueueDepth() int {
+	depth := 0
+	for _, queue := range d.queues {
+		depth += len(queue)
+	}
+	return depth
+}
+
+// deliver sends an event to every matching webhook of its tenant, after
+// anything held for them while they were paused, and holds it for the
+// paused ones
+func (d *Dispatcher) deliver(runCtx context.Context, j job) {
+	event := j.event
+	ctx, span := tracing.Tracer().Start(j.ctx, "webhook.dispatch",
+		trace.WithAttributes(attribute.String("tenant.id", event.TenantID), attribute.Int64("event.id", int64(event.ID))),
+	)
+	defer span.End()
+
+	// Stop retrying when the dispatcher shuts down, but keep the request's trace
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(runCtx, cancel)
+	defer stop()
+
+	webhooks, err := d.db.WithContext(ctx).GetWebhooksByTenant(event.TenantID)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "Failed to load webhooks", "tenant_id", event.TenantID, "error", err)
+		return
+	}
+
+	// Each payload version is encoded once, from the same response
+	response := event.ToEventResponse()
+	bodies := make(map[int][]byte, 2)
+	for _, wh := range webhooks {
+		if wh.PausedAt == nil {
+			d.catchUp(ctx, wh)
+		}
+		if !matchesEventType(wh, event.EventType) {
+			continue
+		}
+		body, ok := bodies[wh.PayloadVersion]
+		if !ok {
+			body, err = encodePayload(wh.PayloadVersion, "event", response)
+			if err != nil {
+				d.logger.ErrorContext(ctx, "Failed to encode webhook payload", "event_id", event.ID, "error", err)
+				return
+			}
+			bodies[wh.PayloadVersion] = body
+		}
+		metrics.EventPayload("webhook", wh.PayloadVersion)
+		if wh.PausedAt != nil {
+			d.hold(ctx, wh, event, body)
+			continue
+		}
+		d.deliverWithRetry(ctx, wh, event, body)
+	}
+}
+
+// deliverWithRetry posts the payload, retrying up to MaxRetries times
+func (d *Dispatcher) deliverWithRetry(ctx context.Context, wh models.Webhook, event *models.Event, body []byte) {
+	var err error
+	for attempt := 0; attempt <= d.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			metrics.WebhookDelivery("retry")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.cfg.RetryDelay * time.Duration(attempt)):
+			}
+		}
+
+		if err = d.send(ctx, wh, body); err == nil {
+			metrics.WebhookDelivery("success")
+			d.latency.Observe(latency.StageWebhook, event, time.Now())
+			d.recordResult(ctx, wh.ID, nil)
+			return
+		}
+	}
+
+	metrics.WebhookDelivery("failure")
+	d.recordResult(ctx, wh.ID, err)
+	d.logger.WarnContext(ctx, "Webhook delivery failed", "webhook_id", wh.ID, "tenant_id", wh.TenantID, "attempts", d.cfg.MaxRetries+1, "error", err)
+	d.deadLetters.Record(ctx, deadletter.Webhook(wh.ID, event, body, d.cfg.MaxRetries+1, err))
+}
+
+// Redeliver sends a previously failed payload to one of the tenant's
+// webhooks once, without retries, and returns the delivery error
+func (d *Dispatcher) Redeliver(ctx context.Context, tenantID string, webhookID uint, body []byte) error {
+	wh, err := d.db.WithContext(ctx).GetWebhook(tenantID, webhookID)
+	if err != nil {
+		return fmt.Errorf("load webhook %d: %w", webhookID, err)
+	}
+
+	if err := d.send(ctx, *wh, body); err != nil {
+		metrics.WebhookDelivery("failure")
+		d.recordResult(ctx, wh.ID, err)
+		return err
+	}
+	metrics.WebhookDelivery("success")
+	d.recordResult(ctx, wh.ID, nil)
+	return nil
+}
+
+// Deliver posts a payload other than an event, such as a report, to wh and
+// returns the last error. With retry it retries like an event delivery. wh
+// may be a target that is not a stored webhook, in which case its ID is
+// zero. A paused webhook is not sent to.
+func (d *Dispatcher) Deliver(ctx context.Context, wh models.Webhook, body []byte, retry bool) error {
+	if !d.cfg.Enabled {
+		return fmt.Errorf("webhooks are disabled")
+	}
+	if wh.PausedAt != nil {
+		return fmt.Errorf("webhook %d is paused", wh.ID)
+	}
+
+	retries := 0
+	if retry {
+		retries = d.cfg.MaxRetries
+	}
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			metrics.WebhookDelivery("retry")
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(d.cfg.RetryDelay * time.Duration(attempt)):
+			}
+		}
+
+		if err = d.send(ctx, wh, body); err == nil {
+			metrics.WebhookDelivery("success")
+			if wh.ID != 0 {
+				d.recordResult(ctx, wh.ID, nil)
+			}
+			return nil
+		}
+	}
+
+	metrics.WebhookDelivery("failure")
+	if wh.ID != 0 {
+		d.recordResult(ctx, wh.ID, err)
+	}
+	return err
+}
+
+// send performs a single delivery attempt within the webhook's timeouts.
+// A failed attempt returns a *DeliveryError.
+func (d *Dispatcher) send(ctx context.Context, wh models.Webhook, body []byte) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "webhook.deliver",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int64("webhook.id", int64(wh.ID))),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	timeout, connectTimeout := d.timeouts(wh)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ctx = withConnectTimeout(ctx, connectTimeout)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "event-ingestion-system-webhook")
+	if wh.ID != 0 {
+		req.Header.Set("X-Webhook-ID", strconv.FormatUint(uint64(wh.ID), 10))
+	}
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(wh.Secret, timestamp, body))
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return classify(err)
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &DeliveryError{Status: StatusHTTPError, Err: fmt.Errorf("unexpected status %d", resp.StatusCode)}
+	}
+	return nil
+}
+
+// recordResult updates the webhook's delivery bookkeeping with the outcome
+// of its latest attempt, which failed with err unless it is nil
+func (d *Dispatcher) recordResult(ctx context.Context, id uint, err error) {
+	status := Status(err)
+	if err != nil {
+		metrics.WebhookDeliveryError(status)
+	}
+	if err := d.db.WithContext(ctx).UpdateWebhookDeliveryStatus(id, err == nil, status); err != nil {
+		d.logger.ErrorContext(ctx, "Failed to update webhook status", "webhook_id", id, "error", err)
+	}
+}
+
+// Sign computes the hex HMAC-SHA256 of "timestamp.body" with the webhook secret
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// matchesEventType reports whether a webhook subscribes to an event type,
+// its EventTypes being eventtype patterns. An empty list subscribes to
+// everything.
+func matchesEventType(wh models.Webhook, eventType string) bool {
+	if wh.EventTypes == "" {
+		return true
+	}
+
+	var types []string
+	if err := json.Unmarshal([]byte(wh.EventTypes), &types); err != nil {
+		return true
+	}
+	return eventtype.Compile(types).Match(eventType)
+}
@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"event-ingestion-system/internal/deadletter"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+)
+
+// releaseInterval is how often held deliveries are checked for webhooks
+// resumed through another replica
+const releaseInterval = 30 * time.Second
+
+var (
+	errPausedBufferFull = errors.New("webhook is paused and its buffer of held deliveries is full")
+	errPausedShutdown   = errors.New("webhook was paused when the server shut down")
+)
+
+// heldDelivery is a delivery to a paused webhook, kept until it is resumed
+type heldDelivery struct {
+	ctx   context.Context
+	event *models.Event
+	body  []byte
+}
+
+// heldQueue is the deliveries held for one webhook, oldest first
+type heldQueue struct {
+	tenantID   string
+	deliveries []heldDelivery
+}
+
+// holds keeps the deliveries of paused webhooks in memory, per replica.
+// Each tenant's webhooks are only touched by the worker delivering its
+// events, which keeps their deliveries in order.
+type holds struct {
+	mu     sync.Mutex
+	queues map[uint]*heldQueue
+}
+
+// hold keeps a delivery to a paused webhook, unless its buffer is full
+func (d *Dispatcher) hold(ctx context.Context, wh models.Webhook, event *models.Event, body []byte) {
+	d.held.mu.Lock()
+	q := d.held.queues[wh.ID]
+	if q == nil {
+		q = &heldQueue{tenantID: wh.TenantID}
+		d.held.queues[wh.ID] = q
+	}
+	full := len(q.deliveries) >= d.cfg.PausedBufferSize
+	if !full {
+		q.deliveries = append(q.deliveries, heldDelivery{ctx: ctx, event: event, body: body})
+	}
+	d.held.mu.Unlock()
+
+	if full {
+		metrics.WebhookDelivery("dropped")
+		d.deadLetters.Record(ctx, deadletter.Webhook(wh.ID, event, body, 0, errPausedBufferFull))
+		return
+	}
+	metrics.WebhookDelivery("held")
+}
+
+// take removes and returns the deliveries held for a webhook
+func (d *Dispatcher) take(webhookID uint) []heldDelivery {
+	d.held.mu.Lock()
+	defer d.held.mu.Unlock()
+	q := d.held.queues[webhookID]
+	if q == nil {
+		return nil
+	}
+	delete(d.held.queues, webhookID)
+	return q.deliveries
+}
+
+// catchUp delivers what was held for wh while it was paused, oldest first,
+// before anything newer goes to it
+func (d *Dispatcher) catchUp(ctx context.Context, wh models.Webhook) {
+	for _, h := range d.take(wh.ID) {
+		if ctx.Err() != nil {
+			// Shutting down before it could be sent
+			d.deadLetters.Record(h.ctx, deadletter.Webhook(wh.ID, h.event, h.body, 0, errPausedShutdown))
+			continue
+		}
+		d.deliverWithRetry(ctx, wh, h.event, h.body)
+	}
+}
+
+// release delivers the held deliveries of the tenant's webhooks that are
+// no longer paused. Those of webhooks that were deleted or deactivated in
+// the meantime are dropped, as their new events are.
+func (d *Dispatcher) release(ctx context.Context, tenantID string) {
+	webhooks, err := d.db.WithContext(ctx).GetWebhooksByTenant(tenantID)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "Failed to load webhooks", "tenant_id", tenantID, "error", err)
+		return
+	}
+	current := make(map[uint]models.Webhook, len(webhooks))
+	for _, wh := range webhooks {
+		current[wh.ID] = wh
+	}
+
+	for _, id := range d.heldWebhooks(tenantID) {
+		wh, ok := current[id]
+		switch {
+		case !ok:
+			if dropped := len(d.take(id)); dropped > 0 {
+				d.logger.InfoContext(ctx, "Dropped deliveries held for a removed webhook", "webhook_id", id, "tenant_id", tenantID, "deliveries", dropped)
+			}
+		case wh.PausedAt == nil:
+			d.catchUp(ctx, wh)
+		}
+	}
+}
+
+// heldWebhooks returns the IDs of the tenant's webhooks with held
+// deliveries
+func (d *Dispatcher) heldWebhooks(tenantID string) []uint {
+	d.held.mu.Lock()
+	defer d.held.mu.Unlock()
+	var ids []uint
+	for id, q := range d.held.queues {
+		if q.tenantID == tenantID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Resume has the held deliveries of the tenants' resumed webhooks sent
+// now, rather than with their next event. Other replicas catch up within
+// releaseInterval.
+func (d *Dispatcher) Resume(tenantIDs ...string) {
+	for _, tenantID := range tenantIDs {
+		d.queueRelease(tenantID)
+	}
+}
+
+// releaseHeld periodically queues a release for every tenant with held
+// deliveries, until ctx is cancelled or the dispatcher drains
+func (d *Dispatcher) releaseHeld(ctx context.Context) {
+	ticker := time.NewTicker(releaseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.draining:
+			return
+		case <-ticker.C:
+			d.held.mu.Lock()
+			tenants := make(map[string]bool)
+			for _, q := range d.held.queues {
+				tenants[q.tenantID] = true
+			}
+			d.held.mu.Unlock()
+			for tenantID := range tenants {
+				d.queueRelease(tenantID)
+			}
+		}
+	}
+}
+
+// HeldDeliveries returns the number of deliveries held for paused webhooks
+func (d *Dispatcher) HeldDeliveries() int {
+	d.held.mu.Lock()
+	defer d.held.mu.Unlock()
+	n := 0
+	for _, q := range d.held.queues {
+		n += len(q.deliveries)
+	}
+	return n
+}
+
+// spillHeld turns the deliveries still held when the dispatcher stops into
+// dead letters, which can be retried once the webhooks are resumed
+func (d *Dispatcher) spillHeld() {
+	d.held.mu.Lock()
+	queues := d.held.queues
+	d.held.queues = make(map[uint]*heldQueue)
+	d.held.mu.Unlock()
+
+	for id, q := range queues {
+		for _, h := range q.deliveries {
+			d.deadLetters.Record(h.ctx, deadletter.Webhook(id, h.event, h.body, 0, errPausedShutdown))
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"event-ingestion-system/internal/models"
+)
+
+// TestEncodePayloadVersions checks both versions carry the same event and
+// only version 1 is told it is deprecated
+func TestEncodePayloadVersions(t *testing.T) {
+	processed := time.Date(2026, 3, 14, 15, 9, 27, 0, time.UTC)
+	event := models.EventResponse{
+		ID:            42,
+		TenantID:      "tenant-1",
+		EventType:     "order.placed",
+		Sequence:      7,
+		Timestamp:     time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC),
+		Metadata:      json.RawMessage(`{"total":12.5}`),
+		ProcessedAt:   &processed,
+		CreatedAt:     processed,
+		CorrelationID: "checkout-1",
+	}
+
+	data, err := encodePayload(models.PayloadV1, "event", event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v1 Payload
+	if err := json.Unmarshal(data, &v1); err != nil {
+		t.Fatal(err)
+	}
+	if v1.Type != "event" || v1.Deprecation != models.PayloadV1Deprecation || !reflect.DeepEqual(v1.Event, event) {
+		t.Fatalf("version 1 payload = %s", data)
+	}
+
+	if data, err = encodePayload(models.PayloadV2, "test", event); err != nil {
+		t.Fatal(err)
+	}
+	var v2 models.EventEnvelope
+	if err := json.Unmarshal(data, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.Version != models.PayloadV2 || v2.Type != "test" || !reflect.DeepEqual(v2.ToEventResponse(), event) {
+		t.Fatalf("version 2 payload = %s", data)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["deprecation"]; ok {
+		t.Fatalf("version 2 payload = %s, want no deprecation", data)
+	}
+}
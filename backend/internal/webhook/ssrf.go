@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// Webhook URLs are chosen by tenants, so deliveries must not reach the
+// service's own network: loopback, private and link-local addresses, where
+// cloud instance metadata lives, and other ranges that are not routed on
+// the internet. Checking the URL when the webhook is saved is not enough,
+// as its host can resolve elsewhere later, or differently on every lookup.
+// Each connection therefore resolves the host itself, checks every address
+// and connects to a checked one, so there is no second lookup to rebind;
+// redirects go through the same dial. webhooks.allowed_networks admits
+// internal endpoints. Through a proxy, which connects on our behalf, the
+// target is checked the same way but the proxy resolves it again.
+
+// reservedPrefixes are blocked besides what netip classifies as loopback,
+// private, link-local, multicast or unspecified
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which embeds IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("2002::/16"),      // 6to4, which embeds IPv4
+	netip.MustParsePrefix("2001::/32"),      // Teredo, which embeds IPv4
+}
+
+// Resolver looks up the addresses of a host; net.DefaultResolver is one,
+// and tests can substitute their own
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// ForbiddenAddressError is a delivery refused because its host resolved
+// only to blocked addresses
+type ForbiddenAddressError struct {
+	Host string
+	Addr netip.Addr
+}
+
+func (e *ForbiddenAddressError) Error() string {
+	if addr, err := netip.ParseAddr(e.Host); err == nil && addr.Unmap() == e.Addr {
+		return fmt.Sprintf("address %s is not allowed", e.Addr)
+	}
+	return fmt.Sprintf("host %s resolves to %s, which is not allowed", e.Host, e.Addr)
+}
+
+// guard resolves and checks the addresses deliveries connect to
+type guard struct {
+	resolver Resolver
+	allowed  []netip.Prefix
+}
+
+// newGuard creates a guard admitting the allowed networks, CIDR ranges or
+// single addresses that config validation has already checked
+func newGuard(resolver Resolver, allowed []string) *guard {
+	g := &guard{resolver: resolver}
+	for _, network := range allowed {
+		if prefix, err := parseNetwork(network); err == nil {
+			g.allowed = append(g.allowed, prefix)
+		}
+	}
+	return g
+}
+
+// parseNetwork parses a CIDR range or a single address
+func parseNetwork(network string) (netip.Prefix, error) {
+	if strings.Contains(network, "/") {
+		prefix, err := netip.ParsePrefix(network)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(network)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// permitted reports whether deliveries may connect to addr
+func (g *guard) permitted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range g.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve returns the permitted addresses of host, in the resolver's
+// order, or a *ForbiddenAddressError when there are none
+func (g *guard) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		resolved, err := g.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range resolved {
+			if addr, ok := netip.AddrFromSlice(ip.IP); ok {
+				addrs = append(addrs, addr.Unmap())
+			}
+		}
+	}
+
+	permitted := addrs[:0:0]
+	var forbidden netip.Addr
+	for _, addr := range addrs {
+		if g.permitted(addr) {
+			permitted = append(permitted, addr)
+		} else if !forbidden.IsValid() {
+			forbidden = addr
+		}
+	}
+	if len(permitted) == 0 {
+		if !forbidden.IsValid() {
+			return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+		}
+		return nil, &ForbiddenAddressError{Host: host, Addr: forbidden}
+	}
+	return permitted, nil
+}
+
+// dial connects to a permitted address of addr's host with dial, trying
+// each in turn. The address checked is the one connected to.
+func (g *guard) dial(ctx context.Context, network, addr string, dial func(ctx context.Context, network, addr string) (net.Conn, error)) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := g.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for _, ip := range addrs {
+		conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// CheckURL refuses a webhook URL whose host is a blocked address or
+// localhost. Hosts are not resolved here; every delivery checks them.
+func (d *Dispatcher) CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !d.guard.permitted(addr) {
+			return &ForbiddenAddressError{Host: host, Addr: addr.Unmap()}
+		}
+		return nil
+	}
+	if (host == "localhost" || strings.HasSuffix(host, ".localhost")) && !d.guard.permitted(netip.MustParseAddr("127.0.0.1")) {
+		return errors.New("localhost is not allowed")
+	}
+	return nil
+}
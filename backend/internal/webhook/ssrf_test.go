@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// flippingResolver answers each lookup with the next of its answers, as a
+// rebinding DNS server alternates between a public and a private address
+type flippingResolver struct {
+	answers [][]string
+	lookups int
+}
+
+func (r *flippingResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	answer := r.answers[r.lookups%len(r.answers)]
+	r.lookups++
+	addrs := make([]net.IPAddr, len(answer))
+	for i, a := range answer {
+		addrs[i] = net.IPAddr{IP: net.ParseIP(a)}
+	}
+	return addrs, nil
+}
+
+// fakeConn is the connection a recording dial returns
+type fakeConn struct{ net.Conn }
+
+func TestGuardPermitted(t *testing.T) {
+	g := newGuard(nil, []string{"10.1.0.0/16", "192.168.7.7"})
+	for _, tc := range []struct {
+		addr string
+		ok   bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // instance metadata
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"::", false},
+		// IPv4-mapped addresses are checked as the IPv4 address
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::ffff:93.184.216.34", true},
+		// 6to4, NAT64 and Teredo embed IPv4 addresses a gateway would
+		// reach, so they are refused whatever they embed
+		{"2002:7f00:1::", false},
+		{"2002:5db8:d822::", false},
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b:1::a00:1", false},
+		{"2001:0:4136:e378:8000:63bf:3fff:fdd2", false},
+		// webhooks.allowed_networks admits internal endpoints
+		{"10.1.2.3", true},
+		{"::ffff:10.1.2.3", true},
+		{"192.168.7.7", true},
+		{"192.168.7.8", false},
+	} {
+		if got := g.permitted(netip.MustParseAddr(tc.addr)); got != tc.ok {
+			t.Errorf("permitted(%s) = %v, want %v", tc.addr, got, tc.ok)
+		}
+	}
+}
+
+// TestGuardDialsTheAddressItChecked resolves a host whose answers flip
+// between a public and a private address. Each dial connects to the
+// address its own lookup checked, so a rebinding answer is refused rather
+// than connected to.
+func TestGuardDialsTheAddressItChecked(t *testing.T) {
+	resolver := &flippingResolver{answers: [][]string{{"93.184.216.34"}, {"169.254.169.254"}}}
+	g := newGuard(resolver, nil)
+	var dialed []string
+	dial := func(_ context.Context, _, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return fakeConn{}, nil
+	}
+	ctx := context.Background()
+
+	if _, err := g.dial(ctx, "tcp", "hooks.example.com:443", dial); err != nil {
+		t.Fatalf("dial while public: %v", err)
+	}
+	_, err := g.dial(ctx, "tcp", "hooks.example.com:443", dial)
+	var forbidden *ForbiddenAddressError
+	if !errors.As(err, &forbidden) || forbidden.Addr != netip.MustParseAddr("169.254.169.254") {
+		t.Fatalf("dial once rebound: err = %v, want the private address refused", err)
+	}
+	if _, err := g.dial(ctx, "tcp", "hooks.example.com:443", dial); err != nil {
+		t.Fatalf("dial once public again: %v", err)
+	}
+
+	// One lookup per dial, and only the checked address connected to
+	if resolver.lookups != 3 {
+		t.Fatalf("lookups = %d, want one per dial", resolver.lookups)
+	}
+	want := []string{"93.184.216.34:443", "93.184.216.34:443"}
+	if strings.Join(dialed, " ") != strings.Join(want, " ") {
+		t.Fatalf("dialed %v, want %v", dialed, want)
+	}
+}
+
+func TestGuardResolve(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		host   string
+		answer []string
+		want   []string
+		// forbidden is the address reported when none are permitted
+		forbidden string
+	}{
+		{name: "public", host: "hooks.example.com", answer: []string{"93.184.216.34"}, want: []string{"93.184.216.34"}},
+		{name: "private answers dropped", host: "hooks.example.com", answer: []string{"10.0.0.1", "93.184.216.34", "::1"}, want: []string{"93.184.216.34"}},
+		{name: "mapped answer unmapped", host: "hooks.example.com", answer: []string{"::ffff:93.184.216.34"}, want: []string{"93.184.216.34"}},
+		{name: "only private", host: "hooks.example.com", answer: []string{"127.0.0.1", "10.0.0.1"}, forbidden: "127.0.0.1"},
+		{name: "mapped private", host: "hooks.example.com", answer: []string{"::ffff:169.254.169.254"}, forbidden: "169.254.169.254"},
+		{name: "NAT64 of a private address", host: "hooks.example.com", answer: []string{"64:ff9b::a9fe:a9fe"}, forbidden: "64:ff9b::a9fe:a9fe"},
+		{name: "6to4 of loopback", host: "hooks.example.com", answer: []string{"2002:7f00:1::1"}, forbidden: "2002:7f00:1::1"},
+		// Literal hosts are not looked up
+		{name: "literal", host: "93.184.216.34", want: []string{"93.184.216.34"}},
+		{name: "private literal", host: "::ffff:127.0.0.1", forbidden: "127.0.0.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := &flippingResolver{answers: [][]string{tc.answer}}
+			addrs, err := newGuard(resolver, nil).resolve(context.Background(), tc.host)
+			if tc.forbidden != "" {
+				var forbidden *ForbiddenAddressError
+				if !errors.As(err, &forbidden) || forbidden.Addr.Unmap() != netip.MustParseAddr(tc.forbidden) {
+					t.Fatalf("resolve = %v, %v, want %s refused", addrs, err, tc.forbidden)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, addr := range addrs {
+				got = append(got, addr.String())
+			}
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Fatalf("resolve = %v, want %v", got, tc.want)
+			}
+			if net.ParseIP(tc.host) != nil && resolver.lookups != 0 {
+				t.Fatalf("literal host looked up %d times", resolver.lookups)
+			}
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	d := &Dispatcher{guard: newGuard(nil, nil)}
+	for _, tc := range []struct {
+		url string
+		ok  bool
+	}{
+		{"https://hooks.example.com/events", true},
+		{"https://93.184.216.34/events", true},
+		// Names are resolved on delivery, not here
+		{"https://internal.example.com/events", true},
+		{"http://127.0.0.1:8080/events", false},
+		{"http://[::1]/events", false},
+		{"http://[::ffff:169.254.169.254]/latest/meta-data", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[64:ff9b::a9fe:a9fe]/", false},
+		{"http://[2002:7f00:1::]/", false},
+		{"http://localhost:3000/", false},
+		{"http://LOCALHOST./", false},
+		{"http://api.localhost/", false},
+		{"http://localhost.example.com/", true},
+	} {
+		if err := d.CheckURL(tc.url); (err == nil) != tc.ok {
+			t.Errorf("CheckURL(%s) = %v, want ok %v", tc.url, err, tc.ok)
+		}
+	}
+
+	// Allowing loopback admits localhost too
+	d = &Dispatcher{guard: newGuard(nil, []string{"127.0.0.0/8"})}
+	if err := d.CheckURL("http://localhost:3000/"); err != nil {
+		t.Fatalf("CheckURL(localhost) with loopback allowed = %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package websocket
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrAlreadyDraining is returned by Drain once a drain has started
+var ErrAlreadyDraining = errors.New("websocket connections are already draining")
+
+// restartFrame closes the connections left when a drain's deadline passes
+var restartFrame = websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting")
+
+// DrainStatus reports a drain of the hub's connections
+type DrainStatus struct {
+	Draining  bool       `json:"draining"`
+	Message   string     `json:"message,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+	// Closed is set once the connections left at the deadline are closed
+	Closed      bool `json:"closed"`
+	Connections int  `json:"connections"`
+}
+
+// drainState is a drain under way; it lasts until the process exits
+type drainState struct {
+	message   string
+	startedAt time.Time
+	deadline  time.Time
+	closed    bool
+}
+
+// reconnectRequested is the payload of the reconnect_requested message
+type reconnectRequested struct {
+	Message  string    `json:"message,omitempty"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// Drain asks every client to reconnect to another instance ahead of a
+// restart. New connections are refused from now on, and those still open
+// after deadline are closed with code 1012 (service restart).
+func (h *Hub) Drain(deadline time.Duration, message string) (DrainStatus, error) {
+	now := time.Now().UTC()
+	h.drainMu.Lock()
+	if h.drain != nil {
+		h.drainMu.Unlock()
+		return h.DrainStatus(), ErrAlreadyDraining
+	}
+	state := &drainState{message: message, startedAt: now, deadline: now.Add(deadline)}
+	h.drain = state
+	h.drainMu.Unlock()
+
+	notice, err := typedMessage("reconnect_requested", reconnectRequested{Message: message, Deadline: state.deadline})
+	if err != nil {
+		return DrainStatus{}, err
+	}
+	queued := queue(notice)
+	h.mu.RLock()
+	for client := range h.clients {
+		h.trySend(client, queued)
+	}
+	h.mu.RUnlock()
+
+	time.AfterFunc(deadline, func() {
+		select {
+		case h.drained <- struct{}{}:
+		default:
+		}
+	})
+	h.logger.Info("Draining WebSocket connections", "deadline", state.deadline, "connections", h.Stats().Connections)
+	return h.DrainStatus(), nil
+}
+
+// DrainStatus returns the state of the drain, if one has started
+func (h *Hub) DrainStatus() DrainStatus {
+	connections := h.Stats().Connections
+
+	h.drainMu.Lock()
+	defer h.drainMu.Unlock()
+	if h.drain == nil {
+		return DrainStatus{Connections: connections}
+	}
+	startedAt, deadline := h.drain.startedAt, h.drain.deadline
+	return DrainStatus{
+		Draining:    true,
+		Message:     h.drain.message,
+		StartedAt:   &startedAt,
+		Deadline:    &deadline,
+		Closed:      h.drain.closed,
+		Connections: connections,
+	}
+}
+
+// Draining reports whether a drain has started
+func (h *Hub) Draining() bool {
+	h.drainMu.Lock()
+	defer h.drainMu.Unlock()
+	return h.drain != nil
+}
+
+// drainRetryAfter returns the whole seconds until the drain's deadline, at
+// least 1, and whether a drain has started
+func (h *Hub) drainRetryAfter() (int, bool) {
+	h.drainMu.Lock()
+	defer h.drainMu.Unlock()
+	if h.drain == nil {
+		return 0, false
+	}
+	seconds := int(time.Until(h.drain.deadline).Seconds()) + 1
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds, true
+}
+
+// closeDrained closes the connections left at the drain's deadline. Must
+// be called from Run.
+func (h *Hub) closeDrained() {
+	h.mu.Lock()
+	closed := len(h.clients)
+	for client := range h.clients {
+		client.closeFrame = restartFrame
+		close(client.send)
+		delete(h.clients, client)
+		h.unregistered(client)
+	}
+	h.mu.Unlock()
+
+	h.drainMu.Lock()
+	h.drain.closed = true
+	h.drainMu.Unlock()
+	h.logger.Info("Drain deadline passed, closed remaining WebSocket connections", "connections", closed)
+}
@@ -3,15 +3,28 @@ package websocket
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"event-ingestion-system/internal/config"
+	apperrors "event-ingestion-system/internal/errors"
+	"event-ingestion-system/internal/eventtype"
+	"event-ingestion-system/internal/flags"
+	"event-ingestion-system/internal/metrics"
 	"event-ingestion-system/internal/models"
+	"event-ingestion-system/internal/tracing"
+	"event-ingestion-system/internal/views"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var upgrader = websocket.Upgrader{
@@ -25,46 +38,161 @@ var upgrader = websocket.Upgrader{
 // Client represents a WebSocket client
 type Client struct {
 	conn     *websocket.Conn
-	send     chan []byte
+	send     chan outbound
 	tenantID string
+	// payloadVersion is the event payload the client asked for
+	payloadVersion int
+	// metadata is how much of their metadata events carry, as
+	// models.EventResponse.WithMetadata takes it
+	metadata string
+	// correlationID, when set, limits the events sent to one workflow's
+	correlationID string
+	// eventTypes limits the events sent by type; nil sends every type
+	eventTypes *eventtype.Matcher
+
+	// closeFrame is written when send is closed; set before closing send
+	closeFrame []byte
+	// replayedUpTo is the last sequence number written by replay; queued
+	// events at or below it are skipped. Only touched by writePump.
+	replayedUpTo uint64
+	// throughput is set while the client is subscribed to throughput
+	throughput atomic.Bool
+}
+
+// outbound is a message queued for clients, with when it was queued
+type outbound struct {
+	data   []byte
+	queued time.Time
+}
+
+// queue stamps a message being queued now
+func queue(data []byte) outbound {
+	return outbound{data: data, queued: time.Now()}
 }
 
 // Hub manages WebSocket connections
 type Hub struct {
 	clients    map[*Client]bool
-	broadcast  chan []byte
+	broadcast  chan outbound
 	register   chan *Client
 	unregister chan *Client
+	shutdown   chan chan struct{}
 	mu         sync.RWMutex
-	config     *config.WebSocketConfig
+
+	// closed is set once Shutdown has run; only touched by Run
+	closed bool
+	// writers tracks writePump goroutines so Shutdown can wait for the
+	// close frames to go out
+	writers sync.WaitGroup
+	config  *config.WebSocketConfig
+	events  EventSource
+	tenants TenantSource
+	logger  *slog.Logger
+	// waiters holds parked long-poll requests
+	waiters waiters
+	// rates holds a *rateCounter per tenant ID
+	rates sync.Map
+
+	throttledMessages   atomic.Int64
+	rateLimitedClosures atomic.Int64
+	oversizedClosures   atomic.Int64
+	registrations       atomic.Int64
+	unregistrations     atomic.Int64
+	messagesSent        atomic.Int64
+	messagesDropped     atomic.Int64
+	messagesMuted       atomic.Int64
+	replaysTruncated    atomic.Int64
+	// latencyTotal sums the nanoseconds between queueing and writing the
+	// messagesWritten messages that went through a send buffer
+	latencyTotal    atomic.Int64
+	messagesWritten atomic.Int64
+
+	// drain is set by Drain; drained is signalled at its deadline
+	drainMu sync.Mutex
+	drain   *drainState
+	drained chan struct{}
+}
+
+// HubStats is a point-in-time snapshot of hub counters
+type HubStats struct {
+	Connections int `json:"connections"`
+	// TenantConnections counts connections per tenant ID
+	TenantConnections map[string]int `json:"tenant_connections"`
+	// BufferedMessages is queued for broadcast or in send buffers;
+	// MaxSendBuffer is the fullest client's send buffer
+	BufferedMessages    int   `json:"buffered_messages"`
+	MaxSendBuffer       int   `json:"max_send_buffer"`
+	ThrottledMessages   int64 `json:"throttled_messages"`
+	RateLimitedClosures int64 `json:"rate_limited_closures"`
+	Registrations       int64 `json:"registrations"`
+	Unregistrations     int64 `json:"unregistrations"`
+	MessagesSent        int64 `json:"messages_sent"`
+	MessagesDropped     int64 `json:"messages_dropped"`
+	ReplaysTruncated    int64 `json:"replays_truncated"`
+	// MessagesMuted were held back because their tenant was muted
+	MessagesMuted int64 `json:"messages_muted"`
+	// OversizedClosures were closed for a message over max_message_size
+	OversizedClosures int64 `json:"oversized_closures"`
+	// AvgBroadcastLatencyMs is the mean time from queueing a message for
+	// a client to writing it, since startup
+	AvgBroadcastLatencyMs float64 `json:"avg_broadcast_latency_ms"`
 }
 
 // NewHub creates a new WebSocket hub
-func NewHub(cfg *config.WebSocketConfig) *Hub {
+func NewHub(cfg *config.WebSocketConfig, events EventSource, tenants TenantSource, logger *slog.Logger) *Hub {
 	return &Hub{
 		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte, 256),
+		broadcast:  make(chan outbound, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		shutdown:   make(chan chan struct{}),
+		drained:    make(chan struct{}, 1),
 		config:     cfg,
+		events:     events,
+		tenants:    tenants,
+		logger:     logger.With("component", "websocket"),
 	}
 }
 
 // Run starts the hub's main loop
 func (h *Hub) Run(ctx context.Context) {
+	throughput := time.NewTicker(h.config.ThroughputInterval)
+	defer throughput.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-throughput.C:
+			h.sendThroughput()
 		case client := <-h.register:
+			if h.closed {
+				client.closeFrame = goingAwayFrame
+				close(client.send)
+				continue
+			}
+			if h.Draining() {
+				// Upgraded just as the drain started
+				client.closeFrame = restartFrame
+				close(client.send)
+				continue
+			}
 			h.mu.Lock()
 			h.clients[client] = true
 			h.mu.Unlock()
+			h.registrations.Add(1)
+			metrics.WebSocketRegistered(client.tenantID)
+		case done := <-h.shutdown:
+			h.closeAll()
+			close(done)
+		case <-h.drained:
+			h.closeDrained()
 		case client := <-h.unregister:
 			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
 				close(client.send)
 				delete(h.clients, client)
+				h.unregistered(client)
 			}
 			h.mu.Unlock()
 		case message := <-h.broadcast:
@@ -73,8 +201,7 @@ func (h *Hub) Run(ctx context.Context) {
 				select {
 				case client.send <- message:
 				default:
-					close(client.send)
-					delete(h.clients, client)
+					h.dropSlowClient(client)
 				}
 			}
 			h.mu.RUnlock()
@@ -82,56 +209,391 @@ func (h *Hub) Run(ctx context.Context) {
 	}
 }
 
-// BroadcastToTenant sends a message to all clients of a specific tenant
-func (h *Hub) BroadcastToTenant(tenantID string, event *models.Event) error {
-	data, err := json.Marshal(event.ToEventResponse())
-	if err != nil {
-		return err
+// goingAwayFrame tells clients the server is shutting down so they reconnect
+var goingAwayFrame = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+
+// closeAll delivers queued broadcasts, then closes every client with a
+// going-away frame. Must be called from Run.
+func (h *Hub) closeAll() {
+	h.closed = true
+	h.ReleaseWaiters()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+drain:
+	for {
+		select {
+		case message := <-h.broadcast:
+			for client := range h.clients {
+				select {
+				case client.send <- message:
+				default:
+				}
+			}
+		default:
+			break drain
+		}
+	}
+
+	for client := range h.clients {
+		client.closeFrame = goingAwayFrame
+		close(client.send)
+		delete(h.clients, client)
+		h.unregistered(client)
+	}
+}
+
+// unregistered counts a client removed from clients
+func (h *Hub) unregistered(client *Client) {
+	h.unregistrations.Add(1)
+	metrics.WebSocketUnregistered(client.tenantID)
+}
+
+// dropSlowClient disconnects a client whose send buffer is full, losing
+// the message that didn't fit. The caller holds mu.
+func (h *Hub) dropSlowClient(client *Client) {
+	close(client.send)
+	delete(h.clients, client)
+	h.unregistered(client)
+	h.messagesDropped.Add(1)
+	metrics.WebSocketClientDropped()
+}
+
+// written counts a message written to a client, queued at queued
+func (h *Hub) written(queued time.Time) {
+	h.messagesSent.Add(1)
+	h.latencyTotal.Add(int64(time.Since(queued)))
+	h.messagesWritten.Add(1)
+	metrics.WebSocketMessageWritten(queued)
+}
+
+// Shutdown flushes queued messages and closes all connections with a
+// going-away frame, waiting until the frames are written or ctx expires.
+// Connections opened afterwards are closed immediately.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case h.shutdown <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	written := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(written)
+	}()
+	select {
+	case <-written:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of the hub counters
+func (h *Hub) Stats() HubStats {
+	stats := HubStats{
+		TenantConnections:   make(map[string]int),
+		ThrottledMessages:   h.throttledMessages.Load(),
+		RateLimitedClosures: h.rateLimitedClosures.Load(),
+		OversizedClosures:   h.oversizedClosures.Load(),
+		Registrations:       h.registrations.Load(),
+		Unregistrations:     h.unregistrations.Load(),
+		MessagesSent:        h.messagesSent.Load(),
+		MessagesDropped:     h.messagesDropped.Load(),
+		MessagesMuted:       h.messagesMuted.Load(),
+		ReplaysTruncated:    h.replaysTruncated.Load(),
+	}
+	if written := h.messagesWritten.Load(); written > 0 {
+		stats.AvgBroadcastLatencyMs = float64(h.latencyTotal.Load()) / float64(written) / float64(time.Millisecond)
 	}
 
 	h.mu.RLock()
+	stats.Connections = len(h.clients)
+	stats.BufferedMessages = len(h.broadcast)
+	for client := range h.clients {
+		stats.TenantConnections[client.tenantID]++
+		stats.BufferedMessages += len(client.send)
+		stats.MaxSendBuffer = max(stats.MaxSendBuffer, len(client.send))
+	}
+	h.mu.RUnlock()
+	return stats
+}
+
+// TenantConnections counts the tenant's connections to this hub
+func (h *Hub) TenantConnections(tenantID string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
 	for client := range h.clients {
 		if client.tenantID == tenantID {
-			select {
-			case client.send <- data:
-			default:
-				close(client.send)
-				delete(h.clients, client)
+			n++
+		}
+	}
+	return n
+}
+
+// SendBufferLengths returns the number of messages waiting in each
+// client's send buffer
+func (h *Hub) SendBufferLengths() []int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	lengths := make([]int, 0, len(h.clients))
+	for client := range h.clients {
+		lengths = append(lengths, len(client.send))
+	}
+	return lengths
+}
+
+// BroadcastToTenant sends a message to all clients of a specific tenant,
+// unless its notifications are muted. Long polls are woken either way.
+func (h *Hub) BroadcastToTenant(ctx context.Context, tenantID string, event *models.Event) error {
+	_, span := tracing.Tracer().Start(ctx, "hub.broadcast")
+	defer span.End()
+
+	recipients := 0
+	defer func() {
+		span.SetAttributes(attribute.String("tenant.id", tenantID), attribute.Int("hub.recipients", recipients))
+	}()
+
+	if h.muted(ctx, tenantID) {
+		h.wakeWaiters(tenantID)
+		return nil
+	}
+
+	// Each payload version and metadata mode is encoded once, for its
+	// first recipient
+	type encoding struct {
+		version  int
+		metadata string
+	}
+	response := event.ToEventResponse()
+	messages := make(map[encoding]outbound)
+	var err error
+	h.mu.RLock()
+	for client := range h.clients {
+		if client.tenantID != tenantID || !client.follows(event) {
+			continue
+		}
+		key := encoding{client.payloadVersion, client.metadata}
+		message, ok := messages[key]
+		if !ok {
+			var data []byte
+			if data, err = encodeEvent(client.payloadVersion, response.WithMetadata(client.metadata)); err != nil {
+				break
 			}
+			message = queue(data)
+			messages[key] = message
+		}
+		recipients++
+		metrics.EventPayload("websocket", client.payloadVersion)
+		select {
+		case client.send <- message:
+		default:
+			h.dropSlowClient(client)
 		}
 	}
 	h.mu.RUnlock()
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	h.wakeWaiters(tenantID)
+	return nil
+}
 
+// Notify sends a typed message, such as a maintenance notice, to every
+// connected client. The message is dropped if the broadcast queue is full.
+func (h *Hub) Notify(messageType string, payload interface{}) error {
+	data, err := typedMessage(messageType, payload)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case h.broadcast <- queue(data):
+	default:
+		h.messagesDropped.Add(1)
+		metrics.WebSocketNoticeDropped()
+		h.logger.Warn("Broadcast queue full, dropping notice", "type", messageType)
+	}
 	return nil
 }
 
-// HandleWebSocket handles WebSocket connections
+// NotifyTenant sends a typed message, such as an alert, to one tenant's
+// clients, unless its notifications are muted. A client whose queue is
+// full misses the message.
+func (h *Hub) NotifyTenant(tenantID, messageType string, payload interface{}) error {
+	if h.muted(context.Background(), tenantID) {
+		return nil
+	}
+	data, err := typedMessage(messageType, payload)
+	if err != nil {
+		return err
+	}
+
+	message := queue(data)
+	h.mu.RLock()
+	for client := range h.clients {
+		if client.tenantID == tenantID {
+			h.trySend(client, message)
+		}
+	}
+	h.mu.RUnlock()
+	return nil
+}
+
+// follows reports whether the client is sent event
+func (c *Client) follows(event *models.Event) bool {
+	return (c.correlationID == "" || event.CorrelationID == c.correlationID) && c.eventTypes.Match(event.EventType)
+}
+
+// encodeEvent encodes an event message at a payload version
+func encodeEvent(version int, event models.EventResponse) ([]byte, error) {
+	if version == models.PayloadV2 {
+		return json.Marshal(event.ToEnvelope("event"))
+	}
+	return json.Marshal(event)
+}
+
+// deprecationNotice is the payload of the deprecation message sent to
+// clients connecting with payload version 1
+type deprecationNotice struct {
+	PayloadVersion int    `json:"payload_version"`
+	Deprecation    string `json:"deprecation"`
+}
+
+// typedMessage encodes a WebSocketMessage
+func typedMessage(messageType string, payload interface{}) ([]byte, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(WebSocketMessage{Type: messageType, Payload: raw})
+}
+
+// HandleWebSocket handles WebSocket connections. With ?after_sequence=N the
+// tenant's stored events after N are replayed before live events, and
+// ?payload_version=2 asks for events as models.EventEnvelope; clients on
+// version 1, the default unless the tenant has the payload_v2 flag, are
+// first sent a deprecation message. ?metadata=summary or none leaves large
+// metadata out of events in favor of a reference to the URL serving it, as
+// the REST endpoints do.
+// ?correlation_id= limits events, replayed or live, to those of one
+// workflow, and ?event_type= to comma-separated eventtype patterns such as
+// checkout.* or !heartbeat; notices still reach the client. While the hub
+// drains, connections are refused with 503.
 func (h *Hub) HandleWebSocket(c *gin.Context) {
 	tenantID := c.GetString("tenant_id")
 	if tenantID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
+	if retryAfter, draining := h.drainRetryAfter(); draining {
+		c.Error(apperrors.ErrDraining(retryAfter))
+		c.Abort()
+		return
+	}
+
+	var replayAfter *uint64
+	if a := c.Query("after_sequence"); a != "" {
+		parsed, err := strconv.ParseUint(a, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after_sequence parameter"})
+			return
+		}
+		replayAfter = &parsed
+	}
+
+	correlationID := c.Query("correlation_id")
+	if utf8.RuneCountInString(correlationID) > 128 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "correlation_id must be at most 128 characters"})
+		return
+	}
+
+	var eventTypes []string
+	if t := c.Query("event_type"); t != "" {
+		eventTypes = strings.Split(t, ",")
+	}
+	if len(eventTypes) > views.MaxEventTypes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("event_type: at most %d patterns allowed", views.MaxEventTypes)})
+		return
+	}
+	for _, t := range eventTypes {
+		if err := eventtype.Validate(t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "event_type: " + err.Error()})
+			return
+		}
+	}
+
+	payloadVersion := models.PayloadV1
+	switch c.Query("payload_version") {
+	case "":
+		if flags.IsEnabled(c.Request.Context(), flags.PayloadV2) {
+			payloadVersion = models.PayloadV2
+		}
+	case "1":
+	case "2":
+		payloadVersion = models.PayloadV2
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "payload_version must be 1 or 2"})
+		return
+	}
+
+	metadata := c.DefaultQuery("metadata", models.MetadataFull)
+	switch metadata {
+	case models.MetadataFull, models.MetadataSummary, models.MetadataNone:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "metadata must be full, summary or none"})
+		return
+	}
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
+		h.logger.Warn("WebSocket upgrade failed", "tenant_id", tenantID, "error", err)
 		return
 	}
 
 	client := &Client{
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		tenantID: tenantID,
+		conn:           conn,
+		send:           make(chan outbound, 256),
+		tenantID:       tenantID,
+		payloadVersion: payloadVersion,
+		metadata:       metadata,
+		correlationID:  correlationID,
+		eventTypes:     eventtype.Compile(eventTypes),
 	}
 
+	h.writers.Add(1)
 	h.register <- client
 
-	go client.writePump(h.config)
+	go func() {
+		defer h.writers.Done()
+		if payloadVersion == models.PayloadV1 &&
+			!client.writeNotice("deprecation", deprecationNotice{PayloadVersion: models.PayloadV1, Deprecation: models.PayloadV1Deprecation}, h.config) {
+			client.conn.Close()
+			return
+		}
+		if replayAfter != nil && !client.replay(h, *replayAfter, h.config) {
+			client.conn.Close()
+			return
+		}
+		client.writePump(h)
+	}()
 	go client.readPump(h, h.config)
 }
 
 // writePump writes messages to the WebSocket connection
-func (c *Client) writePump(cfg *config.WebSocketConfig) {
+func (c *Client) writePump(h *Hub) {
+	cfg := h.config
 	ticker := time.NewTicker(cfg.PingInterval)
 	defer func() {
 		ticker.Stop()
@@ -143,13 +605,18 @@ func (c *Client) writePump(cfg *config.WebSocketConfig) {
 		case message, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeFrame)
 				return
 			}
 
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			if c.replayedUpTo > 0 && c.replayed(message.data) {
+				continue
+			}
+
+			if err := c.conn.WriteMessage(websocket.TextMessage, message.data); err != nil {
 				return
 			}
+			h.written(message.queued)
 
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
@@ -167,20 +634,70 @@ func (c *Client) readPump(h *Hub, cfg *config.WebSocketConfig) {
 		c.conn.Close()
 	}()
 
+	// A frame announcing more than the limit fails before its payload is
+	// read, and the connection answers it with 1009 itself
+	c.conn.SetReadLimit(cfg.MaxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout))
 		return nil
 	})
 
+	limiter := newTokenBucket(cfg.MessageRateLimit, cfg.MessageBurst)
+	violations := 0
+
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				// Log error if needed
+			if err == websocket.ErrReadLimit {
+				h.oversizedClosures.Add(1)
+				metrics.WebSocketOversizedClosure()
+				h.logger.Warn("Closing WebSocket for a message over the size limit", "tenant_id", c.tenantID, "limit", cfg.MaxMessageSize)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				h.logger.Warn("WebSocket closed unexpectedly", "tenant_id", c.tenantID, "error", err)
 			}
 			break
 		}
+
+		if !limiter.allow(time.Now()) {
+			violations++
+			h.throttledMessages.Add(1)
+
+			if cfg.MaxRateViolations > 0 && violations >= cfg.MaxRateViolations {
+				h.rateLimitedClosures.Add(1)
+				h.logger.Warn("Closing WebSocket for sustained rate limit violations", "tenant_id", c.tenantID)
+				c.conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded"),
+					time.Now().Add(cfg.WriteTimeout),
+				)
+				break
+			}
+
+			h.trySend(c, queue(rateLimitErrorMessage))
+			continue
+		}
+		violations = 0
+		c.handleMessage(h, data)
+	}
+}
+
+// rateLimitErrorMessage is sent to clients whose messages are being throttled
+var rateLimitErrorMessage = []byte(`{"type":"error","code":"rate_limit_exceeded","message":"Too many messages. Slow down."}`)
+
+// trySend queues a message for the client without blocking the caller;
+// the message is skipped if the client's send buffer is full
+func (h *Hub) trySend(c *Client, message outbound) {
+	defer func() {
+		// The send channel may already be closed by the hub
+		recover()
+	}()
+
+	select {
+	case c.send <- message:
+	default:
+		h.messagesDropped.Add(1)
+		metrics.WebSocketMessageSkipped()
 	}
 }
 
@@ -0,0 +1,31 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+)
+
+// TenantSource looks tenants up, to hold back messages for those whose
+// notifications are muted
+type TenantSource interface {
+	ByID(ctx context.Context, id string) (*models.Tenant, error)
+}
+
+// muted reports whether the tenant's notifications are muted, counting the
+// message held back if so. A tenant that cannot be looked up is not muted.
+func (h *Hub) muted(ctx context.Context, tenantID string) bool {
+	tenant, err := h.tenants.ByID(ctx, tenantID)
+	if err != nil {
+		h.logger.DebugContext(ctx, "Failed to look up tenant mute", "tenant_id", tenantID, "error", err)
+		return false
+	}
+	if !tenant.Muted(time.Now()) {
+		return false
+	}
+	h.messagesMuted.Add(1)
+	metrics.NotificationMuted("websocket")
+	return true
+}
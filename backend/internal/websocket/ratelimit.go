@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"time"
+)
+
+// tokenBucket throttles client-originated messages on a single connection.
+// It is only touched from the connection's readPump, so it needs no locking.
+type tokenBucket struct {
+	rate     float64
+	burst    float64
+	tokens   float64
+	lastFill time.Time
+}
+
+// newTokenBucket creates a full bucket, or nil when rate limiting is disabled
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:     rate,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		lastFill: time.Now(),
+	}
+}
+
+// allow consumes a token if one is available
+func (b *tokenBucket) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+
+	b.tokens += now.Sub(b.lastFill).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.lastFill = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+
+	"event-ingestion-system/internal/config"
+	"event-ingestion-system/internal/metrics"
+	"event-ingestion-system/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// replayPageSize is the number of stored events fetched per query
+	replayPageSize = 500
+	// maxReplay bounds the events replayed to one connection; clients
+	// further behind catch up through the poll endpoint
+	maxReplay = 10000
+)
+
+// EventSource supplies stored events to replay when a client reconnects
+// with ?after_sequence=N
+type EventSource interface {
+	GetEventsAfterSequence(tenantID string, after uint64, limit int) ([]models.Event, error)
+}
+
+// replay writes the tenant's stored events after the given sequence number
+// before any live message. The client is registered first, so events stored
+// meanwhile arrive live as well; writePump drops those already replayed. It
+// reports whether the connection is still usable.
+func (c *Client) replay(h *Hub, after uint64, cfg *config.WebSocketConfig) bool {
+	c.replayedUpTo = after
+	sent := 0
+	for sent < maxReplay {
+		events, err := h.events.GetEventsAfterSequence(c.tenantID, c.replayedUpTo, min(replayPageSize, maxReplay-sent))
+		if err != nil {
+			h.logger.Error("Failed to load events for replay", "tenant_id", c.tenantID, "after_sequence", c.replayedUpTo, "error", err)
+			return c.writeNotice("replay_failed", map[string]uint64{"last_sequence": c.replayedUpTo}, cfg)
+		}
+		for _, event := range events {
+			if !c.follows(&event) {
+				c.replayedUpTo = event.Sequence
+				continue
+			}
+			data, err := encodeEvent(c.payloadVersion, event.ToEventResponse().WithMetadata(c.metadata))
+			if err != nil {
+				return false
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return false
+			}
+			h.messagesSent.Add(1)
+			metrics.WebSocketMessageSent()
+			metrics.EventPayload("websocket", c.payloadVersion)
+			c.replayedUpTo = event.Sequence
+		}
+		sent += len(events)
+		if len(events) < replayPageSize {
+			return true
+		}
+	}
+
+	// Tell the client where replay stopped so it can page through the rest
+	h.replaysTruncated.Add(1)
+	metrics.WebSocketReplayTruncated()
+	return c.writeNotice("replay_truncated", map[string]uint64{"last_sequence": c.replayedUpTo}, cfg)
+}
+
+// writeNotice writes a typed message directly, bypassing the send queue
+func (c *Client) writeNotice(messageType string, payload interface{}, cfg *config.WebSocketConfig) bool {
+	data, err := typedMessage(messageType, payload)
+	if err != nil {
+		return false
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+	return c.conn.WriteMessage(websocket.TextMessage, data) == nil
+}
+
+// replayed reports whether a queued message is an event already written by
+// replay
+func (c *Client) replayed(message []byte) bool {
+	var event struct {
+		Sequence *uint64 `json:"sequence"`
+	}
+	if err := json.Unmarshal(message, &event); err != nil || event.Sequence == nil {
+		return false
+	}
+	return *event.Sequence <= c.replayedUpTo
+}
@@ -0,0 +1,176 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// throughputWindows are the rolling windows rates are reported over, in
+// seconds
+var throughputWindows = []struct {
+	name    string
+	seconds int64
+}{{"1s", 1}, {"10s", 10}, {"60s", 60}}
+
+// throughputSeconds is how many seconds of counts a tenant keeps, the
+// longest window
+const throughputSeconds = 60
+
+// Throughput is a tenant's rate of ingested events on this replica, in
+// events per second over each window ending with the last whole second
+type Throughput struct {
+	TenantID string             `json:"tenant_id"`
+	Rates    map[string]float64 `json:"rates"`
+	At       time.Time          `json:"at"`
+}
+
+// throughputMessage is the message carrying a Throughput
+type throughputMessage struct {
+	Type string `json:"type"` // always "throughput"
+	Throughput
+}
+
+// rateCounter counts a tenant's events per second over the last minute
+type rateCounter struct {
+	mu sync.Mutex
+	// counts[s%throughputSeconds] holds the events of Unix second s, as
+	// long as seconds[s%throughputSeconds] is s
+	counts  [throughputSeconds]int64
+	seconds [throughputSeconds]int64
+	last    int64
+}
+
+// add counts an event in second now
+func (r *rateCounter) add(now int64) {
+	r.mu.Lock()
+	i := now % throughputSeconds
+	if r.seconds[i] != now {
+		r.seconds[i], r.counts[i] = now, 0
+	}
+	r.counts[i]++
+	r.last = now
+	r.mu.Unlock()
+}
+
+// rates returns the events per second over each window ending before
+// second now
+func (r *rateCounter) rates(now int64) map[string]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rates := make(map[string]float64, len(throughputWindows))
+	for _, window := range throughputWindows {
+		var total int64
+		for s := now - window.seconds; s < now; s++ {
+			if i := s % throughputSeconds; r.seconds[i] == s {
+				total += r.counts[i]
+			}
+		}
+		rates[window.name] = float64(total) / float64(window.seconds)
+	}
+	return rates
+}
+
+// idle reports whether the counter has seen no event within the longest
+// window
+func (r *rateCounter) idle(now int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return now-r.last > throughputSeconds
+}
+
+// ObserveIngest counts an event ingested for the tenant. The ingest path
+// calls it for every stored event, whether or not anyone is connected.
+func (h *Hub) ObserveIngest(tenantID string) {
+	counter, ok := h.rates.Load(tenantID)
+	if !ok {
+		counter, _ = h.rates.LoadOrStore(tenantID, &rateCounter{})
+	}
+	counter.(*rateCounter).add(time.Now().Unix())
+}
+
+// Throughput returns the tenant's ingest rates on this replica
+func (h *Hub) Throughput(tenantID string) Throughput {
+	now := time.Now()
+	t := Throughput{TenantID: tenantID, At: now.UTC().Truncate(time.Second)}
+	if counter, ok := h.rates.Load(tenantID); ok {
+		t.Rates = counter.(*rateCounter).rates(now.Unix())
+	} else {
+		t.Rates = (&rateCounter{}).rates(now.Unix())
+	}
+	return t
+}
+
+// sendThroughput sends each client subscribed to throughput its tenant's
+// rates, and forgets tenants idle for longer than the longest window. An
+// event counted by a tenant being forgotten may be lost, which a soft
+// real-time figure tolerates.
+func (h *Hub) sendThroughput() {
+	now := time.Now().Unix()
+	h.rates.Range(func(tenantID, counter any) bool {
+		if counter.(*rateCounter).idle(now) {
+			h.rates.Delete(tenantID)
+		}
+		return true
+	})
+
+	messages := make(map[string]outbound)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		if !client.throughput.Load() {
+			continue
+		}
+		message, ok := messages[client.tenantID]
+		if !ok {
+			data, err := json.Marshal(throughputMessage{Type: "throughput", Throughput: h.Throughput(client.tenantID)})
+			if err != nil {
+				h.logger.Error("Failed to encode throughput", "tenant_id", client.tenantID, "error", err)
+				return
+			}
+			message = queue(data)
+			messages[client.tenantID] = message
+		}
+		h.trySend(client, message)
+	}
+}
+
+// subscription is a message clients send to start or stop receiving a
+// channel: {"type":"subscribe","channels":["throughput"]} or "unsubscribe"
+type subscription struct {
+	Type     string   `json:"type"`
+	Channels []string `json:"channels"`
+}
+
+// unknownChannelMessage answers a subscription naming a channel that does
+// not exist
+var unknownChannelMessage = []byte(`{"type":"error","code":"unknown_channel","message":"Channels are: throughput"}`)
+
+// handleMessage acts on a message from the client. Anything but a
+// subscription is ignored, as before clients could subscribe.
+func (c *Client) handleMessage(h *Hub, data []byte) {
+	var msg subscription
+	if err := json.Unmarshal(data, &msg); err != nil || (msg.Type != "subscribe" && msg.Type != "unsubscribe") {
+		return
+	}
+	for _, channel := range msg.Channels {
+		if channel != "throughput" {
+			h.trySend(c, queue(unknownChannelMessage))
+			return
+		}
+	}
+	if len(msg.Channels) == 0 {
+		return
+	}
+
+	if msg.Type == "unsubscribe" {
+		c.throughput.Store(false)
+		return
+	}
+	if !c.throughput.Swap(true) {
+		// Answer at once rather than at the next interval
+		if data, err := json.Marshal(throughputMessage{Type: "throughput", Throughput: h.Throughput(c.tenantID)}); err == nil {
+			h.trySend(c, queue(data))
+		}
+	}
+}
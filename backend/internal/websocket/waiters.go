@@ -0,0 +1,81 @@
+package websocket
+
+import "sync"
+
+// waiters parks long-poll requests until an event for their tenant is
+// broadcast. The zero value is ready to use.
+type waiters struct {
+	mu       sync.Mutex
+	tenants  map[string]map[chan struct{}]struct{}
+	released bool
+}
+
+// closed is handed out once waiters are released, so new waits return at once
+var closed = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// WaitForEvent registers interest in the next event broadcast to tenantID.
+// The returned channel is closed when one is, or when ReleaseWaiters runs.
+// Register before checking for existing events so none is missed in
+// between. cancel must be called once the wait is over.
+func (h *Hub) WaitForEvent(tenantID string) (wake <-chan struct{}, cancel func()) {
+	w := &h.waiters
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.released {
+		return closed, func() {}
+	}
+	if w.tenants == nil {
+		w.tenants = make(map[string]map[chan struct{}]struct{})
+	}
+	set := w.tenants[tenantID]
+	if set == nil {
+		set = make(map[chan struct{}]struct{})
+		w.tenants[tenantID] = set
+	}
+	ch := make(chan struct{})
+	set[ch] = struct{}{}
+
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if set, ok := w.tenants[tenantID]; ok {
+			delete(set, ch)
+			if len(set) == 0 {
+				delete(w.tenants, tenantID)
+			}
+		}
+	}
+}
+
+// wakeWaiters releases every request waiting for tenantID
+func (h *Hub) wakeWaiters(tenantID string) {
+	w := &h.waiters
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.tenants[tenantID] {
+		close(ch)
+	}
+	delete(w.tenants, tenantID)
+}
+
+// ReleaseWaiters wakes every waiting request and makes later waits return
+// immediately, so long polls answer before the HTTP server drains
+func (h *Hub) ReleaseWaiters() {
+	w := &h.waiters
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.released = true
+	for tenantID, set := range w.tenants {
+		for ch := range set {
+			close(ch)
+		}
+		delete(w.tenants, tenantID)
+	}
+}
@@ -2,239 +2,115 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 	"time"
 
-	"event-ingestion-system/internal/auth"
+	"event-ingestion-system/internal/app"
 	"event-ingestion-system/internal/config"
-	"event-ingestion-system/internal/database"
-	"event-ingestion-system/internal/handlers"
-	"event-ingestion-system/internal/middleware"
-	"event-ingestion-system/internal/websocket"
-
-	"github.com/gin-gonic/gin"
+	"event-ingestion-system/internal/logging"
+	"event-ingestion-system/internal/seed"
+	"event-ingestion-system/internal/version"
 )
 
 func main() {
-	// Load configuration
-	cfg, err := config.LoadConfig("config.yaml")
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+	// Load configuration; the file is optional unless named explicitly
+	configFlag := flag.String("config", "", "path to the YAML config file (default $CONFIG_PATH or config.yaml)")
+	seedFlag := flag.Bool("seed", false, "populate the database with demo tenants, webhooks and events, then exit")
+	seedTenants := flag.Int("seed-tenants", 5, "number of demo tenants for -seed")
+	seedEvents := flag.Int("seed-events", 10000, "number of events -seed adds")
+	seedRange := flag.Duration("seed-range", 30*24*time.Hour, "how far back -seed spreads event timestamps")
+	seedForce := flag.Bool("seed-force", false, "allow -seed when app.env is production")
+	compressFlag := flag.Bool("compress-metadata", false, "compress the stored metadata of events above database.compress_metadata_above, report the space saved and exit")
+	compressBatch := flag.Int("compress-batch", 1000, "events -compress-metadata reads per transaction")
+	checkFlag := flag.Bool("check", false, "check the config, database and configured dependencies, print a JSON report and exit 1 if any check fails")
+	migrateFlag := flag.Bool("migrate", false, "apply pending database migrations, waiting for any other process migrating, and exit")
+	migratePlanFlag := flag.Bool("migrate-plan", false, "print the pending database migrations without applying them and exit")
+	flag.Parse()
+
+	configPath, required := *configFlag, true
+	if configPath == "" {
+		configPath = os.Getenv("CONFIG_PATH")
 	}
-
-	// Set Gin mode
-	gin.SetMode(cfg.App.Mode)
-
-	// Determine database driver from environment or config
-	driver := os.Getenv("DB_DRIVER")
-	if driver == "" {
-		driver = cfg.Database.Driver
+	if configPath == "" {
+		configPath, required = "config.yaml", false
 	}
 
-	// Determine DSN based on driver
-	var dsn string
-	var dbHost string
-	var dbPort string
-	var dbUser string
-	var dbPassword string
-	var dbName string
-
-	if driver == "postgres" {
-		// PostgreSQL: Read from environment variables
-		dbHost = os.Getenv("DB_HOST")
-		dbPort = os.Getenv("DB_PORT")
-		if dbPort == "" {
-			dbPort = "5432"
-		}
-		dbUser = os.Getenv("DB_USER")
-		dbPassword = os.Getenv("DB_PASSWORD")
-		dbName = os.Getenv("DB_NAME")
-		if dbName == "" {
-			dbName = "render"
-		}
-
-		if dbHost == "" || dbUser == "" || dbPassword == "" {
-			log.Fatal("PostgreSQL configuration error: DB_HOST, DB_USER, and DB_PASSWORD are required")
-		}
-
-		dsn = database.BuildDSN(dbHost, dbPort, dbUser, dbPassword, dbName)
-		log.Printf("Connecting to PostgreSQL: host=%s port=%s database=%s", dbHost, dbPort, dbName)
-	} else {
-		// SQLite: Check for DATABASE_PATH env var first, then fall back to config
-		dbPath := os.Getenv("DATABASE_PATH")
-		if dbPath == "" {
-			dbPath = cfg.Database.Host
+	if *checkFlag {
+		if !app.RunCheck(context.Background(), configPath, required, os.Stdout, os.Stderr) {
+			os.Exit(1)
 		}
-		dsn = dbPath
-		log.Printf("Using SQLite database: %s", dsn)
+		return
 	}
 
-	// Initialize database
-	db, err := database.NewDatabase(
-		driver,
-		dsn,
-		cfg.Database.MaxOpenConns,
-		cfg.Database.MaxIdleConns,
-		cfg.Database.ConnMaxLifetime,
-	)
+	cfg, err := config.LoadConfig(configPath, required)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-	}
-	defer db.Close()
-
-	// Run migrations
-	if err := db.Migrate(); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
-	}
-
-	// Initialize WebSocket hub
-	wsCfg := &config.WebSocketConfig{
-		PingInterval:    cfg.WebSocket.PingInterval,
-		PongTimeout:     cfg.WebSocket.PongTimeout,
-		WriteTimeout:    cfg.WebSocket.WriteTimeout,
-		ReadBufferSize:  cfg.WebSocket.ReadBufferSize,
-		WriteBufferSize: cfg.WebSocket.WriteBufferSize,
+		log.Fatalf("Failed to load config: %v", err)
 	}
-	hub := websocket.NewHub(wsCfg)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	go hub.Run(ctx)
+	// Initialize structured logging; the stdlib log package is routed through it too
+	logger := logging.New(cfg.Logging, os.Stdout)
+	slog.SetDefault(logger)
 
-	// Initialize auth middleware
-	authMiddleware := auth.NewAuthMiddleware(
-		db,
-		cfg.Auth.JWTSecret,
-		cfg.Auth.JWTExpiry,
-		cfg.Auth.APIKeyHeader,
+	build := version.Get()
+	logger.Info("event-ingestion-system starting",
+		"version", build.Version,
+		"commit", build.Commit,
+		"build_date", build.BuildDate,
+		"go_version", build.GoVersion,
 	)
-
-	// Initialize rate limiter
-	rateLimiter := middleware.NewRateLimiter(cfg.RateLimit.RequestsPerMinute)
-
-	// Initialize handlers
-	handler := handlers.NewHandler(db, hub, authMiddleware)
-
-	// Determine port - use PORT env var (set by Render) or config default
-	port := cfg.App.Port
-	if envPort := os.Getenv("PORT"); envPort != "" {
-		if p, err := strconv.Atoi(envPort); err == nil {
-			port = p
-		}
+	if _, err := os.Stat(configPath); err != nil {
+		logger.Info("No config file found, using defaults and environment variables", "path", configPath)
 	}
 
-	// Setup router
-	router := setupRouter(handler, authMiddleware, rateLimiter, cfg, db)
-
-	// Create server
-	srv := &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", cfg.App.Host, port),
-		Handler: router,
-	}
-
-	// Start server in goroutine
-	go func() {
-		log.Printf("Starting server on %s:%d", cfg.App.Host, port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+	switch {
+	case *seedFlag:
+		opts := seed.Options{Tenants: *seedTenants, Events: *seedEvents, Range: *seedRange, Force: *seedForce}
+		if err := app.Seed(context.Background(), cfg, opts, os.Stdout, logger); err != nil {
+			fatal(logger, "Failed to seed the database", err)
 		}
-	}()
-
-	// Wait for interrupt signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Println("Shutting down server...")
-
-	// Graceful shutdown with timeout
-	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	case *migratePlanFlag:
+		if err := app.PrintMigrationPlan(cfg, os.Stdout, logger); err != nil {
+			fatal(logger, "Failed to plan database migrations", err)
+		}
+	case *migrateFlag:
+		if err := app.Migrate(cfg, logger); err != nil {
+			fatal(logger, "Failed to migrate the database", err)
+		}
+	case *compressFlag:
+		if err := app.CompressMetadata(cfg, *compressBatch, os.Stdout, logger); err != nil {
+			fatal(logger, "Failed to compress event metadata", err)
+		}
+	default:
+		serve(cfg, logger)
 	}
-
-	log.Println("Server exited")
 }
 
-func setupRouter(handler *handlers.Handler, authMiddleware *auth.AuthMiddleware, rateLimiter *middleware.RateLimiter, cfg *config.Config, db *database.Database) *gin.Engine {
-	router := gin.New()
-	router.Use(gin.Recovery())
-	router.Use(gin.Logger())
-	router.Use(corsMiddleware())
-
-	// Debug endpoint to show all routes
-	router.GET("/debug/routes", func(c *gin.Context) {
-		routes := router.Routes()
-		c.JSON(200, gin.H{"routes": routes})
-	})
-
-	// Health check (no auth required)
-	router.GET("/health", handler.HealthCheck)
-
-	// API v1 - Public routes (no auth required)
-	router.POST("/api/v1/tenants", handler.CreateTenant)
-	router.GET("/api/v1/tenants", handler.GetTenants)
-	router.GET("/api/v1/tenants-with-keys", handler.GetTenantsWithKeys)
-
-	// API v1 - Protected routes (auth required)
-	protected := router.Group("/api/v1")
-	protected.Use(authMiddleware.Authenticate())
-	protected.Use(middleware.RateLimitMiddleware(rateLimiter, cfg.RateLimit.Enabled))
-	{
-		// Tenants
-		protected.GET("/tenants/:id", handler.GetTenant)
-		protected.GET("/tenants/:id/token", handler.GetAuthToken)
-
-		// Events
-		protected.POST("/events", handler.IngestEvent)
-		protected.GET("/events", handler.GetEvents)
-		protected.GET("/events/stats", handler.GetEventStats)
+// serve runs the server until SIGINT or SIGTERM
+func serve(cfg *config.Config, logger *slog.Logger) {
+	srv, err := app.New(cfg, logger)
+	if err != nil {
+		fatal(logger, "Failed to start", err)
 	}
 
-	// WebSocket endpoint
-	router.GET("/api/v1/ws", func(c *gin.Context) {
-		// Try to authenticate from query param first
-		apiKey := c.Query("api_key")
-		if apiKey != "" {
-			tenant, err := db.GetTenantByAPIKey(apiKey)
-			if err == nil && tenant.Active {
-				c.Set("tenant_id", tenant.ID)
-				c.Set("api_key", apiKey)
-				c.Set("auth_type", "api_key")
-				hub := handler.GetHub()
-				hub.HandleWebSocket(c)
-				return
-			}
-		}
-		// Fall back to normal auth
-		authMiddleware.Authenticate()(c)
-		hub := handler.GetHub()
-		hub.HandleWebSocket(c)
-	})
-
-	return router
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := srv.Run(ctx); err != nil {
+		fatal(logger, "Server exited with errors", err)
+	}
+	logger.Info("Server exited")
 }
 
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-API-Key")
-		c.Header("Access-Control-Max-Age", "86400")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
-
-		c.Next()
+// fatal logs an error and exits the process
+func fatal(logger *slog.Logger, msg string, err error) {
+	if err != nil {
+		logger.Error(msg, "error", err)
+	} else {
+		logger.Error(msg)
 	}
+	os.Exit(1)
 }
@@ -9,6 +9,14 @@ interface Event {
   created_at: string
 }
 
+// Events arrive as payload version 2 envelopes; other message types are notices
+interface EventEnvelope {
+  type: string
+  id: number
+  tenant_id: string
+  data: Omit<Event, 'id' | 'tenant_id'>
+}
+
 interface EventFeedProps {
   tenantId: string
   tenantApiKey: string
@@ -34,7 +42,7 @@ export default function EventFeed({ tenantId, tenantApiKey, tenantName, connecti
   // WebSocket connection
   useEffect(() => {
     const connectWebSocket = () => {
-      const wsUrl = `${WS_URL}?api_key=${tenantApiKey}`
+      const wsUrl = `${WS_URL}?api_key=${tenantApiKey}&payload_version=2`
       
       try {
         const ws = new WebSocket(wsUrl)
@@ -46,7 +54,11 @@ export default function EventFeed({ tenantId, tenantApiKey, tenantName, connecti
 
         ws.onmessage = (event) => {
           try {
-            const newEvent = JSON.parse(event.data) as Event
+            const message = JSON.parse(event.data) as EventEnvelope
+            if (message.type !== 'event') {
+              return
+            }
+            const newEvent: Event = { id: message.id, tenant_id: message.tenant_id, ...message.data }
             setEvents(prev => {
               // Check if event already exists to avoid duplicates
               if (prev.some(e => e.id === newEvent.id)) {